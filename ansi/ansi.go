@@ -54,6 +54,11 @@ func NewFor(f *os.File) *Colorer {
 	return &Colorer{isTTY(f.Fd())}
 }
 
+// New returns a Colorer that colors whether or not the output is a tty.
+func New(enabled bool) *Colorer {
+	return &Colorer{enabled}
+}
+
 func (c *Colorer) Fg(s string, color Color, style Style) string {
 	return c.FgBg(s, color, style, Colorless, Normal)
 }
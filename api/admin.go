@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/reqid"
+	"github.com/hound-search/hound/searcher"
+)
+
+// The body of a request to add a repo: its name along with the same
+// fields as a repo in the config.
+type addRepoRequest struct {
+	Name string `json:"name"`
+	config.Repo
+}
+
+func methodNotAllowed(w http.ResponseWriter) {
+	writeError(w,
+		errors.New(http.StatusText(http.StatusMethodNotAllowed)),
+		http.StatusMethodNotAllowed)
+}
+
+// SetupAdmin registers the handlers for managing the repos of a running
+// instance. They are meant to be served behind the admin token.
+func SetupAdmin(m *http.ServeMux, set *searcher.Set) {
+	m.HandleFunc("/api/v1/admin/repos", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			status := set.Status()
+			repo := r.FormValue("repo")
+			if repo == "" {
+				writeResp(w, status)
+				return
+			}
+
+			if status[repo] == nil {
+				writeError(w,
+					newError(codeUnknownRepo, map[string]string{"repo": repo}, "No such repository: %s", repo),
+					http.StatusNotFound)
+				return
+			}
+			writeResp(w, map[string]*searcher.RepoStatus{repo: status[repo]})
+		case "POST":
+			var req addRepoRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+
+			if req.Name == "" || req.URL == "" {
+				writeError(w, errors.New("A repo needs a name and a url"), http.StatusBadRequest)
+				return
+			}
+
+			if err := set.Add(req.Name, &req.Repo); err != nil {
+				writeError(w, err, http.StatusConflict)
+				return
+			}
+			writeJson(w, "ok", http.StatusAccepted)
+		case "DELETE":
+			if err := set.Remove(r.FormValue("repo")); err != nil {
+				writeError(w, err, http.StatusNotFound)
+				return
+			}
+			writeResp(w, "ok")
+		default:
+			methodNotAllowed(w)
+		}
+	})
+
+	m.HandleFunc("/api/v1/admin/config", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			methodNotAllowed(w)
+			return
+		}
+		writeResp(w, set.Config())
+	})
+
+	m.HandleFunc("/api/v1/admin/reindex", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			methodNotAllowed(w)
+			return
+		}
+
+		repo := r.FormValue("repo")
+		srch := set.Get(repo)
+		if srch == nil {
+			err := repoError(set, repo)
+			writeError(w, err, repoErrorStatus(err))
+			return
+		}
+
+		// a new index that the canary of the repo would refuse can be
+		// served anyway.
+		reindex := srch.Reindex
+		if parseAsBool(r.FormValue("skip-canary")) {
+			reindex = srch.Accept
+		}
+		if !reindex(reqid.FromContext(r.Context())) {
+			writeError(w,
+				fmt.Errorf("Updates are not enabled for repository %s", repo),
+				http.StatusForbidden)
+			return
+		}
+		writeJson(w, "ok", http.StatusAccepted)
+	})
+
+	setupHealth(m, set)
+	setupAdminUsage(m, set)
+}
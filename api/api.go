@@ -6,18 +6,50 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/federation"
+	"github.com/hound-search/hound/hooks"
 	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/reqid"
 	"github.com/hound-search/hound/searcher"
+	"github.com/hound-search/hound/vcs"
 )
 
 const (
 	defaultLinesOfContext uint = 2
 	maxLinesOfContext     uint = 20
+
+	// The value of the mode parameter that selects structural search.
+	// Any other mode is a regexp search.
+	structuralMode = "structural"
+
+	// The values of the case parameter. Smart case ignores case unless
+	// the pattern has an upper case letter, as ripgrep does.
+	caseSensitive   = "sensitive"
+	caseInsensitive = "insensitive"
+	caseSmart       = "smart"
+
+	// The most lines that can be blamed in one request.
+	maxBlameLines = 1000
+
+	// The regions of similar code returned by default, and at most.
+	defaultSimilarLimit uint = 100
+	maxSimilarLimit     uint = 1000
+
+	// The share of the fingerprints of a snippet that a region needs by
+	// default to be similar.
+	defaultSimilarScore = 0.5
+
+	// The chunks returned by a semantic search by default, and at most.
+	defaultSemanticLimit uint = 20
+	maxSemanticLimit     uint = 200
 )
 
 type Stats struct {
@@ -38,10 +70,12 @@ func writeResp(w http.ResponseWriter, data interface{}) {
 	writeJson(w, data, http.StatusOK)
 }
 
-func writeError(w http.ResponseWriter, err error, status int) {
-	writeJson(w, map[string]string{
-		"Error": err.Error(),
-	}, status)
+// What the downstream instances of a gateway returned for a search.
+type remoteResponse struct {
+	res         map[string]*index.SearchResponse
+	unavailable map[string]string
+	filesOpened int
+	err         error
 }
 
 type searchResponse struct {
@@ -59,7 +93,8 @@ func searchAll(
 	repos []string,
 	idx map[string]*searcher.Searcher,
 	filesOpened *int,
-	duration *int) (map[string]*index.SearchResponse, error) {
+	duration *int,
+	debug map[string]*RepoDebug) (map[string]*index.SearchResponse, error) {
 
 	startedAt := time.Now()
 
@@ -81,7 +116,13 @@ func searchAll(
 			return nil, r.err
 		}
 
-		if r.res.Matches == nil {
+		// the repos without matches are the ones that debug is most
+		// often asked about.
+		if debug != nil {
+			debug[r.repo] = newRepoDebug(r.res)
+		}
+
+		if r.res.Matches == nil && r.res.FilenameHits == nil {
 			continue
 		}
 
@@ -94,6 +135,96 @@ func searchAll(
 	return res, nil
 }
 
+// filterTerm matches the owner:, module:, pkg:, modified: and author: terms
+// of a query, along with the backslash that escapes one.
+var filterTerm = regexp.MustCompile(`(^|\s)(\\?)(owner|module|pkg|modified|author):(\S+)`)
+
+// Take the filter terms out of a query. They scope the search to some of
+// the files of each repo, like the parameters of the same names, which they
+// take the place of. A term with a backslash in front, like \pkg:=, is
+// searched for as it is, without the backslash.
+func parseQueryFilters(q string, opt *index.SearchOptions) string {
+	return strings.TrimSpace(filterTerm.ReplaceAllStringFunc(q, func(t string) string {
+		m := filterTerm.FindStringSubmatch(t)
+		if m[2] != "" {
+			return m[1] + t[len(m[1])+1:]
+		}
+
+		switch m[3] {
+		case "owner":
+			opt.Owner = m[4]
+		case "module":
+			opt.Module = m[4]
+		case "pkg":
+			opt.Package = m[4]
+		case "modified":
+			opt.Modified = m[4]
+		case "author":
+			opt.Author = m[4]
+		}
+		return m[1]
+	}))
+}
+
+// Put a backslash in front of the terms of a pattern that would be taken
+// for filter terms, so that a query of it searches for them.
+func escapeFilters(pat string) string {
+	return filterTerm.ReplaceAllStringFunc(pat, func(t string) string {
+		m := filterTerm.FindStringSubmatch(t)
+		if m[2] != "" {
+			return t
+		}
+		return m[1] + `\` + t[len(m[1]):]
+	})
+}
+
+// Set the searches that a search refines, whose filter terms scope it as
+// they scoped them. The filters of the search itself are parsed after
+// these so that they win.
+func parseWithin(within []string, opt *index.SearchOptions) {
+	for _, w := range within {
+		if w = parseQueryFilters(w, opt); w != "" {
+			opt.Within = append(opt.Within, w)
+		}
+	}
+}
+
+// Parse the time a search asks for the index of, which is either a time
+// in RFC 3339 or a date, that stands for the end of the day in UTC. An
+// empty value is the zero time.
+func parseAsTime(v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid time %q, expected a date like 2006-01-02 or an RFC 3339 time", v)
+	}
+	return t.Add(24*time.Hour - time.Nanosecond), nil
+}
+
+// Whether a search of pat ignores case, by its case parameter if it is
+// set, or else by its i parameter.
+func parseIgnoreCase(mode string, i bool, pat string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "":
+		return i, nil
+	case caseSensitive:
+		return false, nil
+	case caseInsensitive:
+		return true, nil
+	case caseSmart:
+		return !index.HasUpperCase(pat), nil
+	}
+	return false, fmt.Errorf("Invalid case %q, expected sensitive, insensitive or smart", mode)
+}
+
 // Used for parsing flags from form values.
 func parseAsBool(v string) bool {
 	v = strings.ToLower(v)
@@ -119,6 +250,86 @@ func parseAsRepoList(v string, idx map[string]*searcher.Searcher) []string {
 	return repos
 }
 
+// The repos of a search: those of the comma separated list v, or those of
+// the default scope of the config if v doesn't name any.
+func parseAsSearchRepos(v string, set *searcher.Set, idx map[string]*searcher.Searcher) []string {
+	if strings.TrimSpace(v) != "" {
+		return parseAsRepoList(v, idx)
+	}
+
+	var repos []string
+	for repo, srch := range idx {
+		if set.InDefaultScope(repo, srch.Repo) {
+			repos = append(repos, repo)
+		}
+	}
+	return repos
+}
+
+// Check that the repos of a list of them can be searched, so that a search
+// of one that doesn't exist, or isn't indexed yet, fails rather than finds
+// nothing. Those of downstream instances are checked by them.
+func checkRepos(v string, set *searcher.Set, idx map[string]*searcher.Searcher, fed *federation.Federation) error {
+	v = strings.TrimSpace(v)
+	if v == "*" {
+		return nil
+	}
+
+	for _, repo := range strings.Split(v, ",") {
+		if repo == "" || idx[repo] != nil || (fed != nil && fed.Owns(repo)) {
+			continue
+		}
+		return repoError(set, repo)
+	}
+	return nil
+}
+
+// Parse a comma separated list of line numbers.
+func parseAsLineList(v string) ([]int, error) {
+	var lines []int
+	for _, s := range strings.Split(v, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("Invalid line number: %s", s)
+		}
+		lines = append(lines, n)
+	}
+
+	if len(lines) == 0 {
+		return nil, errors.New("No lines to blame")
+	}
+	if len(lines) > maxBlameLines {
+		return nil, fmt.Errorf("At most %d lines can be blamed at once", maxBlameLines)
+	}
+	return lines, nil
+}
+
+// Narrow repos down to those with at least one of the comma separated
+// tags. No tags leaves them as they are.
+func filterByTags(repos []string, v string, idx map[string]*searcher.Searcher) []string {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return repos
+	}
+
+	tags := strings.Split(v, ",")
+	var tagged []string
+	for _, repo := range repos {
+		for _, tag := range tags {
+			if idx[repo].Repo.HasTag(strings.TrimSpace(tag)) {
+				tagged = append(tagged, repo)
+				break
+			}
+		}
+	}
+	return tagged
+}
+
 func parseAsUintValue(sv string, min, max, def uint) uint {
 	iv, err := strconv.ParseUint(sv, 10, 54)
 	if err != nil {
@@ -159,12 +370,21 @@ func parseRangeValue(rv string) (int, int) {
 	return b, e
 }
 
-func Setup(m *http.ServeMux, idx map[string]*searcher.Searcher) {
+// Setup registers the api handlers. If fed is non-nil, searches are also
+// fanned out to its downstream instances.
+func Setup(m *http.ServeMux, set *searcher.Set, fed *federation.Federation, hk *hooks.Chain) {
+	us := newUsage(set)
 
 	m.HandleFunc("/api/v1/repos", func(w http.ResponseWriter, r *http.Request) {
+		idx := set.All()
 		res := map[string]*config.Repo{}
+		if fed != nil {
+			res = fed.Repos()
+		}
 		for name, srch := range idx {
-			res[name] = srch.Repo
+			repo := *srch.Repo
+			repo.URLPattern = srch.URLPattern()
+			res[name] = &repo
 		}
 
 		writeResp(w, res)
@@ -173,12 +393,72 @@ func Setup(m *http.ServeMux, idx map[string]*searcher.Searcher) {
 	m.HandleFunc("/api/v1/search", func(w http.ResponseWriter, r *http.Request) {
 		var opt index.SearchOptions
 
+		idx := set.All()
+
 		stats := parseAsBool(r.FormValue("stats"))
-		repos := parseAsRepoList(r.FormValue("repos"), idx)
-		query := r.FormValue("q")
+		facets := parseAsBool(r.FormValue("facets"))
+		suggestions := parseAsBool(r.FormValue("suggest"))
+
+		var debug map[string]*RepoDebug
+		if parseAsBool(r.FormValue("debug")) {
+			debug = map[string]*RepoDebug{}
+		}
+
+		if err := checkRepos(r.FormValue("repos"), set, idx, fed); err != nil {
+			writeError(w, err, http.StatusOK)
+			return
+		}
+		repos := filterByTags(
+			parseAsSearchRepos(r.FormValue("repos"), set, idx),
+			r.FormValue("tags"),
+			idx)
+		opt.Owner = r.FormValue("owner")
+		opt.Module = r.FormValue("module")
+		opt.Package = r.FormValue("pkg")
+		opt.Modified = r.FormValue("modified")
+		opt.Author = r.FormValue("author")
+		parseWithin(r.Form["within"], &opt)
+		query := parseQueryFilters(r.FormValue("q"), &opt)
 		opt.Offset, opt.Limit = parseRangeValue(r.FormValue("rng"))
+		cur, err := parseCursor(r.FormValue("cursor"))
+		if err == nil && cur != nil && idx[cur.Repo] == nil {
+			err = errors.New("not a cursor of a local repo")
+		}
+		if err != nil {
+			writeError(w, invalidParam("cursor", err), http.StatusOK)
+			return
+		}
+		maxBytes := set.MaxResponseBytes()
+		var mb int
+		if parseRangeInt(r.FormValue("maxBytes"), &mb); mb > 0 && mb < maxBytes {
+			maxBytes = mb
+		}
 		opt.FileRegexp = r.FormValue("files")
-		opt.IgnoreCase = parseAsBool(r.FormValue("i"))
+		opt.ExcludeFileRegexp = r.FormValue("excludeFiles")
+		opt.Structural = r.FormValue("mode") == structuralMode
+		opt.WholeWord = parseAsBool(r.FormValue("word"))
+		parseRangeInt(r.FormValue("maxMatchesPerFile"), &opt.MaxMatchesPerFile)
+		parseRangeInt(r.FormValue("maxFilesPerRepo"), &opt.MaxFiles)
+		parseRangeInt(r.FormValue("maxTotal"), &opt.MaxMatches)
+		opt.Sort = r.FormValue("sort")
+		if err := index.CheckSort(opt.Sort); err != nil {
+			writeError(w, invalidParam("sort", err), http.StatusOK)
+			return
+		}
+		opt.Rev = strings.TrimSpace(r.FormValue("rev"))
+		opt.Facets = facets
+		ignoreCase, err := parseIgnoreCase(r.FormValue("case"), parseAsBool(r.FormValue("i")), query)
+		if err != nil {
+			writeError(w, invalidParam("case", err), http.StatusOK)
+			return
+		}
+		opt.IgnoreCase = ignoreCase
+		at, err := parseAsTime(r.FormValue("at"))
+		if err != nil {
+			writeError(w, invalidParam("at", err), http.StatusOK)
+			return
+		}
+		opt.At = at
 		opt.LinesOfContext = parseAsUintValue(
 			r.FormValue("ctx"),
 			0,
@@ -187,38 +467,347 @@ func Setup(m *http.ServeMux, idx map[string]*searcher.Searcher) {
 
 		var filesOpened int
 		var durationMs int
+		startedAt := time.Now()
+
+		// downstream instances are searched alongside the local repos, on
+		// the first page of a search that is cut short by its size alone,
+		// since a cursor only goes on through the local repos.
+		var remote *remoteResponse
+		remoteCh := make(chan *remoteResponse, 1)
+		if fed != nil && cur == nil {
+			params := url.Values{}
+			for k, v := range r.Form {
+				if k != "cursor" {
+					params[k] = v
+				}
+			}
+			go func() {
+				var rr remoteResponse
+				rr.res, rr.unavailable, rr.err = fed.Search(r.Context(), params, r.FormValue("repos"), &rr.filesOpened)
+				remoteCh <- &rr
+			}()
+		}
 
-		results, err := searchAll(query, &opt, repos, idx, &filesOpened, &durationMs)
-		if err != nil {
+		results, err := searchFrom(query, &opt, repos, idx, cur, &filesOpened, &durationMs, debug)
+		var qe *index.QueryError
+		if err != nil && suggestions && errors.As(err, &qe) {
+			writeErrorSuggesting(w, err, http.StatusOK, suggest(r.FormValue("q"), query, &opt, err, repos, idx))
+			return
+		} else if err != nil {
 			// TODO(knorton): Return ok status because the UI expects it for now.
 			writeError(w, err, http.StatusOK)
 			return
 		}
+		us.record(query, repos, results, startedAt)
+
+		remoteRepos := map[string]bool{}
+		if fed != nil && cur == nil {
+			remote = <-remoteCh
+			if remote.err != nil {
+				writeError(w, remote.err, http.StatusOK)
+				return
+			}
+
+			for name, sr := range remote.res {
+				// a local repo wins over a downstream one of the same name.
+				if idx[name] == nil {
+					results[name] = sr
+					remoteRepos[name] = true
+				}
+			}
+			filesOpened += remote.filesOpened
+			durationMs = int(time.Now().Sub(startedAt).Seconds() * 1000)
+		}
 
 		var res struct {
 			Results map[string]*index.SearchResponse
-			Stats   *Stats `json:",omitempty"`
+			Stats   *Stats  `json:",omitempty"`
+			Facets  *Facets `json:",omitempty"`
+
+			// The names of the repos in the order of the sort, if there
+			// is one.
+			Order []string `json:",omitempty"`
+
+			// Whether a cap on the results left some out.
+			Truncated bool `json:",omitempty"`
+
+			// Where to go on from when the cap on the size of the
+			// response left results out, as the cursor param of the
+			// same search.
+			Cursor string `json:",omitempty"`
+
+			// Downstream instances that could not be searched.
+			Unavailable map[string]string `json:",omitempty"`
+
+			// What the search cost in each of the local repos, if debug
+			// was asked for.
+			Debug map[string]*RepoDebug `json:",omitempty"`
+
+			// Searches to retry with, if suggestions were asked for and
+			// the search found nothing.
+			Suggestions []*Suggestion `json:",omitempty"`
 		}
 
-		res.Results = results
+		hres := &hooks.Response{Results: results}
+		if err := hk.Process(&hooks.Request{Endpoint: "search", Params: r.Form, HTTP: r}, hres); err != nil {
+			writeError(w, err, http.StatusOK)
+			return
+		}
+
+		res.Results = hres.Results
+		res.Truncated = capTotal(res.Results, opt.MaxMatches)
+		if next := capSize(res.Results, maxBytes, &opt, cur, remoteRepos); next != nil {
+			res.Truncated = true
+			res.Cursor = next.String()
+		}
+		res.Order = repoOrder(res.Results, opt.Sort)
+		if remote != nil && len(remote.unavailable) > 0 {
+			res.Unavailable = remote.unavailable
+		}
 		if stats {
 			res.Stats = &Stats{
 				FilesOpened: filesOpened,
 				Duration:    durationMs,
 			}
 		}
+		if facets {
+			res.Facets = mergeFacets(res.Results)
+		}
+		res.Debug = debug
+		if suggestions && len(res.Results) == 0 {
+			res.Suggestions = suggest(r.FormValue("q"), query, &opt, nil, repos, idx)
+		}
 
+		if wantsVimgrep(r) {
+			writeVimgrep(w, res.Results, res.Order)
+			return
+		}
 		writeResp(w, &res)
 	})
 
+	setupBatch(m, set, fed, hk)
+	setupJobs(m, set, fed, hk)
+	setupSearches(m, set)
+	setupPreferences(m, set)
+	setupEditor(m, set, hk)
+	setupUsage(m, set)
+
 	m.HandleFunc("/api/v1/excludes", func(w http.ResponseWriter, r *http.Request) {
 		repo := r.FormValue("repo")
-		res := idx[repo].GetExcludedFiles()
+		if fed != nil && fed.Owns(repo) {
+			res, err := fed.Excludes(repo)
+			if err != nil {
+				writeError(w, err, http.StatusBadGateway)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json;charset=utf-8")
+			fmt.Fprint(w, res)
+			return
+		}
+
+		srch := set.Get(repo)
+		if srch == nil {
+			err := repoError(set, repo)
+			writeError(w, err, repoErrorStatus(err))
+			return
+		}
+
+		res := srch.GetExcludedFiles()
 		w.Header().Set("Content-Type", "application/json;charset=utf-8")
 		w.Header().Set("Access-Control-Allow", "*")
 		fmt.Fprint(w, res)
 	})
 
+	m.HandleFunc("/api/v1/blame", func(w http.ResponseWriter, r *http.Request) {
+		repo := r.FormValue("repo")
+		srch := set.Get(repo)
+		if srch == nil {
+			if fed != nil && fed.Owns(repo) {
+				writeError(w,
+					fmt.Errorf("Blame is not available for %s, it is searched on another instance", repo),
+					http.StatusNotImplemented)
+				return
+			}
+			err := repoError(set, repo)
+			writeError(w, err, repoErrorStatus(err))
+			return
+		}
+
+		lines, err := parseAsLineList(r.FormValue("lines"))
+		if err != nil {
+			writeError(w, invalidParam("lines", err), http.StatusBadRequest)
+			return
+		}
+
+		res, err := srch.Blame(r.FormValue("path"), lines, strings.TrimSpace(r.FormValue("rev")))
+		if err == vcs.ErrCannotBlame {
+			writeError(w,
+				fmt.Errorf("Blame is not available for %s", repo),
+				http.StatusNotImplemented)
+			return
+		} else if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		writeResp(w, res)
+	})
+
+	m.HandleFunc("/api/v1/deps", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimSpace(r.FormValue("name"))
+		if name == "" {
+			writeError(w, invalidParam("name", errors.New("The name of a library is required")), http.StatusBadRequest)
+			return
+		}
+		version := strings.TrimSpace(r.FormValue("version"))
+
+		idx := set.All()
+
+		res := map[string][]*index.Dependency{}
+		for _, repo := range filterByTags(parseAsSearchRepos(r.FormValue("repos"), set, idx), r.FormValue("tags"), idx) {
+			deps, err := idx[repo].Dependencies()
+			if err != nil {
+				reqid.Printf(r.Context(), "failed to read the dependencies of %s: %s", repo, err)
+				continue
+			}
+
+			for _, d := range deps {
+				if d.Matches(name, version) {
+					res[repo] = append(res[repo], d)
+				}
+			}
+		}
+
+		writeResp(w, map[string]interface{}{
+			"Results": res,
+		})
+	})
+
+	m.HandleFunc("/api/v1/similar", func(w http.ResponseWriter, r *http.Request) {
+		snippet := r.FormValue("snippet")
+		if strings.TrimSpace(snippet) == "" {
+			writeError(w, invalidParam("snippet", errors.New("A snippet is required")), http.StatusBadRequest)
+			return
+		}
+
+		minScore := defaultSimilarScore
+		if v := r.FormValue("min"); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f < 0 || f > 1 {
+				writeError(w, invalidParam("min", fmt.Errorf("Invalid min: %s", v)), http.StatusBadRequest)
+				return
+			}
+			minScore = f
+		}
+
+		limit := int(parseAsUintValue(r.FormValue("limit"), 1, maxSimilarLimit, defaultSimilarLimit))
+
+		idx := set.All()
+
+		var res []*similarRegion
+		for _, repo := range filterByTags(parseAsSearchRepos(r.FormValue("repos"), set, idx), r.FormValue("tags"), idx) {
+			regions, err := idx[repo].Similar(snippet, minScore)
+			if err == index.ErrSnippetTooShort {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			} else if err != nil {
+				reqid.Printf(r.Context(), "failed to find similar code in %s: %s", repo, err)
+				continue
+			}
+
+			for _, sr := range regions {
+				res = append(res, &similarRegion{Repo: repo, SimilarRegion: sr})
+			}
+		}
+
+		sort.SliceStable(res, func(i, j int) bool {
+			if res[i].Score != res[j].Score {
+				return res[i].Score > res[j].Score
+			}
+			return res[i].Repo < res[j].Repo
+		})
+		if len(res) > limit {
+			res = res[:limit]
+		}
+
+		regions := make([]hookedRegion, len(res))
+		for i, rg := range res {
+			regions[i] = rg
+		}
+		regions, err := hookRegions(hk, "similar", r, regions)
+		if err != nil {
+			writeError(w, err, http.StatusOK)
+			return
+		}
+
+		writeResp(w, map[string]interface{}{
+			"Results": regions,
+		})
+	})
+
+	m.HandleFunc("/api/v1/semantic", func(w http.ResponseWriter, r *http.Request) {
+		model := set.Embeddings()
+		if model == nil {
+			writeError(w,
+				errors.New("Semantic search is not turned on"),
+				http.StatusNotImplemented)
+			return
+		}
+
+		query := strings.TrimSpace(r.FormValue("q"))
+		if query == "" {
+			writeError(w, invalidParam("q", errors.New("A query is required")), http.StatusBadRequest)
+			return
+		}
+
+		vecs, err := model.Embed([]string{query})
+		if err != nil {
+			writeError(w, err, http.StatusBadGateway)
+			return
+		}
+
+		limit := int(parseAsUintValue(r.FormValue("limit"), 1, maxSemanticLimit, defaultSemanticLimit))
+
+		idx := set.All()
+
+		var res []*semanticMatch
+		for _, repo := range filterByTags(parseAsSearchRepos(r.FormValue("repos"), set, idx), r.FormValue("tags"), idx) {
+			matches, err := idx[repo].Nearest(vecs[0], limit)
+			if err != nil {
+				reqid.Printf(r.Context(), "failed to search the embeddings of %s: %s", repo, err)
+				continue
+			}
+
+			for _, sm := range matches {
+				res = append(res, &semanticMatch{Repo: repo, SemanticMatch: sm})
+			}
+		}
+
+		sort.SliceStable(res, func(i, j int) bool {
+			if res[i].Score != res[j].Score {
+				return res[i].Score > res[j].Score
+			}
+			return res[i].Repo < res[j].Repo
+		})
+		if len(res) > limit {
+			res = res[:limit]
+		}
+
+		regions := make([]hookedRegion, len(res))
+		for i, rg := range res {
+			regions[i] = rg
+		}
+		regions, err = hookRegions(hk, "semantic", r, regions)
+		if err != nil {
+			writeError(w, err, http.StatusOK)
+			return
+		}
+
+		writeResp(w, map[string]interface{}{
+			"Results": regions,
+		})
+	})
+
 	m.HandleFunc("/api/v1/update", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
 			writeError(w,
@@ -227,18 +816,60 @@ func Setup(m *http.ServeMux, idx map[string]*searcher.Searcher) {
 			return
 		}
 
-		repos := parseAsRepoList(r.FormValue("repos"), idx)
+		idx := set.All()
+
+		// a webhook has the repo in its payload rather than in repos.
+		var body []byte
+		event := webhookEvent(r)
+		if event != "" {
+			b, err := readPush(r)
+			if err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+			body = b
+
+			// like the pings that are sent when a webhook is set up.
+			if event != "push" {
+				writeResp(w, "ok")
+				return
+			}
+		}
+
+		var repos []string
+		if event != "" && r.URL.Query().Get("repos") == "" {
+			rs, err := pushedRepos(body, idx)
+			if err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+			if len(rs) == 0 {
+				writeError(w,
+					newError(codeUnknownRepo, nil, "No repository is at the urls of the push"),
+					http.StatusNotFound)
+				return
+			}
+			repos = rs
+		} else {
+			repos = parseAsRepoList(r.FormValue("repos"), idx)
+		}
 
 		for _, repo := range repos {
 			searcher := idx[repo]
 			if searcher == nil {
+				err := repoError(set, repo)
+				writeError(w, err, repoErrorStatus(err))
+				return
+			}
+
+			if !searcher.Repo.PushHeaders.Match(r) || !signedPush(r, body, searcher.Repo) {
 				writeError(w,
-					fmt.Errorf("No such repository: %s", repo),
-					http.StatusNotFound)
+					fmt.Errorf("The push update for repository %s is missing its headers or signature", repo),
+					http.StatusUnauthorized)
 				return
 			}
 
-			if !searcher.Update() {
+			if !searcher.Update(reqid.FromContext(r.Context())) {
 				writeError(w,
 					fmt.Errorf("Push updates are not enabled for repository %s", repo),
 					http.StatusForbidden)
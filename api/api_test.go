@@ -0,0 +1,113 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/searcher"
+)
+
+// Make a set of searchers of git repos with the files of repos, by the
+// name of each repo, and a func that removes them.
+func makeSet(t *testing.T, cfg *config.Config, repos map[string]map[string]string) (*searcher.Set, func()) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	tmp, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DbPath = filepath.Join(tmp, "db")
+	if err := os.MkdirAll(cfg.DbPath, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	searchers := map[string]*searcher.Searcher{}
+	for name, files := range repos {
+		src := filepath.Join(tmp, "src", name)
+		for file, body := range files {
+			if err := os.MkdirAll(filepath.Dir(filepath.Join(src, file)), os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(src, file), []byte(body), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, args := range [][]string{
+			{"init", "-q"},
+			{"add", "-A"},
+			{"-c", "user.name=hound", "-c", "user.email=hound@example.com", "commit", "-q", "-m", name},
+		} {
+			cmd := exec.Command("git", args...)
+			cmd.Dir = src
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("git %v: %s: %s", args, err, out)
+			}
+		}
+
+		repo := &config.Repo{URL: src}
+		cfg.InitRepo(repo)
+		s, err := searcher.New(cfg.DbPath, name, repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		searchers[name] = s
+	}
+
+	set := searcher.NewSet(cfg, searchers)
+	return set, func() {
+		set.Stop()
+		os.RemoveAll(tmp)
+	}
+}
+
+func TestParseQueryFilters(t *testing.T) {
+	var opt index.SearchOptions
+	if q := parseQueryFilters("ParseToken pkg:internal/auth owner:@acme", &opt); q != "ParseToken" {
+		t.Fatalf("expected the filter terms to be taken out, got %q", q)
+	}
+	if opt.Package != "internal/auth" || opt.Owner != "@acme" {
+		t.Fatalf("expected the filters of the terms, got %q and %q", opt.Package, opt.Owner)
+	}
+
+	tests := map[string]string{
+		`\pkg:=`:                      "pkg:=",
+		`x \pkg:= newPkg()`:           "x pkg:= newPkg()",
+		`\modified:today`:             "modified:today",
+		`"owner:" \owner:@acme owner`: `"owner:" owner:@acme owner`,
+		`module:`:                     "module:",
+		`repo.module:foo`:             "repo.module:foo",
+	}
+	for q, want := range tests {
+		var opt index.SearchOptions
+		if got := parseQueryFilters(q, &opt); got != want {
+			t.Errorf("parseQueryFilters(%q) = %q, expected %q", q, got, want)
+		}
+		if opt.Owner != "" || opt.Module != "" || opt.Package != "" || opt.Author != "" || opt.Modified != "" {
+			t.Errorf("parseQueryFilters(%q) set filters %+v", q, opt)
+		}
+	}
+}
+
+func TestWithFiltersEscapesPattern(t *testing.T) {
+	q := `\pkg:= owner:@acme`
+	var opt index.SearchOptions
+	pat := parseQueryFilters(q, &opt)
+
+	retry := withFilters(q, pat)
+	if retry != `\pkg:= owner:@acme` {
+		t.Fatalf("expected the retry to keep the term escaped, got %q", retry)
+	}
+
+	var ropt index.SearchOptions
+	if got := parseQueryFilters(retry, &ropt); got != pat || ropt.Owner != "@acme" || ropt.Package != "" {
+		t.Fatalf("expected the retry to search the same, got %q with %+v", got, ropt)
+	}
+}
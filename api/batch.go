@@ -0,0 +1,394 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/hound-search/hound/federation"
+	"github.com/hound-search/hound/hooks"
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/searcher"
+)
+
+const maxBatchQueries = 100
+
+// One query of a batch search. The fields are the parameters of
+// /api/v1/search.
+type batchQuery struct {
+	Query      string   `json:"q"`
+	Repos      string   `json:"repos"`
+	Tags       string   `json:"tags"`
+	Files      string   `json:"files"`
+	Exclude    string   `json:"excludeFiles"`
+	IgnoreCase bool     `json:"i"`
+	Case       string   `json:"case"`
+	Word       bool     `json:"word"`
+	Context    *uint    `json:"ctx"`
+	Range      string   `json:"rng"`
+	Mode       string   `json:"mode"`
+	Rev        string   `json:"rev"`
+	At         string   `json:"at"`
+	Owner      string   `json:"owner"`
+	Module     string   `json:"module"`
+	Package    string   `json:"pkg"`
+	Modified   string   `json:"modified"`
+	Author     string   `json:"author"`
+	Within     []string `json:"within"`
+	Facets     bool     `json:"facets"`
+	Sort       string   `json:"sort"`
+
+	// Caps on the matches of a file, the files of a repo and the matches
+	// of the whole query.
+	MaxMatchesPerFile int `json:"maxMatchesPerFile"`
+	MaxFilesPerRepo   int `json:"maxFilesPerRepo"`
+	MaxTotal          int `json:"maxTotal"`
+}
+
+type batchRequest struct {
+	Queries []*batchQuery `json:"queries"`
+	Stats   bool          `json:"stats"`
+}
+
+// The outcome of one query of a batch, shaped like a /api/v1/search
+// response. A query that fails doesn't fail the rest of the batch.
+type batchResult struct {
+	Results     map[string]*index.SearchResponse `json:",omitempty"`
+	Error       string                           `json:",omitempty"`
+	Code        string                           `json:",omitempty"`
+	Details     map[string]string                `json:",omitempty"`
+	Stats       *Stats                           `json:",omitempty"`
+	Facets      *Facets                          `json:",omitempty"`
+	Unavailable map[string]string                `json:",omitempty"`
+	Truncated   bool                             `json:",omitempty"`
+	Order       []string                         `json:",omitempty"`
+
+	filesOpened int
+	err         error
+}
+
+func (q *batchQuery) options() *index.SearchOptions {
+	opt := &index.SearchOptions{
+		FileRegexp:        q.Files,
+		ExcludeFileRegexp: q.Exclude,
+		IgnoreCase:        q.IgnoreCase,
+		Structural:        q.Mode == structuralMode,
+		WholeWord:         q.Word,
+		MaxMatchesPerFile: q.MaxMatchesPerFile,
+		MaxFiles:          q.MaxFilesPerRepo,
+		MaxMatches:        q.MaxTotal,
+		Sort:              q.Sort,
+		LinesOfContext:    defaultLinesOfContext,
+		Rev:               q.Rev,
+		Owner:             q.Owner,
+		Module:            q.Module,
+		Package:           q.Package,
+		Modified:          q.Modified,
+		Author:            q.Author,
+		Facets:            q.Facets,
+	}
+	opt.Offset, opt.Limit = parseRangeValue(q.Range)
+	if q.Context != nil {
+		opt.LinesOfContext = parseAsUintValue(
+			strconv.FormatUint(uint64(*q.Context), 10),
+			0,
+			maxLinesOfContext,
+			defaultLinesOfContext)
+	}
+	return opt
+}
+
+// The query as the parameters of a search on a downstream instance.
+func (q *batchQuery) params() url.Values {
+	v := url.Values{}
+	v.Set("q", q.Query)
+	v.Set("repos", q.Repos)
+	if q.Tags != "" {
+		v.Set("tags", q.Tags)
+	}
+	v.Set("files", q.Files)
+	if q.Exclude != "" {
+		v.Set("excludeFiles", q.Exclude)
+	}
+	v.Set("rng", q.Range)
+	if q.Mode != "" {
+		v.Set("mode", q.Mode)
+	}
+	if q.Rev != "" {
+		v.Set("rev", q.Rev)
+	}
+	if q.At != "" {
+		v.Set("at", q.At)
+	}
+	if q.Owner != "" {
+		v.Set("owner", q.Owner)
+	}
+	if q.Module != "" {
+		v.Set("module", q.Module)
+	}
+	if q.Package != "" {
+		v.Set("pkg", q.Package)
+	}
+	if q.Modified != "" {
+		v.Set("modified", q.Modified)
+	}
+	if q.Author != "" {
+		v.Set("author", q.Author)
+	}
+	for _, w := range q.Within {
+		v.Add("within", w)
+	}
+	if q.IgnoreCase {
+		v.Set("i", "true")
+	}
+	if q.Case != "" {
+		v.Set("case", q.Case)
+	}
+	if q.Word {
+		v.Set("word", "true")
+	}
+	if q.MaxMatchesPerFile > 0 {
+		v.Set("maxMatchesPerFile", strconv.Itoa(q.MaxMatchesPerFile))
+	}
+	if q.MaxFilesPerRepo > 0 {
+		v.Set("maxFilesPerRepo", strconv.Itoa(q.MaxFilesPerRepo))
+	}
+	if q.MaxTotal > 0 {
+		v.Set("maxTotal", strconv.Itoa(q.MaxTotal))
+	}
+	if q.Sort != "" {
+		v.Set("sort", q.Sort)
+	}
+	if q.Facets {
+		v.Set("facets", "true")
+	}
+	if q.Context != nil {
+		v.Set("ctx", strconv.FormatUint(uint64(*q.Context), 10))
+	}
+	return v
+}
+
+/**
+ * Searches each repo once for all of the queries that include it, with
+ * all of the repos in parallel. If progress is set, it is told how many of
+ * the searches of repos and of downstream instances are done as they are.
+ */
+func searchBatch(
+	ctx context.Context,
+	queries []*batchQuery,
+	set *searcher.Set,
+	fed *federation.Federation,
+	progress func(done, total int)) []*batchResult {
+
+	idx := set.All()
+
+	results := make([]*batchResult, len(queries))
+	pats := make([]string, len(queries))
+	opts := make([]*index.SearchOptions, len(queries))
+	byRepo := map[string][]int{}
+	for i, q := range queries {
+		results[i] = &batchResult{Results: map[string]*index.SearchResponse{}}
+		opts[i] = q.options()
+		// the searches of repos stop when the batch or its job is
+		// cancelled, like those of downstream instances.
+		opts[i].Cancel = ctx.Done()
+		if err := checkRepos(q.Repos, set, idx, fed); err != nil {
+			results[i].err = err
+			continue
+		}
+		if err := index.CheckSort(q.Sort); err != nil {
+			results[i].err = invalidParam("sort", err)
+			continue
+		}
+		at, err := parseAsTime(q.At)
+		if err != nil {
+			results[i].err = invalidParam("at", err)
+			continue
+		}
+		opts[i].At = at
+		parseWithin(q.Within, opts[i])
+		pats[i] = parseQueryFilters(q.Query, opts[i])
+		opts[i].IgnoreCase, err = parseIgnoreCase(q.Case, q.IgnoreCase, pats[i])
+		if err != nil {
+			results[i].err = invalidParam("case", err)
+			continue
+		}
+		for _, repo := range filterByTags(parseAsSearchRepos(q.Repos, set, idx), q.Tags, idx) {
+			byRepo[repo] = append(byRepo[repo], i)
+		}
+	}
+
+	type repoResponse struct {
+		repo string
+		qs   []int
+		res  []*index.SearchResponse
+		errs []error
+	}
+
+	// use a buffered channel to avoid routine leaks.
+	ch := make(chan *repoResponse, len(byRepo))
+	for repo, qs := range byRepo {
+		go func(repo string, qs []int) {
+			p := make([]string, len(qs))
+			o := make([]*index.SearchOptions, len(qs))
+			for j, i := range qs {
+				p[j], o[j] = pats[i], opts[i]
+			}
+			res, errs := idx[repo].SearchBatch(p, o)
+			ch <- &repoResponse{repo, qs, res, errs}
+		}(repo, qs)
+	}
+
+	// downstream instances take the queries one at a time.
+	type remoteQuery struct {
+		i  int
+		rr *remoteResponse
+	}
+	remoteCh := make(chan *remoteQuery, len(queries))
+	if fed != nil {
+		for i, q := range queries {
+			go func(i int, q *batchQuery) {
+				var rr remoteResponse
+				rr.res, rr.unavailable, rr.err = fed.Search(ctx, q.params(), q.Repos, &rr.filesOpened)
+				remoteCh <- &remoteQuery{i, &rr}
+			}(i, q)
+		}
+	}
+
+	total := len(byRepo)
+	if fed != nil {
+		total += len(queries)
+	}
+	done := 0
+	step := func() {
+		done++
+		if progress != nil {
+			progress(done, total)
+		}
+	}
+	if progress != nil {
+		progress(0, total)
+	}
+
+	for range byRepo {
+		r := <-ch
+		step()
+		for j, i := range r.qs {
+			br := results[i]
+			if r.errs[j] != nil {
+				if br.err == nil {
+					br.err = r.errs[j]
+				}
+				continue
+			}
+
+			br.filesOpened += r.res[j].FilesOpened
+			if r.res[j].Matches != nil || r.res[j].FilenameHits != nil {
+				br.Results[r.repo] = r.res[j]
+			}
+		}
+	}
+
+	if fed != nil {
+		for range queries {
+			r := <-remoteCh
+			step()
+			br := results[r.i]
+			if r.rr.err != nil {
+				if br.err == nil {
+					br.err = r.rr.err
+				}
+				continue
+			}
+
+			for name, sr := range r.rr.res {
+				// a local repo wins over a downstream one of the same name.
+				if idx[name] == nil {
+					br.Results[name] = sr
+				}
+			}
+			br.filesOpened += r.rr.filesOpened
+			if len(r.rr.unavailable) > 0 {
+				br.Unavailable = r.rr.unavailable
+			}
+		}
+	}
+
+	return results
+}
+
+// Run the result hooks on the results of a query and fill in the rest of
+// the response, or the error if the query or a hook failed.
+func (br *batchResult) finish(q *batchQuery, endpoint string, hk *hooks.Chain, r *http.Request, stats bool, durationMs int) {
+	if br.err == nil {
+		hres := &hooks.Response{Results: br.Results}
+		br.err = hk.Process(&hooks.Request{Endpoint: endpoint, Params: q.params(), HTTP: r}, hres)
+		br.Results = hres.Results
+	}
+
+	if br.err != nil {
+		br.Results = nil
+		br.Error = br.err.Error()
+		br.Code, br.Details = errorCode(br.err, http.StatusOK)
+		return
+	}
+	br.Truncated = capTotal(br.Results, q.MaxTotal)
+	br.Order = repoOrder(br.Results, q.Sort)
+	if stats {
+		br.Stats = &Stats{
+			FilesOpened: br.filesOpened,
+			Duration:    durationMs,
+		}
+	}
+	if q.Facets {
+		br.Facets = mergeFacets(br.Results)
+	}
+}
+
+func setupBatch(m *http.ServeMux, set *searcher.Set, fed *federation.Federation, hk *hooks.Chain) {
+	m.HandleFunc("/api/v1/search/batch", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			writeError(w,
+				errors.New(http.StatusText(http.StatusMethodNotAllowed)),
+				http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req batchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		if len(req.Queries) > maxBatchQueries {
+			writeError(w,
+				fmt.Errorf("A batch can have at most %d queries", maxBatchQueries),
+				http.StatusBadRequest)
+			return
+		}
+
+		for _, q := range req.Queries {
+			if q == nil {
+				writeError(w, errors.New("A batch can't have null queries"), http.StatusBadRequest)
+				return
+			}
+		}
+
+		startedAt := time.Now()
+		results := searchBatch(r.Context(), req.Queries, set, fed, nil)
+		durationMs := int(time.Now().Sub(startedAt).Seconds() * 1000)
+
+		for i, br := range results {
+			br.finish(req.Queries[i], "batch", hk, r, req.Stats, durationMs)
+		}
+
+		writeResp(w, map[string][]*batchResult{
+			"Results": results,
+		})
+	})
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"sort"
+
+	"github.com/hound-search/hound/index"
+)
+
+// Keep the results of a search to at most max matches in all, taking the
+// repos in order of name and the files of each in order. The repos and
+// files that lose matches are marked truncated, and repos that are left
+// with none keep their response so the caller can tell that they had
+// some. It returns whether any results were left out by a cap, this one
+// or those of the repos.
+func capTotal(results map[string]*index.SearchResponse, max int) bool {
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	truncated := false
+	total := 0
+	for _, name := range names {
+		res := results[name]
+		if res == nil {
+			continue
+		}
+
+		if max > 0 {
+			for i, fm := range res.Matches {
+				room := max - total
+				if len(fm.Matches) <= room {
+					total += len(fm.Matches)
+					continue
+				}
+
+				if room > 0 {
+					fm.Matches = fm.Matches[:room]
+					fm.Truncated = true
+					i++
+				}
+				total = max
+				res.Matches = res.Matches[:i]
+
+				if res.Truncated == nil {
+					res.Truncated = &index.Truncation{}
+				}
+				res.Truncated.Matches = true
+				break
+			}
+		}
+
+		if res.Truncated != nil {
+			truncated = true
+		}
+	}
+	return truncated
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"time"
+
+	"github.com/hound-search/hound/index"
+)
+
+// RepoDebug is what a search cost in one repo, for working out which
+// repos make a query slow.
+type RepoDebug struct {
+	// How long the scan of the candidate files of the repo took.
+	DurationMs int64
+
+	// The files that the index had as candidates, each of which was read
+	// up to its first match at least.
+	FilesScanned int
+
+	// The bytes of the contents of those files that were read.
+	BytesRead int64
+
+	FilesWithMatch int
+}
+
+func newRepoDebug(res *index.SearchResponse) *RepoDebug {
+	return &RepoDebug{
+		DurationMs:     int64(res.Duration / time.Millisecond),
+		FilesScanned:   res.FilesOpened,
+		BytesRead:      res.BytesRead,
+		FilesWithMatch: res.FilesWithMatch,
+	}
+}
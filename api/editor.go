@@ -0,0 +1,335 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hound-search/hound/client"
+	"github.com/hound-search/hound/hooks"
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/searcher"
+	"github.com/hound-search/hound/user"
+)
+
+const (
+	// The results of an editor search by default, and at most.
+	defaultEditorLimit = 50
+	maxEditorLimit     = 500
+
+	// The most lines of context of a match of an editor search.
+	maxEditorContext = 3
+)
+
+// The keywords that the declarations of most languages start with, which
+// a search for a symbol looks for before its name.
+const declKeywords = `func|type|class|struct|interface|enum|trait|impl|def|fn|var|let|const|val|module|namespace|protocol|record|object`
+
+var identifier = regexp.MustCompile(`^[\pL_$][\pL\pN_$]*$`)
+
+// The pattern of the declarations of a symbol: one of the keywords, and
+// the receiver of a method in Go, before its name.
+func symbolPattern(name string) string {
+	return `\b(` + declKeywords + `)\s+(\([^)]*\)\s*)?` + regexp.QuoteMeta(name) + `\b`
+}
+
+func checkEditorQuery(q *client.EditorQuery) error {
+	switch q.Kind {
+	case client.EditorText, client.EditorPath:
+	case client.EditorSymbol:
+		if !identifier.MatchString(q.Query) {
+			return invalidParam("Query", fmt.Errorf("%q is not the name of a symbol", q.Query))
+		}
+	default:
+		return invalidParam("Kind", fmt.Errorf("unknown kind %q, expected text, symbol or path", q.Kind))
+	}
+
+	if q.Query == "" {
+		return invalidParam("Query", errors.New("a query is required"))
+	}
+	if q.Context < 0 || q.Context > maxEditorContext {
+		return invalidParam("Context", fmt.Errorf("at most %d lines of context can be shown", maxEditorContext))
+	}
+	if q.Limit < 0 || q.Limit > maxEditorLimit {
+		return invalidParam("Limit", fmt.Errorf("at most %d results can be returned", maxEditorLimit))
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultEditorLimit
+	}
+	return nil
+}
+
+// The local repos that an editor search asks for, in order of name, all
+// of them if it names none.
+func editorRepos(names []string, set *searcher.Set, idx map[string]*searcher.Searcher) ([]string, error) {
+	if len(names) == 0 {
+		for name := range idx {
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		if idx[name] == nil {
+			return nil, repoError(set, name)
+		}
+	}
+
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+	return names, nil
+}
+
+// The editor searches that are running with tokens, by the user that
+// made them and the token, so that they can be cancelled.
+type editorSearches struct {
+	lck     sync.Mutex
+	running map[string]*editorSearch
+}
+
+type editorSearch struct {
+	cancel context.CancelFunc
+}
+
+// Users only share the tokens of their own searches.
+func editorKey(r *http.Request, token string) string {
+	return user.FromContext(r.Context()) + "\x00" + token
+}
+
+// Record a running search, cancelling the one that had its key before
+// it. The returned func cancels it and forgets it.
+func (es *editorSearches) start(key string, cancel context.CancelFunc) func() {
+	es.lck.Lock()
+	defer es.lck.Unlock()
+
+	if prev := es.running[key]; prev != nil {
+		prev.cancel()
+	}
+	s := &editorSearch{cancel: cancel}
+	es.running[key] = s
+
+	return func() {
+		es.lck.Lock()
+		if es.running[key] == s {
+			delete(es.running, key)
+		}
+		es.lck.Unlock()
+		cancel()
+	}
+}
+
+// Cancel the running search with a key, returning whether there was one.
+func (es *editorSearches) stop(key string) bool {
+	es.lck.Lock()
+	defer es.lck.Unlock()
+
+	s := es.running[key]
+	if s == nil {
+		return false
+	}
+	s.cancel()
+	delete(es.running, key)
+	return true
+}
+
+// Search the contents of the repos for the text or the symbol of an
+// editor search, taking the matches in order of repo, path and line.
+func searchEditor(
+	ctx context.Context,
+	r *http.Request,
+	q *client.EditorQuery,
+	repos []string,
+	idx map[string]*searcher.Searcher,
+	hk *hooks.Chain) (*client.EditorResponse, error) {
+
+	pat := q.Query
+	if q.Kind == client.EditorSymbol {
+		pat = symbolPattern(q.Query)
+	} else if q.Literal {
+		pat = regexp.QuoteMeta(q.Query)
+	}
+
+	opt := &index.SearchOptions{
+		IgnoreCase:     q.IgnoreCase,
+		FileRegexp:     q.Files,
+		LinesOfContext: uint(q.Context),
+		Limit:          q.Limit,
+		MaxMatches:     q.Limit,
+		Cancel:         ctx.Done(),
+	}
+
+	var filesOpened, durationMs int
+	results, err := searchAll(pat, opt, repos, idx, &filesOpened, &durationMs, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{
+		"q":     {pat},
+		"repos": {strings.Join(repos, ",")},
+		"files": {q.Files},
+		"i":     {fmt.Sprintf("%t", q.IgnoreCase)},
+	}
+	hres := &hooks.Response{Results: results}
+	if err := hk.Process(&hooks.Request{Endpoint: "editor", Params: params, HTTP: r}, hres); err != nil {
+		return nil, err
+	}
+
+	// the column of a symbol is where its name is, not its keyword.
+	var name *regexp.Regexp
+	if q.Kind == client.EditorSymbol {
+		p := `\b` + regexp.QuoteMeta(q.Query) + `\b`
+		if q.IgnoreCase {
+			p = "(?i)" + p
+		}
+		name = regexp.MustCompile(p)
+	}
+
+	res := &client.EditorResponse{Results: []*client.EditorResult{}}
+	for _, repo := range repos {
+		sr := hres.Results[repo]
+		if sr == nil {
+			continue
+		}
+		if sr.Truncated != nil {
+			res.Truncated = true
+		}
+
+		for _, fm := range sr.Matches {
+			for _, m := range fm.Matches {
+				if len(res.Results) >= q.Limit {
+					res.Truncated = true
+					return res, nil
+				}
+
+				col := m.Columns()[0]
+				if name != nil && len(m.Spans) > 0 {
+					if loc := name.FindStringIndex(m.Line[m.Spans[0].Start:]); loc != nil {
+						col += loc[0]
+					}
+				}
+
+				res.Results = append(res.Results, &client.EditorResult{
+					Repo:   repo,
+					Path:   fm.Filename,
+					Line:   m.LineNumber,
+					Column: col,
+					Text:   m.Line,
+					Before: m.Before,
+					After:  m.After,
+				})
+			}
+		}
+	}
+	return res, nil
+}
+
+// Find the files of the repos whose paths match the query of an editor
+// search, in order of repo and then in the order they were indexed.
+func findEditorPaths(q *client.EditorQuery, repos []string, idx map[string]*searcher.Searcher) (*client.EditorResponse, error) {
+	pat := q.Query
+	if q.Literal {
+		pat = regexp.QuoteMeta(pat)
+	}
+	if q.IgnoreCase {
+		pat = "(?i)" + pat
+	}
+	re, err := regexp.Compile(pat)
+	if err != nil {
+		return nil, &index.QueryError{Err: err}
+	}
+
+	res := &client.EditorResponse{Results: []*client.EditorResult{}}
+	for _, repo := range repos {
+		paths, more, err := idx[repo].FindPaths(re, q.Limit-len(res.Results))
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range paths {
+			res.Results = append(res.Results, &client.EditorResult{Repo: repo, Path: p})
+		}
+		if more {
+			res.Truncated = true
+			break
+		}
+	}
+	return res, nil
+}
+
+func setupEditor(m *http.ServeMux, set *searcher.Set, hk *hooks.Chain) {
+	es := &editorSearches{running: map[string]*editorSearch{}}
+
+	m.HandleFunc("/api/v1/editor/search", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+		case "DELETE":
+			token := r.FormValue("token")
+			if token == "" {
+				writeError(w, invalidParam("token", errors.New("the token of the search is required")), http.StatusBadRequest)
+				return
+			}
+			writeResp(w, map[string]bool{"Cancelled": es.stop(editorKey(r, token))})
+			return
+		default:
+			methodNotAllowed(w)
+			return
+		}
+
+		var q client.EditorQuery
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		if err := checkEditorQuery(&q); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		idx := set.All()
+		repos, err := editorRepos(q.Repos, set, idx)
+		if err != nil {
+			writeError(w, err, repoErrorStatus(err))
+			return
+		}
+
+		// the search stops when the editor goes away, cancels it or
+		// makes another with its token.
+		ctx, cancel := context.WithCancel(r.Context())
+		if q.Token != "" {
+			defer es.start(editorKey(r, q.Token), cancel)()
+		} else {
+			defer cancel()
+		}
+
+		startedAt := time.Now()
+		var res *client.EditorResponse
+		if q.Kind == client.EditorPath {
+			res, err = findEditorPaths(&q, repos, idx)
+		} else {
+			res, err = searchEditor(ctx, r, &q, repos, idx, hk)
+		}
+
+		var qe *index.QueryError
+		switch {
+		case errors.Is(err, index.ErrCancelled):
+			writeError(w, err, http.StatusConflict)
+			return
+		case errors.As(err, &qe):
+			writeError(w, err, http.StatusBadRequest)
+			return
+		case err != nil:
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		res.DurationMs = int(time.Since(startedAt) / time.Millisecond)
+		writeResp(w, res)
+	})
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/reqid"
+	"github.com/hound-search/hound/searcher"
+)
+
+// The codes of the errors of the API. The code says what went wrong for
+// clients to act on, while the message says it to people and may change.
+const (
+	codeInvalidQuery     = "invalid_query"
+	codeInvalidParam     = "invalid_param"
+	codeUnknownRepo      = "unknown_repo"
+	codeNotIndexed       = "not_indexed"
+	codeNotEnabled       = "not_enabled"
+	codeNotSupported     = "not_supported"
+	codeNotFound         = "not_found"
+	codeConflict         = "conflict"
+	codeCancelled        = "cancelled"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeUnauthorized     = "unauthorized"
+	codeUnavailable      = "unavailable"
+	codeInternal         = "internal"
+)
+
+// The body of every error response: the message, for compatibility as
+// Error, its code and details, and the id the request was logged under.
+type errorBody struct {
+	Error     string
+	Code      string
+	Details   map[string]string `json:",omitempty"`
+	RequestId string            `json:",omitempty"`
+
+	// Searches to retry with, for an invalid query of a search that
+	// asked for suggestions.
+	Suggestions []*Suggestion `json:",omitempty"`
+}
+
+// An error with the code and the details it is reported with.
+type apiError struct {
+	code    string
+	msg     string
+	details map[string]string
+}
+
+func (e *apiError) Error() string {
+	return e.msg
+}
+
+func newError(code string, details map[string]string, format string, args ...interface{}) error {
+	return &apiError{code: code, msg: fmt.Sprintf(format, args...), details: details}
+}
+
+// The error of a parameter with a bad value.
+func invalidParam(name string, err error) error {
+	return &apiError{
+		code:    codeInvalidParam,
+		msg:     err.Error(),
+		details: map[string]string{"param": name},
+	}
+}
+
+// The error of a repo that can't be used, which tells one that doesn't
+// exist from one that isn't indexed yet or failed to be.
+func repoError(set *searcher.Set, repo string) error {
+	details := map[string]string{"repo": repo}
+	switch st := set.State(repo); st {
+	case searcher.StateIndexing:
+		details["state"] = st
+		return newError(codeNotIndexed, details, "Repository %s is not indexed yet", repo)
+	case searcher.StateFailed:
+		details["state"] = st
+		return newError(codeNotIndexed, details, "Repository %s failed to index", repo)
+	case searcher.StateDisabled:
+		details["state"] = st
+		return newError(codeNotEnabled, details, "Repository %s is disabled", repo)
+	}
+	return newError(codeUnknownRepo, details, "No such repository: %s", repo)
+}
+
+// The status that a repo error is reported with, by itself.
+func repoErrorStatus(err error) int {
+	var ae *apiError
+	if errors.As(err, &ae) && ae.code == codeNotIndexed {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusNotFound
+}
+
+// The code and details of an error. Errors without a code of their own
+// are given one for the status they are reported with.
+func errorCode(err error, status int) (string, map[string]string) {
+	var ae *apiError
+	if errors.As(err, &ae) {
+		return ae.code, ae.details
+	}
+
+	var qe *index.QueryError
+	if errors.As(err, &qe) {
+		return codeInvalidQuery, nil
+	}
+	if errors.Is(err, index.ErrCancelled) {
+		return codeCancelled, nil
+	}
+
+	switch status {
+	case http.StatusBadRequest:
+		return codeInvalidParam, nil
+	case http.StatusUnauthorized:
+		return codeUnauthorized, nil
+	case http.StatusForbidden:
+		return codeNotEnabled, nil
+	case http.StatusNotFound:
+		return codeNotFound, nil
+	case http.StatusMethodNotAllowed:
+		return codeMethodNotAllowed, nil
+	case http.StatusConflict:
+		return codeConflict, nil
+	case http.StatusNotImplemented:
+		return codeNotSupported, nil
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codeUnavailable, nil
+	}
+	return codeInternal, nil
+}
+
+// Write an error, with the id of the request so that it can be found in
+// the logs, where the error is logged along with it.
+func writeError(w http.ResponseWriter, err error, status int) {
+	writeErrorSuggesting(w, err, status, nil)
+}
+
+// Write an error like writeError, along with searches that might do what
+// was meant.
+func writeErrorSuggesting(w http.ResponseWriter, err error, status int, sugs []*Suggestion) {
+	body := &errorBody{Error: err.Error(), Suggestions: sugs}
+	body.Code, body.Details = errorCode(err, status)
+	if id := w.Header().Get(reqid.Header); id != "" {
+		body.RequestId = id
+		log.Printf("request=%s failed with %d: %s", id, status, err)
+	}
+	writeJson(w, body, status)
+}
+
+// WriteError writes an error in the shape of those of the API, for the
+// handlers in front of it.
+func WriteError(w http.ResponseWriter, err error, status int) {
+	writeError(w, err, status)
+}
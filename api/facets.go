@@ -0,0 +1,27 @@
+package api
+
+import "github.com/hound-search/hound/index"
+
+// Facets are those of all of the repos of a search, along with the number
+// of files with a match in each repo.
+type Facets struct {
+	Repos map[string]int `json:",omitempty"`
+	index.Facets
+}
+
+// Add up the facets of the results, which have them if the search asked
+// for them.
+func mergeFacets(results map[string]*index.SearchResponse) *Facets {
+	f := &Facets{
+		Repos:  map[string]int{},
+		Facets: *index.NewFacets(),
+	}
+	for repo, res := range results {
+		if res == nil || res.FilesWithMatch == 0 {
+			continue
+		}
+		f.Repos[repo] = res.FilesWithMatch
+		f.Merge(res.Facets)
+	}
+	return f
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hound-search/hound/searcher"
+)
+
+// The actions that can be taken on several repos of a health report at
+// once.
+const (
+	actionDisable = "disable"
+	actionEnable  = "enable"
+	actionRemove  = "remove"
+)
+
+// The body of a request to act on several repos.
+type healthActionRequest struct {
+	Action string   `json:"action"`
+	Repos  []string `json:"repos"`
+}
+
+// Parse the days of a threshold of the health report, which are the
+// default if they are missing.
+func parseDays(name, v string) (time.Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+
+	days, err := strconv.ParseUint(v, 10, 16)
+	if err != nil || days == 0 {
+		return 0, invalidParam(name, fmt.Errorf("expected a number of days, got %q", v))
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+func setupHealth(m *http.ServeMux, set *searcher.Set) {
+	m.HandleFunc("/api/v1/admin/health", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			var opt searcher.HealthOptions
+			var err error
+			if opt.FailingFor, err = parseDays("failing-days", r.FormValue("failing-days")); err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+			if opt.UnchangedFor, err = parseDays("unchanged-days", r.FormValue("unchanged-days")); err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+
+			res := set.Health(opt, time.Now())
+
+			// only the repos that were flagged, unless all of them are
+			// asked for.
+			if !parseAsBool(r.FormValue("all")) {
+				for name, h := range res {
+					if len(h.Flags) == 0 {
+						delete(res, name)
+					}
+				}
+			}
+			writeResp(w, res)
+		case "POST":
+			var req healthActionRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+
+			var act func(string) error
+			switch req.Action {
+			case actionDisable:
+				act = set.Disable
+			case actionEnable:
+				act = set.Enable
+			case actionRemove:
+				act = set.Remove
+			default:
+				writeError(w,
+					invalidParam("action", fmt.Errorf("expected disable, enable or remove, got %q", req.Action)),
+					http.StatusBadRequest)
+				return
+			}
+
+			// each repo gets "ok" or why the action failed for it.
+			res := map[string]string{}
+			for _, name := range req.Repos {
+				res[name] = "ok"
+				if err := act(name); err != nil {
+					res[name] = err.Error()
+				}
+			}
+			writeResp(w, res)
+		default:
+			methodNotAllowed(w)
+		}
+	})
+}
@@ -0,0 +1,318 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hound-search/hound/federation"
+	"github.com/hound-search/hound/hooks"
+	"github.com/hound-search/hound/reqid"
+	"github.com/hound-search/hound/searcher"
+)
+
+// The states of a search job.
+const (
+	jobRunning   = "running"
+	jobDone      = "done"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+const (
+	// The most jobs that run at once. More are turned away until one of
+	// them is done.
+	maxRunningJobs = 8
+
+	// The most jobs that are kept, running or not. The oldest jobs that
+	// are done make room for new ones.
+	maxJobs = 100
+
+	// How long the results of a job are kept once it is done.
+	jobTTL = time.Hour
+)
+
+// The request to start a job: a query, with the same fields as those of a
+// batch, and whether to return the stats of the search.
+type jobRequest struct {
+	batchQuery
+	Stats bool `json:"stats"`
+}
+
+// A search that runs in the background, for queries that take longer
+// than a client or a proxy would wait for.
+type job struct {
+	lck sync.Mutex
+
+	id       string
+	state    string
+	done     int
+	total    int
+	created  time.Time
+	finished time.Time
+	res      *batchResult
+	cancel   func()
+
+	// Whether the search of the job has returned, which a cancelled one
+	// only does once its searches notice, and whether it was deleted.
+	// It is counted as running until then, deleted or not.
+	exited  bool
+	deleted bool
+}
+
+// What a client sees of a job while it polls it.
+type jobStatus struct {
+	Id         string
+	State      string
+	Progress   jobProgress
+	CreatedAt  time.Time
+	FinishedAt *time.Time `json:",omitempty"`
+
+	// Why the job failed, if it did.
+	Error   string            `json:",omitempty"`
+	Code    string            `json:",omitempty"`
+	Details map[string]string `json:",omitempty"`
+}
+
+// The searches of repos and of downstream instances that a job has done,
+// of all of the ones it has to.
+type jobProgress struct {
+	Done  int
+	Total int
+}
+
+func (j *job) status() *jobStatus {
+	j.lck.Lock()
+	defer j.lck.Unlock()
+
+	st := &jobStatus{
+		Id:        j.id,
+		State:     j.state,
+		Progress:  jobProgress{j.done, j.total},
+		CreatedAt: j.created,
+	}
+	if !j.finished.IsZero() {
+		t := j.finished
+		st.FinishedAt = &t
+	}
+	if j.state == jobFailed {
+		st.Error, st.Code, st.Details = j.res.Error, j.res.Code, j.res.Details
+	}
+	return st
+}
+
+func (j *job) progress(done, total int) {
+	j.lck.Lock()
+	defer j.lck.Unlock()
+	j.done, j.total = done, total
+}
+
+// Record the result of the job, unless it was cancelled first.
+func (j *job) finish(res *batchResult) {
+	j.lck.Lock()
+	defer j.lck.Unlock()
+
+	j.exited = true
+	if j.state != jobRunning {
+		return
+	}
+	j.res, j.finished = res, time.Now()
+	j.state = jobDone
+	if res.Error != "" {
+		j.state = jobFailed
+	}
+}
+
+func (j *job) stop() {
+	j.lck.Lock()
+	defer j.lck.Unlock()
+
+	if j.state == jobRunning {
+		j.state, j.finished = jobCancelled, time.Now()
+	}
+	j.cancel()
+}
+
+// The result of the job, or nil if it isn't done.
+func (j *job) result() *batchResult {
+	j.lck.Lock()
+	defer j.lck.Unlock()
+
+	if j.state != jobDone && j.state != jobFailed {
+		return nil
+	}
+	return j.res
+}
+
+// Whether the job is done and its results have been kept long enough.
+func (j *job) expired(now time.Time) bool {
+	j.lck.Lock()
+	defer j.lck.Unlock()
+	return j.exited && now.Sub(j.finished) > jobTTL
+}
+
+// Whether the search of the job is still going, even if it was cancelled.
+func (j *job) running() bool {
+	j.lck.Lock()
+	defer j.lck.Unlock()
+	return !j.exited
+}
+
+// Whether the job was deleted, and is kept only while its search stops.
+func (j *job) isDeleted() bool {
+	j.lck.Lock()
+	defer j.lck.Unlock()
+	return j.deleted
+}
+
+// The jobs of a server, by id.
+type jobs struct {
+	lck sync.Mutex
+	all map[string]*job
+}
+
+// Make room for a new job and add it, unless too many are running.
+func (js *jobs) add(j *job) error {
+	js.lck.Lock()
+	defer js.lck.Unlock()
+
+	now := time.Now()
+	running := 0
+	var oldest *job
+	for id, o := range js.all {
+		if o.expired(now) || (o.isDeleted() && !o.running()) {
+			delete(js.all, id)
+		} else if o.running() {
+			running++
+		} else if oldest == nil || o.created.Before(oldest.created) {
+			oldest = o
+		}
+	}
+
+	if running >= maxRunningJobs {
+		return newError(codeUnavailable, nil, "There are already %d search jobs running, try again later", running)
+	}
+	if len(js.all) >= maxJobs {
+		if oldest == nil {
+			return newError(codeUnavailable, nil, "There are already %d search jobs, try again later", len(js.all))
+		}
+		delete(js.all, oldest.id)
+	}
+
+	js.all[j.id] = j
+	return nil
+}
+
+func (js *jobs) get(id string) *job {
+	js.lck.Lock()
+	defer js.lck.Unlock()
+
+	if j := js.all[id]; j != nil && !j.isDeleted() && !j.expired(time.Now()) {
+		return j
+	}
+	return nil
+}
+
+// Delete a job. One whose search is still stopping is kept, so that it
+// counts toward the jobs that are running, until add finds it stopped.
+func (js *jobs) remove(id string) {
+	js.lck.Lock()
+	defer js.lck.Unlock()
+
+	j := js.all[id]
+	if j == nil {
+		return
+	}
+	if !j.running() {
+		delete(js.all, id)
+		return
+	}
+	j.lck.Lock()
+	j.deleted = true
+	j.lck.Unlock()
+}
+
+func jobNotFound(id string) error {
+	return newError(codeNotFound, map[string]string{"job": id}, "No such search job: %s", id)
+}
+
+func setupJobs(m *http.ServeMux, set *searcher.Set, fed *federation.Federation, hk *hooks.Chain) {
+	js := &jobs{all: map[string]*job{}}
+
+	m.HandleFunc("/api/v1/search/jobs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			methodNotAllowed(w)
+			return
+		}
+
+		var req jobRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, err, http.StatusBadRequest)
+			return
+		}
+		q := &req.batchQuery
+
+		// the job outlives the request, but is logged under its id.
+		ctx, cancel := context.WithCancel(
+			reqid.NewContext(context.Background(), reqid.FromContext(r.Context())))
+		j := &job{
+			id:      reqid.New(),
+			state:   jobRunning,
+			created: time.Now(),
+			cancel:  cancel,
+		}
+		if err := js.add(j); err != nil {
+			cancel()
+			writeError(w, err, http.StatusServiceUnavailable)
+			return
+		}
+
+		hr := r.Clone(ctx)
+		go func() {
+			defer cancel()
+
+			startedAt := time.Now()
+			res := searchBatch(ctx, []*batchQuery{q}, set, fed, j.progress)[0]
+			durationMs := int(time.Now().Sub(startedAt).Seconds() * 1000)
+			res.finish(q, "job", hk, hr, req.Stats, durationMs)
+			j.finish(res)
+		}()
+
+		writeJson(w, j.status(), http.StatusAccepted)
+	})
+
+	m.HandleFunc("/api/v1/search/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/v1/search/jobs/")
+		results := strings.HasSuffix(id, "/results")
+		id = strings.TrimSuffix(id, "/results")
+
+		j := js.get(id)
+		if j == nil || strings.Contains(id, "/") {
+			writeError(w, jobNotFound(id), http.StatusNotFound)
+			return
+		}
+
+		switch {
+		case r.Method == "GET" && results:
+			res := j.result()
+			if res == nil {
+				writeError(w,
+					newError(codeConflict, map[string]string{"job": id}, "Search job %s is %s", id, j.status().State),
+					http.StatusConflict)
+				return
+			}
+			writeResp(w, res)
+		case r.Method == "GET":
+			writeResp(w, j.status())
+		case r.Method == "DELETE" && !results:
+			j.stop()
+			js.remove(id)
+			writeResp(w, "ok")
+		default:
+			methodNotAllowed(w)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+)
+
+func TestSearchBatchCancelled(t *testing.T) {
+	set, done := makeSet(t, &config.Config{}, map[string]map[string]string{
+		"a": {"a.txt": "needle\n"},
+	})
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	res := searchBatch(ctx, []*batchQuery{{Query: "needle", Repos: "*"}}, set, nil, nil)
+	if !errors.Is(res[0].err, index.ErrCancelled) {
+		t.Fatalf("expected the search of the repo to be cancelled, got %v", res[0].err)
+	}
+}
+
+func TestRunningJobsCap(t *testing.T) {
+	js := &jobs{all: map[string]*job{}}
+
+	var running []*job
+	for i := 0; i < maxRunningJobs; i++ {
+		j := &job{id: string(rune('a' + i)), state: jobRunning, created: time.Now(), cancel: func() {}}
+		if err := js.add(j); err != nil {
+			t.Fatal(err)
+		}
+		running = append(running, j)
+	}
+
+	next := func() *job {
+		return &job{id: "next", state: jobRunning, created: time.Now(), cancel: func() {}}
+	}
+	if err := js.add(next()); err == nil {
+		t.Fatal("expected a job past the cap to be turned away")
+	}
+
+	// a cancelled and deleted job still counts until its search stops.
+	j := running[0]
+	j.stop()
+	js.remove(j.id)
+	if js.get(j.id) != nil {
+		t.Fatal("expected a deleted job to be gone")
+	}
+	if err := js.add(next()); err == nil {
+		t.Fatal("expected a job to be turned away while a cancelled one is stopping")
+	}
+
+	j.finish(&batchResult{})
+	if st := j.status().State; st != jobCancelled {
+		t.Fatalf("expected the job to stay cancelled, got %s", st)
+	}
+	if err := js.add(next()); err != nil {
+		t.Fatalf("expected room once the cancelled job stopped, got %s", err)
+	}
+	if _, ok := js.all[j.id]; ok {
+		t.Fatal("expected the deleted job to be dropped once it stopped")
+	}
+}
+
+func TestSearchBatchDefaultScope(t *testing.T) {
+	cfg := &config.Config{DefaultScope: &config.Scope{Repos: []string{"a"}}}
+	set, done := makeSet(t, cfg, map[string]map[string]string{
+		"a": {"a.txt": "needle\n"},
+		"b": {"b.txt": "needle\n"},
+	})
+	defer done()
+
+	res := searchBatch(context.Background(), []*batchQuery{{Query: "needle"}, {Query: "needle", Repos: "*"}}, set, nil, nil)
+	if got := res[0].Results; len(got) != 1 || got["a"] == nil {
+		t.Fatalf("expected a query without repos to search the default scope, got %v", got)
+	}
+	if got := res[1].Results; len(got) != 2 {
+		t.Fatalf("expected a query of * to search every repo, got %v", got)
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hound-search/hound/meta"
+	"github.com/hound-search/hound/searcher"
+	"github.com/hound-search/hound/user"
+)
+
+// The themes of the UI that a user can prefer.
+var themes = map[string]bool{
+	"":      true,
+	"light": true,
+	"dark":  true,
+	"auto":  true,
+}
+
+// The most files of a repo that a page can have, which is as many as the
+// UI loads at once.
+const maxResultsPerPage = 2000
+
+// Check the preferences that a user sent, filling in when their new
+// saved searches were made, or keeping when they were if old has them.
+func checkPreferences(p, old *meta.Preferences, now time.Time) error {
+	if !themes[p.Theme] {
+		return invalidParam("Theme", fmt.Errorf("unknown theme %q, expected light, dark or auto", p.Theme))
+	}
+	if p.LinesOfContext != nil && *p.LinesOfContext > maxLinesOfContext {
+		return invalidParam("LinesOfContext", fmt.Errorf("at most %d lines of context can be shown", maxLinesOfContext))
+	}
+	if p.ResultsPerPage > maxResultsPerPage {
+		return invalidParam("ResultsPerPage", fmt.Errorf("at most %d results can be shown per page", maxResultsPerPage))
+	}
+
+	created := map[string]time.Time{}
+	if old != nil {
+		for _, s := range old.Searches {
+			created[s.Name] = s.Created
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, s := range p.Searches {
+		if err := checkSavedSearch(s.Name, s.Params); err != nil {
+			return err
+		}
+		if seen[s.Name] {
+			return invalidParam("Searches", fmt.Errorf("there are two saved searches named %s", s.Name))
+		}
+		seen[s.Name] = true
+
+		if t, ok := created[s.Name]; ok {
+			s.Created = t
+		} else if s.Created.IsZero() {
+			s.Created = now
+		}
+	}
+	return nil
+}
+
+func setupPreferences(m *http.ServeMux, set *searcher.Set) {
+	// who the user is known as, which is what the maintainers of a repo
+	// are listed by.
+	m.HandleFunc("/api/v1/me", func(w http.ResponseWriter, r *http.Request) {
+		name := user.FromContext(r.Context())
+		if name == "" {
+			writeError(w,
+				newError(codeNotEnabled, nil, "Users are only known when api-tokens or user-header are set"),
+				http.StatusForbidden)
+			return
+		}
+		writeResp(w, map[string]string{"User": name})
+	})
+
+	m.HandleFunc("/api/v1/me/preferences", func(w http.ResponseWriter, r *http.Request) {
+		name := user.FromContext(r.Context())
+		if name == "" {
+			writeError(w,
+				newError(codeNotEnabled, nil, "Preferences are only kept for known users, when api-tokens or user-header are set"),
+				http.StatusForbidden)
+			return
+		}
+
+		db := set.Meta()
+		if db == nil {
+			writeError(w,
+				newError(codeNotEnabled, nil, "Preferences can't be kept by this instance"),
+				http.StatusForbidden)
+			return
+		}
+
+		old, err := db.Preferences(name)
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			if old == nil {
+				old = &meta.Preferences{}
+			}
+			writeResp(w, old)
+		case "PUT":
+			var p meta.Preferences
+			if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+
+			now := time.Now()
+			if err := checkPreferences(&p, old, now); err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+			p.Updated = now
+
+			if err := db.SetPreferences(name, &p); err != nil {
+				writeError(w, err, http.StatusInternalServerError)
+				return
+			}
+			writeResp(w, &p)
+		case "DELETE":
+			if _, err := db.DeletePreferences(name); err != nil {
+				writeError(w, err, http.StatusInternalServerError)
+				return
+			}
+			writeResp(w, "ok")
+		default:
+			methodNotAllowed(w)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/searcher"
+)
+
+// The largest payload of a webhook that is read.
+const maxPushBytes = 10 << 20
+
+// The headers that name the event of a webhook, and the ones that carry
+// the signature of its payload, for Gitea, Gogs and GitHub, whose push
+// payloads have the same repository in them.
+var (
+	webhookEventHeaders     = []string{"X-Gitea-Event", "X-Gogs-Event", "X-GitHub-Event"}
+	webhookSignatureHeaders = []string{"X-Gitea-Signature", "X-Gogs-Signature", "X-Hub-Signature-256"}
+)
+
+type pushPayload struct {
+	Repository struct {
+		CloneURL string `json:"clone_url"`
+		SSHURL   string `json:"ssh_url"`
+		HTMLURL  string `json:"html_url"`
+	} `json:"repository"`
+}
+
+// The event that an update was sent for by the webhook of a code host,
+// or "" if it didn't come from one.
+func webhookEvent(r *http.Request) string {
+	for _, h := range webhookEventHeaders {
+		if ev := r.Header.Get(h); ev != "" {
+			return ev
+		}
+	}
+	return ""
+}
+
+func readPush(r *http.Request) ([]byte, error) {
+	return ioutil.ReadAll(io.LimitReader(r.Body, maxPushBytes))
+}
+
+// The host and path of a clone url, in lower case and without .git, so
+// the https and ssh urls of a repo, in either form, are the same.
+func remoteKey(remote string) string {
+	var host, path string
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil {
+			return ""
+		}
+		host, path = u.Hostname(), u.Path
+	} else if i := strings.Index(remote, ":"); i >= 0 {
+		// scp style ssh urls
+		host, path = remote[:i], remote[i+1:]
+		if j := strings.LastIndex(host, "@"); j >= 0 {
+			host = host[j+1:]
+		}
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if host == "" || path == "" {
+		return ""
+	}
+	return strings.ToLower(host + "/" + path)
+}
+
+// The repos that a push payload is about, which are those at any of the
+// urls of its repository.
+func pushedRepos(body []byte, idx map[string]*searcher.Searcher) ([]string, error) {
+	var p pushPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]bool{}
+	for _, u := range []string{p.Repository.CloneURL, p.Repository.SSHURL, p.Repository.HTMLURL} {
+		if k := remoteKey(u); k != "" {
+			keys[k] = true
+		}
+	}
+
+	var repos []string
+	for name, srch := range idx {
+		if keys[remoteKey(srch.Repo.URL)] {
+			repos = append(repos, name)
+		}
+	}
+	sort.Strings(repos)
+	return repos, nil
+}
+
+// Whether a push is signed with the secret of the repo, or the repo
+// doesn't have one. The signature is the hex HMAC-SHA256 of the body.
+func signedPush(r *http.Request, body []byte, repo *config.Repo) bool {
+	if repo.PushSecretEnv == "" {
+		return true
+	}
+
+	secret := os.Getenv(repo.PushSecretEnv)
+	if secret == "" {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	exp := hex.EncodeToString(mac.Sum(nil))
+
+	for _, h := range webhookSignatureHeaders {
+		if sig := r.Header.Get(h); sig != "" {
+			sig = strings.TrimPrefix(sig, "sha256=")
+			return hmac.Equal([]byte(strings.ToLower(sig)), []byte(exp))
+		}
+	}
+	return false
+}
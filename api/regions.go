@@ -0,0 +1,119 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/hound-search/hound/hooks"
+	"github.com/hound-search/hound/index"
+)
+
+// The link and the metadata that result hooks gave the file of a region.
+type regionFile struct {
+	URL      string                 `json:",omitempty"`
+	Metadata map[string]interface{} `json:",omitempty"`
+}
+
+// A region of a file of a repo that an endpoint found, which result hooks
+// can drop, or link somewhere else.
+type hookedRegion interface {
+	location() (repo, filename string, line int)
+	file() *regionFile
+}
+
+// Run the hooks on regions as results of endpoint, each region being a
+// match at its first line, with no text, of a file of its repo. It returns
+// the regions that the hooks kept, in order, with what they set on their
+// files.
+func hookRegions(
+	hk *hooks.Chain,
+	endpoint string,
+	r *http.Request,
+	regions []hookedRegion) ([]hookedRegion, error) {
+	if hk == nil || len(regions) == 0 {
+		return regions, nil
+	}
+
+	res := map[string]*index.SearchResponse{}
+	files := map[string]map[string]*index.FileMatch{}
+	for _, rg := range regions {
+		repo, filename, line := rg.location()
+		sr := res[repo]
+		if sr == nil {
+			sr = &index.SearchResponse{}
+			res[repo] = sr
+			files[repo] = map[string]*index.FileMatch{}
+		}
+
+		fm := files[repo][filename]
+		if fm == nil {
+			fm = &index.FileMatch{Filename: filename}
+			files[repo][filename] = fm
+			sr.Matches = append(sr.Matches, fm)
+			sr.FilesWithMatch++
+		}
+		fm.Matches = append(fm.Matches, &index.Match{LineNumber: line})
+	}
+
+	hres := &hooks.Response{Results: res}
+	if err := hk.Process(&hooks.Request{Endpoint: endpoint, Params: r.Form, HTTP: r}, hres); err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		repo, filename string
+		line           int
+	}
+	kept := map[key]*index.FileMatch{}
+	for repo, sr := range hres.Results {
+		if sr == nil {
+			continue
+		}
+		for _, fm := range sr.Matches {
+			for _, m := range fm.Matches {
+				kept[key{repo, fm.Filename, m.LineNumber}] = fm
+			}
+		}
+	}
+
+	var out []hookedRegion
+	for _, rg := range regions {
+		repo, filename, line := rg.location()
+		fm := kept[key{repo, filename, line}]
+		if fm == nil {
+			continue
+		}
+		*rg.file() = regionFile{URL: fm.URL, Metadata: fm.Metadata}
+		out = append(out, rg)
+	}
+	return out, nil
+}
+
+// A region of /api/v1/similar.
+type similarRegion struct {
+	Repo string
+	*index.SimilarRegion
+	regionFile
+}
+
+func (s *similarRegion) location() (string, string, int) {
+	return s.Repo, s.Filename, s.StartLine
+}
+
+func (s *similarRegion) file() *regionFile {
+	return &s.regionFile
+}
+
+// A chunk of /api/v1/semantic.
+type semanticMatch struct {
+	Repo string
+	*index.SemanticMatch
+	regionFile
+}
+
+func (s *semanticMatch) location() (string, string, int) {
+	return s.Repo, s.Filename, s.StartLine
+}
+
+func (s *semanticMatch) file() *regionFile {
+	return &s.regionFile
+}
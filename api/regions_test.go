@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/hooks"
+	"github.com/hound-search/hound/index"
+)
+
+// A hook that drops the files named secret.go and links the rest.
+type redactHook struct {
+	endpoint string
+}
+
+func (h *redactHook) Process(req *hooks.Request, res *hooks.Response) error {
+	h.endpoint = req.Endpoint
+	for _, sr := range res.Results {
+		var kept []*index.FileMatch
+		for _, fm := range sr.Matches {
+			if fm.Filename == "secret.go" {
+				continue
+			}
+			fm.URL = "https://example.com/" + fm.Filename
+			kept = append(kept, fm)
+		}
+		sr.Matches = kept
+	}
+	return nil
+}
+
+func TestHookRegions(t *testing.T) {
+	h := &redactHook{}
+	hooks.Register("api-redact", func(cfg *config.ResultHook, client *http.Client) (hooks.Hook, error) {
+		return h, nil
+	})
+	hk, err := hooks.New([]*config.ResultHook{{Type: "api-redact"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	regions := []hookedRegion{
+		&similarRegion{Repo: "a", SimilarRegion: &index.SimilarRegion{Filename: "main.go", StartLine: 3, EndLine: 9}},
+		&similarRegion{Repo: "a", SimilarRegion: &index.SimilarRegion{Filename: "secret.go", StartLine: 1, EndLine: 4}},
+		&similarRegion{Repo: "b", SimilarRegion: &index.SimilarRegion{Filename: "main.go", StartLine: 12, EndLine: 20}},
+	}
+
+	r := httptest.NewRequest("GET", "/api/v1/similar", nil)
+	got, err := hookRegions(hk, "similar", r, regions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h.endpoint != "similar" {
+		t.Fatalf("expected the hook to run for similar, got %q", h.endpoint)
+	}
+	if len(got) != 2 || got[0] != regions[0] || got[1] != regions[2] {
+		t.Fatalf("expected the region of secret.go to be dropped, got %v", got)
+	}
+	for _, rg := range got {
+		if u := rg.file().URL; u != "https://example.com/main.go" {
+			t.Fatalf("expected the link the hook set, got %q", u)
+		}
+	}
+
+	if got, err := hookRegions(nil, "similar", r, regions); err != nil || len(got) != len(regions) {
+		t.Fatalf("expected no hooks to keep every region, got %v, %v", got, err)
+	}
+}
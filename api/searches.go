@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/hound-search/hound/meta"
+	"github.com/hound-search/hound/searcher"
+)
+
+// The longest name a saved search can have.
+const maxSearchNameLen = 100
+
+// The body of a request to save a search.
+type saveSearchRequest struct {
+	Name   string            `json:"name"`
+	Params map[string]string `json:"params"`
+}
+
+// Check the name and the parameters of a search that is being saved.
+func checkSavedSearch(name string, params map[string]string) error {
+	if name == "" || len(name) > maxSearchNameLen {
+		return invalidParam("name", errors.New("A saved search needs a name of at most 100 bytes"))
+	}
+	if params["q"] == "" {
+		return invalidParam("params", errors.New("A saved search needs a q"))
+	}
+	return nil
+}
+
+func setupSearches(m *http.ServeMux, set *searcher.Set) {
+	m.HandleFunc("/api/v1/searches", func(w http.ResponseWriter, r *http.Request) {
+		db := set.Meta()
+		if db == nil {
+			writeError(w,
+				newError(codeNotEnabled, nil, "Searches can't be saved by this instance"),
+				http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			res, err := db.SavedSearches()
+			if err != nil {
+				writeError(w, err, http.StatusInternalServerError)
+				return
+			}
+			if res == nil {
+				res = []*meta.SavedSearch{}
+			}
+			writeResp(w, res)
+		case "POST":
+			var req saveSearchRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+
+			if err := checkSavedSearch(req.Name, req.Params); err != nil {
+				writeError(w, err, http.StatusBadRequest)
+				return
+			}
+
+			s := &meta.SavedSearch{
+				Name:    req.Name,
+				Params:  req.Params,
+				Created: time.Now(),
+			}
+			if err := db.SaveSearch(s); err != nil {
+				writeError(w, err, http.StatusInternalServerError)
+				return
+			}
+			writeResp(w, s)
+		case "DELETE":
+			name := r.FormValue("name")
+			ok, err := db.DeleteSearch(name)
+			if err != nil {
+				writeError(w, err, http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				writeError(w,
+					newError(codeNotFound, map[string]string{"name": name}, "No saved search named %s", name),
+					http.StatusNotFound)
+				return
+			}
+			writeResp(w, "ok")
+		default:
+			methodNotAllowed(w)
+		}
+	})
+}
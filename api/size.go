@@ -0,0 +1,184 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/searcher"
+)
+
+// Where a search that was cut short to keep its response under its cap
+// on size goes on from: the files of the repo it was cut in from Offset,
+// with Limit of them left of the page if it had one, and then the repos
+// after it by name.
+type cursor struct {
+	Repo   string `json:"r"`
+	Offset int    `json:"o"`
+	Limit  int    `json:"l,omitempty"`
+}
+
+func (c *cursor) String() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func parseCursor(v string) (*cursor, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, errors.New("not a cursor of a search")
+	}
+
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Repo == "" || c.Offset < 0 || c.Limit < 0 {
+		return nil, errors.New("not a cursor of a search")
+	}
+	return &c, nil
+}
+
+// The most files that a search returns for each repo, or 0 for all of
+// them.
+func fileLimit(opt *index.SearchOptions) int {
+	if opt.MaxFiles > 0 && (opt.Limit <= 0 || opt.MaxFiles < opt.Limit) {
+		return opt.MaxFiles
+	}
+	return opt.Limit
+}
+
+// Search the repos like searchAll, but going on from the cursor c if it
+// is non-nil, so that only the repo of the cursor, from its file, and the
+// repos after it are searched.
+func searchFrom(
+	query string,
+	opt *index.SearchOptions,
+	repos []string,
+	idx map[string]*searcher.Searcher,
+	c *cursor,
+	filesOpened *int,
+	duration *int,
+	debug map[string]*RepoDebug) (map[string]*index.SearchResponse, error) {
+	if c == nil {
+		return searchAll(query, opt, repos, idx, filesOpened, duration, debug)
+	}
+
+	var rest []string
+	first := false
+	for _, repo := range repos {
+		if repo == c.Repo {
+			first = true
+		} else if repo > c.Repo {
+			rest = append(rest, repo)
+		}
+	}
+
+	res, err := searchAll(query, opt, rest, idx, filesOpened, duration, debug)
+	if err != nil || !first {
+		return res, err
+	}
+
+	o := *opt
+	o.Offset, o.Limit, o.MaxFiles = c.Offset, c.Limit, 0
+
+	var ms int
+	fres, err := searchAll(query, &o, []string{c.Repo}, idx, filesOpened, &ms, debug)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := fres[c.Repo]; ok {
+		res[c.Repo] = r
+	}
+	*duration += ms
+	return res, nil
+}
+
+// The number of bytes that v takes as JSON.
+func jsonSize(v interface{}) int {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
+
+// Keep the results of a search, which went on from the cursor c if it is
+// non-nil, to about max bytes of JSON, taking the repos in order of name
+// and the files of each in order, but always keeping the first file so
+// that going on from the cursor gets further. The repo that loses files
+// is marked truncated and the repos after it are left out. The results of
+// the downstream repos of remote are always kept whole, since a cursor
+// can't go on through them, and count against max first. It returns the
+// cursor to go on from, or nil if nothing was left out.
+func capSize(results map[string]*index.SearchResponse, max int, opt *index.SearchOptions, c *cursor, remote map[string]bool) *cursor {
+	if max <= 0 {
+		return nil
+	}
+
+	size, files := 0, 0
+	names := make([]string, 0, len(results))
+	for name, res := range results {
+		if remote[name] {
+			size += len(name) + jsonSize(res)
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		res := results[name]
+		if res == nil {
+			continue
+		}
+
+		// the response without its files, then each of them in turn.
+		fms := res.Matches
+		res.Matches = nil
+		size += len(name) + jsonSize(res)
+
+		kept := len(fms)
+		for j, fm := range fms {
+			size += jsonSize(fm) + 1
+			if size > max && files > 0 {
+				kept = j
+				break
+			}
+			files++
+		}
+		res.Matches = fms[:kept]
+
+		if kept == len(fms) {
+			continue
+		}
+
+		offset, limit := opt.Offset, fileLimit(opt)
+		if c != nil && name == c.Repo {
+			offset, limit = c.Offset, c.Limit
+		}
+		next := &cursor{Repo: name, Offset: offset + kept}
+		if limit > 0 {
+			next.Limit = limit - kept
+		}
+
+		// a repo without room for any of its files is left out whole, and
+		// comes back with the search that goes on from the cursor.
+		for _, n := range names[i+1:] {
+			delete(results, n)
+		}
+		if kept == 0 {
+			delete(results, name)
+		} else {
+			if res.Truncated == nil {
+				res.Truncated = &index.Truncation{}
+			}
+			res.Truncated.Size = true
+		}
+		return next
+	}
+	return nil
+}
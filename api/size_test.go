@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+)
+
+type searchPage struct {
+	Results map[string]*index.SearchResponse
+	Cursor  string
+	Error   string
+}
+
+func getSearch(t *testing.T, m *http.ServeMux, params url.Values) *searchPage {
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/search?"+params.Encode(), nil))
+
+	var p searchPage
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("%s: %s", w.Body.String(), err)
+	}
+	if p.Error != "" {
+		t.Fatal(p.Error)
+	}
+	return &p
+}
+
+func TestFollowCursor(t *testing.T) {
+	repos := map[string]map[string]string{}
+	for _, name := range []string{"a", "b", "c"} {
+		files := map[string]string{}
+		for i := 0; i < 5; i++ {
+			files[fmt.Sprintf("f%d.txt", i)] = "needle in a haystack\n"
+		}
+		repos[name] = files
+	}
+
+	set, done := makeSet(t, &config.Config{MaxResponseBytes: 1 << 20}, repos)
+	defer done()
+
+	m := http.NewServeMux()
+	Setup(m, set, nil, nil)
+
+	// every file, in one page.
+	exp := map[string]bool{}
+	for repo, res := range getSearch(t, m, url.Values{"q": {"needle"}, "repos": {"*"}}).Results {
+		for _, fm := range res.Matches {
+			exp[repo+"/"+fm.Filename] = true
+		}
+	}
+	if len(exp) != 15 {
+		t.Fatalf("expected 15 files, got %v", exp)
+	}
+
+	// and the same files, each once, in pages of a few of them.
+	got := map[string]bool{}
+	params := url.Values{"q": {"needle"}, "repos": {"*"}, "maxBytes": {"700"}}
+	pages := 0
+	for {
+		p := getSearch(t, m, params)
+		pages++
+		for repo, res := range p.Results {
+			for _, fm := range res.Matches {
+				key := repo + "/" + fm.Filename
+				if got[key] {
+					t.Fatalf("page %d has %s again", pages, key)
+				}
+				got[key] = true
+			}
+		}
+
+		if p.Cursor == "" {
+			break
+		}
+		if pages > len(exp) {
+			t.Fatalf("expected the cursor to get to the end, still going after %d pages", pages)
+		}
+		params.Set("cursor", p.Cursor)
+	}
+
+	if pages < 3 {
+		t.Fatalf("expected several pages, got %d", pages)
+	}
+	for key := range exp {
+		if !got[key] {
+			t.Errorf("expected %s on one of the pages", key)
+		}
+	}
+}
+
+func TestCapSizeKeepsRemoteRepos(t *testing.T) {
+	fm := func(name string) *index.FileMatch {
+		return &index.FileMatch{Filename: name, Matches: []*index.Match{{Line: "needle in a haystack"}}}
+	}
+	results := map[string]*index.SearchResponse{
+		"a":       {Matches: []*index.FileMatch{fm("1"), fm("2"), fm("3")}},
+		"ds/a":    {Matches: []*index.FileMatch{fm("1"), fm("2"), fm("3")}},
+		"zz/last": {Matches: []*index.FileMatch{fm("1")}},
+	}
+	remote := map[string]bool{"ds/a": true, "zz/last": true}
+
+	c := capSize(results, 1, &index.SearchOptions{}, nil, remote)
+	if c == nil || c.Repo != "a" || c.Offset != 1 {
+		t.Fatalf("expected a cursor in a after its first file, got %+v", c)
+	}
+	if len(results["ds/a"].Matches) != 3 || len(results["zz/last"].Matches) != 1 {
+		t.Fatalf("expected the downstream repos to be kept whole, got %v", results)
+	}
+	if len(results["a"].Matches) != 1 {
+		t.Fatalf("expected the first file of a, got %d", len(results["a"].Matches))
+	}
+}
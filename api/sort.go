@@ -0,0 +1,79 @@
+package api
+
+import (
+	"sort"
+	"time"
+
+	"github.com/hound-search/hound/index"
+)
+
+// The names of the repos of a search in the order of the sort by: by
+// name for index.SortRepo, by the first of their paths for index.SortPath,
+// with the most matches first for index.SortScore and with the files that
+// changed last first for index.SortMtime, with ties broken by name. Repos with no files come last. It is nil if by is empty, for
+// the repos in no order.
+func repoOrder(results map[string]*index.SearchResponse, by string) []string {
+	if by == "" {
+		return nil
+	}
+
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if by == index.SortRepo {
+		return names
+	}
+
+	firstPath := func(res *index.SearchResponse) string {
+		var p string
+		if len(res.Matches) > 0 {
+			p = res.Matches[0].Filename
+		}
+		if len(res.FilenameHits) > 0 && (p == "" || res.FilenameHits[0].Filename < p) {
+			p = res.FilenameHits[0].Filename
+		}
+		return p
+	}
+
+	score := func(res *index.SearchResponse) int {
+		n := len(res.FilenameHits)
+		for _, fm := range res.Matches {
+			n += len(fm.Matches)
+		}
+		return n
+	}
+
+	newest := func(res *index.SearchResponse) time.Time {
+		var t time.Time
+		for _, fm := range res.Matches {
+			if fm.Modified != nil && fm.Modified.After(t) {
+				t = *fm.Modified
+			}
+		}
+		return t
+	}
+
+	empty := func(res *index.SearchResponse) bool {
+		return res == nil || len(res.Matches) == 0 && len(res.FilenameHits) == 0
+	}
+
+	sort.SliceStable(names, func(i, j int) bool {
+		a, b := results[names[i]], results[names[j]]
+		if empty(a) || empty(b) {
+			return !empty(a) && empty(b)
+		}
+
+		switch by {
+		case index.SortPath:
+			return firstPath(a) < firstPath(b)
+		case index.SortScore:
+			return score(a) > score(b)
+		case index.SortMtime:
+			return newest(a).After(newest(b))
+		}
+		return false
+	})
+	return names
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/searcher"
+)
+
+// The kinds of suggestions.
+const (
+	suggestUnsupported = "unsupported"
+	suggestLiteral     = "literal"
+	suggestIgnoreCase  = "ignore-case"
+	suggestFiles       = "files"
+)
+
+// Suggestion is a search to retry with, and why it might find what a
+// search that found nothing, or failed, didn't.
+type Suggestion struct {
+	Kind    string
+	Message string
+
+	// The parameters of the search to change for the retry, where an
+	// empty value drops one. Suggestions without them only say what is
+	// wrong.
+	Params map[string]string `json:",omitempty"`
+}
+
+// The constructs of other regexp dialects that the regexps of searches
+// don't have, and what they can be rewritten to, if anything. Escaped
+// ones are left alone.
+var unsupportedConstructs = []struct {
+	re      *regexp.Regexp
+	rewrite string
+	msg     string
+}{
+	{regexp.MustCompile(`(^|[^\\])\(\?<?=`), "${1}(?:", "Lookaheads and lookbehinds aren't supported, so this matches what they look for as well"},
+	{regexp.MustCompile(`(^|[^\\])\(\?<?!`), "", "Negative lookaheads and lookbehinds aren't supported"},
+	{regexp.MustCompile(`(^|[^\\])\(\?>`), "${1}(?:", "Atomic groups aren't supported, so this makes them plain groups"},
+	{regexp.MustCompile(`(^|[^\\])([*+?}])\+`), "${1}${2}", "Possessive quantifiers aren't supported, so this makes them greedy"},
+	{regexp.MustCompile(`(^|[^\\])\\[1-9]`), "", "Backreferences aren't supported"},
+}
+
+// A path filter that is a glob, like *.go, rather than a regexp.
+var globLike = regexp.MustCompile(`^[^\\()\[\]{}^$|+]*[*?][^\\()\[\]{}^$|+]*$`)
+
+// The pattern pat of a retry, with the filter terms of the query q that
+// it was taken from.
+func withFilters(q, pat string) string {
+	pat = escapeFilters(pat)
+	for _, m := range filterTerm.FindAllStringSubmatch(q, -1) {
+		if m[2] == "" {
+			pat += " " + strings.TrimSpace(m[0])
+		}
+	}
+	return pat
+}
+
+// The regexp that matches the paths that a glob does.
+func globToRegexp(g string) string {
+	var b strings.Builder
+	if strings.HasPrefix(g, "*") {
+		g = strings.TrimLeft(g, "*")
+	} else {
+		b.WriteString("(^|/)")
+	}
+
+	for _, r := range g {
+		switch r {
+		case '*':
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// Point out the constructs of the pattern pat of the query q that the
+// regexps of searches don't have, with a rewrite of it without them
+// where there is one.
+func lintQuery(q, pat string) []*Suggestion {
+	var sugs []*Suggestion
+	for _, u := range unsupportedConstructs {
+		if !u.re.MatchString(pat) {
+			continue
+		}
+
+		s := &Suggestion{Kind: suggestUnsupported, Message: u.msg}
+		if u.rewrite != "" {
+			s.Params = map[string]string{"q": withFilters(q, u.re.ReplaceAllString(pat, u.rewrite))}
+		}
+		sugs = append(sugs, s)
+	}
+	return sugs
+}
+
+// Whether a search of pat with opt finds anything in the repos. Only
+// whether it does is wanted, so it stops at the first match.
+func found(pat string, opt *index.SearchOptions, repos []string, idx map[string]*searcher.Searcher) bool {
+	o := *opt
+	o.Offset, o.Limit, o.MaxMatches = 0, 1, 1
+	o.Facets = false
+
+	var filesOpened, durationMs int
+	res, err := searchAll(pat, &o, repos, idx, &filesOpened, &durationMs, nil)
+	return err == nil && len(res) > 0
+}
+
+// Whether any of the files of the repos has a path that re matches.
+func anyPath(re *regexp.Regexp, repos []string, idx map[string]*searcher.Searcher) bool {
+	for _, repo := range repos {
+		if paths, _, err := idx[repo].FindPaths(re, 1); err == nil && len(paths) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Suggest a path filter close to files for one that matches none of the
+// files of the repos: the regexp of a glob, the filter ignoring case or
+// without its anchors. Failing those, dropping the filter is suggested.
+func suggestPaths(files string, repos []string, idx map[string]*searcher.Searcher) []*Suggestion {
+	if files == "" {
+		return nil
+	}
+
+	re, err := regexp.Compile(files)
+	if err == nil && anyPath(re, repos, idx) {
+		return nil
+	}
+
+	var near []string
+	if err != nil || globLike.MatchString(files) {
+		near = append(near, globToRegexp(files))
+	}
+	if err == nil {
+		if !strings.HasPrefix(files, "(?i)") {
+			near = append(near, "(?i)"+files)
+		}
+		if bare := strings.TrimSuffix(strings.TrimPrefix(files, "^"), "$"); bare != files && bare != "" {
+			near = append(near, bare)
+		}
+	}
+
+	for _, f := range near {
+		if nre, err := regexp.Compile(f); err == nil && anyPath(nre, repos, idx) {
+			return []*Suggestion{{
+				Kind:    suggestFiles,
+				Message: fmt.Sprintf("No file matches the path filter %s, but some match %s", files, f),
+				Params:  map[string]string{"files": f},
+			}}
+		}
+	}
+
+	if err != nil {
+		return nil
+	}
+	return []*Suggestion{{
+		Kind:    suggestFiles,
+		Message: fmt.Sprintf("No file matches the path filter %s", files),
+		Params:  map[string]string{"files": ""},
+	}}
+}
+
+// Suggest retries of a search of the pattern pat, taken from the query q,
+// with opt in the repos, which failed with searchErr or found nothing if
+// that is nil. Only the retries that find something are suggested, other
+// than rewrites of constructs that aren't supported.
+func suggest(q, pat string, opt *index.SearchOptions, searchErr error, repos []string, idx map[string]*searcher.Searcher) []*Suggestion {
+	sugs := []*Suggestion{}
+
+	// structural patterns aren't regexps.
+	if !opt.Structural {
+		sugs = append(sugs, lintQuery(q, pat)...)
+
+		if lit := regexp.QuoteMeta(pat); lit != pat && found(lit, opt, repos, idx) {
+			sugs = append(sugs, &Suggestion{
+				Kind:    suggestLiteral,
+				Message: fmt.Sprintf("Search for %s as text rather than as a regexp", pat),
+				Params:  map[string]string{"q": withFilters(q, lit)},
+			})
+		}
+	}
+
+	if searchErr == nil && !opt.IgnoreCase {
+		o := *opt
+		o.IgnoreCase = true
+		if found(pat, &o, repos, idx) {
+			sugs = append(sugs, &Suggestion{
+				Kind:    suggestIgnoreCase,
+				Message: "Search ignoring case",
+				Params:  map[string]string{"case": "insensitive"},
+			})
+		}
+	}
+
+	return append(sugs, suggestPaths(opt.FileRegexp, repos, idx)...)
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/meta"
+	"github.com/hound-search/hound/searcher"
+	"github.com/hound-search/hound/user"
+)
+
+const (
+	// How often the usage that was counted is written to the metadata.
+	usageFlushInterval = 5 * time.Minute
+
+	// The longest term that is counted, in bytes, and the most terms of
+	// a repo that are shown.
+	maxUsageTermLength = 200
+	maxUsageTermsShown = 50
+)
+
+// usage counts how the repos are searched in memory, writing the counts
+// to the metadata of the set now and then so that searches don't each
+// write to it.
+type usage struct {
+	set     *searcher.Set
+	lck     sync.Mutex
+	pending map[string]*meta.RepoUsage
+}
+
+func newUsage(set *searcher.Set) *usage {
+	u := &usage{set: set, pending: map[string]*meta.RepoUsage{}}
+	go func() {
+		for range time.Tick(usageFlushInterval) {
+			u.flush()
+		}
+	}()
+	return u
+}
+
+// Count a search for a term of the repos, and those that it found
+// something in.
+func (u *usage) record(term string, repos []string, results map[string]*index.SearchResponse, now time.Time) {
+	if u.set.Meta() == nil {
+		return
+	}
+
+	term = strings.TrimSpace(term)
+	if len(term) > maxUsageTermLength {
+		n := maxUsageTermLength
+		for n > 0 && !utf8.RuneStart(term[n]) {
+			n--
+		}
+		term = term[:n]
+	}
+
+	u.lck.Lock()
+	defer u.lck.Unlock()
+
+	for _, repo := range repos {
+		p := u.pending[repo]
+		if p == nil {
+			p = &meta.RepoUsage{Terms: map[string]int64{}, Since: now}
+			u.pending[repo] = p
+		}
+
+		p.Searches++
+		if results[repo] != nil {
+			p.Hits++
+		}
+		if term != "" {
+			p.Terms[term]++
+		}
+	}
+}
+
+// Write the counts since the last flush to the metadata.
+func (u *usage) flush() {
+	db := u.set.Meta()
+	if db == nil {
+		return
+	}
+
+	u.lck.Lock()
+	pending := u.pending
+	u.pending = map[string]*meta.RepoUsage{}
+	u.lck.Unlock()
+
+	for repo, p := range pending {
+		if err := db.AddUsage(repo, p); err != nil {
+			log.Printf("failed to record the usage of %s: %s", repo, err)
+		}
+	}
+}
+
+// TermCount is how many times a term was searched for.
+type TermCount struct {
+	Term  string
+	Count int64
+}
+
+// RepoUsage is how a repo has been searched, with the terms that were
+// searched for most first.
+type RepoUsage struct {
+	Repo     string
+	Searches int64
+	Hits     int64
+	Since    *time.Time `json:",omitempty"`
+	Terms    []*TermCount
+}
+
+func newRepoUsage(repo string, u *meta.RepoUsage) *RepoUsage {
+	res := &RepoUsage{Repo: repo, Terms: []*TermCount{}}
+	if u == nil {
+		return res
+	}
+
+	res.Searches, res.Hits = u.Searches, u.Hits
+	if !u.Since.IsZero() {
+		res.Since = &u.Since
+	}
+
+	for t, n := range u.Terms {
+		res.Terms = append(res.Terms, &TermCount{t, n})
+	}
+	sort.Slice(res.Terms, func(i, j int) bool {
+		a, b := res.Terms[i], res.Terms[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Term < b.Term
+	})
+	if len(res.Terms) > maxUsageTermsShown {
+		res.Terms = res.Terms[:maxUsageTermsShown]
+	}
+	return res
+}
+
+// Whether a user is one of the maintainers of a repo.
+func maintains(srch *searcher.Searcher, name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, m := range srch.Repo.Maintainers {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+// The usage of a repo is shown to its maintainers.
+func setupUsage(m *http.ServeMux, set *searcher.Set) {
+	m.HandleFunc("/api/v1/usage", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			methodNotAllowed(w)
+			return
+		}
+
+		repo := r.FormValue("repo")
+		srch := set.Get(repo)
+		if srch == nil {
+			err := repoError(set, repo)
+			writeError(w, err, repoErrorStatus(err))
+			return
+		}
+
+		if !maintains(srch, user.FromContext(r.Context())) {
+			writeError(w,
+				newError(codeUnauthorized, map[string]string{"repo": repo}, "Only the maintainers of %s can see how it is searched", repo),
+				http.StatusForbidden)
+			return
+		}
+
+		u, err := set.Meta().Usage(repo)
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+			return
+		}
+		writeResp(w, newRepoUsage(repo, u))
+	})
+}
+
+// The usage of every repo is shown to admins, who can also reset it.
+func setupAdminUsage(m *http.ServeMux, set *searcher.Set) {
+	m.HandleFunc("/api/v1/admin/usage", func(w http.ResponseWriter, r *http.Request) {
+		db := set.Meta()
+		repo := r.FormValue("repo")
+
+		switch r.Method {
+		case "GET":
+			repos := db.UsageRepos()
+			if repo != "" {
+				repos = []string{repo}
+			}
+
+			res := []*RepoUsage{}
+			for _, name := range repos {
+				u, err := db.Usage(name)
+				if err != nil {
+					writeError(w, err, http.StatusInternalServerError)
+					return
+				}
+				res = append(res, newRepoUsage(name, u))
+			}
+			sort.SliceStable(res, func(i, j int) bool {
+				return res[i].Searches > res[j].Searches
+			})
+			writeResp(w, res)
+		case "DELETE":
+			if repo == "" {
+				writeError(w, invalidParam("repo", errors.New("the repo to reset is required")), http.StatusBadRequest)
+				return
+			}
+			if _, err := db.DeleteUsage(repo); err != nil {
+				writeError(w, err, http.StatusInternalServerError)
+				return
+			}
+			writeResp(w, "ok")
+		default:
+			methodNotAllowed(w)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/hound-search/hound/index"
+)
+
+// The format of a search that asks for its results as text.
+const vimgrepFormat = "vimgrep"
+
+// Whether a search asks for its results as text, with format=vimgrep or
+// by accepting text/plain, rather than as JSON.
+func wantsVimgrep(r *http.Request) bool {
+	if f := r.FormValue("format"); f != "" {
+		return f == vimgrepFormat
+	}
+
+	for _, a := range strings.Split(r.Header.Get("Accept"), ",") {
+		if t, _, err := mime.ParseMediaType(strings.TrimSpace(a)); err == nil && t == "text/plain" {
+			return true
+		}
+	}
+	return false
+}
+
+// Write the results of a search as ripgrep's --vimgrep does, a line of
+// repo/path:line:column:text for each place that the pattern matched, so
+// they can be piped into tools and read by editors as a quickfix list.
+// The repos come in the order given, and the rest by name.
+func writeVimgrep(w http.ResponseWriter, results map[string]*index.SearchResponse, order []string) {
+	seen := map[string]bool{}
+	names := make([]string, 0, len(results))
+	for _, name := range order {
+		if _, ok := results[name]; ok && !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+	var rest []string
+	for name := range results {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	names = append(names, rest...)
+
+	w.Header().Set("Content-Type", "text/plain;charset=utf-8")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+
+	b := bufio.NewWriter(w)
+	defer b.Flush()
+	for _, name := range names {
+		res := results[name]
+		if res == nil {
+			continue
+		}
+		for _, fm := range res.Matches {
+			for _, m := range fm.Matches {
+				for _, col := range m.Columns() {
+					fmt.Fprintf(b, "%s/%s:%d:%d:%s\n", name, fm.Filename, m.LineNumber, col, m.Line)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Package bench measures search latency and throughput by replaying a
+// mix of queries, either against a running instance or directly against
+// the indexes in a dbpath.
+package bench
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hound-search/hound/client"
+)
+
+// Target runs one query.
+type Target interface {
+	Search(q *client.Query) error
+}
+
+// Options control how the queries are replayed.
+type Options struct {
+	// The number of queries run at once.
+	Concurrency int
+
+	// The total number of queries to run, cycling through the mix. If
+	// Duration is also set, whichever comes first stops the run.
+	Requests int
+	Duration time.Duration
+}
+
+// Report is the outcome of a run.
+type Report struct {
+	Requests int
+	Errors   int
+
+	// The first error, to show what went wrong.
+	FirstError error
+
+	Elapsed time.Duration
+
+	// Latency percentiles of the queries, including the failed ones.
+	P50, P90, P99, Max time.Duration
+
+	// The query that took the longest.
+	Slowest *client.Query
+}
+
+// Throughput is the number of queries run per second.
+func (r *Report) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Elapsed.Seconds()
+}
+
+// Print the report in a form meant for people.
+func (r *Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "requests:   %d (%d failed)\n", r.Requests, r.Errors)
+	fmt.Fprintf(w, "elapsed:    %s\n", r.Elapsed)
+	fmt.Fprintf(w, "throughput: %.1f queries/s\n", r.Throughput())
+	fmt.Fprintf(w, "latency:    p50 %s, p90 %s, p99 %s, max %s\n", r.P50, r.P90, r.P99, r.Max)
+	if r.Slowest != nil {
+		fmt.Fprintf(w, "slowest:    %q\n", r.Slowest.Pattern)
+	}
+	if r.FirstError != nil {
+		fmt.Fprintf(w, "first error: %s\n", r.FirstError)
+	}
+}
+
+// The latency at percentile p of the sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	i := int(float64(len(sorted))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+type timing struct {
+	q   *client.Query
+	d   time.Duration
+	err error
+}
+
+// Run replays the queries against t until the run is over.
+func Run(t Target, queries []*client.Query, opt *Options) *Report {
+	conc := opt.Concurrency
+	if conc < 1 {
+		conc = 1
+	}
+
+	var deadline time.Time
+	if opt.Duration > 0 {
+		deadline = time.Now().Add(opt.Duration)
+	}
+
+	var lck sync.Mutex
+	next := 0
+
+	// The next query to run, or nil when the run is over.
+	take := func() *client.Query {
+		lck.Lock()
+		defer lck.Unlock()
+
+		if opt.Requests > 0 && next >= opt.Requests {
+			return nil
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return nil
+		}
+		if opt.Requests <= 0 && deadline.IsZero() && next >= len(queries) {
+			return nil
+		}
+
+		q := queries[next%len(queries)]
+		next++
+		return q
+	}
+
+	ch := make(chan *timing, conc)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < conc; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for q := take(); q != nil; q = take() {
+				t0 := time.Now()
+				err := t.Search(q)
+				ch <- &timing{q, time.Since(t0), err}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+
+	r := &Report{}
+	var lat []time.Duration
+	for tm := range ch {
+		r.Requests++
+		lat = append(lat, tm.d)
+
+		if tm.err != nil {
+			r.Errors++
+			if r.FirstError == nil {
+				r.FirstError = tm.err
+			}
+		}
+
+		if tm.d > r.Max {
+			r.Max, r.Slowest = tm.d, tm.q
+		}
+	}
+	r.Elapsed = time.Since(start)
+
+	sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+	r.P50 = percentile(lat, 0.50)
+	r.P90 = percentile(lat, 0.90)
+	r.P99 = percentile(lat, 0.99)
+
+	return r
+}
+
+// Parse one line of a query log, which is either a pattern on its own or
+// the query string of a request to /api/v1/search, optionally with its
+// path as it appears in an access log.
+func parseQuery(line string) (*client.Query, error) {
+	if i := strings.Index(line, "/api/v1/search?"); i >= 0 {
+		line = line[i+len("/api/v1/search?"):]
+		if j := strings.IndexAny(line, " \t\""); j >= 0 {
+			line = line[:j]
+		}
+	} else if !strings.HasPrefix(line, "q=") {
+		return &client.Query{Pattern: line, Repos: "*"}, nil
+	}
+
+	v, err := url.ParseQuery(line)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &client.Query{
+		Pattern: v.Get("q"),
+		Repos:   v.Get("repos"),
+		Tags:    v.Get("tags"),
+		Files:   v.Get("files"),
+	}
+
+	if q.Repos == "" {
+		q.Repos = "*"
+	}
+
+	switch strings.ToLower(v.Get("i")) {
+	case "true", "1", "fosho":
+		q.IgnoreCase = true
+	}
+
+	if ctx := v.Get("ctx"); ctx != "" {
+		if q.Context, err = strconv.Atoi(ctx); err != nil {
+			return nil, fmt.Errorf("bad ctx: %s", ctx)
+		}
+	}
+
+	return q, nil
+}
+
+// LoadQueries reads a query log with one query per line. Blank lines and
+// lines starting with # are skipped.
+func LoadQueries(r io.Reader) ([]*client.Query, error) {
+	var qs []*client.Query
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		q, err := parseQuery(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		if q.Pattern == "" {
+			continue
+		}
+		qs = append(qs, q)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(qs) == 0 {
+		return nil, fmt.Errorf("no queries found")
+	}
+
+	return qs, nil
+}
+
+// Mix is a generated mix of the kinds of queries people run: short and
+// long literals, case insensitive ones, regexps with and without good
+// trigrams, and ones restricted to some files.
+func Mix() []*client.Query {
+	return []*client.Query{
+		{Pattern: "TODO", Repos: "*", Context: 2},
+		{Pattern: "return nil", Repos: "*", Context: 2},
+		{Pattern: "error", Repos: "*", Context: 2, IgnoreCase: true},
+		{Pattern: "import", Repos: "*", Context: 2, Files: `\.(go|py|java|js|ts)$`},
+		{Pattern: `func \w+\(`, Repos: "*", Context: 2},
+		{Pattern: `(foo|bar)baz`, Repos: "*", Context: 2},
+		{Pattern: `https?://[^\s"]+`, Repos: "*", Context: 0},
+		{Pattern: `[A-Z][a-z]+Exception`, Repos: "*", Context: 2},
+		{Pattern: "password", Repos: "*", Context: 2, IgnoreCase: true},
+		{Pattern: "xyzzy_not_in_any_repo", Repos: "*", Context: 2},
+		{Pattern: `\bmain\b`, Repos: "*", Context: 2, Files: "README|Makefile"},
+		{Pattern: "Copyright", Repos: "*", Context: 0},
+	}
+}
@@ -0,0 +1,146 @@
+package bench
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hound-search/hound/client"
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+)
+
+func TestLoadQueries(t *testing.T) {
+	log := `
+# a comment
+TODO
+q=foo&repos=a,b&i=fosho&ctx=0
+127.0.0.1 - - "GET /api/v1/search?q=bar%28&files=%5C.go%24 HTTP/1.1" 200
+`
+	qs, err := LoadQueries(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(qs) != 3 {
+		t.Fatalf("expected 3 queries, got %d", len(qs))
+	}
+
+	if qs[0].Pattern != "TODO" || qs[0].Repos != "*" {
+		t.Errorf("bad plain query: %+v", qs[0])
+	}
+
+	if q := qs[1]; q.Pattern != "foo" || q.Repos != "a,b" || !q.IgnoreCase || q.Context != 0 {
+		t.Errorf("bad query string: %+v", q)
+	}
+
+	if q := qs[2]; q.Pattern != "bar(" || q.Files != `\.go$` || q.Repos != "*" {
+		t.Errorf("bad access log line: %+v", q)
+	}
+
+	if _, err := LoadQueries(strings.NewReader("# nothing\n")); err == nil {
+		t.Error("expected an empty log to fail")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var lat []time.Duration
+	for i := 1; i <= 100; i++ {
+		lat = append(lat, time.Duration(i))
+	}
+
+	for p, want := range map[float64]time.Duration{0.5: 50, 0.9: 90, 0.99: 99, 1: 100} {
+		if got := percentile(lat, p); got != want {
+			t.Errorf("percentile %v: expected %d, got %d", p, want, got)
+		}
+	}
+
+	if got := percentile(nil, 0.5); got != 0 {
+		t.Errorf("expected 0 for no latencies, got %d", got)
+	}
+}
+
+type fakeTarget struct {
+	n int32
+}
+
+func (f *fakeTarget) Search(q *client.Query) error {
+	atomic.AddInt32(&f.n, 1)
+	if q.Pattern == "bad" {
+		return errors.New("bad pattern")
+	}
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	qs := []*client.Query{{Pattern: "good"}, {Pattern: "bad"}}
+
+	f := &fakeTarget{}
+	r := Run(f, qs, &Options{Concurrency: 3, Requests: 10})
+	if r.Requests != 10 || f.n != 10 {
+		t.Fatalf("expected 10 requests, got %d (%d run)", r.Requests, f.n)
+	}
+	if r.Errors != 5 || r.FirstError == nil {
+		t.Fatalf("expected 5 errors, got %d", r.Errors)
+	}
+
+	// without a limit, the queries are run once.
+	if r := Run(&fakeTarget{}, qs, &Options{}); r.Requests != 2 {
+		t.Fatalf("expected 2 requests, got %d", r.Requests)
+	}
+
+	r = Run(&fakeTarget{}, qs, &Options{Duration: 20 * time.Millisecond})
+	if r.Requests == 0 || r.Elapsed < 20*time.Millisecond {
+		t.Fatalf("expected a run of 20ms, got %d requests in %s", r.Requests, r.Elapsed)
+	}
+}
+
+func thisDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}
+
+func TestLocal(t *testing.T) {
+	dbpath, err := ioutil.TempDir("", "hound-bench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbpath)
+
+	if _, err := index.Build(&index.IndexOptions{}, filepath.Join(dbpath, "idx-1"), thisDir(), "file:///bench", "rev"); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		DbPath: dbpath,
+		Repos: map[string]*config.Repo{
+			"bench":   {URL: "file:///bench", Tags: []string{"go"}},
+			"missing": {URL: "file:///missing"},
+		},
+	}
+
+	local, err := OpenLocal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+
+	if local.Len() != 1 {
+		t.Fatalf("expected 1 index, got %d", local.Len())
+	}
+
+	if got := local.reposFor(&client.Query{Repos: "*", Tags: "python"}); len(got) != 0 {
+		t.Fatalf("expected no repos tagged python, got %v", got)
+	}
+
+	r := Run(local, Mix(), &Options{Concurrency: 2})
+	if r.Errors != 0 {
+		t.Fatalf("expected no errors, got %s", r.FirstError)
+	}
+}
@@ -0,0 +1,146 @@
+package bench
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/hound-search/hound/client"
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+)
+
+type remote struct {
+	cfg *client.Config
+}
+
+// Remote is a target that sends every query to the API of a running
+// instance, the way the command line client does.
+func Remote(cfg *client.Config) Target {
+	return &remote{cfg}
+}
+
+func (t *remote) Search(q *client.Query) error {
+	var res client.Response
+	return client.Search(&res, t.cfg, q)
+}
+
+// Local is a target that searches the indexes in a dbpath directly, which
+// leaves out the cost of HTTP and of encoding the response.
+type Local struct {
+	repos map[string]*config.Repo
+	idx   map[string]*index.Index
+}
+
+// OpenLocal opens the newest index of each repo of cfg in its dbpath.
+// Repos without an index are left out.
+func OpenLocal(cfg *config.Config) (*Local, error) {
+	dirs, err := filepath.Glob(filepath.Join(cfg.DbPath, "idx-*"))
+	if err != nil {
+		return nil, err
+	}
+
+	newest := map[string]*index.IndexRef{}
+	for _, dir := range dirs {
+		ref, err := index.Read(dir)
+		if err != nil {
+			continue
+		}
+
+		if cur := newest[ref.Url]; cur == nil || ref.Time.After(cur.Time) {
+			newest[ref.Url] = ref
+		}
+	}
+
+	t := &Local{
+		repos: map[string]*config.Repo{},
+		idx:   map[string]*index.Index{},
+	}
+
+	for name, repo := range cfg.Repos {
+		ref := newest[repo.URL]
+		if ref == nil {
+			continue
+		}
+
+		idx, err := ref.Open()
+		if err != nil {
+			t.Close()
+			return nil, err
+		}
+
+		t.repos[name] = repo
+		t.idx[name] = idx
+	}
+
+	return t, nil
+}
+
+// Len is the number of repos with an open index.
+func (t *Local) Len() int {
+	return len(t.idx)
+}
+
+// Close the indexes.
+func (t *Local) Close() {
+	for _, idx := range t.idx {
+		idx.Close()
+	}
+}
+
+// The repos a query covers, as the API would choose them.
+func (t *Local) reposFor(q *client.Query) []string {
+	var names []string
+	if q.Repos == "*" || q.Repos == "" {
+		for name := range t.idx {
+			names = append(names, name)
+		}
+	} else {
+		for _, name := range strings.Split(q.Repos, ",") {
+			if t.idx[name] != nil {
+				names = append(names, name)
+			}
+		}
+	}
+
+	if q.Tags == "" {
+		return names
+	}
+
+	var tagged []string
+	for _, name := range names {
+		for _, tag := range strings.Split(q.Tags, ",") {
+			if t.repos[name].HasTag(strings.TrimSpace(tag)) {
+				tagged = append(tagged, name)
+				break
+			}
+		}
+	}
+	return tagged
+}
+
+func (t *Local) Search(q *client.Query) error {
+	opt := &index.SearchOptions{
+		IgnoreCase:     q.IgnoreCase,
+		LinesOfContext: uint(q.Context),
+		FileRegexp:     q.Files,
+	}
+
+	repos := t.reposFor(q)
+
+	// like the API, every repo is searched at once.
+	ch := make(chan error, len(repos))
+	for _, name := range repos {
+		go func(idx *index.Index) {
+			_, err := idx.Search(q.Regexp(), opt)
+			ch <- err
+		}(t.idx[name])
+	}
+
+	var first error
+	for range repos {
+		if err := <-ch; err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
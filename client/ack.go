@@ -3,7 +3,7 @@ package client
 import (
 	"bytes"
 	"fmt"
-	"os"
+	"io"
 	"regexp"
 
 	"github.com/hound-search/hound/ansi"
@@ -11,7 +11,8 @@ import (
 )
 
 type ackPresenter struct {
-	f *os.File
+	f io.Writer
+	c *ansi.Colorer
 }
 
 func hiliteMatches(c *ansi.Colorer, p *regexp.Regexp, line string) string {
@@ -60,11 +61,12 @@ func (p *ackPresenter) Present(
 	repos map[string]*config.Repo,
 	res *Response) error {
 
-	c := ansi.NewFor(p.f)
+	c := p.c
 
 	buf := bytes.NewBuffer(make([]byte, 0, 20))
 
-	for repo, resp := range res.Results {
+	for _, repo := range sortedRepos(res) {
+		resp := res.Results[repo]
 		if _, err := fmt.Fprintf(p.f, "%s\n",
 			c.Fg(repoNameFor(repos, repo), ansi.Red, ansi.Bold)); err != nil {
 			return err
@@ -110,6 +112,6 @@ func (p *ackPresenter) Present(
 	return nil
 }
 
-func NewAckPresenter(w *os.File) Presenter {
-	return &ackPresenter{w}
+func NewAckPresenter(w io.Writer, c *ansi.Colorer) Presenter {
+	return &ackPresenter{w, c}
 }
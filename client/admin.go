@@ -0,0 +1,109 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hound-search/hound/config"
+)
+
+// RepoStatus is the state of a repo as the admin API reports it.
+type RepoStatus struct {
+	State     string
+	URL       string
+	Rev       string
+	IndexedAt *time.Time
+	Error     string
+
+	// How long the index took to build, if it is known.
+	IndexMs int64
+
+	// Set for repos whose updates are failing.
+	Failures    int
+	NextAttempt *time.Time
+	CircuitOpen bool
+}
+
+// Make a request to the admin API, decoding the response into res if it
+// is not nil.
+func doAdmin(cfg *Config, method, path string, params url.Values, body interface{}, res interface{}) error {
+	u := fmt.Sprintf("http://%s/api/v1/admin/%s", cfg.Host, path)
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	r, err := doHttp(cfg, method, u, &buf, cfg.AdminToken)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	switch r.StatusCode {
+	case http.StatusOK, http.StatusAccepted:
+	case http.StatusUnauthorized:
+		return errors.New("Unauthorized, check the admin token")
+	default:
+		return responseError(r)
+	}
+
+	if res == nil {
+		return nil
+	}
+	return json.NewDecoder(r.Body).Decode(res)
+}
+
+// RepoStatuses returns the state of every repo on the host, or of just
+// the one that is named.
+func RepoStatuses(cfg *Config, repo string) (map[string]*RepoStatus, error) {
+	params := url.Values{}
+	if repo != "" {
+		params.Set("repo", repo)
+	}
+
+	res := map[string]*RepoStatus{}
+	if err := doAdmin(cfg, "GET", "repos", params, nil, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// AddRepo starts indexing another repo on the host.
+func AddRepo(cfg *Config, name string, repo *config.Repo) error {
+	// vcs-config doesn't marshal its value, so it has to be sent as is.
+	body := map[string]interface{}{}
+	b, err := json.Marshal(repo)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &body); err != nil {
+		return err
+	}
+	if vc := repo.VcsConfig(); vc != nil {
+		body["vcs-config"] = json.RawMessage(vc)
+	}
+	body["name"] = name
+
+	return doAdmin(cfg, "POST", "repos", nil, body, nil)
+}
+
+// RemoveRepo stops serving a repo on the host and deletes its index.
+func RemoveRepo(cfg *Config, name string) error {
+	return doAdmin(cfg, "DELETE", "repos", url.Values{"repo": {name}}, nil, nil)
+}
+
+// Reindex rebuilds the index of a repo on the host.
+func Reindex(cfg *Config, name string) error {
+	return doAdmin(cfg, "POST", "reindex", url.Values{"repo": {name}}, nil, nil)
+}
@@ -1,11 +1,15 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/hound-search/hound/config"
@@ -18,6 +22,17 @@ type Response struct {
 		FilesOpened int
 		Duration    int
 	} `json:",omitempty"`
+
+	// The names of the repos in the order of the sort of the query, if
+	// it has one.
+	Order []string `json:",omitempty"`
+
+	// Set instead of the results when the search fails, e.g. on a bad
+	// pattern.
+	Error string `json:",omitempty"`
+
+	// The id that the server logged the failure under.
+	RequestId string `json:",omitempty"`
 }
 
 type Presenter interface {
@@ -31,6 +46,131 @@ type Presenter interface {
 type Config struct {
 	HttpHeaders map[string]string `json:"http-headers"`
 	Host        string            `json:"host"`
+
+	// One of the server's api-tokens, if it requires one.
+	Token string `json:"token"`
+
+	// The server's admin-token, for managing its repos.
+	AdminToken string `json:"admin-token"`
+}
+
+// Query is a search to run on the API.
+type Query struct {
+	Pattern string
+
+	// Comma separated repo names, or * for all of them, and tags that
+	// narrow them down.
+	Repos string
+	Tags  string
+
+	// Regexps of the paths of the files to search and of those to skip.
+	Files        string
+	ExcludeFiles string
+
+	Context    int
+	IgnoreCase bool
+	Stats      bool
+
+	// SmartCase ignores case unless the pattern has an upper case letter.
+	SmartCase bool
+
+	// WholeWord only matches the pattern as a whole word.
+	WholeWord bool
+
+	// Literal searches for the pattern as is, rather than as a regexp.
+	Literal bool
+
+	// Sort is the order of the results, one of the index.Sort constants.
+	Sort string
+}
+
+// Regexp is the pattern of the query as the regexp the server runs.
+func (q *Query) Regexp() string {
+	if q.Literal {
+		return regexp.QuoteMeta(q.Pattern)
+	}
+	return q.Pattern
+}
+
+// IgnoresCase is whether the server matches the pattern without regard
+// to case.
+func (q *Query) IgnoresCase() bool {
+	return q.IgnoreCase || q.SmartCase && !index.HasUpperCase(q.Pattern)
+}
+
+func (q *Query) values() url.Values {
+	v := url.Values{
+		"q":            {q.Regexp()},
+		"repos":        {q.Repos},
+		"tags":         {q.Tags},
+		"files":        {q.Files},
+		"excludeFiles": {q.ExcludeFiles},
+		"ctx":          {fmt.Sprintf("%d", q.Context)},
+		"i":            {fmt.Sprintf("%t", q.IgnoreCase)},
+		"stats":        {fmt.Sprintf("%t", q.Stats)},
+	}
+	if q.SmartCase && !q.IgnoreCase {
+		v.Set("case", "smart")
+	}
+	if q.WholeWord {
+		v.Set("word", "true")
+	}
+	if q.Sort != "" {
+		v.Set("sort", q.Sort)
+	}
+	return v
+}
+
+// Permalink is the URL of the query in the web UI.
+func Permalink(cfg *Config, q *Query) string {
+	repos := q.Repos
+	if repos == "*" {
+		repos = ""
+	}
+
+	i := "nope"
+	if q.IgnoreCase {
+		i = "fosho"
+	}
+
+	v := url.Values{
+		"q":            {q.Regexp()},
+		"i":            {i},
+		"files":        {q.Files},
+		"excludeFiles": {q.ExcludeFiles},
+		"repos":        {repos},
+	}
+	if q.SmartCase && !q.IgnoreCase {
+		v.Set("case", "smart")
+	}
+	if q.WholeWord {
+		v.Set("word", "true")
+	}
+
+	return fmt.Sprintf("http://%s/?%s", cfg.Host, v.Encode())
+}
+
+// The repos of a response in the order of its sort, or else in order of
+// name, so output is stable.
+func sortedRepos(res *Response) []string {
+	names := make([]string, 0, len(res.Results))
+	seen := map[string]bool{}
+	for _, name := range res.Order {
+		if _, ok := res.Results[name]; ok && !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+
+	// any the order leaves out, as a server without sorting does.
+	var rest []string
+	for name := range res.Results {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
 }
 
 // Extract a repo name from the given url.
@@ -70,7 +210,15 @@ func repoNameFor(repos map[string]*config.Repo, repo string) string {
 }
 
 func doHttpGet(cfg *Config, uri string) (*http.Response, error) {
-	req, err := http.NewRequest("GET", uri, nil)
+	return doHttp(cfg, "GET", uri, nil, cfg.Token)
+}
+
+func doHttp(cfg *Config, method, uri string, body io.Reader, token string) (*http.Response, error) {
+	return doHttpContext(context.Background(), cfg, method, uri, body, token)
+}
+
+func doHttpContext(ctx context.Context, cfg *Config, method, uri string, body io.Reader, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, uri, body)
 	if err != nil {
 		return nil, err
 	}
@@ -83,22 +231,35 @@ func doHttpGet(cfg *Config, uri string) (*http.Response, error) {
 		}
 	}
 
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
 	var c http.Client
 	return c.Do(req)
 }
 
+// The error of a response that failed, along with the id of the request
+// that the server logged it under, if it has one.
+func responseError(res *http.Response) error {
+	var e struct {
+		Error     string
+		RequestId string
+	}
+	if err := json.NewDecoder(res.Body).Decode(&e); err != nil || e.Error == "" {
+		return fmt.Errorf("Status %d", res.StatusCode)
+	}
+	if e.RequestId != "" {
+		return fmt.Errorf("%s (request %s)", e.Error, e.RequestId)
+	}
+	return errors.New(e.Error)
+}
+
 // Executes a search on the API running on host.
-func Search(r *Response, cfg *Config, pattern, repos, files string, context int, ignoreCase, stats bool) error {
+func Search(r *Response, cfg *Config, q *Query) error {
 	u := fmt.Sprintf("http://%s/api/v1/search?%s",
 		cfg.Host,
-		url.Values{
-			"q":     {pattern},
-			"repos": {repos},
-			"files": {files},
-			"ctx":   {fmt.Sprintf("%d", context)},
-			"i":     {fmt.Sprintf("%t", ignoreCase)},
-			"stats": {fmt.Sprintf("%t", stats)},
-		}.Encode())
+		q.values().Encode())
 
 	res, err := doHttpGet(cfg, u)
 	if err != nil {
@@ -106,11 +267,24 @@ func Search(r *Response, cfg *Config, pattern, repos, files string, context int,
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("Status %d", res.StatusCode)
+	if res.StatusCode == http.StatusUnauthorized {
+		return errors.New("Unauthorized, check the token")
+	} else if res.StatusCode != http.StatusOK {
+		return responseError(res)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(r); err != nil {
+		return err
+	}
+
+	if r.Error != "" {
+		if r.RequestId != "" {
+			return fmt.Errorf("%s (request %s)", r.Error, r.RequestId)
+		}
+		return errors.New(r.Error)
 	}
 
-	return json.NewDecoder(res.Body).Decode(r)
+	return nil
 }
 
 // Load the list of repositories from the API running on host.
@@ -121,15 +295,21 @@ func LoadRepos(repos map[string]*config.Repo, cfg *Config) error {
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode == http.StatusUnauthorized {
+		return errors.New("Unauthorized, check the token")
+	} else if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Status %d", res.StatusCode)
+	}
+
 	return json.NewDecoder(res.Body).Decode(&repos)
 }
 
 // Execute a search and load the list of repositories in parallel on the host.
-func SearchAndLoadRepos(cfg *Config, pattern, repos, files string, context int, ignoreCase, stats bool) (*Response, map[string]*config.Repo, error) {
+func SearchAndLoadRepos(cfg *Config, q *Query) (*Response, map[string]*config.Repo, error) {
 	chs := make(chan error)
 	var res Response
 	go func() {
-		chs <- Search(&res, cfg, pattern, repos, files, context, ignoreCase, stats)
+		chs <- Search(&res, cfg, q)
 	}()
 
 	chr := make(chan error)
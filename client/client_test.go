@@ -0,0 +1,140 @@
+package client
+
+import (
+	"bytes"
+	"net/url"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/hound-search/hound/ansi"
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+)
+
+func TestQueryValues(t *testing.T) {
+	q := &Query{
+		Pattern:    "a.b(",
+		Repos:      "*",
+		Tags:       "go",
+		Context:    1,
+		IgnoreCase: true,
+		Literal:    true,
+	}
+
+	v := q.values()
+	if v.Get("q") != `a\.b\(` || v.Get("tags") != "go" || v.Get("i") != "true" || v.Get("ctx") != "1" {
+		t.Fatalf("unexpected values: %v", v)
+	}
+
+	u, err := url.Parse(Permalink(&Config{Host: "hound:6080"}, q))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := u.Query()
+	if u.Host != "hound:6080" || p.Get("q") != `a\.b\(` || p.Get("i") != "fosho" || p.Get("repos") != "" {
+		t.Fatalf("unexpected permalink: %s", u)
+	}
+}
+
+func TestSmartCase(t *testing.T) {
+	q := &Query{Pattern: "foo", SmartCase: true}
+	if !q.IgnoresCase() || q.values().Get("case") != "smart" {
+		t.Fatalf("expected a smart case search of %q to ignore case", q.Pattern)
+	}
+
+	q.Pattern = "Foo"
+	if q.IgnoresCase() {
+		t.Fatalf("expected a smart case search of %q to match case", q.Pattern)
+	}
+
+	// ignoring case always wins.
+	q.IgnoreCase = true
+	if !q.IgnoresCase() || q.values().Get("case") != "" {
+		t.Fatal("expected -ignore-case to win over smart case")
+	}
+}
+
+func TestSortedRepos(t *testing.T) {
+	res := &Response{
+		Results: map[string]*index.SearchResponse{
+			"b": {}, "a": {}, "d": {}, "c": {},
+		},
+	}
+	if got := sortedRepos(res); !reflect.DeepEqual(got, []string{"a", "b", "c", "d"}) {
+		t.Fatalf("expected the repos in order of name, got %v", got)
+	}
+
+	// repos the order doesn't have, or has twice, still come out once.
+	res.Order = []string{"c", "a", "gone", "c"}
+	if got := sortedRepos(res); !reflect.DeepEqual(got, []string{"c", "a", "b", "d"}) {
+		t.Fatalf("expected the repos in the order of the response, got %v", got)
+	}
+}
+
+func TestGrepPresenter(t *testing.T) {
+	res := &Response{
+		Results: map[string]*index.SearchResponse{
+			"b": {Matches: []*index.FileMatch{{
+				Filename: "x.go",
+				Matches: []*index.Match{{
+					Line:       "foo bar",
+					LineNumber: 3,
+					Before:     []string{"two"},
+				}},
+			}}},
+			"a": {Matches: []*index.FileMatch{{
+				Filename: "y.go",
+				Matches: []*index.Match{{
+					Line:       "foo",
+					LineNumber: 1,
+				}},
+			}}},
+		},
+	}
+	repos := map[string]*config.Repo{
+		"b": {URL: "https://github.com/org/b.git"},
+	}
+
+	var buf bytes.Buffer
+	p := NewGrepPresenter(&buf, ansi.New(false))
+	if err := p.Present(regexp.MustCompile("foo"), 1, repos, res); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := "a/y.go:1:foo\n--\norg/b/x.go-2-two\norg/b/x.go:3:foo bar\n"
+	if buf.String() != exp {
+		t.Fatalf("expected %q, got %q", exp, buf.String())
+	}
+}
+
+func TestVimgrepPresenter(t *testing.T) {
+	res := &Response{
+		Results: map[string]*index.SearchResponse{
+			"a": {Matches: []*index.FileMatch{{
+				Filename: "y.go",
+				Matches: []*index.Match{{
+					Line:       "foo bar foo",
+					LineNumber: 3,
+					Before:     []string{"two"},
+					Spans:      []index.Span{{Start: 0, End: 3}, {Start: 8, End: 11}},
+				}, {
+					Line:       "x := foo()",
+					LineNumber: 7,
+				}},
+			}}},
+		},
+	}
+
+	var buf bytes.Buffer
+	p := NewVimgrepPresenter(&buf, ansi.New(false))
+	if err := p.Present(regexp.MustCompile("foo"), 1, nil, res); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := "a/y.go:3:1:foo bar foo\na/y.go:3:9:foo bar foo\na/y.go:7:1:x := foo()\n"
+	if buf.String() != exp {
+		t.Fatalf("expected %q, got %q", exp, buf.String())
+	}
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// The kinds of search that an editor can make.
+const (
+	// EditorText finds the lines that match a pattern.
+	EditorText = "text"
+
+	// EditorSymbol finds where an identifier is declared, going by the
+	// keywords that declarations of most languages start with.
+	EditorSymbol = "symbol"
+
+	// EditorPath finds the files whose paths match a pattern.
+	EditorPath = "path"
+)
+
+// EditorQuery is a search made by an editor, like a workspace wide search
+// or a quick open of a file, through /api/v1/editor/search.
+type EditorQuery struct {
+	Kind  string
+	Query string
+
+	// Literal searches for the query as is, rather than as a regexp.
+	// Symbols are always literal.
+	Literal    bool
+	IgnoreCase bool
+
+	// The names of the repos to search, or none for all of them, and a
+	// regexp of the paths of the files to search in them.
+	Repos []string `json:",omitempty"`
+	Files string   `json:",omitempty"`
+
+	// The lines of context of each match of a text search, at most 3.
+	Context int `json:",omitempty"`
+
+	// The most results to return, 50 if it isn't set and at most 500.
+	Limit int `json:",omitempty"`
+
+	// Token names the search so that it can be cancelled with
+	// CancelEditorSearch. A new search with the same token cancels the
+	// one before it, the way an editor drops a search as one types on.
+	Token string `json:",omitempty"`
+}
+
+// EditorResult is a match of an editor search, or a file for a search of
+// paths.
+type EditorResult struct {
+	Repo string
+	Path string
+
+	// The line, and the byte column in it, that the match starts at,
+	// both from 1. They are left out for paths.
+	Line   int `json:",omitempty"`
+	Column int `json:",omitempty"`
+
+	Text   string   `json:",omitempty"`
+	Before []string `json:",omitempty"`
+	After  []string `json:",omitempty"`
+}
+
+// EditorResponse is what an editor search found, in order of repo, path
+// and line.
+type EditorResponse struct {
+	Results []*EditorResult
+
+	// Whether there were more results than the limit.
+	Truncated bool `json:",omitempty"`
+
+	DurationMs int
+}
+
+// EditorSearch runs an editor search on the API running on host. The
+// search is given up on, by the server as well, if ctx is done first.
+func EditorSearch(ctx context.Context, cfg *Config, q *EditorQuery) (*EditorResponse, error) {
+	body, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+
+	u := fmt.Sprintf("http://%s/api/v1/editor/search", cfg.Host)
+	res, err := doHttpContext(ctx, cfg, "POST", u, bytes.NewReader(body), cfg.Token)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnauthorized {
+		return nil, errors.New("Unauthorized, check the token")
+	} else if res.StatusCode != http.StatusOK {
+		return nil, responseError(res)
+	}
+
+	var r EditorResponse
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// CancelEditorSearch cancels the editor search with a token, if it is
+// still running.
+func CancelEditorSearch(cfg *Config, token string) error {
+	u := fmt.Sprintf("http://%s/api/v1/editor/search?%s",
+		cfg.Host,
+		url.Values{"token": {token}}.Encode())
+	res, err := doHttp(cfg, "DELETE", u, nil, cfg.Token)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnauthorized {
+		return errors.New("Unauthorized, check the token")
+	} else if res.StatusCode != http.StatusOK {
+		return responseError(res)
+	}
+	return nil
+}
@@ -2,7 +2,7 @@ package client
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"regexp"
 
 	"github.com/hound-search/hound/ansi"
@@ -10,25 +10,105 @@ import (
 )
 
 type grepPresenter struct {
-	f *os.File
+	f io.Writer
+	c *ansi.Colorer
 }
 
+// Presents the results the way grep -n does, with each line prefixed by
+// the repo and the path of its file, so they can be piped into other
+// tools.
 func (p *grepPresenter) Present(
 	re *regexp.Regexp,
 	ctx int,
 	repos map[string]*config.Repo,
 	res *Response) error {
 
-	c := ansi.NewFor(p.f)
+	c := p.c
+	first := true
 
-	if _, err := fmt.Fprintf(p.f, "%s\n",
-		c.Fg("// TODO(knorton): Implement", ansi.Yellow, ansi.Bold)); err != nil {
-		return err
+	for _, repo := range sortedRepos(res) {
+		name := repoNameFor(repos, repo)
+		for _, file := range res.Results[repo].Matches {
+			path := c.Fg(name+"/"+file.Filename, ansi.Magenta, ansi.Normal)
+
+			for _, block := range coalesceMatches(file.Matches) {
+				if ctx > 0 && !first {
+					if _, err := fmt.Fprintln(p.f, c.Fg("--", ansi.Cyan, ansi.Normal)); err != nil {
+						return err
+					}
+				}
+				first = false
+
+				for i, line := range block.Lines {
+					sep := "-"
+					if block.Matches[i] {
+						sep = ":"
+						line = hiliteMatches(c, re, line)
+					}
+					sep = c.Fg(sep, ansi.Cyan, ansi.Normal)
+
+					if _, err := fmt.Fprintf(p.f, "%s%s%s%s%s\n",
+						path,
+						sep,
+						c.Fg(fmt.Sprintf("%d", block.Start+i), ansi.Green, ansi.Normal),
+						sep,
+						line); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func NewGrepPresenter(w io.Writer, c *ansi.Colorer) Presenter {
+	return &grepPresenter{w, c}
+}
+
+type vimgrepPresenter struct {
+	f io.Writer
+	c *ansi.Colorer
+}
+
+// Presents the results the way ripgrep's --vimgrep does, as a line of
+// path:line:column:text for each place that the pattern matched, which
+// editors can read as a quickfix list. Context is left out.
+func (p *vimgrepPresenter) Present(
+	re *regexp.Regexp,
+	ctx int,
+	repos map[string]*config.Repo,
+	res *Response) error {
+
+	c := p.c
+	for _, repo := range sortedRepos(res) {
+		name := repoNameFor(repos, repo)
+		for _, file := range res.Results[repo].Matches {
+			path := c.Fg(name+"/"+file.Filename, ansi.Magenta, ansi.Normal)
+			sep := c.Fg(":", ansi.Cyan, ansi.Normal)
+
+			for _, m := range file.Matches {
+				line := hiliteMatches(c, re, m.Line)
+				for _, col := range m.Columns() {
+					if _, err := fmt.Fprintf(p.f, "%s%s%s%s%d%s%s\n",
+						path,
+						sep,
+						c.Fg(fmt.Sprintf("%d", m.LineNumber), ansi.Green, ansi.Normal),
+						sep,
+						col,
+						sep,
+						line); err != nil {
+						return err
+					}
+				}
+			}
+		}
 	}
 
 	return nil
 }
 
-func NewGrepPresenter(w *os.File) Presenter {
-	return &grepPresenter{w}
+func NewVimgrepPresenter(w io.Writer, c *ansi.Colorer) Presenter {
+	return &vimgrepPresenter{w, c}
 }
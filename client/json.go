@@ -0,0 +1,72 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"regexp"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+)
+
+type jsonPresenter struct {
+	f io.Writer
+}
+
+// Presents the response as the API returned it.
+func (p *jsonPresenter) Present(
+	re *regexp.Regexp,
+	ctx int,
+	repos map[string]*config.Repo,
+	res *Response) error {
+
+	e := json.NewEncoder(p.f)
+	e.SetIndent("", "  ")
+	return e.Encode(res)
+}
+
+func NewJSONPresenter(w io.Writer) Presenter {
+	return &jsonPresenter{w}
+}
+
+// MatchRecord is one line of NDJSON output: a match along with where it
+// was found.
+type MatchRecord struct {
+	Repo     string
+	Filename string
+	*index.Match
+}
+
+type ndjsonPresenter struct {
+	f io.Writer
+}
+
+// Presents each match as a JSON object on a line of its own, which is
+// easier than the whole response for line oriented tools like jq.
+func (p *ndjsonPresenter) Present(
+	re *regexp.Regexp,
+	ctx int,
+	repos map[string]*config.Repo,
+	res *Response) error {
+
+	e := json.NewEncoder(p.f)
+	for _, repo := range sortedRepos(res) {
+		for _, file := range res.Results[repo].Matches {
+			for _, m := range file.Matches {
+				if err := e.Encode(&MatchRecord{
+					Repo:     repo,
+					Filename: file.Filename,
+					Match:    m,
+				}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func NewNDJSONPresenter(w io.Writer) Presenter {
+	return &ndjsonPresenter{w}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hound-search/hound/client"
+	"github.com/hound-search/hound/config"
+)
+
+const adminUsage = `usage: %[1]s [flags] repos list
+       %[1]s [flags] repos status [repo...]
+       %[1]s [flags] repos add [-vcs vcs] [-tags tags] [-config file] name url
+       %[1]s [flags] repos remove name
+       %[1]s [flags] reindex name
+       %[1]s [flags] fsck [-repair] [-rebuild] config.json
+       %[1]s [flags] bench [-c n] [-n n] [-duration d] [-local config.json] (queries.log | mix)
+
+The repos and reindex commands drive the admin API of the server, which
+needs its admin-token. fsck checks the indexes in the dbpath of a server
+config instead. It runs locally and is best run while houndd is stopped.
+bench replays a query log, or a generated mix of queries, against the host
+or the local indexes of a server config and reports latency and throughput.
+`
+
+// Whether the arguments name an admin subcommand rather than a pattern to
+// search for. A search only ever takes one argument.
+func isAdminCommand(args []string) bool {
+	return len(args) > 1 && (args[0] == "repos" || args[0] == "reindex")
+}
+
+// Run one of the admin subcommands.
+func runAdmin(cfg *client.Config, args []string) error {
+	if args[0] == "reindex" {
+		if len(args) != 2 {
+			return errAdminUsage
+		}
+		if err := client.Reindex(cfg, args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("reindexing %s\n", args[1])
+		return nil
+	}
+
+	switch args[1] {
+	case "list":
+		return listRepos(cfg)
+	case "status":
+		return showStatus(cfg, args[2:])
+	case "add":
+		return addRepo(cfg, args[2:])
+	case "remove":
+		if len(args) != 3 {
+			return errAdminUsage
+		}
+		if err := client.RemoveRepo(cfg, args[2]); err != nil {
+			return err
+		}
+		fmt.Printf("removed %s\n", args[2])
+		return nil
+	}
+
+	return errAdminUsage
+}
+
+var errAdminUsage = errors.New("invalid admin command, see -help")
+
+func sortedNames(res map[string]*client.RepoStatus) []string {
+	names := make([]string, 0, len(res))
+	for name := range res {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func listRepos(cfg *client.Config) error {
+	res, err := client.RepoStatuses(cfg, "")
+	if err != nil {
+		return err
+	}
+
+	for _, name := range sortedNames(res) {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+func showStatus(cfg *client.Config, repos []string) error {
+	res := map[string]*client.RepoStatus{}
+	if len(repos) == 0 {
+		all, err := client.RepoStatuses(cfg, "")
+		if err != nil {
+			return err
+		}
+		res = all
+	}
+
+	for _, repo := range repos {
+		one, err := client.RepoStatuses(cfg, repo)
+		if err != nil {
+			return err
+		}
+		for name, st := range one {
+			res[name] = st
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATE\tREV\tINDEXED\tERROR")
+	for _, name := range sortedNames(res) {
+		st := res[name]
+
+		rev := st.Rev
+		if len(rev) > 12 {
+			rev = rev[:12]
+		}
+
+		indexed := ""
+		if st.IndexedAt != nil && !st.IndexedAt.IsZero() {
+			indexed = st.IndexedAt.Local().Format("2006-01-02 15:04:05")
+			if st.IndexMs > 0 {
+				indexed += fmt.Sprintf(" (%s)", time.Duration(st.IndexMs)*time.Millisecond)
+			}
+		}
+
+		state := st.State
+		if st.CircuitOpen {
+			state += " (circuit open)"
+		}
+
+		problem := st.Error
+		if st.Failures > 0 && st.NextAttempt != nil {
+			problem = fmt.Sprintf("%d failures, retrying at %s: %s",
+				st.Failures,
+				st.NextAttempt.Local().Format("2006-01-02 15:04:05"),
+				st.Error)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name, state, rev, indexed, problem)
+	}
+	return w.Flush()
+}
+
+func addRepo(cfg *client.Config, args []string) error {
+	fs := flag.NewFlagSet("repos add", flag.ContinueOnError)
+	flagVcs := fs.String("vcs", "", "the vcs of the repo (default git)")
+	flagTags := fs.String("tags", "", "comma separated tags of the repo")
+	flagConfig := fs.String("config", "", "a file with the rest of the repo's config, as in config.json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
+		return errAdminUsage
+	}
+
+	var repo config.Repo
+	if *flagConfig != "" {
+		b, err := ioutil.ReadFile(*flagConfig)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(b, &repo); err != nil {
+			return err
+		}
+	}
+
+	repo.URL = fs.Arg(1)
+	if *flagVcs != "" {
+		repo.Vcs = *flagVcs
+	}
+	if *flagTags != "" {
+		repo.Tags = strings.Split(*flagTags, ",")
+	}
+
+	if err := client.AddRepo(cfg, fs.Arg(0), &repo); err != nil {
+		return err
+	}
+
+	fmt.Printf("indexing %s, see %s repos status %s\n", fs.Arg(0), os.Args[0], fs.Arg(0))
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hound-search/hound/bench"
+	"github.com/hound-search/hound/client"
+	"github.com/hound-search/hound/config"
+)
+
+// Whether the arguments are the bench subcommand, which always names the
+// queries to run so it can't be mistaken for a search.
+func isBenchCommand(args []string) bool {
+	return len(args) > 1 && args[0] == "bench"
+}
+
+// The queries of a query log, or the generated mix.
+func loadBenchQueries(src string) ([]*client.Query, error) {
+	if src == "mix" {
+		return bench.Mix(), nil
+	}
+
+	r, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return bench.LoadQueries(r)
+}
+
+// Run a benchmark and print its report.
+func runBench(cfg *client.Config, args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flagConc := fs.Int("c", 4, "the number of queries to run at once")
+	flagRequests := fs.Int("n", 0, "the number of queries to run (default one pass over the queries)")
+	flagDuration := fs.Duration("duration", 0, "run for this long instead, e.g. 30s")
+	flagLocal := fs.String("local", "", "search the indexes in the dbpath of this server config instead of the host")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errAdminUsage
+	}
+
+	queries, err := loadBenchQueries(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	target := bench.Remote(cfg)
+	where := cfg.Host
+	if *flagLocal != "" {
+		var conf config.Config
+		if err := conf.LoadFromFile(*flagLocal); err != nil {
+			return err
+		}
+
+		local, err := bench.OpenLocal(&conf)
+		if err != nil {
+			return err
+		}
+		defer local.Close()
+
+		if local.Len() == 0 {
+			return errors.New("no indexes found in " + conf.DbPath)
+		}
+
+		target = local
+		where = fmt.Sprintf("%d local indexes", local.Len())
+	}
+
+	fmt.Printf("running %d queries against %s with concurrency %d\n", len(queries), where, *flagConc)
+
+	rep := bench.Run(target, queries, &bench.Options{
+		Concurrency: *flagConc,
+		Requests:    *flagRequests,
+		Duration:    *flagDuration,
+	})
+	rep.Print(os.Stdout)
+
+	if rep.Errors == rep.Requests {
+		return errors.New("every query failed")
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hound-search/hound/client"
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/meta"
+)
+
+// The states fsck reports an index in.
+const (
+	fsckOK         = "ok"
+	fsckCorrupt    = "corrupt"
+	fsckIncomplete = "incomplete"
+	fsckOrphaned   = "orphaned"
+	fsckMissing    = "missing"
+)
+
+// Whether the arguments are the fsck subcommand, which always names the
+// config so it can't be mistaken for a search.
+func isFsckCommand(args []string) bool {
+	return len(args) > 1 && args[0] == "fsck"
+}
+
+// The result of checking one index of the dbpath.
+type fsckResult struct {
+	dir   string
+	state string
+	repos []string
+	err   error
+}
+
+// The names of the repos in the config that are indexed from url.
+func reposWithURL(cfg *config.Config, url string) []string {
+	var names []string
+	for name, repo := range cfg.Repos {
+		if repo.URL == url {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The names of the repos whose indexes, served or kept, are in each
+// directory of the dbpath, by the name of the directory, as houndd last
+// recorded them.
+func recordedOwners(recs map[string]*meta.Repo) map[string][]string {
+	owners := map[string][]string{}
+	for name, rec := range recs {
+		for _, dir := range rec.Dirs() {
+			owners[filepath.Base(dir)] = append(owners[filepath.Base(dir)], name)
+		}
+	}
+	for _, names := range owners {
+		sort.Strings(names)
+	}
+	return owners
+}
+
+// Check every index in the dbpath of cfg, along with the repos of cfg that
+// have none. The repos of an index are the ones that houndd recorded as
+// using it, so even a corrupt index can be rebuilt for them, or those
+// with its url if it has none recorded.
+func checkIndexes(cfg *config.Config) ([]*fsckResult, error) {
+	dirs, err := filepath.Glob(filepath.Join(cfg.DbPath, "idx-*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(dirs)
+
+	db, err := meta.OpenReadOnly(cfg.DbPath)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := db.Repos()
+	if err != nil {
+		return nil, err
+	}
+	owners := recordedOwners(recs)
+
+	var res []*fsckResult
+	indexed := map[string]bool{}
+	for _, dir := range dirs {
+		r := &fsckResult{dir: dir, state: fsckOK, repos: owners[filepath.Base(dir)]}
+		res = append(res, r)
+		for _, name := range r.repos {
+			indexed[name] = true
+		}
+
+		ref, err := index.Verify(dir)
+		if err == index.ErrIncomplete {
+			// the index is either still being built or was abandoned,
+			// which houndd cleans up when it starts.
+			r.state, r.err = fsckIncomplete, err
+			continue
+		} else if ref == nil {
+			r.state, r.err = fsckCorrupt, err
+			continue
+		}
+
+		if r.repos == nil {
+			r.repos = reposWithURL(cfg, ref.Url)
+		}
+		for _, name := range r.repos {
+			indexed[name] = true
+		}
+
+		switch {
+		case err == index.ErrNoChecksums:
+			r.err = err
+		case err != nil:
+			r.state, r.err = fsckCorrupt, err
+		case len(r.repos) == 0:
+			r.state = fsckOrphaned
+			r.err = fmt.Errorf("no repo in the config has the url %s", ref.Url)
+		}
+	}
+
+	names := make([]string, 0, len(cfg.Repos))
+	for name := range cfg.Repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !indexed[name] {
+			err := errors.New("it will be indexed when houndd starts")
+			if rec := recs[name]; rec != nil && rec.Failures > 0 {
+				err = fmt.Errorf("it failed to index %d times, last at %s: %s",
+					rec.Failures, rec.LastFailure.Format(time.RFC3339), rec.LastError)
+			}
+			res = append(res, &fsckResult{
+				state: fsckMissing,
+				repos: []string{name},
+				err:   err,
+			})
+		}
+	}
+
+	return res, nil
+}
+
+func printFsckResults(res []*fsckResult) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "INDEX\tSTATE\tREPOS\tPROBLEM")
+	for _, r := range res {
+		dir := filepath.Base(r.dir)
+		if r.dir == "" {
+			dir = "-"
+		}
+
+		problem := ""
+		if r.err != nil {
+			problem = r.err.Error()
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", dir, r.state, strings.Join(r.repos, ","), problem)
+	}
+	return w.Flush()
+}
+
+// Run fsck, returning whether every index is trustworthy. With repair,
+// corrupt indexes are deleted so that they are rebuilt, and with rebuild
+// the server is also asked to rebuild them right away.
+func runFsck(cfg *client.Config, args []string) (bool, error) {
+	fs := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	flagRepair := fs.Bool("repair", false, "delete corrupt indexes so they are rebuilt")
+	flagRebuild := fs.Bool("rebuild", false, "after repairing, ask the running server to reindex the affected repos")
+	if err := fs.Parse(args[1:]); err != nil {
+		return false, err
+	}
+
+	if fs.NArg() != 1 {
+		return false, errAdminUsage
+	}
+
+	var conf config.Config
+	if err := conf.LoadFromFile(fs.Arg(0)); err != nil {
+		return false, err
+	}
+
+	res, err := checkIndexes(&conf)
+	if err != nil {
+		return false, err
+	}
+
+	if err := printFsckResults(res); err != nil {
+		return false, err
+	}
+
+	var corrupt []*fsckResult
+	for _, r := range res {
+		if r.state == fsckCorrupt {
+			corrupt = append(corrupt, r)
+		}
+	}
+
+	if len(corrupt) == 0 {
+		return true, nil
+	}
+
+	if !*flagRepair {
+		fmt.Printf("%d corrupt indexes, run with -repair to delete them\n", len(corrupt))
+		return false, nil
+	}
+
+	rebuild := map[string]bool{}
+	for _, r := range corrupt {
+		if err := os.RemoveAll(r.dir); err != nil {
+			return false, err
+		}
+		fmt.Printf("deleted %s\n", r.dir)
+
+		for _, name := range r.repos {
+			rebuild[name] = true
+		}
+	}
+
+	if !*flagRebuild {
+		fmt.Println("houndd will rebuild them when it next starts")
+		return true, nil
+	}
+
+	ok := true
+	for _, name := range sortedKeys(rebuild) {
+		if err := client.Reindex(cfg, name); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to reindex %s: %s\n", name, err)
+			ok = false
+			continue
+		}
+		fmt.Printf("reindexing %s\n", name)
+	}
+
+	return ok, nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -3,11 +3,13 @@ package main
 import (
 	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/user"
 	"regexp"
 
+	"github.com/hound-search/hound/ansi"
 	"github.com/hound-search/hound/client"
 	"github.com/hound-search/hound/index"
 )
@@ -16,14 +18,34 @@ import (
 // -ldflags -X main.defaultHouse addr. This should remain uninitialized.
 var defaultHost string
 
-// a convenience method for creating a new presenter that is either
-// ack-like or grep-like.
-func newPresenter(likeGrep bool) client.Presenter {
-	if likeGrep {
-		return client.NewGrepPresenter(os.Stdout)
+// a convenience method for creating the presenter for one of the output
+// formats: ack, grep, vimgrep, json or ndjson.
+func newPresenter(output, color string) (client.Presenter, error) {
+	c := ansi.NewFor(os.Stdout)
+	switch color {
+	case "always":
+		c = ansi.New(true)
+	case "never":
+		c = ansi.New(false)
+	case "auto":
+	default:
+		return nil, fmt.Errorf("unknown color mode: %s", color)
 	}
 
-	return client.NewAckPresenter(os.Stdout)
+	switch output {
+	case "ack":
+		return client.NewAckPresenter(os.Stdout, c), nil
+	case "grep":
+		return client.NewGrepPresenter(os.Stdout, c), nil
+	case "vimgrep":
+		return client.NewVimgrepPresenter(os.Stdout, c), nil
+	case "json":
+		return client.NewJSONPresenter(os.Stdout), nil
+	case "ndjson":
+		return client.NewNDJSONPresenter(os.Stdout), nil
+	}
+
+	return nil, fmt.Errorf("unknown output format: %s", output)
 }
 
 // the paths we will attempt to load config from
@@ -81,50 +103,140 @@ func defaultFlagForHost() string {
 }
 
 func main() {
-	flagHost := flag.String("host", defaultFlagForHost(), "")
-	flagRepos := flag.String("repos", "*", "")
-	flagFiles := flag.String("files", "", "")
-	flagContext := flag.Int("context", 2, "")
-	flagCase := flag.Bool("ignore-case", false, "")
-	flagStats := flag.Bool("show-stats", false, "")
-	flagGrep := flag.Bool("like-grep", false, "")
+	log.SetFlags(0)
+	log.SetPrefix("hound: ")
+
+	flagHost := flag.String("host", defaultFlagForHost(), "the host:port of the hound server")
+	flagToken := flag.String("token", os.Getenv("HOUND_TOKEN"), "an API token of the server (default $HOUND_TOKEN)")
+	flagAdminToken := flag.String("admin-token", os.Getenv("HOUND_ADMIN_TOKEN"), "the admin token of the server (default $HOUND_ADMIN_TOKEN)")
+	flagRepos := flag.String("repos", "*", "comma separated repos to search, * for all of them")
+	flagTags := flag.String("tags", "", "only search repos with one of these comma separated tags")
+	flagFiles := flag.String("files", "", "only search files whose path matches this regexp")
+	flagExclude := flag.String("exclude-files", "", "skip files whose path matches this regexp")
+	flagContext := flag.Int("context", 2, "the number of lines of context around matches")
+	flagCase := flag.Bool("ignore-case", false, "match without regard to case")
+	flagSmartCase := flag.Bool("smart-case", false, "match without regard to case unless the pattern has an upper case letter")
+	flagLiteral := flag.Bool("literal", false, "search for the pattern as is, not as a regexp")
+	flagWord := flag.Bool("word", false, "only match the pattern as a whole word")
+	flagSort := flag.String("sort", "", "the order of the results: path, repo, score or mtime")
+	flagStats := flag.Bool("show-stats", false, "request stats on the search, which json output includes")
+	flagGrep := flag.Bool("like-grep", false, "the same as -output grep")
+	flagOutput := flag.String("output", "ack", "the output format: ack, grep, vimgrep, json or ndjson")
+	flagColor := flag.String("color", "auto", "when to color output: auto, always or never")
+	flagOpen := flag.Bool("open", false, "open the search in the web UI instead")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] pattern\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, adminUsage, os.Args[0])
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
 
 	flag.Parse()
 
+	cfg := client.Config{
+		Host:        *flagHost,
+		HttpHeaders: nil,
+	}
+
+	if err := loadConfig(&cfg); err != nil {
+		log.Fatal(err)
+	}
+
+	if *flagToken != "" {
+		cfg.Token = *flagToken
+	}
+	if *flagAdminToken != "" {
+		cfg.AdminToken = *flagAdminToken
+	}
+
+	if isFsckCommand(flag.Args()) {
+		ok, err := runFsck(&cfg, flag.Args())
+		if err == errAdminUsage {
+			flag.Usage()
+			os.Exit(2)
+		} else if err != nil {
+			log.Fatal(err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if isBenchCommand(flag.Args()) {
+		if err := runBench(&cfg, flag.Args()); err == errAdminUsage {
+			flag.Usage()
+			os.Exit(2)
+		} else if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if isAdminCommand(flag.Args()) {
+		if err := runAdmin(&cfg, flag.Args()); err == errAdminUsage {
+			flag.Usage()
+			os.Exit(2)
+		} else if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	if flag.NArg() != 1 {
 		flag.Usage()
-		return
+		os.Exit(2)
 	}
 
-	pat := index.GetRegexpPattern(flag.Arg(0), *flagCase)
+	if *flagGrep {
+		*flagOutput = "grep"
+	}
+
+	q := &client.Query{
+		Pattern:      flag.Arg(0),
+		Repos:        *flagRepos,
+		Tags:         *flagTags,
+		Files:        *flagFiles,
+		ExcludeFiles: *flagExclude,
+		Context:      *flagContext,
+		IgnoreCase:   *flagCase,
+		SmartCase:    *flagSmartCase,
+		Literal:      *flagLiteral,
+		WholeWord:    *flagWord,
+		Sort:         *flagSort,
+		Stats:        *flagStats,
+	}
+
+	pat := q.Regexp()
+	if q.WholeWord {
+		pat = index.WholeWordPattern(pat)
+	}
+	pat = index.GetRegexpPattern(pat, q.IgnoresCase())
 
 	reg, err := regexp.Compile(pat)
 	if err != nil {
-		// TODO(knorton): Better error reporting
-		log.Panic(err)
+		log.Fatalf("invalid pattern: %s", err)
 	}
 
-	cfg := client.Config{
-		Host:        *flagHost,
-		HttpHeaders: nil,
+	presenter, err := newPresenter(*flagOutput, *flagColor)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	if err := loadConfig(&cfg); err != nil {
-		log.Panic(err)
+	if *flagOpen {
+		if err := openURL(client.Permalink(&cfg, q)); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	res, repos, err := client.SearchAndLoadRepos(&cfg,
-		flag.Arg(0),
-		*flagRepos,
-		*flagFiles,
-		*flagContext,
-		*flagCase,
-		*flagStats)
+	res, repos, err := client.SearchAndLoadRepos(&cfg, q)
 	if err != nil {
-		log.Panic(err)
+		log.Fatal(err)
 	}
 
-	if err := newPresenter(*flagGrep).Present(reg, *flagContext, repos, res); err != nil {
-		log.Panic(err)
+	if err := presenter.Present(reg, *flagContext, repos, res); err != nil {
+		log.Fatal(err)
 	}
 }
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/dblock"
+	"github.com/hound-search/hound/vcs"
+)
+
+// The results a doctor check can have.
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+)
+
+// Less free space than this in the dbpath is worth a warning, since every
+// repo needs room for its clone and two copies of its index.
+const minDiskFree = 1 << 30
+
+// The number of repos whose remotes are checked at once.
+const maxConcurrentChecks = 8
+
+type checkResult struct {
+	result string
+	name   string
+	detail string
+}
+
+type doctorReport struct {
+	checks []*checkResult
+}
+
+func (r *doctorReport) add(result, name, format string, args ...interface{}) {
+	r.checks = append(r.checks, &checkResult{result, name, fmt.Sprintf(format, args...)})
+}
+
+func (r *doctorReport) failed() int {
+	n := 0
+	for _, c := range r.checks {
+		if c.result == checkFail {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *doctorReport) print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, c := range r.checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.result, c.name, c.detail)
+	}
+	return tw.Flush()
+}
+
+// Check that the dbpath can be written to and has room for indexes.
+func checkDbPath(r *doctorReport, dbpath string) {
+	if err := os.MkdirAll(dbpath, os.ModePerm); err != nil {
+		r.add(checkFail, "dbpath", "%s cannot be created: %s", dbpath, err)
+		return
+	}
+
+	f, err := ioutil.TempFile(dbpath, "doctor-")
+	if err != nil {
+		r.add(checkFail, "dbpath", "%s is not writable: %s", dbpath, err)
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+	r.add(checkPass, "dbpath", "%s is writable", dbpath)
+
+	// another houndd using the dbpath is fine, as long as it is the one
+	// that this config is for.
+	if lck, err := dblock.Acquire(dbpath); err != nil {
+		r.add(checkWarn, "dbpath lock", "%s", err)
+	} else {
+		lck.Release()
+		r.add(checkPass, "dbpath lock", "no houndd is using %s", dbpath)
+	}
+
+	free, err := diskFree(dbpath)
+	if err != nil {
+		r.add(checkWarn, "disk space", "unable to tell how much space is free: %s", err)
+	} else if free < minDiskFree {
+		r.add(checkWarn, "disk space", "only %d MB free in %s", free>>20, dbpath)
+	} else {
+		r.add(checkPass, "disk space", "%d MB free", free>>20)
+	}
+}
+
+// Check the commands that the vcs drivers of the repos run.
+func checkTools(r *doctorReport, cfg *config.Config) {
+	seen := map[string]bool{}
+	for _, name := range sortedRepoNames(cfg) {
+		repo := cfg.Repos[name]
+		if seen[repo.Vcs] {
+			continue
+		}
+		seen[repo.Vcs] = true
+
+		wd, err := vcs.New(repo.Vcs, repo.VcsConfig())
+		if err != nil {
+			r.add(checkFail, repo.Vcs, "%s", err)
+			continue
+		}
+
+		for _, t := range wd.Tools() {
+			if t.Err != nil {
+				r.add(checkFail, t.Name, "%s", t.Err)
+			} else {
+				r.add(checkPass, t.Name, "%s", t.Version)
+			}
+		}
+	}
+}
+
+// Check that every repo can be reached with its credentials.
+func checkRemotes(r *doctorReport, cfg *config.Config) {
+	names := sortedRepoNames(cfg)
+	res := make([]*checkResult, len(names))
+
+	var wg sync.WaitGroup
+	sem := make(chan bool, maxConcurrentChecks)
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			sem <- true
+			defer func() { <-sem }()
+
+			res[i] = checkRemote("repo "+name, cfg.Repos[name])
+		}(i, name)
+	}
+	wg.Wait()
+
+	r.checks = append(r.checks, res...)
+}
+
+func checkRemote(name string, repo *config.Repo) *checkResult {
+	wd, err := vcs.New(repo.Vcs, repo.VcsConfig())
+	if err != nil {
+		return &checkResult{checkFail, name, err.Error()}
+	}
+	wd.SetEnv(repo.Proxy.Env())
+
+	err = wd.CheckRemote(repo.URL)
+	switch {
+	case err == vcs.ErrCannotCheck:
+		return &checkResult{checkWarn, name, "the " + repo.Vcs + " driver cannot check remotes"}
+	case err != nil:
+		return &checkResult{checkFail, name, err.Error()}
+	}
+	return &checkResult{checkPass, name, "reached " + config.RedactURL(repo.URL)}
+}
+
+func sortedRepoNames(cfg *config.Config) []string {
+	names := make([]string, 0, len(cfg.Repos))
+	for name := range cfg.Repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check the config, the dbpath, the vcs commands and every repo's remote,
+// and print a report. It fails if any of the checks do.
+func doctor(conf string) error {
+	var r doctorReport
+
+	var cfg config.Config
+	if err := cfg.LoadFromFile(conf); err != nil {
+		r.add(checkFail, "config", "%s cannot be loaded: %s", conf, err)
+		r.print(os.Stdout)
+		return fmt.Errorf("%s cannot be loaded", conf)
+	}
+	r.add(checkPass, "config", "%s has %d repos", conf, len(cfg.Repos))
+
+	checkDbPath(&r, cfg.DbPath)
+	checkTools(&r, &cfg)
+	checkRemotes(&r, &cfg)
+
+	if err := r.print(os.Stdout); err != nil {
+		return err
+	}
+
+	if n := r.failed(); n > 0 {
+		return fmt.Errorf("%d of %d checks failed", n, len(r.checks))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/dblock"
+	"github.com/hound-search/hound/searcher"
+)
+
+// What houndd does when another one has its dbpath: fail, or serve
+// searches as a searcher from a dbpath of its own.
+const (
+	ifLockedFail     = "fail"
+	ifLockedSearcher = "searcher"
+)
+
+// The most searchers that can share a dbpath with the houndd that has it.
+const maxReplicas = 16
+
+// The lock of the dbpath, which is held until houndd exits. It is kept
+// here so that it is never collected, which would release it.
+var dbLock *dblock.Lock
+
+// Lock the dbpath of the config. If another houndd has it, this one fails
+// unless ifLocked is searcher, in which case it serves the indexes that
+// are published to the index store from a dbpath of its own under the
+// dbpath, taking the searcher role.
+func lockDbPath(cfg *config.Config, role *searcher.Role, ifLocked string) error {
+	if err := os.MkdirAll(cfg.DbPath, os.ModePerm); err != nil {
+		return err
+	}
+
+	lck, err := dblock.Acquire(cfg.DbPath)
+	if err == nil {
+		dbLock = lck
+		return nil
+	}
+
+	var le *dblock.LockedError
+	if !errors.As(err, &le) {
+		return err
+	}
+	if ifLocked != ifLockedSearcher {
+		return fmt.Errorf("%s: stop it, give this houndd a dbpath of its own or start it with -if-locked %s", le, ifLockedSearcher)
+	}
+	if cfg.IndexStore == "" {
+		return fmt.Errorf("%s, and there is no index-store for this houndd to serve the indexes of as a searcher", le)
+	}
+
+	for i := 1; i <= maxReplicas; i++ {
+		dir := filepath.Join(cfg.DbPath, fmt.Sprintf("replica-%d", i))
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return err
+		}
+
+		lck, err := dblock.Acquire(dir)
+		var rle *dblock.LockedError
+		if errors.As(err, &rle) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		info_log.Printf("%s, serving the published indexes from %s as a searcher", le, dir)
+		dbLock = lck
+		cfg.DbPath = dir
+		*role = searcher.RoleSearcher
+		return nil
+	}
+	return fmt.Errorf("%s, and so are all %d of the dbpaths of its searchers", le, maxReplicas)
+}
@@ -3,18 +3,18 @@ package main
 import (
 	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
-	"path/filepath"
 	"runtime"
-	"strings"
 	"syscall"
 
 	"github.com/hound-search/hound/api"
 	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/discover"
+	"github.com/hound-search/hound/federation"
 	"github.com/hound-search/hound/searcher"
 	"github.com/hound-search/hound/ui"
 	"github.com/hound-search/hound/web"
@@ -23,13 +23,11 @@ import (
 const gracefulShutdownSignal = syscall.SIGTERM
 
 var (
-	info_log   *log.Logger
-	error_log  *log.Logger
-	_, b, _, _ = runtime.Caller(0)
-	basepath   = filepath.Dir(b)
+	info_log  *log.Logger
+	error_log *log.Logger
 )
 
-func makeSearchers(cfg *config.Config) (map[string]*searcher.Searcher, bool, error) {
+func makeSearchers(cfg *config.Config, role searcher.Role) (*searcher.Set, bool, error) {
 	// Ensure we have a dbpath
 	if _, err := os.Stat(cfg.DbPath); err != nil {
 		if err := os.MkdirAll(cfg.DbPath, os.ModePerm); err != nil {
@@ -37,7 +35,7 @@ func makeSearchers(cfg *config.Config) (map[string]*searcher.Searcher, bool, err
 		}
 	}
 
-	searchers, errs, err := searcher.MakeAll(cfg)
+	searchers, errs, err := searcher.MakeAll(cfg, role)
 	if err != nil {
 		return nil, false, err
 	}
@@ -55,24 +53,52 @@ func makeSearchers(cfg *config.Config) (map[string]*searcher.Searcher, bool, err
 	return searchers, true, nil
 }
 
-func handleShutdown(shutdownCh <-chan os.Signal, searchers map[string]*searcher.Searcher) {
+// Connect to the downstream instances in the config, if any, and add their
+// repos to the config so the UI knows about them.
+func makeFederation(cfg *config.Config) *federation.Federation {
+	if len(cfg.Federation) == 0 {
+		return nil
+	}
+
+	fed := federation.New(cfg.Federation, cfg.Proxy.Client())
+	fed.Refresh()
+
+	if cfg.Repos == nil {
+		cfg.Repos = map[string]*config.Repo{}
+	}
+
+	for name, repo := range fed.Repos() {
+		if _, ok := cfg.Repos[name]; ok {
+			error_log.Printf("%s is both a local and a downstream repo, using the local one", name)
+			continue
+		}
+		cfg.Repos[name] = repo
+	}
+
+	fed.Start()
+	return fed
+}
+
+// Called to terminate the process once a graceful shutdown completes. The
+// windows service replaces this so it can report that it has stopped.
+var exit = os.Exit
+
+func handleShutdown(shutdownCh <-chan os.Signal, searchers ...*searcher.Set) {
 	go func() {
 		<-shutdownCh
 		info_log.Printf("Graceful shutdown requested...")
 		for _, s := range searchers {
 			s.Stop()
 		}
-
-		for _, s := range searchers {
-			s.Wait()
-		}
-
-		os.Exit(0)
+		exit(0)
 	}()
 }
 
+// The channel that receives shutdown requests, both from signals and
+// from the windows service control manager.
+var shutdownCh = make(chan os.Signal, 1)
+
 func registerShutdownSignal() <-chan os.Signal {
-	shutdownCh := make(chan os.Signal, 1)
 	signal.Notify(shutdownCh, gracefulShutdownSignal)
 	return shutdownCh
 }
@@ -100,7 +126,7 @@ func runHttp(
 	addr string,
 	dev bool,
 	cfg *config.Config,
-	idx map[string]*searcher.Searcher) error {
+	idx *searcher.Set) error {
 	m := http.DefaultServeMux
 
 	h, err := ui.Content(dev, cfg)
@@ -109,7 +135,7 @@ func runHttp(
 	}
 
 	m.Handle("/", h)
-	api.Setup(m, idx)
+	api.Setup(m, idx, nil, nil)
 	return http.ListenAndServe(addr, m)
 }
 
@@ -120,22 +146,140 @@ func main() {
 
 	flagConf := flag.String("conf", "config.json", "")
 	flagAddr := flag.String("addr", ":6080", "")
-	flagDev := flag.Bool("dev", false, "")
+	flagDev := flag.Bool("dev-ui", false, "serve the UI from its source tree, for working on it (needs a build with -tags dev)")
+	flag.BoolVar(flagDev, "dev", false, "the same as -dev-ui")
+	flagRole := flag.String("role", "all", "all, indexer (build and publish indexes) or searcher (only serve published indexes)")
+	flagService := flag.String("service", "", "install, uninstall, start or stop houndd as a windows service")
+	flagBackup := flag.String("backup", "", "copy the indexes and repos in the dbpath to this directory and exit")
+	flagRestore := flag.String("restore", "", "restore a backup from this directory into the dbpath and exit")
+	flagIndexOnly := flag.Bool("index-only", false, "bring every index up to date, publish it to the index-store and exit")
+	flagDoctor := flag.Bool("doctor", false, "check the vcs commands, the dbpath and that every repo can be reached, then exit")
+	flagIfLocked := flag.String("if-locked", ifLockedFail, "what to do when another houndd has the dbpath: fail, or serve the indexes it publishes as a searcher")
 
 	flag.Parse()
 
+	if *flagDev && !ui.DevUI {
+		error_log.Fatal("-dev-ui needs a build of houndd with -tags dev")
+	}
+
+	if *flagBackup != "" || *flagRestore != "" {
+		var cfg config.Config
+		if err := cfg.LoadFromFile(*flagConf); err != nil {
+			error_log.Fatal(err)
+		}
+
+		if *flagBackup != "" {
+			if err := searcher.Backup(cfg.DbPath, *flagBackup); err != nil {
+				error_log.Fatal(err)
+			}
+			if err := backupTenants(&cfg, *flagBackup); err != nil {
+				error_log.Fatal(err)
+			}
+			info_log.Printf("backed up %s to %s", cfg.DbPath, *flagBackup)
+		} else {
+			role := searcher.RoleAll
+			if err := lockDbPath(&cfg, &role, ifLockedFail); err != nil {
+				error_log.Fatal(err)
+			}
+			if err := searcher.Restore(*flagRestore, cfg.DbPath); err != nil {
+				error_log.Fatal(err)
+			}
+			if err := restoreTenants(&cfg, *flagRestore); err != nil {
+				error_log.Fatal(err)
+			}
+			info_log.Printf("restored %s from %s", cfg.DbPath, *flagRestore)
+		}
+		return
+	}
+
+	if *flagDoctor {
+		if err := doctor(*flagConf); err != nil {
+			error_log.Fatal(err)
+		}
+		return
+	}
+
+	if *flagIndexOnly {
+		if err := indexOnly(*flagConf); err != nil {
+			error_log.Fatal(err)
+		}
+		return
+	}
+
+	if *flagService != "" {
+		if err := serviceCommand(*flagService, *flagConf, *flagAddr); err != nil {
+			error_log.Fatal(err)
+		}
+		return
+	}
+
+	role, err := searcher.ParseRole(*flagRole)
+	if err != nil {
+		error_log.Fatal(err)
+	}
+	if *flagIfLocked != ifLockedFail && *flagIfLocked != ifLockedSearcher {
+		error_log.Fatalf("unknown -if-locked %q, expected %s or %s", *flagIfLocked, ifLockedFail, ifLockedSearcher)
+	}
+
+	serve(*flagConf, *flagAddr, *flagDev, role, *flagIfLocked)
+}
+
+// Build and publish the indexes of every repo without serving them, for
+// CI jobs that feed searchers through the index store.
+func indexOnly(conf string) error {
 	var cfg config.Config
-	if err := cfg.LoadFromFile(*flagConf); err != nil {
+	if err := cfg.LoadFromFile(conf); err != nil {
+		return err
+	}
+
+	role := searcher.RoleIndexer
+	if err := lockDbPath(&cfg, &role, ifLockedFail); err != nil {
+		return err
+	}
+
+	errs, err := searcher.IndexAll(&cfg)
+	if err != nil {
+		return err
+	}
+
+	failed, total, err := indexTenants(&cfg)
+	if err != nil {
+		return err
+	}
+	failed += len(errs)
+	total += len(cfg.Repos)
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d repos failed to index, see output above", failed, total)
+	}
+
+	info_log.Println("All indexes built!")
+	return nil
+}
+
+// Load the config, build the indexes and serve search traffic. This does
+// not return.
+func serve(conf, addr string, dev bool, role searcher.Role, ifLocked string) {
+	var cfg config.Config
+	if err := cfg.LoadFromFile(conf); err != nil {
 		panic(err)
 	}
 
+	// a second houndd on the dbpath would delete the indexes of the first.
+	if err := lockDbPath(&cfg, &role, ifLocked); err != nil {
+		error_log.Fatal(err)
+	}
+
 	// Start the web server on a background routine.
-	ws := web.Start(&cfg, *flagAddr, *flagDev)
+	ws, err := web.Start(&cfg, addr, dev)
+	if err != nil {
+		error_log.Fatal(err)
+	}
 
 	// It's not safe to be killed during makeSearchers, so register the
 	// shutdown signal here and defer processing it until we are ready.
 	shutdownCh := registerShutdownSignal()
-	idx, ok, err := makeSearchers(&cfg)
+	idx, ok, err := makeSearchers(&cfg, role)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -145,27 +289,38 @@ func main() {
 		info_log.Println("All indexes built!")
 	}
 
-	handleShutdown(shutdownCh, idx)
+	tenants, err := makeTenants(&cfg, role)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sets := []*searcher.Set{idx}
+	for _, t := range tenants {
+		if err := ws.ServeTenant(t.name, t.cfg, t.set); err != nil {
+			log.Panic(err)
+		}
+		sets = append(sets, t.set)
+	}
 
-	host := *flagAddr
-	if strings.HasPrefix(host, ":") {
-		host = "localhost" + host
+	handleShutdown(shutdownCh, sets...)
+
+	if err := discover.Start(&cfg, idx); err != nil {
+		log.Panic(err)
 	}
 
-	if *flagDev {
+	fed := makeFederation(&cfg)
+
+	if dev {
 		info_log.Printf("[DEV] starting webpack-dev-server at localhost:8080...")
-		webpack := exec.Command("./node_modules/.bin/webpack-dev-server", "--mode", "development")
-		webpack.Dir = basepath + "/../../"
-		webpack.Stdout = os.Stdout
-		webpack.Stderr = os.Stderr
-		err = webpack.Start()
-		if err != nil {
+		if err := ui.StartDevServer(); err != nil {
 			error_log.Println(err)
 		}
 	}
 
-	info_log.Printf("running server at http://%s...\n", host)
+	for _, u := range ws.URLs() {
+		info_log.Printf("running server at %s...\n", u)
+	}
 
 	// Fully enable the web server now that we have indexes
-	panic(ws.ServeWithIndex(idx))
+	panic(ws.ServeWithIndex(idx, fed))
 }
@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "errors"
+
+// Service mode is only available on windows.
+func serviceCommand(cmd, conf, addr string) error {
+	return errors.New("houndd: -service is only supported on windows")
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/hound-search/hound/searcher"
+)
+
+const (
+	serviceName        = "houndd"
+	serviceDisplayName = "Hound"
+	serviceDescription = "Hound source code search"
+)
+
+// Constants from winsvc.h and winnt.h.
+const (
+	serviceWin32OwnProcess = 0x10
+
+	serviceStopped      = 1
+	serviceStartPending = 2
+	serviceStopPending  = 3
+	serviceRunning      = 4
+
+	serviceAcceptStop     = 0x1
+	serviceAcceptShutdown = 0x4
+
+	serviceControlStop        = 0x1
+	serviceControlInterrogate = 0x4
+	serviceControlShutdown    = 0x5
+
+	eventlogErrorType       = 0x1
+	eventlogInformationType = 0x4
+
+	errorCallNotImplemented = 120
+)
+
+var (
+	modadvapi32 = syscall.NewLazyDLL("advapi32.dll")
+
+	procStartServiceCtrlDispatcherW   = modadvapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandlerExW = modadvapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus              = modadvapi32.NewProc("SetServiceStatus")
+	procRegisterEventSourceW          = modadvapi32.NewProc("RegisterEventSourceW")
+	procReportEventW                  = modadvapi32.NewProc("ReportEventW")
+)
+
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+type serviceStatus struct {
+	serviceType             uint32
+	currentState            uint32
+	controlsAccepted        uint32
+	win32ExitCode           uint32
+	serviceSpecificExitCode uint32
+	checkPoint              uint32
+	waitHint                uint32
+}
+
+// The state of the running service. There is only ever one.
+var svc struct {
+	handle uintptr
+	status serviceStatus
+	conf   string
+	addr   string
+}
+
+func setServiceState(state uint32) {
+	svc.status.serviceType = serviceWin32OwnProcess
+	svc.status.currentState = state
+	if state == serviceRunning {
+		svc.status.controlsAccepted = serviceAcceptStop | serviceAcceptShutdown
+	} else {
+		svc.status.controlsAccepted = 0
+	}
+	procSetServiceStatus.Call(svc.handle, uintptr(unsafe.Pointer(&svc.status)))
+}
+
+// Receives control requests from the service control manager.
+func serviceHandler(ctl, evtype uint32, evdata, ctx uintptr) uintptr {
+	switch ctl {
+	case serviceControlStop, serviceControlShutdown:
+		setServiceState(serviceStopPending)
+		shutdownCh <- gracefulShutdownSignal
+		return 0
+	case serviceControlInterrogate:
+		setServiceState(svc.status.currentState)
+		return 0
+	}
+	return errorCallNotImplemented
+}
+
+// The entry point called by the service control manager on its own thread.
+func serviceMain(argc uint32, argv **uint16) uintptr {
+	h, _, err := procRegisterServiceCtrlHandlerExW.Call(
+		uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(serviceName))),
+		syscall.NewCallback(serviceHandler),
+		0)
+	if h == 0 {
+		error_log.Printf("unable to register service handler: %s", err)
+		return 0
+	}
+	svc.handle = h
+
+	exit = func(code int) {
+		svc.status.win32ExitCode = uint32(code)
+		setServiceState(serviceStopped)
+		os.Exit(code)
+	}
+
+	setServiceState(serviceRunning)
+	serve(svc.conf, svc.addr, false, searcher.RoleAll, ifLockedFail)
+	return 0
+}
+
+// An io.Writer that sends each log line to the windows event log.
+type eventLog struct {
+	handle uintptr
+	etype  uint16
+}
+
+func (e *eventLog) Write(b []byte) (int, error) {
+	msg := syscall.StringToUTF16Ptr(strings.TrimSpace(string(b)))
+	r, _, err := procReportEventW.Call(
+		e.handle,
+		uintptr(e.etype),
+		0,
+		1,
+		0,
+		1,
+		0,
+		uintptr(unsafe.Pointer(&msg)),
+		0)
+	if r == 0 {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Send all logging to the event log since a service has no console.
+func useEventLog() error {
+	h, _, err := procRegisterEventSourceW.Call(
+		0,
+		uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(serviceName))))
+	if h == 0 {
+		return err
+	}
+
+	info := &eventLog{handle: h, etype: eventlogInformationType}
+	errs := &eventLog{handle: h, etype: eventlogErrorType}
+	info_log = log.New(info, "", 0)
+	error_log = log.New(errs, "", 0)
+	log.SetFlags(0)
+	log.SetOutput(errs)
+	return nil
+}
+
+// Run under the service control manager. This does not return until the
+// service is stopped.
+func runService(conf, addr string) error {
+	if err := useEventLog(); err != nil {
+		return err
+	}
+
+	// A service starts in the system directory, so relative paths in the
+	// config are taken relative to the config file itself.
+	if err := os.Chdir(filepath.Dir(conf)); err != nil {
+		return err
+	}
+
+	svc.conf = conf
+	svc.addr = addr
+
+	table := []serviceTableEntry{
+		{syscall.StringToUTF16Ptr(serviceName), syscall.NewCallback(serviceMain)},
+		{nil, 0},
+	}
+
+	r, _, err := procStartServiceCtrlDispatcherW.Call(uintptr(unsafe.Pointer(&table[0])))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// Run a windows admin command, passing along its output on failure.
+func runAdmin(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %s\n%s", name, strings.Join(args, " "), err, out)
+	}
+	return nil
+}
+
+// The registry key for our event log source.
+const eventSourceKey = `HKLM\SYSTEM\CurrentControlSet\Services\EventLog\Application\` + serviceName
+
+func installService(conf, addr string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	bin := fmt.Sprintf(`"%s" -service run -conf "%s" -addr "%s"`, exe, conf, addr)
+	if err := runAdmin("sc.exe", "create", serviceName,
+		"binPath=", bin,
+		"start=", "auto",
+		"DisplayName=", serviceDisplayName); err != nil {
+		return err
+	}
+
+	if err := runAdmin("sc.exe", "description", serviceName, serviceDescription); err != nil {
+		return err
+	}
+
+	// EventCreate.exe carries a generic message table that simply
+	// displays the logged string.
+	return runAdmin("reg.exe", "add", eventSourceKey,
+		"/v", "EventMessageFile",
+		"/t", "REG_EXPAND_SZ",
+		"/d", `%SystemRoot%\System32\EventCreate.exe`,
+		"/f")
+}
+
+func uninstallService() error {
+	if err := runAdmin("sc.exe", "delete", serviceName); err != nil {
+		return err
+	}
+
+	return runAdmin("reg.exe", "delete", eventSourceKey, "/f")
+}
+
+// Carry out one of the -service commands.
+func serviceCommand(cmd, conf, addr string) error {
+	conf, err := filepath.Abs(conf)
+	if err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "install":
+		return installService(conf, addr)
+	case "uninstall":
+		return uninstallService()
+	case "start":
+		return runAdmin("sc.exe", "start", serviceName)
+	case "stop":
+		return runAdmin("sc.exe", "stop", serviceName)
+	case "run":
+		return runService(conf, addr)
+	}
+
+	return fmt.Errorf("houndd: unknown service command %q, expected install, uninstall, start, stop or run", cmd)
+}
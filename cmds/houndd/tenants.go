@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/searcher"
+)
+
+// A tenant of the config, with the config of its own hound and the
+// searchers of its repos.
+type tenant struct {
+	name string
+	cfg  *config.Config
+	set  *searcher.Set
+}
+
+// Make the searchers of every tenant of the config, each in a dbpath of
+// its own under the one of the config.
+func makeTenants(cfg *config.Config, role searcher.Role) ([]*tenant, error) {
+	var tenants []*tenant
+	for _, name := range cfg.TenantNames() {
+		tc, err := cfg.ForTenant(name)
+		if err != nil {
+			return nil, err
+		}
+
+		set, ok, err := makeSearchers(tc, role)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %s", name, err)
+		}
+		if !ok {
+			info_log.Printf("Some repos of tenant %s failed to index, see output above", name)
+		}
+
+		tenants = append(tenants, &tenant{name, tc, set})
+	}
+	return tenants, nil
+}
+
+// Build and publish the indexes of the repos of every tenant of the
+// config, like indexOnly does for those of the instance, returning how
+// many failed out of how many there are.
+func indexTenants(cfg *config.Config) (int, int, error) {
+	failed, total := 0, 0
+	for _, name := range cfg.TenantNames() {
+		tc, err := cfg.ForTenant(name)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if err := os.MkdirAll(tc.DbPath, os.ModePerm); err != nil {
+			return 0, 0, err
+		}
+
+		errs, err := searcher.IndexAll(tc)
+		if err != nil {
+			return 0, 0, fmt.Errorf("tenant %s: %s", name, err)
+		}
+		failed += len(errs)
+		total += len(tc.Repos)
+	}
+	return failed, total, nil
+}
+
+// Back up the dbpath of every tenant of the config into target, where it
+// is in the same place relative to the backup of the instance as it is to
+// the dbpath of the instance.
+func backupTenants(cfg *config.Config, target string) error {
+	for _, name := range cfg.TenantNames() {
+		tc, err := cfg.ForTenant(name)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(cfg.DbPath, tc.DbPath)
+		if err != nil {
+			return err
+		}
+		// a tenant that hasn't been served yet has nothing to back up.
+		if _, err := os.Stat(tc.DbPath); os.IsNotExist(err) {
+			continue
+		}
+		if err := searcher.Backup(tc.DbPath, filepath.Join(target, rel)); err != nil {
+			return fmt.Errorf("tenant %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// Restore the dbpath of every tenant of the config that is in the backup
+// in src, which backupTenants made.
+func restoreTenants(cfg *config.Config, src string) error {
+	for _, name := range cfg.TenantNames() {
+		tc, err := cfg.ForTenant(name)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(cfg.DbPath, tc.DbPath)
+		if err != nil {
+			return err
+		}
+		from := filepath.Join(src, rel)
+		if _, err := os.Stat(from); os.IsNotExist(err) {
+			info_log.Printf("there is no backup of tenant %s in %s", name, src)
+			continue
+		}
+		if err := searcher.Restore(from, tc.DbPath); err != nil {
+			return fmt.Errorf("tenant %s: %s", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math/bits"
+)
+
+// Check reads the index in file and verifies that it is well formed: the
+// header and trailer are intact, every offset is in range, the names are
+// sorted and every posting list decodes to increasing ids of files in the
+// index. Unlike Open, a corrupt index is reported as an error rather than
+// ending the process. It returns the names of the indexed files.
+func Check(file string) ([]string, error) {
+	d, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(d) < len(magic)+5*4+len(trailerMagic) ||
+		string(d[:len(magic)]) != magic ||
+		string(d[len(d)-len(trailerMagic):]) != trailerMagic {
+		return nil, fmt.Errorf("bad header or trailer")
+	}
+
+	n := uint32(len(d) - len(trailerMagic) - 5*4)
+	pathData := binary.BigEndian.Uint32(d[n:])
+	nameData := binary.BigEndian.Uint32(d[n+4:])
+	postData := binary.BigEndian.Uint32(d[n+8:])
+	nameIndex := binary.BigEndian.Uint32(d[n+12:])
+	postIndex := binary.BigEndian.Uint32(d[n+16:])
+
+	if pathData != uint32(len(magic)) || nameData < pathData || postData < nameData ||
+		nameIndex < postData || postIndex < nameIndex || n < postIndex {
+		return nil, fmt.Errorf("sections out of order")
+	}
+
+	if (postIndex-nameIndex)%4 != 0 || postIndex-nameIndex < 4 {
+		return nil, fmt.Errorf("bad name index size")
+	}
+	if (n-postIndex)%postEntrySize != 0 {
+		return nil, fmt.Errorf("bad posting list index size")
+	}
+
+	if err := checkStrings(d[pathData:nameData]); err != nil {
+		return nil, fmt.Errorf("path list: %s", err)
+	}
+
+	numName := int((postIndex-nameIndex)/4) - 1
+	names := make([]string, numName)
+	for i := 0; i < numName; i++ {
+		off := binary.BigEndian.Uint32(d[nameIndex+4*uint32(i):])
+		if nameData+off >= postData {
+			return nil, fmt.Errorf("name %d out of range", i)
+		}
+
+		s := d[nameData+off : postData]
+		end := bytes.IndexByte(s, 0)
+		if end < 0 {
+			return nil, fmt.Errorf("name %d is not terminated", i)
+		}
+
+		names[i] = string(s[:end])
+		if i > 0 && names[i] < names[i-1] {
+			return nil, fmt.Errorf("names out of order at %q", names[i])
+		}
+	}
+
+	numPost := int((n - postIndex) / postEntrySize)
+	last := -1
+	for i := 0; i < numPost; i++ {
+		e := d[postIndex+uint32(i)*postEntrySize:]
+		trigram := int(e[0])<<16 | int(e[1])<<8 | int(e[2])
+		count := binary.BigEndian.Uint32(e[3:])
+		offset := binary.BigEndian.Uint32(e[3+4:])
+
+		if trigram <= last {
+			return nil, fmt.Errorf("posting lists out of order at %#x", trigram)
+		}
+		last = trigram
+
+		if err := checkList(d[postData:nameIndex], trigram, count, offset, numName); err != nil {
+			return nil, fmt.Errorf("posting list %#x: %s", trigram, err)
+		}
+	}
+
+	return names, nil
+}
+
+// Check a sequence of NUL terminated strings that ends with an empty one.
+func checkStrings(d []byte) error {
+	for len(d) > 0 {
+		i := bytes.IndexByte(d, 0)
+		if i < 0 {
+			return fmt.Errorf("unterminated string")
+		}
+		if i == 0 {
+			return nil
+		}
+		d = d[i+1:]
+	}
+	return fmt.Errorf("missing end of list")
+}
+
+// Check one posting list of the posting list data.
+func checkList(d []byte, trigram int, count, offset uint32, numName int) error {
+	if uint64(offset)+3 > uint64(len(d)) {
+		return fmt.Errorf("offset out of range")
+	}
+
+	t := d[offset:]
+	if int(t[0])<<16|int(t[1])<<8|int(t[2]) != trigram {
+		return fmt.Errorf("trigram does not match its index entry")
+	}
+	d = t[3:]
+
+	if count&bitmapList != 0 {
+		size := (numName + 7) / 8
+		if len(d) < size {
+			return fmt.Errorf("bitmap out of range")
+		}
+
+		set := 0
+		for _, b := range d[:size] {
+			set += bits.OnesCount8(b)
+		}
+		if set != int(count&^bitmapList) {
+			return fmt.Errorf("bitmap has %d files, expected %d", set, count&^bitmapList)
+		}
+		if numName%8 != 0 && d[size-1]>>(uint(numName)%8) != 0 {
+			return fmt.Errorf("bitmap has files past the end")
+		}
+		return nil
+	}
+
+	fileid := ^uint32(0)
+	for i := uint32(0); i < count; i++ {
+		delta, n := binary.Uvarint(d)
+		if n <= 0 || delta == 0 {
+			return fmt.Errorf("bad delta")
+		}
+		d = d[n:]
+
+		fileid += uint32(delta)
+		if int(fileid) >= numName {
+			return fmt.Errorf("file id %d out of range", fileid)
+		}
+	}
+
+	if delta, n := binary.Uvarint(d); n <= 0 || delta != 0 {
+		return fmt.Errorf("missing end of list")
+	}
+
+	return nil
+}
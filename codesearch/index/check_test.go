@@ -0,0 +1,70 @@
+package index
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	for _, files := range []map[string]string{postFiles, bitmapFiles("f", 3000)} {
+		f, _ := ioutil.TempFile("", "index-test")
+		defer os.Remove(f.Name())
+		out := f.Name()
+		buildIndex(out, nil, files)
+
+		names, err := Check(out)
+		if err != nil {
+			t.Fatalf("Check: %s", err)
+		}
+		if len(names) != len(files) {
+			t.Fatalf("Check found %d names, want %d", len(names), len(files))
+		}
+	}
+}
+
+func TestCheckCorrupt(t *testing.T) {
+	f, _ := ioutil.TempFile("", "index-test")
+	defer os.Remove(f.Name())
+	out := f.Name()
+	buildIndex(out, nil, postFiles)
+
+	good, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the offset of the last posting list index entry
+	n := len(good) - len(trailerMagic) - 5*4
+	last := n - postEntrySize + 3 + 4
+
+	corruptions := map[string]func(d []byte) []byte{
+		"truncated": func(d []byte) []byte {
+			return d[:len(d)/2]
+		},
+		"bad trailer": func(d []byte) []byte {
+			d[len(d)-1] ^= 0xff
+			return d
+		},
+		"list out of range": func(d []byte) []byte {
+			binary.BigEndian.PutUint32(d[last:], 0xfffffff0)
+			return d
+		},
+		"wrong count": func(d []byte) []byte {
+			binary.BigEndian.PutUint32(d[last-4:], 1000)
+			return d
+		},
+	}
+
+	for name, fn := range corruptions {
+		d := fn(append([]byte(nil), good...))
+		if err := ioutil.WriteFile(out, d, 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := Check(out); err == nil {
+			t.Errorf("%s: expected Check to fail", name)
+		}
+	}
+}
@@ -239,6 +239,7 @@ type postMapReader struct {
   count   uint32
   offset  uint32
   d       []byte
+  bits    []byte
   oldid   uint32
   fileid  uint32
   i       int
@@ -268,7 +269,13 @@ func (r *postMapReader) load() {
     r.fileid = ^uint32(0)
     return
   }
-  r.d = r.ix.slice(r.ix.postData+r.offset+3, -1)
+  if r.count&bitmapList != 0 {
+    r.count &^= bitmapList
+    r.bits = r.ix.bitmap(r.offset)
+  } else {
+    r.bits = nil
+    r.d = r.ix.slice(r.ix.postData+r.offset+3, -1)
+  }
   r.oldid = ^uint32(0)
   r.i = 0
 }
@@ -276,13 +283,20 @@ func (r *postMapReader) load() {
 func (r *postMapReader) nextId() bool {
   for r.count > 0 {
     r.count--
-    delta64, n := binary.Uvarint(r.d)
-    delta := uint32(delta64)
-    if n <= 0 || delta == 0 {
-      corrupt(r.ix.data.f)
+    if r.bits != nil {
+      r.oldid = nextBit(r.bits, r.oldid+1)
+      if r.oldid == ^uint32(0) {
+        corrupt(r.ix.data.f)
+      }
+    } else {
+      delta64, n := binary.Uvarint(r.d)
+      delta := uint32(delta64)
+      if n <= 0 || delta == 0 {
+        corrupt(r.ix.data.f)
+      }
+      r.d = r.d[n:]
+      r.oldid += delta
     }
-    r.d = r.d[n:]
-    r.oldid += delta
     for r.i < len(r.idmap) && r.idmap[r.i].hi <= r.oldid {
       r.i++
     }
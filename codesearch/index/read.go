@@ -39,6 +39,11 @@ package index
 // not recorded at all.  The list of posting lists ends with an entry
 // with trigram "\xff\xff\xff" and a delta list consisting a single zero.
 //
+// Long posting lists that cover enough of the files are instead written
+// as a bitmap of (number of names + 7) / 8 bytes following the trigram,
+// where bit id%8 of byte id/8 is set if file id is in the list.  The top
+// bit of the file count in the list's index entry marks these lists.
+//
 // The indexes enable efficient random access to the lists.  The name
 // index is a sequence of 4-byte big-endian values listing the byte
 // offset in the name list where each name begins.  The posting list
@@ -67,7 +72,10 @@ package index
 import (
   "bytes"
   "encoding/binary"
+  "fmt"
+  "io/ioutil"
   "log"
+  "math/bits"
   "os"
   "runtime"
   "sort"
@@ -93,8 +101,34 @@ type Index struct {
 
 const postEntrySize = 3 + 4 + 4
 
+// Set in the file count of posting lists stored as bitmaps.
+const bitmapList = 1 << 31
+
 func Open(file string) *Index {
-  mm := mmap(file)
+  return open(mmap(file))
+}
+
+// OpenInMemory is like Open, but reads the whole index onto the heap so
+// that lookups never go back to the file. Unlike Open, it returns an error
+// rather than exiting if the file can't be read or is corrupt.
+func OpenInMemory(file string) (*Index, error) {
+  f, err := os.Open(file)
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+
+  data, err := ioutil.ReadAll(f)
+  if err != nil {
+    return nil, err
+  }
+  if len(data) < 4*4+len(trailerMagic) || string(data[len(data)-len(trailerMagic):]) != trailerMagic {
+    return nil, fmt.Errorf("corrupt index: %s", file)
+  }
+  return open(mmapData{f, data, nil}), nil
+}
+
+func open(mm mmapData) *Index {
   if len(mm.d) < 4*4+len(trailerMagic) || string(mm.d[len(mm.d)-len(trailerMagic):]) != trailerMagic {
     corrupt(mm.f)
   }
@@ -176,6 +210,11 @@ func (ix *Index) Name(fileid uint32) string {
   return string(ix.NameBytes(fileid))
 }
 
+// NumNames returns the number of files in the index.
+func (ix *Index) NumNames() int {
+  return ix.numName
+}
+
 // listAt returns the index list entry at the given offset.
 func (ix *Index) listAt(off uint32) (trigram, count, offset uint32) {
   d := ix.slice(ix.postIndex+off, postEntrySize)
@@ -190,13 +229,15 @@ func (ix *Index) dumpPosting() {
   for i := 0; i < ix.numPost; i++ {
     j := i * postEntrySize
     t := uint32(d[j])<<16 | uint32(d[j+1])<<8 | uint32(d[j+2])
-    count := int(binary.BigEndian.Uint32(d[j+3:]))
+    count := binary.BigEndian.Uint32(d[j+3:])
     offset := binary.BigEndian.Uint32(d[j+3+4:])
-    log.Printf("%#x: %d at %d", t, count, offset)
+    log.Printf("%#x: %d at %d (bitmap: %v)", t, count&^bitmapList, offset, count&bitmapList != 0)
   }
 }
 
-func (ix *Index) findList(trigram uint32) (count int, offset uint32) {
+// findList returns the file count and offset of the posting list of
+// trigram. The count has bitmapList set if the list is a bitmap.
+func (ix *Index) findList(trigram uint32) (count uint32, offset uint32) {
   // binary search
   d := ix.slice(ix.postIndex, postEntrySize*ix.numPost)
   i := sort.Search(ix.numPost, func(i int) bool {
@@ -212,17 +253,41 @@ func (ix *Index) findList(trigram uint32) (count int, offset uint32) {
   if t != trigram {
     return 0, 0
   }
-  count = int(binary.BigEndian.Uint32(d[i+3:]))
+  count = binary.BigEndian.Uint32(d[i+3:])
   offset = binary.BigEndian.Uint32(d[i+3+4:])
   return
 }
 
+// bitmap returns the bitmap of a posting list stored as one.
+func (ix *Index) bitmap(offset uint32) []byte {
+  return ix.slice(ix.postData+offset+3, (ix.numName+7)/8)
+}
+
+// nextBit returns the first file id from id on that is set in bm, or
+// ^uint32(0) if there is none.
+func nextBit(bm []byte, id uint32) uint32 {
+  for i := int(id / 8); i < len(bm); i++ {
+    b := bm[i] >> (id % 8)
+    if b != 0 {
+      return id + uint32(bits.TrailingZeros8(b))
+    }
+    id = uint32(i+1) * 8
+  }
+  return ^uint32(0)
+}
+
+// hasBit reports whether file id is set in bm.
+func hasBit(bm []byte, id uint32) bool {
+  return int(id/8) < len(bm) && bm[id/8]&(1<<(id%8)) != 0
+}
+
 type postReader struct {
   ix       *Index
   count    int
   offset   uint32
   fileid   uint32
   d        []byte
+  bits     []byte
   restrict []uint32
 }
 
@@ -232,10 +297,14 @@ func (r *postReader) init(ix *Index, trigram uint32, restrict []uint32) {
     return
   }
   r.ix = ix
-  r.count = count
+  r.count = int(count &^ bitmapList)
   r.offset = offset
   r.fileid = ^uint32(0)
-  r.d = ix.slice(ix.postData+offset+3, -1)
+  if count&bitmapList != 0 {
+    r.bits = ix.bitmap(offset)
+  } else {
+    r.d = ix.slice(ix.postData+offset+3, -1)
+  }
   r.restrict = restrict
 }
 
@@ -244,6 +313,9 @@ func (r *postReader) max() int {
 }
 
 func (r *postReader) next() bool {
+  if r.bits != nil {
+    return r.nextBit()
+  }
   for r.count > 0 {
     r.count--
     delta64, n := binary.Uvarint(r.d)
@@ -273,6 +345,30 @@ func (r *postReader) next() bool {
   return false
 }
 
+// nextBit is next for posting lists stored as bitmaps. Rather than
+// walking the list, only the ids in restrict are tested when there is one.
+func (r *postReader) nextBit() bool {
+  if r.restrict != nil {
+    for len(r.restrict) > 0 {
+      id := r.restrict[0]
+      r.restrict = r.restrict[1:]
+      if hasBit(r.bits, id) {
+        r.fileid = id
+        return true
+      }
+    }
+  } else if r.count > 0 {
+    r.count--
+    r.fileid = nextBit(r.bits, r.fileid+1)
+    if r.fileid == ^uint32(0) {
+      corrupt(r.ix.data.f)
+    }
+    return true
+  }
+  r.fileid = ^uint32(0)
+  return false
+}
+
 func (ix *Index) PostingList(trigram uint32) []uint32 {
   return ix.postingList(trigram, nil)
 }
@@ -295,6 +391,25 @@ func (ix *Index) postingAnd(list []uint32, trigram uint32, restrict []uint32) []
   var r postReader
   r.init(ix, trigram, restrict)
   x := list[:0]
+  if r.bits != nil {
+    // test each id in list rather than walking the whole bitmap.
+    j := 0
+    for _, fileid := range list {
+      if !hasBit(r.bits, fileid) {
+        continue
+      }
+      if restrict != nil {
+        for j < len(restrict) && restrict[j] < fileid {
+          j++
+        }
+        if j == len(restrict) || restrict[j] != fileid {
+          continue
+        }
+      }
+      x = append(x, fileid)
+    }
+    return x
+  }
   i := 0
   for r.next() {
     fileid := r.fileid
@@ -422,6 +537,10 @@ type mmapData struct {
 }
 
 func (m *mmapData) close() error {
+  // data read by OpenInMemory is left to the garbage collector.
+  if m.o == nil && m.d != nil {
+    return nil
+  }
   return unmmapFile(m)
 }
 
@@ -5,8 +5,10 @@
 package index
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"regexp/syntax"
 	"testing"
 )
 
@@ -58,3 +60,105 @@ func equalList(x, y []uint32) bool {
 	}
 	return true
 }
+
+// Enough files that the posting lists of common trigrams become bitmaps.
+func bitmapFiles(prefix string, n int) map[string]string {
+	files := make(map[string]string)
+	for i := 0; i < n; i++ {
+		s := "common"
+		if i%2 == 0 {
+			s += " half"
+		}
+		if i%1000 == 7 {
+			s += " rare"
+		}
+		files[fmt.Sprintf("%s%05d", prefix, i)] = s
+	}
+	return files
+}
+
+func everyNth(n, of, start uint32) []uint32 {
+	var l []uint32
+	for i := start; i < of; i += n {
+		l = append(l, i)
+	}
+	return l
+}
+
+func TestBitmapPosting(t *testing.T) {
+	f, _ := ioutil.TempFile("", "index-test")
+	defer os.Remove(f.Name())
+	out := f.Name()
+
+	const n = 5000
+	buildIndex(out, nil, bitmapFiles("f", n))
+	ix := Open(out)
+	defer ix.Close()
+
+	com := tri('c', 'o', 'm')
+	hal := tri('h', 'a', 'l')
+	rar := tri('r', 'a', 'r')
+
+	if count, _ := ix.findList(com); count&bitmapList == 0 {
+		t.Errorf("expected the list of com to be a bitmap")
+	}
+	if count, _ := ix.findList(rar); count&bitmapList != 0 {
+		t.Errorf("expected the list of rar to be deltas")
+	}
+
+	all := everyNth(1, n, 0)
+	half := everyNth(2, n, 0)
+	rare := everyNth(1000, n, 7)
+
+	if l := ix.PostingList(com); !equalList(l, all) {
+		t.Errorf("PostingList(com) has %d files, want %d", len(l), len(all))
+	}
+	if l := ix.PostingList(hal); !equalList(l, half) {
+		t.Errorf("PostingList(hal) has %d files, want %d", len(l), len(half))
+	}
+	if l := ix.PostingAnd(ix.PostingList(rar), com); !equalList(l, rare) {
+		t.Errorf("PostingList(rar&com) = %v, want %v", l, rare)
+	}
+	if l := ix.PostingAnd(ix.PostingList(com), hal); !equalList(l, half) {
+		t.Errorf("PostingList(com&hal) has %d files, want %d", len(l), len(half))
+	}
+	if l := ix.postingList(hal, rare); !equalList(l, nil) {
+		t.Errorf("PostingList(hal) restricted to rare = %v, want []", l)
+	}
+	if l := ix.PostingOr(ix.PostingList(rar), hal); len(l) != len(half)+len(rare) {
+		t.Errorf("PostingList(rar|hal) has %d files, want %d", len(l), len(half)+len(rare))
+	}
+
+	re, err := syntax.Parse("half.*com|rare", syntax.Perl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := RegexpQuery(re)
+	if l := ix.PostingQuery(q); len(l) != len(half)+len(rare) {
+		t.Errorf("PostingQuery(%s) has %d files, want %d", q, len(l), len(half)+len(rare))
+	}
+}
+
+func TestBitmapMerge(t *testing.T) {
+	f1, _ := ioutil.TempFile("", "index-test")
+	f2, _ := ioutil.TempFile("", "index-test")
+	f3, _ := ioutil.TempFile("", "index-test")
+	defer os.Remove(f1.Name())
+	defer os.Remove(f2.Name())
+	defer os.Remove(f3.Name())
+
+	const n = 3000
+	buildIndex(f1.Name(), []string{"/a"}, bitmapFiles("/a/", n))
+	buildIndex(f2.Name(), []string{"/b"}, bitmapFiles("/b/", n))
+	Merge(f3.Name(), f1.Name(), f2.Name())
+
+	ix := Open(f3.Name())
+	defer ix.Close()
+
+	var half []uint32
+	half = append(half, everyNth(2, n, 0)...)
+	half = append(half, everyNth(2, 2*n, n)...)
+	if l := ix.PostingList(tri('h', 'a', 'l')); !equalList(l, half) {
+		t.Errorf("merged PostingList(hal) has %d files, want %d", len(l), len(half))
+	}
+}
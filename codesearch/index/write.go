@@ -52,6 +52,8 @@ type IndexWriter struct {
 	postFile  []*os.File  // flushed post entries
 	postData  [][]byte    // mmap buffers to be unmapped
 	postIndex *bufWriter  // temp file holding posting list index
+	ids       []uint32    // file ids of the posting list being written
+	bits      []byte      // scratch bitmap of a posting list
 
 	inbuf []byte     // input buffer
 	main  *bufWriter // main index file
@@ -59,6 +61,11 @@ type IndexWriter struct {
 
 const npost = 64 << 20 / 8 // 64 MB worth of post entries
 
+// Posting lists with fewer files than this are always written as deltas.
+// Past it, lists that cover enough of the files are written as bitmaps,
+// which are smaller and can be tested for a file without decoding.
+const minBitmapList = 1024
+
 // Create returns a new IndexWriter that will write the index to file.
 func Create(file string) *IndexWriter {
 	return &IndexWriter{
@@ -260,13 +267,26 @@ func (ix *IndexWriter) Flush() {
 	ix.main.flush()
 }
 
+// Throttle makes the writer call wait with the size of each write to the
+// index and its temporary files before making it, so that the rate at
+// which it writes to disk can be limited.
+func (ix *IndexWriter) Throttle(wait func(n int)) {
+	for _, b := range []*bufWriter{ix.nameData, ix.nameIndex, ix.postIndex, ix.main} {
+		b.wait = wait
+	}
+}
+
 func (ix *IndexWriter) Close() {
 	ix.main.file.Close()
 }
 
 func copyFile(dst, src *bufWriter) {
 	dst.flush()
-	_, err := io.Copy(dst.file, src.finish())
+	var w io.Writer = dst.file
+	if dst.wait != nil {
+		w = waitWriter{dst.file, dst.wait}
+	}
+	_, err := io.Copy(w, src.finish())
 	if err != nil {
 		log.Fatalf("copying %s to %s: %v", src.name, dst.name, err)
 	}
@@ -340,15 +360,23 @@ func (ix *IndexWriter) mergePost(out *bufWriter) {
 		ix.buf[2] = byte(trigram)
 
 		// posting list
-		fileid := ^uint32(0)
-		nfile := uint32(0)
-		out.write(ix.buf[:3])
+		ix.ids = ix.ids[:0]
 		for ; e.trigram() == trigram && trigram != 1<<24-1; e = h.next() {
-			out.writeUvarint(e.fileid() - fileid)
-			fileid = e.fileid()
-			nfile++
+			ix.ids = append(ix.ids, e.fileid())
+		}
+		nfile := uint32(len(ix.ids))
+		out.write(ix.buf[:3])
+		if bits := ix.bitmap(ix.ids); bits != nil {
+			out.write(bits)
+			nfile |= bitmapList
+		} else {
+			fileid := ^uint32(0)
+			for _, id := range ix.ids {
+				out.writeUvarint(id - fileid)
+				fileid = id
+			}
+			out.writeUvarint(0)
 		}
-		out.writeUvarint(0)
 
 		// index entry
 		ix.postIndex.write(ix.buf[:3])
@@ -361,6 +389,50 @@ func (ix *IndexWriter) mergePost(out *bufWriter) {
 	}
 }
 
+// bitmap returns the posting list ids as a bitmap of all the files in
+// the index, if that is smaller than the list of deltas.
+func (ix *IndexWriter) bitmap(ids []uint32) []byte {
+	if len(ids) < minBitmapList {
+		return nil
+	}
+
+	// the empty name ending the list of names has been added by now.
+	size := (ix.numName - 1 + 7) / 8
+
+	n := 1
+	fileid := ^uint32(0)
+	for _, id := range ids {
+		n += uvarintLen(id - fileid)
+		fileid = id
+		if n > size {
+			break
+		}
+	}
+	if n <= size {
+		return nil
+	}
+
+	if cap(ix.bits) < size {
+		ix.bits = make([]byte, size)
+	}
+	bits := ix.bits[:size]
+	for i := range bits {
+		bits[i] = 0
+	}
+	for _, id := range ids {
+		bits[id/8] |= 1 << (id % 8)
+	}
+	return bits
+}
+
+func uvarintLen(x uint32) int {
+	n := 1
+	for ; x >= 0x80; x >>= 7 {
+		n++
+	}
+	return n
+}
+
 // A postChunk represents a chunk of post entries flushed to disk or
 // still in memory.
 type postChunk struct {
@@ -493,6 +565,20 @@ type bufWriter struct {
 	file *os.File
 	buf  []byte
 	tmp  [8]byte
+
+	// If set, called before each write to the file.
+	wait func(n int)
+}
+
+// A waitWriter calls wait before each write.
+type waitWriter struct {
+	w    io.Writer
+	wait func(n int)
+}
+
+func (w waitWriter) Write(p []byte) (int, error) {
+	w.wait(len(p))
+	return w.w.Write(p)
 }
 
 // bufCreate creates a new file with the given name and returns a
@@ -523,6 +609,9 @@ func (b *bufWriter) write(x []byte) {
 	if len(x) > n {
 		b.flush()
 		if len(x) >= cap(b.buf) {
+			if b.wait != nil {
+				b.wait(len(x))
+			}
 			if _, err := b.file.Write(x); err != nil {
 				log.Fatalf("writing %s: %v", b.name, err)
 			}
@@ -544,6 +633,9 @@ func (b *bufWriter) writeString(s string) {
 	if len(s) > n {
 		b.flush()
 		if len(s) >= cap(b.buf) {
+			if b.wait != nil {
+				b.wait(len(s))
+			}
 			if _, err := b.file.WriteString(s); err != nil {
 				log.Fatalf("writing %s: %v", b.name, err)
 			}
@@ -567,6 +659,9 @@ func (b *bufWriter) flush() {
 	if len(b.buf) == 0 {
 		return
 	}
+	if b.wait != nil {
+		b.wait(len(b.buf))
+	}
 	_, err := b.file.Write(b.buf)
 	if err != nil {
 		log.Fatalf("writing %s: %v", b.name, err)
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Determine if the url refers to an Azure DevOps (or the older Visual
+// Studio Team Services) hosted repo.
+func isAzureDevOpsURL(u string) bool {
+	for _, h := range hostAndParents(urlHost(u)) {
+		if h == "visualstudio.com" || h == "dev.azure.com" {
+			return true
+		}
+	}
+	return false
+}
+
+// Split the path of a clone url into its non-empty segments.
+func pathSegments(p string) []string {
+	var segs []string
+	for _, s := range strings.Split(p, "/") {
+		if s != "" {
+			segs = append(segs, s)
+		}
+	}
+	return segs
+}
+
+// Derive the {organization} and {project} placeholders from an Azure
+// DevOps clone url. The following forms are understood:
+//
+//	https://dev.azure.com/{organization}/{project}/_git/{repo}
+//	https://{organization}.visualstudio.com/[DefaultCollection/]{project}/_git/{repo}
+//	git@ssh.dev.azure.com:v3/{organization}/{project}/{repo}
+//	{organization}@vs-ssh.visualstudio.com:v3/{organization}/{project}/{repo}
+func azureDevOpsVars(raw string) map[string]string {
+	var host, path string
+	if i := strings.Index(raw, ":v3/"); i >= 0 && !strings.Contains(raw, "://") {
+		// scp style ssh urls
+		host = raw[:i]
+		if j := strings.LastIndex(host, "@"); j >= 0 {
+			host = host[j+1:]
+		}
+		path = raw[i+1:]
+	} else {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil
+		}
+		host = u.Hostname()
+		path = u.Path
+	}
+
+	segs := pathSegments(path)
+	if len(segs) > 0 && segs[0] == "v3" {
+		segs = segs[1:]
+	}
+
+	var org string
+	if strings.HasSuffix(host, ".visualstudio.com") && !strings.HasPrefix(host, "vs-ssh.") {
+		org = strings.TrimSuffix(host, ".visualstudio.com")
+		if len(segs) > 0 && strings.EqualFold(segs[0], "DefaultCollection") {
+			segs = segs[1:]
+		}
+	} else if len(segs) > 0 {
+		org, segs = segs[0], segs[1:]
+	}
+
+	vars := map[string]string{}
+	if org != "" {
+		vars["organization"] = org
+	}
+
+	if len(segs) > 1 && segs[0] != "_git" {
+		vars["project"] = segs[0]
+	}
+
+	return vars
+}
@@ -0,0 +1,14 @@
+package config
+
+import "strings"
+
+// Clean up the base path so that it is either empty, for the root, or
+// starts with a slash and doesn't end with one.
+func initBasePath(c *Config) {
+	p := strings.Trim(c.BasePath, "/")
+	if p == "" {
+		c.BasePath = ""
+		return
+	}
+	c.BasePath = "/" + p
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+)
+
+// The port that Bitbucket Server serves its repos over ssh on, unless it
+// is set up otherwise.
+const bitbucketServerSSHPort = "7999"
+
+// The url pattern of the repos of a Bitbucket Server (or Data Center),
+// with {server}, {project} and {repo} filled in from the clone url.
+var bitbucketServerURLPattern = &URLPattern{
+	BaseURL:     "{server}/projects/{project}/repos/{repo}/browse/{path}?at={branch}{anchor}",
+	Anchor:      "#{line}",
+	RangeAnchor: "#{start}-{end}",
+}
+
+// Derive the {server}, {project} and {repo} placeholders from the clone url
+// of a Bitbucket Server repo, or return nil if it isn't one. The following
+// forms are understood:
+//
+//	https://{host}[/{context}]/scm/{project}/{repo}.git
+//	ssh://git@{host}:7999[/{context}]/{project}/{repo}.git
+//
+// The server of an ssh url is taken to be https on the same host.
+func bitbucketServerVars(raw string) map[string]string {
+	if !strings.Contains(raw, "://") {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil
+	}
+
+	segs := pathSegments(u.Path)
+	var server string
+	switch u.Scheme {
+	case "http", "https":
+		if len(segs) < 3 || segs[len(segs)-3] != "scm" {
+			return nil
+		}
+		server = u.Scheme + "://" + u.Host + "/" + strings.Join(segs[:len(segs)-3], "/")
+	case "ssh":
+		if u.Port() != bitbucketServerSSHPort || len(segs) < 2 {
+			return nil
+		}
+		server = "https://" + u.Hostname() + "/" + strings.Join(segs[:len(segs)-2], "/")
+	default:
+		return nil
+	}
+
+	return map[string]string{
+		"server":  strings.TrimSuffix(server, "/"),
+		"project": strings.ToUpper(segs[len(segs)-2]),
+		"repo":    strings.TrimSuffix(segs[len(segs)-1], ".git"),
+	}
+}
+
+// Determine if the url refers to a repo on a Bitbucket Server.
+func isBitbucketServerURL(u string) bool {
+	return bitbucketServerVars(u) != nil
+}
@@ -0,0 +1,47 @@
+package config
+
+const (
+	defaultCanaryMaxShrink = 0.5
+	defaultCanarySamples   = 5
+)
+
+// Canary checks each new index of a repo against the one it is about to
+// replace, and keeps serving the old one if the new one lost too much of
+// it, as it would after a bad clone or a filter that went wrong.
+type Canary struct {
+	// The most that the new index can shrink by, as a share of the files
+	// of the old one and of the files that each query matches in it.
+	MaxShrink float64 `json:"max-shrink"`
+
+	// The queries whose results are compared. Unless there are some, as
+	// many as samples are taken from the names of the files of the old
+	// index.
+	Queries []string `json:"queries"`
+	Samples int      `json:"samples"`
+}
+
+// Fill the fields of c that are not set from def, the canary of the
+// config, and then from the defaults.
+func initCanary(c, def *Canary) {
+	if def == nil {
+		def = &Canary{}
+	}
+
+	if c.MaxShrink == 0 {
+		c.MaxShrink = def.MaxShrink
+	}
+	if c.MaxShrink == 0 {
+		c.MaxShrink = defaultCanaryMaxShrink
+	}
+
+	if len(c.Queries) == 0 {
+		c.Queries = def.Queries
+	}
+
+	if c.Samples == 0 {
+		c.Samples = def.Samples
+	}
+	if c.Samples == 0 {
+		c.Samples = defaultCanarySamples
+	}
+}
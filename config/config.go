@@ -9,23 +9,71 @@ import (
 )
 
 const (
-	defaultMsBetweenPoll         = 30000
-	defaultMaxConcurrentIndexers = 2
-	defaultPushEnabled           = false
-	defaultPollEnabled           = true
-	defaultTitle                 = "Hound"
-	defaultVcs                   = "git"
-	defaultBaseURL               = "{url}/blob/master/{path}{anchor}"
-	defaultBaseURLAzureDevops    = "{url}/?path=%2F{path}&version=GBmaster&line={anchor}"
-	defaultAnchor                = "#L{line}"
-	defaultHealthCheckURI        = "/healthz"
-	defaultAnchorAzureDevops     = "&line={line}"
+	defaultMsBetweenPoll           = 30000
+	defaultMaxConcurrentIndexers   = 2
+	defaultMaxMsBetweenRetries     = 6 * 60 * 60 * 1000
+	defaultCircuitBreakerThreshold = 5
+	defaultKeepGenerations         = 1
+	defaultPollJitter              = 0.1
+	defaultMaxMsBetweenPolls       = 30 * 60 * 1000
+	defaultMaxExcerptLineLength    = 2000
+	defaultMsIdleBeforeArchive     = 30 * 60 * 1000
+	defaultMaxResponseBytes        = 32 << 20
+	defaultPushEnabled             = false
+	defaultPollEnabled             = true
+	defaultTitle                   = "Hound"
+	defaultVcs                     = "git"
+	defaultBaseURL                 = "{url}/blob/{branch}/{path}{anchor}"
+	defaultBaseURLAzureDevops      = "{url}/?path=%2F{path}&version=GB{branch}{anchor}"
+	defaultAnchor                  = "#L{line}"
+	defaultHealthCheckURI          = "/healthz"
+	defaultAnchorAzureDevops       = "&line={line}"
+	defaultRangeAnchor             = "#L{start}-L{end}"
+	defaultRangeAnchorAzureDevops  = "&line={start}&lineEnd={end}&lineStartColumn={startcol}&lineEndColumn={endcol}"
+)
+
+// The content modes of a repo.
+const (
+	ContentModeCode = "code"
+	ContentModeDocs = "docs"
+)
+
+// The tiers of a repo: hot repos are always ready to search, and the
+// indexes of archived ones are compressed and closed while nobody
+// searches them.
+const (
+	TierHot     = "hot"
+	TierArchive = "archive"
 )
 
 //URLPattern ...
 type URLPattern struct {
 	BaseURL string `json:"base-url"`
 	Anchor  string `json:"anchor"`
+
+	// The anchor of a link to a range of lines, with {start} and {end}
+	// for the first and last lines and {startcol} and {endcol} for the
+	// columns, from 1, where the range starts and ends. Links to ranges
+	// use the anchor of the first line if this is empty.
+	RangeAnchor string `json:"range-anchor,omitempty"`
+
+	// The rendered page of a markdown file in a docs repo, with {page}
+	// for its path without the extension. Files are linked with base-url
+	// if this is empty.
+	PageURL string `json:"page-url,omitempty"`
+}
+
+// Resolve fills in the placeholders that can only be known on the server,
+// like {branch}. Placeholders that are not in vars are left as is for the
+// UI to expand.
+func (u *URLPattern) Resolve(vars map[string]string) {
+	for name, val := range vars {
+		ph := "{" + name + "}"
+		u.BaseURL = strings.Replace(u.BaseURL, ph, val, -1)
+		u.Anchor = strings.Replace(u.Anchor, ph, val, -1)
+		u.RangeAnchor = strings.Replace(u.RangeAnchor, ph, val, -1)
+		u.PageURL = strings.Replace(u.PageURL, ph, val, -1)
+	}
 }
 
 //Repo ...
@@ -38,6 +86,115 @@ type Repo struct {
 	ExcludeDotFiles   bool           `json:"exclude-dot-files"`
 	EnablePollUpdates *bool          `json:"enable-poll-updates"`
 	EnablePushUpdates *bool          `json:"enable-push-updates"`
+	Proxy             *Proxy         `json:"proxy,omitempty"`
+	InMemory          bool           `json:"in-memory"`
+
+	// Labels for picking out groups of repos in a search.
+	Tags []string `json:"tags,omitempty"`
+
+	// The users who can see how the repo is searched, by the names that
+	// user-header gives them or that their API tokens are known by.
+	Maintainers []string `json:"maintainers,omitempty"`
+
+	// Headers that a pushed update of the repo has to carry, with these
+	// values, to be accepted, like the X-Gitlab-Token or Authorization
+	// that the webhook of its server is set up to send.
+	PushHeaders SecretHeaders `json:"push-headers,omitempty"`
+
+	// The name of an environment variable with the secret of the push
+	// webhook of the repo. Pushes have to be signed with it when it is
+	// set, the way Gitea, Gogs and GitHub sign the payloads of webhooks.
+	PushSecretEnv string `json:"push-secret-env,omitempty"`
+
+	// After a failed update, the repo is retried with exponential backoff
+	// starting at the poll interval and going up to this. These default
+	// to the values in the config.
+	MaxMsBetweenRetries int `json:"max-ms-between-retries,omitempty"`
+
+	// The number of failures in a row after which the circuit for the
+	// repo opens: pushed updates are ignored and the remote is only tried
+	// every max-ms-between-retries until an update succeeds.
+	CircuitBreakerThreshold int `json:"circuit-breaker-threshold,omitempty"`
+
+	// Limits, in bytes per second, on how fast the repo is fetched over
+	// http(s) and how fast its index is written to disk. These apply on
+	// top of the limits in the config, which are shared by every repo.
+	MaxFetchBytesPerSec int64 `json:"max-fetch-bytes-per-sec,omitempty"`
+	MaxWriteBytesPerSec int64 `json:"max-write-bytes-per-sec,omitempty"`
+
+	// The number of indexes of the repo that are kept, counting the one
+	// being served, so that searches can ask for an earlier revision.
+	// This defaults to the value in the config.
+	KeepGenerations int `json:"keep-generations,omitempty"`
+
+	// How far apart in time the kept generations are: an index is only
+	// kept once it is replaced if it was built at least this long after
+	// the newest one already kept, so that keep-generations of them go
+	// back that many intervals, say days, rather than that many
+	// revisions. Zero keeps every revision.
+	MsBetweenGenerations int `json:"ms-between-generations,omitempty"`
+
+	// How much polls are spread out, as a fraction of the poll interval
+	// that each one is moved by at random, so that repos don't all poll
+	// at once. Adaptive polling lengthens the interval of a repo that
+	// hasn't changed in a while, up to max-ms-between-polls, and goes
+	// back to ms-between-poll once it changes. These default to the
+	// values in the config.
+	PollJitter        *float64 `json:"poll-jitter,omitempty"`
+	AdaptivePolling   *bool    `json:"adaptive-polling,omitempty"`
+	MaxMsBetweenPolls int      `json:"max-ms-between-polls,omitempty"`
+
+	// Skip the files that look generated or like data when indexing.
+	// These add to or override the file-filters of the config.
+	FileFilters *FileFilters `json:"file-filters,omitempty"`
+
+	// Index the text of the documents of the repo, like PDFs and Word
+	// files. This adds to or overrides the extraction of the config.
+	Extraction *Extraction `json:"extraction,omitempty"`
+
+	// Check each new index against the one it replaces before serving
+	// it. This adds to or overrides the canary of the config.
+	Canary *Canary `json:"canary,omitempty"`
+
+	// What the repo holds: "code", the default, or "docs" for wikis and
+	// other documentation, whose markdown files have their results shown
+	// as plain text and linked to their rendered pages with the page-url
+	// of the url-pattern.
+	ContentMode string `json:"content-mode,omitempty"`
+
+	// Whether only the sources of the code and markdown cells of Jupyter
+	// notebooks are indexed, rather than their JSON with its metadata and
+	// outputs. This is true unless it is set.
+	IndexNotebookCells *bool `json:"index-notebook-cells,omitempty"`
+
+	// Whether minified scripts and stylesheets, and their source maps,
+	// are left out of the index, which is true unless it is set. With
+	// index-source-maps, the original sources that the maps of minified
+	// files have the contents of are indexed in their place.
+	ExcludeMinified *bool `json:"exclude-minified,omitempty"`
+	IndexSourceMaps bool  `json:"index-source-maps,omitempty"`
+
+	// Records when each file last changed, from the history of the repo,
+	// so searches can be sorted and filtered by it. On by default for the
+	// vcs that can tell, which is git.
+	IndexCommitTimes *bool `json:"index-commit-times,omitempty"`
+
+	// Records who made the last commit of each file as well, so searches
+	// can be filtered by author.
+	IndexCommitAuthors bool `json:"index-commit-authors,omitempty"`
+
+	// The longest, in bytes, that a line of an excerpt of the results is
+	// before it is cut down, with markers for what was cut. This defaults
+	// to the value in the config, and a negative value keeps whole lines.
+	MaxExcerptLineLength int `json:"max-excerpt-line-length,omitempty"`
+
+	// The tier of the repo, "hot" by default or "archive" for one that is
+	// rarely searched. The index of an archived repo is compressed and
+	// closed once it hasn't been searched for ms-idle-before-archive,
+	// which defaults to the value in the config, and opened again by the
+	// next search of it.
+	Tier                string `json:"tier,omitempty"`
+	MsIdleBeforeArchive int    `json:"ms-idle-before-archive,omitempty"`
 }
 
 // Used for interpreting the config value for fields that use *bool. If a value
@@ -55,6 +212,41 @@ func (r *Repo) PollUpdatesEnabled() bool {
 	return optionToBool(r.EnablePollUpdates, defaultPollEnabled)
 }
 
+//AdaptivePollingEnabled ...
+// Does the poll interval of this repo adapt to how often it changes?
+func (r *Repo) AdaptivePollingEnabled() bool {
+	return optionToBool(r.AdaptivePolling, false)
+}
+
+// DocsMode reports whether the repo holds documentation rather than code.
+func (r *Repo) DocsMode() bool {
+	return r.ContentMode == ContentModeDocs
+}
+
+// Archived reports whether the index of the repo is archived while it isn't
+// searched.
+func (r *Repo) Archived() bool {
+	return r.Tier == TierArchive
+}
+
+// NotebookCellsIndexed reports whether only the cells of the notebooks of the
+// repo are indexed.
+func (r *Repo) NotebookCellsIndexed() bool {
+	return optionToBool(r.IndexNotebookCells, true)
+}
+
+// MinifiedExcluded reports whether the minified files of the repo are left
+// out of its index.
+func (r *Repo) MinifiedExcluded() bool {
+	return optionToBool(r.ExcludeMinified, true)
+}
+
+// CommitTimesIndexed reports whether the index of the repo records when each
+// of its files last changed.
+func (r *Repo) CommitTimesIndexed() bool {
+	return optionToBool(r.IndexCommitTimes, true)
+}
+
 //PushUpdatesEnabled ...
 // Are push based updates enabled on this repo?
 func (r *Repo) PushUpdatesEnabled() bool {
@@ -68,6 +260,126 @@ type Config struct {
 	Repos                 map[string]*Repo `json:"repos"`
 	MaxConcurrentIndexers int              `json:"max-concurrent-indexers"`
 	HealthCheckURI        string           `json:"health-check-uri"`
+	Proxy                 *Proxy           `json:"proxy,omitempty"`
+
+	// The path that hound is served under, like /hound when a reverse
+	// proxy sends it https://tools.corp/hound/. The UI, the API and the
+	// links that hound makes are all under it. Empty is the root.
+	BasePath string `json:"base-path"`
+
+	// The addresses that houndd serves on, each with its own TLS and
+	// timeouts. It serves on the -addr flag alone if there are none.
+	Listeners []*Listener `json:"listeners"`
+
+	// The most bytes of results that a search responds with. A search
+	// with more responds with the results that fit and a cursor to go on
+	// from.
+	MaxResponseBytes int `json:"max-response-bytes"`
+
+	// The most repos that there can be, counting those added while
+	// running, and how many requests to the API are handled at once,
+	// which turns away the rest with a 429. There is no limit on either
+	// unless it is set.
+	MaxRepos              int `json:"max-repos"`
+	MaxConcurrentRequests int `json:"max-concurrent-requests"`
+
+	// Teams or orgs, by name, that each have repos, indexes, API tokens
+	// and a UI of their own on this instance.
+	Tenants map[string]*Tenant `json:"tenants"`
+
+	// Where built indexes are published so other instances can load
+	// them instead of building their own. Empty keeps them local.
+	IndexStore              string         `json:"index-store"`
+	IndexStoreConfigMessage *SecretMessage `json:"index-store-config"`
+
+	// How replicas sharing an index store pick the one that indexes.
+	// Empty means every replica indexes for itself.
+	LeaderElection              string         `json:"leader-election"`
+	LeaderElectionConfigMessage *SecretMessage `json:"leader-election-config"`
+
+	// Other hound instances whose repos are searched along with ours.
+	Federation []*Downstream `json:"federation"`
+
+	// Code hosts whose repos are served along with those of the config.
+	Discovery []*Discovery `json:"discovery"`
+
+	// Required to reach the administrative endpoints, like /debug/. They
+	// are disabled if this is empty.
+	AdminToken string `json:"admin-token"`
+
+	// Tokens that clients have to present to use the API. The API is
+	// open to everyone if there are none.
+	APITokens []string `json:"api-tokens"`
+
+	// The header that a proxy in front of hound which authenticates users
+	// puts the name of the user in, like X-Forwarded-User. Users are told
+	// apart by their API token unless it is set. Only set it if every
+	// request comes through the proxy, since the header is believed.
+	UserHeader string `json:"user-header"`
+
+	// Webhooks that are told about indexing events.
+	Notifications []*Notification `json:"notifications"`
+
+	// The defaults for the backoff and circuit breaking of the repos.
+	MaxMsBetweenRetries     int `json:"max-ms-between-retries"`
+	CircuitBreakerThreshold int `json:"circuit-breaker-threshold"`
+
+	// Limits, in bytes per second, on the fetches and index writes of all
+	// the repos together. Zero means no limit.
+	MaxFetchBytesPerSec int64 `json:"max-fetch-bytes-per-sec"`
+	MaxWriteBytesPerSec int64 `json:"max-write-bytes-per-sec"`
+
+	// The default number of indexes kept for each repo. It is 1, just the
+	// one being served, unless it is set.
+	KeepGenerations int `json:"keep-generations"`
+
+	// The default spacing of the generations of each repo, which is none.
+	MsBetweenGenerations int `json:"ms-between-generations"`
+
+	// The default cap on the lines of excerpts, which is 2000 bytes
+	// unless it is set.
+	MaxExcerptLineLength int `json:"max-excerpt-line-length"`
+
+	// How long the archived repos go without a search before their
+	// indexes are archived, 30 minutes unless it is set.
+	MsIdleBeforeArchive int `json:"ms-idle-before-archive"`
+
+	// The defaults for the scheduling of the polls of the repos. Polls
+	// are moved by up to 10% of the interval unless poll-jitter is set,
+	// and adaptive polls wait for at most 30 minutes.
+	PollJitter        *float64 `json:"poll-jitter"`
+	AdaptivePolling   bool     `json:"adaptive-polling"`
+	MaxMsBetweenPolls int      `json:"max-ms-between-polls"`
+
+	// Skip the files of every repo that look generated or like data when
+	// indexing. Nothing is skipped for this unless it is set.
+	FileFilters *FileFilters `json:"file-filters"`
+
+	// Index the text of the documents of every repo, like PDFs and Word
+	// files. Nothing is extracted for this unless it is set.
+	Extraction *Extraction `json:"extraction"`
+
+	// Check each new index of every repo against the one it replaces
+	// before serving it. Nothing is checked for this unless it is set.
+	Canary *Canary `json:"canary"`
+
+	// The repos that are searched when a search doesn't say which. All of
+	// them are unless it is set.
+	DefaultScope *Scope `json:"default-scope"`
+
+	// The repos that the repo filter of the UI lists first, in order.
+	PinnedRepos []string `json:"pinned-repos"`
+
+	// Turns on semantic search, if it is set.
+	Embeddings *Embeddings `json:"embeddings"`
+
+	// Hooks that transform the results of searches, in order.
+	ResultHooks []*ResultHook `json:"result-hooks"`
+
+	// The url patterns of the repos on each host, by host name. A pattern
+	// for a domain applies to all of the hosts in it. Repos with a
+	// url-pattern of their own don't use these.
+	URLPatterns map[string]*URLPattern `json:"url-patterns"`
 }
 
 // SecretMessage is just like json.RawMessage but it will not
@@ -91,6 +403,17 @@ func (s *SecretMessage) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+//HasTag ...
+// Is the repo labelled with the given tag?
+func (r *Repo) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
 //VcsConfig ...
 // Get the JSON encode vcs-config for this repo. This returns nil if
 // the repo doesn't declare a vcs-config.
@@ -101,8 +424,28 @@ func (r *Repo) VcsConfig() []byte {
 	return *r.VcsConfigMessage
 }
 
-// Populate missing config values with default values.
-func initRepo(r *Repo) {
+// IndexStoreConfig gets the JSON encoded index-store-config. This returns nil
+// if the config doesn't declare one.
+func (c *Config) IndexStoreConfig() []byte {
+	if c.IndexStoreConfigMessage == nil {
+		return nil
+	}
+	return *c.IndexStoreConfigMessage
+}
+
+// LeaderElectionConfig gets the JSON encoded leader-election-config. This
+// returns nil if the config doesn't declare one.
+func (c *Config) LeaderElectionConfig() []byte {
+	if c.LeaderElectionConfigMessage == nil {
+		return nil
+	}
+	return *c.LeaderElectionConfigMessage
+}
+
+// Populate missing config values with default values. The url pattern
+// comes from patterns, by the host of the url of the repo, unless the repo
+// has its own.
+func initRepo(r *Repo, patterns map[string]*URLPattern) {
 	if r.MsBetweenPolls == 0 {
 		r.MsBetweenPolls = defaultMsBetweenPoll
 	}
@@ -111,27 +454,137 @@ func initRepo(r *Repo) {
 		r.Vcs = defaultVcs
 	}
 
+	def := urlPatternFor(r.URL, patterns)
 	if r.URLPattern == nil {
-		if strings.Contains(r.URL, "visualstudio.com") {
-			r.URLPattern = &URLPattern{
-				BaseURL: defaultBaseURLAzureDevops,
-				Anchor:  defaultAnchorAzureDevops,
-			}
-		} else {
-			r.URLPattern = &URLPattern{
-				BaseURL: defaultBaseURL,
-				Anchor:  defaultAnchor,
-			}
-		}
-
+		r.URLPattern = def
 	} else {
 		if r.URLPattern.BaseURL == "" {
-			r.URLPattern.BaseURL = defaultBaseURL
+			r.URLPattern.BaseURL = def.BaseURL
 		}
 
 		if r.URLPattern.Anchor == "" {
-			r.URLPattern.Anchor = defaultAnchor
+			r.URLPattern.Anchor = def.Anchor
+		}
+
+		// a range anchor of the host only goes with its own anchor.
+		if r.URLPattern.RangeAnchor == "" && r.URLPattern.Anchor == def.Anchor {
+			r.URLPattern.RangeAnchor = def.RangeAnchor
+		}
+	}
+
+	if r.URLPattern.BaseURL == "" {
+		r.URLPattern.BaseURL = defaultBaseURL
+	}
+	if r.URLPattern.Anchor == "" {
+		r.URLPattern.Anchor = defaultAnchor
+	}
+
+	// {organization} and {project} are known as soon as we have the url.
+	if isAzureDevOpsURL(r.URL) {
+		r.URLPattern.Resolve(azureDevOpsVars(r.URL))
+	}
+	if vars := bitbucketServerVars(r.URL); vars != nil {
+		r.URLPattern.Resolve(vars)
+	}
+}
+
+//InitRepo ...
+// Populate the missing values of a repo of this config with defaults. This
+// is done for every repo as the config is loaded, and has to be done for
+// repos that are added later.
+func (c *Config) InitRepo(r *Repo) {
+	initRepo(r, c.URLPatterns)
+
+	// repos without their own proxy settings use the global ones.
+	if r.Proxy == nil {
+		r.Proxy = c.Proxy
+	}
+
+	if r.MaxMsBetweenRetries == 0 {
+		r.MaxMsBetweenRetries = c.MaxMsBetweenRetries
+	}
+	if r.MaxMsBetweenRetries == 0 {
+		r.MaxMsBetweenRetries = defaultMaxMsBetweenRetries
+	}
+
+	if r.CircuitBreakerThreshold == 0 {
+		r.CircuitBreakerThreshold = c.CircuitBreakerThreshold
+	}
+	if r.CircuitBreakerThreshold == 0 {
+		r.CircuitBreakerThreshold = defaultCircuitBreakerThreshold
+	}
+
+	if r.KeepGenerations == 0 {
+		r.KeepGenerations = c.KeepGenerations
+	}
+	if r.KeepGenerations == 0 {
+		r.KeepGenerations = defaultKeepGenerations
+	}
+
+	if r.MsBetweenGenerations == 0 {
+		r.MsBetweenGenerations = c.MsBetweenGenerations
+	}
+
+	if r.MaxExcerptLineLength == 0 {
+		r.MaxExcerptLineLength = c.MaxExcerptLineLength
+	}
+	if r.MaxExcerptLineLength == 0 {
+		r.MaxExcerptLineLength = defaultMaxExcerptLineLength
+	}
+
+	if r.ContentMode == "" {
+		r.ContentMode = ContentModeCode
+	}
+
+	if r.Tier == "" {
+		r.Tier = TierHot
+	}
+	if r.MsIdleBeforeArchive == 0 {
+		r.MsIdleBeforeArchive = c.MsIdleBeforeArchive
+	}
+	if r.MsIdleBeforeArchive == 0 {
+		r.MsIdleBeforeArchive = defaultMsIdleBeforeArchive
+	}
+
+	if r.PollJitter == nil {
+		j := defaultPollJitter
+		if c.PollJitter != nil {
+			j = *c.PollJitter
 		}
+		r.PollJitter = &j
+	}
+
+	if r.AdaptivePolling == nil {
+		a := c.AdaptivePolling
+		r.AdaptivePolling = &a
+	}
+
+	if r.MaxMsBetweenPolls == 0 {
+		r.MaxMsBetweenPolls = c.MaxMsBetweenPolls
+	}
+	if r.MaxMsBetweenPolls == 0 {
+		r.MaxMsBetweenPolls = defaultMaxMsBetweenPolls
+	}
+
+	if r.FileFilters == nil && c.FileFilters != nil {
+		r.FileFilters = &FileFilters{}
+	}
+	if r.FileFilters != nil {
+		initFileFilters(r.FileFilters, c.FileFilters)
+	}
+
+	if r.Extraction == nil && c.Extraction != nil {
+		r.Extraction = &Extraction{}
+	}
+	if r.Extraction != nil {
+		initExtraction(r.Extraction, c.Extraction)
+	}
+
+	if r.Canary == nil && c.Canary != nil {
+		r.Canary = &Canary{}
+	}
+	if r.Canary != nil {
+		initCanary(r.Canary, c.Canary)
 	}
 }
 
@@ -144,6 +597,12 @@ func initConfig(c *Config) {
 	if c.HealthCheckURI == "" {
 		c.HealthCheckURI = defaultHealthCheckURI
 	}
+
+	if c.MaxResponseBytes == 0 {
+		c.MaxResponseBytes = defaultMaxResponseBytes
+	}
+
+	initBasePath(c)
 }
 
 //LoadFromFile ...
@@ -171,8 +630,38 @@ func (c *Config) LoadFromFile(filename string) error {
 		c.DbPath = path
 	}
 
+	initURLPatterns(c)
+
+	for _, d := range c.Discovery {
+		initDiscovery(c, d)
+	}
+
 	for _, repo := range c.Repos {
-		initRepo(repo)
+		c.InitRepo(repo)
+	}
+
+	for name, t := range c.Tenants {
+		initTenant(c, name, t)
+	}
+
+	for _, d := range c.Federation {
+		initDownstream(d)
+	}
+
+	for _, n := range c.Notifications {
+		initNotification(n)
+	}
+
+	if c.Embeddings != nil {
+		initEmbeddings(c.Embeddings)
+	}
+
+	for _, h := range c.ResultHooks {
+		initResultHook(h)
+	}
+
+	for _, l := range c.Listeners {
+		initListener(l)
 	}
 
 	initConfig(c)
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const defaultDiscoveryMsBetweenPolls = 10 * 60 * 1000
+
+// The kinds of code host that repos can be discovered on.
+const (
+	DiscoveryGitea           = "gitea"
+	DiscoveryGogs            = "gogs"
+	DiscoveryBitbucketServer = "bitbucket-server"
+)
+
+// The url patterns of the files of each kind of code host, which the
+// hosts of discoveries get unless url-patterns says otherwise.
+var hostURLPatterns = map[string]*URLPattern{
+	DiscoveryGitea: {
+		BaseURL:     "{url}/src/branch/{branch}/{path}{anchor}",
+		Anchor:      defaultAnchor,
+		RangeAnchor: defaultRangeAnchor,
+	},
+	DiscoveryGogs: {
+		BaseURL:     "{url}/src/{branch}/{path}{anchor}",
+		Anchor:      defaultAnchor,
+		RangeAnchor: defaultRangeAnchor,
+	},
+	DiscoveryBitbucketServer: bitbucketServerURLPattern,
+}
+
+// Discovery serves the repos of organizations on a code host, like a
+// Gitea server, along with those of the config. The host is asked for
+// them again every so often, so repos it gains are added and those it
+// loses are removed.
+type Discovery struct {
+	// The kind of host: gitea, gogs or bitbucket-server.
+	Type string `json:"type"`
+
+	// The url of the host, like https://git.example.com.
+	URL string `json:"url"`
+
+	// The organizations, or users, whose repos are served. These are the
+	// keys of the projects on Bitbucket Server, with ~ before the slug of
+	// a user.
+	Orgs []string `json:"orgs"`
+
+	// The name of an environment variable with a token for the api of
+	// the host. Repos cloned over http(s) use it too unless the repo
+	// config has a vcs-config of its own.
+	TokenEnv string `json:"token-env"`
+
+	// Extra headers to send the api.
+	HTTPHeaders map[string]string `json:"http-headers"`
+
+	// How long to wait between asking the host for the repos.
+	MsBetweenPolls int `json:"ms-between-polls"`
+
+	// Clone the repos over ssh rather than http(s).
+	SSH bool `json:"ssh"`
+
+	// Serve the archived repos as well.
+	IncludeArchived bool `json:"include-archived"`
+
+	// The config of each repo that is found, the same as a repo of the
+	// config without the url, which is filled in.
+	RepoConfig json.RawMessage `json:"repo"`
+}
+
+// Populate missing discovery values with default values, and give the
+// host the url pattern of its kind.
+func initDiscovery(c *Config, d *Discovery) {
+	d.Type = strings.ToLower(d.Type)
+	d.URL = strings.TrimSuffix(d.URL, "/")
+
+	if d.MsBetweenPolls == 0 {
+		d.MsBetweenPolls = defaultDiscoveryMsBetweenPolls
+	}
+
+	host, p := urlHost(d.URL), hostURLPatterns[d.Type]
+	if host == "" || p == nil || c.URLPatterns[host] != nil {
+		return
+	}
+	if c.URLPatterns == nil {
+		c.URLPatterns = map[string]*URLPattern{}
+	}
+	cp := *p
+	c.URLPatterns[host] = &cp
+}
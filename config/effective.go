@@ -0,0 +1,144 @@
+package config
+
+import (
+	"encoding/json"
+	"net/url"
+)
+
+// What secrets are replaced with in the effective config.
+const masked = "xxxxx"
+
+// Effective returns a copy of the config, with its defaults filled in, that
+// is safe to show to an operator: repos is the set of repos actually being
+// served, which includes the ones added while running, and the tokens, the
+// headers and the credentials in urls are masked. The vcs-config and other
+// SecretMessages are left out as they always are when marshalled, as is the
+// config of result hooks, which is free form.
+func (c *Config) Effective(repos map[string]*Repo) *Config {
+	e := *c
+
+	if e.AdminToken != "" {
+		e.AdminToken = masked
+	}
+	if len(e.APITokens) > 0 {
+		e.APITokens = make([]string, len(c.APITokens))
+		for i := range e.APITokens {
+			e.APITokens[i] = masked
+		}
+	}
+
+	e.Repos = make(map[string]*Repo, len(repos))
+	for name, r := range repos {
+		cp := *r
+		cp.URL = RedactURL(r.URL)
+		e.Repos[name] = &cp
+	}
+
+	e.Tenants = nil
+	for name, t := range c.Tenants {
+		if e.Tenants == nil {
+			e.Tenants = map[string]*Tenant{}
+		}
+
+		cp := *t
+		if len(cp.APITokens) > 0 {
+			cp.APITokens = make([]string, len(t.APITokens))
+			for i := range cp.APITokens {
+				cp.APITokens[i] = masked
+			}
+		}
+		cp.Repos = make(map[string]*Repo, len(t.Repos))
+		for n, r := range t.Repos {
+			rc := *r
+			rc.URL = RedactURL(r.URL)
+			cp.Repos[n] = &rc
+		}
+		e.Tenants[name] = &cp
+	}
+
+	e.Federation = nil
+	for _, d := range c.Federation {
+		cp := *d
+		cp.URL = RedactURL(d.URL)
+		cp.HTTPHeaders = maskHeaders(d.HTTPHeaders)
+		e.Federation = append(e.Federation, &cp)
+	}
+
+	// the config of the repos of a discovery has their vcs-config in it.
+	e.Discovery = nil
+	for _, d := range c.Discovery {
+		cp := *d
+		cp.URL = RedactURL(d.URL)
+		cp.HTTPHeaders = maskHeaders(d.HTTPHeaders)
+		if cp.RepoConfig != nil {
+			cp.RepoConfig = json.RawMessage("{}")
+		}
+		e.Discovery = append(e.Discovery, &cp)
+	}
+
+	e.Notifications = nil
+	for _, n := range c.Notifications {
+		cp := *n
+		cp.URL = RedactURL(n.URL)
+		cp.HTTPHeaders = maskHeaders(n.HTTPHeaders)
+		e.Notifications = append(e.Notifications, &cp)
+	}
+
+	if c.Embeddings != nil {
+		cp := *c.Embeddings
+		cp.URL = RedactURL(c.Embeddings.URL)
+		cp.HTTPHeaders = maskHeaders(c.Embeddings.HTTPHeaders)
+		e.Embeddings = &cp
+	}
+
+	e.ResultHooks = nil
+	for _, h := range c.ResultHooks {
+		cp := *h
+		cp.URL = RedactURL(h.URL)
+		cp.HTTPHeaders = maskHeaders(h.HTTPHeaders)
+		if cp.Config != nil {
+			cp.Config = json.RawMessage("{}")
+		}
+		e.ResultHooks = append(e.ResultHooks, &cp)
+	}
+
+	return &e
+}
+
+// Mask the values of headers, which are there for authentication more
+// often than not.
+func maskHeaders(h map[string]string) map[string]string {
+	if h == nil {
+		return nil
+	}
+
+	res := make(map[string]string, len(h))
+	for k := range h {
+		res[k] = masked
+	}
+	return res
+}
+
+// RedactURL masks the credentials of a url along with the values of its
+// query, where services like to put their keys, so that it is safe to log
+// or to show.
+func RedactURL(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" {
+		return uri
+	}
+
+	if u.User != nil {
+		u.User = url.User(masked)
+	}
+
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k := range q {
+			q.Set(k, masked)
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	return u.String()
+}
@@ -0,0 +1,50 @@
+package config
+
+const (
+	defaultEmbeddingDimensions = 512
+	defaultEmbeddingChunkLines = 40
+	defaultEmbeddingBatchSize  = 32
+)
+
+// Embeddings configures semantic search, which finds the chunks of code
+// whose embeddings are nearest to that of a query. It is experimental.
+type Embeddings struct {
+	// Where embeddings come from: local (the default), which hashes the
+	// words of the text and needs no service, or http, an embedding
+	// service with the API of OpenAI's /v1/embeddings.
+	Backend string `json:"backend"`
+
+	// The url and model of an http backend, and extra headers to send it,
+	// e.g. for authentication.
+	URL         string            `json:"url"`
+	Model       string            `json:"model"`
+	HTTPHeaders map[string]string `json:"http-headers"`
+
+	// The size of the vectors of the local backend.
+	Dimensions int `json:"dimensions"`
+
+	// The number of lines in each chunk of a file that gets an embedding.
+	ChunkLines int `json:"chunk-lines"`
+
+	// The number of chunks sent to the backend at once.
+	BatchSize int `json:"batch-size"`
+}
+
+// Populate missing embedding values with default values.
+func initEmbeddings(e *Embeddings) {
+	if e.Backend == "" {
+		e.Backend = "local"
+	}
+
+	if e.Dimensions == 0 {
+		e.Dimensions = defaultEmbeddingDimensions
+	}
+
+	if e.ChunkLines == 0 {
+		e.ChunkLines = defaultEmbeddingChunkLines
+	}
+
+	if e.BatchSize == 0 {
+		e.BatchSize = defaultEmbeddingBatchSize
+	}
+}
@@ -0,0 +1,60 @@
+package config
+
+const (
+	defaultExtractionMaxBytes  = 8 << 20
+	defaultExtractionTimeoutMs = 60 * 1000
+)
+
+// Extraction pulls the text out of documents that are committed to repos,
+// like specs in PDF and Word, and indexes it in their place so that they
+// can be searched. Nothing is extracted unless it is set.
+type Extraction struct {
+	// Whether the text of Word, Excel and PowerPoint files, .docx, .xlsx
+	// and .pptx, is extracted, which Hound does itself. This is true
+	// unless it is set.
+	Office *bool `json:"office"`
+
+	// Commands that write the text of a file to their output, by the
+	// extension of the files they are for, with {path} for the path of
+	// the file, like ["pdftotext", "-layout", "{path}", "-"] for ".pdf".
+	// They take the place of the built in ones.
+	Commands map[string][]string `json:"commands"`
+
+	// The most text taken from one file, in bytes. Files with more than
+	// this aren't indexed.
+	MaxBytes int64 `json:"max-bytes"`
+
+	// How long a command has to extract the text of one file.
+	TimeoutMs int `json:"timeout-ms"`
+}
+
+// Fill the fields of e that are not set from def, the extraction of the
+// config, and then from the defaults.
+func initExtraction(e, def *Extraction) {
+	if def == nil {
+		def = &Extraction{}
+	}
+
+	if e.Office == nil {
+		office := optionToBool(def.Office, true)
+		e.Office = &office
+	}
+
+	if e.Commands == nil {
+		e.Commands = def.Commands
+	}
+
+	if e.MaxBytes == 0 {
+		e.MaxBytes = def.MaxBytes
+	}
+	if e.MaxBytes == 0 {
+		e.MaxBytes = defaultExtractionMaxBytes
+	}
+
+	if e.TimeoutMs == 0 {
+		e.TimeoutMs = def.TimeoutMs
+	}
+	if e.TimeoutMs == 0 {
+		e.TimeoutMs = defaultExtractionTimeoutMs
+	}
+}
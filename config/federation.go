@@ -0,0 +1,31 @@
+package config
+
+import "time"
+
+const defaultDownstreamTimeoutMs = 5000
+
+// Downstream is another hound instance that a gateway fans searches out
+// to. Its repos show up on the gateway as <name>/<repo>.
+type Downstream struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+
+	// How long to wait for the instance before leaving its results out.
+	TimeoutMs int `json:"timeout-ms"`
+
+	// Extra headers to send, e.g. for an authenticating proxy in front
+	// of the instance.
+	HTTPHeaders map[string]string `json:"http-headers"`
+}
+
+// Timeout is the time to wait for a response from the instance.
+func (d *Downstream) Timeout() time.Duration {
+	return time.Duration(d.TimeoutMs) * time.Millisecond
+}
+
+// Populate missing downstream values with default values.
+func initDownstream(d *Downstream) {
+	if d.TimeoutMs == 0 {
+		d.TimeoutMs = defaultDownstreamTimeoutMs
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+const (
+	defaultMaxLineLength  = 10000
+	defaultMaxEntropy     = 5.8
+	defaultSizePercentile = 99
+	defaultSizeFactor     = 20
+	defaultMinFilterSize  = 1 << 20
+)
+
+// FileFilters skip the files of a repo that are most likely generated or
+// data rather than code, like bundles, minified files and blobs, so that
+// they don't take up the index and the results. Each check is on with its
+// default unless it is set, and a negative value turns it off.
+type FileFilters struct {
+	// Skip files with a line longer than this, in bytes.
+	MaxLineLength int `json:"max-line-length"`
+
+	// Skip files whose bytes have a Shannon entropy above this, in bits
+	// per byte. Code is usually below 5, base64 is close to 6.
+	MaxEntropy float64 `json:"max-entropy"`
+
+	// Skip files that are more than size-factor times the size of the
+	// size-percentile of the files of the repo, as long as they are also
+	// bigger than min-size, in bytes.
+	SizePercentile float64 `json:"size-percentile"`
+	SizeFactor     float64 `json:"size-factor"`
+	MinSize        int64   `json:"min-size"`
+
+	// Skip the lock files of package managers, like package-lock.json
+	// and go.sum.
+	SkipLockfiles *bool `json:"skip-lockfiles"`
+
+	// Globs of the files that are indexed whatever the checks say,
+	// matched against the path in the repo and against the name.
+	Include []string `json:"include"`
+}
+
+// Fill the fields of f that are not set from def, the filters of the
+// config, and then from the defaults.
+func initFileFilters(f, def *FileFilters) {
+	if def == nil {
+		def = &FileFilters{}
+	}
+
+	if f.MaxLineLength == 0 {
+		f.MaxLineLength = def.MaxLineLength
+	}
+	if f.MaxLineLength == 0 {
+		f.MaxLineLength = defaultMaxLineLength
+	}
+
+	if f.MaxEntropy == 0 {
+		f.MaxEntropy = def.MaxEntropy
+	}
+	if f.MaxEntropy == 0 {
+		f.MaxEntropy = defaultMaxEntropy
+	}
+
+	if f.SizePercentile == 0 {
+		f.SizePercentile = def.SizePercentile
+	}
+	if f.SizePercentile == 0 {
+		f.SizePercentile = defaultSizePercentile
+	}
+
+	if f.SizeFactor == 0 {
+		f.SizeFactor = def.SizeFactor
+	}
+	if f.SizeFactor == 0 {
+		f.SizeFactor = defaultSizeFactor
+	}
+
+	if f.MinSize == 0 {
+		f.MinSize = def.MinSize
+	}
+	if f.MinSize == 0 {
+		f.MinSize = defaultMinFilterSize
+	}
+
+	if f.SkipLockfiles == nil {
+		skip := optionToBool(def.SkipLockfiles, true)
+		f.SkipLockfiles = &skip
+	}
+
+	if f.Include == nil {
+		f.Include = def.Include
+	}
+}
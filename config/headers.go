@@ -0,0 +1,29 @@
+package config
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+)
+
+// SecretHeaders are http headers whose values are secrets, like tokens.
+// Their values are masked when they are marshalled, so that they aren't
+// sent to the UI along with the rest of the repo.
+type SecretHeaders map[string]string
+
+// MarshalJSON marshals the names of the headers with masked values.
+func (h SecretHeaders) MarshalJSON() ([]byte, error) {
+	return json.Marshal(maskHeaders(h))
+}
+
+// Match reports whether the request has every one of the headers, with its
+// value.
+func (h SecretHeaders) Match(r *http.Request) bool {
+	for key, val := range h {
+		got := r.Header.Get(key)
+		if subtle.ConstantTimeCompare([]byte(got), []byte(val)) != 1 {
+			return false
+		}
+	}
+	return true
+}
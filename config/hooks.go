@@ -0,0 +1,47 @@
+package config
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const defaultHookTimeoutMs = 2000
+
+// ResultHook transforms the responses of searches before they are sent,
+// e.g. to redact them or to add to them.
+type ResultHook struct {
+	// The kind of hook: http, which posts the response to a service
+	// that sends it back changed, plugin, a Go plugin, or a kind that
+	// was registered with the hooks package.
+	Type string `json:"type"`
+
+	// The url of an http hook, and extra headers to send it.
+	URL         string            `json:"url"`
+	HTTPHeaders map[string]string `json:"http-headers"`
+
+	// The file of a Go plugin.
+	Path string `json:"path"`
+
+	// The config of a plugin or a registered kind, in whatever form it
+	// takes.
+	Config json.RawMessage `json:"config"`
+
+	// How long to wait for an http hook.
+	TimeoutMs int `json:"timeout-ms"`
+
+	// Whether to send the response unchanged when the hook fails, rather
+	// than failing the search.
+	FailOpen bool `json:"fail-open"`
+}
+
+// Timeout is the time to wait for an http hook.
+func (h *ResultHook) Timeout() time.Duration {
+	return time.Duration(h.TimeoutMs) * time.Millisecond
+}
+
+// Populate missing hook values with default values.
+func initResultHook(h *ResultHook) {
+	if h.TimeoutMs == 0 {
+		h.TimeoutMs = defaultHookTimeoutMs
+	}
+}
@@ -0,0 +1,67 @@
+package config
+
+import "time"
+
+// The networks that a listener can be on. NetworkTCP is whatever the
+// system does for the address, which for one without a host is usually
+// IPv4 and IPv6 on one socket. NetworkTCP4 and NetworkTCP6 are only one
+// of them, and NetworkDual is an IPv4 and an IPv6 socket on the same
+// port, for the systems that don't take both on one.
+const (
+	NetworkTCP  = "tcp"
+	NetworkTCP4 = "tcp4"
+	NetworkTCP6 = "tcp6"
+	NetworkDual = "dual"
+)
+
+// Listener is an address that houndd serves on.
+type Listener struct {
+	Addr    string `json:"addr"`
+	Network string `json:"network"`
+
+	// The files of the certificate and key that the listener serves TLS
+	// with. It serves plain HTTP if they aren't set.
+	TLSCert string `json:"tls-cert"`
+	TLSKey  string `json:"tls-key"`
+
+	// Only answers the health check, for a listener that is there for a
+	// load balancer.
+	HealthCheckOnly bool `json:"health-check-only"`
+
+	// How long reading a request, writing its response and waiting for
+	// the next request of a connection that is kept alive can each take.
+	// There is no limit on those that aren't set, except that waiting
+	// for the next request is limited by the read timeout then.
+	MsReadTimeout  int `json:"ms-read-timeout"`
+	MsWriteTimeout int `json:"ms-write-timeout"`
+	MsIdleTimeout  int `json:"ms-idle-timeout"`
+}
+
+// TLS reports whether the listener serves TLS.
+func (l *Listener) TLS() bool {
+	return l.TLSCert != "" || l.TLSKey != ""
+}
+
+// ReadTimeout is the time that reading a request can take, or 0 for no limit.
+func (l *Listener) ReadTimeout() time.Duration {
+	return time.Duration(l.MsReadTimeout) * time.Millisecond
+}
+
+// WriteTimeout is the time that writing a response can take, or 0 for no
+// limit.
+func (l *Listener) WriteTimeout() time.Duration {
+	return time.Duration(l.MsWriteTimeout) * time.Millisecond
+}
+
+// IdleTimeout is the time that a connection that is kept alive waits for its
+// next request, or 0 for the read timeout.
+func (l *Listener) IdleTimeout() time.Duration {
+	return time.Duration(l.MsIdleTimeout) * time.Millisecond
+}
+
+// Populate missing listener values with default values.
+func initListener(l *Listener) {
+	if l.Network == "" {
+		l.Network = NetworkTCP
+	}
+}
@@ -0,0 +1,37 @@
+package config
+
+const defaultNotifyFailures = 3
+
+// Notification is an outbound webhook that is called when things happen
+// to the repos, like an index being rebuilt or failing.
+type Notification struct {
+	URL string `json:"url"`
+
+	// How the payload is shaped: json (the default), slack or teams.
+	Format string `json:"format"`
+
+	// The events to send, all of them if this is empty.
+	Events []string `json:"events"`
+
+	// A text/template for the payload that replaces the default one. For
+	// slack and teams it is the text of the message.
+	Template string `json:"template"`
+
+	// Extra headers to send, e.g. for authentication.
+	HTTPHeaders map[string]string `json:"http-headers"`
+
+	// The number of failures in a row of a repo that is worth telling
+	// anyone about.
+	Failures int `json:"failures"`
+}
+
+// Populate missing notification values with default values.
+func initNotification(n *Notification) {
+	if n.Format == "" {
+		n.Format = "json"
+	}
+
+	if n.Failures == 0 {
+		n.Failures = defaultNotifyFailures
+	}
+}
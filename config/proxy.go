@@ -0,0 +1,111 @@
+package config
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Proxy describes the outbound proxy to use for network operations. Any
+// field that is left empty falls back to the HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY environment variables of the daemon.
+type Proxy struct {
+	HTTPProxy  string `json:"http-proxy"`
+	HTTPSProxy string `json:"https-proxy"`
+	NoProxy    string `json:"no-proxy"`
+}
+
+// MarshalJSON masks the credentials that proxy urls may carry before the
+// config is sent to the UI.
+func (p *Proxy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"http-proxy":  RedactURL(p.HTTPProxy),
+		"https-proxy": RedactURL(p.HTTPSProxy),
+		"no-proxy":    p.NoProxy,
+	})
+}
+
+// Env returns the environment variables that apply these settings to child
+// processes like git and hg. Both spellings are set since tools disagree on
+// which one they honor.
+func (p *Proxy) Env() []string {
+	if p == nil {
+		return nil
+	}
+
+	var env []string
+	add := func(name, val string) {
+		if val == "" {
+			return
+		}
+		env = append(env,
+			strings.ToUpper(name)+"="+val,
+			strings.ToLower(name)+"="+val)
+	}
+
+	add("http_proxy", p.HTTPProxy)
+	add("https_proxy", p.HTTPSProxy)
+	add("no_proxy", p.NoProxy)
+	return env
+}
+
+// Determine if the host should be contacted directly according to the
+// comma separated list of hosts and domains in noProxy.
+func bypassProxy(noProxy, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	for _, p := range strings.Split(noProxy, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+
+		// like curl, a leading dot is optional and matches the domain
+		// itself as well as any of its subdomains.
+		p = strings.TrimPrefix(p, ".")
+		if p == "*" || p == host || strings.HasSuffix(host, "."+p) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProxyFunc returns a proxy function for http.Transport that honors these
+// settings. A nil Proxy behaves like http.ProxyFromEnvironment.
+func (p *Proxy) ProxyFunc() func(*http.Request) (*url.URL, error) {
+	if p == nil || (p.HTTPProxy == "" && p.HTTPSProxy == "") {
+		return http.ProxyFromEnvironment
+	}
+
+	return func(r *http.Request) (*url.URL, error) {
+		if p.NoProxy != "" && bypassProxy(p.NoProxy, r.URL.Host) {
+			return nil, nil
+		}
+
+		proxy := p.HTTPProxy
+		if r.URL.Scheme == "https" && p.HTTPSProxy != "" {
+			proxy = p.HTTPSProxy
+		}
+
+		if proxy == "" {
+			return http.ProxyFromEnvironment(r)
+		}
+
+		return url.Parse(proxy)
+	}
+}
+
+// Client returns an http.Client whose traffic is routed through these proxy
+// settings.
+func (p *Proxy) Client() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: p.ProxyFunc(),
+		},
+	}
+}
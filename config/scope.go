@@ -0,0 +1,70 @@
+package config
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Scope is the repos that are searched when a search doesn't say which,
+// so that a new user of an instance with many repos starts out with the
+// ones that most people search.
+type Scope struct {
+	// The repos that are searched, along with the repos that have any of
+	// the tags.
+	Repos []string `json:"repos"`
+	Tags  []string `json:"tags"`
+}
+
+// InDefaultScope reports whether the repo with a name is searched by the
+// searches that don't say which repos to search. All the repos are unless
+// there is a default scope.
+func (c *Config) InDefaultScope(name string, r *Repo) bool {
+	s := c.DefaultScope
+	if s == nil || (len(s.Repos) == 0 && len(s.Tags) == 0) {
+		return true
+	}
+
+	for _, n := range s.Repos {
+		if n == name {
+			return true
+		}
+	}
+	for _, t := range s.Tags {
+		if r.HasTag(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultRepos is the names of the repos of the config in the default
+// scope, in order, or nil if there is no default scope.
+func (c *Config) DefaultRepos() []string {
+	s := c.DefaultScope
+	if s == nil || (len(s.Repos) == 0 && len(s.Tags) == 0) {
+		return nil
+	}
+
+	names := []string{}
+	for name, r := range c.Repos {
+		if c.InDefaultScope(name, r) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ScopeToJSONString has the repos of the default scope and the pinned
+// repos, for the UI.
+func (c *Config) ScopeToJSONString() (string, error) {
+	b, err := json.Marshal(map[string][]string{
+		"Default": c.DefaultRepos(),
+		"Pinned":  c.PinnedRepos,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// The directory of the dbpath that the dbpath of each tenant is in.
+const tenantsDirname = "tenants"
+
+// TenantPrefix is the path under the base path that each tenant is served
+// under, followed by its name.
+const TenantPrefix = "/t/"
+
+// The names of tenants, which are in paths of both urls and the dbpath.
+var validTenantName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Tenant is a team or org that has what amounts to a hound of its own
+// within a houndd that serves many of them: repos whose names are its own,
+// indexes in a dbpath of its own, API tokens of its own and a UI of its
+// own under /t/<name>/ with its own scope.
+type Tenant struct {
+	// The title of its UI, which is the title of the instance and the
+	// name of the tenant unless it is set.
+	Title string           `json:"title"`
+	Repos map[string]*Repo `json:"repos"`
+
+	// Tokens that clients have to present to use the API of the tenant.
+	// Those of the instance don't work for it, and its API is open to
+	// everyone if there are none.
+	APITokens []string `json:"api-tokens"`
+
+	// The scope and the pinned repos of its UI, which are of its repos.
+	DefaultScope *Scope   `json:"default-scope"`
+	PinnedRepos  []string `json:"pinned-repos"`
+
+	// The quotas of the tenant: the most repos it can have, how many of
+	// them are indexed at once, which is the max-concurrent-indexers of
+	// the instance unless it is set, and how many requests to its API are
+	// handled at once. There is no limit on repos or requests unless it
+	// is set.
+	MaxRepos              int `json:"max-repos"`
+	MaxConcurrentIndexers int `json:"max-concurrent-indexers"`
+	MaxConcurrentRequests int `json:"max-concurrent-requests"`
+}
+
+// Populate missing tenant values with default values.
+func initTenant(c *Config, name string, t *Tenant) {
+	if t.Title == "" {
+		t.Title = fmt.Sprintf("%s - %s", c.Title, name)
+	}
+
+	if t.Repos == nil {
+		t.Repos = map[string]*Repo{}
+	}
+	for _, repo := range t.Repos {
+		c.InitRepo(repo)
+	}
+}
+
+// TenantNames returns the names of the tenants, in order.
+func (c *Config) TenantNames() []string {
+	names := make([]string, 0, len(c.Tenants))
+	for name := range c.Tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ForTenant is the config of the hound of a tenant: that of the instance,
+// but with the repos, tokens, scope and quotas of the tenant, and with its
+// dbpath and base path under those of the instance. The discovery, the
+// federation and the listeners are those of the instance alone.
+func (c *Config) ForTenant(name string) (*Config, error) {
+	t := c.Tenants[name]
+	if t == nil {
+		return nil, fmt.Errorf("there is no tenant %s", name)
+	}
+
+	if !validTenantName.MatchString(name) {
+		return nil, fmt.Errorf("the name of tenant %q can only have letters, digits, dots, dashes and underscores", name)
+	}
+
+	if t.MaxRepos > 0 && len(t.Repos) > t.MaxRepos {
+		return nil, fmt.Errorf("tenant %s has %d repos, more than its max-repos of %d", name, len(t.Repos), t.MaxRepos)
+	}
+
+	tc := *c
+	tc.Tenants = nil
+	tc.Title = t.Title
+	tc.Repos = t.Repos
+	tc.DbPath = filepath.Join(c.DbPath, tenantsDirname, name)
+	tc.BasePath = c.BasePath + TenantPrefix + name
+	tc.APITokens = t.APITokens
+	tc.DefaultScope = t.DefaultScope
+	tc.PinnedRepos = t.PinnedRepos
+	tc.MaxRepos = t.MaxRepos
+	tc.MaxConcurrentRequests = t.MaxConcurrentRequests
+	if t.MaxConcurrentIndexers > 0 {
+		tc.MaxConcurrentIndexers = t.MaxConcurrentIndexers
+	}
+
+	tc.Discovery = nil
+	tc.Federation = nil
+	tc.Listeners = nil
+
+	return &tc, nil
+}
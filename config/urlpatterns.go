@@ -0,0 +1,124 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+)
+
+// The url patterns of the well known hosts, which the url-patterns of the
+// config add to or override.
+var defaultURLPatterns = map[string]*URLPattern{
+	"github.com": {
+		BaseURL:     defaultBaseURL,
+		Anchor:      defaultAnchor,
+		RangeAnchor: defaultRangeAnchor,
+	},
+	"gitlab.com": {
+		BaseURL:     "{url}/-/blob/{branch}/{path}{anchor}",
+		Anchor:      defaultAnchor,
+		RangeAnchor: "#L{start}-{end}",
+	},
+	"bitbucket.org": {
+		BaseURL:     "{url}/src/{branch}/{path}{anchor}",
+		Anchor:      "#lines-{line}",
+		RangeAnchor: "#lines-{start}:{end}",
+	},
+	"gitea.com":    hostURLPatterns[DiscoveryGitea],
+	"codeberg.org": hostURLPatterns[DiscoveryGitea],
+	"dev.azure.com": {
+		BaseURL:     defaultBaseURLAzureDevops,
+		Anchor:      defaultAnchorAzureDevops,
+		RangeAnchor: defaultRangeAnchorAzureDevops,
+	},
+	"visualstudio.com": {
+		BaseURL:     defaultBaseURLAzureDevops,
+		Anchor:      defaultAnchorAzureDevops,
+		RangeAnchor: defaultRangeAnchorAzureDevops,
+	},
+}
+
+// Find the lower case host name of a clone url, which may be a regular
+// url or an scp style ssh one like git@github.com:org/repo.git. It returns
+// "" if there is no host.
+func urlHost(raw string) string {
+	if !strings.Contains(raw, "://") {
+		// scp style ssh urls
+		i := strings.Index(raw, ":")
+		if i < 0 {
+			return ""
+		}
+		host := raw[:i]
+		if j := strings.LastIndex(host, "@"); j >= 0 {
+			host = host[j+1:]
+		}
+		return strings.ToLower(host)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// Return the host and the domains it is in, the most specific first, so
+// api.acme.visualstudio.com gives itself, acme.visualstudio.com,
+// visualstudio.com and com.
+func hostAndParents(host string) []string {
+	var res []string
+	for host != "" {
+		res = append(res, host)
+		i := strings.Index(host, ".")
+		if i < 0 {
+			break
+		}
+		host = host[i+1:]
+	}
+	return res
+}
+
+// Pick the url pattern for a clone url by its host. A pattern for a domain
+// also applies to the hosts in it, the patterns of the config win over the
+// built in ones for the same host, and hosts that are not known get the
+// Bitbucket Server pattern if the url is of one and the GitHub style
+// default otherwise. The result is a copy that can be changed.
+func urlPatternFor(raw string, patterns map[string]*URLPattern) *URLPattern {
+	for _, h := range hostAndParents(urlHost(raw)) {
+		if p := patterns[h]; p != nil {
+			cp := *p
+			return &cp
+		}
+		if p := defaultURLPatterns[h]; p != nil {
+			cp := *p
+			return &cp
+		}
+	}
+
+	// Bitbucket Server is self hosted, so it is told by its urls.
+	if isBitbucketServerURL(raw) {
+		cp := *bitbucketServerURLPattern
+		return &cp
+	}
+
+	return &URLPattern{
+		BaseURL:     defaultBaseURL,
+		Anchor:      defaultAnchor,
+		RangeAnchor: defaultRangeAnchor,
+	}
+}
+
+// Host names are not case sensitive, so the keys of url-patterns aren't
+// either.
+func initURLPatterns(c *Config) {
+	if len(c.URLPatterns) == 0 {
+		return
+	}
+
+	patterns := make(map[string]*URLPattern, len(c.URLPatterns))
+	for h, p := range c.URLPatterns {
+		if p != nil {
+			patterns[strings.ToLower(h)] = p
+		}
+	}
+	c.URLPatterns = patterns
+}
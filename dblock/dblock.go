@@ -0,0 +1,105 @@
+// Package dblock keeps two houndd processes from using the same dbpath,
+// where they would delete and overwrite each other's indexes.
+package dblock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The file in a dbpath that is locked while a houndd uses it.
+const lockFilename = "hound.lock"
+
+// The error of lockFile for a file that another process has locked.
+var errLocked = errors.New("dblock: the lock is held")
+
+// Holder is the process that holds the lock of a dbpath, as it wrote
+// itself into the lock file.
+type Holder struct {
+	PID     int
+	Host    string
+	Started time.Time
+}
+
+func (h *Holder) String() string {
+	return fmt.Sprintf("pid %d on %s, since %s", h.PID, h.Host, h.Started.Format(time.RFC3339))
+}
+
+// LockedError is the error of a dbpath that another process holds the
+// lock of.
+type LockedError struct {
+	Dir string
+
+	// Who holds it, if the lock file could be read.
+	Holder *Holder
+}
+
+func (e *LockedError) Error() string {
+	if e.Holder == nil {
+		return fmt.Sprintf("%s is in use by another houndd", e.Dir)
+	}
+	return fmt.Sprintf("%s is in use by another houndd (%s)", e.Dir, e.Holder)
+}
+
+// Lock is the lock of a dbpath, which is held until it is released or
+// the process exits, however it exits.
+type Lock struct {
+	f *os.File
+}
+
+// Acquire locks the dbpath dir for this process, or returns a
+// *LockedError if another process has it.
+func Acquire(dir string) (*Lock, error) {
+	path := filepath.Join(dir, lockFilename)
+	f, err := lockFile(path)
+	if err == errLocked {
+		h, _ := ReadHolder(dir)
+		return nil, &LockedError{Dir: dir, Holder: h}
+	} else if err != nil {
+		return nil, err
+	}
+
+	host, _ := os.Hostname()
+	b, err := json.Marshal(&Holder{PID: os.Getpid(), Host: host, Started: time.Now()})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.WriteAt(b, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &Lock{f: f}, nil
+}
+
+// Release gives up the lock.
+func (l *Lock) Release() error {
+	return l.f.Close()
+}
+
+// ReadHolder reads who holds, or last held, the lock of the dbpath dir. It
+// is nil if no process ever did.
+func ReadHolder(dir string) (*Holder, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, lockFilename))
+	if os.IsNotExist(err) || (err == nil && len(b) == 0) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var h Holder
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
@@ -0,0 +1,41 @@
+package dblock
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestAcquire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dblock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := Acquire(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second one is told who has it.
+	_, err = Acquire(dir)
+	var le *LockedError
+	if !errors.As(err, &le) {
+		t.Fatalf("expected the dbpath to be locked, got %v", err)
+	}
+	if le.Holder == nil || le.Holder.PID != os.Getpid() {
+		t.Fatalf("expected this process to hold the lock, got %+v", le.Holder)
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = Acquire(dir)
+	if err != nil {
+		t.Fatalf("expected the released lock to be taken, got %s", err)
+	}
+	l.Release()
+}
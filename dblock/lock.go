@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package dblock
+
+import (
+	"os"
+	"syscall"
+)
+
+// Open the file at path and take an advisory lock of it, which the
+// kernel drops when the process exits.
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
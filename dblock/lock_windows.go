@@ -0,0 +1,32 @@
+package dblock
+
+import (
+	"os"
+	"syscall"
+)
+
+const errorSharingViolation syscall.Errno = 32
+
+// Open the file at path so that no other process can write to it until
+// this one closes it or exits. Others can still read it, to tell who has
+// it.
+func lockFile(path string) (*os.File, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := syscall.CreateFile(p,
+		syscall.GENERIC_READ|syscall.GENERIC_WRITE,
+		syscall.FILE_SHARE_READ,
+		nil,
+		syscall.OPEN_ALWAYS,
+		syscall.FILE_ATTRIBUTE_NORMAL,
+		0)
+	if err == errorSharingViolation {
+		return nil, errLocked
+	} else if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
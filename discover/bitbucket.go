@@ -0,0 +1,86 @@
+package discover
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hound-search/hound/config"
+)
+
+// The number of repos asked for in each page of a listing.
+const bitbucketPageSize = 100
+
+func init() {
+	register(newBitbucketServer, config.DiscoveryBitbucketServer)
+}
+
+// Lists the repos of a project through the REST api of Bitbucket Server,
+// or those of a user for a key like ~jdoe.
+type bitbucketServer struct {
+	cfg    *config.Discovery
+	client *http.Client
+}
+
+type bitbucketPage struct {
+	Values []struct {
+		Slug    string `json:"slug"`
+		Project struct {
+			Key string `json:"key"`
+		} `json:"project"`
+		Archived bool `json:"archived"`
+		Links    struct {
+			Clone []struct {
+				Href string `json:"href"`
+				Name string `json:"name"`
+			} `json:"clone"`
+		} `json:"links"`
+	} `json:"values"`
+	IsLastPage    bool `json:"isLastPage"`
+	NextPageStart int  `json:"nextPageStart"`
+}
+
+func newBitbucketServer(d *config.Discovery, client *http.Client) lister {
+	return &bitbucketServer{cfg: d, client: client}
+}
+
+func (b *bitbucketServer) list(key string) ([]*Repo, error) {
+	u := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos", b.cfg.URL, url.PathEscape(key))
+	if strings.HasPrefix(key, "~") {
+		u = fmt.Sprintf("%s/rest/api/1.0/users/%s/repos", b.cfg.URL, url.PathEscape(key[1:]))
+	}
+
+	var res []*Repo
+	for start := 0; ; {
+		var page bitbucketPage
+		if err := getJSON(b.client, b.cfg, "Bearer", fmt.Sprintf("%s?start=%d&limit=%d", u, start, bitbucketPageSize), &page); err != nil {
+			return nil, err
+		}
+
+		for _, v := range page.Values {
+			r := &Repo{
+				Name:     v.Project.Key + "/" + v.Slug,
+				Archived: v.Archived,
+			}
+			for _, l := range v.Links.Clone {
+				switch l.Name {
+				case "http":
+					// the url has the user of the token in it.
+					if cu, err := url.Parse(l.Href); err == nil {
+						cu.User = nil
+						r.CloneURL = cu.String()
+					}
+				case "ssh":
+					r.SSHURL = l.Href
+				}
+			}
+			res = append(res, r)
+		}
+
+		if page.IsLastPage || page.NextPageStart <= start {
+			return res, nil
+		}
+		start = page.NextPageStart
+	}
+}
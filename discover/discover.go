@@ -0,0 +1,253 @@
+// Package discover serves the repos of organizations on code hosts, like
+// Gitea, asking the hosts for them every so often so that new repos are
+// added and the ones that go away are removed.
+package discover
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/hound-search/hound/config"
+)
+
+const apiTimeout = 30 * time.Second
+
+// Repo is a repo that a host has.
+type Repo struct {
+	// The name of the repo including its org, like acme/api.
+	Name string
+
+	CloneURL string
+	SSHURL   string
+
+	// Archived repos are read only, and empty ones have nothing to index.
+	Archived bool
+	Empty    bool
+}
+
+// A host that can list the repos of an org.
+type lister interface {
+	list(org string) ([]*Repo, error)
+}
+
+type newLister func(d *config.Discovery, client *http.Client) lister
+
+var listers = map[string]newLister{}
+
+func register(l newLister, kinds ...string) {
+	for _, kind := range kinds {
+		listers[kind] = l
+	}
+}
+
+// The repos being served, which searcher.Set is.
+type repoSet interface {
+	Repos() map[string]*config.Repo
+	Add(name string, repo *config.Repo) error
+	Remove(name string) error
+}
+
+// A discovery and the repos that it added.
+type discoverer struct {
+	cfg *config.Discovery
+	l   lister
+	set repoSet
+
+	added map[string]bool
+}
+
+// Start checks the discoveries of the config and serves the repos they
+// find in set, looking for them once now and then again every
+// ms-between-polls.
+func Start(cfg *config.Config, set repoSet) error {
+	var ds []*discoverer
+	for _, d := range cfg.Discovery {
+		disc, err := newDiscoverer(d, cfg.Proxy, set)
+		if err != nil {
+			return err
+		}
+		ds = append(ds, disc)
+	}
+
+	for _, d := range ds {
+		go d.run()
+	}
+	return nil
+}
+
+func newDiscoverer(d *config.Discovery, proxy *config.Proxy, set repoSet) (*discoverer, error) {
+	nl := listers[d.Type]
+	if nl == nil {
+		return nil, fmt.Errorf("discover: unknown type of host %q", d.Type)
+	}
+	if d.URL == "" || len(d.Orgs) == 0 {
+		return nil, fmt.Errorf("discover: the %s discovery needs a url and orgs", d.Type)
+	}
+
+	client := proxy.Client()
+	client.Timeout = apiTimeout
+
+	disc := &discoverer{
+		cfg:   d,
+		l:     nl(d, client),
+		set:   set,
+		added: map[string]bool{},
+	}
+
+	// the config of the repos is checked once, rather than for each one.
+	if _, err := disc.repoConfig(); err != nil {
+		return nil, fmt.Errorf("discover: the repo config of %s: %s", d.URL, err)
+	}
+	return disc, nil
+}
+
+func (d *discoverer) run() {
+	for {
+		if err := d.sync(); err != nil {
+			log.Printf("failed to discover the repos of %s: %s", d.cfg.URL, err)
+		}
+		time.Sleep(time.Duration(d.cfg.MsBetweenPolls) * time.Millisecond)
+	}
+}
+
+// A new config of a repo from the config of the discovery.
+func (d *discoverer) repoConfig() (*config.Repo, error) {
+	var repo config.Repo
+	if d.cfg.RepoConfig != nil {
+		if err := json.Unmarshal(d.cfg.RepoConfig, &repo); err != nil {
+			return nil, err
+		}
+	}
+
+	// the token of the api clones over http(s) as well.
+	if repo.VcsConfigMessage == nil && d.cfg.TokenEnv != "" && !d.cfg.SSH {
+		b, err := json.Marshal(map[string]string{"pat-env": d.cfg.TokenEnv})
+		if err != nil {
+			return nil, err
+		}
+		msg := config.SecretMessage(b)
+		repo.VcsConfigMessage = &msg
+	}
+	return &repo, nil
+}
+
+// Ask the host for the repos of the orgs, add the ones that aren't being
+// served and remove the ones it added that the host no longer has. Repos
+// are only removed once every org could be listed, so a host that is down
+// doesn't lose its repos.
+func (d *discoverer) sync() error {
+	found := map[string]*Repo{}
+	var failed error
+	for _, org := range d.cfg.Orgs {
+		repos, err := d.l.list(org)
+		if err != nil {
+			failed = fmt.Errorf("org %s: %s", org, err)
+			continue
+		}
+
+		for _, r := range repos {
+			if r.Empty || (r.Archived && !d.cfg.IncludeArchived) {
+				continue
+			}
+			found[r.Name] = r
+		}
+	}
+
+	serving := d.set.Repos()
+	for name, r := range found {
+		if serving[name] != nil {
+			continue
+		}
+
+		repo, err := d.repoConfig()
+		if err != nil {
+			return err
+		}
+		repo.URL = r.CloneURL
+		if d.cfg.SSH {
+			repo.URL = r.SSHURL
+		}
+
+		if err := d.set.Add(name, repo); err != nil {
+			log.Printf("failed to add discovered repo %s: %s", name, err)
+			continue
+		}
+		log.Printf("Discovered repo %s on %s", name, d.cfg.URL)
+		d.added[name] = true
+	}
+
+	if failed != nil {
+		return failed
+	}
+
+	for name := range d.added {
+		if found[name] != nil {
+			continue
+		}
+
+		if err := d.set.Remove(name); err != nil {
+			log.Printf("failed to remove repo %s: %s", name, err)
+		} else {
+			log.Printf("Removed repo %s, which %s no longer has", name, d.cfg.URL)
+		}
+		delete(d.added, name)
+	}
+	return nil
+}
+
+// The token of the api from the environment, if there is one.
+func token(d *config.Discovery) (string, error) {
+	if d.TokenEnv == "" {
+		return "", nil
+	}
+
+	tok := os.Getenv(d.TokenEnv)
+	if tok == "" {
+		return "", fmt.Errorf("environment variable %s is not set", d.TokenEnv)
+	}
+	return tok, nil
+}
+
+var errNotFound = errors.New("discover: not found")
+
+// Get a url of the api of a host, sending the token of the discovery with
+// the scheme that the host wants, and decode its answer into v.
+func getJSON(client *http.Client, d *config.Discovery, scheme, u string, v interface{}) error {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	tok, err := token(d)
+	if err != nil {
+		return err
+	}
+	if tok != "" {
+		req.Header.Set("Authorization", scheme+" "+tok)
+	}
+	for key, val := range d.HTTPHeaders {
+		req.Header.Set(key, val)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return errNotFound
+	default:
+		return fmt.Errorf("%s from %s", res.Status, req.URL.Redacted())
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
@@ -0,0 +1,267 @@
+package discover
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hound-search/hound/config"
+)
+
+// A Gitea server with the repos of each org, and of a user, that answers
+// in pages of at most two repos the way a server with a small limit does.
+func giteaServer(orgs, users map[string][]*giteaRepo) *httptest.Server {
+	list := func(w http.ResponseWriter, r *http.Request, repos []*giteaRepo) {
+		if r.Header.Get("Authorization") != "token tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		page, _ := strconv.Atoi(r.FormValue("page"))
+		if page == 0 {
+			page = 1
+		}
+		start, end := (page-1)*2, page*2
+		if start > len(repos) {
+			start = len(repos)
+		}
+		if end > len(repos) {
+			end = len(repos)
+		}
+		json.NewEncoder(w).Encode(repos[start:end])
+	}
+
+	m := http.NewServeMux()
+	for org, repos := range orgs {
+		repos := repos
+		m.HandleFunc(fmt.Sprintf("/api/v1/orgs/%s/repos", org), func(w http.ResponseWriter, r *http.Request) {
+			list(w, r, repos)
+		})
+	}
+	for user, repos := range users {
+		repos := repos
+		m.HandleFunc(fmt.Sprintf("/api/v1/users/%s/repos", user), func(w http.ResponseWriter, r *http.Request) {
+			list(w, r, repos)
+		})
+	}
+	return httptest.NewServer(m)
+}
+
+func giteaRepoAt(host, name string) *giteaRepo {
+	return &giteaRepo{
+		FullName: name,
+		CloneURL: fmt.Sprintf("https://%s/%s.git", host, name),
+		SSHURL:   fmt.Sprintf("git@%s:%s.git", host, name),
+	}
+}
+
+func TestGiteaList(t *testing.T) {
+	archived := giteaRepoAt("git.example.com", "acme/old")
+	archived.Archived = true
+	srv := giteaServer(
+		map[string][]*giteaRepo{
+			"acme": {
+				giteaRepoAt("git.example.com", "acme/api"),
+				giteaRepoAt("git.example.com", "acme/web"),
+				archived,
+			},
+		},
+		map[string][]*giteaRepo{
+			"alice": {giteaRepoAt("git.example.com", "alice/dotfiles")},
+		})
+	defer srv.Close()
+
+	t.Setenv("GITEA_TOKEN", "tok")
+	d := &config.Discovery{Type: config.DiscoveryGitea, URL: srv.URL, TokenEnv: "GITEA_TOKEN"}
+	g := newGitea(d, http.DefaultClient)
+
+	repos, err := g.list("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range repos {
+		names = append(names, r.Name)
+	}
+	if exp := []string{"acme/api", "acme/web", "acme/old"}; !reflect.DeepEqual(names, exp) {
+		t.Fatalf("expected every page of %v, got %v", exp, names)
+	}
+	if !repos[2].Archived || repos[0].CloneURL != "https://git.example.com/acme/api.git" {
+		t.Fatalf("expected the urls and the archived repo, got %+v", repos)
+	}
+
+	// users have repos too.
+	repos, err = g.list("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0].Name != "alice/dotfiles" {
+		t.Fatalf("expected the repos of the user, got %+v", repos)
+	}
+
+	if _, err := g.list("nobody"); err == nil {
+		t.Fatal("expected an error for an org that isn't there")
+	}
+}
+
+// The repos of a searcher.Set, without the searchers.
+type fakeSet map[string]*config.Repo
+
+func (s fakeSet) Repos() map[string]*config.Repo {
+	res := map[string]*config.Repo{}
+	for name, repo := range s {
+		res[name] = repo
+	}
+	return res
+}
+
+func (s fakeSet) Add(name string, repo *config.Repo) error {
+	if s[name] != nil {
+		return fmt.Errorf("repo %s already exists", name)
+	}
+	s[name] = repo
+	return nil
+}
+
+func (s fakeSet) Remove(name string) error {
+	if s[name] == nil {
+		return fmt.Errorf("No such repository: %s", name)
+	}
+	delete(s, name)
+	return nil
+}
+
+func (s fakeSet) names() []string {
+	var names []string
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lists the repos it is given, or fails.
+type fakeLister struct {
+	repos []*Repo
+	err   error
+}
+
+func (l *fakeLister) list(org string) ([]*Repo, error) {
+	return l.repos, l.err
+}
+
+func TestSync(t *testing.T) {
+	set := fakeSet{"acme/api": {URL: "https://git.example.com/acme/api.git"}}
+	l := &fakeLister{repos: []*Repo{
+		{Name: "acme/api", CloneURL: "https://git.example.com/acme/api.git"},
+		{Name: "acme/web", CloneURL: "https://git.example.com/acme/web.git"},
+		{Name: "acme/old", CloneURL: "https://git.example.com/acme/old.git", Archived: true},
+		{Name: "acme/new", CloneURL: "https://git.example.com/acme/new.git", Empty: true},
+	}}
+
+	d := &discoverer{
+		cfg: &config.Discovery{
+			URL:        "https://git.example.com",
+			Orgs:       []string{"acme"},
+			TokenEnv:   "GITEA_TOKEN",
+			RepoConfig: json.RawMessage(`{"ms-between-poll": 60000}`),
+		},
+		l:     l,
+		set:   set,
+		added: map[string]bool{},
+	}
+
+	if err := d.sync(); err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"acme/api", "acme/web"}; !reflect.DeepEqual(set.names(), exp) {
+		t.Fatalf("expected %v, got %v", exp, set.names())
+	}
+
+	web := set["acme/web"]
+	if web.URL != "https://git.example.com/acme/web.git" || web.MsBetweenPolls != 60000 {
+		t.Fatalf("expected the repo config with the clone url, got %+v", web)
+	}
+	if web.VcsConfigMessage == nil || string(*web.VcsConfigMessage) != `{"pat-env":"GITEA_TOKEN"}` {
+		t.Fatal("expected the repo to clone with the token")
+	}
+
+	// a host that can't be reached doesn't lose its repos.
+	l.repos, l.err = nil, errors.New("unreachable")
+	if err := d.sync(); err == nil {
+		t.Fatal("expected the error of the listing")
+	}
+	if len(set) != 2 {
+		t.Fatalf("expected the repos to be kept, got %v", set.names())
+	}
+
+	// the repos it added go once the host doesn't have them, and the
+	// ones of the config stay.
+	l.err = nil
+	if err := d.sync(); err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"acme/api"}; !reflect.DeepEqual(set.names(), exp) {
+		t.Fatalf("expected %v, got %v", exp, set.names())
+	}
+}
+
+func TestBitbucketServerList(t *testing.T) {
+	page := func(start int, last bool, slugs ...string) string {
+		var values []string
+		for _, slug := range slugs {
+			values = append(values, fmt.Sprintf(`{"slug": %q, "project": {"key": "ACME"}, "links": {"clone": [`+
+				`{"href": "https://jdoe@git.example.com/scm/acme/%s.git", "name": "http"}, `+
+				`{"href": "ssh://git@git.example.com:7999/acme/%s.git", "name": "ssh"}]}}`, slug, slug, slug))
+		}
+		return fmt.Sprintf(`{"values": [%s], "isLastPage": %v, "nextPageStart": %d}`,
+			strings.Join(values, ","), last, start+len(slugs))
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path + "?start=" + r.FormValue("start") {
+		case "/rest/api/1.0/projects/ACME/repos?start=0":
+			fmt.Fprint(w, page(0, false, "api", "web"))
+		case "/rest/api/1.0/projects/ACME/repos?start=2":
+			fmt.Fprint(w, page(2, true, "docs"))
+		case "/rest/api/1.0/users/jdoe/repos?start=0":
+			fmt.Fprint(w, page(0, true, "dotfiles"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	t.Setenv("BITBUCKET_TOKEN", "tok")
+	b := newBitbucketServer(&config.Discovery{URL: srv.URL, TokenEnv: "BITBUCKET_TOKEN"}, http.DefaultClient)
+
+	repos, err := b.list("ACME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range repos {
+		names = append(names, r.Name)
+	}
+	if exp := []string{"ACME/api", "ACME/web", "ACME/docs"}; !reflect.DeepEqual(names, exp) {
+		t.Fatalf("expected every page of %v, got %v", exp, names)
+	}
+	if r := repos[0]; r.CloneURL != "https://git.example.com/scm/acme/api.git" || r.SSHURL != "ssh://git@git.example.com:7999/acme/api.git" {
+		t.Fatalf("expected the clone urls without the user, got %+v", r)
+	}
+
+	if repos, err := b.list("~jdoe"); err != nil || len(repos) != 1 {
+		t.Fatalf("expected the repos of the user, got %v, %v", repos, err)
+	}
+}
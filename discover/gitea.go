@@ -0,0 +1,79 @@
+package discover
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/hound-search/hound/config"
+)
+
+// The number of repos asked for in each page of a listing.
+const giteaPageSize = 50
+
+func init() {
+	register(newGitea, config.DiscoveryGitea, config.DiscoveryGogs)
+}
+
+// Lists the repos of an org, or a user, through the api of Gitea or of
+// Gogs, which Gitea was forked from. Gogs doesn't page its listings.
+type gitea struct {
+	cfg    *config.Discovery
+	client *http.Client
+	paged  bool
+}
+
+type giteaRepo struct {
+	FullName string `json:"full_name"`
+	CloneURL string `json:"clone_url"`
+	SSHURL   string `json:"ssh_url"`
+	Archived bool   `json:"archived"`
+	Empty    bool   `json:"empty"`
+}
+
+func newGitea(d *config.Discovery, client *http.Client) lister {
+	return &gitea{
+		cfg:    d,
+		client: client,
+		paged:  d.Type == config.DiscoveryGitea,
+	}
+}
+
+func (g *gitea) list(org string) ([]*Repo, error) {
+	repos, err := g.listAt("orgs", org)
+	if err == errNotFound {
+		repos, err = g.listAt("users", org)
+	}
+	return repos, err
+}
+
+// List the repos at /api/v1/{kind}/{org}/repos, page by page until an
+// empty one, as the host may have a smaller limit on the size of a page.
+func (g *gitea) listAt(kind, org string) ([]*Repo, error) {
+	var res []*Repo
+	for page := 1; ; page++ {
+		u := fmt.Sprintf("%s/api/v1/%s/%s/repos", g.cfg.URL, kind, url.PathEscape(org))
+		if g.paged {
+			u += fmt.Sprintf("?page=%d&limit=%d", page, giteaPageSize)
+		}
+
+		var repos []*giteaRepo
+		if err := getJSON(g.client, g.cfg, "token", u, &repos); err != nil {
+			return nil, err
+		}
+
+		for _, r := range repos {
+			res = append(res, &Repo{
+				Name:     r.FullName,
+				CloneURL: r.CloneURL,
+				SSHURL:   r.SSHURL,
+				Archived: r.Archived,
+				Empty:    r.Empty,
+			})
+		}
+
+		if !g.paged || len(repos) == 0 {
+			return res, nil
+		}
+	}
+}
@@ -0,0 +1,253 @@
+// Package embed turns text into vectors whose distances say how alike the
+// meaning of the texts is, for semantic search. Vectors come from a
+// backend, either one built in that hashes the words of the text, or an
+// embedding service over http.
+package embed
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/hound-search/hound/config"
+)
+
+const requestTimeout = 60 * time.Second
+
+// A backend makes the vectors of texts, in order.
+type backend interface {
+	embed(texts []string) ([][]float32, error)
+}
+
+// Model makes the embeddings of text for the config. A nil Model makes
+// none, which turns semantic search off.
+type Model struct {
+	b backend
+
+	// The number of lines in each chunk of a file that gets an embedding,
+	// and the number of chunks sent to the backend at once.
+	ChunkLines int
+	BatchSize  int
+}
+
+// New sets up the backend of the config, with client for an http one. It
+// returns nil if the config is nil.
+func New(cfg *config.Embeddings, client *http.Client) (*Model, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	m := &Model{
+		ChunkLines: cfg.ChunkLines,
+		BatchSize:  cfg.BatchSize,
+	}
+
+	switch cfg.Backend {
+	case "local":
+		m.b = &hashing{dim: cfg.Dimensions}
+	case "http":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("embeddings: an http backend needs a url")
+		}
+		m.b = &service{
+			url:     cfg.URL,
+			model:   cfg.Model,
+			headers: cfg.HTTPHeaders,
+			client:  client,
+		}
+	default:
+		return nil, fmt.Errorf("embeddings: unknown backend: %s", cfg.Backend)
+	}
+
+	return m, nil
+}
+
+// Embed returns the vector of each text, scaled to a length of 1 so that
+// their dot product is their cosine similarity.
+func (m *Model) Embed(texts []string) ([][]float32, error) {
+	var res [][]float32
+	for len(texts) > 0 {
+		n := len(texts)
+		if m.BatchSize > 0 && n > m.BatchSize {
+			n = m.BatchSize
+		}
+
+		vecs, err := m.b.embed(texts[:n])
+		if err != nil {
+			return nil, err
+		}
+		if len(vecs) != n {
+			return nil, fmt.Errorf("embeddings: expected %d vectors, got %d", n, len(vecs))
+		}
+
+		for _, v := range vecs {
+			normalize(v)
+		}
+		res = append(res, vecs...)
+		texts = texts[n:]
+	}
+	return res, nil
+}
+
+func normalize(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+
+	l := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= l
+	}
+}
+
+// The local backend, which hashes the words of a text into a vector of a
+// fixed size. Identifiers are split into their words, so a query like
+// "retry with backoff" is near code that calls retryWithBackoff.
+type hashing struct {
+	dim int
+}
+
+// Words too common to say anything about a text.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "the": true, "of": true, "to": true,
+	"in": true, "for": true, "with": true, "on": true, "is": true, "it": true,
+}
+
+// Split text into lower case words, including the words of identifiers
+// in camel or snake case.
+func words(text string) []string {
+	var res []string
+	var cur []rune
+	flush := func() {
+		if len(cur) > 1 {
+			if w := strings.ToLower(string(cur)); !stopWords[w] {
+				res = append(res, w)
+			}
+		}
+		cur = cur[:0]
+	}
+
+	rs := []rune(text)
+	for i, r := range rs {
+		switch {
+		case unicode.IsLetter(r):
+			// a word of a camel case identifier ends before an upper case
+			// letter that follows a lower one, or that starts a word after
+			// an acronym, as in HTTPClient.
+			if unicode.IsUpper(r) && len(cur) > 0 {
+				prev := cur[len(cur)-1]
+				if unicode.IsLower(prev) || (i+1 < len(rs) && unicode.IsLower(rs[i+1]) && unicode.IsUpper(prev)) {
+					flush()
+				}
+			}
+			cur = append(cur, r)
+		case unicode.IsDigit(r):
+			cur = append(cur, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return res
+}
+
+func (h *hashing) embed(texts []string) ([][]float32, error) {
+	res := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, h.dim)
+		for _, w := range words(text) {
+			f := fnv.New64a()
+			f.Write([]byte(w))
+			sum := f.Sum64()
+
+			// the sign keeps the words that share a slot from adding up.
+			if sum&(1<<63) != 0 {
+				v[sum%uint64(h.dim)]--
+			} else {
+				v[sum%uint64(h.dim)]++
+			}
+		}
+		res[i] = v
+	}
+	return res, nil
+}
+
+// An embedding service with the API of OpenAI's /v1/embeddings, which
+// many local servers also have.
+type service struct {
+	url     string
+	model   string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (s *service) embed(texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model": s.model,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	c := *s.client
+	c.Timeout = requestTimeout
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return nil, fmt.Errorf("embeddings: %s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var data struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	vecs := make([][]float32, len(texts))
+	for _, d := range data.Data {
+		if d.Index < 0 || d.Index >= len(vecs) {
+			return nil, fmt.Errorf("embeddings: unexpected index %d", d.Index)
+		}
+		vecs[d.Index] = d.Embedding
+	}
+	for i, v := range vecs {
+		if v == nil {
+			return nil, fmt.Errorf("embeddings: no vector for text %d", i)
+		}
+	}
+	return vecs, nil
+}
@@ -0,0 +1,132 @@
+package embed
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/hound-search/hound/config"
+)
+
+func TestWords(t *testing.T) {
+	got := words("func retryWithBackoff(c *HTTPClient, max_attempts int) // Retry the call")
+	expected := []string{"func", "retry", "backoff", "http", "client", "max", "attempts", "int", "retry", "call"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func dot(a, b []float32) float32 {
+	var res float32
+	for i := range a {
+		res += a[i] * b[i]
+	}
+	return res
+}
+
+func TestLocal(t *testing.T) {
+	m, err := New(&config.Embeddings{Backend: "local", Dimensions: 256, BatchSize: 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vecs, err := m.Embed([]string{
+		"retry HTTP with backoff",
+		"func retryWithBackoff(c *HTTPClient) error",
+		"func sum(xs []int) int",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vecs) != 3 {
+		t.Fatalf("expected 3 vectors, got %d", len(vecs))
+	}
+	for _, v := range vecs {
+		if l := math.Sqrt(float64(dot(v, v))); math.Abs(l-1) > 1e-4 {
+			t.Fatalf("expected a vector of length 1, got %f", l)
+		}
+	}
+
+	if near, far := dot(vecs[0], vecs[1]), dot(vecs[0], vecs[2]); near <= far {
+		t.Fatalf("expected the retry code to be nearer than the sum (%f <= %f)", near, far)
+	}
+}
+
+func TestService(t *testing.T) {
+	var batches [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "no", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model != "code" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		batches = append(batches, req.Input)
+
+		type datum struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		}
+		var data []datum
+		// out of order, which the index fixes.
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			data = append(data, datum{i, []float32{float32(len(req.Input[i])), 0}})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	defer srv.Close()
+
+	m, err := New(&config.Embeddings{
+		Backend:     "http",
+		URL:         srv.URL,
+		Model:       "code",
+		HTTPHeaders: map[string]string{"Authorization": "Bearer secret"},
+		BatchSize:   2,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vecs, err := m.Embed([]string{"a", "bb", "ccc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(batches) != 2 {
+		t.Fatalf("expected 2 batches, got %d", len(batches))
+	}
+	expected := [][]float32{{1, 0}, {1, 0}, {1, 0}}
+	if !reflect.DeepEqual(vecs, expected) {
+		t.Fatalf("expected %v, got %v", expected, vecs)
+	}
+
+	m.b.(*service).headers = nil
+	if _, err := m.Embed([]string{"a"}); err == nil {
+		t.Fatal("expected a failing service to fail")
+	}
+}
+
+func TestNew(t *testing.T) {
+	if m, err := New(nil, nil); m != nil || err != nil {
+		t.Fatalf("expected no model without a config, got %v, %v", m, err)
+	}
+
+	if _, err := New(&config.Embeddings{Backend: "http"}, nil); err == nil {
+		t.Fatal("expected an http backend without a url to fail")
+	}
+
+	if _, err := New(&config.Embeddings{Backend: "magic"}, nil); err == nil {
+		t.Fatal("expected an unknown backend to fail")
+	}
+}
@@ -0,0 +1,295 @@
+// Package federation lets one hound act as a gateway to several others,
+// fanning each search out to them and merging what comes back.
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/reqid"
+)
+
+// How often the repo lists of the downstream instances are refreshed.
+const refreshInterval = time.Minute
+
+// Federation is the set of downstream instances behind a gateway.
+type Federation struct {
+	downstreams []*downstream
+}
+
+type downstream struct {
+	cfg    *config.Downstream
+	client *http.Client
+
+	// The repos the instance last told us about, by their own names.
+	lck   sync.RWMutex
+	repos map[string]*config.Repo
+}
+
+// What one downstream instance contributed to a search.
+type result struct {
+	ds          *downstream
+	res         map[string]*index.SearchResponse
+	filesOpened int
+	err         error
+
+	// Set when the instance answered but rejected the query, which
+	// would happen locally too.
+	queryErr string
+}
+
+// New returns a Federation of the given instances. The client is used for
+// all requests to them.
+func New(cfgs []*config.Downstream, client *http.Client) *Federation {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	f := &Federation{}
+	for _, cfg := range cfgs {
+		f.downstreams = append(f.downstreams, &downstream{
+			cfg:    cfg,
+			client: client,
+			repos:  map[string]*config.Repo{},
+		})
+	}
+	return f
+}
+
+// Split a gateway repo name into the instance and its own name for it.
+func (f *Federation) route(repo string) (*downstream, string) {
+	for _, ds := range f.downstreams {
+		if name := strings.TrimPrefix(repo, ds.cfg.Name+"/"); name != repo {
+			return ds, name
+		}
+	}
+	return nil, ""
+}
+
+// Owns reports whether the repo belongs to one of the downstream instances.
+func (f *Federation) Owns(repo string) bool {
+	ds, _ := f.route(repo)
+	return ds != nil
+}
+
+func (ds *downstream) get(ctx context.Context, path string, params url.Values, into interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, ds.cfg.Timeout())
+	defer cancel()
+
+	uri := strings.TrimSuffix(ds.cfg.URL, "/") + path
+	if params != nil {
+		uri += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	// the downstream logs the search under the id of the request for it.
+	if id := reqid.FromContext(ctx); id != "" {
+		req.Header.Set(reqid.Header, id)
+	}
+
+	for key, val := range ds.cfg.HTTPHeaders {
+		if strings.ToLower(key) == "host" {
+			req.Host = val
+		} else {
+			req.Header.Set(key, val)
+		}
+	}
+
+	res, err := ds.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", uri, res.Status)
+	}
+
+	if s, ok := into.(*string); ok {
+		b, err := ioutil.ReadAll(res.Body)
+		*s = string(b)
+		return err
+	}
+
+	return json.NewDecoder(res.Body).Decode(into)
+}
+
+func (ds *downstream) refresh() error {
+	var repos map[string]*config.Repo
+	if err := ds.get(context.Background(), "/api/v1/repos", nil, &repos); err != nil {
+		return err
+	}
+
+	ds.lck.Lock()
+	defer ds.lck.Unlock()
+	ds.repos = repos
+	return nil
+}
+
+// Refresh fetches the repo list of every instance. An instance that can't
+// be reached keeps the list it had before.
+func (f *Federation) Refresh() {
+	var wg sync.WaitGroup
+	for _, ds := range f.downstreams {
+		wg.Add(1)
+		go func(ds *downstream) {
+			defer wg.Done()
+			if err := ds.refresh(); err != nil {
+				log.Printf("unable to list repos of %s: %s", ds.cfg.Name, err)
+			}
+		}(ds)
+	}
+	wg.Wait()
+}
+
+// Start refreshing the repo lists in the background.
+func (f *Federation) Start() {
+	go func() {
+		for range time.Tick(refreshInterval) {
+			f.Refresh()
+		}
+	}()
+}
+
+// Repos returns the repos of all instances under their gateway names.
+func (f *Federation) Repos() map[string]*config.Repo {
+	res := map[string]*config.Repo{}
+	for _, ds := range f.downstreams {
+		ds.lck.RLock()
+		for name, repo := range ds.repos {
+			res[ds.cfg.Name+"/"+name] = repo
+		}
+		ds.lck.RUnlock()
+	}
+	return res
+}
+
+// Work out which repos to ask each instance for. A "*" asks every
+// instance for all of its repos.
+func (f *Federation) plan(repos string) map[*downstream][]string {
+	plan := map[*downstream][]string{}
+	if strings.TrimSpace(repos) == "*" {
+		for _, ds := range f.downstreams {
+			plan[ds] = []string{"*"}
+		}
+		return plan
+	}
+
+	for _, repo := range strings.Split(repos, ",") {
+		if ds, name := f.route(strings.TrimSpace(repo)); ds != nil {
+			plan[ds] = append(plan[ds], name)
+		}
+	}
+	return plan
+}
+
+func (ds *downstream) search(ctx context.Context, params url.Values, repos []string) *result {
+	q := url.Values{}
+	for k, v := range params {
+		q[k] = v
+	}
+	q.Set("repos", strings.Join(repos, ","))
+	q.Set("stats", "1")
+	// the results are read as JSON, whatever the gateway answers with.
+	q.Del("format")
+
+	var res struct {
+		Results map[string]*index.SearchResponse
+		Stats   *struct {
+			FilesOpened int
+		}
+		Error string
+	}
+
+	r := &result{ds: ds}
+	if r.err = ds.get(ctx, "/api/v1/search", q, &res); r.err != nil {
+		return r
+	}
+
+	if res.Error != "" {
+		r.queryErr = res.Error
+		return r
+	}
+
+	r.res = res.Results
+	if res.Stats != nil {
+		r.filesOpened = res.Stats.FilesOpened
+	}
+	return r
+}
+
+// Search runs the query described by params on every instance that holds
+// one of the requested repos. Results are keyed by gateway repo name.
+// Instances that fail or time out are left out of the results and listed
+// in unavailable along with the reason; the search as a whole only fails
+// if an instance rejects the query itself.
+func (f *Federation) Search(
+	ctx context.Context,
+	params url.Values,
+	repos string,
+	filesOpened *int) (map[string]*index.SearchResponse, map[string]string, error) {
+
+	plan := f.plan(repos)
+
+	// use a buffered channel so slow instances don't leak routines.
+	ch := make(chan *result, len(plan))
+	for ds, names := range plan {
+		go func(ds *downstream, names []string) {
+			ch <- ds.search(ctx, params, names)
+		}(ds, names)
+	}
+
+	res := map[string]*index.SearchResponse{}
+	unavailable := map[string]string{}
+	var queryErr error
+	for i := 0; i < len(plan); i++ {
+		r := <-ch
+		switch {
+		case r.err != nil:
+			reqid.Printf(ctx, "search of %s failed: %s", r.ds.cfg.Name, r.err)
+			unavailable[r.ds.cfg.Name] = r.err.Error()
+		case r.queryErr != "":
+			queryErr = &index.QueryError{Err: errors.New(r.queryErr)}
+		default:
+			for name, sr := range r.res {
+				res[r.ds.cfg.Name+"/"+name] = sr
+			}
+			*filesOpened += r.filesOpened
+		}
+	}
+
+	if queryErr != nil {
+		return nil, nil, queryErr
+	}
+
+	return res, unavailable, nil
+}
+
+// Excludes fetches the excluded files, as JSON, from the instance that
+// holds the repo.
+func (f *Federation) Excludes(repo string) (string, error) {
+	ds, name := f.route(repo)
+	if ds == nil {
+		return "", fmt.Errorf("No such repository: %s", repo)
+	}
+
+	var res string
+	err := ds.get(context.Background(), "/api/v1/excludes", url.Values{"repo": {name}}, &res)
+	return res, err
+}
@@ -0,0 +1,105 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+)
+
+// A downstream hound with the given repos that finds one match in each
+// repo it is asked to search.
+func fakeHound(t *testing.T, repos ...string) *httptest.Server {
+	m := http.NewServeMux()
+	m.HandleFunc("/api/v1/repos", func(w http.ResponseWriter, r *http.Request) {
+		res := map[string]*config.Repo{}
+		for _, repo := range repos {
+			res[repo] = &config.Repo{URL: "https://example.com/" + repo}
+		}
+		json.NewEncoder(w).Encode(res)
+	})
+	m.HandleFunc("/api/v1/search", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("q") == "(" {
+			json.NewEncoder(w).Encode(map[string]string{"Error": "bad regexp"})
+			return
+		}
+
+		res := map[string]*index.SearchResponse{}
+		asked := r.FormValue("repos")
+		for _, repo := range repos {
+			if asked == "*" || asked == repo {
+				res[repo] = &index.SearchResponse{
+					Matches: []*index.FileMatch{{Filename: "main.go"}},
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Results": res,
+			"Stats":   map[string]int{"FilesOpened": 1},
+		})
+	})
+	return httptest.NewServer(m)
+}
+
+func TestFederatedSearch(t *testing.T) {
+	us := fakeHound(t, "api", "web")
+	defer us.Close()
+
+	eu := fakeHound(t, "billing")
+	defer eu.Close()
+
+	down := fakeHound(t)
+	down.Close()
+
+	f := New([]*config.Downstream{
+		{Name: "us", URL: us.URL, TimeoutMs: 1000},
+		{Name: "eu", URL: eu.URL, TimeoutMs: 1000},
+		{Name: "down", URL: down.URL, TimeoutMs: 1000},
+	}, nil)
+	f.Refresh()
+
+	repos := f.Repos()
+	if len(repos) != 3 || repos["us/api"] == nil || repos["eu/billing"] == nil {
+		t.Fatalf("unexpected repos: %v", repos)
+	}
+
+	if !f.Owns("eu/billing") || f.Owns("billing") {
+		t.Fatal("repos are not attributed to their instance")
+	}
+
+	var opened int
+	res, unavailable, err := f.Search(context.Background(), url.Values{"q": {"main"}}, "*", &opened)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res) != 3 || res["us/web"] == nil || res["eu/billing"] == nil {
+		t.Fatalf("unexpected results: %v", res)
+	}
+
+	if opened != 2 {
+		t.Fatalf("expected 2 files opened, got %d", opened)
+	}
+
+	if _, ok := unavailable["down"]; !ok || len(unavailable) != 1 {
+		t.Fatalf("expected only down to be unavailable, got %v", unavailable)
+	}
+
+	// only the instances holding the requested repos are asked.
+	res, unavailable, err = f.Search(context.Background(), url.Values{"q": {"main"}}, "us/api", &opened)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res["us/api"] == nil || len(unavailable) != 0 {
+		t.Fatalf("unexpected results: %v, %v", res, unavailable)
+	}
+
+	if _, _, err := f.Search(context.Background(), url.Values{"q": {"("}}, "us/api", &opened); err == nil {
+		t.Fatal("expected a rejected query to fail the search")
+	}
+}
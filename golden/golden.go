@@ -0,0 +1,307 @@
+// Package golden runs searches of fixture repos through the API and
+// compares what they find, in what order and with what excerpts, with
+// golden results that were checked in, so that changes to how searches
+// are run, ranked or stored can be told apart from changes to what they
+// find.
+package golden
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hound-search/hound/api"
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/searcher"
+)
+
+// The fields of responses that change from run to run, like timings and
+// the revisions of the fixture repos, which are left out of the results
+// that are compared.
+var volatileFields = map[string]bool{
+	"Stats":    true,
+	"Revision": true,
+	"Duration": true,
+	"WokenMs":  true,
+	"Modified": true,
+}
+
+// Case is a request of the API whose response is compared with a golden
+// result.
+type Case struct {
+	// The name of the golden result, which is unique.
+	Name string
+
+	// The endpoint, /api/v1/search if it isn't set, and its params.
+	Path   string
+	Params map[string]string
+}
+
+// URL is the path and query of the request of the case.
+func (c *Case) URL() string {
+	p := c.Path
+	if p == "" {
+		p = "/api/v1/search"
+	}
+
+	v := url.Values{}
+	for k, val := range c.Params {
+		v.Set(k, val)
+	}
+	return p + "?" + v.Encode()
+}
+
+// ReadCases reads the cases of a JSON file, which is a list of them.
+func ReadCases(filename string) ([]*Case, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []*Case
+	if err := json.Unmarshal(b, &cases); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+
+	seen := map[string]bool{}
+	for _, c := range cases {
+		if c.Name == "" || seen[c.Name] {
+			return nil, fmt.Errorf("%s: every case needs a name of its own, got %q", filename, c.Name)
+		}
+		seen[c.Name] = true
+	}
+	return cases, nil
+}
+
+// Fixture is the fixture repos of a directory, each indexed from a git
+// repo of its own and served through the API.
+type Fixture struct {
+	set *searcher.Set
+	mux *http.ServeMux
+}
+
+// Run a command in dir, failing with its output.
+func run(dir string, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	// commits made the same way every time.
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=hound", "GIT_AUTHOR_EMAIL=hound@example.com",
+		"GIT_COMMITTER_NAME=hound", "GIT_COMMITTER_EMAIL=hound@example.com",
+		"GIT_AUTHOR_DATE=2020-01-01T00:00:00Z", "GIT_COMMITTER_DATE=2020-01-01T00:00:00Z")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s %s: %s: %s", name, strings.Join(args, " "), err, out)
+	}
+	return nil
+}
+
+// Copy the files of the directory src into dst, which is made.
+func copyDir(dst, src string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		to := filepath.Join(dst, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(to, os.ModePerm)
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(to, b, 0644)
+	})
+}
+
+// Load the fixture repos in the subdirectories of dir, making a git repo
+// of each, and index them in a dbpath under tmp, with the config in
+// config.json in dir, if there is one, for the rest. It needs git.
+func Load(dir, tmp string) (*Fixture, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, err
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := map[string]interface{}{}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "config.json")); err == nil {
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return nil, fmt.Errorf("%s: %s", filepath.Join(dir, "config.json"), err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	repos := map[string]interface{}{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		src := filepath.Join(tmp, "src", e.Name())
+		if err := copyDir(src, filepath.Join(dir, e.Name())); err != nil {
+			return nil, err
+		}
+		for _, args := range [][]string{
+			{"init", "-q"},
+			{"add", "-A"},
+			{"commit", "-q", "-m", "fixture"},
+		} {
+			if err := run(src, "git", args...); err != nil {
+				return nil, err
+			}
+		}
+
+		repos[e.Name()] = map[string]interface{}{"url": src}
+	}
+	cfg["dbpath"] = filepath.Join(tmp, "db")
+	cfg["repos"] = repos
+
+	// the config is loaded as houndd loads it, with its defaults.
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	filename := filepath.Join(tmp, "config.json")
+	if err := ioutil.WriteFile(filename, b, 0644); err != nil {
+		return nil, err
+	}
+
+	var c config.Config
+	if err := c.LoadFromFile(filename); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(c.DbPath, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	searchers := map[string]*searcher.Searcher{}
+	for name, repo := range c.Repos {
+		s, err := searcher.New(c.DbPath, name, repo)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		searchers[name] = s
+	}
+
+	f := &Fixture{
+		set: searcher.NewSet(&c, searchers),
+		mux: http.NewServeMux(),
+	}
+	api.Setup(f.mux, f.set, nil, nil)
+	return f, nil
+}
+
+// Close stops the searchers of the fixture.
+func (f *Fixture) Close() {
+	f.set.Stop()
+}
+
+// Run the request of the case, returning its response as it is compared
+// with the golden result: JSON without its volatile fields, indented, or
+// the text of other responses as it is.
+func (f *Fixture) Run(c *Case) ([]byte, error) {
+	w := httptest.NewRecorder()
+	f.mux.ServeHTTP(w, httptest.NewRequest("GET", c.URL(), nil))
+	if w.Code != http.StatusOK {
+		return nil, fmt.Errorf("%s: %d: %s", c.URL(), w.Code, w.Body.String())
+	}
+
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		return w.Body.Bytes(), nil
+	}
+	return Normalize(w.Body.Bytes())
+}
+
+// Take the volatile fields out of a value decoded from JSON.
+func stripVolatile(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if volatileFields[k] {
+				delete(v, k)
+				continue
+			}
+			stripVolatile(val)
+		}
+	case []interface{}:
+		for _, val := range v {
+			stripVolatile(val)
+		}
+	}
+}
+
+// Normalize a JSON response for comparing it with a golden result: its
+// volatile fields are left out, and it is indented, with the keys of
+// objects sorted, so that the differences with the golden result read
+// like a diff.
+func Normalize(b []byte) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	stripVolatile(v)
+
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// Diff says where got first differs from the golden result exp, line by
+// line, or returns "" if they're the same.
+func Diff(exp, got []byte) string {
+	if bytes.Equal(exp, got) {
+		return ""
+	}
+
+	el := strings.Split(string(exp), "\n")
+	gl := strings.Split(string(got), "\n")
+	n := len(el)
+	if len(gl) > n {
+		n = len(gl)
+	}
+
+	line := func(l []string, i int) string {
+		if i < len(l) {
+			return l[i]
+		}
+		return "<end>"
+	}
+	for i := 0; i < n; i++ {
+		if line(el, i) != line(gl, i) {
+			return fmt.Sprintf("line %d:\n- %s\n+ %s", i+1, line(el, i), line(gl, i))
+		}
+	}
+	return ""
+}
+
+// Names are the names of the cases, sorted.
+func Names(cases []*Case) []string {
+	names := make([]string, 0, len(cases))
+	for _, c := range cases {
+		names = append(names, c.Name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,124 @@
+package golden
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "write the golden results from what the searches find")
+
+const resultsDir = "testdata/results"
+
+func goldenFilename(name string) string {
+	return filepath.Join(resultsDir, name+".golden")
+}
+
+func TestGolden(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("the fixture repos need git")
+	}
+
+	cases, err := ReadCases("testdata/cases.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmp, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	f, err := Load("testdata/repos", tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if *update {
+		if err := os.MkdirAll(resultsDir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			got, err := f.Run(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// nothing of where the test runs belongs in a golden result.
+			if strings.Contains(string(got), tmp) {
+				t.Fatalf("expected no paths of %s in the results, got:\n%s", tmp, got)
+			}
+
+			if *update {
+				if err := ioutil.WriteFile(goldenFilename(c.Name), got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			exp, err := ioutil.ReadFile(goldenFilename(c.Name))
+			if err != nil {
+				t.Fatalf("%s, run go test ./golden -update to write it", err)
+			}
+			if d := Diff(exp, got); d != "" {
+				t.Fatalf("%s differs from %s at %s", c.URL(), goldenFilename(c.Name), d)
+			}
+		})
+	}
+}
+
+func TestGoldenFilesHaveCases(t *testing.T) {
+	cases, err := ReadCases("testdata/cases.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := map[string]bool{}
+	for _, name := range Names(cases) {
+		names[name] = true
+	}
+
+	files, err := filepath.Glob(filepath.Join(resultsDir, "*.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if name := strings.TrimSuffix(filepath.Base(file), ".golden"); !names[name] {
+			t.Errorf("expected a case for %s, or for it to be removed", file)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	got, err := Normalize([]byte(`{"b":1,"a":{"Duration":3,"Revision":"abc","c":[{"Stats":{}}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := "{\n  \"a\": {\n    \"c\": [\n      {}\n    ]\n  },\n  \"b\": 1\n}\n"
+	if string(got) != exp {
+		t.Fatalf("expected %q, got %q", exp, got)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	if d := Diff([]byte("a\nb\n"), []byte("a\nb\n")); d != "" {
+		t.Fatalf("expected no diff, got %q", d)
+	}
+	if d := Diff([]byte("a\nb\n"), []byte("a\nc\n")); d != "line 2:\n- b\n+ c" {
+		t.Fatalf("expected a diff at line 2, got %q", d)
+	}
+	if d := Diff([]byte("a\n"), []byte("a\nb\n")); d != "line 2:\n- \n+ b" {
+		t.Fatalf("expected a diff at line 2, got %q", d)
+	}
+}
@@ -0,0 +1,21 @@
+#!/usr/bin/env python3
+"""Deploy the widgets to the servers."""
+
+import sys
+
+SERVERS = ["web-1", "web-2"]
+
+
+def deploy(server, version):
+    # TODO: roll back when a server fails.
+    print("deploying %s to %s" % (version, server))
+
+
+def main(args):
+    version = args[0] if args else "latest"
+    for server in SERVERS:
+        deploy(server, version)
+
+
+if __name__ == "__main__":
+    main(sys.argv[1:])
@@ -0,0 +1,12 @@
+// Helpers for the deploy dashboard.
+
+function formatVersion(v) {
+  return 'v' + v;
+}
+
+function colorFor(status) {
+  // TODO: more colors for more statuses.
+  return status === 'ok' ? 'green' : 'red';
+}
+
+module.exports = { formatVersion: formatVersion, colorFor: colorFor };
@@ -0,0 +1,24 @@
+package color
+
+// Color is the name of a color.
+type Color string
+
+// Default is the color of new widgets.
+const Default Color = "grey"
+
+var names = []Color{"grey", "red", "green", "blue"}
+
+// Names lists the colors that widgets come in.
+func Names() []Color {
+	return names
+}
+
+// IsColor says whether c is one of the colors.
+func IsColor(c Color) bool {
+	for _, n := range names {
+		if n == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package widgets
+
+import (
+	"fmt"
+
+	"example.com/widgets/internal/color"
+)
+
+// Widget is a thing with a name and a color.
+type Widget struct {
+	Name  string
+	Color color.Color
+}
+
+// NewWidget makes a widget of the default color.
+func NewWidget(name string) *Widget {
+	return &Widget{Name: name, Color: color.Default}
+}
+
+// Paint gives the widget another color.
+func (w *Widget) Paint(c color.Color) {
+	// TODO: refuse colors that clash.
+	w.Color = c
+}
+
+func (w *Widget) String() string {
+	return fmt.Sprintf("%s (%s)", w.Name, w.Color)
+}
+
+func describe(w *Widget) {
+	fmt.Println(w.String())
+	fmt.Println("colors:", color.Names())
+}
@@ -0,0 +1,11 @@
+package widgets
+
+import "testing"
+
+func TestPaint(t *testing.T) {
+	w := NewWidget("gear")
+	w.Paint("red")
+	if w.Color != "red" {
+		t.Fatalf("expected a red widget, got %s", w.Color)
+	}
+}
@@ -0,0 +1,123 @@
+// Package hooks lets a deployment transform the results of searches before
+// they are sent, without changing the searcher: to redact them, to add
+// metadata to the files or to rewrite their links. Hooks are external
+// http services, Go plugins, or kinds of hooks that a build of houndd
+// registers.
+package hooks
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+)
+
+// Request is the search whose results a hook is given.
+type Request struct {
+	// The endpoint that was searched: search, batch, job, editor, similar
+	// or semantic.
+	Endpoint string `json:"endpoint"`
+
+	// The parameters of the search, as for /api/v1/search.
+	Params url.Values `json:"params"`
+
+	// The request the search came in, for hooks that depend on who is
+	// searching. It is not sent to http hooks.
+	HTTP *http.Request `json:"-"`
+}
+
+// Response is the results of a search, by repo, which a hook can change
+// as it likes.
+type Response struct {
+	Results map[string]*index.SearchResponse
+}
+
+// Hook transforms the results of searches.
+type Hook interface {
+	Process(req *Request, res *Response) error
+}
+
+// Factory makes a hook of some kind from its config.
+type Factory func(cfg *config.ResultHook, client *http.Client) (Hook, error)
+
+var (
+	lck       sync.Mutex
+	factories = map[string]Factory{
+		"http":   newHTTPHook,
+		"plugin": newPluginHook,
+	}
+)
+
+// Register adds a kind of hook that the config can use, e.g. from the
+// init function of a package that is built into houndd.
+func Register(kind string, f Factory) {
+	lck.Lock()
+	defer lck.Unlock()
+	factories[kind] = f
+}
+
+func factoryFor(kind string) Factory {
+	lck.Lock()
+	defer lck.Unlock()
+	return factories[kind]
+}
+
+type entry struct {
+	cfg  *config.ResultHook
+	hook Hook
+}
+
+// Chain runs the hooks of the config, in order. A nil Chain leaves the
+// results as they are.
+type Chain struct {
+	entries []*entry
+}
+
+// New makes the hooks of the config, with client for the ones that call
+// out over http. It returns nil if there are none.
+func New(cfgs []*config.ResultHook, client *http.Client) (*Chain, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	c := &Chain{}
+	for i, cfg := range cfgs {
+		f := factoryFor(cfg.Type)
+		if f == nil {
+			return nil, fmt.Errorf("result hook %d: unknown type: %s", i, cfg.Type)
+		}
+
+		h, err := f(cfg, client)
+		if err != nil {
+			return nil, fmt.Errorf("result hook %d: %s", i, err)
+		}
+		c.entries = append(c.entries, &entry{cfg, h})
+	}
+	return c, nil
+}
+
+// Process runs the results of a search through each hook. A hook that
+// fails fails the search, unless it fails open.
+func (c *Chain) Process(req *Request, res *Response) error {
+	if c == nil {
+		return nil
+	}
+
+	for i, e := range c.entries {
+		if err := e.hook.Process(req, res); err != nil {
+			if !e.cfg.FailOpen {
+				return fmt.Errorf("result hook %d: %s", i, err)
+			}
+			log.Printf("failed to run result hook %d (%s), skipping it: %s", i, e.cfg.Type, err)
+		}
+	}
+	return nil
+}
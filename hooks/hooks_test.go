@@ -0,0 +1,151 @@
+package hooks
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+)
+
+func testResponse() *Response {
+	return &Response{Results: map[string]*index.SearchResponse{
+		"hound": {
+			Matches: []*index.FileMatch{{
+				Filename: "config.go",
+				Matches:  []*index.Match{{Line: `password = "hunter2"`, LineNumber: 3}},
+			}},
+			FilesWithMatch: 1,
+		},
+	}}
+}
+
+func TestHTTPHook(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			http.Error(w, "no", http.StatusUnauthorized)
+			return
+		}
+
+		var body struct {
+			Endpoint string     `json:"endpoint"`
+			Params   url.Values `json:"params"`
+			Response Response   `json:"response"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if body.Endpoint != "search" || body.Params.Get("q") != "password" {
+			http.Error(w, "unexpected search", http.StatusBadRequest)
+			return
+		}
+
+		for _, sr := range body.Response.Results {
+			for _, fm := range sr.Matches {
+				fm.URL = "https://code.example.com/" + fm.Filename
+				fm.Metadata = map[string]interface{}{"team": "platform"}
+				for _, m := range fm.Matches {
+					m.Line = strings.Replace(m.Line, "hunter2", "[redacted]", -1)
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(&body.Response)
+	}))
+	defer srv.Close()
+
+	c, err := New([]*config.ResultHook{{
+		Type:        "http",
+		URL:         srv.URL,
+		HTTPHeaders: map[string]string{"X-Token": "secret"},
+		TimeoutMs:   2000,
+	}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := testResponse()
+	req := &Request{Endpoint: "search", Params: url.Values{"q": {"password"}}}
+	if err := c.Process(req, res); err != nil {
+		t.Fatal(err)
+	}
+
+	fm := res.Results["hound"].Matches[0]
+	if got := fm.Matches[0].Line; got != `password = "[redacted]"` {
+		t.Fatalf("expected the line to be redacted, got %s", got)
+	}
+	if fm.URL != "https://code.example.com/config.go" || fm.Metadata["team"] != "platform" {
+		t.Fatalf("expected the url and metadata to be set, got %s and %v", fm.URL, fm.Metadata)
+	}
+	if res.Results["hound"].FilesWithMatch != 1 {
+		t.Fatalf("expected the rest of the results to be kept, got %+v", res.Results["hound"])
+	}
+}
+
+type funcHook func(req *Request, res *Response) error
+
+func (f funcHook) Process(req *Request, res *Response) error {
+	return f(req, res)
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	Register("test", func(cfg *config.ResultHook, client *http.Client) (Hook, error) {
+		name := string(cfg.Config)
+		return funcHook(func(req *Request, res *Response) error {
+			order = append(order, name)
+			if name == `"fails"` {
+				return errors.New("broken")
+			}
+			return nil
+		}), nil
+	})
+
+	c, err := New([]*config.ResultHook{
+		{Type: "test", Config: json.RawMessage(`"first"`)},
+		{Type: "test", Config: json.RawMessage(`"fails"`), FailOpen: true},
+		{Type: "test", Config: json.RawMessage(`"last"`)},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Process(&Request{}, testResponse()); err != nil {
+		t.Fatalf("expected a hook that fails open not to fail the search, got %s", err)
+	}
+	if got := strings.Join(order, " "); got != `"first" "fails" "last"` {
+		t.Fatalf("expected the hooks to run in order, got %s", got)
+	}
+
+	c.entries[1].cfg.FailOpen = false
+	if err := c.Process(&Request{}, testResponse()); err == nil {
+		t.Fatal("expected a hook that fails closed to fail the search")
+	}
+
+	var nilChain *Chain
+	if err := nilChain.Process(&Request{}, testResponse()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if c, err := New(nil, nil); c != nil || err != nil {
+		t.Fatalf("expected no chain without hooks, got %v, %v", c, err)
+	}
+
+	bad := []*config.ResultHook{
+		{Type: "magic"},
+		{Type: "http"},
+		{Type: "plugin"},
+	}
+	for _, cfg := range bad {
+		if _, err := New([]*config.ResultHook{cfg}, nil); err == nil {
+			t.Errorf("expected a %s hook of %+v to fail", cfg.Type, cfg)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/hound-search/hound/config"
+)
+
+// A hook that posts the search and its results to a service, which sends
+// back the results as they should be.
+type httpHook struct {
+	cfg    *config.ResultHook
+	client *http.Client
+}
+
+func newHTTPHook(cfg *config.ResultHook, client *http.Client) (Hook, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("an http hook needs a url")
+	}
+	return &httpHook{cfg, client}, nil
+}
+
+func (h *httpHook) Process(req *Request, res *Response) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"endpoint": req.Endpoint,
+		"params":   req.Params,
+		"response": res,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.cfg.Timeout())
+	defer cancel()
+
+	r, err := http.NewRequest("POST", h.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+	for k, v := range h.cfg.HTTPHeaders {
+		r.Header.Set(k, v)
+	}
+
+	resp, err := h.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	// the results are only replaced once all of them have been read.
+	var out Response
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return err
+	}
+	res.Results = out.Results
+	return nil
+}
@@ -0,0 +1,38 @@
+package hooks
+
+import (
+	"fmt"
+	"net/http"
+	"plugin"
+
+	"github.com/hound-search/hound/config"
+)
+
+// The symbol that a Go plugin exports to make its hook, with the type
+// func(cfg *config.ResultHook) (hooks.Hook, error).
+const pluginSymbol = "NewHook"
+
+// Open a Go plugin and make its hook. Plugins have to be built with the
+// same version of Go and of the packages of hound as houndd, and only
+// work where Go supports them.
+func newPluginHook(cfg *config.ResultHook, client *http.Client) (Hook, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("a plugin hook needs a path")
+	}
+
+	p, err := plugin.Open(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	sym, err := p.Lookup(pluginSymbol)
+	if err != nil {
+		return nil, err
+	}
+
+	newHook, ok := sym.(func(*config.ResultHook) (Hook, error))
+	if !ok {
+		return nil, fmt.Errorf("%s of %s is a %T, not a func(*config.ResultHook) (hooks.Hook, error)", pluginSymbol, cfg.Path, sym)
+	}
+	return newHook(cfg)
+}
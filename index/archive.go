@@ -0,0 +1,148 @@
+package index
+
+import (
+	"compress/gzip"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hound-search/hound/codesearch/index"
+)
+
+// The trigram index of an archived index, compressed, in place of "tri".
+const archivedFilename = "tri.gz"
+
+// Whether the index in dir was archived, having its compressed trigram
+// index but not the trigram index itself.
+func archivedDir(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, "tri")); err == nil {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(dir, archivedFilename))
+	return err == nil
+}
+
+// Copy the file src to dst through filter, writing to a temporary file
+// that replaces dst once it is complete.
+func copyFileThrough(dst, src string, filter func(w io.Writer, r io.Reader) error) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	tmp := dst + ".tmp"
+	w, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := filter(w, r); err != nil {
+		w.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := w.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+func compress(w io.Writer, r io.Reader) error {
+	c := gzip.NewWriter(w)
+	if _, err := io.Copy(c, r); err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+func decompress(w io.Writer, r io.Reader) error {
+	c, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	_, err = io.Copy(w, c)
+	return err
+}
+
+// Archive compresses the trigram index and closes it, so that the index
+// holds neither memory nor files until a search wakes it. Indexes that
+// are loaded into memory are left as they are.
+func (n *Index) Archive() error {
+	n.lck.Lock()
+	defer n.lck.Unlock()
+
+	if n.idx == nil || n.mem != nil {
+		return nil
+	}
+
+	tri := filepath.Join(n.Ref.dir, "tri")
+	if err := copyFileThrough(filepath.Join(n.Ref.dir, archivedFilename), tri, compress); err != nil {
+		return err
+	}
+
+	if err := n.idx.Close(); err != nil {
+		return err
+	}
+	n.idx = nil
+	return os.Remove(tri)
+}
+
+// Archived is whether the index has been archived and not woken since.
+func (n *Index) Archived() bool {
+	n.lck.RLock()
+	defer n.lck.RUnlock()
+	return n.idx == nil
+}
+
+// Wake decompresses the trigram index of an archived index and opens it
+// again, returning how long that took. Searches wake an index on their
+// own.
+func (n *Index) Wake() (time.Duration, error) {
+	n.lck.Lock()
+	defer n.lck.Unlock()
+
+	if n.idx != nil {
+		return 0, nil
+	}
+
+	startedAt := time.Now()
+	tri := filepath.Join(n.Ref.dir, "tri")
+	gz := filepath.Join(n.Ref.dir, archivedFilename)
+	if err := copyFileThrough(tri, gz, decompress); err != nil {
+		return 0, err
+	}
+	if err := os.Remove(gz); err != nil {
+		return 0, err
+	}
+
+	n.idx = index.Open(tri)
+
+	took := time.Since(startedAt)
+	log.Printf("Woke the archived index of %s in %s", n.Ref.Url, took)
+	return took, nil
+}
+
+// Take the read lock of the index, waking it first if it was archived,
+// and return how long waking it took.
+func (n *Index) rlock() (time.Duration, error) {
+	var woken time.Duration
+	for {
+		n.lck.RLock()
+		if n.idx != nil {
+			return woken, nil
+		}
+		n.lck.RUnlock()
+
+		d, err := n.Wake()
+		if err != nil {
+			return 0, err
+		}
+		woken += d
+	}
+}
@@ -0,0 +1,75 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchive(t *testing.T) {
+	ref, err := buildIndex(url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	exp, err := idx.Search("func", &SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.Archive(); err != nil {
+		t.Fatal(err)
+	}
+	if !idx.Archived() {
+		t.Fatal("expected the index to be archived")
+	}
+	if _, err := os.Stat(filepath.Join(ref.Dir(), "tri")); !os.IsNotExist(err) {
+		t.Fatalf("expected the trigram index to be gone, got %v", err)
+	}
+
+	// an archived index is verified as it was built.
+	if _, err := Verify(ref.Dir()); err != nil {
+		t.Fatal(err)
+	}
+
+	// and opens archived.
+	reopened, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reopened.Archived() {
+		t.Fatal("expected the index to open archived")
+	}
+	reopened.Close()
+
+	// a search wakes it.
+	res, err := idx.Search("func", &SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.Archived() {
+		t.Fatal("expected the search to wake the index")
+	}
+	if res.FilesWithMatch != exp.FilesWithMatch {
+		t.Fatalf("expected %d files with matches, got %d", exp.FilesWithMatch, res.FilesWithMatch)
+	}
+	if _, err := os.Stat(filepath.Join(ref.Dir(), archivedFilename)); !os.IsNotExist(err) {
+		t.Fatalf("expected the archive to be gone, got %v", err)
+	}
+
+	// the next search doesn't wait.
+	res, err = idx.Search("func", &SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.WokenMs != 0 {
+		t.Fatalf("expected no wait for an index that is awake, got %dms", res.WokenMs)
+	}
+}
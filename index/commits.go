@@ -0,0 +1,145 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const commitsFilename = "commits.json"
+
+// FileCommit is the last commit that changed a file.
+type FileCommit struct {
+	Time time.Time
+
+	// The author of the commit, as Name <email>, if authors are recorded.
+	Author string `json:",omitempty"`
+}
+
+// The last commits of the files of a repo, by path.
+type commits map[string]*FileCommit
+
+// The last commit of a file, or nil if it isn't known.
+func (c commits) of(name string) *FileCommit {
+	if c == nil {
+		return nil
+	}
+	return c[name]
+}
+
+// The time that the last commit of a file was made, if it is known.
+func (c commits) modified(name string) *time.Time {
+	if fc := c.of(name); fc != nil {
+		t := fc.Time
+		return &t
+	}
+	return nil
+}
+
+// Who made the last commit of a file, if that is known.
+func (c commits) author(name string) string {
+	if fc := c.of(name); fc != nil {
+		return fc.Author
+	}
+	return ""
+}
+
+// Whether the last commit of a file was made by someone whose name or
+// email has who, in lower case, in it.
+func (c commits) authoredBy(name, who string) bool {
+	a := c.author(name)
+	return a != "" && strings.Contains(strings.ToLower(a), who)
+}
+
+// The time of the newest of the commits, or the zero time if none are
+// known.
+func (c commits) newest() time.Time {
+	var t time.Time
+	for _, fc := range c {
+		if fc.Time.After(t) {
+			t = fc.Time
+		}
+	}
+	return t
+}
+
+// A span of time that the last commit of a file has to be in, from its
+// start up to but not including its end. Either may be zero, for a span
+// without that end.
+type timeSpan struct {
+	from, to time.Time
+}
+
+func (s *timeSpan) contains(t time.Time) bool {
+	return (s.from.IsZero() || !t.Before(s.from)) && (s.to.IsZero() || t.Before(s.to))
+}
+
+// Parse a modified: filter: >, >=, < or <= a date or an RFC 3339 time,
+// or a date alone for that day. A date is a day in UTC, so >2024-01-01 is
+// from the start of the next day.
+func parseModified(v string) (*timeSpan, error) {
+	var op string
+	for _, o := range []string{">=", "<=", ">", "<"} {
+		if strings.HasPrefix(v, o) {
+			op, v = o, v[len(o):]
+			break
+		}
+	}
+
+	var start, end time.Time
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		start, end = t, t.Add(time.Nanosecond)
+	} else if t, err := time.Parse("2006-01-02", v); err == nil {
+		start, end = t, t.AddDate(0, 0, 1)
+	} else {
+		return nil, fmt.Errorf("Invalid modified time %q, expected a date like 2006-01-02 or an RFC 3339 time", v)
+	}
+
+	switch op {
+	case ">":
+		return &timeSpan{from: end}, nil
+	case ">=":
+		return &timeSpan{from: start}, nil
+	case "<":
+		return &timeSpan{to: start}, nil
+	case "<=":
+		return &timeSpan{to: end}, nil
+	}
+	return &timeSpan{from: start, to: end}, nil
+}
+
+func writeCommitsJson(filename string, c commits) error {
+	w, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	return json.NewEncoder(w).Encode(c)
+}
+
+// Read the last commits of the files of the repo, if they were recorded.
+func loadCommits(dir string) (commits, error) {
+	r, err := os.Open(filepath.Join(dir, commitsFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var c commits
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LastCommit is the time of the newest commit of the files of the index,
+// which is the zero time unless their commits were recorded.
+func (n *Index) LastCommit() time.Time {
+	return n.commits.newest()
+}
@@ -0,0 +1,135 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseModified(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		v    string
+		in   []time.Time
+		out  []time.Time
+		fail bool
+	}{
+		{v: ">2024-01-02", in: []time.Time{day(3)}, out: []time.Time{day(2), day(2).Add(time.Hour)}},
+		{v: ">=2024-01-02", in: []time.Time{day(2), day(3)}, out: []time.Time{day(1)}},
+		{v: "<2024-01-02", in: []time.Time{day(1)}, out: []time.Time{day(2)}},
+		{v: "<=2024-01-02", in: []time.Time{day(2).Add(time.Hour)}, out: []time.Time{day(3)}},
+		{v: "2024-01-02", in: []time.Time{day(2), day(2).Add(23 * time.Hour)}, out: []time.Time{day(1), day(3)}},
+		{v: ">2024-01-02T12:00:00Z", in: []time.Time{day(2).Add(13 * time.Hour)}, out: []time.Time{day(2).Add(12 * time.Hour)}},
+		{v: ">last week", fail: true},
+	}
+	for _, test := range tests {
+		span, err := parseModified(test.v)
+		if test.fail {
+			if err == nil {
+				t.Errorf("expected an error for %q", test.v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tm := range test.in {
+			if !span.contains(tm) {
+				t.Errorf("expected %q to contain %s", test.v, tm)
+			}
+		}
+		for _, tm := range test.out {
+			if span.contains(tm) {
+				t.Errorf("expected %q not to contain %s", test.v, tm)
+			}
+		}
+	}
+}
+
+func TestCommitTimes(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	writeTestFile(t, src, "old/handler.go", "func handle() {}\n")
+	writeTestFile(t, src, "new/handler.go", "func handle() {}\n")
+	writeTestFile(t, src, "untracked.go", "func handle() {}\n")
+
+	dst, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)
+	recent := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	ref, err := Build(&IndexOptions{
+		Commits: func(dir string) (map[string]*FileCommit, error) {
+			if dir != src {
+				t.Fatalf("expected the commits of %s, got %s", src, dir)
+			}
+			return map[string]*FileCommit{
+				"old/handler.go": {Time: old, Author: "Bob <bob@example.com>"},
+				"new/handler.go": {Time: recent, Author: "Jane Doe <jane@example.com>"},
+			}, nil
+		},
+	}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	files := func(opt *SearchOptions) []string {
+		res, err := idx.Search("handle", opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, fm := range res.Matches {
+			names = append(names, fm.Filename)
+			if exp := idx.commits.modified(fm.Filename); !reflect.DeepEqual(fm.Modified, exp) {
+				t.Errorf("expected %s to have been modified at %v, got %v", fm.Filename, exp, fm.Modified)
+			}
+			if exp := idx.commits.author(fm.Filename); fm.Author != exp {
+				t.Errorf("expected %s to have been changed by %q, got %q", fm.Filename, exp, fm.Author)
+			}
+		}
+		return names
+	}
+
+	tests := []struct {
+		opt *SearchOptions
+		exp []string
+	}{
+		{&SearchOptions{Sort: SortMtime}, []string{"new/handler.go", "old/handler.go", "untracked.go"}},
+		{&SearchOptions{Modified: ">2024-01-01"}, []string{"new/handler.go"}},
+		{&SearchOptions{Modified: "<2024-01-01"}, []string{"old/handler.go"}},
+		{&SearchOptions{Modified: "2019-05-01", Sort: SortPath}, []string{"old/handler.go"}},
+		{&SearchOptions{Author: "JANE"}, []string{"new/handler.go"}},
+		{&SearchOptions{Author: "bob@example"}, []string{"old/handler.go"}},
+		{&SearchOptions{Author: "bob", Modified: ">2024-01-01"}, nil},
+	}
+	for _, test := range tests {
+		if got := files(test.opt); !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%+v: expected %v, got %v", test.opt, test.exp, got)
+		}
+	}
+
+	if _, err := idx.Search("handle", &SearchOptions{Modified: "yesterday"}); err == nil {
+		t.Fatal("expected an error for a bad modified time")
+	}
+}
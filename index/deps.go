@@ -0,0 +1,270 @@
+package index
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const depsFilename = "deps.json"
+
+// Dependency is a library that one of the manifests of a repo depends on.
+type Dependency struct {
+	Name    string
+	Version string `json:",omitempty"`
+
+	// The manifest, relative to the root of the repo.
+	File string
+
+	// Whether the dependency is only needed for development, or is only
+	// there for another dependency, where the manifest says so.
+	Dev      bool `json:",omitempty"`
+	Indirect bool `json:",omitempty"`
+}
+
+// Find the reader of the manifest with the given file name, if it is one.
+func depsReaderFor(name string) func(io.Reader) ([]*Dependency, error) {
+	switch {
+	case name == "go.mod":
+		return readGoModDeps
+	case name == "package.json":
+		return readPackageJsonDeps
+	case strings.HasPrefix(name, "requirements") && strings.HasSuffix(name, ".txt"):
+		return readRequirementsDeps
+	case strings.HasSuffix(name, ".csproj"):
+		return readCsprojDeps
+	}
+	return nil
+}
+
+// Read the requirements of a go.mod, in either of their forms.
+func readGoModDeps(r io.Reader) ([]*Dependency, error) {
+	var deps []*Dependency
+	block := false
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		indirect := false
+		if i := strings.Index(line, "//"); i >= 0 {
+			indirect = strings.TrimSpace(line[i+2:]) == "indirect"
+			line = line[:i]
+		}
+
+		f := strings.Fields(line)
+		switch {
+		case len(f) == 0:
+			continue
+		case block && f[0] == ")":
+			block = false
+			continue
+		case !block && f[0] == "require":
+			if len(f) == 2 && f[1] == "(" {
+				block = true
+				continue
+			}
+			f = f[1:]
+		case !block:
+			continue
+		}
+
+		if len(f) != 2 {
+			continue
+		}
+
+		name := f[0]
+		if p, err := strconv.Unquote(name); err == nil {
+			name = p
+		}
+		deps = append(deps, &Dependency{
+			Name:     name,
+			Version:  f[1],
+			Indirect: indirect,
+		})
+	}
+
+	return deps, s.Err()
+}
+
+// Read the dependencies of all the kinds in a package.json.
+func readPackageJsonDeps(r io.Reader) ([]*Dependency, error) {
+	var pkg struct {
+		Dependencies         map[string]string `json:"dependencies"`
+		DevDependencies      map[string]string `json:"devDependencies"`
+		PeerDependencies     map[string]string `json:"peerDependencies"`
+		OptionalDependencies map[string]string `json:"optionalDependencies"`
+	}
+	if err := json.NewDecoder(r).Decode(&pkg); err != nil {
+		return nil, nil
+	}
+
+	var deps []*Dependency
+	add := func(m map[string]string, dev bool) {
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			deps = append(deps, &Dependency{Name: name, Version: m[name], Dev: dev})
+		}
+	}
+	add(pkg.Dependencies, false)
+	add(pkg.PeerDependencies, false)
+	add(pkg.OptionalDependencies, false)
+	add(pkg.DevDependencies, true)
+	return deps, nil
+}
+
+// Read the requirements of a pip requirements file. Options, like the
+// files it includes, and requirements that aren't on a package index,
+// like urls, are skipped.
+func readRequirementsDeps(r io.Reader) ([]*Dependency, error) {
+	var deps []*Dependency
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		// the environment markers, and the hashes of the requirement.
+		if i := strings.IndexByte(line, ';'); i >= 0 {
+			line = line[:i]
+		}
+		if i := strings.Index(line, " --"); i >= 0 {
+			line = line[:i]
+		}
+
+		line = strings.Join(strings.Fields(line), "")
+		if line == "" || line[0] == '-' || strings.Contains(line, "://") {
+			continue
+		}
+
+		name, ver := line, ""
+		if i := strings.IndexAny(line, "=<>~!"); i >= 0 {
+			name, ver = line[:i], line[i:]
+		}
+
+		// the extras of the package, like requests[security].
+		if i := strings.IndexByte(name, '['); i >= 0 {
+			name = name[:i]
+		}
+
+		deps = append(deps, &Dependency{Name: name, Version: ver})
+	}
+
+	return deps, s.Err()
+}
+
+// Read the package references of an msbuild project, with their version in
+// either an attribute or an element.
+func readCsprojDeps(r io.Reader) ([]*Dependency, error) {
+	var proj struct {
+		Items []struct {
+			Refs []struct {
+				Include        string `xml:"Include,attr"`
+				Update         string `xml:"Update,attr"`
+				Version        string `xml:"Version,attr"`
+				VersionElement string `xml:"Version"`
+			} `xml:"PackageReference"`
+		} `xml:"ItemGroup"`
+	}
+	if err := xml.NewDecoder(r).Decode(&proj); err != nil {
+		return nil, nil
+	}
+
+	var deps []*Dependency
+	for _, item := range proj.Items {
+		for _, ref := range item.Refs {
+			name, ver := ref.Include, ref.Version
+			if name == "" {
+				name = ref.Update
+			}
+			if ver == "" {
+				ver = strings.TrimSpace(ref.VersionElement)
+			}
+			if name != "" {
+				deps = append(deps, &Dependency{Name: name, Version: ver})
+			}
+		}
+	}
+	return deps, nil
+}
+
+// Read the dependencies of a manifest, given the reader for its kind.
+func readDeps(filename, rel string, read func(io.Reader) ([]*Dependency, error)) ([]*Dependency, error) {
+	r, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	deps, err := read(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range deps {
+		d.File = filepath.ToSlash(rel)
+	}
+	return deps, nil
+}
+
+func writeDepsJson(filename string, deps []*Dependency) error {
+	w, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	return json.NewEncoder(w).Encode(deps)
+}
+
+// Dependencies reads the dependencies that were found in the manifests of
+// the repo when it was indexed.
+func (n *Index) Dependencies() ([]*Dependency, error) {
+	r, err := os.Open(filepath.Join(n.Ref.dir, depsFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var deps []*Dependency
+	if err := json.NewDecoder(r).Decode(&deps); err != nil {
+		return nil, err
+	}
+	return deps, nil
+}
+
+// Trim the operators and the v of a version, as in ^1.2.0 or v1.2.0.
+func bareVersion(v string) string {
+	return strings.TrimLeft(strings.TrimSpace(v), "^~=<>!v ")
+}
+
+// Matches reports whether d is a dependency on the library name. Names
+// are compared without case. If version is set, the version that d asks
+// for has to be it or start with it, so 1.2 matches ^1.2.3 but not 1.20.
+func (d *Dependency) Matches(name, version string) bool {
+	if !strings.EqualFold(d.Name, name) {
+		return false
+	}
+
+	if version == "" {
+		return true
+	}
+
+	want, have := bareVersion(version), bareVersion(d.Version)
+	return have == want || strings.HasPrefix(have, want+".") ||
+		strings.HasPrefix(have, want+"-") || strings.HasPrefix(have, want+"+")
+}
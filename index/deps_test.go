@@ -0,0 +1,149 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadDeps(t *testing.T) {
+	tests := []struct {
+		file     string
+		data     string
+		expected []*Dependency
+	}{
+		{"go.mod", `module github.com/acme/foo
+
+go 1.21
+
+require github.com/pkg/errors v0.9.1
+
+require (
+	golang.org/x/sync v0.5.0
+	"golang.org/x/text" v0.14.0 // indirect
+)
+
+replace golang.org/x/sync => ../sync
+`, []*Dependency{
+			{Name: "github.com/pkg/errors", Version: "v0.9.1"},
+			{Name: "golang.org/x/sync", Version: "v0.5.0"},
+			{Name: "golang.org/x/text", Version: "v0.14.0", Indirect: true},
+		}},
+		{"package.json", `{
+  "name": "web",
+  "dependencies": {"react": "^18.2.0", "lodash": "4.17.21"},
+  "devDependencies": {"jest": "~29.7.0"}
+}`, []*Dependency{
+			{Name: "lodash", Version: "4.17.21"},
+			{Name: "react", Version: "^18.2.0"},
+			{Name: "jest", Version: "~29.7.0", Dev: true},
+		}},
+		{"requirements-dev.txt", `# pinned
+-r requirements.txt
+--index-url https://pypi.example.com/simple
+requests[security] >= 2.31.0 ; python_version >= "3.8"
+Django==4.2.7 --hash=sha256:abc
+flask
+git+https://github.com/acme/lib.git#egg=lib
+`, []*Dependency{
+			{Name: "requests", Version: ">=2.31.0"},
+			{Name: "Django", Version: "==4.2.7"},
+			{Name: "flask"},
+		}},
+		{"App.csproj", `<Project Sdk="Microsoft.NET.Sdk">
+  <ItemGroup>
+    <PackageReference Include="Newtonsoft.Json" Version="13.0.3" />
+    <PackageReference Include="Serilog">
+      <Version>3.1.1</Version>
+    </PackageReference>
+  </ItemGroup>
+</Project>`, []*Dependency{
+			{Name: "Newtonsoft.Json", Version: "13.0.3"},
+			{Name: "Serilog", Version: "3.1.1"},
+		}},
+	}
+
+	for _, test := range tests {
+		read := depsReaderFor(test.file)
+		if read == nil {
+			t.Fatalf("%s: expected a reader", test.file)
+		}
+
+		got, err := read(strings.NewReader(test.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.file, test.expected, got)
+		}
+	}
+
+	if depsReaderFor("main.go") != nil {
+		t.Fatal("expected main.go not to be a manifest")
+	}
+}
+
+func TestDependencyMatches(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+		match   bool
+	}{
+		{"^1.2.3", "", true},
+		{"^1.2.3", "1.2", true},
+		{"v1.2.3", "1.2.3", true},
+		{"==1.20.0", "1.2", false},
+		{"1.2.3-beta.1", "1.2.3", true},
+		{"2.0.0", "1", false},
+	}
+
+	for _, test := range tests {
+		d := &Dependency{Name: "Lib", Version: test.version}
+		if got := d.Matches("lib", test.want); got != test.match {
+			t.Errorf("%s matching %q: expected %v, got %v", test.version, test.want, test.match, got)
+		}
+	}
+
+	if (&Dependency{Name: "lib"}).Matches("other", "") {
+		t.Fatal("expected a different name not to match")
+	}
+}
+
+func TestIndexDependencies(t *testing.T) {
+	src, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	writeTestFile(t, src, "svc/go.mod", "module x\n\nrequire github.com/pkg/errors v0.9.1\n")
+
+	dst, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	ref, err := Build(&IndexOptions{}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	deps, err := idx.Dependencies()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*Dependency{{Name: "github.com/pkg/errors", Version: "v0.9.1", File: "svc/go.mod"}}
+	if !reflect.DeepEqual(deps, expected) {
+		t.Fatalf("expected %v, got %v", expected, deps)
+	}
+}
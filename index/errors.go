@@ -0,0 +1,21 @@
+package index
+
+import "errors"
+
+// ErrCancelled is the error of a search that was cancelled before it was
+// done.
+var ErrCancelled = errors.New("the search was cancelled")
+
+// QueryError is the error of a search whose pattern or options are
+// invalid, as opposed to one that failed to read the index.
+type QueryError struct {
+	Err error
+}
+
+func (e *QueryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
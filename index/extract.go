@@ -0,0 +1,394 @@
+package index
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Converter pulls the text out of a kind of document, like a PDF, so
+// that it can be indexed in the place of the document.
+type Converter interface {
+	Convert(path string) ([]byte, error)
+}
+
+// Extraction is the converters of the documents of a repo, by extension,
+// and the most text that is taken from one file.
+type Extraction struct {
+	Converters map[string]Converter
+	MaxBytes   int64
+}
+
+var errTooMuchText = errors.New("too much text")
+
+// The converter of the file at path, or nil if its text isn't extracted.
+func (e *Extraction) converterFor(path string) Converter {
+	if e == nil {
+		return nil
+	}
+	return e.Converters[strings.ToLower(filepath.Ext(path))]
+}
+
+// A buffer that fails once it has more than max bytes, if max is set. It
+// doesn't embed its buffer so that io.Copy can't write around the limit.
+type limitedBuffer struct {
+	buf bytes.Buffer
+	max int64
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.max > 0 && int64(b.buf.Len()+len(p)) > b.max {
+		return 0, errTooMuchText
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) WriteString(s string) (int, error) {
+	return b.Write([]byte(s))
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// Extract the text of a file with c, at most max bytes of it.
+func extractText(c Converter, path string, max int64) ([]byte, error) {
+	data, err := c.Convert(path)
+	if err != nil {
+		return nil, err
+	}
+	if max > 0 && int64(len(data)) > max {
+		return nil, errTooMuchText
+	}
+	return data, nil
+}
+
+// CommandConverter runs a command that writes the text of a file to its
+// output. A {path} in args is replaced with the path of the file.
+type CommandConverter struct {
+	Args    []string
+	Timeout time.Duration
+
+	// The most output that is read.
+	MaxBytes int64
+}
+
+// Convert runs the command on the file at path.
+func (c *CommandConverter) Convert(path string) ([]byte, error) {
+	if len(c.Args) == 0 {
+		return nil, errors.New("no command")
+	}
+
+	ctx := context.Background()
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = strings.Replace(arg, "{path}", path, -1)
+	}
+
+	var out limitedBuffer
+	out.max = c.MaxBytes
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %s", err, msg)
+		}
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// OfficeConverters are the built in converters of Word, Excel and
+// PowerPoint files, which are zips of XML. They stop once they have more
+// than max bytes of text, if max is set.
+func OfficeConverters(max int64) map[string]Converter {
+	return map[string]Converter{
+		".docx": &officeConverter{convertDocx, max},
+		".xlsx": &officeConverter{convertXlsx, max},
+		".pptx": &officeConverter{convertPptx, max},
+	}
+}
+
+type officeConverter struct {
+	convert func(z *zip.Reader, w *limitedBuffer) error
+	max     int64
+}
+
+func (c *officeConverter) Convert(path string) ([]byte, error) {
+	z, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	w := limitedBuffer{max: c.max}
+	if err := c.convert(&z.Reader, &w); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// The files of a zip by name.
+func zipFiles(z *zip.Reader) map[string]*zip.File {
+	files := map[string]*zip.File{}
+	for _, f := range z.File {
+		files[f.Name] = f
+	}
+	return files
+}
+
+// The files of a zip whose names are prefix, a number and suffix, in the
+// order of the numbers, like the slides of a presentation.
+func numberedFiles(z *zip.Reader, prefix, suffix string) []*zip.File {
+	type numbered struct {
+		n int
+		f *zip.File
+	}
+
+	var files []numbered
+	for _, f := range z.File {
+		if !strings.HasPrefix(f.Name, prefix) || !strings.HasSuffix(f.Name, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(f.Name, prefix), suffix))
+		if err != nil {
+			continue
+		}
+		files = append(files, numbered{n, f})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].n < files[j].n })
+	res := make([]*zip.File, len(files))
+	for i, f := range files {
+		res[i] = f.f
+	}
+	return res
+}
+
+// Walk the elements of an XML file of a zip, calling start and end for
+// each element and text for the text in them.
+func walkXML(f *zip.File, start func(xml.StartElement) error, end func(xml.EndElement) error, text func([]byte) error) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if start != nil {
+				err = start(t)
+			}
+		case xml.EndElement:
+			if end != nil {
+				err = end(t)
+			}
+		case xml.CharData:
+			if text != nil {
+				err = text(t)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Write out the text of the runs of paragraphs, a line for each paragraph,
+// which is how both Word and PowerPoint keep their text.
+func paragraphText(f *zip.File, w *limitedBuffer, para string) error {
+	inText := false
+	return walkXML(f,
+		func(e xml.StartElement) error {
+			switch e.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				_, err := w.WriteString("\t")
+				return err
+			case "br", "cr":
+				_, err := w.WriteString("\n")
+				return err
+			}
+			return nil
+		},
+		func(e xml.EndElement) error {
+			switch e.Name.Local {
+			case "t":
+				inText = false
+			case para:
+				_, err := w.WriteString("\n")
+				return err
+			}
+			return nil
+		},
+		func(b []byte) error {
+			if !inText {
+				return nil
+			}
+			_, err := w.Write(b)
+			return err
+		})
+}
+
+func convertDocx(z *zip.Reader, w *limitedBuffer) error {
+	doc := zipFiles(z)["word/document.xml"]
+	if doc == nil {
+		return errors.New("not a Word document")
+	}
+	return paragraphText(doc, w, "p")
+}
+
+func convertPptx(z *zip.Reader, w *limitedBuffer) error {
+	slides := numberedFiles(z, "ppt/slides/slide", ".xml")
+	if len(slides) == 0 {
+		return errors.New("not a PowerPoint presentation")
+	}
+
+	for i, slide := range slides {
+		if i > 0 {
+			if _, err := w.WriteString("\n"); err != nil {
+				return err
+			}
+		}
+		if err := paragraphText(slide, w, "p"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The strings that the cells of a workbook refer to by their index.
+func sharedStrings(z *zip.Reader) ([]string, error) {
+	f := zipFiles(z)["xl/sharedStrings.xml"]
+	if f == nil {
+		return nil, nil
+	}
+
+	var strs []string
+	var cur strings.Builder
+	inText := false
+	err := walkXML(f,
+		func(e xml.StartElement) error {
+			if e.Name.Local == "t" {
+				inText = true
+			}
+			return nil
+		},
+		func(e xml.EndElement) error {
+			switch e.Name.Local {
+			case "t":
+				inText = false
+			case "si":
+				strs = append(strs, cur.String())
+				cur.Reset()
+			}
+			return nil
+		},
+		func(b []byte) error {
+			if inText {
+				cur.Write(b)
+			}
+			return nil
+		})
+	return strs, err
+}
+
+// Write out the cells of each sheet, a line for each row with the cells
+// separated by tabs and a blank line between sheets.
+func convertXlsx(z *zip.Reader, w *limitedBuffer) error {
+	sheets := numberedFiles(z, "xl/worksheets/sheet", ".xml")
+	if len(sheets) == 0 {
+		return errors.New("not an Excel workbook")
+	}
+
+	strs, err := sharedStrings(z)
+	if err != nil {
+		return err
+	}
+
+	for i, sheet := range sheets {
+		if i > 0 {
+			if _, err := w.WriteString("\n"); err != nil {
+				return err
+			}
+		}
+
+		var cells []string
+		var typ string
+		var val strings.Builder
+		inVal := false
+		err := walkXML(sheet,
+			func(e xml.StartElement) error {
+				switch e.Name.Local {
+				case "c":
+					typ = ""
+					for _, a := range e.Attr {
+						if a.Name.Local == "t" {
+							typ = a.Value
+						}
+					}
+					val.Reset()
+				case "v", "t":
+					inVal = true
+				}
+				return nil
+			},
+			func(e xml.EndElement) error {
+				switch e.Name.Local {
+				case "v", "t":
+					inVal = false
+				case "c":
+					v := val.String()
+					if typ == "s" {
+						if n, err := strconv.Atoi(v); err == nil && n >= 0 && n < len(strs) {
+							v = strs[n]
+						}
+					}
+					cells = append(cells, v)
+				case "row":
+					_, err := w.WriteString(strings.Join(cells, "\t") + "\n")
+					cells = cells[:0]
+					return err
+				}
+				return nil
+			},
+			func(b []byte) error {
+				if inVal {
+					val.Write(b)
+				}
+				return nil
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
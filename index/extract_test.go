@@ -0,0 +1,188 @@
+package index
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testDocx = `<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:r><w:t>The retry</w:t></w:r><w:r><w:t xml:space="preserve"> budget</w:t></w:r></w:p>
+<w:p><w:r><w:t>is</w:t><w:tab/><w:t>three.</w:t></w:r></w:p>
+</w:body></w:document>`
+
+	testSharedStrings = `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><si><t>region</t></si><si><t>eu-west</t></si></sst>`
+
+	testSheet = `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="inlineStr"><is><t>hosts</t></is></c></row>
+<row r="2"><c r="A2" t="s"><v>1</v></c><c r="B2"><v>12</v></c></row>
+</sheetData></worksheet>`
+
+	testSlide = `<?xml version="1.0" encoding="UTF-8"?>
+<p:sld xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main">
+<p:cSld><p:spTree><p:sp><p:txBody><a:p><a:r><a:t>%s</a:t></a:r></a:p></p:txBody></p:sp></p:spTree></p:cSld></p:sld>`
+)
+
+func writeTestZip(t *testing.T, dir, name string, files map[string]string) {
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	z := zip.NewWriter(w)
+	for name, data := range files {
+		f, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOfficeConverters(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestZip(t, dir, "spec.docx", map[string]string{"word/document.xml": testDocx})
+	writeTestZip(t, dir, "hosts.xlsx", map[string]string{
+		"xl/sharedStrings.xml":     testSharedStrings,
+		"xl/worksheets/sheet1.xml": testSheet,
+	})
+	writeTestZip(t, dir, "talk.pptx", map[string]string{
+		"ppt/slides/slide10.xml": strings.Replace(testSlide, "%s", "Last", 1),
+		"ppt/slides/slide2.xml":  strings.Replace(testSlide, "%s", "Second", 1),
+		"ppt/slides/slide1.xml":  strings.Replace(testSlide, "%s", "First", 1),
+	})
+	writeTestZip(t, dir, "empty.docx", map[string]string{"readme.txt": "not a document"})
+
+	convs := OfficeConverters(0)
+	for name, exp := range map[string]string{
+		"spec.docx":  "The retry budget\nis\tthree.\n",
+		"hosts.xlsx": "region\thosts\neu-west\t12\n",
+		"talk.pptx":  "First\n\nSecond\n\nLast\n",
+	} {
+		text, err := convs[filepath.Ext(name)].Convert(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if string(text) != exp {
+			t.Errorf("expected the text of %s to be %q, got %q", name, exp, text)
+		}
+	}
+
+	if _, err := convs[".docx"].Convert(filepath.Join(dir, "empty.docx")); err == nil {
+		t.Error("expected an error for a zip that isn't a document")
+	}
+
+	if _, err := OfficeConverters(10)[".docx"].Convert(filepath.Join(dir, "spec.docx")); err != errTooMuchText {
+		t.Errorf("expected %q for a document with too much text, got %v", errTooMuchText, err)
+	}
+}
+
+func TestCommandConverter(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestFile(t, dir, "a.pdf", "the text of a pdf\n")
+	path := filepath.Join(dir, "a.pdf")
+
+	text, err := (&CommandConverter{Args: []string{"cat", "{path}"}}).Convert(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != "the text of a pdf\n" {
+		t.Fatalf("expected the output of the command, got %q", text)
+	}
+
+	if _, err := (&CommandConverter{Args: []string{"cat", "{path}"}, MaxBytes: 4}).Convert(path); err == nil {
+		t.Error("expected an error for too much output")
+	}
+
+	if _, err := (&CommandConverter{Args: []string{"cat", filepath.Join(dir, "missing")}}).Convert(path); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected the error of the command, got %v", err)
+	}
+}
+
+func TestExtraction(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	writeTestFile(t, src, "main.go", "package main\n")
+	writeTestZip(t, src, "docs/spec.docx", map[string]string{"word/document.xml": testDocx})
+	writeTestZip(t, src, "docs/broken.docx", map[string]string{"readme.txt": "not a document"})
+	writeTestFile(t, src, "docs/design.pdf", "%PDF-1.4 the retry budget\n")
+
+	dst, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ex := &Extraction{Converters: OfficeConverters(0)}
+	ex.Converters[".pdf"] = &CommandConverter{Args: []string{"tail", "-c", "+10", "{path}"}}
+	ref, err := Build(&IndexOptions{Extraction: ex}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	res, err := idx.Search("retry budget", &SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := map[string]string{}
+	for _, fm := range res.Matches {
+		lines[fm.Filename] = fm.Matches[0].Line
+	}
+	if len(lines) != 2 || lines["docs/spec.docx"] != "The retry budget" || lines["docs/design.pdf"] != "the retry budget" {
+		t.Fatalf("expected matches in the text of the documents, got %v", lines)
+	}
+
+	r, err := os.Open(filepath.Join(dst, excludedFileJsonFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var excluded []*ExcludedFile
+	if err := json.NewDecoder(r).Decode(&excluded); err != nil {
+		t.Fatal(err)
+	}
+	if len(excluded) != 1 || excluded[0].Filename != "docs/broken.docx" || !strings.HasPrefix(excluded[0].Reason, "Could not extract its text") {
+		t.Fatalf("expected the broken document to be excluded, got %+v", excluded)
+	}
+}
@@ -0,0 +1,106 @@
+package index
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// The languages of files by their extension, for facets. The names are
+// those that the file filters of the UI use.
+var languagesByExt = map[string]string{
+	".c":        "C",
+	".h":        "C",
+	".cc":       "C++",
+	".cpp":      "C++",
+	".cxx":      "C++",
+	".hh":       "C++",
+	".hpp":      "C++",
+	".hxx":      "C++",
+	".cs":       "C#",
+	".css":      "CSS",
+	".less":     "CSS",
+	".scss":     "CSS",
+	".go":       "Go",
+	".htm":      "HTML",
+	".html":     "HTML",
+	".java":     "Java",
+	".js":       "JavaScript",
+	".jsx":      "JavaScript",
+	".mjs":      "JavaScript",
+	".json":     "JSON",
+	".kt":       "Kotlin",
+	".kts":      "Kotlin",
+	".md":       "Markdown",
+	".markdown": "Markdown",
+	".php":      "PHP",
+	".proto":    "Protobuf",
+	".py":       "Python",
+	".rb":       "Ruby",
+	".rs":       "Rust",
+	".scala":    "Scala",
+	".bash":     "Shell",
+	".sh":       "Shell",
+	".sql":      "SQL",
+	".swift":    "Swift",
+	".ts":       "TypeScript",
+	".tsx":      "TypeScript",
+	".yaml":     "YAML",
+	".yml":      "YAML",
+}
+
+// The directory that files at the root of a repo are counted under.
+const rootDirectory = "."
+
+// Facets count the files with a match by where they are, so that a UI can
+// show how many results each filter would leave and a dashboard can chart
+// where a pattern lives. Files in a language or with an extension that
+// isn't known aren't counted under those.
+type Facets struct {
+	Languages   map[string]int `json:",omitempty"`
+	Directories map[string]int `json:",omitempty"`
+	Extensions  map[string]int `json:",omitempty"`
+}
+
+// NewFacets returns facets with nothing counted.
+func NewFacets() *Facets {
+	return &Facets{
+		Languages:   map[string]int{},
+		Directories: map[string]int{},
+		Extensions:  map[string]int{},
+	}
+}
+
+// Count a file with a match.
+func (f *Facets) add(name string) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext != "" {
+		f.Extensions[ext]++
+	}
+
+	if lang := languagesByExt[ext]; lang != "" {
+		f.Languages[lang]++
+	}
+
+	dir := rootDirectory
+	if i := strings.Index(name, "/"); i >= 0 {
+		dir = name[:i]
+	}
+	f.Directories[dir]++
+}
+
+// Merge adds the counts of o to f.
+func (f *Facets) Merge(o *Facets) {
+	if o == nil {
+		return
+	}
+
+	for k, v := range o.Languages {
+		f.Languages[k] += v
+	}
+	for k, v := range o.Directories {
+		f.Directories[k] += v
+	}
+	for k, v := range o.Extensions {
+		f.Extensions[k] += v
+	}
+}
@@ -0,0 +1,77 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestFacets(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	files := map[string]string{
+		"main.go":          "// hound\n",
+		"cmd/hound/x.go":   "// hound\n// hound\n",
+		"web/app.js":       "// hound\n",
+		"web/app.min.JS":   "// hound\n",
+		"web/style.css":    "/* nothing */\n",
+		"docs/Makefile":    "# hound\n",
+		"docs/notes.weird": "hound\n",
+	}
+	for name, data := range files {
+		writeTestFile(t, src, name, data)
+	}
+
+	dst, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := Build(&IndexOptions{}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	res, err := idx.Search("hound", &SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Facets != nil {
+		t.Fatal("expected no facets unless asked for")
+	}
+
+	// files beyond the page count too.
+	res, err = idx.Search("hound", &SearchOptions{Facets: true, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := &Facets{
+		Languages:   map[string]int{"Go": 2, "JavaScript": 2},
+		Directories: map[string]int{".": 1, "cmd": 1, "web": 2, "docs": 2},
+		Extensions:  map[string]int{".go": 2, ".js": 2, ".weird": 1},
+	}
+	if !reflect.DeepEqual(res.Facets, exp) {
+		t.Fatalf("expected %v, got %v", exp, res.Facets)
+	}
+
+	all := NewFacets()
+	all.Merge(res.Facets)
+	all.Merge(res.Facets)
+	all.Merge(nil)
+	if all.Languages["Go"] != 4 || all.Directories["."] != 2 {
+		t.Fatalf("expected the counts to add up, got %v", all)
+	}
+}
@@ -0,0 +1,148 @@
+package index
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	stdregexp "regexp"
+)
+
+// The most files that one search of a repo returns by their names alone.
+const maxFilenameHits = 100
+
+// FilenameHit is a file that matches a search by its path but was never
+// indexed, like an image, a PDF or a binary, so its contents can't be
+// searched and it could otherwise not be found at all.
+type FilenameHit struct {
+	Filename string
+
+	// Why the file wasn't indexed.
+	Reason string
+
+	Owners []string `json:",omitempty"`
+}
+
+// The files that were left out of the index on purpose or because they
+// were of a kind that doesn't belong in search results.
+var notFilenameHits = map[string]bool{
+	reasonDotFile:     true,
+	reasonInvalidMode: true,
+}
+
+// The files that were left out of the index, read the first time a search
+// needs them.
+func (n *Index) excludedFiles() ([]*ExcludedFile, error) {
+	n.lazyLck.Lock()
+	defer n.lazyLck.Unlock()
+
+	if n.excluded != nil {
+		return n.excluded, nil
+	}
+
+	excluded := []*ExcludedFile{}
+	r, err := os.Open(filepath.Join(n.Ref.dir, excludedFileJsonFilename))
+	if os.IsNotExist(err) {
+		n.excluded = excluded
+		return excluded, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if err := json.NewDecoder(r).Decode(&excluded); err != nil {
+		return nil, err
+	}
+
+	n.excluded = excluded
+	return excluded, nil
+}
+
+// Find the files that weren't indexed whose paths match the search: all
+// of those in its scope for a search of only paths, with an empty pattern,
+// or else those whose paths match the pattern. They only come with the
+// first page of results, and not for structural searches or refinements,
+// which have to match the contents.
+func (n *Index) findFilenameHits(s *search) error {
+	if s.opt.Offset > 0 || s.sp != nil || len(s.opt.Within) > 0 {
+		return nil
+	}
+
+	excluded, err := n.excludedFiles()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range excluded {
+		if len(s.filenameHits) >= maxFilenameHits {
+			break
+		}
+
+		if notFilenameHits[f.Reason] {
+			continue
+		}
+
+		name := filepath.ToSlash(f.Filename)
+		if !s.inScope(name) || s.re.MatchString(name, true, true) < 0 {
+			continue
+		}
+
+		s.filenameHits = append(s.filenameHits, &FilenameHit{
+			Filename: name,
+			Reason:   f.Reason,
+			Owners:   s.owners.of(name),
+		})
+	}
+	return nil
+}
+
+// FindPaths finds the indexed files whose paths match re, in the order
+// they were indexed, up to limit of them. It returns whether there were
+// more.
+func (n *Index) FindPaths(re *stdregexp.Regexp, limit int) ([]string, bool, error) {
+	if _, err := n.rlock(); err != nil {
+		return nil, false, err
+	}
+	defer n.lck.RUnlock()
+
+	var res []string
+	for i := 0; i < n.idx.NumNames(); i++ {
+		name := n.idx.Name(uint32(i))
+		if !re.MatchString(name) {
+			continue
+		}
+		if len(res) >= limit {
+			return res, true, nil
+		}
+		res = append(res, name)
+	}
+	return res, false, nil
+}
+
+// NumFiles is the number of files in the index.
+func (n *Index) NumFiles() (int, error) {
+	if _, err := n.rlock(); err != nil {
+		return 0, err
+	}
+	defer n.lck.RUnlock()
+	return n.idx.NumNames(), nil
+}
+
+// SamplePaths takes up to k of the paths of the index, spread evenly
+// across them.
+func (n *Index) SamplePaths(k int) ([]string, error) {
+	if _, err := n.rlock(); err != nil {
+		return nil, err
+	}
+	defer n.lck.RUnlock()
+
+	num := n.idx.NumNames()
+	if k > num {
+		k = num
+	}
+
+	res := make([]string, 0, k)
+	for i := 0; i < k; i++ {
+		res = append(res, n.idx.Name(uint32(i*num/k)))
+	}
+	return res, nil
+}
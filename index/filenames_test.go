@@ -0,0 +1,77 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestFilenameHits(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	writeTestFile(t, src, "main.go", "package main // logo\n")
+	writeTestFile(t, src, "assets/logo.png", "\x89PNG\r\n\x1a\n\x00\x00\x00\x00")
+	writeTestFile(t, src, "assets/icon.png", "\x89PNG\r\n\x1a\n\x00\x00\x00\x00")
+	writeTestFile(t, src, "bin/tool.dll", "MZ\x90\x00\xff\xfe\xff")
+	writeTestFile(t, src, ".hidden/logo.bin", "\x00\x00")
+
+	dst, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := Build(&IndexOptions{ExcludeDotFiles: true}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	hits := func(pat string, opt *SearchOptions) []string {
+		res, err := idx.Search(pat, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, h := range res.FilenameHits {
+			if h.Reason == "" {
+				t.Fatalf("expected a reason for %s", h.Filename)
+			}
+			names = append(names, h.Filename)
+		}
+		return names
+	}
+
+	tests := []struct {
+		pat string
+		opt *SearchOptions
+		exp []string
+	}{
+		// the pattern matches the path.
+		{"logo", &SearchOptions{}, []string{"assets/logo.png"}},
+		{"LOGO", &SearchOptions{IgnoreCase: true}, []string{"assets/logo.png"}},
+		// a search of only paths.
+		{"", &SearchOptions{FileRegexp: "^assets/"}, []string{"assets/icon.png", "assets/logo.png"}},
+		{"", &SearchOptions{FileRegexp: "\\.(png|dll)$", ExcludeFileRegexp: "icon"}, []string{"assets/logo.png", "bin/tool.dll"}},
+		// later pages and refinements have none.
+		{"logo", &SearchOptions{Offset: 1}, nil},
+		{"logo", &SearchOptions{Within: []string{"package"}}, nil},
+	}
+
+	for _, test := range tests {
+		if got := hits(test.pat, test.opt); !reflect.DeepEqual(got, test.exp) {
+			t.Fatalf("%q %+v: expected %v, got %v", test.pat, test.opt, test.exp, got)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package index
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// The lock files of package managers, which are generated and change with
+// every dependency that does.
+var lockfiles = map[string]bool{
+	"package-lock.json":   true,
+	"npm-shrinkwrap.json": true,
+	"yarn.lock":           true,
+	"pnpm-lock.yaml":      true,
+	"Cargo.lock":          true,
+	"Gemfile.lock":        true,
+	"composer.lock":       true,
+	"poetry.lock":         true,
+	"Pipfile.lock":        true,
+	"go.sum":              true,
+	"packages.lock.json":  true,
+	"mix.lock":            true,
+	"pubspec.lock":        true,
+	"Podfile.lock":        true,
+}
+
+const reasonLockfile = "Lock files are excluded."
+
+// FileFilters skip files that are most likely generated or data rather
+// than code. A check with a value that isn't positive is off.
+type FileFilters struct {
+	// The longest line a file may have, in bytes.
+	MaxLineLength int
+
+	// The highest Shannon entropy of the bytes of a file, in bits per
+	// byte.
+	MaxEntropy float64
+
+	// Files are skipped if they are bigger than SizeFactor times the
+	// SizePercentile of the sizes of the files of the repo, and bigger
+	// than MinSize.
+	SizePercentile float64
+	SizeFactor     float64
+	MinSize        int64
+
+	SkipLockfiles bool
+
+	// Globs of the files that are never skipped, matched against the
+	// path and against the name.
+	Include []string
+}
+
+// The filters as they apply to one repo, once the sizes of its files are
+// known.
+type fileFilter struct {
+	*FileFilters
+
+	// the biggest a file can be, or 0 for any size.
+	maxSize int64
+}
+
+// Set up the filters for the files of src, finding their sizes if the
+// size check is on. It returns nil if f is nil.
+func newFileFilter(f *FileFilters, src string, special []string) (*fileFilter, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	ff := &fileFilter{FileFilters: f}
+	if f.SizePercentile <= 0 || f.SizeFactor <= 0 {
+		return ff, nil
+	}
+
+	var sizes []int64
+	if err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if containsString(special, info.Name()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			sizes = append(sizes, info.Size())
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if len(sizes) == 0 {
+		return ff, nil
+	}
+
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+	p := f.SizePercentile
+	if p > 100 {
+		p = 100
+	}
+	i := int(math.Ceil(p/100*float64(len(sizes)))) - 1
+	if i < 0 {
+		i = 0
+	}
+
+	ff.maxSize = int64(float64(sizes[i]) * f.SizeFactor)
+	if ff.maxSize < f.MinSize {
+		ff.maxSize = f.MinSize
+	}
+	return ff, nil
+}
+
+// Whether a file is matched by one of the Include globs.
+func (f *fileFilter) included(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, g := range f.Include {
+		if ok, _ := filepath.Match(g, rel); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(g, filepath.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// The reason that the file at path should be skipped, or "" if it should
+// be indexed.
+func (f *fileFilter) check(path, rel string, size int64) (string, error) {
+	if f == nil || f.included(rel) {
+		return "", nil
+	}
+
+	if f.SkipLockfiles && lockfiles[filepath.Base(rel)] {
+		return reasonLockfile, nil
+	}
+
+	if f.maxSize > 0 && size > f.maxSize {
+		return fmt.Sprintf("Too large for this repo (%d bytes, the limit is %d)", size, f.maxSize), nil
+	}
+
+	if f.MaxLineLength <= 0 && f.MaxEntropy <= 0 {
+		return "", nil
+	}
+
+	r, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	var counts [256]int64
+	var n int64
+	line, longest := 0, 0
+	br := bufio.NewReader(r)
+	for {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+
+		counts[c]++
+		n++
+		if c == '\n' {
+			line = 0
+			continue
+		}
+		if line++; line > longest {
+			longest = line
+		}
+	}
+
+	if f.MaxLineLength > 0 && longest > f.MaxLineLength {
+		return fmt.Sprintf("Line too long (%d bytes)", longest), nil
+	}
+
+	if f.MaxEntropy > 0 {
+		if e := entropy(counts[:], n); e > f.MaxEntropy {
+			return fmt.Sprintf("Entropy too high (%0.2f bits per byte), probably data", e), nil
+		}
+	}
+
+	return "", nil
+}
+
+// The Shannon entropy of n bytes with the given counts, in bits per byte.
+func entropy(counts []int64, n int64) float64 {
+	if n == 0 {
+		return 0
+	}
+
+	var e float64
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / float64(n)
+		e -= p * math.Log2(p)
+	}
+	return e
+}
@@ -0,0 +1,112 @@
+package index
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileFilters(t *testing.T) {
+	src, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	code := "package a\n\nfunc f() int {\n\treturn 1\n}\n"
+	for i := 0; i < 20; i++ {
+		writeTestFile(t, src, filepath.Join("a", string(rune('a'+i))+".go"), code)
+	}
+
+	blob := make([]byte, 30000)
+	rand.New(rand.NewSource(1)).Read(blob)
+	enc := base64.StdEncoding.EncodeToString(blob)
+	var lines []string
+	for i := 0; i < len(enc); i += 76 {
+		end := i + 76
+		if end > len(enc) {
+			end = len(enc)
+		}
+		lines = append(lines, enc[i:end])
+	}
+
+	writeTestFile(t, src, "data/blob.txt", strings.Join(lines, "\n"))
+	writeTestFile(t, src, "dist/app.min.js", "var a=1;"+strings.Repeat("a=a+1;", 1000)+"\n")
+	writeTestFile(t, src, "big/words.txt", strings.Repeat("hello world\n", 10000))
+	writeTestFile(t, src, "package-lock.json", "{}\n")
+	writeTestFile(t, src, "vendor/wide.js", "var b=1;"+strings.Repeat("b=b+1;", 250)+"\n")
+
+	dst, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	opt := &IndexOptions{
+		Filters: &FileFilters{
+			MaxLineLength:  1000,
+			MaxEntropy:     5.8,
+			SizePercentile: 80,
+			SizeFactor:     20,
+			MinSize:        50000,
+			SkipLockfiles:  true,
+			Include:        []string{"vendor/*"},
+		},
+	}
+	if _, err := Build(opt, dst, src, url, rev); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := os.Open(filepath.Join(dst, excludedFileJsonFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var excluded []*ExcludedFile
+	if err := json.NewDecoder(r).Decode(&excluded); err != nil {
+		t.Fatal(err)
+	}
+
+	reasons := map[string]string{}
+	for _, e := range excluded {
+		reasons[e.Filename] = e.Reason
+	}
+
+	for name, exp := range map[string]string{
+		"data/blob.txt":     "Entropy too high",
+		"dist/app.min.js":   "Line too long",
+		"big/words.txt":     "Too large for this repo",
+		"package-lock.json": reasonLockfile,
+	} {
+		if !strings.HasPrefix(reasons[name], exp) {
+			t.Errorf("expected %s to be excluded with %q, got %q", name, exp, reasons[name])
+		}
+	}
+
+	for _, name := range []string{"a/a.go", "vendor/wide.js"} {
+		if r, ok := reasons[name]; ok {
+			t.Errorf("expected %s to be indexed, it was excluded: %s", name, r)
+		}
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	var counts [256]int64
+	counts['a'] = 10
+	if e := entropy(counts[:], 10); e != 0 {
+		t.Fatalf("expected a single byte to have no entropy, got %f", e)
+	}
+
+	for i := range counts {
+		counts[i] = 1
+	}
+	if e := entropy(counts[:], 256); e != 8 {
+		t.Fatalf("expected every byte once to have 8 bits, got %f", e)
+	}
+}
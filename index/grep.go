@@ -7,12 +7,16 @@ import (
 	"os"
 
 	"github.com/hound-search/hound/codesearch/regexp"
+	"github.com/hound-search/hound/structural"
 )
 
 var nl = []byte{'\n'}
 
 type grepper struct {
 	buf []byte
+
+	// the bytes that grep2 has read, over all the files it has grepped.
+	read int64
 }
 
 func countLines(b []byte) int {
@@ -127,64 +131,212 @@ func firstNLines(buf []byte, n int) [][]byte {
 	return r
 }
 
-// TODO(knorton): This is still being tested. This is a grep that supports context lines. Unlike the version
-// in codesearch, this one does not operate on chunks. The downside is that we have to have the whole file
-// in memory to do the grep. Fortunately, we limit the size of files that get indexed anyway. 10M files tend
-// to not be source code.
+const (
+	// How much of a file grep2 holds in memory at once.
+	grepWindow = 1 << 20
+
+	// The window grows to fit a line and its context up to this size.
+	// Longer lines are split, rather than read whole.
+	maxGrepWindow = 1 << 24
+)
+
+// This is a grep that supports context lines. Files are streamed through a
+// window that slides forward a line at a time as it is scanned. Lines that
+// may be needed as before context are kept in the window, and a line is
+// only scanned once its after context has been read too, so memory stays
+// bounded no matter how large the file is.
 func (g *grepper) grep2(
 	r io.Reader,
 	re *regexp.Regexp,
 	nctx int,
 	fn func(line []byte, lineno int, before [][]byte, after [][]byte) (bool, error)) error {
 
-	buf, err := g.fillFrom(r)
-	if err != nil {
-		return err
+	if g.buf == nil {
+		g.buf = make([]byte, grepWindow)
 	}
 
-	lineno := 0
+	var (
+		buf = g.buf[:0]
+
+		// where the lines that have yet to be scanned start.
+		pos = 0
+
+		// before context doesn't reach back past the previous match.
+		floor = 0
+
+		// the number of the line at pos.
+		lineno = 1
+
+		eof = false
+	)
+
 	for {
-		if len(buf) == 0 {
-			return nil
+		if !eof {
+			n, err := io.ReadFull(r, buf[len(buf):cap(buf)])
+			buf = buf[:len(buf)+n]
+			g.read += int64(n)
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
 		}
 
-		m := re.Match(buf, true, true)
-		if m < 0 {
+		// the end of the last complete line in the window.
+		lines := len(buf)
+		if !eof {
+			lines = bytes.LastIndex(buf, nl) + 1
+		}
+
+		// only scan up to the lines whose after context is in the window.
+		end := lines
+		for i := 0; i < nctx && end > pos && !eof; i++ {
+			end = bytes.LastIndex(buf[:end-1], nl) + 1
+		}
+
+		if end <= pos && !eof {
+			// the window is full but holds no line we can scan yet.
+			if cap(buf) < maxGrepWindow {
+				b := make([]byte, len(buf), 2*cap(buf))
+				copy(b, buf)
+				buf = b
+				continue
+			}
+
+			// give up on the after context, then on whole lines.
+			end = lines
+			if end <= pos {
+				end = len(buf)
+				lines = end
+			}
+		}
+
+		for pos < end {
+			m := re.Match(buf[pos:end], true, true)
+			if m < 0 {
+				break
+			}
+			m += pos
+
+			// start of matched line.
+			str := bytes.LastIndex(buf[pos:m], nl) + 1 + pos
+
+			//end of previous line
+			endl := str - 1
+			if endl < floor {
+				endl = floor
+			}
+
+			//end of current line
+			lend := m + 1
+			if lend > end {
+				lend = end
+			}
+
+			lineno += countLines(buf[pos:str])
+
+			more, err := fn(
+				bytes.TrimRight(buf[str:lend], "\n"),
+				lineno,
+				lastNLines(buf[floor:endl], nctx),
+				firstNLines(buf[lend:lines], nctx))
+			if err != nil {
+				return err
+			}
+			if !more {
+				return nil
+			}
+
+			lineno += countLines(buf[str:lend])
+			pos, floor = lend, lend
+		}
+
+		if eof {
 			return nil
 		}
 
-		// start of matched line.
-		str := bytes.LastIndex(buf[:m], nl) + 1
+		lineno += countLines(buf[pos:end])
+		pos = end
+
+		// keep the lines that may be before context of the next match,
+		// unless they would crowd out the rest of the window.
+		keep := pos
+		for i := 0; i < nctx && keep > floor; i++ {
+			keep = bytes.LastIndex(buf[floor:keep-1], nl) + 1 + floor
+		}
+		if pos-keep > cap(buf)/2 {
+			keep = pos
+		}
+
+		buf = buf[:copy(buf, buf[keep:])]
+		pos -= keep
+		floor = 0
+	}
+}
+
+// Report the lines on which the matches of a structural pattern start, in
+// the manner of grep2. A match that runs over several lines has the rest
+// of them at the start of its after context. It also reports whether
+// matching gave up before the end of buf, so there may be more matches.
+func grepStructural(
+	buf []byte,
+	sp *structural.Pattern,
+	lang *structural.Language,
+	nctx int,
+	fn func(line []byte, lineno int, before [][]byte, after [][]byte) (bool, error)) (bool, error) {
+
+	var (
+		// the start of the line numbered lineno.
+		pos    = 0
+		lineno = 1
+
+		// before context doesn't reach back past the previous match.
+		floor = 0
+	)
+
+	ms, complete := sp.FindAll(buf, lang)
+	for _, m := range ms {
+		if m.Start < pos {
+			// another match already started on this line.
+			continue
+		}
+
+		str := bytes.LastIndex(buf[pos:m.Start], nl) + 1 + pos
+		lineno += countLines(buf[pos:str])
 
-		//end of previous line
 		endl := str - 1
-		if endl < 0 {
-			endl = 0
+		if endl < floor {
+			endl = floor
 		}
 
-		//end of current line
-		end := m + 1
-		if end > len(buf) {
-			end = len(buf)
+		lend := len(buf)
+		if i := bytes.IndexByte(buf[m.Start:], '\n'); i >= 0 {
+			lend = m.Start + i + 1
 		}
 
-		lineno += countLines(buf[:str])
+		// the lines the match goes on to.
+		n := 0
+		if m.End > lend {
+			n = countLines(buf[lend:m.End-1]) + 1
+		}
 
 		more, err := fn(
-			bytes.TrimRight(buf[str:end], "\n"),
-			lineno+1,
-			lastNLines(buf[:endl], nctx),
-			firstNLines(buf[end:], nctx))
+			bytes.TrimRight(buf[str:lend], "\n"),
+			lineno,
+			lastNLines(buf[floor:endl], nctx),
+			firstNLines(buf[lend:], n+nctx))
 		if err != nil {
-			return err
+			return false, err
 		}
 		if !more {
-			return nil
+			return false, nil
 		}
 
-		lineno++
-		buf = buf[end:]
+		lineno += countLines(buf[str:lend])
+		pos, floor = lend, lend
 	}
+
+	return !complete, nil
 }
 
 // This nonsense is adapted from https://code.google.com/p/codesearch/source/browse/regexp/match.go#399
@@ -3,6 +3,7 @@ package index
 import (
 	"bytes"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -292,3 +293,56 @@ func TestContext(t *testing.T) {
 			[]string{"second", "third"},
 		})
 }
+
+type fullMatch struct {
+	line   string
+	no     int
+	before string
+	after  string
+}
+
+func grepAll(t *testing.T, g *grepper, buf []byte, exp string, ctx int) []fullMatch {
+	re, err := regexp.Compile(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m []fullMatch
+	if err := g.grep2(bytes.NewReader(buf), re, ctx,
+		func(line []byte, lineno int, before [][]byte, after [][]byte) (bool, error) {
+			m = append(m, fullMatch{
+				line:   string(line),
+				no:     lineno,
+				before: formatLinesFromBytes(before),
+				after:  formatLinesFromBytes(after),
+			})
+			return true, nil
+		}); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestGrepWindow(t *testing.T) {
+	var b bytes.Buffer
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&b, "line %d %s\n", i, strings.Repeat("x", i%37))
+	}
+	b.WriteString("last line 7")
+	subj := b.Bytes()
+
+	for _, exp := range []string{"7", "(?m)^line 1", "x{30}", "last"} {
+		for _, ctx := range []int{0, 1, 3} {
+			expected := grepAll(t, &grepper{}, subj, exp, ctx)
+			if len(expected) == 0 {
+				t.Fatalf("expected matches for %s", exp)
+			}
+
+			// a window smaller than a line forces it to slide and grow.
+			got := grepAll(t, &grepper{buf: make([]byte, 16)}, subj, exp, ctx)
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("%s with %d lines of context: streamed matches differ", exp, ctx)
+			}
+		}
+	}
+}
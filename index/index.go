@@ -1,19 +1,29 @@
 package index
 
 import (
+	"bytes"
 	"compress/gzip"
 	"encoding/gob"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	stdregexp "regexp"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 	"unicode/utf8"
 
 	"github.com/hound-search/hound/codesearch/index"
 	"github.com/hound-search/hound/codesearch/regexp"
+	"github.com/hound-search/hound/embed"
+	"github.com/hound-search/hound/structural"
+	"github.com/hound-search/hound/throttle"
 )
 
 const (
@@ -21,6 +31,10 @@ const (
 	manifestFilename         = "metadata.gob"
 	excludedFileJsonFilename = "excluded_files.json"
 	filePeekSize             = 2048
+
+	// Searches with at least this many candidate files in one repo
+	// scan them in parallel.
+	minParallelScan = 16
 )
 
 const (
@@ -33,11 +47,69 @@ type Index struct {
 	Ref *IndexRef
 	idx *index.Index
 	lck sync.RWMutex
+
+	// The contents of every file, by name, once the index has been
+	// loaded into memory. Nil means they are read from disk.
+	mem map[string][]byte
+
+	owners  *owners
+	modules *modules
+
+	// The source maps of the files that were indexed from them, by the
+	// path they were indexed under.
+	sourceMaps map[string]string
+
+	// The last commits of the files, if they were recorded.
+	commits commits
+
+	// The fingerprints and the embeddings of the files, once a search
+	// has needed them.
+	lazyLck  sync.Mutex
+	fp       *fingerprints
+	emb      *embeddings
+	excluded []*ExcludedFile
+	nbs      notebooks
 }
 
 type IndexOptions struct {
 	ExcludeDotFiles bool
 	SpecialFiles    []string
+
+	// Limits how fast the index is written to disk, if it is set.
+	WriteLimit *throttle.Limiter
+
+	// Makes the embeddings of the chunks of the files for semantic
+	// search, if it is set.
+	Embeddings *embed.Model
+
+	// Skips the files that look generated or like data, if it is set.
+	Filters *FileFilters
+
+	// Indexes the text of documents in their place, if it is set.
+	Extraction *Extraction
+
+	// Indexes only the sources of the cells of Jupyter notebooks.
+	NotebookCells bool
+
+	// Skips minified scripts and stylesheets and their source maps, and
+	// indexes the original sources in the maps in their place if
+	// SourceMaps is set.
+	ExcludeMinified bool
+	SourceMaps      bool
+
+	// Finds the last commit of each file of the checkout in src, by its
+	// path with forward slashes, so searches can go by when files last
+	// changed, if it is set.
+	Commits func(src string) (map[string]*FileCommit, error)
+
+	// Cuts the lines of the excerpts of results to at most this many
+	// bytes, if it is set. The whole lines are still indexed and searched.
+	MaxExcerptLineLength int
+
+	// Checkpoints the build after every this many files, or
+	// defaultShardSize if it isn't set, so that a build that is cut short
+	// resumes from the last checkpoint.
+	ShardSize int
 }
 
 type SearchOptions struct {
@@ -46,6 +118,70 @@ type SearchOptions struct {
 	FileRegexp     string
 	Offset         int
 	Limit          int
+
+	// ExcludeFileRegexp skips the files whose path matches it, even if
+	// they match FileRegexp.
+	ExcludeFileRegexp string
+
+	// WholeWord only matches the pattern between word boundaries, so a
+	// search for an identifier doesn't match longer names that have it
+	// in them. It doesn't apply to structural patterns.
+	WholeWord bool
+
+	// Caps on the matches returned for one file, on the files, the same
+	// as a Limit if it is lower, and on the matches of the whole search.
+	// The response says which of them left results out. MaxMatches is
+	// matchLimit if it isn't set, and can't be more.
+	MaxMatchesPerFile int
+	MaxFiles          int
+	MaxMatches        int
+
+	// Sort is the order of the files, one of the Sort constants, or empty
+	// for the order they were indexed in.
+	Sort string
+
+	// Structural treats the pattern as a structural pattern rather than
+	// a regexp. See package structural.
+	Structural bool
+
+	// Rev asks for the index of an earlier revision, or a prefix of one,
+	// among those a searcher keeps. The index itself ignores it.
+	Rev string
+
+	// At asks for the newest index that a searcher keeps that was built
+	// by then. It wins over Rev.
+	At time.Time
+
+	// Owner only searches the files owned by a team or user, going by
+	// the CODEOWNERS and OWNERS files of the repo.
+	Owner string
+
+	// Module and Package only search the files of a module, or of a
+	// package, and the ones below it. Modules are found by their go.mod
+	// or package.json.
+	Module  string
+	Package string
+
+	// Modified only searches the files whose last commit is in a span of
+	// time, like >2024-01-01. See parseModified.
+	Modified string
+
+	// Author only searches the files whose last commit was made by
+	// someone whose name or email has it in them, ignoring case.
+	Author string
+
+	// Cancel stops the search with ErrCancelled once it is closed, such
+	// as when the client that asked for it has gone.
+	Cancel <-chan struct{}
+
+	// Within refines the results of earlier searches: only the files
+	// that match each of these regexps as well are searched. They are
+	// matched against the whole file, with IgnoreCase like the pattern.
+	Within []string
+
+	// Facets counts all of the files with a match by language, top
+	// level directory and extension.
+	Facets bool
 }
 
 type Match struct {
@@ -53,6 +189,15 @@ type Match struct {
 	LineNumber int
 	Before     []string
 	After      []string
+
+	// The cell of a notebook that the match is in, whose context is
+	// kept to the cell.
+	Cell *NotebookCell `json:",omitempty"`
+
+	// Where the pattern matched in Line, so the matches can be
+	// highlighted without running it again. Structural matches don't
+	// have them.
+	Spans []Span `json:",omitempty"`
 }
 
 type SearchResponse struct {
@@ -60,12 +205,68 @@ type SearchResponse struct {
 	FilesWithMatch int
 	FilesOpened    int           `json:"-"`
 	Duration       time.Duration `json:"-"`
+	BytesRead      int64         `json:"-"`
 	Revision       string
+	Facets         *Facets `json:",omitempty"`
+
+	// The files that were never indexed, like images and binaries, whose
+	// paths match the search.
+	FilenameHits []*FilenameHit `json:",omitempty"`
+
+	// Which caps left out results, if any did.
+	Truncated *Truncation `json:",omitempty"`
+
+	// How long the search waited for the index to be woken, if it had
+	// been archived.
+	WokenMs int64 `json:",omitempty"`
+}
+
+// Truncation says which of the caps of a search left out results, so
+// that a caller knows that there is more than it got.
+type Truncation struct {
+	// Files had more matches than the cap on the matches of a file.
+	MatchesPerFile bool `json:",omitempty"`
+
+	// More files had matches than the page, or the cap on files, had
+	// room for.
+	Files bool `json:",omitempty"`
+
+	// The search had more matches than the cap on matches.
+	Matches bool `json:",omitempty"`
+
+	// The response had no room for more files under its cap on size.
+	Size bool `json:",omitempty"`
+
+	// A structural pattern took too long to match in files, which may have
+	// more matches than were found.
+	Structural bool `json:",omitempty"`
 }
 
 type FileMatch struct {
 	Filename string
 	Matches  []*Match
+
+	// Who owns the file, if the repo says.
+	Owners []string `json:",omitempty"`
+
+	// Whether the file had more matches than it came with.
+	Truncated bool `json:",omitempty"`
+
+	// The source map that the file was indexed from, for an original
+	// source of a minified file, which isn't in the repo itself.
+	SourceMap string `json:",omitempty"`
+
+	// When the last commit that changed the file was made, if that was
+	// recorded.
+	Modified *time.Time `json:",omitempty"`
+
+	// Who made that commit, if authors were recorded.
+	Author string `json:",omitempty"`
+
+	// Set by result hooks: a link to the file that replaces the one made
+	// from the url-pattern of the repo, and anything else they add.
+	URL      string                 `json:",omitempty"`
+	Metadata map[string]interface{} `json:",omitempty"`
 }
 
 type ExcludedFile struct {
@@ -78,6 +279,10 @@ type IndexRef struct {
 	Rev  string
 	Time time.Time
 	dir  string
+
+	// The longest that the lines of the excerpts of results are, in
+	// bytes, before they are cut. Zero keeps whole lines.
+	MaxExcerptLineLength int `json:",omitempty"`
 }
 
 func (r *IndexRef) Dir() string {
@@ -95,10 +300,39 @@ func (r *IndexRef) writeManifest() error {
 }
 
 func (r *IndexRef) Open() (*Index, error) {
-	return &Index{
-		Ref: r,
-		idx: index.Open(filepath.Join(r.dir, "tri")),
-	}, nil
+	o, err := loadOwners(r.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := loadModules(r.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	maps, err := loadSourceMaps(r.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := loadCommits(r.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Index{
+		Ref:        r,
+		owners:     o,
+		modules:    m,
+		sourceMaps: maps,
+		commits:    c,
+	}
+
+	// an archived index is woken by the first search of it.
+	if !archivedDir(r.dir) {
+		n.idx = index.Open(filepath.Join(r.dir, "tri"))
+	}
+	return n, nil
 }
 
 func (r *IndexRef) Remove() error {
@@ -108,14 +342,19 @@ func (r *IndexRef) Remove() error {
 func (n *Index) Close() error {
 	n.lck.Lock()
 	defer n.lck.Unlock()
+	if n.idx == nil {
+		return nil
+	}
 	return n.idx.Close()
 }
 
 func (n *Index) Destroy() error {
 	n.lck.Lock()
 	defer n.lck.Unlock()
-	if err := n.idx.Close(); err != nil {
-		return err
+	if n.idx != nil {
+		if err := n.idx.Close(); err != nil {
+			return err
+		}
 	}
 	return n.Ref.Remove()
 }
@@ -124,12 +363,103 @@ func (n *Index) GetDir() string {
 	return n.Ref.dir
 }
 
-func toStrings(lines [][]byte) []string {
-	strs := make([]string, len(lines))
-	for i, n := 0, len(lines); i < n; i++ {
-		strs[i] = string(lines[i])
+// Read and decompress one of the raw files kept alongside the index.
+func readRawFile(filename string) ([]byte, error) {
+	r, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	c, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	return ioutil.ReadAll(c)
+}
+
+// LoadIntoMemory reads the trigram index and the contents of every file
+// onto the heap so that searches don't touch the disk at all. It returns
+// the number of bytes of file contents that were loaded.
+func (n *Index) LoadIntoMemory() (int64, error) {
+	if _, err := n.Wake(); err != nil {
+		return 0, err
+	}
+
+	ix, err := index.OpenInMemory(filepath.Join(n.Ref.dir, "tri"))
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	mem := make(map[string][]byte, ix.NumNames())
+	for i := 0; i < ix.NumNames(); i++ {
+		name := ix.Name(uint32(i))
+		b, err := readRawFile(filepath.Join(n.Ref.dir, "raw", name))
+		if err != nil {
+			ix.Close()
+			return 0, err
+		}
+		mem[name] = b
+		size += int64(len(b))
 	}
-	return strs
+
+	n.lck.Lock()
+	defer n.lck.Unlock()
+
+	old := n.idx
+	n.idx, n.mem = ix, mem
+	return size, old.Close()
+}
+
+// Whether LoadIntoMemory has been called.
+func (n *Index) InMemory() bool {
+	n.lck.RLock()
+	defer n.lck.RUnlock()
+	return n.mem != nil
+}
+
+// HasUpperCase reports whether a pattern has an upper case letter of its
+// own, for smart case. Letters that are part of escapes, like \S, \pL
+// and \x4A, and the names of groups don't count.
+func HasUpperCase(pat string) bool {
+	rs := []rune(pat)
+	for i := 0; i < len(rs); i++ {
+		switch {
+		case rs[i] == '\\' && i+1 < len(rs):
+			i++
+			switch rs[i] {
+			case 'p', 'P', 'x':
+				// \p{Greek} and \x{004A}, or \pL and \x4A.
+				if i+1 < len(rs) && rs[i+1] == '{' {
+					for i < len(rs) && rs[i] != '}' {
+						i++
+					}
+				} else if rs[i] == 'x' {
+					i += 2
+				} else {
+					i++
+				}
+			}
+		case rs[i] == '(' && strings.HasPrefix(string(rs[i:]), "(?P<"):
+			for i < len(rs) && rs[i] != '>' {
+				i++
+			}
+		case unicode.IsUpper(rs[i]):
+			return true
+		}
+	}
+	return false
+}
+
+// WholeWordPattern is the pattern that only matches pat as a whole word.
+func WholeWordPattern(pat string) string {
+	if pat == "" {
+		return pat
+	}
+	return `\b(?:` + pat + `)\b`
 }
 
 func GetRegexpPattern(pat string, ignoreCase bool) string {
@@ -139,92 +469,641 @@ func GetRegexpPattern(pat string, ignoreCase bool) string {
 	return "(?m)" + pat
 }
 
-func (n *Index) Search(pat string, opt *SearchOptions) (*SearchResponse, error) {
-	startedAt := time.Now()
+// The state of one search as its candidate files are scanned.
+type search struct {
+	re         *regexp.Regexp
+	sp         *structural.Pattern
+	opt        *SearchOptions
+	owners     *owners
+	modules    *modules
+	sourceMaps map[string]string
+	commits    commits
+	startedAt  time.Time
+
+	// the span of time that the files have to have last changed in, and
+	// the author, in lower case, of their last commit.
+	modified *timeSpan
+	author   string
+
+	// the patterns that the paths of files have to match, and must not.
+	fre, xre *regexp.Regexp
+
+	// the patterns of the searches being refined, which the files also
+	// have to match.
+	within []*stdregexp.Regexp
+
+	// the pattern again as a standard regexp, which can say where in a
+	// line it matched.
+	spans *stdregexp.Regexp
+
+	// the candidate files, in order of file id.
+	ids   []uint32
+	names []string
+
+	results          []*FileMatch
+	filenameHits     []*FilenameHit
+	facets           *Facets
+	filesFound       int
+	filesCollected   int
+	matchesCollected int
+	bytesRead        int64
+
+	// set once the cap on matches has left some out.
+	matchesFull bool
+	truncated   Truncation
+}
 
-	n.lck.RLock()
-	defer n.lck.RUnlock()
+// Compile the pattern and find the files that may match it.
+func (n *Index) newSearch(pat string, opt *SearchOptions) (*search, error) {
+	s := &search{
+		opt:        opt,
+		owners:     n.owners,
+		modules:    n.modules,
+		sourceMaps: n.sourceMaps,
+		commits:    n.commits,
+		startedAt:  time.Now(),
+	}
+	if err := CheckSort(opt.Sort); err != nil {
+		return nil, &QueryError{err}
+	}
+	if opt.Modified != "" {
+		m, err := parseModified(opt.Modified)
+		if err != nil {
+			return nil, &QueryError{err}
+		}
+		s.modified = m
+	}
+	s.author = strings.ToLower(opt.Author)
+	if opt.Facets {
+		s.facets = NewFacets()
+	}
 
-	re, err := regexp.Compile(GetRegexpPattern(pat, opt.IgnoreCase))
-	if err != nil {
-		return nil, err
+	var err error
+	if opt.Structural {
+		s.sp, err = structural.Compile(pat)
+		if err != nil {
+			return nil, &QueryError{err}
+		}
+
+		// the regexp only narrows down the files to those with all of
+		// the words of the pattern.
+		pat = structuralPrefilter(s.sp)
+	} else {
+		if opt.WholeWord {
+			pat = WholeWordPattern(pat)
+		}
+		pat = GetRegexpPattern(pat, opt.IgnoreCase)
 	}
 
-	var (
-		g                grepper
-		results          []*FileMatch
-		filesOpened      int
-		filesFound       int
-		filesCollected   int
-		matchesCollected int
-	)
+	s.re, err = regexp.Compile(pat)
+	if err != nil {
+		return nil, &QueryError{err}
+	}
+	if s.sp == nil {
+		s.spans, err = stdregexp.Compile(pat)
+		if err != nil {
+			return nil, &QueryError{err}
+		}
+	}
 
-	var fre *regexp.Regexp
 	if opt.FileRegexp != "" {
-		fre, err = regexp.Compile(opt.FileRegexp)
+		s.fre, err = regexp.Compile(opt.FileRegexp)
 		if err != nil {
-			return nil, err
+			return nil, &QueryError{err}
+		}
+	}
+
+	if opt.ExcludeFileRegexp != "" {
+		s.xre, err = regexp.Compile(opt.ExcludeFileRegexp)
+		if err != nil {
+			return nil, &QueryError{err}
+		}
+	}
+
+	files := n.idx.PostingQuery(index.RegexpQuery(s.re.Syntax))
+	for _, w := range opt.Within {
+		pat := GetRegexpPattern(w, opt.IgnoreCase)
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			return nil, &QueryError{err}
+		}
+
+		// the index narrows down the files that can match, but matching
+		// is done by the standard regexps, which are safe to share
+		// between the workers of a search.
+		wre, err := stdregexp.Compile(pat)
+		if err != nil {
+			return nil, &QueryError{err}
 		}
+		s.within = append(s.within, wre)
+		files = intersect(files, n.idx.PostingQuery(index.RegexpQuery(re.Syntax)))
 	}
 
-	files := n.idx.PostingQuery(index.RegexpQuery(re.Syntax))
 	for _, file := range files {
-		var matches []*Match
 		name := n.idx.Name(file)
-		hasMatch := false
-
-		// reject files that do not match the file pattern
-		if fre != nil && fre.MatchString(name, true, true) < 0 {
+		if !s.inScope(name) {
 			continue
 		}
 
-		filesOpened++
-		if err := g.grep2File(filepath.Join(n.Ref.dir, "raw", name), re, int(opt.LinesOfContext),
-			func(line []byte, lineno int, before [][]byte, after [][]byte) (bool, error) {
+		s.ids = append(s.ids, file)
+		s.names = append(s.names, name)
+	}
 
-				hasMatch = true
-				if filesFound < opt.Offset || (opt.Limit > 0 && filesCollected >= opt.Limit) {
-					return false, nil
-				}
+	if err := n.findFilenameHits(s); err != nil {
+		return nil, err
+	}
 
-				matchesCollected++
-				matches = append(matches, &Match{
-					Line:       string(line),
-					LineNumber: lineno,
-					Before:     toStrings(before),
-					After:      toStrings(after),
-				})
+	return s, nil
+}
 
-				if matchesCollected > matchLimit {
-					return false, fmt.Errorf("search exceeds limit on matches: %d", matchLimit)
-				}
+// Whether a file is one of those the search is scoped to, by its path,
+// owner, module and package and when and by whom it last changed.
+func (s *search) inScope(name string) bool {
+	// reject files that do not match the file pattern
+	if s.fre != nil && s.fre.MatchString(name, true, true) < 0 {
+		return false
+	}
 
-				return true, nil
-			}); err != nil {
-			return nil, err
+	// and those that match the exclude pattern
+	if s.xre != nil && s.xre.MatchString(name, true, true) >= 0 {
+		return false
+	}
+
+	if s.opt.Owner != "" && !s.owners.owns(name, s.opt.Owner) {
+		return false
+	}
+
+	if s.opt.Module != "" && !s.modules.inModule(name, s.opt.Module) {
+		return false
+	}
+
+	if s.opt.Package != "" && !s.modules.inPackage(name, s.opt.Package) {
+		return false
+	}
+
+	// files whose last commit isn't known are never in a span of time.
+	if s.modified != nil {
+		if c := s.commits.of(name); c == nil || !s.modified.contains(c.Time) {
+			return false
 		}
+	}
 
-		if !hasMatch {
-			continue
+	if s.author != "" && !s.commits.authoredBy(name, s.author) {
+		return false
+	}
+
+	return true
+}
+
+// The file ids in both of the sorted lists a and b.
+func intersect(a, b []uint32) []uint32 {
+	var res []uint32
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			res = append(res, a[i])
+			i++
+			j++
+		}
+	}
+	return res
+}
+
+// A regexp for the files that may match a structural pattern: they have
+// to contain all of its words, in order. Words are made of identifier
+// characters, none of which need quoting.
+func structuralPrefilter(sp *structural.Pattern) string {
+	return strings.Join(sp.Literals(), "(?s:.*)")
+}
+
+// The most files the requested page has room for, or 0 for any number.
+func (s *search) fileLimit() int {
+	if s.opt.MaxFiles > 0 && (s.opt.Limit <= 0 || s.opt.MaxFiles < s.opt.Limit) {
+		return s.opt.MaxFiles
+	}
+	return s.opt.Limit
+}
+
+// The most matches the search returns.
+func (s *search) matchLimit() int {
+	if s.opt.MaxMatches > 0 && s.opt.MaxMatches < matchLimit {
+		return s.opt.MaxMatches
+	}
+	return matchLimit
+}
+
+// The most matches one file returns: no more than the search does.
+func (s *search) fileMatchLimit() int {
+	if max := s.opt.MaxMatchesPerFile; max > 0 && max < s.matchLimit() {
+		return max
+	}
+	return s.matchLimit()
+}
+
+// whether the requested page already has all of its files, or all of the
+// matches it can have.
+func (s *search) pageFull() bool {
+	if s.opt.Sort != "" {
+		return s.matchesFull
+	}
+	limit := s.fileLimit()
+	return s.matchesFull || limit > 0 && s.filesCollected >= limit
+}
+
+// whether the next file with a match falls within the requested page.
+// A sorted search takes in every file, and pages once it has sorted them.
+func (s *search) inPage() bool {
+	if s.opt.Sort != "" {
+		return !s.pageFull()
+	}
+	return s.filesFound >= s.opt.Offset && !s.pageFull()
+}
+
+// take in the scans in the order of the files.
+func (s *search) add(fs *fileScan) error {
+	s.bytesRead += fs.bytesRead
+	if fs.err != nil {
+		return fs.err
+	}
+
+	if fs.gaveUp {
+		s.truncated.Structural = true
+	}
+
+	select {
+	case <-s.opt.Cancel:
+		return ErrCancelled
+	default:
+	}
+
+	if !fs.hasMatch {
+		return nil
+	}
+
+	if s.inPage() && len(fs.matches) > 0 {
+		matches, truncated := fs.matches, fs.truncated
+		if truncated {
+			s.truncated.MatchesPerFile = true
+		}
+
+		// the file gets the matches that the search has room for.
+		if room := s.matchLimit() - s.matchesCollected; len(matches) > room {
+			matches, truncated = matches[:room], true
+			s.matchesFull = true
+			s.truncated.Matches = true
 		}
 
-		filesFound++
 		if len(matches) > 0 {
-			filesCollected++
-			results = append(results, &FileMatch{
-				Filename: name,
-				Matches:  matches,
+			s.matchesCollected += len(matches)
+			s.filesCollected++
+			s.results = append(s.results, &FileMatch{
+				Filename:  fs.name,
+				Matches:   matches,
+				Owners:    s.owners.of(fs.name),
+				Truncated: truncated,
+				SourceMap: s.sourceMaps[fs.name],
+				Modified:  s.commits.modified(fs.name),
+				Author:    s.commits.author(fs.name),
 			})
 		}
 	}
+	if s.facets != nil {
+		s.facets.add(fs.name)
+	}
+	s.filesFound++
+	return nil
+}
+
+func (s *search) response(n *Index) *SearchResponse {
+	if s.opt.Sort != "" {
+		s.sortResults()
+	}
+
+	if s.filesFound > s.opt.Offset+s.filesCollected {
+		s.truncated.Files = true
+	}
+
+	var truncated *Truncation
+	if s.truncated != (Truncation{}) {
+		t := s.truncated
+		truncated = &t
+	}
 
 	return &SearchResponse{
-		Matches:        results,
-		FilesWithMatch: filesFound,
-		FilesOpened:    filesOpened,
-		Duration:       time.Now().Sub(startedAt),
+		Matches:        s.results,
+		FilesWithMatch: s.filesFound,
+		FilesOpened:    len(s.names),
+		Duration:       time.Now().Sub(s.startedAt),
+		BytesRead:      s.bytesRead,
 		Revision:       n.Ref.Rev,
-	}, nil
+		Facets:         s.facets,
+		FilenameHits:   s.filenameHits,
+		Truncated:      truncated,
+	}
+}
+
+func (n *Index) Search(pat string, opt *SearchOptions) (*SearchResponse, error) {
+	woken, err := n.rlock()
+	if err != nil {
+		return nil, err
+	}
+	defer n.lck.RUnlock()
+
+	s, err := n.newSearch(pat, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.names) < minParallelScan || runtime.GOMAXPROCS(0) == 1 {
+		var g grepper
+		for _, name := range s.names {
+			if err := s.add(n.scanFile(&g, s, s.re, name, nil, s.inPage())); err != nil {
+				return nil, err
+			}
+		}
+	} else if err := n.scanFiles(s); err != nil {
+		return nil, err
+	}
+
+	res := s.response(n)
+	res.WokenMs = int64(woken / time.Millisecond)
+	return res, nil
+}
+
+// SearchBatch carries out several searches at once, returning a response
+// or an error for each. Files that are candidates for more than one of the
+// searches are only read and decompressed once.
+func (n *Index) SearchBatch(pats []string, opts []*SearchOptions) ([]*SearchResponse, []error) {
+	res := make([]*SearchResponse, len(pats))
+	errs := make([]error, len(pats))
+
+	woken, err := n.rlock()
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return res, errs
+	}
+	defer n.lck.RUnlock()
+
+	ss := make([]*search, len(pats))
+	for i := range pats {
+		ss[i], errs[i] = n.newSearch(pats[i], opts[i])
+	}
+
+	// walk the candidates of all the searches together in file order.
+	var g grepper
+	next := make([]int, len(ss))
+	for {
+		file := ^uint32(0)
+		want := 0
+		for i, s := range ss {
+			if errs[i] != nil || next[i] >= len(s.ids) {
+				continue
+			}
+			if id := s.ids[next[i]]; id < file {
+				file, want = id, 1
+			} else if id == file {
+				want++
+			}
+		}
+
+		if want == 0 {
+			break
+		}
+
+		var data []byte
+		var err error
+		if want > 1 {
+			data, err = n.readFile(n.idx.Name(file))
+		}
+
+		for i, s := range ss {
+			if errs[i] != nil || next[i] >= len(s.ids) || s.ids[next[i]] != file {
+				continue
+			}
+			name := s.names[next[i]]
+			next[i]++
+
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+
+			errs[i] = s.add(n.scanFile(&g, s, s.re, name, data, s.inPage()))
+		}
+	}
+
+	for i, s := range ss {
+		if errs[i] == nil {
+			res[i] = s.response(n)
+			res[i].WokenMs = int64(woken / time.Millisecond)
+		}
+	}
+
+	return res, errs
+}
+
+// What searching one file turned up.
+type fileScan struct {
+	name     string
+	matches  []*Match
+	hasMatch bool
+	err      error
+
+	// whether the file has more than the matches that were kept.
+	truncated bool
+
+	// whether structural matching gave up before the end of the file.
+	gaveUp bool
+
+	// how much of the file was read, which is all of it unless it was
+	// grepped only up to its first match.
+	bytesRead int64
+}
+
+// Find the matches of s in one file, whose contents are data if they have
+// already been read, with re, which stands in for s.re since it can't be
+// shared. Unless collect is set, this stops at the first match, since all
+// that is needed is whether there is one.
+func (n *Index) scanFile(g *grepper, s *search, re *regexp.Regexp, name string, data []byte, collect bool) *fileScan {
+	fs := &fileScan{name: name, bytesRead: int64(len(data))}
+	nctx, max := int(s.opt.LinesOfContext), s.fileMatchLimit()
+
+	// a file that doesn't match the searches being refined has no matches.
+	if len(s.within) > 0 {
+		if data == nil {
+			if data, fs.err = n.readFile(name); fs.err != nil {
+				return fs
+			}
+			fs.bytesRead = int64(len(data))
+		}
+		for _, w := range s.within {
+			if !w.Match(data) {
+				return fs
+			}
+		}
+	}
+
+	var cells []*notebookCell
+	if collect && isNotebook(name) {
+		nbs, err := n.notebooks()
+		if err != nil {
+			fs.err = err
+			return fs
+		}
+		cells = nbs[name]
+	}
+
+	fn := func(line []byte, lineno int, before [][]byte, after [][]byte) (bool, error) {
+
+		fs.hasMatch = true
+		if !collect {
+			return false, nil
+		}
+
+		if len(fs.matches) >= max {
+			fs.truncated = true
+			return false, nil
+		}
+
+		m := &Match{
+			LineNumber: lineno,
+			Before:     cutLines(before, n.Ref.MaxExcerptLineLength),
+			After:      cutLines(after, n.Ref.MaxExcerptLineLength),
+		}
+		m.Line, m.Spans = cutLine(line, findSpans(s.spans, line), n.Ref.MaxExcerptLineLength)
+		if c := cellAt(cells, lineno); c != nil {
+			m.Cell = &c.NotebookCell
+			c.trim(m)
+		}
+		fs.matches = append(fs.matches, m)
+		return true, nil
+	}
+
+	if s.sp != nil {
+		// structural matches can span lines, so they need the whole file.
+		if data == nil {
+			data, fs.err = n.readFile(name)
+			fs.bytesRead = int64(len(data))
+		}
+		if fs.err == nil {
+			fs.gaveUp, fs.err = grepStructural(data, s.sp, structural.LanguageFor(name), nctx, fn)
+		}
+	} else if data != nil {
+		fs.err = g.grep2(bytes.NewReader(data), re, nctx, fn)
+	} else {
+		read := g.read
+		fs.err = n.grepFile(g, name, re, nctx, fn)
+		fs.bytesRead = g.read - read
+	}
+	return fs
+}
+
+// Read the whole contents of one of the indexed files.
+func (n *Index) readFile(name string) ([]byte, error) {
+	if n.mem != nil {
+		return n.mem[name], nil
+	}
+	return readRawFile(filepath.Join(n.Ref.dir, "raw", name))
+}
+
+// Scan the files of s with a pool of workers, adding the scans to s in
+// the order of the files. Workers only run a bounded distance ahead of add, and
+// once the page is full they just look for a first match in each file.
+func (n *Index) scanFiles(s *search) error {
+	names := s.names
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(names) {
+		workers = len(names)
+	}
+
+	var (
+		// set once add has all the files the page needs.
+		full int32
+
+		scans = make([]chan *fileScan, len(names))
+		jobs  = make(chan int)
+		ahead = make(chan struct{}, 4*workers)
+		done  = make(chan struct{})
+		wg    sync.WaitGroup
+	)
+
+	// the regexp matcher caches state and can't be shared.
+	res := make([]*regexp.Regexp, workers)
+	for w := range res {
+		re, err := regexp.Compile(s.re.String())
+		if err != nil {
+			return err
+		}
+		res[w] = re
+	}
+
+	for i := range scans {
+		scans[i] = make(chan *fileScan, 1)
+	}
+
+	go func() {
+		defer close(jobs)
+		for i := range names {
+			select {
+			case ahead <- struct{}{}:
+			case <-done:
+				return
+			}
+
+			select {
+			case jobs <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for _, re := range res {
+		wg.Add(1)
+		go func(re *regexp.Regexp) {
+			defer wg.Done()
+			var g grepper
+			for i := range jobs {
+				collect := atomic.LoadInt32(&full) == 0
+				scans[i] <- n.scanFile(&g, s, re, names[i], nil, collect)
+			}
+		}(re)
+	}
+
+	// the workers must be done with the index before the search returns.
+	defer wg.Wait()
+	defer close(done)
+
+	for i := range names {
+		fs := <-scans[i]
+		<-ahead
+
+		if err := s.add(fs); err != nil {
+			return err
+		}
+
+		if s.pageFull() {
+			atomic.StoreInt32(&full, 1)
+		}
+	}
+
+	return nil
+}
+
+// Grep one of the indexed files, from memory if the index has been loaded.
+func (n *Index) grepFile(g *grepper, name string, re *regexp.Regexp, nctx int,
+	fn func(line []byte, lineno int, before [][]byte, after [][]byte) (bool, error)) error {
+	if n.mem != nil {
+		return g.grep2(bytes.NewReader(n.mem[name]), re, nctx, fn)
+	}
+	return g.grep2File(filepath.Join(n.Ref.dir, "raw", name), re, nctx, fn)
 }
 
 func isTextFile(filename string) (bool, error) {
@@ -278,7 +1157,7 @@ func validUTF8IgnoringPartialTrailingRune(p []byte) bool {
 	return true
 }
 
-func addFileToIndex(ix *index.IndexWriter, dst, src, path string) (string, error) {
+func addFileToIndex(ix *index.IndexWriter, lim *throttle.Limiter, fp *fingerprints, ch *chunker, buf *bytes.Buffer, dst, src, path string) (string, error) {
 	rel, err := filepath.Rel(src, path)
 	if err != nil {
 		return "", err
@@ -290,6 +1169,12 @@ func addFileToIndex(ix *index.IndexWriter, dst, src, path string) (string, error
 	}
 	defer r.Close()
 
+	return addToIndex(ix, lim, fp, ch, buf, dst, rel, r)
+}
+
+// Add the contents of the file at rel, read from r, to the index. This
+// returns the reason the index rejected them, if it did.
+func addToIndex(ix *index.IndexWriter, lim *throttle.Limiter, fp *fingerprints, ch *chunker, buf *bytes.Buffer, dst, rel string, r io.Reader) (string, error) {
 	dup := filepath.Join(dst, "raw", rel)
 	w, err := os.Create(dup)
 	if err != nil {
@@ -297,10 +1182,17 @@ func addFileToIndex(ix *index.IndexWriter, dst, src, path string) (string, error
 	}
 	defer w.Close()
 
-	g := gzip.NewWriter(w)
+	g := gzip.NewWriter(lim.Writer(w))
 	defer g.Close()
 
-	return ix.Add(rel, io.TeeReader(r, g)), nil
+	// the contents are kept as they are read to fingerprint them.
+	buf.Reset()
+	reason := ix.Add(rel, io.TeeReader(r, io.MultiWriter(g, buf)))
+	if reason == "" {
+		fp.add(rel, buf.Bytes())
+		ch.add(rel, buf.Bytes())
+	}
+	return reason, nil
 }
 
 func addDirToIndex(dst, src, path string) error {
@@ -313,8 +1205,10 @@ func addDirToIndex(dst, src, path string) error {
 		return nil
 	}
 
+	// the directory is already there if the sources of a source map were
+	// indexed under it.
 	dup := filepath.Join(dst, "raw", rel)
-	return os.Mkdir(dup, os.ModePerm)
+	return os.MkdirAll(dup, os.ModePerm)
 }
 
 // write the list of excluded files to the given filename.
@@ -337,12 +1231,39 @@ func containsString(haystack []string, needle string) bool {
 	return false
 }
 
-func indexAllFiles(opt *IndexOptions, dst, src string) error {
+func indexAllFiles(opt *IndexOptions, prog *buildProgress, dst, src string) error {
 	ix := index.Create(filepath.Join(dst, "tri"))
 	defer ix.Close()
 
+	if opt.WriteLimit != nil {
+		ix.Throttle(opt.WriteLimit.Wait)
+	}
+
 	excluded := []*ExcludedFile{}
 
+	// the owners listed by the OWNERS files, and the modules rooted at
+	// each directory.
+	dirOwners := map[string][]string{}
+	dirModules := map[string]string{}
+
+	// the dependencies of every manifest.
+	deps := []*Dependency{}
+
+	// the cells of the notebooks, if only those are indexed.
+	nbs := notebooks{}
+
+	// the source maps of the sources that were indexed from them.
+	maps := map[string]string{}
+
+	fp := &fingerprints{}
+	ch := newChunker(opt.Embeddings)
+	var buf bytes.Buffer
+
+	ff, err := newFileFilter(opt.Filters, src, opt.SpecialFiles)
+	if err != nil {
+		return err
+	}
+
 	// Make a file to store the excluded files for this repo
 	fileHandle, err := os.Create(filepath.Join(dst, "excluded_files.json"))
 	if err != nil {
@@ -350,7 +1271,35 @@ func indexAllFiles(opt *IndexOptions, dst, src string) error {
 	}
 	defer fileHandle.Close()
 
-	if err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+	// the shards that an earlier run of the build finished are replayed
+	// from what they recorded, and their files skipped in the walk.
+	for _, s := range prog.done {
+		for _, rel := range s.Files {
+			if err := replayToIndex(ix, fp, ch, &buf, dst, rel); err != nil {
+				return err
+			}
+		}
+
+		excluded = append(excluded, s.Excluded...)
+		deps = append(deps, s.Deps...)
+		for dir, o := range s.Owners {
+			dirOwners[dir] = o
+		}
+		for dir, mod := range s.Modules {
+			dirModules[dir] = mod
+		}
+		for rel, cells := range s.Notebooks {
+			nbs[rel] = cells
+		}
+		for name, mapRel := range s.SourceMaps {
+			maps[name] = mapRel
+		}
+	}
+	prog.excludedAt, prog.depsAt = len(excluded), len(deps)
+
+	// what indexing each file finds is also recorded in the shard that
+	// it is in, for the checkpoint of the shard.
+	indexPath := func(path string, info os.FileInfo) error {
 		name := info.Name()
 		rel, err := filepath.Rel(src, path)
 		if err != nil {
@@ -382,6 +1331,38 @@ func indexAllFiles(opt *IndexOptions, dst, src string) error {
 			return addDirToIndex(dst, src, path)
 		}
 
+		if name == "OWNERS" && info.Mode().IsRegular() {
+			owners, err := readOwnersFile(path)
+			if err != nil {
+				return err
+			}
+			dir := filepath.ToSlash(filepath.Dir(rel))
+			dirOwners[dir] = owners
+			prog.cur.Owners[dir] = owners
+		}
+
+		if read := moduleManifests[name]; read != nil && info.Mode().IsRegular() {
+			mod, err := read(path)
+			if err != nil {
+				return err
+			}
+			dir := filepath.ToSlash(filepath.Dir(rel))
+
+			// a go.mod wins over a package.json in the same directory.
+			if _, ok := dirModules[dir]; mod != "" && (!ok || name == "go.mod") {
+				dirModules[dir] = mod
+				prog.cur.Modules[dir] = mod
+			}
+		}
+
+		if read := depsReaderFor(name); read != nil && info.Mode().IsRegular() {
+			d, err := readDeps(path, rel, read)
+			if err != nil {
+				return err
+			}
+			deps = append(deps, d...)
+		}
+
 		if info.Mode()&os.ModeType != 0 {
 			excluded = append(excluded, &ExcludedFile{
 				rel,
@@ -390,6 +1371,49 @@ func indexAllFiles(opt *IndexOptions, dst, src string) error {
 			return nil
 		}
 
+		if opt.NotebookCells && isNotebook(name) {
+			text, err := readNotebook(path, rel, nbs)
+			if err != nil {
+				excluded = append(excluded, &ExcludedFile{rel, fmt.Sprintf("Could not read the cells of the notebook: %s", err)})
+				return nil
+			}
+			if cells, ok := nbs[filepath.ToSlash(rel)]; ok {
+				prog.cur.Notebooks[filepath.ToSlash(rel)] = cells
+			}
+
+			reason, err := addToIndex(ix, opt.WriteLimit, fp, ch, &buf, dst, rel, bytes.NewReader(text))
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				excluded = append(excluded, &ExcludedFile{rel, reason})
+			} else {
+				prog.cur.Files = append(prog.cur.Files, rel)
+			}
+			return nil
+		}
+
+		// documents are indexed as their text, which the file filters
+		// don't apply to.
+		if c := opt.Extraction.converterFor(path); c != nil {
+			text, err := extractText(c, path, opt.Extraction.MaxBytes)
+			if err != nil {
+				excluded = append(excluded, &ExcludedFile{rel, fmt.Sprintf("Could not extract its text: %s", err)})
+				return nil
+			}
+
+			reason, err := addToIndex(ix, opt.WriteLimit, fp, ch, &buf, dst, rel, bytes.NewReader(text))
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				excluded = append(excluded, &ExcludedFile{rel, reason})
+			} else {
+				prog.cur.Files = append(prog.cur.Files, rel)
+			}
+			return nil
+		}
+
 		txt, err := isTextFile(path)
 		if err != nil {
 			return err
@@ -403,25 +1427,147 @@ func indexAllFiles(opt *IndexOptions, dst, src string) error {
 			return nil
 		}
 
-		reasonForExclusion, err := addFileToIndex(ix, dst, src, path)
+		if opt.ExcludeMinified {
+			min, err := isMinified(path, rel, info.Size())
+			if err != nil {
+				return err
+			}
+			if min {
+				excluded = append(excluded, &ExcludedFile{rel, reasonMinified})
+				if !opt.SourceMaps {
+					return nil
+				}
+				// the sources go under the path of their map, which isn't
+				// a directory in the repo.
+				at := len(prog.cur.Files)
+				if err := addSourceMapToIndex(src, rel, maps, func(name string, r io.Reader) (string, error) {
+					if err := os.MkdirAll(filepath.Join(dst, "raw", filepath.Dir(filepath.FromSlash(name))), os.ModePerm); err != nil {
+						return "", err
+					}
+					reason, err := addToIndex(ix, opt.WriteLimit, fp, ch, &buf, dst, name, r)
+					if err == nil && reason == "" {
+						prog.cur.Files = append(prog.cur.Files, name)
+					}
+					return reason, err
+				}); err != nil {
+					return err
+				}
+				for _, name := range prog.cur.Files[at:] {
+					prog.cur.SourceMaps[name] = maps[name]
+				}
+				return nil
+			}
+		}
+
+		reasonForExclusion, err := ff.check(path, rel, info.Size())
 		if err != nil {
 			return err
 		}
 		if reasonForExclusion != "" {
 			excluded = append(excluded, &ExcludedFile{rel, reasonForExclusion})
+			return nil
+		}
+
+		reasonForExclusion, err = addFileToIndex(ix, opt.WriteLimit, fp, ch, &buf, dst, src, path)
+		if err != nil {
+			return err
+		}
+		if reasonForExclusion != "" {
+			excluded = append(excluded, &ExcludedFile{rel, reasonForExclusion})
+		} else {
+			prog.cur.Files = append(prog.cur.Files, rel)
+		}
+
+		return nil
+	}
+
+	walked := 0
+	if err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if info.IsDir() {
+			return indexPath(path, info)
 		}
 
+		walked++
+		if prog.skip(walked) {
+			return nil
+		}
+		if err := indexPath(path, info); err != nil {
+			return err
+		}
+		if err := prog.next(excluded, deps); err != nil {
+			return err
+		}
 		return nil
 	}); err != nil {
 		return err
 	}
 
+	if prog.pending() {
+		if err := prog.checkpoint(excluded, deps); err != nil {
+			return err
+		}
+	}
+
 	if err := writeExcludedFilesJson(
 		filepath.Join(dst, excludedFileJsonFilename),
 		excluded); err != nil {
 		return err
 	}
 
+	owners, err := readOwners(src, dirOwners)
+	if err != nil {
+		return err
+	}
+	if owners != nil {
+		if err := writeOwnersJson(filepath.Join(dst, ownersFilename), owners); err != nil {
+			return err
+		}
+	}
+
+	if err := writeDepsJson(filepath.Join(dst, depsFilename), deps); err != nil {
+		return err
+	}
+
+	if err := writeFingerprints(filepath.Join(dst, fingerprintsFilename), fp); err != nil {
+		return err
+	}
+
+	if err := ch.write(filepath.Join(dst, embeddingsFilename)); err != nil {
+		return err
+	}
+
+	if len(maps) > 0 {
+		if err := writeSourceMapsJson(filepath.Join(dst, sourceMapsFilename), maps); err != nil {
+			return err
+		}
+	}
+
+	if opt.Commits != nil {
+		c, err := opt.Commits(src)
+		if err != nil {
+			return err
+		}
+		if len(c) > 0 {
+			if err := writeCommitsJson(filepath.Join(dst, commitsFilename), c); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(nbs) > 0 {
+		if err := writeNotebooksJson(filepath.Join(dst, notebooksFilename), nbs); err != nil {
+			return err
+		}
+	}
+
+	if len(dirModules) > 0 {
+		if err := writeModulesJson(
+			filepath.Join(dst, modulesFilename),
+			&modules{Dirs: dirModules}); err != nil {
+			return err
+		}
+	}
+
 	ix.Flush()
 
 	return nil
@@ -456,19 +1602,35 @@ func Build(opt *IndexOptions, dst, src, url, rev string) (*IndexRef, error) {
 		}
 	}
 
-	if err := os.Mkdir(filepath.Join(dst, "raw"), os.ModePerm); err != nil {
+	// the copies of the files indexed by an earlier run of the build that
+	// was cut short are kept.
+	if err := os.MkdirAll(filepath.Join(dst, "raw"), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	prog, err := startBuild(dst, url, rev, opt.ShardSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := indexAllFiles(opt, prog, dst, src); err != nil {
+		return nil, err
+	}
+
+	if err := prog.finish(); err != nil {
 		return nil, err
 	}
 
-	if err := indexAllFiles(opt, dst, src); err != nil {
+	if err := writeChecksums(dst); err != nil {
 		return nil, err
 	}
 
 	r := &IndexRef{
-		Url:  url,
-		Rev:  rev,
-		Time: time.Now(),
-		dir:  dst,
+		Url:                  url,
+		Rev:                  rev,
+		Time:                 time.Now(),
+		dir:                  dst,
+		MaxExcerptLineLength: opt.MaxExcerptLineLength,
 	}
 
 	if err := r.writeManifest(); err != nil {
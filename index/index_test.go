@@ -1,10 +1,16 @@
 package index
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"runtime"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -59,6 +65,38 @@ func TestSearch(t *testing.T) {
 	}
 }
 
+func TestQueryError(t *testing.T) {
+	ref, err := buildIndex(url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	tests := []struct {
+		pat string
+		opt *SearchOptions
+	}{
+		{"(", &SearchOptions{}},
+		{"index", &SearchOptions{FileRegexp: "("}},
+		{"index", &SearchOptions{Sort: "size"}},
+		{"index", &SearchOptions{Modified: "yesterday"}},
+	}
+
+	for _, test := range tests {
+		_, err := idx.Search(test.pat, test.opt)
+		var qe *QueryError
+		if !errors.As(err, &qe) {
+			t.Errorf("%q %+v: expected a query error, got %v", test.pat, test.opt, err)
+		}
+	}
+}
+
 func TestRemove(t *testing.T) {
 	ref, err := buildIndex(url, rev)
 	if err != nil {
@@ -100,3 +138,731 @@ func TestRead(t *testing.T) {
 	}
 	defer idx.Close()
 }
+
+// Tests that an index that can't be read into memory is still searched
+// from disk, rather than taking the process down.
+func TestLoadIntoMemoryFails(t *testing.T) {
+	ref, err := buildIndex(url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	if err := os.Remove(filepath.Join(ref.dir, "tri")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := idx.LoadIntoMemory(); err == nil {
+		t.Fatal("expected an error for an index whose trigrams are gone")
+	}
+	if idx.InMemory() {
+		t.Fatal("expected the index to stay on disk")
+	}
+
+	if _, err := idx.Search("func Test", &SearchOptions{}); err != nil {
+		t.Fatalf("expected the index to still be searched from disk: %s", err)
+	}
+}
+
+func TestLoadIntoMemory(t *testing.T) {
+	ref, err := buildIndex(url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	opt := &SearchOptions{LinesOfContext: 1}
+	onDisk, err := idx.Search("func Test", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := idx.LoadIntoMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !idx.InMemory() || size == 0 {
+		t.Fatalf("expected the index to be in memory, loaded %d bytes", size)
+	}
+
+	inMemory, err := idx.Search("func Test", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(onDisk.Matches, inMemory.Matches) {
+		t.Fatalf("expected the same matches from memory as from disk")
+	}
+
+	if len(inMemory.Matches) == 0 {
+		t.Fatalf("expected some matches")
+	}
+}
+
+func TestParallelScan(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	// scan in parallel even on a single cpu.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	// more than enough files to be scanned in parallel, all but every
+	// third one matching.
+	const numFiles = 4 * minParallelScan
+	for i := 0; i < numFiles; i++ {
+		body := fmt.Sprintf("needle %d\nhay\nneedle %d\n", i, i)
+		if i%3 == 0 {
+			body = fmt.Sprintf("needl %d\n", i)
+		}
+		name := filepath.Join(src, fmt.Sprintf("f%03d.txt", i))
+		if err := ioutil.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := Build(&IndexOptions{}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	var all []string
+	for i := 0; i < numFiles; i++ {
+		if i%3 != 0 {
+			all = append(all, fmt.Sprintf("f%03d.txt", i))
+		}
+	}
+
+	for _, page := range []struct{ offset, limit int }{{0, 0}, {0, 5}, {7, 10}, {40, 10}} {
+		res, err := idx.Search("needle", &SearchOptions{
+			LinesOfContext: 1,
+			Offset:         page.offset,
+			Limit:          page.limit,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.FilesWithMatch != len(all) {
+			t.Fatalf("expected %d files with matches, got %d", len(all), res.FilesWithMatch)
+		}
+
+		expected := all[page.offset:]
+		if page.limit > 0 && len(expected) > page.limit {
+			expected = expected[:page.limit]
+		}
+
+		var got []string
+		for _, fm := range res.Matches {
+			got = append(got, fm.Filename)
+			if len(fm.Matches) != 2 || fm.Matches[1].Before[0] != "hay" {
+				t.Fatalf("unexpected matches in %s: %+v", fm.Filename, fm.Matches)
+			}
+		}
+
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("offset %d limit %d: expected %v, got %v", page.offset, page.limit, expected, got)
+		}
+	}
+}
+
+func TestSearchBatch(t *testing.T) {
+	ref, err := buildIndex(url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	pats := []string{"func Test", "t.Fatal", "err", "package index"}
+	opts := []*SearchOptions{
+		{LinesOfContext: 2},
+		{Limit: 1},
+		{LinesOfContext: 1},
+		{FileRegexp: "grep"},
+	}
+
+	res, errs := idx.SearchBatch(pats, opts)
+	for i, pat := range pats {
+		if errs[i] != nil {
+			t.Fatalf("%s: %s", pat, errs[i])
+		}
+
+		exp, err := idx.Search(pat, opts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(res[i].Matches, exp.Matches) || res[i].FilesWithMatch != exp.FilesWithMatch {
+			t.Fatalf("%s: expected the same results in a batch as alone", pat)
+		}
+	}
+
+	// a bad query only fails itself.
+	res, errs = idx.SearchBatch([]string{"(", "func"}, []*SearchOptions{{}, {}})
+	if errs[0] == nil || errs[1] != nil || len(res[1].Matches) == 0 {
+		t.Fatalf("expected only the first query to fail: %v", errs)
+	}
+}
+
+func TestStructuralSearch(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	files := map[string]string{
+		"a.go": "package a\n\nfunc f() {\n\tfoo(bar(\n\t\t1), nil)\n\tfoo(x, y)\n}\n",
+		"b.go": "package b\n\n// foo(x, nil)\nvar s = \"foo(x, nil)\"\n",
+		"c.py": "foo(\")\", nil)\n",
+		"d.go": "f(1,2,3,4,X)\nf(" + strings.Repeat("1,", 400) + "0)\n",
+	}
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := Build(&IndexOptions{}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	res, err := idx.Search("foo(:[args], nil)", &SearchOptions{
+		Structural:     true,
+		LinesOfContext: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.FilesWithMatch != 2 {
+		t.Fatalf("expected matches in 2 files, got %d", res.FilesWithMatch)
+	}
+
+	m := res.Matches[0].Matches
+	if res.Matches[0].Filename != "a.go" || len(m) != 1 {
+		t.Fatalf("expected one match in a.go, got %+v", res.Matches[0])
+	}
+
+	// the rest of a match spanning lines comes first in its after context.
+	if m[0].LineNumber != 4 || m[0].Line != "\tfoo(bar(" ||
+		!reflect.DeepEqual(m[0].Before, []string{"func f() {"}) ||
+		!reflect.DeepEqual(m[0].After, []string{"\t\t1), nil)", "\tfoo(x, y)"}) {
+		t.Fatalf("unexpected match: %+v", m[0])
+	}
+
+	if res.Truncated != nil {
+		t.Fatalf("expected a complete response, got %+v", res.Truncated)
+	}
+
+	// a file that matching gives up on may have more matches.
+	res, err = idx.Search("f(:[a],:[b],:[c],:[d],X)", &SearchOptions{Structural: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Matches) != 1 || len(res.Matches[0].Matches) != 1 {
+		t.Fatalf("expected the match before the long call, got %+v", res.Matches)
+	}
+
+	if res.Truncated == nil || !res.Truncated.Structural {
+		t.Fatalf("expected the response to say matching gave up, got %+v", res.Truncated)
+	}
+
+	if _, err := idx.Search("foo(:[args", &SearchOptions{Structural: true}); err == nil {
+		t.Fatal("expected a bad structural pattern to fail")
+	}
+}
+
+func TestSearchWithin(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	writeTestFile(t, src, "a.go", "package a\n\nimport \"net/http\"\n\nfunc Handle() {}\n")
+	writeTestFile(t, src, "b.go", "package b\n\nimport \"os\"\n\nfunc Handle() {}\n")
+	writeTestFile(t, src, "c.go", "package c\n\nimport \"NET/HTTP\"\n\nfunc Handle() {}\n")
+
+	dst, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := Build(&IndexOptions{}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	tests := []struct {
+		within     []string
+		ignoreCase bool
+		files      []string
+	}{
+		{nil, false, []string{"a.go", "b.go", "c.go"}},
+		{[]string{"net/http"}, false, []string{"a.go"}},
+		{[]string{"net/http"}, true, []string{"a.go", "c.go"}},
+		{[]string{"net/http", "package b"}, false, nil},
+		{[]string{"import"}, false, []string{"a.go", "b.go", "c.go"}},
+	}
+
+	for _, test := range tests {
+		res, err := idx.Search("func Handle", &SearchOptions{Within: test.within, IgnoreCase: test.ignoreCase})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var files []string
+		for _, m := range res.Matches {
+			files = append(files, m.Filename)
+		}
+		sort.Strings(files)
+
+		if !reflect.DeepEqual(files, test.files) {
+			t.Fatalf("within %v: expected %v, got %v", test.within, test.files, files)
+		}
+	}
+
+	if _, err := idx.Search("func", &SearchOptions{Within: []string{"("}}); err == nil {
+		t.Fatal("expected a bad within pattern to fail the search")
+	}
+}
+
+func TestExcludeFiles(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	for _, name := range []string{"cmd/main.go", "vendor/lib/lib.go", "web/app.js", "web/vendor/jquery.js"} {
+		writeTestFile(t, src, name, "var hound = 1\n")
+	}
+
+	dst, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := Build(&IndexOptions{}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	tests := []struct {
+		files, exclude string
+		exp            []string
+	}{
+		{"", "", []string{"cmd/main.go", "vendor/lib/lib.go", "web/app.js", "web/vendor/jquery.js"}},
+		{"", "vendor/", []string{"cmd/main.go", "web/app.js"}},
+		{"", "^vendor/", []string{"cmd/main.go", "web/app.js", "web/vendor/jquery.js"}},
+		{"\\.go$", "^vendor/", []string{"cmd/main.go"}},
+		{"", "(?:vendor/|\\.js$)", []string{"cmd/main.go"}},
+	}
+
+	for _, test := range tests {
+		res, err := idx.Search("hound", &SearchOptions{FileRegexp: test.files, ExcludeFileRegexp: test.exclude})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var files []string
+		for _, m := range res.Matches {
+			files = append(files, m.Filename)
+		}
+		sort.Strings(files)
+
+		if !reflect.DeepEqual(files, test.exp) {
+			t.Fatalf("files %q, exclude %q: expected %v, got %v", test.files, test.exclude, test.exp, files)
+		}
+	}
+}
+
+func TestWholeWord(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	writeTestFile(t, src, "a.go", "func get() {}\nfunc getUser() {}\nx := cache.get(key)\ny := forget()\n")
+
+	dst, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := Build(&IndexOptions{}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	lines := func(pat string, opt *SearchOptions) []int {
+		res, err := idx.Search(pat, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var lines []int
+		for _, fm := range res.Matches {
+			for _, m := range fm.Matches {
+				lines = append(lines, m.LineNumber)
+			}
+		}
+		return lines
+	}
+
+	tests := []struct {
+		pat string
+		opt *SearchOptions
+		exp []int
+	}{
+		{"get", &SearchOptions{}, []int{1, 2, 3, 4}},
+		{"get", &SearchOptions{WholeWord: true}, []int{1, 3}},
+		{"GET", &SearchOptions{WholeWord: true, IgnoreCase: true}, []int{1, 3}},
+		// the whole of an alternation has to be a word.
+		{"get|getUser", &SearchOptions{WholeWord: true}, []int{1, 2, 3}},
+		// a quoted literal is still bounded.
+		{regexp.QuoteMeta("cache.get"), &SearchOptions{WholeWord: true}, []int{3}},
+	}
+	for _, test := range tests {
+		if got := lines(test.pat, test.opt); !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%q %+v: expected lines %v, got %v", test.pat, test.opt, test.exp, got)
+		}
+	}
+}
+
+func TestSearchCaps(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	writeTestFile(t, src, "a.txt", "todo 1\ntodo 2\ntodo 3\n")
+	writeTestFile(t, src, "b.txt", "todo 4\ntodo 5\n")
+	writeTestFile(t, src, "c.txt", "todo 6\n")
+	writeTestFile(t, src, "many.txt", strings.Repeat("many\n", matchLimit+10))
+
+	dst, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := Build(&IndexOptions{}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	type result struct {
+		Files     map[string]int
+		Cut       []string
+		Truncated Truncation
+	}
+	search := func(pat string, opt *SearchOptions) result {
+		res, err := idx.Search(pat, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := result{Files: map[string]int{}}
+		for _, fm := range res.Matches {
+			r.Files[fm.Filename] = len(fm.Matches)
+			if fm.Truncated {
+				r.Cut = append(r.Cut, fm.Filename)
+			}
+		}
+		if res.Truncated != nil {
+			r.Truncated = *res.Truncated
+		}
+		return r
+	}
+
+	tests := []struct {
+		opt *SearchOptions
+		exp result
+	}{
+		{&SearchOptions{}, result{map[string]int{"a.txt": 3, "b.txt": 2, "c.txt": 1}, nil, Truncation{}}},
+		{&SearchOptions{MaxMatchesPerFile: 2}, result{map[string]int{"a.txt": 2, "b.txt": 2, "c.txt": 1}, []string{"a.txt"}, Truncation{MatchesPerFile: true}}},
+		{&SearchOptions{MaxFiles: 2}, result{map[string]int{"a.txt": 3, "b.txt": 2}, nil, Truncation{Files: true}}},
+		{&SearchOptions{MaxFiles: 5, Limit: 1}, result{map[string]int{"a.txt": 3}, nil, Truncation{Files: true}}},
+		{&SearchOptions{MaxMatches: 4}, result{map[string]int{"a.txt": 3, "b.txt": 1}, []string{"b.txt"}, Truncation{Files: true, Matches: true}}},
+	}
+	for _, test := range tests {
+		if got := search("todo", test.opt); !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%+v: expected %+v, got %+v", test.opt, test.exp, got)
+		}
+	}
+
+	// a search past the cap on matches is trimmed rather than failing.
+	got := search("many", &SearchOptions{})
+	exp := result{map[string]int{"many.txt": matchLimit}, []string{"many.txt"}, Truncation{MatchesPerFile: true}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected %d matches and the file truncated, got %+v", matchLimit, got)
+	}
+}
+
+func TestMatchSpans(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	writeTestFile(t, src, "a.txt", "Foo foo fOO\nnaïve foo\nfood\n")
+
+	dst, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := Build(&IndexOptions{}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	spans := func(pat string, opt *SearchOptions) map[int][]Span {
+		res, err := idx.Search(pat, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := map[int][]Span{}
+		for _, fm := range res.Matches {
+			for _, m := range fm.Matches {
+				got[m.LineNumber] = m.Spans
+			}
+		}
+		return got
+	}
+
+	tests := []struct {
+		pat string
+		opt *SearchOptions
+		exp map[int][]Span
+	}{
+		{"foo", &SearchOptions{}, map[int][]Span{1: {{4, 7}}, 2: {{7, 10}}, 3: {{0, 3}}}},
+		// offsets are in bytes, and ï takes two.
+		{"foo", &SearchOptions{IgnoreCase: true}, map[int][]Span{1: {{0, 3}, {4, 7}, {8, 11}}, 2: {{7, 10}}, 3: {{0, 3}}}},
+		{"foo", &SearchOptions{IgnoreCase: true, WholeWord: true}, map[int][]Span{1: {{0, 3}, {4, 7}, {8, 11}}, 2: {{7, 10}}}},
+		// empty matches have nothing to highlight.
+		{"^", &SearchOptions{}, map[int][]Span{1: nil, 2: nil, 3: nil}},
+	}
+	for _, test := range tests {
+		if got := spans(test.pat, test.opt); !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%q %+v: expected spans %v, got %v", test.pat, test.opt, test.exp, got)
+		}
+	}
+}
+
+func TestHasUpperCase(t *testing.T) {
+	tests := map[string]bool{
+		"foo":             false,
+		"Foo":             true,
+		"fooBar":          true,
+		`\S+\w\D`:         false,
+		`\pL\p{Greek}`:    false,
+		`\PL\P{Lu}x`:      false,
+		`\x4A\x{004A}`:    false,
+		`(?P<Name>a)`:     false,
+		`(?P<Name>a)B`:    true,
+		`[A-Z]`:           true,
+		`(?i)foo`:         false,
+		`\\Foo`:           true,
+		"ünïcödé":         false,
+		"Ünïcödé":         true,
+		`func \w+\(ctx\)`: false,
+	}
+	for pat, exp := range tests {
+		if got := HasUpperCase(pat); got != exp {
+			t.Errorf("expected %q to have an upper case letter: %v, got %v", pat, exp, got)
+		}
+	}
+}
+
+func TestBytesRead(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	a := "func needle() {}\n" + strings.Repeat("// padding\n", 100)
+	b := strings.Repeat("// more padding\n", 200) + "x := needle()\n"
+	writeTestFile(t, src, "a.go", a)
+	writeTestFile(t, src, "b.go", b)
+	writeTestFile(t, src, "c.go", "nothing to see\n")
+
+	dst, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := Build(&IndexOptions{}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	check := func(what string) {
+		res, err := idx.Search("needle", &SearchOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.FilesOpened != 2 {
+			t.Errorf("%s: expected the 2 candidates to be scanned, got %d", what, res.FilesOpened)
+		}
+		if exp := int64(len(a) + len(b)); res.BytesRead != exp {
+			t.Errorf("%s: expected %d bytes to be read, got %d", what, exp, res.BytesRead)
+		}
+	}
+
+	check("on disk")
+
+	if _, err := idx.LoadIntoMemory(); err != nil {
+		t.Fatal(err)
+	}
+	check("in memory")
+}
+
+func TestCancel(t *testing.T) {
+	ref, err := buildIndex(url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	cancel := make(chan struct{})
+	close(cancel)
+	if _, err := idx.Search("func", &SearchOptions{Cancel: cancel}); err != ErrCancelled {
+		t.Fatalf("expected the search to be cancelled, got %v", err)
+	}
+
+	if _, err := idx.Search("func", &SearchOptions{Cancel: make(chan struct{})}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindPaths(t *testing.T) {
+	ref, err := buildIndex(url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	paths, more, err := idx.FindPaths(regexp.MustCompile(`^index\.go$`), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(paths, []string{"index.go"}) || more {
+		t.Fatalf("expected only index.go, got %v (more: %v)", paths, more)
+	}
+
+	paths, more, err = idx.FindPaths(regexp.MustCompile(`_test\.go$`), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || !strings.HasSuffix(paths[0], "_test.go") || !more {
+		t.Fatalf("expected one of the tests and more of them, got %v (more: %v)", paths, more)
+	}
+}
@@ -0,0 +1,100 @@
+package index
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// The markers that stand for the parts of a line that were cut from an
+// excerpt, with the number of bytes that each of them stands for, so the
+// offsets of what is left in the line can still be worked out.
+const (
+	lineCutBefore = "…[%d bytes]"
+	lineCutAfter  = "[%d bytes]…"
+)
+
+// Cut a line down to at most max bytes, along with markers for what was
+// left out, keeping the part that starts a quarter of the way before the
+// first span. The spans are moved to where they are in the excerpt, and
+// those that are outside of it are left out. A max of zero or less keeps
+// the whole line.
+func cutLine(line []byte, spans []Span, max int) (string, []Span) {
+	if max <= 0 || len(line) <= max {
+		return string(line), spans
+	}
+
+	start := 0
+	if len(spans) > 0 {
+		start = spans[0].Start - max/4
+	}
+	if start > len(line)-max {
+		start = len(line) - max
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + max
+
+	// runes aren't split.
+	for start > 0 && !utf8.RuneStart(line[start]) {
+		start--
+	}
+	for end < len(line) && !utf8.RuneStart(line[end]) {
+		end--
+	}
+
+	var prefix, suffix string
+	if start > 0 {
+		prefix = fmt.Sprintf(lineCutBefore, start)
+	}
+	if end < len(line) {
+		suffix = fmt.Sprintf(lineCutAfter, len(line)-end)
+	}
+
+	var cut []Span
+	for _, s := range spans {
+		if s.End <= start || s.Start >= end {
+			continue
+		}
+		if s.Start < start {
+			s.Start = start
+		}
+		if s.End > end {
+			s.End = end
+		}
+		shift := len(prefix) - start
+		cut = append(cut, Span{s.Start + shift, s.End + shift})
+	}
+
+	return prefix + string(line[start:end]) + suffix, cut
+}
+
+// Cut lines of context down to at most max bytes each, from their start.
+func cutLines(lines [][]byte, max int) []string {
+	res := make([]string, len(lines))
+	for i, line := range lines {
+		res[i], _ = cutLine(line, nil, max)
+	}
+	return res
+}
+
+// Columns are where each of the spans of a match starts in the whole of
+// its line, as 1-based byte offsets like those of grep and vim, even if
+// the line was cut down for its excerpt. A match without spans has the
+// start of its line.
+func (m *Match) Columns() []int {
+	if len(m.Spans) == 0 {
+		return []int{1}
+	}
+
+	var cut, marker int
+	if _, err := fmt.Sscanf(m.Line, lineCutBefore, &cut); err == nil {
+		marker = len(fmt.Sprintf(lineCutBefore, cut))
+	}
+
+	cols := make([]int, len(m.Spans))
+	for i, s := range m.Spans {
+		cols[i] = s.Start - marker + cut + 1
+	}
+	return cols
+}
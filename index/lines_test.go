@@ -0,0 +1,114 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCutLine(t *testing.T) {
+	long := strings.Repeat("a", 100) + "needle" + strings.Repeat("b", 100)
+
+	tests := []struct {
+		line  string
+		spans []Span
+		max   int
+		exp   string
+		expSp []Span
+	}{
+		{"short", []Span{{0, 5}}, 10, "short", []Span{{0, 5}}},
+		{long, nil, 0, long, nil},
+		{long, nil, 10, "aaaaaaaaaa[196 bytes]…", nil},
+		{long, []Span{{100, 106}}, 20, "…[95 bytes]aaaaaneedlebbbbbbbbb[91 bytes]…", []Span{{18, 24}}},
+		// the excerpt doesn't run past the end of the line.
+		{long, []Span{{200, 206}}, 20, "…[186 bytes]bbbbbbbbbbbbbbbbbbbb", []Span{{28, 34}}},
+		// spans that run past the excerpt are clipped to it.
+		{long, []Span{{0, 206}}, 10, "aaaaaaaaaa[196 bytes]…", []Span{{0, 10}}},
+		// runes aren't split.
+		{"éééééé", nil, 5, "éé[8 bytes]…", nil},
+	}
+	for _, test := range tests {
+		line, spans := cutLine([]byte(test.line), test.spans, test.max)
+		if line != test.exp || !reflect.DeepEqual(spans, test.expSp) {
+			t.Errorf("cut %q %v to %d: expected %q %v, got %q %v", test.line, test.spans, test.max, test.exp, test.expSp, line, spans)
+		}
+	}
+}
+
+func TestMaxExcerptLineLength(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	bundle := strings.Repeat("x", 5000) + "needle" + strings.Repeat("y", 5000)
+	// the index skips files with too many long lines.
+	writeTestFile(t, src, "bundle.txt", strings.Repeat("z", 3000)+"\n"+bundle+"\n"+strings.Repeat("short\n", 30))
+
+	dst, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := Build(&IndexOptions{MaxExcerptLineLength: 100}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	// the cap is kept with the index.
+	read, err := Read(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.MaxExcerptLineLength != 100 {
+		t.Fatalf("expected the cap to be read back, got %d", read.MaxExcerptLineLength)
+	}
+
+	idx, err := read.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	res, err := idx.Search("needle", &SearchOptions{LinesOfContext: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Matches) != 1 || len(res.Matches[0].Matches) != 1 {
+		t.Fatalf("expected one match, got %v", res.Matches)
+	}
+
+	m := res.Matches[0].Matches[0]
+	if !strings.HasPrefix(m.Line, "…[4975 bytes]") || !strings.HasSuffix(m.Line, "[4931 bytes]…") {
+		t.Fatalf("expected the line to be cut around the match, got %q", m.Line)
+	}
+	if len(m.Spans) != 1 || m.Line[m.Spans[0].Start:m.Spans[0].End] != "needle" {
+		t.Fatalf("expected the span to point at the match, got %v", m.Spans)
+	}
+	if exp := []string{strings.Repeat("z", 100) + "[2900 bytes]…"}; !reflect.DeepEqual(m.Before, exp) {
+		t.Fatalf("expected the context to be cut, got %q", m.Before)
+	}
+}
+
+func TestMatchColumns(t *testing.T) {
+	long := []byte(strings.Repeat("a", 100) + "needle" + strings.Repeat("b", 100) + "needle")
+
+	line, spans := cutLine(long, []Span{{100, 106}, {206, 212}}, 20)
+	tests := []struct {
+		m   *Match
+		exp []int
+	}{
+		{&Match{Line: "a needle"}, []int{1}},
+		{&Match{Line: "a needle", Spans: []Span{{2, 8}}}, []int{3}},
+		{&Match{Line: line, Spans: spans}, []int{101}},
+	}
+	for _, test := range tests {
+		if cols := test.m.Columns(); !reflect.DeepEqual(cols, test.exp) {
+			t.Errorf("expected the columns of %q to be %v, got %v", test.m.Line, test.exp, cols)
+		}
+	}
+}
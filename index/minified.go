@@ -0,0 +1,236 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	sourceMapsFilename = "sourcemaps.json"
+
+	reasonMinified = "Minified files are excluded."
+
+	// Files smaller than this are never taken for minified by the length
+	// of their lines.
+	minifiedMinSize = 1024
+
+	// How much of a file is read to find the length of its lines, and the
+	// longest that a line is on average in a file that isn't minified.
+	minifiedPeekSize    = 64 * 1024
+	minifiedMaxMeanLine = 300
+)
+
+// The extensions of the files that are checked for being minified.
+var minifiedExts = map[string]bool{
+	".js":  true,
+	".mjs": true,
+	".cjs": true,
+	".css": true,
+}
+
+var (
+	// the comment, on the last lines of a bundle, that says where its
+	// source map is.
+	sourceMappingURL = regexp.MustCompile(`^\s*(//|/\*)[#@]\s*sourceMappingURL=(\S+?)\s*(\*/)?\s*$`)
+
+	// the scheme that bundlers put in front of sources, like webpack://.
+	sourceScheme = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:/*`)
+)
+
+func isSourceMap(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".js.map") || strings.HasSuffix(name, ".css.map")
+}
+
+// Whether the file at path is a minified script or stylesheet, by its
+// name or by the length of its lines, or the source map of one.
+func isMinified(path, rel string, size int64) (bool, error) {
+	name := strings.ToLower(filepath.Base(rel))
+	if isSourceMap(name) {
+		return true, nil
+	}
+
+	if !minifiedExts[filepath.Ext(name)] {
+		return false, nil
+	}
+
+	if strings.Contains(name, ".min.") {
+		return true, nil
+	}
+
+	if size < minifiedMinSize {
+		return false, nil
+	}
+
+	r, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	buf := make([]byte, minifiedPeekSize)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	buf = buf[:n]
+
+	lines := bytes.Count(buf, []byte("\n")) + 1
+	return len(buf)/lines > minifiedMaxMeanLine, nil
+}
+
+type sourceMap struct {
+	SourceRoot     string    `json:"sourceRoot"`
+	Sources        []string  `json:"sources"`
+	SourcesContent []*string `json:"sourcesContent"`
+}
+
+// The path, relative to src, of the source map of the minified file at rel:
+// the one its sourceMappingURL comment points to, or else the file next
+// to it with .map added, if either is in the repo. Only maps that are
+// excluded as minified themselves count, so the sources indexed under
+// their paths can't clash with a file.
+func findSourceMap(src, rel string) (string, error) {
+	if isSourceMap(rel) {
+		return "", nil
+	}
+
+	r, err := os.Open(filepath.Join(src, rel))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	// the comment is on one of the last lines.
+	var url string
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 16*1024*1024)
+	for s.Scan() {
+		if m := sourceMappingURL.FindStringSubmatch(s.Text()); m != nil {
+			url = m[2]
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+
+	rel = filepath.ToSlash(rel)
+	cands := []string{rel + ".map"}
+	if url != "" && !sourceScheme.MatchString(url) && !strings.HasPrefix(url, "/") {
+		cands = append([]string{path.Join(path.Dir(rel), url)}, cands...)
+	}
+
+	for _, c := range cands {
+		if strings.HasPrefix(c, "../") || !isSourceMap(c) {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(src, filepath.FromSlash(c))); err == nil && info.Mode().IsRegular() {
+			return c, nil
+		}
+	}
+	return "", nil
+}
+
+// The path of a source of a map, relative to the directory of the map
+// and cleaned of the schemes and parent directories that bundlers add,
+// and whether it could be in the repo as it is.
+func sourcePath(root, source string) (string, bool) {
+	p := path.Join(root, source)
+	local := !sourceScheme.MatchString(p) && !path.IsAbs(p)
+	p = path.Clean("/" + sourceScheme.ReplaceAllString(p, ""))
+	return strings.TrimPrefix(p, "/"), local
+}
+
+// Index the original sources of the minified file at rel that its source
+// map has the contents of, each under the path of the map followed by the
+// path of the source. Sources that are in the repo already, and those of
+// packages that were bundled with it, are left out. The paths of the
+// sources that were indexed are recorded in maps with that of the map.
+// add indexes a file, returning the reason it was rejected if it was.
+func addSourceMapToIndex(src, rel string, maps map[string]string, add func(name string, r io.Reader) (string, error)) error {
+	mapRel, err := findSourceMap(src, rel)
+	if err != nil || mapRel == "" {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(src, filepath.FromSlash(mapRel)))
+	if err != nil {
+		return err
+	}
+
+	// a broken map leaves its sources out but doesn't stop the index.
+	var sm sourceMap
+	if err := json.Unmarshal(data, &sm); err != nil {
+		return nil
+	}
+
+	for i, source := range sm.Sources {
+		if i >= len(sm.SourcesContent) || sm.SourcesContent[i] == nil {
+			continue
+		}
+
+		p, local := sourcePath(sm.SourceRoot, source)
+		if p == "" || containsString(strings.Split(p, "/"), "node_modules") {
+			continue
+		}
+
+		if local {
+			inRepo := path.Join(path.Dir(mapRel), sm.SourceRoot, source)
+			if !strings.HasPrefix(inRepo, "../") {
+				if _, err := os.Stat(filepath.Join(src, filepath.FromSlash(inRepo))); err == nil {
+					continue
+				}
+			}
+		}
+
+		name := mapRel + "/" + p
+		if _, ok := maps[name]; ok {
+			continue
+		}
+
+		reason, err := add(name, strings.NewReader(*sm.SourcesContent[i]))
+		if err != nil {
+			return err
+		}
+		if reason == "" {
+			maps[name] = mapRel
+		}
+	}
+	return nil
+}
+
+func writeSourceMapsJson(filename string, maps map[string]string) error {
+	w, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	return json.NewEncoder(w).Encode(maps)
+}
+
+// Read the sources that were indexed from source maps, if the repo has
+// any.
+func loadSourceMaps(dir string) (map[string]string, error) {
+	r, err := os.Open(filepath.Join(dir, sourceMapsFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var maps map[string]string
+	if err := json.NewDecoder(r).Decode(&maps); err != nil {
+		return nil, err
+	}
+	return maps, nil
+}
@@ -0,0 +1,154 @@
+package index
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestIsMinified(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	readable := strings.Repeat("function add(a, b) {\n  return a + b;\n}\n\n", 100)
+	bundle := strings.Repeat("function add(a,b){return a+b}", 100) + "\n//# sourceMappingURL=bundle.js.map\n"
+
+	tests := map[string]struct {
+		data string
+		exp  bool
+	}{
+		"src/app.js":          {readable, false},
+		"dist/bundle.js":      {bundle, true},
+		"dist/vendor.min.js":  {"var a=1;\n", true},
+		"dist/site.min.css":   {"a{}\n", true},
+		"dist/bundle.js.map":  {"{}", true},
+		"dist/short.js":       {"var a=1;var b=2;", false},
+		"data/wide.json":      {bundle, false},
+		"styles/theme.css":    {strings.Repeat("a {\n  color: red;\n}\n", 100), false},
+		"styles/inlined.js":   {strings.Repeat("x", minifiedMinSize) + "\n", true},
+		"lib/module.min.mjs":  {"export const a=1;\n", true},
+		"docs/minutes.min.md": {"notes\n", false},
+	}
+	for rel, test := range tests {
+		writeTestFile(t, dir, rel, test.data)
+		min, err := isMinified(filepath.Join(dir, rel), rel, int64(len(test.data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if min != test.exp {
+			t.Errorf("expected %s to be minified: %v, got %v", rel, test.exp, min)
+		}
+	}
+}
+
+func TestSourceMaps(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	content := func(s string) *string { return &s }
+	sm, err := json.Marshal(&sourceMap{
+		Sources: []string{
+			"webpack:///./src/cart/total.js",
+			"webpack:///./node_modules/left-pad/index.js",
+			"../../src/main.js",
+			"webpack:///webpack/bootstrap",
+		},
+		SourcesContent: []*string{
+			content("export function cartTotal(items) {\n  return items.reduce((t, i) => t + i.price, 0);\n}\n"),
+			content("module.exports = function cartTotal() {};\n"),
+			content("import { cartTotal } from './cart/total';\n"),
+			nil,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, src, "src/main.js", "import { cartTotal } from './cart/total';\n")
+	writeTestFile(t, src, "dist/app.min.js", "function cartTotal(t){return t.reduce(function(t,n){return t+n.price},0)}\n//# sourceMappingURL=maps/app.js.map\n")
+	writeTestFile(t, src, "dist/maps/app.js.map", string(sm))
+	writeTestFile(t, src, "dist/other.min.js", "function cartTotal(){}\n")
+
+	build := func(opt *IndexOptions) *Index {
+		dst, err := ioutil.TempDir(os.TempDir(), "hound")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ref, err := Build(opt, dst, src, url, rev)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		idx, err := ref.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return idx
+	}
+
+	search := func(idx *Index) map[string]string {
+		res, err := idx.Search("cartTotal", &SearchOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files := map[string]string{}
+		for _, fm := range res.Matches {
+			files[fm.Filename] = fm.SourceMap
+		}
+		return files
+	}
+
+	noExclusion := build(&IndexOptions{})
+	defer noExclusion.Ref.Remove()
+	defer noExclusion.Close()
+	if files := search(noExclusion); len(files) != 4 {
+		t.Fatalf("expected every file to be searched without the exclusion, got %v", files)
+	}
+
+	excluded := build(&IndexOptions{ExcludeMinified: true})
+	defer excluded.Ref.Remove()
+	defer excluded.Close()
+	if files := search(excluded); !reflect.DeepEqual(files, map[string]string{"src/main.js": ""}) {
+		t.Fatalf("expected the minified files and the map to be excluded, got %v", files)
+	}
+
+	ex, err := excluded.excludedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range ex {
+		if f.Reason == reasonMinified {
+			names = append(names, filepath.ToSlash(f.Filename))
+		}
+	}
+	sort.Strings(names)
+	if exp := []string{"dist/app.min.js", "dist/maps/app.js.map", "dist/other.min.js"}; !reflect.DeepEqual(names, exp) {
+		t.Fatalf("expected %v to be excluded as minified, got %v", exp, names)
+	}
+
+	// the sources in the repo already and those of packages are left out.
+	mapped := build(&IndexOptions{ExcludeMinified: true, SourceMaps: true})
+	defer mapped.Ref.Remove()
+	defer mapped.Close()
+	exp := map[string]string{
+		"src/main.js":                            "",
+		"dist/maps/app.js.map/src/cart/total.js": "dist/maps/app.js.map",
+	}
+	if files := search(mapped); !reflect.DeepEqual(files, exp) {
+		t.Fatalf("expected %v, got %v", exp, files)
+	}
+}
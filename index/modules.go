@@ -0,0 +1,143 @@
+package index
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const modulesFilename = "modules.json"
+
+// The manifests that name the module, or package, whose root is the
+// directory they are in, with how to read the name from each.
+var moduleManifests = map[string]func(filename string) (string, error){
+	"go.mod":       readGoModule,
+	"package.json": readPackageName,
+}
+
+// The modules of a repo, as recorded when it was indexed.
+type modules struct {
+	// The path of the module rooted at each directory that has one.
+	Dirs map[string]string
+}
+
+// Read the module path from a go.mod.
+func readGoModule(filename string) (string, error) {
+	r, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+
+		f := strings.Fields(line)
+		if len(f) != 2 || f[0] != "module" {
+			continue
+		}
+
+		if p, err := strconv.Unquote(f[1]); err == nil {
+			return p, nil
+		}
+		return f[1], nil
+	}
+
+	return "", s.Err()
+}
+
+// Read the name of an npm package from its package.json.
+func readPackageName(filename string) (string, error) {
+	r, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	var pkg struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r).Decode(&pkg); err != nil {
+		// a broken manifest doesn't keep the repo from being indexed.
+		return "", nil
+	}
+	return pkg.Name, nil
+}
+
+func writeModulesJson(filename string, m *modules) error {
+	w, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	return json.NewEncoder(w).Encode(m)
+}
+
+// Load the modules recorded for the index in dir, which are nil if the repo
+// doesn't have any or the index was built before they were recorded.
+func loadModules(dir string) (*modules, error) {
+	r, err := os.Open(filepath.Join(dir, modulesFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var m modules
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// The module that a file of the repo belongs to and the path of its
+// package, which is the module path followed by the directory of the file
+// within the module.
+func (m *modules) of(name string) (string, string) {
+	if m == nil {
+		return "", ""
+	}
+
+	dir := path.Dir(filepath.ToSlash(name))
+	for root := dir; ; root = path.Dir(root) {
+		if mod, ok := m.Dirs[root]; ok {
+			if root == dir {
+				return mod, mod
+			}
+			if root == "." {
+				return mod, mod + "/" + dir
+			}
+			return mod, mod + "/" + strings.TrimPrefix(dir, root+"/")
+		}
+		if root == "." || root == "/" {
+			return "", ""
+		}
+	}
+}
+
+// Whether a file belongs to the module with the given path, or to one of
+// the modules below it.
+func (m *modules) inModule(name, module string) bool {
+	mod, _ := m.of(name)
+	module = strings.TrimSuffix(module, "/")
+	return mod != "" && (mod == module || strings.HasPrefix(mod, module+"/"))
+}
+
+// Whether a file is in a package, or in one of the packages below it. The
+// package can be given by its full path or by any of its trailing
+// elements, like internal/auth for github.com/acme/foo/internal/auth.
+func (m *modules) inPackage(name, pkg string) bool {
+	_, p := m.of(name)
+	pkg = strings.Trim(pkg, "/")
+	return p != "" && pkg != "" && strings.Contains("/"+p+"/", "/"+pkg+"/")
+}
@@ -0,0 +1,91 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+)
+
+func TestModules(t *testing.T) {
+	src, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	writeTestFile(t, src, "go.mod", "// the service\nmodule github.com/acme/foo\n\ngo 1.21\n")
+	writeTestFile(t, src, "main.go", "needle\n")
+	writeTestFile(t, src, "internal/auth/auth.go", "needle\n")
+	writeTestFile(t, src, "internal/auth/token/token.go", "needle\n")
+	writeTestFile(t, src, "internal/authz/authz.go", "needle\n")
+	writeTestFile(t, src, "tools/go.mod", "module \"github.com/acme/foo/tools\"\n")
+	writeTestFile(t, src, "tools/gen/gen.go", "needle\n")
+	writeTestFile(t, src, "web/package.json", `{"name": "@acme/web", "version": "1.0.0"}`)
+	writeTestFile(t, src, "web/src/app.js", "needle\n")
+
+	dst, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	ref, err := Build(&IndexOptions{}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	tests := []struct {
+		opt      SearchOptions
+		expected []string
+	}{
+		{SearchOptions{Module: "github.com/acme/foo/tools"}, []string{"tools/gen/gen.go"}},
+		{SearchOptions{Module: "github.com/acme/foo"}, []string{
+			"internal/auth/auth.go",
+			"internal/auth/token/token.go",
+			"internal/authz/authz.go",
+			"main.go",
+			"tools/gen/gen.go",
+		}},
+		{SearchOptions{Module: "github.com/acme/fo"}, nil},
+		{SearchOptions{Package: "internal/auth"}, []string{
+			"internal/auth/auth.go",
+			"internal/auth/token/token.go",
+		}},
+		{SearchOptions{Package: "github.com/acme/foo/internal/auth/token"}, []string{
+			"internal/auth/token/token.go",
+		}},
+		{SearchOptions{Module: "@acme/web", Package: "@acme/web/src"}, []string{"web/src/app.js"}},
+	}
+
+	for _, test := range tests {
+		opt := test.opt
+		res, err := idx.Search("needle", &opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, m := range res.Matches {
+			got = append(got, m.Filename)
+		}
+		sort.Strings(got)
+
+		if len(got) != len(test.expected) {
+			t.Errorf("%+v: expected %v, got %v", test.opt, test.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("%+v: expected %v, got %v", test.opt, test.expected, got)
+				break
+			}
+		}
+	}
+}
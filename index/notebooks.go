@@ -0,0 +1,214 @@
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const notebooksFilename = "notebooks.json"
+
+// The kinds of cells whose sources are indexed. The others, like raw
+// cells, and the outputs of all of them are left out.
+var notebookCellTypes = map[string]bool{
+	"code":     true,
+	"markdown": true,
+	"heading":  true,
+}
+
+// NotebookCell is the cell of a Jupyter notebook that a match is in.
+type NotebookCell struct {
+	// The position of the cell in the notebook, from 1.
+	Number int
+
+	// The kind of cell, "code" or "markdown".
+	Type string
+}
+
+// Where the source of a cell is in the text of a notebook that was
+// indexed, by line from 1.
+type notebookCell struct {
+	NotebookCell
+	First int
+	Last  int
+}
+
+// The cells of the notebooks of a repo, by file.
+type notebooks map[string][]*notebookCell
+
+func isNotebook(name string) bool {
+	return strings.ToLower(filepath.Ext(name)) == ".ipynb"
+}
+
+// The source of a cell, which notebooks keep as a string or as a list of
+// lines.
+func cellSource(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+
+	var lines []string
+	if err := json.Unmarshal(raw, &lines); err == nil {
+		return strings.Join(lines, ""), nil
+	}
+
+	var src string
+	if err := json.Unmarshal(raw, &src); err != nil {
+		return "", err
+	}
+	return src, nil
+}
+
+// Pull the sources of the code and markdown cells out of a notebook,
+// with a blank line between cells, and find where each of them is in the
+// text. Notebooks of format 4 keep their cells at the top and those of
+// format 3 in worksheets.
+func notebookText(data []byte) ([]byte, []*notebookCell, error) {
+	type cell struct {
+		Type   string          `json:"cell_type"`
+		Source json.RawMessage `json:"source"`
+		Input  json.RawMessage `json:"input"`
+	}
+
+	var nb struct {
+		Cells      []*cell `json:"cells"`
+		Worksheets []struct {
+			Cells []*cell `json:"cells"`
+		} `json:"worksheets"`
+	}
+	if err := json.Unmarshal(data, &nb); err != nil {
+		return nil, nil, err
+	}
+
+	all := nb.Cells
+	for _, ws := range nb.Worksheets {
+		all = append(all, ws.Cells...)
+	}
+	if all == nil {
+		return nil, nil, errors.New("no cells")
+	}
+
+	var buf bytes.Buffer
+	var cells []*notebookCell
+	line := 1
+	for i, c := range all {
+		if !notebookCellTypes[c.Type] {
+			continue
+		}
+
+		raw := c.Source
+		if c.Type == "code" && len(c.Input) > 0 {
+			raw = c.Input
+		}
+		src, err := cellSource(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		src = strings.TrimRight(src, "\n")
+		if strings.TrimSpace(src) == "" {
+			continue
+		}
+
+		if len(cells) > 0 {
+			buf.WriteString("\n")
+			line++
+		}
+
+		n := strings.Count(src, "\n") + 1
+		cells = append(cells, &notebookCell{
+			NotebookCell: NotebookCell{Number: i + 1, Type: c.Type},
+			First:        line,
+			Last:         line + n - 1,
+		})
+		buf.WriteString(src)
+		buf.WriteString("\n")
+		line += n
+	}
+
+	return buf.Bytes(), cells, nil
+}
+
+// The text of the notebook at path, recording its cells in nbs under rel.
+func readNotebook(path, rel string, nbs notebooks) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	text, cells, err := notebookText(data)
+	if err != nil {
+		return nil, err
+	}
+	nbs[filepath.ToSlash(rel)] = cells
+	return text, nil
+}
+
+// The cell that a line is in, or nil if it is between cells.
+func cellAt(cells []*notebookCell, line int) *notebookCell {
+	for _, c := range cells {
+		if line >= c.First && line <= c.Last {
+			return c
+		}
+	}
+	return nil
+}
+
+// Keep the context of a match to the cell it is in, which the lines of
+// other cells are no context for.
+func (c *notebookCell) trim(m *Match) {
+	if drop := c.First - (m.LineNumber - len(m.Before)); drop > 0 {
+		if drop > len(m.Before) {
+			drop = len(m.Before)
+		}
+		m.Before = m.Before[drop:]
+	}
+	if keep := c.Last - m.LineNumber; keep < len(m.After) {
+		if keep < 0 {
+			keep = 0
+		}
+		m.After = m.After[:keep]
+	}
+}
+
+func writeNotebooksJson(filename string, nbs notebooks) error {
+	w, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	return json.NewEncoder(w).Encode(nbs)
+}
+
+// The cells of the notebooks of the repo, read the first time a search
+// needs them.
+func (n *Index) notebooks() (notebooks, error) {
+	n.lazyLck.Lock()
+	defer n.lazyLck.Unlock()
+
+	if n.nbs != nil {
+		return n.nbs, nil
+	}
+
+	nbs := notebooks{}
+	r, err := os.Open(filepath.Join(n.Ref.dir, notebooksFilename))
+	if os.IsNotExist(err) {
+		n.nbs = nbs
+		return nbs, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if err := json.NewDecoder(r).Decode(&nbs); err != nil {
+		return nil, err
+	}
+
+	n.nbs = nbs
+	return nbs, nil
+}
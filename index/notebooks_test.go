@@ -0,0 +1,122 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+const testNotebook = `{
+ "cells": [
+  {"cell_type": "markdown", "metadata": {}, "source": ["# Load the churn data\n", "From the warehouse."]},
+  {"cell_type": "code", "execution_count": 1, "metadata": {}, "outputs": [
+   {"output_type": "display_data", "data": {"image/png": "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk", "text/plain": ["churn figure"]}}
+  ], "source": ["import pandas as pd\n", "df = pd.read_csv(\"churn.csv\")\n", "df.head()"]},
+  {"cell_type": "raw", "metadata": {}, "source": "churn raw"},
+  {"cell_type": "code", "metadata": {}, "outputs": [], "source": []},
+  {"cell_type": "code", "metadata": {}, "outputs": [], "source": "df.plot(title=\"churn\")\n"}
+ ],
+ "metadata": {"kernelspec": {"name": "python3", "display_name": "churn kernel"}},
+ "nbformat": 4,
+ "nbformat_minor": 5
+}`
+
+func TestNotebookText(t *testing.T) {
+	text, cells, err := notebookText([]byte(testNotebook))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := "# Load the churn data\nFrom the warehouse.\n\nimport pandas as pd\ndf = pd.read_csv(\"churn.csv\")\ndf.head()\n\ndf.plot(title=\"churn\")\n"
+	if string(text) != exp {
+		t.Fatalf("expected the sources of the cells, got %q", text)
+	}
+
+	expCells := []*notebookCell{
+		{NotebookCell{1, "markdown"}, 1, 2},
+		{NotebookCell{2, "code"}, 4, 6},
+		{NotebookCell{5, "code"}, 8, 8},
+	}
+	if !reflect.DeepEqual(cells, expCells) {
+		t.Fatalf("expected cells %+v, got %+v", expCells, cells)
+	}
+
+	// notebooks of format 3 keep their cells in worksheets.
+	text, _, err = notebookText([]byte(`{"worksheets": [{"cells": [{"cell_type": "code", "input": ["x = 1"], "outputs": []}]}], "nbformat": 3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != "x = 1\n" {
+		t.Fatalf("expected the input of the cell, got %q", text)
+	}
+
+	if _, _, err := notebookText([]byte(`{"name": "not a notebook"}`)); err == nil {
+		t.Fatal("expected an error for JSON without cells")
+	}
+}
+
+func TestNotebookSearch(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	writeTestFile(t, src, "analysis/churn.ipynb", testNotebook)
+	writeTestFile(t, src, "broken.ipynb", "{")
+
+	dst, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := Build(&IndexOptions{NotebookCells: true}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	res, err := idx.Search("churn", &SearchOptions{LinesOfContext: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Matches) != 1 {
+		t.Fatalf("expected a match in the notebook only, got %d files", len(res.Matches))
+	}
+
+	// the outputs, raw cells and metadata aren't searched.
+	type match struct {
+		Line   string
+		Cell   NotebookCell
+		Before []string
+		After  []string
+	}
+	var got []match
+	for _, m := range res.Matches[0].Matches {
+		got = append(got, match{m.Line, *m.Cell, m.Before, m.After})
+	}
+
+	exp := []match{
+		{"# Load the churn data", NotebookCell{1, "markdown"}, []string{}, []string{"From the warehouse."}},
+		{"df = pd.read_csv(\"churn.csv\")", NotebookCell{2, "code"}, []string{"import pandas as pd"}, []string{"df.head()"}},
+		{"df.plot(title=\"churn\")", NotebookCell{5, "code"}, []string{}, []string{}},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected matches %+v, got %+v", exp, got)
+	}
+
+	excluded, err := idx.excludedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(excluded) != 1 || excluded[0].Filename != "broken.ipynb" {
+		t.Fatalf("expected the broken notebook to be excluded, got %+v", excluded)
+	}
+}
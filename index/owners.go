@@ -0,0 +1,269 @@
+package index
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const ownersFilename = "owners.json"
+
+// Where GitHub looks for a CODEOWNERS file, in order.
+var codeOwnersPaths = []string{
+	"CODEOWNERS",
+	".github/CODEOWNERS",
+	".docs/CODEOWNERS",
+	"docs/CODEOWNERS",
+}
+
+// One line of a CODEOWNERS file.
+type ownerRule struct {
+	Pattern string
+	Owners  []string
+
+	re *regexp.Regexp
+}
+
+// The owners of the files of a repo, from its CODEOWNERS file and the
+// OWNERS files of its directories, as recorded when it was indexed.
+type owners struct {
+	// The rules of CODEOWNERS, in order. The last one that matches a file
+	// decides its owners.
+	Rules []*ownerRule
+
+	// The owners listed by the OWNERS file of each directory, which apply
+	// to the files below it that don't have one closer to them.
+	Dirs map[string][]string
+}
+
+// Turn a CODEOWNERS pattern, which follows the rules of .gitignore, into a
+// regexp for the paths of the files it covers.
+func ownerPattern(pat string) (*regexp.Regexp, error) {
+	// a pattern with a slash other than at its end is relative to the
+	// root, otherwise it matches at any depth.
+	anchored := strings.Contains(strings.TrimSuffix(pat, "/"), "/")
+
+	// but one that ends in a single star only covers the files that it
+	// names, not whatever is in the directories among them.
+	exact := strings.HasSuffix(pat, "*") && !strings.HasSuffix(pat, "**")
+	pat = strings.TrimPrefix(pat, "/")
+	pat = strings.TrimSuffix(pat, "/")
+
+	var b strings.Builder
+	if anchored {
+		b.WriteString("^")
+	} else {
+		b.WriteString("(^|/)")
+	}
+
+	for i := 0; i < len(pat); i++ {
+		switch c := pat[i]; c {
+		case '*':
+			if i+1 < len(pat) && pat[i+1] == '*' {
+				i++
+				if i+1 < len(pat) && pat[i+1] == '/' {
+					// "**/" is any number of directories, including none.
+					i++
+					b.WriteString("(.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	// a pattern that names a directory covers everything in it.
+	if exact {
+		b.WriteString("$")
+	} else {
+		b.WriteString("(/|$)")
+	}
+	return regexp.Compile(b.String())
+}
+
+// Read the rules of a CODEOWNERS file. Lines that can't be parsed are
+// skipped, as GitHub does.
+func readCodeOwners(filename string) ([]*ownerRule, error) {
+	r, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var rules []*ownerRule
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+
+		re, err := ownerPattern(f[0])
+		if err != nil {
+			continue
+		}
+
+		// a pattern without owners takes the ownership of its files away.
+		rule := &ownerRule{Pattern: f[0], re: re}
+		if len(f) > 1 {
+			rule.Owners = f[1:]
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, s.Err()
+}
+
+// Read the owners of an OWNERS file. Both the plain list of the Chromium
+// style and the approvers of the Kubernetes style are understood, while
+// the directives of either, like per-file rules, are ignored.
+func readOwnersFile(filename string) ([]string, error) {
+	r, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var res []string
+	section := ""
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasSuffix(line, ":") {
+			section = strings.TrimSuffix(line, ":")
+			continue
+		}
+
+		if strings.HasPrefix(line, "- ") {
+			if section == "approvers" {
+				res = append(res, strings.TrimSpace(line[2:]))
+			}
+			continue
+		}
+
+		if section != "" || strings.ContainsAny(line, " :=") {
+			continue
+		}
+
+		res = append(res, line)
+	}
+
+	return res, s.Err()
+}
+
+// Find the owners of the repo checked out in src. The OWNERS files are
+// the ones that were found while indexing it, by directory.
+func readOwners(src string, dirs map[string][]string) (*owners, error) {
+	o := &owners{Dirs: dirs}
+	for _, p := range codeOwnersPaths {
+		rules, err := readCodeOwners(filepath.Join(src, filepath.FromSlash(p)))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		o.Rules = rules
+		break
+	}
+
+	if len(o.Rules) == 0 && len(o.Dirs) == 0 {
+		return nil, nil
+	}
+	return o, nil
+}
+
+func writeOwnersJson(filename string, o *owners) error {
+	w, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	return json.NewEncoder(w).Encode(o)
+}
+
+// Load the owners recorded for the index in dir, which are nil if the repo
+// doesn't have any or the index was built before they were recorded.
+func loadOwners(dir string) (*owners, error) {
+	r, err := os.Open(filepath.Join(dir, ownersFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var o owners
+	if err := json.NewDecoder(r).Decode(&o); err != nil {
+		return nil, err
+	}
+
+	for _, rule := range o.Rules {
+		rule.re, err = ownerPattern(rule.Pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &o, nil
+}
+
+// The owners of a file of the repo, named by its path relative to the
+// root.
+func (o *owners) of(name string) []string {
+	if o == nil {
+		return nil
+	}
+
+	name = filepath.ToSlash(name)
+	for i := len(o.Rules) - 1; i >= 0; i-- {
+		if o.Rules[i].re.MatchString(name) {
+			return o.Rules[i].Owners
+		}
+	}
+
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		if owners, ok := o.Dirs[dir]; ok {
+			return owners
+		}
+		if dir == "." || dir == "/" {
+			return nil
+		}
+	}
+}
+
+// Whether a file is owned by owner. "@team" and "team" are the same owner,
+// and the case of either doesn't matter.
+func (o *owners) owns(name, owner string) bool {
+	owner = strings.TrimPrefix(owner, "@")
+	for _, own := range o.of(name) {
+		if strings.EqualFold(strings.TrimPrefix(own, "@"), owner) {
+			return true
+		}
+	}
+	return false
+}
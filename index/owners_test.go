@@ -0,0 +1,159 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOwnerPattern(t *testing.T) {
+	tests := []struct {
+		pat   string
+		path  string
+		match bool
+	}{
+		{"*", "a/b/c.go", true},
+		{"*.js", "web/app.js", true},
+		{"*.js", "web/app.jsx", false},
+		{"docs/", "docs/a/b.md", true},
+		{"docs/", "src/docs/b.md", true},
+		{"/docs/", "src/docs/b.md", false},
+		{"/docs/*", "docs/a.md", true},
+		{"/docs/*", "docs/a/b.md", false},
+		{"apps/", "apps/x/y.go", true},
+		{"**/logs", "a/b/logs/x.log", true},
+		{"src/**/test", "src/test/a.go", true},
+		{"src/**/test", "src/a/b/test/a.go", true},
+		{"build/logs", "x/build/logs/a", false},
+		{"a?c.go", "abc.go", true},
+	}
+
+	for _, test := range tests {
+		re, err := ownerPattern(test.pat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := re.MatchString(test.path); got != test.match {
+			t.Errorf("%q matching %q: expected %v, got %v", test.pat, test.path, test.match, got)
+		}
+	}
+}
+
+func writeTestFile(t *testing.T, dir, name, data string) {
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(data), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOwners(t *testing.T) {
+	src, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	writeTestFile(t, src, ".github/CODEOWNERS", `
+# everything else
+*         @acme/core
+*.js      @acme/web   # the frontend
+/vendor/
+`)
+	writeTestFile(t, src, "lib/OWNERS", "# owners\nalice@acme.com\nset noparent\n")
+	writeTestFile(t, src, "k8s/OWNERS", "approvers:\n  - bob\nreviewers:\n  - carol\n")
+	writeTestFile(t, src, "main.go", "needle\n")
+	writeTestFile(t, src, "web/app.js", "needle\n")
+	writeTestFile(t, src, "vendor/dep.go", "needle\n")
+	writeTestFile(t, src, "lib/a/lib.go", "needle\n")
+	writeTestFile(t, src, "k8s/deploy.go", "needle\n")
+
+	dst, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	ref, err := Build(&IndexOptions{}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	res, err := idx.Search("needle", &SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string][]string{}
+	for _, m := range res.Matches {
+		got[m.Filename] = m.Owners
+	}
+
+	// CODEOWNERS covers every file but the vendored one, so the OWNERS
+	// files are left for the files it doesn't own.
+	expected := map[string][]string{
+		"main.go":       {"@acme/core"},
+		"web/app.js":    {"@acme/web"},
+		"vendor/dep.go": nil,
+		"lib/a/lib.go":  {"@acme/core"},
+		"k8s/deploy.go": {"@acme/core"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected owners %v, got %v", expected, got)
+	}
+
+	res, err = idx.Search("needle", &SearchOptions{Owner: "ACME/web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Matches) != 1 || res.Matches[0].Filename != "web/app.js" {
+		t.Fatalf("expected only web/app.js to be owned by acme/web, got %v", res.Matches)
+	}
+
+	// without CODEOWNERS, the closest OWNERS file decides.
+	o := &owners{Dirs: map[string][]string{
+		"lib": {"alice@acme.com"},
+		"k8s": {"bob"},
+	}}
+	if owners := o.of("lib/a/lib.go"); !reflect.DeepEqual(owners, []string{"alice@acme.com"}) {
+		t.Fatalf("expected lib/a/lib.go to be owned by alice, got %v", owners)
+	}
+	if owners := o.of("main.go"); owners != nil {
+		t.Fatalf("expected main.go to have no owners, got %v", owners)
+	}
+}
+
+func TestReadOwnersFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestFile(t, dir, "chromium", "alice@acme.com\nset noparent\nper-file *.gn=bob@acme.com\nfile://OTHER_OWNERS\n")
+	writeTestFile(t, dir, "k8s", "options:\n  no_parent_owners: true\napprovers:\n  - bob\n  - sig-apps-leads\nreviewers:\n  - carol\n")
+
+	tests := map[string][]string{
+		"chromium": {"alice@acme.com"},
+		"k8s":      {"bob", "sig-apps-leads"},
+	}
+	for name, expected := range tests {
+		got, err := readOwnersFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %v, got %v", name, expected, got)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package index
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/hound-search/hound/codesearch/index"
+)
+
+// The directory of an index being built that records how far the build
+// got, so that one that is cut short resumes where it left off. It is
+// removed once the build is done.
+const progressDirname = "progress"
+
+// The file in the progress directory that says what is being built.
+const buildFilename = "build.json"
+
+// How many of the files of a repo are indexed between checkpoints, if
+// the options don't say.
+const defaultShardSize = 10000
+
+// What a build in progress is building.
+type buildStart struct {
+	Url string
+	Rev string
+}
+
+// What indexing the files of one shard of a build found. The copies of
+// those that were added to the index are kept in raw, so resuming the
+// build replays them rather than reading, filtering and extracting the
+// files again.
+type shardProgress struct {
+	// How many of the files of the walk of the repo the build had passed
+	// at the end of the shard, counting those of the shards before it.
+	Walked int
+
+	// The files that were added to the index, in order.
+	Files []string
+
+	Excluded   []*ExcludedFile
+	Owners     map[string][]string
+	Modules    map[string]string
+	Deps       []*Dependency
+	Notebooks  notebooks
+	SourceMaps map[string]string
+}
+
+func newShardProgress() *shardProgress {
+	return &shardProgress{
+		Owners:     map[string][]string{},
+		Modules:    map[string]string{},
+		Notebooks:  notebooks{},
+		SourceMaps: map[string]string{},
+	}
+}
+
+// The progress of a build, which is checkpointed after each shard.
+type buildProgress struct {
+	dir  string
+	size int
+
+	// The shards that an earlier run of the build finished.
+	done []*shardProgress
+
+	// How many files of the walk those shards got through.
+	resumed int
+
+	// The shard being indexed, how many files of the walk have been
+	// passed, and where in the walk, the excluded files and the
+	// dependencies the shard starts.
+	cur        *shardProgress
+	walked     int
+	shardAt    int
+	excludedAt int
+	depsAt     int
+}
+
+func shardFilename(n int) string {
+	return fmt.Sprintf("%06d.json", n)
+}
+
+// Write v as JSON to filename, all at once, so that a build that is cut
+// short never leaves half of it.
+func writeJsonAtomic(filename string, v interface{}) error {
+	tmp := filename + ".tmp"
+	w, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+func readJsonFile(filename string, v interface{}) error {
+	r, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return json.NewDecoder(r).Decode(v)
+}
+
+// Start the build of the index of url at rev in dst, resuming an earlier
+// one of the same build that was cut short, if there is one.
+func startBuild(dst, url, rev string, size int) (*buildProgress, error) {
+	if size <= 0 {
+		size = defaultShardSize
+	}
+
+	p := &buildProgress{
+		dir:  filepath.Join(dst, progressDirname),
+		size: size,
+		cur:  newShardProgress(),
+	}
+
+	var b buildStart
+	if err := readJsonFile(filepath.Join(p.dir, buildFilename), &b); err == nil && b.Url == url && b.Rev == rev {
+		for n := 0; ; n++ {
+			s := &shardProgress{}
+			if err := readJsonFile(filepath.Join(p.dir, shardFilename(n)), s); err != nil {
+				break
+			}
+			p.done = append(p.done, s)
+		}
+
+		if len(p.done) > 0 {
+			p.resumed = p.done[len(p.done)-1].Walked
+			p.walked, p.shardAt = p.resumed, p.resumed
+			log.Printf("Resuming the build of %s at %s after %d shards of its files", url, rev, len(p.done))
+		}
+		return p, nil
+	}
+
+	if err := os.RemoveAll(p.dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(p.dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := writeJsonAtomic(filepath.Join(p.dir, buildFilename), &buildStart{Url: url, Rev: rev}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Whether the nth file of the walk was indexed by a shard that an earlier
+// run of the build finished, and is to be skipped.
+func (p *buildProgress) skip(n int) bool {
+	return n <= p.resumed
+}
+
+// Record that another file of the walk has been indexed, and checkpoint
+// the shard, with the excluded files and dependencies found since the
+// last one, once it is full.
+func (p *buildProgress) next(excluded []*ExcludedFile, deps []*Dependency) error {
+	p.walked++
+	if p.walked-p.shardAt < p.size {
+		return nil
+	}
+	return p.checkpoint(excluded, deps)
+}
+
+// Write the shard being indexed and start the next one.
+func (p *buildProgress) checkpoint(excluded []*ExcludedFile, deps []*Dependency) error {
+	s := p.cur
+	s.Walked = p.walked
+	s.Excluded = excluded[p.excludedAt:]
+	s.Deps = deps[p.depsAt:]
+
+	if err := writeJsonAtomic(filepath.Join(p.dir, shardFilename(len(p.done))), s); err != nil {
+		return err
+	}
+
+	p.done = append(p.done, s)
+	p.cur = newShardProgress()
+	p.shardAt = p.walked
+	p.excludedAt = len(excluded)
+	p.depsAt = len(deps)
+	return nil
+}
+
+// Whether the shard being indexed has anything in it.
+func (p *buildProgress) pending() bool {
+	return p.walked > p.shardAt
+}
+
+// Remove the progress of the build, which is done.
+func (p *buildProgress) finish() error {
+	return os.RemoveAll(p.dir)
+}
+
+// Add the copy in raw of a file that a finished shard added to the index
+// to it again.
+func replayToIndex(ix *index.IndexWriter, fp *fingerprints, ch *chunker, buf *bytes.Buffer, dst, rel string) error {
+	r, err := os.Open(filepath.Join(dst, "raw", rel))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	g, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer g.Close()
+
+	buf.Reset()
+	if _, err := buf.ReadFrom(g); err != nil {
+		return err
+	}
+
+	if reason := ix.Add(rel, bytes.NewReader(buf.Bytes())); reason == "" {
+		fp.add(rel, buf.Bytes())
+		ch.add(rel, buf.Bytes())
+	}
+	return nil
+}
+
+// Resumable says whether dir holds a build of an index that was cut
+// short, and of which url and rev, so that the build can be resumed in it.
+func Resumable(dir string) (url, rev string, ok bool) {
+	if _, err := os.Stat(filepath.Join(dir, manifestFilename)); err == nil {
+		return "", "", false
+	}
+
+	var b buildStart
+	if err := readJsonFile(filepath.Join(dir, progressDirname, buildFilename), &b); err != nil {
+		return "", "", false
+	}
+	return b.Url, b.Rev, true
+}
@@ -0,0 +1,117 @@
+package index
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResumeBuild(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	files := map[string]string{
+		"a.txt": "needle in a\n",
+		"b.dat": "\xff\xfe\x00",
+		"c.txt": "needle in c\n",
+		"d.txt": "nothing in d\n",
+		"e.txt": "nothing in e\n",
+	}
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	// the build fails once all of its files are indexed, in shards of
+	// [a.txt b.dat] [c.txt d.txt] [e.txt].
+	opt := &IndexOptions{
+		ShardSize: 2,
+		Commits: func(src string) (map[string]*FileCommit, error) {
+			return nil, errors.New("cut short")
+		},
+	}
+	if _, err := Build(opt, dst, src, url, rev); err == nil {
+		t.Fatal("expected the build to fail")
+	}
+
+	if u, r, ok := Resumable(dst); !ok || u != url || r != rev {
+		t.Fatalf("expected a resumable build of %s at %s, got %v %s %s", url, rev, ok, u, r)
+	}
+
+	// as though it had been cut short in the last shard, with changes to
+	// the files of the first and the last.
+	if err := os.Remove(filepath.Join(dst, progressDirname, shardFilename(2))); err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range map[string]string{
+		"a.txt": "nothing in a\n",
+		"e.txt": "needle in e\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opt.Commits = nil
+	ref, err := Build(opt, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, ok := Resumable(dst); ok {
+		t.Fatal("expected the build to be done")
+	}
+	if _, err := os.Stat(filepath.Join(dst, progressDirname)); !os.IsNotExist(err) {
+		t.Fatalf("expected the progress to be removed, got %v", err)
+	}
+	if _, err := Verify(dst); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	res, err := idx.Search("needle", &SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the finished shards are replayed as they were indexed, and the rest
+	// is indexed as it is now.
+	got := map[string]bool{}
+	for _, m := range res.Matches {
+		got[m.Filename] = true
+	}
+	exp := map[string]bool{"a.txt": true, "c.txt": true, "e.txt": true}
+	if len(got) != len(exp) {
+		t.Fatalf("expected matches in %v, got %v", exp, got)
+	}
+	for name := range exp {
+		if !got[name] {
+			t.Fatalf("expected matches in %v, got %v", exp, got)
+		}
+	}
+
+	excluded, err := idx.excludedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(excluded) != 1 || excluded[0].Filename != "b.dat" {
+		t.Fatalf("expected b.dat to be excluded, got %v", excluded)
+	}
+}
@@ -0,0 +1,220 @@
+package index
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/hound-search/hound/embed"
+)
+
+const embeddingsFilename = "embeddings.gob"
+
+// The embeddings of the chunks of the files of an index, all of the same
+// size and one after another in Vectors. The files and lines of the chunks
+// run parallel.
+type embeddings struct {
+	Names   []string
+	Files   []uint32
+	Starts  []uint32
+	Ends    []uint32
+	Dim     int
+	Vectors []float32
+}
+
+// Splits the files of an index into chunks and has a model embed them as
+// they add up to a batch.
+type chunker struct {
+	model *embed.Model
+	emb   embeddings
+
+	// the chunks waiting for their embeddings.
+	files        []uint32
+	starts, ends []uint32
+	texts        []string
+
+	// the first error of the model, after which no more are embedded.
+	err error
+}
+
+func newChunker(model *embed.Model) *chunker {
+	if model == nil {
+		return nil
+	}
+	return &chunker{model: model}
+}
+
+// Add the chunks of one of the files of an index.
+func (c *chunker) add(name string, data []byte) {
+	if c == nil || c.err != nil || len(bytes.TrimSpace(data)) == 0 {
+		return
+	}
+
+	file := uint32(len(c.emb.Names))
+	c.emb.Names = append(c.emb.Names, name)
+
+	lines := bytes.SplitAfter(data, nl)
+	for start := 0; start < len(lines); start += c.model.ChunkLines {
+		end := start + c.model.ChunkLines
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		text := bytes.Join(lines[start:end], nil)
+		if len(bytes.TrimSpace(text)) == 0 {
+			continue
+		}
+
+		c.files = append(c.files, file)
+		c.starts = append(c.starts, uint32(start+1))
+		c.ends = append(c.ends, uint32(end))
+		c.texts = append(c.texts, string(text))
+	}
+
+	if len(c.texts) >= c.model.BatchSize {
+		c.flush()
+	}
+}
+
+// Embed the chunks that are waiting.
+func (c *chunker) flush() {
+	if c.err != nil || len(c.texts) == 0 {
+		return
+	}
+
+	vecs, err := c.model.Embed(c.texts)
+	if err != nil {
+		c.err = err
+		return
+	}
+
+	for i, v := range vecs {
+		if c.emb.Dim == 0 {
+			c.emb.Dim = len(v)
+		}
+		if len(v) != c.emb.Dim {
+			c.err = fmt.Errorf("expected vectors of size %d, got %d", c.emb.Dim, len(v))
+			return
+		}
+
+		c.emb.Files = append(c.emb.Files, c.files[i])
+		c.emb.Starts = append(c.emb.Starts, c.starts[i])
+		c.emb.Ends = append(c.emb.Ends, c.ends[i])
+		c.emb.Vectors = append(c.emb.Vectors, v...)
+	}
+
+	c.files, c.starts, c.ends, c.texts = nil, nil, nil, nil
+}
+
+// Write the embeddings of the index. An index whose embeddings failed is
+// still written without them, it just can't be searched semantically.
+func (c *chunker) write(filename string) error {
+	if c == nil {
+		return nil
+	}
+
+	c.flush()
+	if c.err != nil {
+		log.Printf("failed to embed the files of %s: %s", filepath.Dir(filename), c.err)
+		return nil
+	}
+
+	w, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	return gob.NewEncoder(w).Encode(&c.emb)
+}
+
+// Read the embeddings of the index, once.
+func (n *Index) loadEmbeddings() (*embeddings, error) {
+	n.lazyLck.Lock()
+	defer n.lazyLck.Unlock()
+
+	if n.emb != nil {
+		return n.emb, nil
+	}
+
+	emb := &embeddings{}
+	r, err := os.Open(filepath.Join(n.Ref.dir, embeddingsFilename))
+	if os.IsNotExist(err) {
+		// built without embeddings.
+		n.emb = emb
+		return emb, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if err := gob.NewDecoder(r).Decode(emb); err != nil {
+		return nil, err
+	}
+
+	n.emb = emb
+	return emb, nil
+}
+
+// SemanticMatch is a chunk of a file whose embedding is near that of a
+// query.
+type SemanticMatch struct {
+	Filename  string
+	StartLine int
+	EndLine   int
+
+	// The cosine similarity of the chunk and the query.
+	Score float32
+}
+
+// Nearest finds the limit chunks of the files of the index whose
+// embeddings are nearest to vec, which has to come from the model the
+// index was built with, the nearest first.
+func (n *Index) Nearest(vec []float32, limit int) ([]*SemanticMatch, error) {
+	emb, err := n.loadEmbeddings()
+	if err != nil {
+		return nil, err
+	}
+
+	if emb.Dim == 0 || limit <= 0 {
+		return nil, nil
+	}
+
+	if len(vec) != emb.Dim {
+		return nil, fmt.Errorf("the query has a vector of size %d but the index has %d", len(vec), emb.Dim)
+	}
+
+	var res []*SemanticMatch
+	for i := range emb.Files {
+		v := emb.Vectors[i*emb.Dim : (i+1)*emb.Dim]
+
+		var score float32
+		for j, x := range v {
+			score += x * vec[j]
+		}
+
+		// keep the best, dropping the worst once there are too many.
+		if len(res) == limit && score <= res[limit-1].Score {
+			continue
+		}
+		m := &SemanticMatch{
+			Filename:  emb.Names[emb.Files[i]],
+			StartLine: int(emb.Starts[i]),
+			EndLine:   int(emb.Ends[i]),
+			Score:     score,
+		}
+
+		at := sort.Search(len(res), func(i int) bool { return res[i].Score < score })
+		if len(res) < limit {
+			res = append(res, nil)
+		}
+		copy(res[at+1:], res[at:])
+		res[at] = m
+	}
+
+	return res, nil
+}
@@ -0,0 +1,80 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/embed"
+)
+
+func TestNearest(t *testing.T) {
+	src, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	writeTestFile(t, src, "net/retry.go", `package net
+
+// retryWithBackoff calls the HTTP client again until it succeeds.
+func retryWithBackoff(c *HTTPClient, attempts int) error {
+	return nil
+}
+`)
+	writeTestFile(t, src, "math/sum.go", `package math
+
+// Sum adds up the numbers.
+func Sum(numbers []int) int {
+	return 0
+}
+`)
+
+	cfg := &config.Embeddings{Backend: "local", Dimensions: 256, ChunkLines: 3, BatchSize: 2}
+	model, err := embed.New(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	ref, err := Build(&IndexOptions{Embeddings: model}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	vecs, err := model.Embed([]string{"retry http with backoff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := idx.Nearest(vecs[0], 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(res))
+	}
+	if m := res[0]; m.Filename != "net/retry.go" || m.StartLine != 1 || m.EndLine != 3 {
+		t.Fatalf("expected lines 1 to 3 of net/retry.go to be nearest, got %+v", m)
+	}
+	if res[0].Score < res[1].Score {
+		t.Fatalf("expected the nearest first, got %f then %f", res[0].Score, res[1].Score)
+	}
+
+	if _, err := idx.Nearest([]float32{1}, 1); err == nil {
+		t.Fatal("expected a vector of the wrong size to fail")
+	}
+}
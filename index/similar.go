@@ -0,0 +1,298 @@
+package index
+
+import (
+	"encoding/gob"
+	"errors"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	fingerprintsFilename = "fingerprints.gob"
+
+	// The number of tokens hashed together into each k-gram, and the
+	// number of k-grams in each window of which the smallest is kept as
+	// a fingerprint. Any run of k+w-1 tokens that two files share gives
+	// them a fingerprint in common.
+	fingerprintK      = 5
+	fingerprintWindow = 4
+
+	// Files bigger than this aren't fingerprinted.
+	maxFingerprintFileLen = 1 << 20
+
+	// Fingerprints found in more places than this, like those of
+	// boilerplate, say nothing about whether code was copied.
+	maxFingerprintPostings = 500
+
+	// Matches further apart than this many lines are in separate regions.
+	maxRegionGap = 10
+)
+
+// ErrSnippetTooShort is returned by Similar for a snippet that is too short
+// to have a fingerprint.
+var ErrSnippetTooShort = errors.New("the snippet is too short to compare")
+
+// The fingerprints of the files of an index, sorted by their hashes. The
+// files and lines of the fingerprints run parallel to their hashes.
+type fingerprints struct {
+	Names  []string
+	Hashes []uint64
+	Files  []uint32
+	Lines  []uint32
+}
+
+func (fp *fingerprints) Len() int           { return len(fp.Hashes) }
+func (fp *fingerprints) Less(i, j int) bool { return fp.Hashes[i] < fp.Hashes[j] }
+func (fp *fingerprints) Swap(i, j int) {
+	fp.Hashes[i], fp.Hashes[j] = fp.Hashes[j], fp.Hashes[i]
+	fp.Files[i], fp.Files[j] = fp.Files[j], fp.Files[i]
+	fp.Lines[i], fp.Lines[j] = fp.Lines[j], fp.Lines[i]
+}
+
+// A fingerprint of some text, with the line that it starts on.
+type fingerprint struct {
+	hash uint64
+	line int
+}
+
+// A token of the text being fingerprinted.
+type token struct {
+	hash uint64
+	line int
+}
+
+// Split text into tokens, which are runs of letters and digits or single
+// marks, ignoring space. Copied code is often reindented, so space is
+// left out.
+func tokenize(data []byte) []token {
+	var toks []token
+	line := 1
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == '\n' {
+			line++
+		}
+		if unicode.IsSpace(r) {
+			i += size
+			continue
+		}
+
+		j := i + size
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			for j < len(data) {
+				r, size := utf8.DecodeRune(data[j:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				j += size
+			}
+		}
+
+		h := fnv.New64a()
+		h.Write(data[i:j])
+		toks = append(toks, token{h.Sum64(), line})
+		i = j
+	}
+	return toks
+}
+
+// Pick the fingerprints of text by winnowing the hashes of its k-grams:
+// the smallest hash of each window is kept, once.
+func winnow(data []byte) []fingerprint {
+	toks := tokenize(data)
+	if len(toks) < fingerprintK {
+		return nil
+	}
+
+	grams := make([]fingerprint, len(toks)-fingerprintK+1)
+	for i := range grams {
+		var h uint64
+		for _, t := range toks[i : i+fingerprintK] {
+			h = h*1099511628211 ^ t.hash
+		}
+		grams[i] = fingerprint{h, toks[i].line}
+	}
+
+	w := fingerprintWindow
+	if w > len(grams) {
+		w = len(grams)
+	}
+
+	var res []fingerprint
+	last := -1
+	for start := 0; start+w <= len(grams); start++ {
+		// the rightmost smallest hash, so that equal hashes in a row are
+		// only kept once.
+		min := start
+		for i := start + 1; i < start+w; i++ {
+			if grams[i].hash <= grams[min].hash {
+				min = i
+			}
+		}
+
+		if min != last {
+			res = append(res, grams[min])
+			last = min
+		}
+	}
+	return res
+}
+
+// Add the fingerprints of one of the files of an index.
+func (fp *fingerprints) add(name string, data []byte) {
+	if len(data) > maxFingerprintFileLen {
+		return
+	}
+
+	prints := winnow(data)
+	if len(prints) == 0 {
+		return
+	}
+
+	file := uint32(len(fp.Names))
+	fp.Names = append(fp.Names, name)
+	for _, p := range prints {
+		fp.Hashes = append(fp.Hashes, p.hash)
+		fp.Files = append(fp.Files, file)
+		fp.Lines = append(fp.Lines, uint32(p.line))
+	}
+}
+
+func writeFingerprints(filename string, fp *fingerprints) error {
+	sort.Sort(fp)
+
+	w, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	return gob.NewEncoder(w).Encode(fp)
+}
+
+// Read the fingerprints of the index, once.
+func (n *Index) loadFingerprints() (*fingerprints, error) {
+	n.lazyLck.Lock()
+	defer n.lazyLck.Unlock()
+
+	if n.fp != nil {
+		return n.fp, nil
+	}
+
+	fp := &fingerprints{}
+	r, err := os.Open(filepath.Join(n.Ref.dir, fingerprintsFilename))
+	if os.IsNotExist(err) {
+		// built before fingerprints were.
+		n.fp = fp
+		return fp, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if err := gob.NewDecoder(r).Decode(fp); err != nil {
+		return nil, err
+	}
+
+	n.fp = fp
+	return fp, nil
+}
+
+// SimilarRegion is a part of a file that shares code with a snippet. Its
+// lines are those on which the first and the last of the shared
+// fingerprints start.
+type SimilarRegion struct {
+	Filename  string
+	StartLine int
+	EndLine   int
+
+	// The share of the fingerprints of the snippet that the region has,
+	// from 0 to 1.
+	Score float64
+}
+
+// Similar finds the regions of the files of the index that have at least
+// minScore of the fingerprints of snippet, the best first.
+func (n *Index) Similar(snippet string, minScore float64) ([]*SimilarRegion, error) {
+	prints := winnow([]byte(snippet))
+	if len(prints) == 0 {
+		return nil, ErrSnippetTooShort
+	}
+
+	fp, err := n.loadFingerprints()
+	if err != nil {
+		return nil, err
+	}
+
+	type hit struct {
+		line int
+		hash uint64
+	}
+
+	hits := map[uint32][]hit{}
+	seen := map[uint64]bool{}
+	want := 0
+	for _, p := range prints {
+		if seen[p.hash] {
+			continue
+		}
+		seen[p.hash] = true
+
+		i := sort.Search(len(fp.Hashes), func(i int) bool { return fp.Hashes[i] >= p.hash })
+		j := i
+		for j < len(fp.Hashes) && fp.Hashes[j] == p.hash {
+			j++
+		}
+		if j-i > maxFingerprintPostings {
+			continue
+		}
+		want++
+
+		for ; i < j; i++ {
+			hits[fp.Files[i]] = append(hits[fp.Files[i]], hit{int(fp.Lines[i]), p.hash})
+		}
+	}
+
+	var res []*SimilarRegion
+	for file, hs := range hits {
+		sort.Slice(hs, func(i, j int) bool { return hs[i].line < hs[j].line })
+
+		// split the hits of the file into regions at the gaps between them.
+		for start := 0; start < len(hs); {
+			end := start + 1
+			for end < len(hs) && hs[end].line-hs[end-1].line <= maxRegionGap {
+				end++
+			}
+
+			found := map[uint64]bool{}
+			for _, h := range hs[start:end] {
+				found[h.hash] = true
+			}
+
+			if score := float64(len(found)) / float64(want); score >= minScore {
+				res = append(res, &SimilarRegion{
+					Filename:  fp.Names[file],
+					StartLine: hs[start].line,
+					EndLine:   hs[end-1].line,
+					Score:     score,
+				})
+			}
+			start = end
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		if res[i].Filename != res[j].Filename {
+			return res[i].Filename < res[j].Filename
+		}
+		return res[i].StartLine < res[j].StartLine
+	})
+	return res, nil
+}
@@ -0,0 +1,119 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const similarSnippet = `func retry(n int, fn func() error) error {
+	var err error
+	for i := 0; i < n; i++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		time.Sleep(backoff(i))
+	}
+	return err
+}`
+
+func TestSimilar(t *testing.T) {
+	src, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	// a copy that was reindented and had a line added, far down a file.
+	writeTestFile(t, src, "a/copy.go", `package a
+
+import "time"
+
+// lots of other code
+var x = 1
+var y = 2
+
+func retry(n int, fn func() error) error {
+    var err error
+    for i := 0; i < n; i++ {
+        if err = fn(); err == nil {
+            return nil
+        }
+        log.Printf("attempt %d failed", i)
+        time.Sleep(backoff(i))
+    }
+    return err
+}
+`)
+	writeTestFile(t, src, "b/other.go", `package b
+
+func sum(xs []int) int {
+	total := 0
+	for _, x := range xs {
+		total += x
+	}
+	return total
+}
+`)
+
+	dst, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	ref, err := Build(&IndexOptions{}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	res, err := idx.Similar(similarSnippet, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res) != 1 {
+		t.Fatalf("expected 1 similar region, got %d", len(res))
+	}
+
+	r := res[0]
+	if r.Filename != "a/copy.go" {
+		t.Fatalf("expected a/copy.go to be similar, got %s", r.Filename)
+	}
+	if r.StartLine < 9 || r.EndLine > 19 || r.StartLine > r.EndLine {
+		t.Fatalf("expected the region to be within lines 9 to 19, got %d to %d", r.StartLine, r.EndLine)
+	}
+	if r.Score < 0.5 || r.Score >= 1 {
+		t.Fatalf("expected a score of at least 0.5 but less than 1, got %f", r.Score)
+	}
+
+	if _, err := idx.Similar("x := 1", 0.5); err != ErrSnippetTooShort {
+		t.Fatalf("expected a short snippet to fail, got %v", err)
+	}
+}
+
+func TestWinnow(t *testing.T) {
+	a := winnow([]byte(similarSnippet))
+	if len(a) == 0 {
+		t.Fatal("expected the snippet to have fingerprints")
+	}
+
+	// space doesn't change the fingerprints, only their lines.
+	b := winnow([]byte("func retry(n int, fn func() error) error { var err error\n" +
+		"for i := 0; i < n; i++ { if err = fn(); err == nil { return nil }\n" +
+		"time.Sleep(backoff(i)) }\nreturn err }"))
+	if len(a) != len(b) {
+		t.Fatalf("expected %d fingerprints, got %d", len(a), len(b))
+	}
+	for i := range a {
+		if a[i].hash != b[i].hash {
+			t.Fatalf("expected fingerprint %d to be %x, got %x", i, a[i].hash, b[i].hash)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package index
+
+import (
+	"fmt"
+	"sort"
+)
+
+// The orders that the results of a search can be sorted in. Ties are
+// always broken by path, so the same search of the same index comes back
+// in the same order.
+const (
+	// SortPath puts files in order of path, byte by byte.
+	SortPath = "path"
+
+	// SortRepo is the same as SortPath for the files of a repo. It differs
+	// in the order of the repos of a search of several.
+	SortRepo = "repo"
+
+	// SortScore puts the files with the most matches first.
+	SortScore = "score"
+
+	// SortMtime puts the files that changed most recently first, and
+	// those whose last commit isn't known last.
+	SortMtime = "mtime"
+)
+
+var fileOrders = map[string]func(a, b *FileMatch) bool{
+	SortPath: byPath,
+	SortRepo: byPath,
+	SortScore: func(a, b *FileMatch) bool {
+		if len(a.Matches) != len(b.Matches) {
+			return len(a.Matches) > len(b.Matches)
+		}
+		return byPath(a, b)
+	},
+	SortMtime: func(a, b *FileMatch) bool {
+		if a.Modified == nil || b.Modified == nil {
+			if (a.Modified == nil) != (b.Modified == nil) {
+				return b.Modified == nil
+			}
+		} else if !a.Modified.Equal(*b.Modified) {
+			return a.Modified.After(*b.Modified)
+		}
+		return byPath(a, b)
+	},
+}
+
+func byPath(a, b *FileMatch) bool {
+	return a.Filename < b.Filename
+}
+
+// CheckSort returns an error if by isn't one of the orders results can be
+// sorted in, or empty for the order of the index.
+func CheckSort(by string) error {
+	if _, ok := fileOrders[by]; by != "" && !ok {
+		return fmt.Errorf("unknown sort: %s", by)
+	}
+	return nil
+}
+
+// Sort the files of a sorted search and take the requested page of them.
+// Which files are on a page isn't known until all of them are in, so a
+// sorted search collects every file with a match, up to the cap on
+// matches, rather than stopping when the page is full.
+func (s *search) sortResults() {
+	less := fileOrders[s.opt.Sort]
+	sort.SliceStable(s.results, func(i, j int) bool {
+		return less(s.results[i], s.results[j])
+	})
+	sort.SliceStable(s.filenameHits, func(i, j int) bool {
+		return s.filenameHits[i].Filename < s.filenameHits[j].Filename
+	})
+
+	start, end := s.opt.Offset, len(s.results)
+	if start > end {
+		start = end
+	}
+	if limit := s.fileLimit(); limit > 0 && start+limit < end {
+		end = start + limit
+	}
+	s.results = s.results[start:end]
+	s.filesCollected = len(s.results)
+}
@@ -0,0 +1,75 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSortResults(t *testing.T) {
+	src, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	// the walk puts a/b.txt before a.txt, which comes first by path.
+	writeTestFile(t, src, "a/b.txt", "todo\n")
+	writeTestFile(t, src, "a.txt", "todo\ntodo\n")
+	writeTestFile(t, src, "c.txt", "todo\ntodo\ntodo\n")
+	writeTestFile(t, src, "d.txt", "todo\ntodo\n")
+
+	dst, err := ioutil.TempDir(os.TempDir(), "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := Build(&IndexOptions{}, dst, src, url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	files := func(opt *SearchOptions) []string {
+		res, err := idx.Search("todo", opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, fm := range res.Matches {
+			names = append(names, fm.Filename)
+		}
+		return names
+	}
+
+	tests := []struct {
+		opt *SearchOptions
+		exp []string
+	}{
+		{&SearchOptions{Sort: SortPath}, []string{"a.txt", "a/b.txt", "c.txt", "d.txt"}},
+		{&SearchOptions{Sort: SortRepo}, []string{"a.txt", "a/b.txt", "c.txt", "d.txt"}},
+		// ties in score go by path.
+		{&SearchOptions{Sort: SortScore}, []string{"c.txt", "a.txt", "d.txt", "a/b.txt"}},
+		// pages are taken from the sorted files.
+		{&SearchOptions{Sort: SortPath, Offset: 1, Limit: 2}, []string{"a/b.txt", "c.txt"}},
+		{&SearchOptions{Sort: SortScore, Offset: 3, Limit: 2}, []string{"a/b.txt"}},
+		{&SearchOptions{Sort: SortScore, MaxFiles: 1}, []string{"c.txt"}},
+	}
+	for _, test := range tests {
+		if got := files(test.opt); !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%+v: expected %v, got %v", test.opt, test.exp, got)
+		}
+	}
+
+	if _, err := idx.Search("todo", &SearchOptions{Sort: "size"}); err == nil {
+		t.Fatal("expected an error for an unknown sort")
+	}
+}
@@ -0,0 +1,32 @@
+package index
+
+import (
+	stdregexp "regexp"
+)
+
+// The most spans that are found on a line. A pattern like . matches every
+// character of a line, which is no use to highlight one by one.
+const maxSpans = 100
+
+// Span is where a pattern matched in a line, by byte offsets from the
+// start of the line, up to but not including End.
+type Span struct {
+	Start int
+	End   int
+}
+
+// Find where re matches in a line. Empty matches, like those of ^ or \b,
+// have nothing to highlight, so they are left out.
+func findSpans(re *stdregexp.Regexp, line []byte) []Span {
+	if re == nil {
+		return nil
+	}
+
+	var spans []Span
+	for _, m := range re.FindAllIndex(line, maxSpans) {
+		if m[1] > m[0] {
+			spans = append(spans, Span{m[0], m[1]})
+		}
+	}
+	return spans
+}
@@ -0,0 +1,170 @@
+package index
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hound-search/hound/codesearch/index"
+)
+
+const checksumsFilename = "checksums.sha256"
+
+// ErrNoChecksums is reported by Verify for indexes built before checksums
+// were recorded. Their contents can only be checked for consistency.
+var ErrNoChecksums = errors.New("index has no checksums")
+
+// ErrIncomplete is reported by Verify for an index without a manifest,
+// which is either still being built or was abandoned partway.
+var ErrIncomplete = errors.New("index has no manifest")
+
+// The sha256 of one file, in hex.
+func checksumFile(path string) (string, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Record the checksum of every file of the index in dir, in the format of
+// sha256sum so they can also be checked by hand. The manifest is written
+// afterwards and is not included.
+func writeChecksums(dir string) error {
+	var lines []string
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == checksumsFilename || rel == manifestFilename {
+			return nil
+		}
+
+		sum, err := checksumFile(path)
+		if err != nil {
+			return err
+		}
+
+		lines = append(lines, fmt.Sprintf("%s  %s\n", sum, filepath.ToSlash(rel)))
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	sort.Strings(lines)
+	return ioutil.WriteFile(filepath.Join(dir, checksumsFilename), []byte(strings.Join(lines, "")), 0666)
+}
+
+// Read the checksums recorded for the index in dir, keyed by the path of
+// each file relative to dir.
+func readChecksums(dir string) (map[string]string, error) {
+	r, err := os.Open(filepath.Join(dir, checksumsFilename))
+	if os.IsNotExist(err) {
+		return nil, ErrNoChecksums
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	sums := map[string]string{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		f := strings.SplitN(s.Text(), "  ", 2)
+		if len(f) != 2 {
+			return nil, fmt.Errorf("malformed %s", checksumsFilename)
+		}
+		sums[f[1]] = f[0]
+	}
+
+	return sums, s.Err()
+}
+
+// Verify checks that the index in dir is complete and intact: its manifest
+// can be read, every file matches the checksum recorded when the index
+// was built, the trigram table is consistent and every file it names has
+// its raw contents alongside it. For an index without checksums, the
+// remaining checks are still made and ErrNoChecksums is returned if they
+// pass. The manifest is returned whenever it could be read.
+func Verify(dir string) (*IndexRef, error) {
+	ref, err := Read(dir)
+	if os.IsNotExist(err) {
+		return nil, ErrIncomplete
+	} else if err != nil {
+		return nil, fmt.Errorf("bad manifest: %s", err)
+	}
+
+	sums, sumErr := readChecksums(dir)
+	if sumErr != nil && sumErr != ErrNoChecksums {
+		return ref, sumErr
+	}
+
+	// the trigram index of an archived index is checked decompressed.
+	tri := filepath.Join(dir, "tri")
+	if archivedDir(dir) {
+		tmp, err := ioutil.TempFile("", "hound-verify-tri")
+		if err != nil {
+			return ref, err
+		}
+		tmp.Close()
+		defer os.Remove(tmp.Name())
+
+		tri = tmp.Name()
+		if err := copyFileThrough(tri, filepath.Join(dir, archivedFilename), decompress); err != nil {
+			return ref, fmt.Errorf("bad %s: %s", archivedFilename, err)
+		}
+	}
+
+	for rel, want := range sums {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if rel == "tri" {
+			path = tri
+		}
+
+		got, err := checksumFile(path)
+		if os.IsNotExist(err) {
+			return ref, fmt.Errorf("%s is missing", rel)
+		} else if err != nil {
+			return ref, err
+		}
+
+		if got != want {
+			return ref, fmt.Errorf("%s does not match its checksum", rel)
+		}
+	}
+
+	names, err := index.Check(tri)
+	if err != nil {
+		return ref, fmt.Errorf("bad trigram index: %s", err)
+	}
+
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(dir, "raw", name)); err != nil {
+			return ref, fmt.Errorf("raw/%s is missing", filepath.ToSlash(name))
+		}
+	}
+
+	return ref, sumErr
+}
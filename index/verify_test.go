@@ -0,0 +1,72 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	ref, err := buildIndex(url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	r, err := Verify(ref.Dir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Url != url {
+		t.Fatalf("expected url of %s, got %s", url, r.Url)
+	}
+
+	// An index built before checksums is still checked.
+	if err := os.Remove(filepath.Join(ref.Dir(), checksumsFilename)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(ref.Dir()); err != ErrNoChecksums {
+		t.Fatalf("expected %s, got %v", ErrNoChecksums, err)
+	}
+}
+
+func TestVerifyCorrupt(t *testing.T) {
+	ref, err := buildIndex(url, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Remove()
+
+	raw := filepath.Join(ref.Dir(), "raw", "index.go")
+	if err := ioutil.WriteFile(raw, []byte("corrupt"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(ref.Dir()); err == nil {
+		t.Fatal("expected a changed raw file to fail verification")
+	}
+
+	// Without checksums, a missing raw file is still noticed.
+	if err := os.Remove(filepath.Join(ref.Dir(), checksumsFilename)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Verify(ref.Dir()); err == nil || err == ErrNoChecksums {
+		t.Fatalf("expected a missing raw file to fail verification, got %v", err)
+	}
+
+	// An index without a manifest never finished building.
+	if err := os.Remove(filepath.Join(ref.Dir(), manifestFilename)); err != nil {
+		t.Fatal(err)
+	}
+
+	if r, err := Verify(ref.Dir()); err != ErrIncomplete || r != nil {
+		t.Fatalf("expected %s, got %v", ErrIncomplete, err)
+	}
+}
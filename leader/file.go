@@ -0,0 +1,172 @@
+package leader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A lease held in a file on storage shared by all replicas. Linking a
+// written file into place and renaming an expired one out of the way are
+// both atomic, so only one replica can win each round, and the lease is
+// never seen half written.
+type fileLease struct {
+	Path string `json:"path"`
+
+	now func() time.Time
+}
+
+// What is written into the lease file.
+type fileLeaseRecord struct {
+	Holder  string
+	Expires time.Time
+}
+
+func newFileLease(cfg []byte) (lease, error) {
+	l := &fileLease{now: time.Now}
+	if cfg != nil {
+		if err := json.Unmarshal(cfg, l); err != nil {
+			return nil, err
+		}
+	}
+
+	if l.Path == "" {
+		return nil, errors.New("leader: the file lease needs a path")
+	}
+
+	return l, nil
+}
+
+// Read the lease. One that can't be parsed, like the empty file that a
+// replica which crashed while creating it left before leases were linked
+// into place, is held by no one and has expired.
+func (l *fileLease) read() (*fileLeaseRecord, error) {
+	b, err := ioutil.ReadFile(l.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var r fileLeaseRecord
+	if err := json.Unmarshal(b, &r); err != nil {
+		return &fileLeaseRecord{}, nil
+	}
+	return &r, nil
+}
+
+func (l *fileLease) record(identity string, d time.Duration) ([]byte, error) {
+	return json.Marshal(&fileLeaseRecord{
+		Holder:  identity,
+		Expires: l.now().Add(d),
+	})
+}
+
+// Write the record of a lease held by identity to a temporary file next to
+// the lease, which the caller removes once it is in place.
+func (l *fileLease) writeTemp(identity string, d time.Duration) (string, error) {
+	b, err := l.record(identity, d)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(l.Path), ".lease-")
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// Take a free lease by linking a written one into place, which fails if
+// another replica got there first.
+func (l *fileLease) create(identity string, d time.Duration) (bool, error) {
+	tmp, err := l.writeTemp(identity, d)
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp)
+
+	if err := os.Link(tmp, l.Path); os.IsExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Extend a lease we already hold by replacing the file in one step, unless
+// another replica has taken it over since it was read.
+func (l *fileLease) renew(identity string, d time.Duration) (bool, error) {
+	tmp, err := l.writeTemp(identity, d)
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp)
+
+	r, err := l.read()
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if r.Holder != identity || !l.now().Before(r.Expires) {
+		return false, nil
+	}
+
+	return true, os.Rename(tmp, l.Path)
+}
+
+func (l *fileLease) tryAcquire(identity string, d time.Duration) (bool, error) {
+	r, err := l.read()
+	if os.IsNotExist(err) {
+		return l.create(identity, d)
+	} else if err != nil {
+		return false, err
+	}
+
+	// A lease of ours that has expired may be being taken over, so it is
+	// taken back like anyone else's.
+	if r.Holder == identity && l.now().Before(r.Expires) {
+		return l.renew(identity, d)
+	}
+
+	if l.now().Before(r.Expires) {
+		return false, nil
+	}
+
+	// The holder is gone. Only one replica's rename of the stale lease
+	// can succeed; the winner then competes to create a fresh one.
+	stale := fmt.Sprintf("%s.stale-%s", l.Path, identity)
+	if err := os.Rename(l.Path, stale); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer os.Remove(stale)
+
+	// If another replica took over between our read and the rename, we
+	// moved its fresh lease. Put it back unless yet another has been
+	// created since.
+	moved, err := (&fileLease{Path: stale}).read()
+	if err != nil || moved.Holder != r.Holder || !moved.Expires.Equal(r.Expires) {
+		os.Link(stale, l.Path)
+		return false, err
+	}
+
+	return l.create(identity, d)
+}
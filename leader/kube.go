@@ -0,0 +1,215 @@
+package leader
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	defaultLeaseName  = "hound"
+
+	// The format of a kubernetes MicroTime.
+	microTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// A coordination.k8s.io Lease, reached through the in-cluster api server
+// with the pod's service account. Updates carry the resourceVersion that
+// was read, so when two replicas race the api server rejects one of them.
+type kubeLease struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+
+	server    string
+	tokenPath string
+	client    *http.Client
+	now       func() time.Time
+}
+
+type leaseObject struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   leaseMetadata `json:"metadata"`
+	Spec       leaseSpec     `json:"spec"`
+}
+
+type leaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions"`
+}
+
+func newKubeLease(cfg []byte) (lease, error) {
+	l := &kubeLease{
+		Name:      defaultLeaseName,
+		tokenPath: serviceAccountDir + "/token",
+		now:       time.Now,
+	}
+
+	if cfg != nil {
+		if err := json.Unmarshal(cfg, l); err != nil {
+			return nil, err
+		}
+	}
+
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("leader: kubernetes leader election only works inside a cluster")
+	}
+	l.server = "https://" + net.JoinHostPort(host, port)
+
+	if l.Namespace == "" {
+		ns, err := ioutil.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, err
+		}
+		l.Namespace = strings.TrimSpace(string(ns))
+	}
+
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("leader: no certificates in the service account ca.crt")
+	}
+
+	l.client = &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}
+
+	return l, nil
+}
+
+func (l *kubeLease) url(name string) string {
+	return fmt.Sprintf("%s/apis/coordination.k8s.io/v1/namespaces/%s/leases%s", l.server, l.Namespace, name)
+}
+
+// Send a request to the api server. The token is read every time since
+// projected service account tokens are rotated.
+func (l *kubeLease) do(method, uri string, body interface{}) (*http.Response, error) {
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(method, uri, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	if token, err := ioutil.ReadFile(l.tokenPath); err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	return l.client.Do(req)
+}
+
+func (l *kubeLease) tryAcquire(identity string, d time.Duration) (bool, error) {
+	res, err := l.do("GET", l.url("/"+l.Name), nil)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	now := l.now().UTC().Format(microTimeFormat)
+	secs := int((d + time.Second - 1) / time.Second)
+
+	switch res.StatusCode {
+	case http.StatusNotFound:
+		return l.write("POST", l.url(""), &leaseObject{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata: leaseMetadata{
+				Name:      l.Name,
+				Namespace: l.Namespace,
+			},
+			Spec: leaseSpec{
+				HolderIdentity:       identity,
+				LeaseDurationSeconds: secs,
+				AcquireTime:          now,
+				RenewTime:            now,
+			},
+		})
+	case http.StatusOK:
+	default:
+		return false, fmt.Errorf("leader: reading lease %s: %s", l.Name, res.Status)
+	}
+
+	var obj leaseObject
+	if err := json.NewDecoder(res.Body).Decode(&obj); err != nil {
+		return false, err
+	}
+
+	if obj.Spec.HolderIdentity != identity {
+		if !l.expired(&obj.Spec) {
+			return false, nil
+		}
+		obj.Spec.HolderIdentity = identity
+		obj.Spec.AcquireTime = now
+		obj.Spec.LeaseTransitions++
+	}
+
+	obj.Spec.LeaseDurationSeconds = secs
+	obj.Spec.RenewTime = now
+	return l.write("PUT", l.url("/"+l.Name), &obj)
+}
+
+func (l *kubeLease) expired(spec *leaseSpec) bool {
+	if spec.HolderIdentity == "" {
+		return true
+	}
+
+	renewed, err := time.Parse(microTimeFormat, spec.RenewTime)
+	if err != nil {
+		return true
+	}
+
+	return l.now().After(renewed.Add(time.Duration(spec.LeaseDurationSeconds) * time.Second))
+}
+
+// Create or update the lease. A conflict means another replica won.
+func (l *kubeLease) write(method, uri string, obj *leaseObject) (bool, error) {
+	res, err := l.do(method, uri, obj)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return true, nil
+	case http.StatusConflict:
+		return false, nil
+	}
+
+	return false, fmt.Errorf("leader: writing lease %s: %s", l.Name, res.Status)
+}
@@ -0,0 +1,122 @@
+// Package leader elects one of several houndd replicas to do the indexing
+// while the rest only serve what it publishes.
+package leader
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const defaultLeaseDurationMs = 15000
+
+// Elector tells a replica whether it currently holds the lease.
+type Elector interface {
+	IsLeader() bool
+}
+
+// A lease that replicas compete for. tryAcquire takes the lease for
+// identity if it is free or expired, or renews it if identity already
+// holds it, and reports whether identity holds it afterwards.
+type lease interface {
+	tryAcquire(identity string, d time.Duration) (bool, error)
+}
+
+// Options common to every kind of lease.
+type options struct {
+	LeaseDurationMs int `json:"lease-duration-ms"`
+}
+
+func (o *options) duration() time.Duration {
+	if o.LeaseDurationMs == 0 {
+		o.LeaseDurationMs = defaultLeaseDurationMs
+	}
+	return time.Duration(o.LeaseDurationMs) * time.Millisecond
+}
+
+type elector struct {
+	lease    lease
+	identity string
+	duration time.Duration
+	leader   int32
+}
+
+// New starts campaigning for the lease of the given kind, "file" or
+// "kubernetes", configured by cfg. It makes a first attempt before
+// returning so that a lone replica starts out as the leader.
+func New(kind string, cfg []byte) (Elector, error) {
+	var opts options
+	if cfg != nil {
+		if err := json.Unmarshal(cfg, &opts); err != nil {
+			return nil, err
+		}
+	}
+
+	var l lease
+	var err error
+	switch kind {
+	case "file":
+		l, err = newFileLease(cfg)
+	case "kubernetes":
+		l, err = newKubeLease(cfg)
+	default:
+		err = fmt.Errorf("leader: %s is not a valid kind of leader election.", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e := &elector{
+		lease:    l,
+		identity: identity(),
+		duration: opts.duration(),
+	}
+
+	e.campaign()
+	go func() {
+		// renew well within the lease so a slow round doesn't lose it.
+		for range time.Tick(e.duration / 3) {
+			e.campaign()
+		}
+	}()
+
+	return e, nil
+}
+
+// Identify this replica. Pod names are unique within a deployment and
+// become the hostname in kubernetes.
+func identity() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+func (e *elector) campaign() {
+	ok, err := e.lease.tryAcquire(e.identity, e.duration)
+	if err != nil {
+		log.Printf("leader election failed: %s", err)
+		ok = false
+	}
+
+	var v int32
+	if ok {
+		v = 1
+	}
+
+	if old := atomic.SwapInt32(&e.leader, v); old != v {
+		if ok {
+			log.Printf("%s is now the leader and will index", e.identity)
+		} else {
+			log.Printf("%s is no longer the leader and will only serve", e.identity)
+		}
+	}
+}
+
+func (e *elector) IsLeader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
@@ -0,0 +1,226 @@
+package leader
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A clock the test can move forward.
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+// Run the same contest against any kind of lease: a takes it, b can't
+// while a keeps renewing, and b takes over once a stops.
+func testLease(t *testing.T, l lease, c *clock) {
+	d := 10 * time.Second
+
+	if ok, err := l.tryAcquire("a", d); err != nil || !ok {
+		t.Fatalf("expected a to take a free lease: %v %v", ok, err)
+	}
+
+	if ok, err := l.tryAcquire("b", d); err != nil || ok {
+		t.Fatalf("expected b to be refused a held lease: %v %v", ok, err)
+	}
+
+	c.t = c.t.Add(5 * time.Second)
+	if ok, err := l.tryAcquire("a", d); err != nil || !ok {
+		t.Fatalf("expected a to renew its lease: %v %v", ok, err)
+	}
+
+	c.t = c.t.Add(8 * time.Second)
+	if ok, err := l.tryAcquire("b", d); err != nil || ok {
+		t.Fatalf("expected the renewed lease to still be held: %v %v", ok, err)
+	}
+
+	c.t = c.t.Add(5 * time.Second)
+	if ok, err := l.tryAcquire("b", d); err != nil || !ok {
+		t.Fatalf("expected b to take over an expired lease: %v %v", ok, err)
+	}
+
+	if ok, err := l.tryAcquire("a", d); err != nil || ok {
+		t.Fatalf("expected a to have lost the lease: %v %v", ok, err)
+	}
+}
+
+func TestFileLease(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "hound-leader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	c := &clock{t: time.Now()}
+	l := &fileLease{
+		Path: filepath.Join(tmp, "hound.lease"),
+		now:  c.now,
+	}
+
+	testLease(t, l, c)
+}
+
+// Tests that a replica which crashed while creating the lease doesn't keep
+// the rest from ever taking it: neither a temporary file it left nor an
+// empty lease, which is what creating the lease in place could leave.
+func TestFileLeaseCrashMidCreate(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "hound-leader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	c := &clock{t: time.Now()}
+	l := &fileLease{
+		Path: filepath.Join(tmp, "hound.lease"),
+		now:  c.now,
+	}
+	d := 10 * time.Second
+
+	// a crashed after writing its lease, but before linking it into place.
+	if _, err := l.writeTemp("a", d); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := l.tryAcquire("b", d); err != nil || !ok {
+		t.Fatalf("expected b to take a lease that was never created: %v %v", ok, err)
+	}
+
+	if err := ioutil.WriteFile(l.Path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := l.tryAcquire("c", d); err != nil || !ok {
+		t.Fatalf("expected c to take over an empty lease: %v %v", ok, err)
+	}
+	if ok, err := l.tryAcquire("b", d); err != nil || ok {
+		t.Fatalf("expected b to be refused the lease of c: %v %v", ok, err)
+	}
+}
+
+// Tests that a renewal doesn't replace a lease that another replica has
+// taken over since it was read.
+func TestFileLeaseRenewChecksHolder(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "hound-leader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	c := &clock{t: time.Now()}
+	l := &fileLease{
+		Path: filepath.Join(tmp, "hound.lease"),
+		now:  c.now,
+	}
+	d := 10 * time.Second
+
+	if ok, err := l.tryAcquire("b", d); err != nil || !ok {
+		t.Fatalf("expected b to take a free lease: %v %v", ok, err)
+	}
+
+	if ok, err := l.renew("a", d); err != nil || ok {
+		t.Fatalf("expected a to be refused the renewal of the lease of b: %v %v", ok, err)
+	}
+	if r, err := l.read(); err != nil || r.Holder != "b" {
+		t.Fatalf("expected b to still hold the lease, got %v %v", r, err)
+	}
+}
+
+// Just enough of the api server to store one Lease with optimistic
+// concurrency on its resourceVersion.
+type fakeAPIServer struct {
+	lck     sync.Mutex
+	lease   *leaseObject
+	version int
+}
+
+func (s *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var obj leaseObject
+	switch r.Method {
+	case "GET":
+		if s.lease == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(s.lease)
+		return
+	case "POST":
+		if s.lease != nil {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+	case "PUT":
+	}
+
+	json.NewDecoder(r.Body).Decode(&obj)
+	if r.Method == "PUT" && obj.Metadata.ResourceVersion != strconv.Itoa(s.version) {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	s.version++
+	obj.Metadata.ResourceVersion = strconv.Itoa(s.version)
+	s.lease = &obj
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s.lease)
+}
+
+func TestKubeLease(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "hound-leader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	token := filepath.Join(tmp, "token")
+	if err := ioutil.WriteFile(token, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	api := &fakeAPIServer{}
+	srv := httptest.NewTLSServer(api)
+	defer srv.Close()
+
+	c := &clock{t: time.Now()}
+	l := &kubeLease{
+		Namespace: "search",
+		Name:      "hound",
+		server:    srv.URL,
+		tokenPath: token,
+		client:    srv.Client(),
+		now:       c.now,
+	}
+
+	testLease(t, l, c)
+
+	if api.lease.Spec.HolderIdentity != "b" || api.lease.Spec.LeaseTransitions != 1 {
+		t.Fatalf("unexpected lease: %+v", api.lease.Spec)
+	}
+
+	// a write based on a stale read loses to whoever wrote in between.
+	stale := *api.lease
+	stale.Spec.HolderIdentity = "a"
+	if ok, err := l.tryAcquire("b", 10*time.Second); err != nil || !ok {
+		t.Fatalf("expected b to renew its lease: %v %v", ok, err)
+	}
+	if ok, err := l.write("PUT", l.url("/hound"), &stale); err != nil || ok {
+		t.Fatalf("expected a conflicting write to lose: %v %v", ok, err)
+	}
+}
@@ -0,0 +1,278 @@
+// Package meta is a small database, kept in the dbpath, of what is known
+// about the repos being indexed there: the indexes and generations that
+// each is served from, how long it took to build them, the failures of
+// its updates and the searches that were saved. It can be asked about
+// them without opening the indexes, and by fsck while houndd is running.
+//
+// The records are kept in memory and each change is appended to a log,
+// which is rewritten with just the records when it is opened and once it
+// has grown well past them.
+package meta
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Filename is the name of the log in the dbpath.
+const Filename = "meta.log"
+
+// The number of changes past the number of records at which the log is
+// rewritten.
+const compactAfter = 1000
+
+// ErrReadOnly is returned for changes to a database opened with
+// OpenReadOnly.
+var ErrReadOnly = errors.New("meta: the database is read only")
+
+// A change to the log: the new value of a key, or nil if it was deleted.
+type change struct {
+	Table string          `json:"t"`
+	Key   string          `json:"k"`
+	Value json.RawMessage `json:"v,omitempty"`
+}
+
+// DB is the metadata of a dbpath. A nil DB has nothing in it and ignores
+// changes, so that searchers made without one don't need to check.
+type DB struct {
+	lck    sync.Mutex
+	path   string
+	w      *os.File
+	tables map[string]map[string]json.RawMessage
+
+	// the changes appended since the log was last rewritten.
+	changes int
+}
+
+// Open opens the metadata of a dbpath, creating it if there is none, for
+// reading and writing. Only one process should have it open this way.
+func Open(dbpath string) (*DB, error) {
+	db, err := load(filepath.Join(dbpath, Filename))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.compact(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// OpenReadOnly reads the metadata of a dbpath as it is now, which is
+// empty if there is none.
+func OpenReadOnly(dbpath string) (*DB, error) {
+	return load(filepath.Join(dbpath, Filename))
+}
+
+// Snapshot writes the records of the metadata of dbpath, as they are now,
+// to a log at filename, all at once, for backups. A houndd can have the
+// dbpath open; a change that it is in the middle of appending is left out,
+// as it would be after a crash.
+func Snapshot(dbpath, filename string) error {
+	db, err := OpenReadOnly(dbpath)
+	if err != nil {
+		return err
+	}
+	return db.writeRecords(filename)
+}
+
+// Read the records of a log. The last change may have been cut short by
+// a crash, in which case it is left out.
+func load(path string) (*DB, error) {
+	db := &DB{
+		path:   path,
+		tables: map[string]map[string]json.RawMessage{},
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+
+		var c change
+		if err := json.Unmarshal(line, &c); err != nil {
+			if i == len(lines)-1 {
+				break
+			}
+			return nil, fmt.Errorf("meta: %s:%d: %s", path, i+1, err)
+		}
+		db.apply(&c)
+	}
+	return db, nil
+}
+
+func (db *DB) apply(c *change) {
+	t := db.tables[c.Table]
+	if c.Value == nil {
+		delete(t, c.Key)
+		return
+	}
+
+	if t == nil {
+		t = map[string]json.RawMessage{}
+		db.tables[c.Table] = t
+	}
+	t[c.Key] = c.Value
+}
+
+// The number of records in all of the tables. The caller holds the lock.
+func (db *DB) size() int {
+	n := 0
+	for _, t := range db.tables {
+		n += len(t)
+	}
+	return n
+}
+
+// Write a log of just the records to path, all at once. The caller holds
+// the lock, unless the database isn't shared yet.
+func (db *DB) writeRecords(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	var tables []string
+	for name := range db.tables {
+		tables = append(tables, name)
+	}
+	sort.Strings(tables)
+
+	for _, name := range tables {
+		for _, key := range db.keys(name) {
+			if err := writeChange(w, &change{Table: name, Key: key, Value: db.tables[name][key]}); err != nil {
+				f.Close()
+				return err
+			}
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Rewrite the log with just the records, and append to it from then on.
+// The caller holds the lock, unless the database isn't shared yet.
+func (db *DB) compact() error {
+	if err := db.writeRecords(db.path); err != nil {
+		return err
+	}
+
+	var err error
+	if db.w != nil {
+		db.w.Close()
+	}
+	db.w, err = os.OpenFile(db.path, os.O_WRONLY|os.O_APPEND, 0644)
+	db.changes = 0
+	return err
+}
+
+func writeChange(w io.Writer, c *change) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// Record a change and append it to the log. The caller holds the lock.
+func (db *DB) write(c *change) error {
+	if db.w == nil {
+		return ErrReadOnly
+	}
+
+	if err := writeChange(db.w, c); err != nil {
+		return err
+	}
+	db.apply(c)
+
+	db.changes++
+	if db.changes > compactAfter && db.changes > db.size() {
+		return db.compact()
+	}
+	return nil
+}
+
+// Read the record of a key into v, returning whether there is one. The
+// caller holds the lock.
+func (db *DB) get(table, key string, v interface{}) (bool, error) {
+	b := db.tables[table][key]
+	if b == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(b, v)
+}
+
+// The caller holds the lock.
+func (db *DB) put(table, key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return db.write(&change{Table: table, Key: key, Value: b})
+}
+
+// The caller holds the lock.
+func (db *DB) delete(table, key string) (bool, error) {
+	if db.tables[table][key] == nil {
+		return false, nil
+	}
+	return true, db.write(&change{Table: table, Key: key})
+}
+
+// The keys of a table, in order. The caller holds the lock.
+func (db *DB) keys(table string) []string {
+	var keys []string
+	for k := range db.tables[table] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Close stops appending to the log.
+func (db *DB) Close() error {
+	if db == nil {
+		return nil
+	}
+
+	db.lck.Lock()
+	defer db.lck.Unlock()
+
+	if db.w == nil {
+		return nil
+	}
+	err := db.w.Close()
+	db.w = nil
+	return err
+}
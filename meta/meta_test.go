@@ -0,0 +1,253 @@
+package meta
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepos(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	built := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, name := range []string{"api", "web"} {
+		err := db.UpdateRepo(name, func(r *Repo) bool {
+			r.Rev, r.IndexDir, r.IndexedAt = "abc", "/db/idx-"+name, built
+			r.Generations = []*Generation{{Rev: "abb", IndexDir: "/db/idx-old-" + name}}
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.UpdateRepo("web", func(r *Repo) bool {
+		r.Failures, r.LastError = 2, "unreachable"
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RemoveRepo("api"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a change that was cut short is left out.
+	f, err := os.OpenFile(filepath.Join(dir, Filename), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"t": "repos", "k": "api", "v": {"Rev": `)
+	f.Close()
+
+	ro, err := OpenReadOnly(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs, err := ro.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	web := recs["web"]
+	if len(recs) != 1 || web == nil || web.Rev != "abc" || web.Failures != 2 || !web.IndexedAt.Equal(built) {
+		t.Fatalf("expected the record of web, got %v", recs)
+	}
+	if dirs := web.Dirs(); len(dirs) != 2 || dirs[1] != "/db/idx-old-web" {
+		t.Fatalf("expected the dirs of web, got %v", dirs)
+	}
+	if err := ro.RemoveRepo("web"); err != ErrReadOnly {
+		t.Fatalf("expected a change to a read only database to fail, got %v", err)
+	}
+	db.Close()
+
+	// opening it again leaves just the records in the log.
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if rec, err := db.Repo("web"); err != nil || rec == nil || rec.LastError != "unreachable" {
+		t.Fatalf("expected the record of web, got %+v, %v", rec, err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, Filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "\n"); n != 1 {
+		t.Fatalf("expected the log to be compacted to one record, got %d lines", n)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 3*compactAfter; i++ {
+		if err := db.UpdateRepo("api", func(r *Repo) bool {
+			r.IndexMs = int64(i)
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, Filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "\n"); n > compactAfter+1 {
+		t.Fatalf("expected the log to be compacted as it grew, got %d lines", n)
+	}
+	if rec, _ := db.Repo("api"); rec.IndexMs != 3*compactAfter-1 {
+		t.Fatalf("expected the last change, got %+v", rec)
+	}
+}
+
+func TestSavedSearches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, name := range []string{"todo", "log4j"} {
+		if err := db.SaveSearch(&SavedSearch{Name: name, Params: map[string]string{"q": name}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := db.SavedSearches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0].Name != "log4j" || res[1].Params["q"] != "todo" {
+		t.Fatalf("expected the searches in order of name, got %v", res)
+	}
+
+	if ok, err := db.DeleteSearch("todo"); !ok || err != nil {
+		t.Fatalf("expected todo to be deleted, got %v, %v", ok, err)
+	}
+	if ok, _ := db.DeleteSearch("todo"); ok {
+		t.Fatal("expected deleting a missing search to say so")
+	}
+}
+
+func TestPreferences(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p, err := db.Preferences("jane"); p != nil || err != nil {
+		t.Fatalf("expected no preferences, got %v, %v", p, err)
+	}
+
+	ctx := uint(5)
+	err = db.SetPreferences("jane", &Preferences{
+		Repos:          []string{"api"},
+		LinesOfContext: &ctx,
+		Searches:       []*SavedSearch{{Name: "todo", Params: map[string]string{"q": "TODO"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// they are kept apart from those of others, and across restarts.
+	db, err = OpenReadOnly(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := db.Preferences("jane")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p == nil || *p.LinesOfContext != 5 || p.Repos[0] != "api" || p.Searches[0].Params["q"] != "TODO" {
+		t.Fatalf("expected the preferences of jane, got %+v", p)
+	}
+	if p, _ := db.Preferences("john"); p != nil {
+		t.Fatalf("expected john to have none, got %+v", p)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	first := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	if err := db.AddUsage("api", &RepoUsage{Searches: 2, Hits: 1, Terms: map[string]int64{"NewClient": 2}, Since: first}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddUsage("api", &RepoUsage{Searches: 1, Hits: 1, Terms: map[string]int64{"NewClient": 1, "Retry": 1}, Since: first.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := db.Usage("api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Searches != 3 || u.Hits != 2 || u.Terms["NewClient"] != 3 || u.Terms["Retry"] != 1 || !u.Since.Equal(first) {
+		t.Fatalf("expected the counts to add up, got %+v", u)
+	}
+
+	// the terms searched least make way for new ones.
+	many := &RepoUsage{Terms: map[string]int64{}}
+	for i := 0; i < maxUsageTerms; i++ {
+		many.Terms[fmt.Sprintf("term%d", i)] = 1
+	}
+	if err := db.AddUsage("api", many); err != nil {
+		t.Fatal(err)
+	}
+	u, _ = db.Usage("api")
+	if len(u.Terms) != maxUsageTerms/2 || u.Terms["NewClient"] != 3 || u.Terms["Retry"] != 1 {
+		t.Fatalf("expected the top %d terms to be kept, got %d of them", maxUsageTerms/2, len(u.Terms))
+	}
+
+	if u, _ := db.Usage("web"); u != nil {
+		t.Fatalf("expected web to have no usage, got %+v", u)
+	}
+	if repos := db.UsageRepos(); len(repos) != 1 || repos[0] != "api" {
+		t.Fatalf("expected only api to have usage, got %v", repos)
+	}
+}
@@ -0,0 +1,67 @@
+package meta
+
+import "time"
+
+const tablePrefs = "prefs"
+
+// Preferences are the settings of a user, kept on the server so that they
+// follow the user from one machine to another.
+type Preferences struct {
+	// The repos that are searched unless a search says otherwise.
+	Repos []string `json:",omitempty"`
+
+	// The theme of the UI.
+	Theme string `json:",omitempty"`
+
+	// The lines of context around matches, and the files of a repo that
+	// are shown before more are loaded, if they are set.
+	LinesOfContext *uint `json:",omitempty"`
+	ResultsPerPage uint  `json:",omitempty"`
+
+	// The searches that the user saved, which only they see.
+	Searches []*SavedSearch `json:",omitempty"`
+
+	Updated time.Time
+}
+
+// Preferences returns the preferences of a user, or nil if they never
+// set any.
+func (db *DB) Preferences(user string) (*Preferences, error) {
+	if db == nil {
+		return nil, nil
+	}
+
+	db.lck.Lock()
+	defer db.lck.Unlock()
+
+	var p Preferences
+	if ok, err := db.get(tablePrefs, user, &p); !ok || err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// SetPreferences replaces the preferences of a user.
+func (db *DB) SetPreferences(user string, p *Preferences) error {
+	if db == nil {
+		return ErrReadOnly
+	}
+
+	db.lck.Lock()
+	defer db.lck.Unlock()
+
+	return db.put(tablePrefs, user, p)
+}
+
+// DeletePreferences forgets the preferences of a user, returning whether
+// there were any.
+func (db *DB) DeletePreferences(user string) (bool, error) {
+	if db == nil {
+		return false, nil
+	}
+
+	db.lck.Lock()
+	defer db.lck.Unlock()
+
+	return db.delete(tablePrefs, user)
+}
@@ -0,0 +1,130 @@
+package meta
+
+import "time"
+
+const tableRepos = "repos"
+
+// Repo is what is known about the indexing of a repo.
+type Repo struct {
+	URL string
+
+	// The index being served, the revision it is of and when it was
+	// built.
+	Rev       string `json:",omitempty"`
+	IndexDir  string `json:",omitempty"`
+	IndexedAt time.Time
+
+	// How long the update that built the index took, from fetching the
+	// revision to opening the index.
+	IndexMs int64 `json:",omitempty"`
+
+	// The earlier generations that are kept, newest first.
+	Generations []*Generation `json:",omitempty"`
+
+	// The failures in a row of the updates of the repo, and the last one.
+	Failures    int    `json:",omitempty"`
+	LastError   string `json:",omitempty"`
+	LastFailure time.Time
+
+	// When the first of the failures in a row was, which is kept across
+	// restarts, unlike the count.
+	FailingSince time.Time
+
+	// When the revision of the repo last changed, as far as hound has
+	// seen it change.
+	ChangedAt time.Time
+
+	// Whether the repo was disabled, so that it is neither indexed nor
+	// served until it is enabled again even though it is in the config.
+	Disabled bool `json:",omitempty"`
+}
+
+// Generation is an earlier index of a repo that is kept.
+type Generation struct {
+	Rev       string
+	IndexDir  string
+	IndexedAt time.Time
+}
+
+// Dirs returns the directories of the indexes of the repo, the one being
+// served first.
+func (r *Repo) Dirs() []string {
+	var dirs []string
+	if r.IndexDir != "" {
+		dirs = append(dirs, r.IndexDir)
+	}
+	for _, g := range r.Generations {
+		dirs = append(dirs, g.IndexDir)
+	}
+	return dirs
+}
+
+// Repo returns the record of a repo, or nil if there is none.
+func (db *DB) Repo(name string) (*Repo, error) {
+	if db == nil {
+		return nil, nil
+	}
+
+	db.lck.Lock()
+	defer db.lck.Unlock()
+
+	var r Repo
+	if ok, err := db.get(tableRepos, name, &r); !ok || err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Repos returns the records of every repo, by name.
+func (db *DB) Repos() (map[string]*Repo, error) {
+	res := map[string]*Repo{}
+	if db == nil {
+		return res, nil
+	}
+
+	db.lck.Lock()
+	defer db.lck.Unlock()
+
+	for _, name := range db.keys(tableRepos) {
+		var r Repo
+		if _, err := db.get(tableRepos, name, &r); err != nil {
+			return nil, err
+		}
+		res[name] = &r
+	}
+	return res, nil
+}
+
+// UpdateRepo changes the record of a repo with f, which starts from an
+// empty one if there is none. The record is only written if f says that
+// it changed it.
+func (db *DB) UpdateRepo(name string, f func(r *Repo) bool) error {
+	if db == nil {
+		return nil
+	}
+
+	db.lck.Lock()
+	defer db.lck.Unlock()
+
+	var r Repo
+	if _, err := db.get(tableRepos, name, &r); err != nil {
+		return err
+	}
+	if !f(&r) {
+		return nil
+	}
+	return db.put(tableRepos, name, &r)
+}
+
+// RemoveRepo forgets a repo.
+func (db *DB) RemoveRepo(name string) error {
+	if db == nil {
+		return nil
+	}
+
+	db.lck.Lock()
+	defer db.lck.Unlock()
+
+	_, err := db.delete(tableRepos, name)
+	return err
+}
@@ -0,0 +1,60 @@
+package meta
+
+import "time"
+
+const tableSearches = "searches"
+
+// SavedSearch is a search that was saved under a name, so that it can be
+// run again.
+type SavedSearch struct {
+	Name string
+
+	// The parameters of the search, as /api/v1/search takes them.
+	Params map[string]string
+
+	Created time.Time
+}
+
+// SaveSearch saves a search, replacing the one with the same name.
+func (db *DB) SaveSearch(s *SavedSearch) error {
+	if db == nil {
+		return ErrReadOnly
+	}
+
+	db.lck.Lock()
+	defer db.lck.Unlock()
+
+	return db.put(tableSearches, s.Name, s)
+}
+
+// SavedSearches returns the saved searches in order of name.
+func (db *DB) SavedSearches() ([]*SavedSearch, error) {
+	if db == nil {
+		return nil, nil
+	}
+
+	db.lck.Lock()
+	defer db.lck.Unlock()
+
+	var res []*SavedSearch
+	for _, name := range db.keys(tableSearches) {
+		var s SavedSearch
+		if _, err := db.get(tableSearches, name, &s); err != nil {
+			return nil, err
+		}
+		res = append(res, &s)
+	}
+	return res, nil
+}
+
+// DeleteSearch deletes a saved search, returning whether there was one.
+func (db *DB) DeleteSearch(name string) (bool, error) {
+	if db == nil {
+		return false, nil
+	}
+
+	db.lck.Lock()
+	defer db.lck.Unlock()
+
+	return db.delete(tableSearches, name)
+}
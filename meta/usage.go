@@ -0,0 +1,118 @@
+package meta
+
+import (
+	"sort"
+	"time"
+)
+
+const tableUsage = "usage"
+
+// The most terms that are kept for a repo. Once there are more, the ones
+// searched least are dropped down to half of this, which leaves room for
+// new ones to build up.
+const maxUsageTerms = 200
+
+// RepoUsage is how a repo has been searched: how many searches took it in
+// and found something in it, and the terms that were searched for most.
+type RepoUsage struct {
+	Searches int64
+	Hits     int64
+
+	// The number of searches of each term.
+	Terms map[string]int64 `json:",omitempty"`
+
+	// When the first of the searches was.
+	Since time.Time
+}
+
+// Keep the terms that were searched most, breaking ties by the term.
+func (u *RepoUsage) trim() {
+	if len(u.Terms) <= maxUsageTerms {
+		return
+	}
+
+	terms := make([]string, 0, len(u.Terms))
+	for t := range u.Terms {
+		terms = append(terms, t)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		a, b := u.Terms[terms[i]], u.Terms[terms[j]]
+		if a != b {
+			return a > b
+		}
+		return terms[i] < terms[j]
+	})
+	for _, t := range terms[maxUsageTerms/2:] {
+		delete(u.Terms, t)
+	}
+}
+
+// Usage returns the usage of a repo, or nil if it was never searched.
+func (db *DB) Usage(repo string) (*RepoUsage, error) {
+	if db == nil {
+		return nil, nil
+	}
+
+	db.lck.Lock()
+	defer db.lck.Unlock()
+
+	var u RepoUsage
+	if ok, err := db.get(tableUsage, repo, &u); !ok || err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// UsageRepos returns the names of the repos that have usage, in order.
+func (db *DB) UsageRepos() []string {
+	if db == nil {
+		return nil
+	}
+
+	db.lck.Lock()
+	defer db.lck.Unlock()
+
+	return db.keys(tableUsage)
+}
+
+// AddUsage adds the counts of add to the usage of a repo.
+func (db *DB) AddUsage(repo string, add *RepoUsage) error {
+	if db == nil {
+		return ErrReadOnly
+	}
+
+	db.lck.Lock()
+	defer db.lck.Unlock()
+
+	var u RepoUsage
+	if _, err := db.get(tableUsage, repo, &u); err != nil {
+		return err
+	}
+
+	if u.Since.IsZero() || !add.Since.IsZero() && add.Since.Before(u.Since) {
+		u.Since = add.Since
+	}
+	u.Searches += add.Searches
+	u.Hits += add.Hits
+	for t, n := range add.Terms {
+		if u.Terms == nil {
+			u.Terms = map[string]int64{}
+		}
+		u.Terms[t] += n
+	}
+	u.trim()
+
+	return db.put(tableUsage, repo, &u)
+}
+
+// DeleteUsage forgets the usage of a repo, returning whether it had any.
+func (db *DB) DeleteUsage(repo string) (bool, error) {
+	if db == nil {
+		return false, nil
+	}
+
+	db.lck.Lock()
+	defer db.lck.Unlock()
+
+	return db.delete(tableUsage, repo)
+}
@@ -0,0 +1,280 @@
+// Package notify calls webhooks about what happens to the repos, like an
+// index being rebuilt or failing, so that people or other services can
+// be told about it.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/hound-search/hound/config"
+)
+
+// The events that can be sent.
+const (
+	// A repo started serving an index of a new revision.
+	IndexCompleted = "index-completed"
+
+	// A repo failed to update as many times in a row as a webhook's
+	// failures setting.
+	IndexFailed = "index-failed"
+
+	// The canary of a repo refused a new index, so the old one is still
+	// served.
+	IndexRefused = "index-refused"
+
+	RepoAdded   = "repo-added"
+	RepoRemoved = "repo-removed"
+)
+
+var events = map[string]bool{
+	IndexCompleted: true,
+	IndexFailed:    true,
+	IndexRefused:   true,
+	RepoAdded:      true,
+	RepoRemoved:    true,
+}
+
+// The number of events that can wait for a webhook before new ones are
+// dropped.
+const queueSize = 100
+
+// How many times, and how far apart, a webhook is tried.
+const (
+	maxAttempts  = 3
+	retryBackoff = time.Second
+	sendTimeout  = 10 * time.Second
+)
+
+// Event is something that happened to a repo. It is the payload of json
+// webhooks, and what their templates are executed with.
+type Event struct {
+	Event    string    `json:"event"`
+	Repo     string    `json:"repo"`
+	URL      string    `json:"url,omitempty"`
+	Rev      string    `json:"rev,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Failures int       `json:"failures,omitempty"`
+	Time     time.Time `json:"time"`
+
+	// The id of the API request that set off the indexing, if one did.
+	RequestID string `json:"request,omitempty"`
+}
+
+// Message describes the event in a line for people.
+func (e *Event) Message() string {
+	switch e.Event {
+	case IndexCompleted:
+		return fmt.Sprintf("Hound: %s is now indexed at %s", e.Repo, e.Rev)
+	case IndexFailed:
+		return fmt.Sprintf("Hound: %s has failed to index %d times in a row: %s", e.Repo, e.Failures, e.Error)
+	case IndexRefused:
+		return fmt.Sprintf("Hound: the index of %s at %s was refused, %s", e.Repo, e.Rev, e.Error)
+	case RepoAdded:
+		return fmt.Sprintf("Hound: %s (%s) was added", e.Repo, e.URL)
+	case RepoRemoved:
+		return fmt.Sprintf("Hound: %s was removed", e.Repo)
+	}
+	return fmt.Sprintf("Hound: %s %s", e.Event, e.Repo)
+}
+
+// Notifier sends events to the webhooks of the config. A nil Notifier
+// sends nothing.
+type Notifier struct {
+	hooks []*hook
+}
+
+type hook struct {
+	cfg    *config.Notification
+	tmpl   *template.Template
+	events map[string]bool
+	client *http.Client
+	queue  chan *Event
+}
+
+var funcs = template.FuncMap{
+	// Quote a value for use in a json template.
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// New checks the webhooks of the config and starts sending events to
+// them with client. It returns nil if there are none.
+func New(cfgs []*config.Notification, client *http.Client) (*Notifier, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	n := &Notifier{}
+	for _, cfg := range cfgs {
+		h, err := newHook(cfg, client)
+		if err != nil {
+			return nil, fmt.Errorf("notification %s: %s", cfg.URL, err)
+		}
+		n.hooks = append(n.hooks, h)
+		go h.run()
+	}
+	return n, nil
+}
+
+func newHook(cfg *config.Notification, client *http.Client) (*hook, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("a url is required")
+	}
+
+	switch cfg.Format {
+	case "json", "slack", "teams":
+	default:
+		return nil, fmt.Errorf("unknown format: %s", cfg.Format)
+	}
+
+	h := &hook{
+		cfg:    cfg,
+		client: client,
+		queue:  make(chan *Event, queueSize),
+	}
+
+	if len(cfg.Events) > 0 {
+		h.events = map[string]bool{}
+		for _, e := range cfg.Events {
+			if !events[e] {
+				return nil, fmt.Errorf("unknown event: %s", e)
+			}
+			h.events[e] = true
+		}
+	}
+
+	if cfg.Template != "" {
+		t, err := template.New(cfg.URL).Funcs(funcs).Parse(cfg.Template)
+		if err != nil {
+			return nil, err
+		}
+		h.tmpl = t
+	}
+
+	return h, nil
+}
+
+// Notify queues an event for every webhook that wants it. It never
+// blocks, so events are dropped if a webhook falls far behind.
+func (n *Notifier) Notify(e *Event) {
+	if n == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	for _, h := range n.hooks {
+		if !h.wants(e) {
+			continue
+		}
+
+		select {
+		case h.queue <- e:
+		default:
+			log.Printf("Dropping %s of %s for %s, too many notifications are waiting", e.Event, e.Repo, h.cfg.URL)
+		}
+	}
+}
+
+func (h *hook) wants(e *Event) bool {
+	if h.events != nil && !h.events[e.Event] {
+		return false
+	}
+
+	// failures are only worth telling about once they reach the
+	// threshold, not on every one after.
+	if e.Event == IndexFailed && e.Failures != h.cfg.Failures {
+		return false
+	}
+
+	return true
+}
+
+// The payload of the event for this webhook.
+func (h *hook) body(e *Event) ([]byte, error) {
+	text := e.Message()
+	if h.tmpl != nil {
+		var buf bytes.Buffer
+		if err := h.tmpl.Execute(&buf, e); err != nil {
+			return nil, err
+		}
+		if h.cfg.Format == "json" {
+			return buf.Bytes(), nil
+		}
+		text = buf.String()
+	}
+
+	switch h.cfg.Format {
+	case "slack", "teams":
+		return json.Marshal(map[string]string{"text": text})
+	}
+	return json.Marshal(e)
+}
+
+func (h *hook) run() {
+	for e := range h.queue {
+		if err := h.send(e); err != nil {
+			log.Printf("failed to send %s of %s to %s: %s", e.Event, e.Repo, h.cfg.URL, err)
+		}
+	}
+}
+
+func (h *hook) send(e *Event) error {
+	b, err := h.body(e)
+	if err != nil {
+		return err
+	}
+
+	c := *h.client
+	c.Timeout = sendTimeout
+
+	for i := 0; ; i++ {
+		err = h.post(&c, b)
+		if err == nil || i+1 == maxAttempts {
+			return err
+		}
+		time.Sleep(retryBackoff << uint(i))
+	}
+}
+
+func (h *hook) post(c *http.Client, b []byte) error {
+	req, err := http.NewRequest("POST", h.cfg.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, val := range h.cfg.HTTPHeaders {
+		if strings.ToLower(key) == "host" {
+			req.Host = val
+		} else {
+			req.Header.Set(key, val)
+		}
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("status %d", res.StatusCode)
+	}
+	return nil
+}
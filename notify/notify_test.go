@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hound-search/hound/config"
+)
+
+// A webhook that sends each request it gets on the channel.
+type request struct {
+	header http.Header
+	body   string
+}
+
+func fakeHook(t *testing.T) (*httptest.Server, chan *request) {
+	ch := make(chan *request, 10)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		ch <- &request{r.Header, string(b)}
+	}))
+	return s, ch
+}
+
+func receive(t *testing.T, ch chan *request) *request {
+	select {
+	case r := <-ch:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the webhook")
+	}
+	return nil
+}
+
+func TestNotify(t *testing.T) {
+	s, ch := fakeHook(t)
+	defer s.Close()
+
+	n, err := New([]*config.Notification{
+		{
+			URL:         s.URL,
+			Format:      "json",
+			Events:      []string{IndexFailed, RepoAdded},
+			HTTPHeaders: map[string]string{"Authorization": "Bearer secret"},
+			Failures:    2,
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n.Notify(&Event{Event: IndexCompleted, Repo: "foo"})
+	n.Notify(&Event{Event: IndexFailed, Repo: "foo", Failures: 1})
+	n.Notify(&Event{Event: IndexFailed, Repo: "foo", Failures: 2, Error: "boom"})
+
+	r := receive(t, ch)
+	if got := r.header.Get("Authorization"); got != "Bearer secret" {
+		t.Fatalf("expected the configured headers, got %q", got)
+	}
+	if !strings.Contains(r.body, `"event":"index-failed"`) || !strings.Contains(r.body, `"failures":2`) {
+		t.Fatalf("expected only the failure that reached the threshold, got %s", r.body)
+	}
+
+	select {
+	case r := <-ch:
+		t.Fatalf("expected nothing more to be sent, got %s", r.body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSlackTemplate(t *testing.T) {
+	s, ch := fakeHook(t)
+	defer s.Close()
+
+	n, err := New([]*config.Notification{
+		{URL: s.URL, Format: "slack"},
+		{URL: s.URL, Format: "teams", Template: "{{.Repo}} at {{.Rev}}"},
+		{URL: s.URL, Format: "json", Template: `{"repo": {{json .Repo}}}`},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n.Notify(&Event{Event: IndexCompleted, Repo: `f"oo`, Rev: "abc"})
+
+	bodies := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		bodies[receive(t, ch).body] = true
+	}
+
+	for _, want := range []string{
+		`{"text":"Hound: f\"oo is now indexed at abc"}`,
+		`{"text":"f\"oo at abc"}`,
+		`{"repo": "f\"oo"}`,
+	} {
+		if !bodies[want] {
+			t.Errorf("expected %s to be sent, got %v", want, bodies)
+		}
+	}
+}
+
+func TestBadConfig(t *testing.T) {
+	for _, cfg := range []*config.Notification{
+		{Format: "json"},
+		{URL: "http://localhost/", Format: "xml"},
+		{URL: "http://localhost/", Format: "json", Events: []string{"index-exploded"}},
+		{URL: "http://localhost/", Format: "json", Template: "{{.Repo"},
+	} {
+		if _, err := New([]*config.Notification{cfg}, nil); err == nil {
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+
+	// nothing is configured, so nothing is sent.
+	n, err := New(nil, nil)
+	if err != nil || n != nil {
+		t.Fatalf("expected no notifier, got %v, %v", n, err)
+	}
+	n.Notify(&Event{Event: RepoAdded})
+}
@@ -0,0 +1,84 @@
+// Package reqid gives each API call an id that it is known by in the logs,
+// the response and the work that it sets off, so that a failure a user
+// reports can be found in the logs of the server.
+package reqid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Header is the header that requests and responses carry their id in.
+const Header = "X-Request-Id"
+
+// The longest id taken from a request. Longer ones are replaced.
+const maxLen = 64
+
+type key struct{}
+
+// New makes a random id.
+func New() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// NewContext returns a copy of ctx that carries the id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, key{}, id)
+}
+
+// FromContext returns the id that ctx carries, or "" if it has none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(key{}).(string)
+	return id
+}
+
+// Whether an id that came with a request is fit to be logged and sent
+// back, which it is if it is short and made of letters, digits and a few
+// marks.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-' || c == '_' || c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Handler gives each request to h an id, the one in its X-Request-Id
+// header if that came from a proxy in front of hound, or else a new one.
+// The id is set in the header of the response before h is called, and is
+// in the context of the request.
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid(id) {
+			id = New()
+		}
+		w.Header().Set(Header, id)
+		h.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
+
+// Printf logs a message with the id that ctx carries, if it has one, as
+// request=<id> at the start of the line.
+func Printf(ctx context.Context, format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	if id := FromContext(ctx); id != "" {
+		msg = "request=" + id + " " + msg
+	}
+	log.Print(msg)
+}
@@ -0,0 +1,47 @@
+package reqid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	var seen string
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}))
+
+	tests := []struct {
+		sent string
+		keep bool
+	}{
+		{"", false},
+		{"abc-123_X.y", true},
+		{"has spaces", false},
+		{"inject\nrequest=1", false},
+		{strings.Repeat("a", maxLen+1), false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/api/v1/search", nil)
+		if test.sent != "" {
+			r.Header.Set(Header, test.sent)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		got := w.Header().Get(Header)
+		if got == "" || got != seen {
+			t.Fatalf("%q: expected the same id in the response and the context, got %q and %q", test.sent, got, seen)
+		}
+		if (got == test.sent) != test.keep {
+			t.Errorf("%q: expected it to be kept: %v, got %q", test.sent, test.keep, got)
+		}
+	}
+
+	if New() == New() {
+		t.Fatal("expected new ids to differ")
+	}
+}
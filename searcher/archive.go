@@ -0,0 +1,71 @@
+package searcher
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// How often a repo of the archive tier checks whether it has been idle
+// for long enough to be archived.
+const archiveCheckInterval = time.Minute
+
+// Record that the indexes of the searcher are being used.
+func (s *Searcher) touch() {
+	atomic.StoreInt64(&s.lastUsed, time.Now().UnixNano())
+}
+
+// When the indexes of the searcher were last used.
+func (s *Searcher) lastUse() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&s.lastUsed))
+}
+
+// Archive the indexes of the searcher that aren't yet, the one being
+// served and those that are kept. It returns false once the searcher has
+// been removed.
+func (s *Searcher) archive(name string) bool {
+	s.lck.RLock()
+	if s.idx == nil {
+		s.lck.RUnlock()
+		return false
+	}
+
+	// the indexes are held like searches hold them, so that none of them
+	// is destroyed while it is being archived.
+	gens := append([]*generation{{s.idx, s.inUse}}, s.retained...)
+	for _, g := range gens {
+		g.inUse.Add(1)
+	}
+	s.lck.RUnlock()
+
+	for _, g := range gens {
+		if !g.idx.Archived() {
+			if err := g.idx.Archive(); err != nil {
+				log.Printf("failed to archive index (%s): %s", name, err)
+			} else {
+				log.Printf("Archived the index of %s at %s", name, g.idx.Ref.Rev)
+			}
+		}
+		g.inUse.Done()
+	}
+	return true
+}
+
+// Archive the indexes of a repo of the archive tier whenever it has gone
+// unsearched for the ms-idle-before-archive of the repo, until the
+// searcher is removed. Searches wake them again.
+func (s *Searcher) archiveWhenIdle(name string) {
+	idle := time.Duration(s.Repo.MsIdleBeforeArchive) * time.Millisecond
+
+	t := time.NewTicker(archiveCheckInterval)
+	defer t.Stop()
+
+	for range t.C {
+		if time.Since(s.lastUse()) < idle {
+			continue
+		}
+		if !s.archive(name) {
+			return
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package searcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/meta"
+)
+
+const (
+	// Written last, so a backup without it is incomplete.
+	backupManifestFilename = "backup.json"
+
+	// While this file exists in the dbpath, searchers will not pull or
+	// reindex so the vcs dirs hold still while they are copied.
+	backupPauseFilename = "backup-in-progress"
+
+	// A pause file older than this was left behind by a backup that
+	// died and is ignored.
+	maxBackupPause = time.Hour
+
+	// How many times to try copying a vcs dir that keeps changing.
+	maxCopyAttempts = 3
+)
+
+// Describes the contents of a backup.
+type backupManifest struct {
+	// The dbpath the backup was taken from. Used to fix up absolute
+	// paths on restore.
+	DbPath  string
+	Time    time.Time
+	Indexes []*backupIndex
+	Vcs     []string
+
+	// Whether the backup has the metadata of the dbpath, which backups
+	// from before it was kept don't.
+	Meta bool
+}
+
+type backupIndex struct {
+	Dir string
+	Url string
+	Rev string
+}
+
+// Whether a backup has asked searchers to hold off on updates.
+func backupInProgress(dbpath string) bool {
+	fi, err := os.Stat(filepath.Join(dbpath, backupPauseFilename))
+	if err != nil {
+		return false
+	}
+	return time.Since(fi.ModTime()) < maxBackupPause
+}
+
+// Backup snapshots the indexes, vcs dirs and metadata in dbpath into the
+// target directory, which must not already exist. It is safe to run
+// against the dbpath of a running houndd: only index generations with a
+// complete manifest are copied and updates are paused while the vcs dirs
+// are.
+func Backup(dbpath, target string) error {
+	dbpath, err := filepath.Abs(dbpath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(target); err == nil {
+		return fmt.Errorf("backup target %s already exists", target)
+	}
+
+	if err := os.MkdirAll(target, os.ModePerm); err != nil {
+		return err
+	}
+
+	pause := filepath.Join(dbpath, backupPauseFilename)
+	if err := ioutil.WriteFile(pause, []byte(time.Now().Format(time.RFC3339)), 0644); err != nil {
+		return err
+	}
+	defer os.Remove(pause)
+
+	m := &backupManifest{
+		DbPath: dbpath,
+		Time:   time.Now(),
+	}
+
+	if m.Indexes, err = backupIndexes(dbpath, target); err != nil {
+		return err
+	}
+
+	if m.Vcs, err = backupVcs(dbpath, target); err != nil {
+		return err
+	}
+
+	// the metadata has the saved searches, preferences and usage, along
+	// with the records of the indexes.
+	if err := meta.Snapshot(dbpath, filepath.Join(target, meta.Filename)); err != nil {
+		return err
+	}
+	m.Meta = true
+
+	return writeBackupManifest(target, m)
+}
+
+// Copy each complete index generation. An index dir is never modified
+// once its manifest is written, so the only hazard is one being removed
+// by a swap while it is copied. Those are dropped since a newer
+// generation will have replaced them.
+func backupIndexes(dbpath, target string) ([]*backupIndex, error) {
+	dirs, err := filepath.Glob(filepath.Join(dbpath, "idx-*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var idxs []*backupIndex
+	for _, dir := range dirs {
+		ref, err := index.Read(dir)
+		if err != nil {
+			// still being built
+			continue
+		}
+
+		dst := filepath.Join(target, filepath.Base(dir))
+		err = copyDir(dir, dst)
+		if _, serr := index.Read(dir); serr != nil {
+			// removed out from under us
+			os.RemoveAll(dst)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		idxs = append(idxs, &backupIndex{
+			Dir: filepath.Base(dir),
+			Url: ref.Url,
+			Rev: ref.Rev,
+		})
+	}
+
+	return idxs, nil
+}
+
+// Copy each vcs dir, including shared object stores. A searcher that
+// was already pulling when the backup started may still touch its dir,
+// so the copy is retried until the dir holds still across a whole pass.
+func backupVcs(dbpath, target string) ([]string, error) {
+	dirs, err := filepath.Glob(filepath.Join(dbpath, "vcs-*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, dir := range dirs {
+		dst := filepath.Join(target, filepath.Base(dir))
+		if err := copyStableDir(dir, dst); err != nil {
+			return nil, err
+		}
+		names = append(names, filepath.Base(dir))
+	}
+
+	return names, nil
+}
+
+func copyStableDir(src, dst string) error {
+	for i := 0; i < maxCopyAttempts; i++ {
+		before, err := snapshotDir(src)
+		if err != nil {
+			return err
+		}
+
+		if err := copyDir(src, dst); err != nil {
+			return err
+		}
+
+		after, err := snapshotDir(src)
+		if err != nil {
+			return err
+		}
+
+		if before == after {
+			return nil
+		}
+
+		log.Printf("%s changed during backup, copying again", src)
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("%s kept changing during backup", src)
+}
+
+// Summarize the names, sizes and mod times of everything under dir.
+func snapshotDir(dir string) (string, error) {
+	var b strings.Builder
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s %d %d %s\n", path, fi.Size(), fi.ModTime().UnixNano(), fi.Mode())
+		return nil
+	})
+	return b.String(), err
+}
+
+func writeBackupManifest(dir string, m *backupManifest) error {
+	w, err := os.Create(filepath.Join(dir, backupManifestFilename))
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(m)
+}
+
+func readBackupManifest(dir string) (*backupManifest, error) {
+	r, err := os.Open(filepath.Join(dir, backupManifestFilename))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a complete backup: %s", dir, err)
+	}
+	defer r.Close()
+
+	var m backupManifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// Restore copies a backup made with Backup, metadata and all, into dbpath
+// so that houndd can start up without cloning or indexing the repos
+// again. It refuses to overwrite a dbpath that already holds indexes or
+// vcs dirs.
+func Restore(src, dbpath string) error {
+	dbpath, err := filepath.Abs(dbpath)
+	if err != nil {
+		return err
+	}
+
+	m, err := readBackupManifest(src)
+	if err != nil {
+		return err
+	}
+
+	for _, pat := range []string{"idx-*", "vcs-*"} {
+		existing, err := filepath.Glob(filepath.Join(dbpath, pat))
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			return fmt.Errorf("dbpath %s is not empty, refusing to restore over it", dbpath)
+		}
+	}
+
+	if err := os.MkdirAll(dbpath, os.ModePerm); err != nil {
+		return err
+	}
+
+	for _, idx := range m.Indexes {
+		if err := copyDir(filepath.Join(src, idx.Dir), filepath.Join(dbpath, idx.Dir)); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range m.Vcs {
+		dir := filepath.Join(dbpath, name)
+		if err := copyDir(filepath.Join(src, name), dir); err != nil {
+			return err
+		}
+
+		if err := rewriteAlternates(dir, m.DbPath, dbpath); err != nil {
+			return err
+		}
+	}
+
+	// last, and all at once, so that the metadata is only there with the
+	// indexes that it describes.
+	if m.Meta {
+		if err := meta.Snapshot(src, filepath.Join(dbpath, meta.Filename)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Git working dirs that borrow objects from a shared store refer to it
+// by absolute path, which will differ if the dbpath has moved.
+func rewriteAlternates(dir, from, to string) error {
+	if from == to {
+		return nil
+	}
+
+	alt := filepath.Join(dir, ".git", "objects", "info", "alternates")
+	dat, err := ioutil.ReadFile(alt)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	lines := strings.Split(string(dat), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, from+string(filepath.Separator)) {
+			lines[i] = to + strings.TrimPrefix(line, from)
+		}
+	}
+
+	return ioutil.WriteFile(alt, []byte(strings.Join(lines, "\n")), 0644)
+}
+
+// Recursively copy src to dst, keeping file modes and symlinks.
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case fi.IsDir():
+			return os.MkdirAll(target, fi.Mode().Perm()|0700)
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case fi.Mode().IsRegular():
+			return copyFile(path, target, fi.Mode().Perm())
+		}
+
+		// sockets, devices and the like have no place in a dbpath
+		return nil
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
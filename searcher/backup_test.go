@@ -0,0 +1,137 @@
+package searcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/meta"
+)
+
+func writeFile(t *testing.T, path, data string) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "hound-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	dbpath := filepath.Join(tmp, "db")
+	vcsDir := filepath.Join(dbpath, "vcs-abc")
+	store := filepath.Join(dbpath, "vcs-shared-abc")
+	writeFile(t, filepath.Join(vcsDir, "main.go"), "package main\n")
+	writeFile(t, filepath.Join(vcsDir, ".git", "objects", "info", "alternates"),
+		filepath.Join(store, "objects")+"\n")
+	writeFile(t, filepath.Join(store, "HEAD"), "ref: refs/heads/master\n")
+
+	if _, err := index.Build(&index.IndexOptions{}, filepath.Join(dbpath, "idx-done"), vcsDir, "url", "rev"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the metadata, with a change that is still being appended.
+	db, err := meta.Open(dbpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveSearch(&meta.SavedSearch{Name: "todos", Params: map[string]string{"q": "TODO"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetPreferences("jane", &meta.Preferences{Repos: []string{"api"}}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	f, err := os.OpenFile(filepath.Join(dbpath, meta.Filename), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"t":"searches","k":"half`)
+	f.Close()
+
+	// an index that is still being built has no manifest
+	writeFile(t, filepath.Join(dbpath, "idx-building", "raw", "main.go"), "package main\n")
+
+	target := filepath.Join(tmp, "backup")
+	if err := Backup(dbpath, target); err != nil {
+		t.Fatal(err)
+	}
+
+	if backupInProgress(dbpath) {
+		t.Fatal("pause file left behind")
+	}
+
+	if _, err := os.Stat(filepath.Join(target, "idx-building")); err == nil {
+		t.Fatal("incomplete index was backed up")
+	}
+
+	if err := Backup(dbpath, target); err == nil {
+		t.Fatal("expected backup over an existing target to fail")
+	}
+
+	restored := filepath.Join(tmp, "restored")
+	if err := Restore(target, restored); err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := index.Read(filepath.Join(restored, "idx-done"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Url != "url" || ref.Rev != "rev" {
+		t.Fatalf("restored ref is %s@%s", ref.Url, ref.Rev)
+	}
+
+	alt, err := ioutil.ReadFile(filepath.Join(restored, "vcs-abc", ".git", "objects", "info", "alternates"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := filepath.Join(restored, "vcs-shared-abc", "objects")
+	if strings.TrimSpace(string(alt)) != exp {
+		t.Fatalf("expected alternates to point at %s, got %s", exp, alt)
+	}
+
+	rdb, err := meta.OpenReadOnly(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	searches, err := rdb.SavedSearches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(searches) != 1 || searches[0].Name != "todos" || searches[0].Params["q"] != "TODO" {
+		t.Fatalf("expected the saved search to be restored, got %+v", searches)
+	}
+	prefs, err := rdb.Preferences("jane")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefs == nil || len(prefs.Repos) != 1 || prefs.Repos[0] != "api" {
+		t.Fatalf("expected the preferences to be restored, got %+v", prefs)
+	}
+
+	if err := Restore(target, restored); err == nil {
+		t.Fatal("expected restore over an existing dbpath to fail")
+	}
+}
+
+func TestRestoreIncompleteBackup(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "hound-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := Restore(tmp, filepath.Join(tmp, "db")); err == nil {
+		t.Fatal("expected restore without a manifest to fail")
+	}
+}
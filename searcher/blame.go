@@ -0,0 +1,97 @@
+package searcher
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/hound-search/hound/vcs"
+)
+
+// The number of files whose blame is cached for each repo.
+const maxBlameFiles = 256
+
+// The blame of recently asked for lines, by revision and file. Blame
+// doesn't change for a revision, so nothing is ever stale; the oldest
+// files are dropped once there are too many.
+type blameCache struct {
+	lck   sync.Mutex
+	files map[string]map[int]*vcs.BlameLine
+	order []string
+}
+
+// The cached blame of lines of a file, and the lines that aren't cached.
+func (c *blameCache) get(key string, lines []int) ([]*vcs.BlameLine, []int) {
+	c.lck.Lock()
+	defer c.lck.Unlock()
+
+	var found []*vcs.BlameLine
+	var missing []int
+	for _, n := range lines {
+		if b := c.files[key][n]; b != nil {
+			found = append(found, b)
+		} else {
+			missing = append(missing, n)
+		}
+	}
+	return found, missing
+}
+
+func (c *blameCache) add(key string, lines []*vcs.BlameLine) {
+	c.lck.Lock()
+	defer c.lck.Unlock()
+
+	if c.files == nil {
+		c.files = map[string]map[int]*vcs.BlameLine{}
+	}
+
+	f := c.files[key]
+	if f == nil {
+		if len(c.order) >= maxBlameFiles {
+			delete(c.files, c.order[0])
+			c.order = c.order[1:]
+		}
+		f = map[int]*vcs.BlameLine{}
+		c.files[key] = f
+		c.order = append(c.order, key)
+	}
+
+	for _, b := range lines {
+		f[b.Line] = b
+	}
+}
+
+// Blame reports who last changed the given lines of a file as of rev, or
+// of the revision being served if rev is empty. It is worked out from the
+// clone of the repo the first time it is asked for, and cached.
+func (s *Searcher) Blame(path string, lines []int, rev string) ([]*vcs.BlameLine, error) {
+	if s.wd == nil {
+		return nil, vcs.ErrCannotBlame
+	}
+
+	if rev == "" {
+		rev = s.Ref().Rev
+		if rev == "" {
+			return nil, errRemoved
+		}
+	}
+
+	key := rev + "\x00" + path
+	res, missing := s.blames.get(key, lines)
+	if len(missing) > 0 {
+		more, err := s.wd.Blame(s.vcsDir, rev, path, missing)
+		if err != nil {
+			return nil, err
+		}
+		if len(more) != len(missing) {
+			return nil, errors.New("not every line could be blamed")
+		}
+		s.blames.add(key, more)
+		res = append(res, more...)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Line < res[j].Line
+	})
+	return res, nil
+}
@@ -0,0 +1,108 @@
+package searcher
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+)
+
+// The fewest files that a query of a canary has to match in the old
+// index to be compared, since the counts of rarer ones swing too much to
+// go by.
+const minCanaryMatches = 5
+
+// The names of files that make queries worth sampling, which are about
+// as long as an identifier has to be to stand for the file.
+var sampleName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{3,}$`)
+
+// CanaryError is the error of a new index that the canary of its repo
+// refused, leaving the old one to be served.
+type CanaryError struct {
+	// The revision that the refused index was built from.
+	Rev string
+
+	Reason string
+}
+
+func (e *CanaryError) Error() string {
+	return fmt.Sprintf("the index of %s was refused, %s", e.Rev, e.Reason)
+}
+
+// The queries that a canary compares the indexes with: its own, or else
+// the names of some of the files of the old index, as literals.
+func canaryQueries(c *config.Canary, old *index.Index) ([]string, error) {
+	if len(c.Queries) > 0 {
+		return c.Queries, nil
+	}
+
+	paths, err := old.SamplePaths(c.Samples)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []string
+	for _, p := range paths {
+		name := path.Base(p)
+		if i := strings.Index(name, "."); i > 0 {
+			name = name[:i]
+		}
+		if sampleName.MatchString(name) {
+			res = append(res, regexp.QuoteMeta(name))
+		}
+	}
+	return res, nil
+}
+
+// Whether a count went down by more than the share max of it.
+func shrunk(old, cur int, max float64) bool {
+	return old > 0 && float64(cur) < float64(old)*(1-max)
+}
+
+// Check a new index of rev against the old one that it is to replace,
+// refusing it if it has lost too many of the files of the old one or of
+// those that the queries of the canary match.
+func checkCanary(c *config.Canary, old, idx *index.Index, rev string) error {
+	o, err := old.NumFiles()
+	if err != nil {
+		return err
+	}
+	n, err := idx.NumFiles()
+	if err != nil {
+		return err
+	}
+	if shrunk(o, n, c.MaxShrink) {
+		return &CanaryError{Rev: rev, Reason: fmt.Sprintf("it has %d files, down from %d", n, o)}
+	}
+
+	qs, err := canaryQueries(c, old)
+	if err != nil {
+		return err
+	}
+
+	opt := &index.SearchOptions{IgnoreCase: true, Limit: 1}
+	for _, q := range qs {
+		o, err := old.Search(q, opt)
+		if err != nil {
+			return err
+		}
+		if o.FilesWithMatch < minCanaryMatches {
+			continue
+		}
+
+		n, err := idx.Search(q, opt)
+		if err != nil {
+			return err
+		}
+		if shrunk(o.FilesWithMatch, n.FilesWithMatch, c.MaxShrink) {
+			return &CanaryError{
+				Rev:    rev,
+				Reason: fmt.Sprintf("%s matches %d files, down from %d", q, n.FilesWithMatch, o.FilesWithMatch),
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package searcher
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hound-search/hound/config"
+)
+
+func TestCheckCanary(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "hound-canary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// ten files that call the handler, and then fewer of them.
+	write := func(src string, files, calls int) {
+		for i := 0; i < files; i++ {
+			data := "package app\n"
+			if i < calls {
+				data += "func init() { handler() }\n"
+			}
+			writeFile(t, filepath.Join(tmp, src, fmt.Sprintf("file%d.go", i)), data)
+		}
+	}
+	write("all", 10, 10)
+	write("same", 10, 10)
+	write("shrunk", 4, 4)
+	write("uncalled", 10, 2)
+
+	old := buildFunc(t, tmp, filepath.Join(tmp, "all"))("idx-old", "1")
+	defer old.Close()
+
+	c := &config.Canary{MaxShrink: 0.5, Queries: []string{"handler"}}
+	for _, test := range []struct {
+		src    string
+		reason string
+	}{
+		{"same", ""},
+		{"shrunk", "it has 4 files, down from 10"},
+		{"uncalled", "handler matches 2 files, down from 10"},
+	} {
+		idx := buildFunc(t, tmp, filepath.Join(tmp, test.src))("idx-"+test.src, "2")
+		defer idx.Close()
+
+		err := checkCanary(c, old, idx, "2")
+		var ce *CanaryError
+		switch {
+		case test.reason == "" && err != nil:
+			t.Fatalf("expected the index of %s to be served, got %s", test.src, err)
+		case test.reason != "" && (!errors.As(err, &ce) || ce.Reason != test.reason || ce.Rev != "2"):
+			t.Fatalf("expected the index of %s to be refused as %q, got %v", test.src, test.reason, err)
+		}
+	}
+}
+
+func TestCanaryQueries(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "hound-canary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	for _, name := range []string{"cmd/main.go", "lib/go.mod", "lib/parser.test.js", "lib/x.go"} {
+		writeFile(t, filepath.Join(src, name), "package app\n")
+	}
+	idx := buildFunc(t, tmp, src)("idx", "1")
+	defer idx.Close()
+
+	// names that are too short to stand for their files are left out.
+	qs, err := canaryQueries(&config.Canary{Samples: 10}, idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"main", "parser"}; !reflect.DeepEqual(qs, exp) {
+		t.Fatalf("expected the queries %v, got %v", exp, qs)
+	}
+
+	qs, err = canaryQueries(&config.Canary{Samples: 10, Queries: []string{"init"}}, idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(qs, ",") != "init" {
+		t.Fatalf("expected the queries of the canary, got %v", qs)
+	}
+}
@@ -0,0 +1,106 @@
+package searcher
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hound-search/hound/index"
+)
+
+// The extensions of markdown files.
+var markdownExts = map[string]bool{
+	".md":       true,
+	".markdown": true,
+	".mdown":    true,
+	".mkd":      true,
+	".mdx":      true,
+}
+
+var (
+	// lines that are only markup, like fences, rules, the separators
+	// under table headers and the definitions of reference links.
+	mdMarkupLine = regexp.MustCompile("^\\s*(```|~~~|([-*_]\\s*){3,}$|\\|?\\s*:?-{3,}:?\\s*(\\|\\s*:?-{3,}:?\\s*)*\\|?\\s*$|\\[[^\\]]+\\]:\\s)")
+
+	// the block markers at the start of a line: quotes, headings, list
+	// items and task boxes.
+	mdBlock = regexp.MustCompile(`^\s*(>\s?)*\s*(#{1,6}\s+|[-*+]\s+(\[[ xX]\]\s+)?|\d+[.)]\s+)?`)
+
+	// the closing hashes of a heading.
+	mdHeadingEnd = regexp.MustCompile(`\s+#+\s*$`)
+
+	mdImage    = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink     = regexp.MustCompile(`\[([^\]]+)\](\([^)]*\)|\[[^\]]*\])`)
+	mdAutolink = regexp.MustCompile(`<((https?|mailto|ftp):[^>\s]+)>`)
+	mdHTML     = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	mdCode     = regexp.MustCompile("`+([^`]+)`+")
+	mdStrong   = regexp.MustCompile(`(\*\*|__)(\S|\S.*?\S)(\*\*|__)`)
+	mdStrike   = regexp.MustCompile(`~~(\S|\S.*?\S)~~`)
+
+	// emphasis only counts away from words, so snake_case stays as is.
+	mdEm = regexp.MustCompile(`(^|[^\w*])[*_](\S|\S[^*_]*?\S)[*_]($|[^\w*])`)
+
+	// the cells of a table row.
+	mdCell = regexp.MustCompile(`\s*\|\s*`)
+)
+
+func isMarkdown(name string) bool {
+	return markdownExts[strings.ToLower(filepath.Ext(name))]
+}
+
+// Reduce a line of markdown to the text that it renders as, near enough
+// for an excerpt: the markup is taken out and links become their text.
+// Lines that are only markup become empty.
+func stripMarkdown(line string) string {
+	if mdMarkupLine.MatchString(line) {
+		return ""
+	}
+
+	heading := strings.HasPrefix(strings.TrimLeft(line, " >"), "#")
+	line = mdBlock.ReplaceAllString(line, "")
+	if heading {
+		line = mdHeadingEnd.ReplaceAllString(line, "")
+	}
+
+	if strings.HasPrefix(line, "|") || strings.HasSuffix(line, "|") {
+		line = strings.Trim(line, "| \t")
+		line = mdCell.ReplaceAllString(line, "   ")
+	}
+
+	line = mdImage.ReplaceAllString(line, "$1")
+	line = mdLink.ReplaceAllString(line, "$1")
+	line = mdAutolink.ReplaceAllString(line, "$1")
+	line = mdHTML.ReplaceAllString(line, "")
+	line = mdCode.ReplaceAllString(line, "$1")
+	line = mdStrong.ReplaceAllString(line, "$2")
+	line = mdStrike.ReplaceAllString(line, "$1")
+	// twice, as a match takes the space that the next one starts with.
+	line = mdEm.ReplaceAllString(line, "$1$2$3")
+	line = mdEm.ReplaceAllString(line, "$1$2$3")
+	return strings.TrimRight(line, " \t")
+}
+
+// Show the results in the markdown files of a docs repo as plain text.
+func (s *Searcher) docsExcerpts(res *index.SearchResponse) {
+	if res == nil || !s.Repo.DocsMode() {
+		return
+	}
+
+	strip := func(lines []string) {
+		for i, line := range lines {
+			lines[i] = stripMarkdown(line)
+		}
+	}
+
+	for _, fm := range res.Matches {
+		if !isMarkdown(fm.Filename) {
+			continue
+		}
+
+		for _, m := range fm.Matches {
+			m.Line = stripMarkdown(m.Line)
+			strip(m.Before)
+			strip(m.After)
+		}
+	}
+}
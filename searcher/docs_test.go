@@ -0,0 +1,47 @@
+package searcher
+
+import "testing"
+
+func TestStripMarkdown(t *testing.T) {
+	tests := []struct {
+		line, exp string
+	}{
+		{"plain text", "plain text"},
+		{"# Getting Started #", "Getting Started"},
+		{"### Install", "Install"},
+		{"> quoted **bold** text", "quoted bold text"},
+		{"- [x] done with `make`", "done with make"},
+		{"* item with *emphasis* and _more_", "item with emphasis and more"},
+		{"12. numbered", "numbered"},
+		{"see [the guide](docs/guide.md) or [that][ref]", "see the guide or that"},
+		{"![diagram](img/arch.png) below", "diagram below"},
+		{"<https://example.com> and <br/>html", "https://example.com and html"},
+		{"keep snake_case_names and 2*3*4", "keep snake_case_names and 2*3*4"},
+		{"~~gone~~ __strong__", "gone strong"},
+		{"| Name | Value |", "Name   Value"},
+		{"|------|:-----:|", ""},
+		{"```go", ""},
+		{"---", ""},
+		{"[ref]: https://example.com", ""},
+	}
+
+	for _, test := range tests {
+		if got := stripMarkdown(test.line); got != test.exp {
+			t.Errorf("%q: expected %q, got %q", test.line, test.exp, got)
+		}
+	}
+}
+
+func TestIsMarkdown(t *testing.T) {
+	for name, exp := range map[string]bool{
+		"README.md":           true,
+		"docs/Guide.MARKDOWN": true,
+		"page.mdx":            true,
+		"main.go":             false,
+		"md":                  false,
+	} {
+		if isMarkdown(name) != exp {
+			t.Errorf("%s: expected %t", name, exp)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package searcher
+
+import (
+	"expvar"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hound-search/hound/config"
+)
+
+var (
+	// The number of failures in a row of each repo that is failing, and
+	// the total number of failed updates, under /debug/vars.
+	repoFailures   = expvar.NewMap("hound_repo_failures")
+	updateFailures = expvar.NewInt("hound_update_failures_total")
+)
+
+// Tracks the failures of a repo's updates, spacing out retries with
+// exponential backoff and opening a circuit once it has failed too many
+// times in a row, so that a remote that keeps failing, e.g. because its
+// token was revoked, isn't hammered on every poll.
+type repoHealth struct {
+	lck sync.Mutex
+
+	name      string
+	base, max time.Duration
+	threshold int
+
+	failures    int
+	lastError   string
+	lastFailure time.Time
+	nextAttempt time.Time
+}
+
+func newRepoHealth(name string, repo *config.Repo) *repoHealth {
+	base := time.Duration(repo.MsBetweenPolls) * time.Millisecond
+	max := time.Duration(repo.MaxMsBetweenRetries) * time.Millisecond
+	if base <= 0 {
+		base = time.Minute
+	}
+	if max < base {
+		max = base
+	}
+
+	return &repoHealth{
+		name:      name,
+		base:      base,
+		max:       max,
+		threshold: repo.CircuitBreakerThreshold,
+	}
+}
+
+// Whether the circuit is open. The caller holds the lock.
+func (h *repoHealth) isOpen() bool {
+	return h.threshold > 0 && h.failures >= h.threshold
+}
+
+// Record a failed update and schedule the next attempt. It returns the
+// number of failures in a row.
+func (h *repoHealth) failed(err error, now time.Time) int {
+	h.lck.Lock()
+	defer h.lck.Unlock()
+
+	wasOpen := h.isOpen()
+	h.failures++
+	h.lastError = err.Error()
+	h.lastFailure = now
+
+	delay := h.max
+	if !h.isOpen() {
+		delay = h.base
+		for i := 1; i < h.failures && delay < h.max; i++ {
+			delay *= 2
+		}
+		if delay > h.max {
+			delay = h.max
+		}
+	}
+	h.nextAttempt = now.Add(delay)
+
+	repoFailures.Add(h.name, 1)
+	updateFailures.Add(1)
+
+	if h.isOpen() && !wasOpen {
+		log.Printf("Opening the circuit for %s after %d failures in a row, retrying every %s",
+			h.name, h.failures, h.max)
+	}
+
+	return h.failures
+}
+
+// Record a successful update, closing the circuit.
+func (h *repoHealth) succeeded() {
+	h.lck.Lock()
+	defer h.lck.Unlock()
+
+	if h.failures == 0 {
+		return
+	}
+
+	if h.isOpen() {
+		log.Printf("Closing the circuit for %s", h.name)
+	}
+
+	h.failures = 0
+	h.lastError = ""
+	h.nextAttempt = time.Time{}
+	repoFailures.Delete(h.name)
+}
+
+// Stop reporting the failures of a repo that is no longer being served.
+func (h *repoHealth) forget() {
+	repoFailures.Delete(h.name)
+}
+
+// How long to wait before the next update. Healthy repos wait for delay,
+// the poll interval, while failing ones wait until they are due a retry.
+func (h *repoHealth) wait(delay time.Duration, now time.Time) time.Duration {
+	h.lck.Lock()
+	defer h.lck.Unlock()
+
+	if h.failures == 0 {
+		return delay
+	}
+
+	if d := h.nextAttempt.Sub(now); d > 0 {
+		return d
+	}
+
+	// wake up right away, a zero delay would wait forever.
+	return time.Nanosecond
+}
+
+// Whether an update is allowed now. While a repo is backing off, requests
+// for updates, e.g. from webhooks, are ignored until it is due a retry.
+func (h *repoHealth) due(now time.Time) bool {
+	h.lck.Lock()
+	defer h.lck.Unlock()
+	return h.failures == 0 || !now.Before(h.nextAttempt)
+}
+
+// Add the failures of the repo to its status.
+func (h *repoHealth) report(st *RepoStatus) {
+	h.lck.Lock()
+	defer h.lck.Unlock()
+
+	if h.failures == 0 {
+		return
+	}
+
+	last, next := h.lastFailure, h.nextAttempt
+	st.Error = h.lastError
+	st.Failures = h.failures
+	st.LastFailure = &last
+	st.NextAttempt = &next
+	st.CircuitOpen = h.isOpen()
+}
@@ -0,0 +1,93 @@
+package searcher
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hound-search/hound/config"
+)
+
+func TestRepoHealthBackoff(t *testing.T) {
+	h := newRepoHealth("backoff", &config.Repo{
+		MsBetweenPolls:          1000,
+		MaxMsBetweenRetries:     5000,
+		CircuitBreakerThreshold: 4,
+	})
+
+	now := time.Now()
+	if d := h.wait(time.Second, now); d != time.Second {
+		t.Fatalf("expected a healthy repo to wait for the poll interval, got %s", d)
+	}
+
+	// 1s, 2s, 4s and then the circuit opens at the 5s maximum.
+	for i, exp := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		h.failed(errors.New("fetch failed"), now)
+		if d := h.wait(time.Second, now); d != exp {
+			t.Fatalf("failure %d: expected to wait %s, got %s", i+1, exp, d)
+		}
+		if h.due(now) {
+			t.Fatalf("failure %d: expected the repo not to be due", i+1)
+		}
+	}
+
+	var st RepoStatus
+	h.report(&st)
+	if !st.CircuitOpen || st.Failures != 5 || st.Error != "fetch failed" {
+		t.Fatalf("expected an open circuit after 5 failures, got %+v", st)
+	}
+
+	if !h.due(now.Add(5 * time.Second)) {
+		t.Fatal("expected the repo to be due once it has backed off")
+	}
+
+	h.succeeded()
+	st = RepoStatus{}
+	h.report(&st)
+	if st.CircuitOpen || st.Failures != 0 || !h.due(now) {
+		t.Fatalf("expected a success to close the circuit, got %+v", st)
+	}
+}
+
+// Tests that a repo that fails to index is tried again.
+func TestSetRetriesFailedRepo(t *testing.T) {
+	src, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	db, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(db)
+
+	url := filepath.Join(src, "later")
+	set := NewSet(&config.Config{DbPath: db}, map[string]*Searcher{})
+	if err := set.Add("later", &config.Repo{URL: url, MsBetweenPolls: 200}); err != nil {
+		t.Fatal(err)
+	}
+
+	st := waitForState(t, set, "later")
+	if st.State != StateFailed || st.Failures < 1 || st.NextAttempt == nil {
+		t.Fatalf("expected the repo to fail, got %+v", st)
+	}
+
+	// once the remote is there, the retry succeeds.
+	if err := os.Mkdir(url, 0755); err != nil {
+		t.Fatal(err)
+	}
+	makeGitRepo(t, url)
+
+	for i := 0; i < 100 && set.Get("later") == nil; i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if set.Get("later") == nil {
+		t.Fatalf("expected the repo to be retried, got %+v", set.Status()["later"])
+	}
+	set.Stop()
+}
@@ -0,0 +1,129 @@
+package searcher
+
+import (
+	"log"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/embed"
+	"github.com/hound-search/hound/store"
+)
+
+// IndexAll brings the index of every repo in the config up to date and
+// publishes it to the index store, if there is one, without serving
+// anything. Indexes in the dbpath that are still current are reused and
+// the rest are removed, as at startup. Like MakeAll, it only returns an
+// error if nothing could be done, and otherwise reports each repo that
+// couldn't be indexed in the map.
+func IndexAll(cfg *config.Config) (map[string]error, error) {
+	refs, err := findExistingRefs(cfg.DbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := openIndexStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	emb, err := embed.New(cfg.Embeddings, cfg.Proxy.Client())
+	if err != nil {
+		return nil, err
+	}
+
+	lim := makeLimiter(cfg.MaxConcurrentIndexers)
+	thr := newThrottles(cfg)
+	defer thr.close()
+	shared := findSharedRemotes(cfg)
+
+	resultCh := make(chan searcherResult, len(cfg.Repos))
+	for name, repo := range cfg.Repos {
+		go func(name string, repo *config.Repo) {
+			lim.Acquire()
+			defer lim.Release()
+
+			resultCh <- searcherResult{
+				name: name,
+				err:  indexOne(cfg.DbPath, name, repo, shared[repo.URL], st, refs, thr, emb),
+			}
+		}(name, repo)
+	}
+
+	errs := map[string]error{}
+	for range cfg.Repos {
+		r := <-resultCh
+		if r.err != nil {
+			log.Printf("failed to index %s: %s", r.name, r.err)
+			errs[r.name] = r.err
+		}
+	}
+
+	if err := refs.removeUnclaimed(); err != nil {
+		return nil, err
+	}
+
+	return errs, nil
+}
+
+// Pull a repo and index it, unless the index of its head is already in
+// the dbpath or has already been published.
+func indexOne(
+	dbpath, name string,
+	repo *config.Repo,
+	shared bool,
+	st store.Store,
+	refs *foundRefs,
+	thr *throttles,
+	emb *embed.Model) error {
+
+	wd, vcsDir, opt, err := openWorkDir(dbpath, name, repo, shared, thr, emb)
+	if err != nil {
+		return err
+	}
+
+	rev, err := wd.PullOrClone(vcsDir, repo.URL)
+	if err != nil {
+		return err
+	}
+
+	if st != nil {
+		si, err := latestStoredIndex(st, name, repo)
+		if err != nil && err != store.ErrNotFound {
+			return err
+		}
+
+		if si != nil && si.Rev == rev {
+			// keep the local copy, if there is one, for when we serve.
+			if ref := refs.find(repo.URL, rev); ref != nil {
+				refs.claim(ref)
+			}
+			log.Printf("%s is already published at %s", name, rev)
+			return nil
+		}
+	}
+
+	idxDir := nextIndexDir(dbpath)
+	if ref := refs.find(repo.URL, rev); ref != nil {
+		idxDir = ref.Dir()
+		refs.claim(ref)
+	} else if p := refs.claimPartial(repo.URL, rev); p != nil {
+		idxDir = p.Dir()
+	}
+
+	idx, err := buildAndOpenIndex(opt, dbpath, vcsDir, idxDir, repo.URL, rev)
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+
+	if st == nil {
+		log.Printf("Indexed %s at %s", name, rev)
+		return nil
+	}
+
+	if err := publishIndex(st, name, repo, idx, wd.Ref()); err != nil {
+		return err
+	}
+
+	log.Printf("Published index of %s at %s", name, rev)
+	return nil
+}
@@ -0,0 +1,73 @@
+package searcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hound-search/hound/config"
+)
+
+func TestIndexAll(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	makeGitRepo(t, src)
+
+	storeCfg := config.SecretMessage(`{"path": "` + filepath.ToSlash(filepath.Join(tmp, "store")) + `"}`)
+	cfg := &config.Config{
+		DbPath:                  filepath.Join(tmp, "db"),
+		MaxConcurrentIndexers:   2,
+		IndexStore:              "file",
+		IndexStoreConfigMessage: &storeCfg,
+		Repos: map[string]*config.Repo{
+			"good": {URL: src},
+			"bad":  {URL: filepath.Join(tmp, "missing")},
+		},
+	}
+	for _, repo := range cfg.Repos {
+		cfg.InitRepo(repo)
+	}
+	if err := os.MkdirAll(cfg.DbPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	errs, err := IndexAll(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || errs["bad"] == nil {
+		t.Fatalf("expected only bad to fail, got %v", errs)
+	}
+
+	st, err := openIndexStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	si, err := latestStoredIndex(st, "good", cfg.Repos["good"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a second run finds it already published and keeps the local index.
+	delete(cfg.Repos, "bad")
+	if errs, err := IndexAll(cfg); err != nil || len(errs) != 0 {
+		t.Fatalf("expected the second run to succeed, got %v %v", err, errs)
+	}
+
+	refs, err := findExistingRefs(cfg.DbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs.refs) != 1 || refs.find(src, si.Rev) == nil {
+		t.Fatalf("expected the index of %s in the dbpath", si.Rev)
+	}
+}
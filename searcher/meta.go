@@ -0,0 +1,122 @@
+package searcher
+
+import (
+	"log"
+	"time"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/meta"
+)
+
+// Record the index that a searcher is serving, along with the generations
+// it keeps, and that the repo is no longer failing. took is how long it
+// took to build the index, or zero if it was already built, in which case
+// the time that it took before is kept.
+func (s *Searcher) recordIndex(name string, took time.Duration) {
+	ref := s.Ref()
+	gens := s.Generations()
+
+	err := s.meta.UpdateRepo(name, func(r *meta.Repo) bool {
+		if took > 0 || r.IndexDir != ref.Dir() {
+			r.IndexMs = int64(took / time.Millisecond)
+		}
+
+		if r.Rev != ref.Rev || r.ChangedAt.IsZero() {
+			r.ChangedAt = ref.Time
+		}
+
+		r.URL = s.Repo.URL
+		r.Rev = ref.Rev
+		r.IndexDir = ref.Dir()
+		r.IndexedAt = ref.Time
+
+		r.Generations = nil
+		for i := 1; i < len(gens); i++ {
+			g := gens[i]
+			r.Generations = append(r.Generations, &meta.Generation{
+				Rev:       g.Rev,
+				IndexDir:  g.Dir(),
+				IndexedAt: g.Time,
+			})
+		}
+
+		r.Failures, r.LastError, r.LastFailure, r.FailingSince = 0, "", time.Time{}, time.Time{}
+		return true
+	})
+	if err != nil {
+		log.Printf("failed to record the index of %s: %s", name, err)
+	}
+}
+
+// Record that an update of a repo failed, for the nth time in a row.
+func recordFailure(db *meta.DB, name, url string, failure error, n int, now time.Time) {
+	err := db.UpdateRepo(name, func(r *meta.Repo) bool {
+		r.URL = url
+		if r.Failures == 0 || r.FailingSince.IsZero() {
+			r.FailingSince = now
+		}
+		r.Failures, r.LastError, r.LastFailure = n, failure.Error(), now
+		return true
+	})
+	if err != nil {
+		log.Printf("failed to record the failure of %s: %s", name, err)
+	}
+}
+
+// Record that an update of a repo succeeded without changing its index.
+// Nothing is written unless it had been failing.
+func (s *Searcher) recordSuccess(name string) {
+	err := s.meta.UpdateRepo(name, func(r *meta.Repo) bool {
+		if r.Failures == 0 {
+			return false
+		}
+		r.Failures, r.LastError, r.LastFailure, r.FailingSince = 0, "", time.Time{}, time.Time{}
+		return true
+	})
+	if err != nil {
+		log.Printf("failed to record the update of %s: %s", name, err)
+	}
+}
+
+// Claim the indexes of other revisions of a repo url that are in dirs, up
+// to n of them in the order of dirs. This is how the generations of repos
+// that share a remote, whose indexes can't be told apart by their url,
+// are kept after a restart.
+func (r *foundRefs) claimDirs(url, rev string, dirs []string, n int) []*index.IndexRef {
+	if n <= 0 {
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var res []*index.IndexRef
+	for _, dir := range dirs {
+		for _, ref := range r.refs {
+			if len(res) < n && ref.Dir() == dir && ref.Url == url && ref.Rev != rev && !r.claimed[ref] {
+				r.claimed[ref] = true
+				res = append(res, ref)
+			}
+		}
+	}
+	return res
+}
+
+// Forget the repos that are no longer in the config, whose indexes were
+// removed along with the others that weren't claimed at startup.
+func forgetRemoved(db *meta.DB, cfg *config.Config) error {
+	recs, err := db.Repos()
+	if err != nil {
+		return err
+	}
+
+	for name := range recs {
+		if cfg.Repos[name] == nil {
+			if err := db.RemoveRepo(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package searcher
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/hound-search/hound/config"
+)
+
+// Adaptive polls wait for this fraction of the time since the repo last
+// changed, so a repo that hasn't changed for an hour polls every 6
+// minutes.
+const adaptivePollDivisor = 10
+
+// Decides when a repo polls next. The polls of every repo are moved by a
+// random amount so that hundreds of repos with the same interval don't
+// fetch at the same moment, and with adaptive polling a repo that hasn't
+// changed in a long time polls less often until it changes again.
+type pollSchedule struct {
+	base, max time.Duration
+	jitter    float64
+	adaptive  bool
+
+	// When the repo last had a new revision.
+	lastChange time.Time
+
+	// A random number in [0, 1).
+	rnd func() float64
+}
+
+func newPollSchedule(repo *config.Repo, lastChange time.Time) *pollSchedule {
+	base := time.Duration(repo.MsBetweenPolls) * time.Millisecond
+	max := time.Duration(repo.MaxMsBetweenPolls) * time.Millisecond
+	if max < base {
+		max = base
+	}
+
+	var jitter float64
+	if repo.PollJitter != nil {
+		jitter = *repo.PollJitter
+	}
+	if jitter < 0 {
+		jitter = 0
+	} else if jitter > 1 {
+		jitter = 1
+	}
+
+	if lastChange.IsZero() {
+		lastChange = time.Now()
+	}
+
+	return &pollSchedule{
+		base:       base,
+		max:        max,
+		jitter:     jitter,
+		adaptive:   repo.AdaptivePollingEnabled(),
+		lastChange: lastChange,
+		rnd:        rand.Float64,
+	}
+}
+
+// Record that the repo had a new revision, which brings an adaptive
+// interval back down to the poll interval.
+func (p *pollSchedule) changed(now time.Time) {
+	p.lastChange = now
+}
+
+// The interval before the next poll, before the jitter.
+func (p *pollSchedule) interval(now time.Time) time.Duration {
+	if !p.adaptive {
+		return p.base
+	}
+
+	d := now.Sub(p.lastChange) / adaptivePollDivisor
+	if d < p.base {
+		return p.base
+	}
+	if d > p.max {
+		return p.max
+	}
+	return d
+}
+
+// How long to wait before the next poll.
+func (p *pollSchedule) next(now time.Time) time.Duration {
+	d := p.interval(now)
+	if p.jitter == 0 || d <= 0 {
+		return d
+	}
+
+	// anywhere from (1 - jitter) to (1 + jitter) of the interval.
+	f := 1 + p.jitter*(2*p.rnd()-1)
+	if j := time.Duration(float64(d) * f); j > 0 {
+		return j
+	}
+	return time.Nanosecond
+}
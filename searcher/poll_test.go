@@ -0,0 +1,68 @@
+package searcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hound-search/hound/config"
+)
+
+func TestPollJitter(t *testing.T) {
+	jitter := 0.2
+	p := newPollSchedule(&config.Repo{
+		MsBetweenPolls: 10000,
+		PollJitter:     &jitter,
+	}, time.Now())
+
+	now := time.Now()
+	for _, c := range []struct {
+		rnd float64
+		exp time.Duration
+	}{
+		{0, 8 * time.Second},
+		{0.5, 10 * time.Second},
+		{0.75, 11 * time.Second},
+	} {
+		p.rnd = func() float64 { return c.rnd }
+		if d := p.next(now); d != c.exp {
+			t.Fatalf("with %f: expected to wait %s, got %s", c.rnd, c.exp, d)
+		}
+	}
+}
+
+func TestAdaptivePolling(t *testing.T) {
+	adaptive := true
+	jitter := 0.0
+	now := time.Now()
+	p := newPollSchedule(&config.Repo{
+		MsBetweenPolls:    30000,
+		MaxMsBetweenPolls: 600000,
+		AdaptivePolling:   &adaptive,
+		PollJitter:        &jitter,
+	}, now)
+
+	for _, c := range []struct {
+		since time.Duration
+		exp   time.Duration
+	}{
+		{time.Minute, 30 * time.Second},
+		{time.Hour, 6 * time.Minute},
+		{24 * time.Hour, 10 * time.Minute},
+	} {
+		if d := p.next(now.Add(c.since)); d != c.exp {
+			t.Fatalf("unchanged for %s: expected to wait %s, got %s", c.since, c.exp, d)
+		}
+	}
+
+	// a change brings it right back to the poll interval.
+	p.changed(now.Add(24 * time.Hour))
+	if d := p.next(now.Add(24*time.Hour + time.Second)); d != 30*time.Second {
+		t.Fatalf("expected to wait 30s after a change, got %s", d)
+	}
+
+	// without adaptive polling it is always the poll interval.
+	p.adaptive = false
+	if d := p.next(now.Add(48 * time.Hour)); d != 30*time.Second {
+		t.Fatalf("expected to wait 30s, got %s", d)
+	}
+}
@@ -0,0 +1,145 @@
+package searcher
+
+import (
+	"log"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// The reasons that a repo is flagged in a health report.
+const (
+	// The repo has failed to index for longer than the report allows.
+	FlagFailing = "failing"
+
+	// Nothing has changed in the repo for longer than the report allows.
+	FlagUnchanged = "unchanged"
+
+	// The remote says that the repo doesn't exist.
+	FlagNotFound = "not-found"
+)
+
+// How much each flag takes off the score of a repo, out of 100.
+var flagWeights = map[string]int{
+	FlagNotFound:  60,
+	FlagFailing:   40,
+	FlagUnchanged: 20,
+}
+
+// What the errors of the vcs commands say when the remote doesn't have
+// the repo, or no longer lets us see it.
+var notFoundError = regexp.MustCompile(`(?i)repository (\S+ )?not found|returned error: 404|does not appear to be a git repository|repository \S+ does not exist`)
+
+// The thresholds of a health report. The defaults are a week of failures
+// and a year without changes.
+type HealthOptions struct {
+	FailingFor   time.Duration
+	UnchangedFor time.Duration
+}
+
+const (
+	defaultFailingFor   = 7 * 24 * time.Hour
+	defaultUnchangedFor = 365 * 24 * time.Hour
+)
+
+// RepoHealth is how healthy a repo of the set looks, for finding the
+// dead entries of the config.
+type RepoHealth struct {
+	State string
+	URL   string
+
+	// From 100 for a repo that nothing is wrong with down to 0, along
+	// with the reasons that it is lower.
+	Score int
+	Flags []string `json:",omitempty"`
+
+	// When the repo started failing, and why it failed last.
+	FailingSince *time.Time `json:",omitempty"`
+	LastError    string     `json:",omitempty"`
+
+	// When the repo last changed: the newest commit of its files if their
+	// commits are recorded, or else when hound last saw its revision
+	// change.
+	LastChange *time.Time `json:",omitempty"`
+}
+
+func (h *RepoHealth) flag(f string) {
+	h.Flags = append(h.Flags, f)
+	h.Score -= flagWeights[f]
+	if h.Score < 0 {
+		h.Score = 0
+	}
+}
+
+// Whether the error of a failed update says that the remote doesn't have
+// the repo.
+func remoteNotFound(msg string) bool {
+	return notFoundError.MatchString(msg)
+}
+
+// Health scores every repo of the set, disabled ones included, flagging
+// the ones that have failed for too long, that haven't changed for too
+// long or whose remote no longer has them.
+func (s *Set) Health(opt HealthOptions, now time.Time) map[string]*RepoHealth {
+	if opt.FailingFor <= 0 {
+		opt.FailingFor = defaultFailingFor
+	}
+	if opt.UnchangedFor <= 0 {
+		opt.UnchangedFor = defaultUnchangedFor
+	}
+
+	status := s.Status()
+
+	recs, err := s.meta.Repos()
+	if err != nil {
+		log.Printf("failed to read the records of the repos: %s", err)
+	}
+
+	all := s.All()
+
+	res := map[string]*RepoHealth{}
+	for name, st := range status {
+		h := &RepoHealth{
+			State:     st.State,
+			URL:       st.URL,
+			Score:     100,
+			LastError: st.Error,
+		}
+
+		rec := recs[name]
+		if rec != nil {
+			if h.LastError == "" {
+				h.LastError = rec.LastError
+			}
+			if !rec.FailingSince.IsZero() {
+				t := rec.FailingSince
+				h.FailingSince = &t
+			}
+		}
+
+		var changed time.Time
+		if srch := all[name]; srch != nil {
+			changed = srch.LastCommit()
+		}
+		if changed.IsZero() && rec != nil {
+			changed = rec.ChangedAt
+		}
+		if !changed.IsZero() {
+			h.LastChange = &changed
+		}
+
+		if h.LastError != "" && remoteNotFound(h.LastError) {
+			h.flag(FlagNotFound)
+		}
+		if h.FailingSince != nil && now.Sub(*h.FailingSince) >= opt.FailingFor {
+			h.flag(FlagFailing)
+		}
+		if h.LastChange != nil && now.Sub(*h.LastChange) >= opt.UnchangedFor {
+			h.flag(FlagUnchanged)
+		}
+		sort.Strings(h.Flags)
+
+		res[name] = h
+	}
+	return res
+}
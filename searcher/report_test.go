@@ -0,0 +1,117 @@
+package searcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/meta"
+)
+
+func TestRemoteNotFound(t *testing.T) {
+	tests := map[string]bool{
+		"remote: Repository not found.\nfatal: repository 'https://github.com/a/b/' not found": true,
+		"fatal: repository '/tmp/missing' does not exist":                                      true,
+		"fatal: unable to access 'https://x/a.git/': The requested URL returned error: 404":    true,
+		"fatal: 'origin' does not appear to be a git repository":                               true,
+		"fatal: unable to access 'https://x/a.git/': Could not resolve host: x":                false,
+		`exec: "git": executable file not found in $PATH`:                                      false,
+	}
+	for msg, exp := range tests {
+		if got := remoteNotFound(msg); got != exp {
+			t.Errorf("%q: expected %v, got %v", msg, exp, got)
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	src, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	makeGitRepo(t, src)
+
+	dbpath, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbpath)
+
+	db, err := meta.Open(dbpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := NewSet(&config.Config{DbPath: dbpath}, map[string]*Searcher{})
+	set.meta = db
+	defer set.Stop()
+
+	if err := set.Add("a", &config.Repo{URL: src}); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Add("bad", &config.Repo{URL: filepath.Join(src, "missing")}); err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, set, "a")
+	waitForState(t, set, "bad")
+
+	flags := func(now time.Time) map[string][]string {
+		res := map[string][]string{}
+		for name, h := range set.Health(HealthOptions{}, now) {
+			res[name] = h.Flags
+		}
+		return res
+	}
+
+	if got, exp := flags(time.Now()), map[string][]string{"a": nil, "bad": {FlagNotFound}}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	later := time.Now().Add(2 * 365 * 24 * time.Hour)
+	if got, exp := flags(later), map[string][]string{"a": {FlagUnchanged}, "bad": {FlagFailing, FlagNotFound}}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if h := set.Health(HealthOptions{}, later)["bad"]; h.Score != 0 || h.FailingSince == nil {
+		t.Fatalf("expected bad to score 0, got %+v", h)
+	}
+
+	// a disabled repo is kept, and stays disabled across restarts.
+	for _, name := range []string{"a", "bad"} {
+		if err := set.Disable(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if set.Get("a") != nil || set.State("a") != StateDisabled {
+		t.Fatalf("expected a to be disabled, got %s", set.State("a"))
+	}
+	if h := set.Health(HealthOptions{}, time.Now())["bad"]; h == nil || h.State != StateDisabled {
+		t.Fatalf("expected bad to be reported as disabled, got %+v", h)
+	}
+	if rec, err := db.Repo("bad"); err != nil || rec == nil || !rec.Disabled {
+		t.Fatalf("expected bad to be recorded as disabled, got %+v, %v", rec, err)
+	}
+
+	if err := set.Enable("a"); err != nil {
+		t.Fatal(err)
+	}
+	if st := waitForState(t, set, "a"); st.State != StateReady {
+		t.Fatalf("expected a to be served again, got %+v", st)
+	}
+	if rec, err := db.Repo("a"); err != nil || rec == nil || rec.Disabled {
+		t.Fatalf("expected a to be recorded as enabled, got %+v, %v", rec, err)
+	}
+	if err := set.Enable("a"); err == nil {
+		t.Fatal("expected enabling a repo that isn't disabled to fail")
+	}
+
+	if err := set.Remove("bad"); err != nil {
+		t.Fatal(err)
+	}
+	if rec, err := db.Repo("bad"); err != nil || rec != nil {
+		t.Fatalf("expected bad to be forgotten, got %+v, %v", rec, err)
+	}
+}
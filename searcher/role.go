@@ -0,0 +1,125 @@
+package searcher
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/leader"
+	"github.com/hound-search/hound/store"
+)
+
+// Role decides which part of the work a houndd process takes on. Running
+// indexers and searchers separately lets the searchers scale out without
+// each of them cloning and indexing every repo.
+type Role string
+
+const (
+	// Clone, index and serve searches. This is the default.
+	RoleAll Role = "all"
+
+	// Clone and index, publishing every build to the index store.
+	RoleIndexer Role = "indexer"
+
+	// Only serve indexes that indexers have published to the index
+	// store, picking up each new generation as latest.json moves.
+	RoleSearcher Role = "searcher"
+)
+
+// How long a searcher waits at startup for an indexer to publish the
+// first index of a repo before giving up on it.
+const maxPublishWait = 30 * time.Minute
+
+// ParseRole checks that s names a known role.
+func ParseRole(s string) (Role, error) {
+	switch r := Role(s); r {
+	case RoleAll, RoleIndexer, RoleSearcher:
+		return r, nil
+	case "":
+		return RoleAll, nil
+	}
+	return "", fmt.Errorf("unknown role %q, expected all, indexer or searcher", s)
+}
+
+// Decide the role of each round of work. With leader election, replicas
+// in the all role index while they hold the lease and otherwise serve
+// what the leader publishes, as searchers do.
+func electRole(cfg *config.Config, role Role) (func() Role, error) {
+	if cfg.LeaderElection == "" || role != RoleAll {
+		return func() Role { return role }, nil
+	}
+
+	el, err := leader.New(cfg.LeaderElection, cfg.LeaderElectionConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	return func() Role {
+		if el.IsLeader() {
+			return RoleIndexer
+		}
+		return RoleSearcher
+	}, nil
+}
+
+// Fetch the latest published index, waiting for one to show up if an
+// indexer hasn't gotten to this repo yet. If this replica stops being a
+// searcher while it waits, store.ErrNotFound is returned so that it
+// builds the index itself. The caller holds a token of lim, which it gives
+// back while it waits so that other repos can be indexed meanwhile.
+func waitForIndex(
+	st store.Store,
+	dbpath, name string,
+	repo *config.Repo,
+	refs *foundRefs,
+	lim limiter,
+	role func() Role) (*index.Index, *storedIndex, error) {
+	delay := time.Duration(repo.MsBetweenPolls) * time.Millisecond
+	deadline := time.Now().Add(maxPublishWait)
+	for {
+		idx, si, err := fetchIndex(st, dbpath, name, repo, refs)
+		if err != store.ErrNotFound || role() != RoleSearcher {
+			return idx, si, err
+		}
+
+		if time.Now().After(deadline) {
+			return nil, nil, fmt.Errorf("no index of %s was published within %s", name, maxPublishWait)
+		}
+
+		log.Printf("Waiting for an indexer to publish %s", name)
+		lim.Release()
+		time.Sleep(delay)
+		lim.Acquire()
+	}
+}
+
+// Swap in the latest published index if it differs from rev.
+func updateFromStore(s *Searcher, dbpath, name, rev string, lim limiter) (string, bool, error) {
+	// acquire a token from the rate limiter
+	lim.Acquire()
+	defer lim.Release()
+
+	si, err := latestStoredIndex(s.indexStore, name, s.Repo)
+	if err != nil {
+		log.Printf("index store error (%s): %s", name, err)
+		return rev, false, err
+	}
+
+	if si.Rev == rev {
+		return rev, false, nil
+	}
+
+	log.Printf("Loading published index of %s at %s", name, si.Rev)
+	idx, err := downloadIndex(s.indexStore, dbpath, name, s.Repo, si.Rev)
+	if err != nil {
+		log.Printf("failed to fetch index (%s): %s", name, err)
+		return rev, false, err
+	}
+	loadIntoMemory(name, s.Repo, idx)
+
+	s.swapIndexes(idx, si.Branch)
+
+	return si.Rev, true, nil
+}
@@ -1,35 +1,98 @@
 package searcher
 
 import (
+	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/embed"
 	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/meta"
+	"github.com/hound-search/hound/notify"
+	"github.com/hound-search/hound/reqid"
+	"github.com/hound-search/hound/store"
 	"github.com/hound-search/hound/vcs"
 )
 
+// The branch used in links for repos whose driver cannot tell us which
+// ref it is indexing.
+const defaultBranch = "master"
+
+// Returned by searches of a repo that has been removed.
+var errRemoved = errors.New("the repository has been removed")
+
 type Searcher struct {
 	idx  *index.Index
 	lck  sync.RWMutex
 	Repo *config.Repo
 
+	// The ref that idx was built from, which the links to its files point
+	// at.
+	branch string
+
+	// The searches that are using idx. When a new index is swapped in,
+	// the old one is only destroyed once they are done with it.
+	inUse *sync.WaitGroup
+
+	// The indexes of earlier revisions that are kept, newest first, up to
+	// the keep-generations of the repo.
+	retained []*generation
+
 	// The channel is used to request updates from the API and
 	// to signal that it is ok for searchers to begin polling.
 	// It has a buffer size of 1 to allow at most one pending
 	// update at a time.
 	updateCh chan time.Time
 
-	shutdownRequested bool
+	// Rebuilt indexes are published here, if it is set.
+	indexStore store.Store
+
+	// Set to make the next update rebuild the index even if the repo has
+	// not changed.
+	force int32
+
+	// Set to serve the next index that is built even if the canary of the
+	// repo would refuse it.
+	skipCanary int32
+
+	// When a search last took one of the indexes, in unix nanoseconds,
+	// which says when the indexes of the archive tier are idle.
+	lastUsed int64
+
+	// The id of the API request that asked for the next update, if one
+	// did, which the update is logged and notified under.
+	requestID atomic.Value
+
+	// The failures of recent updates, which space out the next ones.
+	health *repoHealth
+
+	// Told about new indexes and failed updates, if it is set.
+	events *notify.Notifier
+
+	// Where the indexes and failures of the repo are recorded.
+	meta *meta.DB
+
+	// The clone of the repo, for blaming the lines of results.
+	wd     *vcs.WorkDir
+	vcsDir string
+	blames blameCache
+
+	shutdownRequested int32
 	shutdownCh        chan empty
 	doneCh            chan empty
 }
@@ -54,6 +117,15 @@ type foundRefs struct {
 	refs    []*index.IndexRef
 	claimed map[*index.IndexRef]bool
 	lock    sync.Mutex
+
+	// the refs of the builds that were cut short, which can be resumed.
+	partial []*partialBuild
+}
+
+// A build of the index of a repo url at rev that was cut short.
+type partialBuild struct {
+	ref      *index.IndexRef
+	url, rev string
 }
 
 func makeLimiter(n int) limiter {
@@ -81,6 +153,22 @@ func (r *foundRefs) find(url, rev string) *index.IndexRef {
 	return nil
 }
 
+// Claim the build of the index of the repo url at rev that was cut short,
+// to resume it in its dir. It returns nil if there is none, or if another
+// repo has already claimed it, since only one build can go on in a dir.
+func (r *foundRefs) claimPartial(url, rev string) *index.IndexRef {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, p := range r.partial {
+		if p.url == url && p.rev == rev && !r.claimed[p.ref] {
+			r.claimed[p.ref] = true
+			return p.ref
+		}
+	}
+	return nil
+}
+
 /**
  * Claim a ref for reuse. This ensures they ref will not be garbage
  * collected at the end of startup.
@@ -92,6 +180,36 @@ func (r *foundRefs) claim(ref *index.IndexRef) {
 	r.claimed[ref] = true
 }
 
+// Claim the indexes of other revisions of a repo url, up to n of them
+// with the newest first, so that earlier generations kept before a restart are kept on.
+func (r *foundRefs) claimOlder(url, rev string, n int) []*index.IndexRef {
+	if n <= 0 {
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var older []*index.IndexRef
+	for _, ref := range r.refs {
+		if ref.Url == url && ref.Rev != rev && !r.claimed[ref] {
+			older = append(older, ref)
+		}
+	}
+
+	sort.Slice(older, func(i, j int) bool {
+		return older[i].Time.After(older[j].Time)
+	})
+	if len(older) > n {
+		older = older[:n]
+	}
+
+	for _, ref := range older {
+		r.claimed[ref] = true
+	}
+	return older
+}
+
 /**
  * Delete the directorires associated with all IndexRefs that were
  * found in the dbpath but were not claimed during startup.
@@ -112,16 +230,183 @@ func (r *foundRefs) removeUnclaimed() error {
 	return nil
 }
 
+// Move the whole index onto the heap for repos configured to be served
+// from memory. If that fails the index keeps being read from disk.
+func loadIntoMemory(name string, repo *config.Repo, idx *index.Index) {
+	if !repo.InMemory {
+		return
+	}
+
+	size, err := idx.LoadIntoMemory()
+	if err != nil {
+		log.Printf("failed to load index into memory (%s): %s", name, err)
+		return
+	}
+	log.Printf("Loaded index of %s into memory (%d bytes of files)", name, size)
+}
+
+// An index that is no longer the latest, and the searches using it.
+type generation struct {
+	idx   *index.Index
+	inUse *sync.WaitGroup
+}
+
 // Perform atomic swap of index in the searcher so that the new
-// index is made "live".
-func (s *Searcher) swapIndexes(idx *index.Index) error {
+// index, built from branch, is made "live". Searches that started on the
+// old index finish on it. Unless it is kept as an earlier generation, it
+// is destroyed in the background once they have, as are generations past
+// the ones kept.
+func (s *Searcher) swapIndexes(idx *index.Index, branch string) {
 	s.lck.Lock()
-	defer s.lck.Unlock()
+	old := &generation{s.idx, s.inUse}
+	s.idx, s.inUse, s.branch = idx, &sync.WaitGroup{}, branch
+
+	var expired []*generation
+	if old.idx != nil {
+		// a reindex of the same revision replaces it.
+		if keep := s.Repo.KeepGenerations; keep > 1 && old.idx.Ref.Rev != idx.Ref.Rev && s.spacedOut(old.idx.Ref) {
+			s.retained = append([]*generation{old}, s.retained...)
+		} else {
+			expired = append(expired, old)
+		}
+	}
+
+	if n := s.Repo.KeepGenerations - 1; len(s.retained) > n {
+		if n < 0 {
+			n = 0
+		}
+		expired = append(expired, s.retained[n:]...)
+		s.retained = s.retained[:n]
+	}
+	s.lck.Unlock()
+
+	for _, g := range expired {
+		go retireIndex(g.idx, g.inUse)
+	}
+}
+
+// Whether ref was built long enough after the newest generation that is
+// kept to be kept as well. The lock must be held.
+func (s *Searcher) spacedOut(ref *index.IndexRef) bool {
+	d := time.Duration(s.Repo.MsBetweenGenerations) * time.Millisecond
+	if d <= 0 || len(s.retained) == 0 {
+		return true
+	}
+	return ref.Time.Sub(s.retained[0].idx.Ref.Time) >= d
+}
+
+// Destroy an index that is no longer served once the searches using it
+// are done.
+func retireIndex(idx *index.Index, inUse *sync.WaitGroup) {
+	if inUse != nil {
+		inUse.Wait()
+	}
+
+	if err := idx.Destroy(); err != nil {
+		log.Printf("failed to destroy index (%s): %s", idx.GetDir(), err)
+	}
+}
+
+// Take the index being served for a search, which calls done when it has
+// finished with it. The lock is only held long enough to take it, so a
+// long search never holds up a swap, or the searches after it.
+func (s *Searcher) acquire() (idx *index.Index, done func()) {
+	s.touch()
+
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+
+	if s.idx == nil {
+		return nil, nil
+	}
+
+	s.inUse.Add(1)
+	return s.idx, s.inUse.Done
+}
+
+// Take the index of a revision, or of a prefix of one, for a search, or
+// else the newest one built by at if it is set. An empty rev and a zero at
+// are the latest index.
+func (s *Searcher) acquireRev(rev string, at time.Time) (*index.Index, func(), error) {
+	if !at.IsZero() {
+		return s.acquireAt(at)
+	}
+
+	if rev == "" {
+		idx, done := s.acquire()
+		if idx == nil {
+			return nil, nil, errRemoved
+		}
+		return idx, done, nil
+	}
+
+	s.touch()
+
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+
+	if s.idx == nil {
+		return nil, nil, errRemoved
+	}
 
-	oldIdx := s.idx
-	s.idx = idx
+	if strings.HasPrefix(s.idx.Ref.Rev, rev) {
+		s.inUse.Add(1)
+		return s.idx, s.inUse.Done, nil
+	}
+
+	for _, g := range s.retained {
+		if strings.HasPrefix(g.idx.Ref.Rev, rev) {
+			g.inUse.Add(1)
+			return g.idx, g.inUse.Done, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("no index of revision %s is kept", rev)
+}
+
+// Take the newest index that was built by at, which is the code as it was
+// searched then as near as the generations that are kept can tell.
+func (s *Searcher) acquireAt(at time.Time) (*index.Index, func(), error) {
+	s.touch()
+
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+
+	if s.idx == nil {
+		return nil, nil, errRemoved
+	}
+
+	if !s.idx.Ref.Time.After(at) {
+		s.inUse.Add(1)
+		return s.idx, s.inUse.Done, nil
+	}
+
+	// newest first.
+	for _, g := range s.retained {
+		if !g.idx.Ref.Time.After(at) {
+			g.inUse.Add(1)
+			return g.idx, g.inUse.Done, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("no index from %s or before is kept", at.Format(time.RFC3339))
+}
+
+// Generations lists the indexes that are kept, the one being served
+// first.
+func (s *Searcher) Generations() []index.IndexRef {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+
+	if s.idx == nil {
+		return nil
+	}
 
-	return oldIdx.Destroy()
+	refs := []index.IndexRef{*s.idx.Ref}
+	for _, g := range s.retained {
+		refs = append(refs, *g.idx.Ref)
+	}
+	return refs
 }
 
 // Perform a basic search on the current index using the supplied pattern
@@ -129,15 +414,103 @@ func (s *Searcher) swapIndexes(idx *index.Index) error {
 //
 // TODO(knorton): pat should really just be a part of SearchOptions
 func (s *Searcher) Search(pat string, opt *index.SearchOptions) (*index.SearchResponse, error) {
+	idx, done, err := s.acquireRev(opt.Rev, opt.At)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	res, err := idx.Search(pat, opt)
+	if err != nil {
+		return nil, err
+	}
+	s.docsExcerpts(res)
+	return res, nil
+}
+
+// Carry out several searches on the current index at once. See
+// index.SearchBatch.
+func (s *Searcher) SearchBatch(pats []string, opts []*index.SearchOptions) ([]*index.SearchResponse, []error) {
+	// searches of earlier revisions may each need a different index.
+	for _, opt := range opts {
+		if opt.Rev != "" || !opt.At.IsZero() {
+			return s.searchEach(pats, opts)
+		}
+	}
+
+	idx, done := s.acquire()
+	if idx == nil {
+		errs := make([]error, len(pats))
+		for i := range errs {
+			errs[i] = errRemoved
+		}
+		return make([]*index.SearchResponse, len(pats)), errs
+	}
+	defer done()
+
+	res, errs := idx.SearchBatch(pats, opts)
+	for _, r := range res {
+		s.docsExcerpts(r)
+	}
+	return res, errs
+}
+
+func (s *Searcher) searchEach(pats []string, opts []*index.SearchOptions) ([]*index.SearchResponse, []error) {
+	res := make([]*index.SearchResponse, len(pats))
+	errs := make([]error, len(pats))
+	for i, pat := range pats {
+		res[i], errs[i] = s.Search(pat, opts[i])
+	}
+	return res, errs
+}
+
+// Ref describes the index being served.
+func (s *Searcher) Ref() index.IndexRef {
 	s.lck.RLock()
 	defer s.lck.RUnlock()
-	return s.idx.Search(pat, opt)
+	if s.idx == nil {
+		return index.IndexRef{}
+	}
+	return *s.idx.Ref
+}
+
+// URLPattern is the url-pattern of the repo with {branch} filled in, so
+// that links point at the same ref as the index being served.
+func (s *Searcher) URLPattern() *config.URLPattern {
+	s.lck.RLock()
+	branch := s.branch
+	s.lck.RUnlock()
+	if branch == "" {
+		branch = defaultBranch
+	}
+
+	p := *s.Repo.URLPattern
+	p.Resolve(map[string]string{"branch": branch})
+	return &p
+}
+
+// LastCommit is the time of the newest commit of the files of the index
+// being served, or the zero time if it isn't known.
+func (s *Searcher) LastCommit() time.Time {
+	idx, done := s.acquire()
+	if idx == nil {
+		return time.Time{}
+	}
+	defer done()
+
+	return idx.LastCommit()
 }
 
 // Get the excluded files as a JSON string. This is only used for returning
 // the data directly to clients (thus JSON).
 func (s *Searcher) GetExcludedFiles() string {
-	path := filepath.Join(s.idx.GetDir(), "excluded_files.json")
+	idx, done := s.acquire()
+	if idx == nil {
+		return ""
+	}
+	defer done()
+
+	path := filepath.Join(idx.GetDir(), "excluded_files.json")
 	dat, err := ioutil.ReadFile(path)
 	if err != nil {
 		log.Printf("Couldn't read excluded_files.json %v\n", err)
@@ -145,12 +518,63 @@ func (s *Searcher) GetExcludedFiles() string {
 	return string(dat)
 }
 
-// Triggers an immediate poll of the repository.
-func (s *Searcher) Update() bool {
+// The dependencies found in the manifests of the current index of the
+// repo. See index.Dependencies.
+func (s *Searcher) Dependencies() ([]*index.Dependency, error) {
+	idx, done := s.acquire()
+	if idx == nil {
+		return nil, errRemoved
+	}
+	defer done()
+
+	return idx.Dependencies()
+}
+
+// Find the code of the current index that is similar to a snippet. See
+// index.Similar.
+func (s *Searcher) Similar(snippet string, minScore float64) ([]*index.SimilarRegion, error) {
+	idx, done := s.acquire()
+	if idx == nil {
+		return nil, errRemoved
+	}
+	defer done()
+
+	return idx.Similar(snippet, minScore)
+}
+
+// Find the chunks of the current index whose embeddings are nearest to
+// vec. See index.Nearest.
+func (s *Searcher) Nearest(vec []float32, limit int) ([]*index.SemanticMatch, error) {
+	idx, done := s.acquire()
+	if idx == nil {
+		return nil, errRemoved
+	}
+	defer done()
+
+	return idx.Nearest(vec, limit)
+}
+
+// Find the files of the current index whose paths match re. See
+// index.FindPaths.
+func (s *Searcher) FindPaths(re *regexp.Regexp, limit int) ([]string, bool, error) {
+	idx, done := s.acquire()
+	if idx == nil {
+		return nil, false, errRemoved
+	}
+	defer done()
+
+	return idx.FindPaths(re, limit)
+}
+
+// Triggers an immediate poll of the repository, for the API request with
+// the given id, which may be empty.
+func (s *Searcher) Update(requestID string) bool {
 	if !s.Repo.PushUpdatesEnabled() {
 		return false
 	}
 
+	s.requestID.Store(requestID)
+
 	// schedule an update if one is not already scheduled
 	select {
 	case s.updateCh <- time.Now():
@@ -161,11 +585,59 @@ func (s *Searcher) Update() bool {
 	return true
 }
 
+// Reindex rebuilds the index from the latest revision of the repo, even
+// if it hasn't changed, for the API request with the given id. It returns
+// false if updates are turned off for the repo.
+func (s *Searcher) Reindex(requestID string) bool {
+	if !s.Repo.PollUpdatesEnabled() && !s.Repo.PushUpdatesEnabled() {
+		return false
+	}
+
+	s.requestID.Store(requestID)
+	atomic.StoreInt32(&s.force, 1)
+	select {
+	case s.updateCh <- time.Now():
+	default:
+	}
+
+	return true
+}
+
+// Accept rebuilds the index like Reindex, serving it even if the canary
+// of the repo would refuse it, as when a repo really did shrink.
+func (s *Searcher) Accept(requestID string) bool {
+	atomic.StoreInt32(&s.skipCanary, 1)
+	if !s.Reindex(requestID) {
+		atomic.StoreInt32(&s.skipCanary, 0)
+		return false
+	}
+	return true
+}
+
+// Remove shuts the searcher down and deletes its index once the searches
+// using it are done. Searches of it fail from then on.
+func (s *Searcher) Remove() {
+	s.Stop()
+	s.Wait()
+
+	s.lck.Lock()
+	idx, inUse, retained := s.idx, s.inUse, s.retained
+	s.idx, s.retained = nil, nil
+	s.lck.Unlock()
+
+	if idx != nil {
+		retireIndex(idx, inUse)
+	}
+	for _, g := range retained {
+		retireIndex(g.idx, g.inUse)
+	}
+}
+
 // Shut down the searcher cleanly, waiting for any indexing operations to complete.
 func (s *Searcher) Stop() {
+	atomic.StoreInt32(&s.shutdownRequested, 1)
 	select {
 	case s.shutdownCh <- empty{}:
-		s.shutdownRequested = true
 	default:
 	}
 }
@@ -195,11 +667,31 @@ func (s *Searcher) waitForUpdate(delay time.Duration) {
 	}
 }
 
+// Take the id of the request that asked for the update that is starting,
+// or "" if it wasn't asked for.
+func (s *Searcher) takeRequestID() string {
+	id, _ := s.requestID.Swap("").(string)
+	return id
+}
+
 // Signal the searcher that it is ok to begin polling the repository.
 func (s *Searcher) begin() {
 	s.updateCh <- time.Now()
 }
 
+// Shut down a searcher that was never begun. Its poller is let go with
+// the shutdown already requested, so it stops without polling and Wait
+// returns. The index is deleted too if remove is set, as Remove does.
+func (s *Searcher) discard(remove bool) {
+	s.Stop()
+	s.begin()
+	if remove {
+		s.Remove()
+	} else {
+		s.Wait()
+	}
+}
+
 // Generate a new index directory in the dbpath. The names are based
 // on pseudo-randomness with a time-based seed.
 func nextIndexDir(dbpath string) string {
@@ -216,20 +708,27 @@ func findExistingRefs(dbpath string) (*foundRefs, error) {
 	}
 
 	var refs []*index.IndexRef
+	var partial []*partialBuild
 	for _, dir := range dirs {
 		r, _ := index.Read(dir)
 		refs = append(refs, r)
+
+		if url, rev, ok := index.Resumable(dir); ok {
+			partial = append(partial, &partialBuild{r, url, rev})
+		}
 	}
 
 	return &foundRefs{
 		refs:    refs,
 		claimed: map[*index.IndexRef]bool{},
+		partial: partial,
 	}, nil
 }
 
 // Open an index at the given path. If the idxDir is already present, it will
 // simply open and use that index. If, however, the idxDir does not exist a new
-// one will be built.
+// one will be built, as it will if it holds a build that was cut short, which
+// is resumed.
 func buildAndOpenIndex(
 	opt *index.IndexOptions,
 	dbpath,
@@ -237,7 +736,8 @@ func buildAndOpenIndex(
 	idxDir,
 	url,
 	rev string) (*index.Index, error) {
-	if _, err := os.Stat(idxDir); err != nil {
+	_, _, resume := index.Resumable(idxDir)
+	if _, err := os.Stat(idxDir); err != nil || resume {
 		r, err := index.Build(opt, idxDir, vcsDir, url, rev)
 		if err != nil {
 			return nil, err
@@ -268,11 +768,38 @@ func hashFor(name string) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
-// Create a normalized name for the vcs directory of this repo.
-func vcsDirFor(repo *config.Repo) string {
+// Create a normalized name for the vcs directory of this repo. When other
+// repos point at the same remote, each gets a directory of its own since
+// they may track different refs.
+func vcsDirFor(name string, repo *config.Repo, shared bool) string {
+	if shared {
+		return fmt.Sprintf("vcs-%s", hashFor(repo.URL+"\x00"+name))
+	}
 	return fmt.Sprintf("vcs-%s", hashFor(repo.URL))
 }
 
+// Create a normalized name for the object store that is shared between
+// all repos pointing at the same remote.
+func sharedStoreFor(repo *config.Repo) string {
+	return fmt.Sprintf("vcs-shared-%s", hashFor(repo.URL))
+}
+
+// Find the remotes that are used by more than one repo in the config.
+func findSharedRemotes(cfg *config.Config) map[string]bool {
+	counts := map[string]int{}
+	for _, repo := range cfg.Repos {
+		counts[repo.URL]++
+	}
+
+	shared := map[string]bool{}
+	for url, n := range counts {
+		if n > 1 {
+			shared[url] = true
+		}
+	}
+	return shared
+}
+
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
@@ -280,9 +807,9 @@ func init() {
 // Make a searcher for each repo in the Config. This function kind of has a notion
 // of partial errors. First, if the error returned is non-nil then a fatal error has
 // occurred and no other return values are valid. If an error occurs that is specific
-// to a particular searcher, that searcher will not be present in the searcher map and
+// to a particular searcher, that searcher will not be present in the searcher set and
 // will have an error entry in the error map.
-func MakeAll(cfg *config.Config) (map[string]*Searcher, map[string]error, error) {
+func MakeAll(cfg *config.Config, role Role) (*Set, map[string]error, error) {
 	errs := map[string]error{}
 	searchers := map[string]*Searcher{}
 
@@ -291,16 +818,67 @@ func MakeAll(cfg *config.Config) (map[string]*Searcher, map[string]error, error)
 		return nil, nil, err
 	}
 
+	db, err := meta.Open(cfg.DbPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	st, err := openIndexStore(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if role != RoleAll && st == nil {
+		return nil, nil, fmt.Errorf("the %s role needs an index-store", role)
+	}
+
+	if cfg.LeaderElection != "" && st == nil {
+		return nil, nil, fmt.Errorf("leader election needs an index-store")
+	}
+
+	roleFn, err := electRole(cfg, role)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	events, err := notify.New(cfg.Notifications, cfg.Proxy.Client())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	emb, err := embed.New(cfg.Embeddings, cfg.Proxy.Client())
+	if err != nil {
+		return nil, nil, err
+	}
+
 	lim := makeLimiter(cfg.MaxConcurrentIndexers)
+	thr := newThrottles(cfg)
+	shared := findSharedRemotes(cfg)
+
+	recs, err := db.Repos()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the repos that were disabled stay that way until they are enabled.
+	disabled := map[string]*config.Repo{}
+	for name, repo := range cfg.Repos {
+		if rec := recs[name]; rec != nil && rec.Disabled {
+			disabled[name] = repo
+		}
+	}
 
-	n := len(cfg.Repos)
+	n := len(cfg.Repos) - len(disabled)
 	// Channel to receive the results from newSearcherConcurrent function.
 	resultCh := make(chan searcherResult, n)
 
 	// Start new searchers for all repos in different go routines while
 	// respecting cfg.MaxConcurrentIndexers.
 	for name, repo := range cfg.Repos {
-		go newSearcherConcurrent(cfg.DbPath, name, repo, refs, lim, resultCh)
+		if disabled[name] != nil {
+			continue
+		}
+		go newSearcherConcurrent(cfg.DbPath, name, repo, shared[repo.URL], roleFn, st, refs, lim, thr, emb, db, resultCh)
 	}
 
 	// Collect the results on resultCh channel for all repos.
@@ -315,21 +893,42 @@ func MakeAll(cfg *config.Config) (map[string]*Searcher, map[string]error, error)
 	}
 
 	if err := refs.removeUnclaimed(); err != nil {
+		thr.close()
 		return nil, nil, err
 	}
 
+	if err := forgetRemoved(db, cfg); err != nil {
+		log.Printf("failed to forget the repos that were removed: %s", err)
+	}
+
 	// after all the repos are in good shape, we start their polling
 	for _, s := range searchers {
+		s.events = events
 		s.begin()
 	}
 
-	return searchers, errs, nil
+	set := newSet(cfg, searchers, roleFn, st, lim, thr)
+	set.events = events
+	set.emb = emb
+	set.meta = db
+	set.disabled = disabled
+
+	// the repos that failed are tried again with backoff, so a remote
+	// that was briefly down at startup doesn't keep them out for good.
+	set.lck.Lock()
+	for name, err := range errs {
+		repo := cfg.Repos[name]
+		set.fail(name, repo, shared[repo.URL], err, newRepoHealth(name, repo))
+	}
+	set.lck.Unlock()
+
+	return set, errs, nil
 }
 
 // Creates a new Searcher that is available for searches as soon as this returns.
 // This will pull or clone the target repo and start watching the repo for changes.
 func New(dbpath, name string, repo *config.Repo) (*Searcher, error) {
-	s, err := newSearcher(dbpath, name, repo, &foundRefs{}, makeLimiter(1))
+	s, err := newSearcher(dbpath, name, repo, false, func() Role { return RoleAll }, nil, &foundRefs{}, makeLimiter(1), nil, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -348,22 +947,27 @@ func updateAndReindex(
 	rev string,
 	wd *vcs.WorkDir,
 	opt *index.IndexOptions,
-	lim limiter) (string, bool) {
+	lim limiter) (string, bool, error) {
 
 	// acquire a token from the rate limiter
 	lim.Acquire()
 	defer lim.Release()
 
 	repo := s.Repo
+	if backupInProgress(dbpath) {
+		log.Printf("Backup in progress, skipping update of %s", name)
+		return rev, false, nil
+	}
+
 	newRev, err := wd.PullOrClone(vcsDir, repo.URL)
 
 	if err != nil {
 		log.Printf("vcs pull error (%s - %s): %s", name, repo.URL, err)
-		return rev, false
+		return rev, false, err
 	}
 
-	if newRev == rev {
-		return rev, false
+	if newRev == rev && atomic.SwapInt32(&s.force, 0) == 0 {
+		return rev, false, nil
 	}
 
 	log.Printf("Rebuilding %s for %s", name, newRev)
@@ -376,18 +980,66 @@ func updateAndReindex(
 		newRev)
 	if err != nil {
 		log.Printf("failed index build (%s): %s", name, err)
-		return rev, false
+		return rev, false, err
 	}
 
-	if err := s.swapIndexes(idx); err != nil {
-		log.Printf("failed index swap (%s): %s", name, err)
-		if err := idx.Destroy(); err != nil {
-			log.Printf("failed to destroy index (%s): %s\n", name, err)
+	if repo.Canary != nil && atomic.SwapInt32(&s.skipCanary, 0) == 0 {
+		if cur, done := s.acquire(); cur != nil {
+			err = checkCanary(repo.Canary, cur, idx, newRev)
+			done()
+		}
+		if err != nil {
+			log.Printf("canary of %s refused the new index: %s", name, err)
+			if derr := idx.Destroy(); derr != nil {
+				log.Printf("failed to destroy index (%s): %s", idx.GetDir(), derr)
+			}
+			return rev, false, err
 		}
-		return rev, false
 	}
 
-	return newRev, true
+	tryPublishIndex(s.indexStore, name, repo, idx, wd.Ref())
+	loadIntoMemory(name, repo, idx)
+
+	s.swapIndexes(idx, wd.Ref())
+
+	return newRev, true, nil
+}
+
+// Set up the vcs working directory of a repo and the options to index it
+// with.
+func openWorkDir(dbpath, name string, repo *config.Repo, shared bool, thr *throttles, emb *embed.Model) (*vcs.WorkDir, string, *index.IndexOptions, error) {
+	vcsDir := filepath.Join(dbpath, vcsDirFor(name, repo, shared))
+
+	wd, err := vcs.New(repo.Vcs, repo.VcsConfig())
+	if err != nil {
+		return nil, "", nil, err
+	}
+	wd.SetEnv(repo.Proxy.Env())
+
+	if shared && wd.UseSharedStore(filepath.Join(dbpath, sharedStoreFor(repo))) {
+		log.Printf("Sharing objects for %s with other repos of %s", name, repo.URL)
+	}
+
+	opt := &index.IndexOptions{
+		ExcludeDotFiles:      repo.ExcludeDotFiles,
+		SpecialFiles:         wd.SpecialFiles(),
+		Embeddings:           emb,
+		Filters:              fileFilters(repo.FileFilters),
+		Extraction:           extraction(repo.Extraction),
+		NotebookCells:        repo.NotebookCellsIndexed(),
+		ExcludeMinified:      repo.MinifiedExcluded(),
+		SourceMaps:           repo.IndexSourceMaps,
+		MaxExcerptLineLength: repo.MaxExcerptLineLength,
+	}
+	if repo.CommitTimesIndexed() {
+		opt.Commits = fileCommits(name, wd, repo.IndexCommitAuthors)
+	}
+
+	if err := thr.apply(dbpath, name, repo, wd, opt); err != nil {
+		return nil, "", nil, err
+	}
+
+	return wd, vcsDir, opt, nil
 }
 
 // Creates a new Searcher that is capable of re-claiming an existing index directory
@@ -395,56 +1047,133 @@ func updateAndReindex(
 func newSearcher(
 	dbpath, name string,
 	repo *config.Repo,
+	shared bool,
+	role func() Role,
+	st store.Store,
 	refs *foundRefs,
-	lim limiter) (*Searcher, error) {
-
-	vcsDir := filepath.Join(dbpath, vcsDirFor(repo))
+	lim limiter,
+	thr *throttles,
+	emb *embed.Model,
+	db *meta.DB) (*Searcher, error) {
 
 	log.Printf("Searcher started for %s", name)
+	start := time.Now()
 
-	wd, err := vcs.New(repo.Vcs, repo.VcsConfig())
+	wd, vcsDir, opt, err := openWorkDir(dbpath, name, repo, shared, thr, emb)
 	if err != nil {
 		return nil, err
 	}
 
-	opt := &index.IndexOptions{
-		ExcludeDotFiles: repo.ExcludeDotFiles,
-		SpecialFiles:    wd.SpecialFiles(),
-	}
+	var idx *index.Index
+	var rev, branch string
 
-	rev, err := wd.PullOrClone(vcsDir, repo.URL)
-	if err != nil {
-		return nil, err
-	}
+	// how long it took to build the index, if it wasn't already built.
+	var took time.Duration
 
-	var idxDir string
-	ref := refs.find(repo.URL, rev)
-	if ref == nil {
-		idxDir = nextIndexDir(dbpath)
-	} else {
-		idxDir = ref.Dir()
-		refs.claim(ref)
+	// A published index lets us start serving without cloning. The
+	// first poll will bring the vcs dir up to date.
+	if role() == RoleSearcher {
+		i, si, err := waitForIndex(st, dbpath, name, repo, refs, lim, role)
+		if err == nil {
+			idx, rev, branch = i, si.Rev, si.Branch
+		} else if err != store.ErrNotFound {
+			return nil, err
+		}
+	} else if st != nil {
+		i, si, err := fetchIndex(st, dbpath, name, repo, refs)
+		if err == nil {
+			log.Printf("Loaded index of %s at %s from the index store", name, si.Rev)
+			idx, rev, branch = i, si.Rev, si.Branch
+		} else if err != store.ErrNotFound {
+			log.Printf("failed to fetch index (%s): %s", name, err)
+		}
 	}
 
-	idx, err := buildAndOpenIndex(
-		opt,
-		dbpath,
-		vcsDir,
-		idxDir,
-		repo.URL,
-		rev)
-	if err != nil {
-		return nil, err
+	if idx == nil {
+		rev, err = wd.PullOrClone(vcsDir, repo.URL)
+		if err != nil {
+			return nil, err
+		}
+		branch = wd.Ref()
+
+		var idxDir string
+		ref := refs.find(repo.URL, rev)
+		if ref == nil {
+			idxDir = nextIndexDir(dbpath)
+			if p := refs.claimPartial(repo.URL, rev); p != nil {
+				idxDir = p.Dir()
+			}
+		} else {
+			idxDir = ref.Dir()
+			refs.claim(ref)
+		}
+
+		idx, err = buildAndOpenIndex(
+			opt,
+			dbpath,
+			vcsDir,
+			idxDir,
+			repo.URL,
+			rev)
+		if err != nil {
+			return nil, err
+		}
+		if ref == nil {
+			took = time.Since(start)
+		}
+
+		tryPublishIndex(st, name, repo, idx, branch)
 	}
 
+	loadIntoMemory(name, repo, idx)
+
 	s := &Searcher{
 		idx:        idx,
+		branch:     branch,
+		inUse:      &sync.WaitGroup{},
 		updateCh:   make(chan time.Time, 1),
 		Repo:       repo,
+		indexStore: st,
+		health:     newRepoHealth(name, repo),
+		wd:         wd,
+		vcsDir:     vcsDir,
 		doneCh:     make(chan empty),
 		shutdownCh: make(chan empty, 1),
+		meta:       db,
 	}
 
+	// generations that were kept before a restart are kept on. The indexes
+	// of a shared remote can't be told apart, so for those it takes the
+	// ones that were recorded as the repo's.
+	var older []*index.IndexRef
+	if !shared {
+		older = refs.claimOlder(repo.URL, idx.Ref.Rev, repo.KeepGenerations-1)
+	} else if rec, err := db.Repo(name); err == nil && rec != nil {
+		older = refs.claimDirs(repo.URL, idx.Ref.Rev, rec.Dirs(), repo.KeepGenerations-1)
+	}
+	for _, ref := range older {
+		old, err := ref.Open()
+		if err != nil {
+			log.Printf("failed to open index (%s): %s", name, err)
+			continue
+		}
+		s.retained = append(s.retained, &generation{old, &sync.WaitGroup{}})
+	}
+	s.recordIndex(name, took)
+
+	// indexes served from memory are never archived.
+	s.touch()
+	if repo.Archived() && !repo.InMemory {
+		go s.archiveWhenIdle(name)
+	}
+
+	// the index was built when the repo last changed, as far as we know.
+	lastChange := idx.Ref.Time
+
+	// the revision whose index the canary last refused, which is only
+	// told about once.
+	var refused string
+
 	go func() {
 
 		// each searcher's poller is held until begin is called.
@@ -456,27 +1185,97 @@ func newSearcher(
 			return
 		}
 
-		var delay time.Duration
+		var poll *pollSchedule
 		if repo.PollUpdatesEnabled() {
-			delay = time.Duration(repo.MsBetweenPolls) * time.Millisecond
+			poll = newPollSchedule(repo, lastChange)
 		}
 
 		for {
+			var delay time.Duration
+			if poll != nil {
+				delay = poll.next(time.Now())
+			}
+
 			// Wait for a signal to proceed
-			s.waitForUpdate(delay)
+			s.waitForUpdate(s.health.wait(delay, time.Now()))
 
-			if s.shutdownRequested {
+			if atomic.LoadInt32(&s.shutdownRequested) != 0 {
 				s.completeShutdown()
 				return
 			}
 
+			// a repo that is backing off only updates when it is due to,
+			// unless a reindex was asked for.
+			if !s.health.due(time.Now()) && atomic.LoadInt32(&s.force) == 0 {
+				continue
+			}
+
+			// the work is logged under the request that asked for it.
+			id := s.takeRequestID()
+			ctx := reqid.NewContext(context.Background(), id)
+			if id != "" {
+				reqid.Printf(ctx, "updating %s", name)
+			}
+
 			// attempt to update and reindex this searcher
-			newRev, ok := updateAndReindex(s, dbpath, vcsDir, name, rev, wd, opt, lim)
+			start := time.Now()
+			var newRev string
+			var ok bool
+			var err error
+			if role() == RoleSearcher {
+				newRev, ok, err = updateFromStore(s, dbpath, name, rev, lim)
+			} else {
+				newRev, ok, err = updateAndReindex(s, dbpath, vcsDir, name, rev, wd, opt, lim)
+			}
+
+			if err != nil {
+				if id != "" {
+					reqid.Printf(ctx, "update of %s failed: %s", name, err)
+				}
+				n := s.health.failed(err, time.Now())
+				recordFailure(s.meta, name, repo.URL, err, n, time.Now())
+				var ce *CanaryError
+				if errors.As(err, &ce) && ce.Rev != refused {
+					refused = ce.Rev
+					s.events.Notify(&notify.Event{
+						Event:     notify.IndexRefused,
+						Repo:      name,
+						URL:       repo.URL,
+						Rev:       ce.Rev,
+						Error:     ce.Reason,
+						RequestID: id,
+					})
+				}
+				s.events.Notify(&notify.Event{
+					Event:     notify.IndexFailed,
+					Repo:      name,
+					URL:       repo.URL,
+					Rev:       rev,
+					Error:     err.Error(),
+					Failures:  n,
+					RequestID: id,
+				})
+				continue
+			}
+			s.health.succeeded()
+
 			if !ok {
+				s.recordSuccess(name)
 				continue
 			}
 
 			rev = newRev
+			s.recordIndex(name, time.Since(start))
+			if poll != nil {
+				poll.changed(time.Now())
+			}
+			s.events.Notify(&notify.Event{
+				Event:     notify.IndexCompleted,
+				Repo:      name,
+				URL:       repo.URL,
+				Rev:       rev,
+				RequestID: id,
+			})
 
 			// This is just a good time to GC since we know there will be a
 			// whole set of dead posting lists on the heap. Ensuring these
@@ -491,21 +1290,96 @@ func newSearcher(
 	return s, nil
 }
 
+// The filters of the files of a repo, as the index takes them. A check
+// that the config turns off with a negative value is off in the index
+// too.
+func fileFilters(f *config.FileFilters) *index.FileFilters {
+	if f == nil {
+		return nil
+	}
+
+	return &index.FileFilters{
+		MaxLineLength:  f.MaxLineLength,
+		MaxEntropy:     f.MaxEntropy,
+		SizePercentile: f.SizePercentile,
+		SizeFactor:     f.SizeFactor,
+		MinSize:        f.MinSize,
+		SkipLockfiles:  f.SkipLockfiles != nil && *f.SkipLockfiles,
+		Include:        f.Include,
+	}
+}
+
+// Find the last commits of the files of a checkout for the index, with
+// their authors if authors is set. A repo whose history can't be read is
+// still indexed, without them.
+func fileCommits(name string, wd *vcs.WorkDir, authors bool) func(dir string) (map[string]*index.FileCommit, error) {
+	return func(dir string) (map[string]*index.FileCommit, error) {
+		c, err := wd.LastCommits(dir)
+		if err == vcs.ErrCannotListCommits {
+			return nil, nil
+		} else if err != nil {
+			log.Printf("Could not find when the files of %s last changed: %s", name, err)
+			return nil, nil
+		}
+
+		res := make(map[string]*index.FileCommit, len(c))
+		for path, fc := range c {
+			res[path] = &index.FileCommit{Time: fc.Time}
+			if authors {
+				res[path].Author = fc.Author
+			}
+		}
+		return res, nil
+	}
+}
+
+func extraction(e *config.Extraction) *index.Extraction {
+	if e == nil {
+		return nil
+	}
+
+	ex := &index.Extraction{
+		Converters: map[string]index.Converter{},
+		MaxBytes:   e.MaxBytes,
+	}
+	if e.Office != nil && *e.Office {
+		ex.Converters = index.OfficeConverters(e.MaxBytes)
+	}
+	for ext, args := range e.Commands {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		ex.Converters[ext] = &index.CommandConverter{
+			Args:     args,
+			Timeout:  time.Duration(e.TimeoutMs) * time.Millisecond,
+			MaxBytes: e.MaxBytes,
+		}
+	}
+	return ex
+}
+
 // This function is a wrapper around `newSearcher` function.
 // It respects the parameter `cfg.MaxConcurrentIndexers` while making the
 // creation of searchers for various repositories concurrent.
 func newSearcherConcurrent(
 	dbpath, name string,
 	repo *config.Repo,
+	shared bool,
+	role func() Role,
+	st store.Store,
 	refs *foundRefs,
 	lim limiter,
+	thr *throttles,
+	emb *embed.Model,
+	db *meta.DB,
 	resultCh chan searcherResult) {
 
 	// acquire a token from the rate limiter
 	lim.Acquire()
 	defer lim.Release()
 
-	s, err := newSearcher(dbpath, name, repo, refs, lim)
+	s, err := newSearcher(dbpath, name, repo, shared, role, st, refs, lim, thr, emb, db)
 	if err != nil {
 		resultCh <- searcherResult{
 			name: name,
@@ -0,0 +1,250 @@
+package searcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+)
+
+// Returns a function that builds an index of src at a rev in a dir of tmp.
+func buildFunc(t *testing.T, tmp, src string) func(dir, rev string) *index.Index {
+	return func(dir, rev string) *index.Index {
+		ref, err := index.Build(&index.IndexOptions{}, filepath.Join(tmp, dir), src, "https://example.com/repo.git", rev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx, err := ref.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return idx
+	}
+}
+
+// Tests that a search running when a new index is swapped in finishes on
+// the old one, which is only destroyed after it is done.
+func TestSwapWaitsForSearches(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "hound-swap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	writeFile(t, filepath.Join(src, "main.go"), "package main\n")
+
+	build := buildFunc(t, tmp, src)
+
+	s := &Searcher{idx: build("one", "1"), inUse: &sync.WaitGroup{}, Repo: &config.Repo{KeepGenerations: 1}}
+	old, done := s.acquire()
+
+	s.swapIndexes(build("two", "2"), "")
+	defer s.idx.Close()
+
+	if rev := s.Ref().Rev; rev != "2" {
+		t.Fatalf("expected new searches to use rev 2, got %s", rev)
+	}
+
+	// the search that was already running can still read the old index.
+	res, err := old.Search("package", &index.SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Matches) != 1 {
+		t.Fatalf("expected 1 match in the old index, got %d", len(res.Matches))
+	}
+
+	if _, err := os.Stat(old.GetDir()); err != nil {
+		t.Fatalf("expected the old index to be kept while it is in use: %s", err)
+	}
+
+	done()
+
+	for i := 0; ; i++ {
+		if _, err := os.Stat(old.GetDir()); os.IsNotExist(err) {
+			break
+		}
+		if i == 100 {
+			t.Fatal("expected the old index to be destroyed once the search was done")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Tests that earlier generations are kept and can be searched by
+// revision, until they fall out of the ones kept.
+func TestKeepGenerations(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "hound-generations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	writeFile(t, filepath.Join(src, "main.go"), "package main\n")
+	build := buildFunc(t, tmp, src)
+
+	s := &Searcher{idx: build("one", "aaa1"), inUse: &sync.WaitGroup{}, Repo: &config.Repo{KeepGenerations: 2}}
+	first := s.idx
+
+	s.swapIndexes(build("two", "bbb2"), "")
+
+	res, err := s.Search("package", &index.SearchOptions{Rev: "aaa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Matches) != 1 {
+		t.Fatalf("expected 1 match in the kept generation, got %d", len(res.Matches))
+	}
+
+	if _, err := s.Search("package", &index.SearchOptions{Rev: "ccc"}); err == nil {
+		t.Fatal("expected an error for a revision that isn't kept")
+	}
+
+	s.swapIndexes(build("three", "ccc3"), "")
+	defer func() {
+		s.idx.Close()
+		for _, g := range s.retained {
+			g.idx.Close()
+		}
+	}()
+
+	var revs []string
+	for _, ref := range s.Generations() {
+		revs = append(revs, ref.Rev)
+	}
+	if len(revs) != 2 || revs[0] != "ccc3" || revs[1] != "bbb2" {
+		t.Fatalf("expected ccc3 and bbb2 to be kept, got %v", revs)
+	}
+
+	if _, err := s.Search("package", &index.SearchOptions{Rev: "aaa"}); err == nil {
+		t.Fatal("expected the oldest generation to be dropped")
+	}
+
+	for i := 0; ; i++ {
+		if _, err := os.Stat(first.GetDir()); os.IsNotExist(err) {
+			break
+		}
+		if i == 100 {
+			t.Fatal("expected the oldest generation to be destroyed")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Tests that generations are only kept once they are spaced out by
+// ms-between-generations, and that a search at a time gets the newest one
+// built by then.
+func TestGenerationsByTime(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "hound-generations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	writeFile(t, filepath.Join(src, "main.go"), "package main\n")
+	build := buildFunc(t, tmp, src)
+
+	day := 24 * time.Hour
+	t0 := time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC)
+	at := func(dir, rev string, tm time.Time) *index.Index {
+		idx := build(dir, rev)
+		idx.Ref.Time = tm
+		return idx
+	}
+
+	s := &Searcher{
+		idx:   at("one", "aaa1", t0),
+		inUse: &sync.WaitGroup{},
+		Repo: &config.Repo{
+			KeepGenerations:      3,
+			MsBetweenGenerations: int(day / time.Millisecond),
+		},
+	}
+	s.swapIndexes(at("two", "bbb2", t0.Add(time.Hour)), "")
+	s.swapIndexes(at("three", "ccc3", t0.Add(day+time.Hour)), "")
+	s.swapIndexes(at("four", "ddd4", t0.Add(day+2*time.Hour)), "")
+	defer func() {
+		s.idx.Close()
+		for _, g := range s.retained {
+			g.idx.Close()
+		}
+	}()
+
+	var revs []string
+	for _, ref := range s.Generations() {
+		revs = append(revs, ref.Rev)
+	}
+	if len(revs) != 3 || revs[0] != "ddd4" || revs[1] != "ccc3" || revs[2] != "aaa1" {
+		t.Fatalf("expected ddd4, ccc3 and aaa1 to be kept, got %v", revs)
+	}
+
+	tests := []struct {
+		at  time.Time
+		rev string
+	}{
+		{t0.Add(3 * day), "ddd4"},
+		{t0.Add(day + 90*time.Minute), "ccc3"},
+		{t0.Add(2 * time.Hour), "aaa1"},
+		{t0, "aaa1"},
+	}
+	for _, test := range tests {
+		res, err := s.Search("package", &index.SearchOptions{At: test.at})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Revision != test.rev {
+			t.Fatalf("at %s: expected %s, got %s", test.at, test.rev, res.Revision)
+		}
+	}
+
+	if _, err := s.Search("package", &index.SearchOptions{At: t0.Add(-time.Minute)}); err == nil {
+		t.Fatal("expected an error for a time before the oldest generation")
+	}
+}
+
+// Tests that links point at the ref of the index being served, as it
+// changes, rather than at the one the searcher started with.
+func TestURLPatternFollowsSwaps(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "hound-swap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	writeFile(t, filepath.Join(src, "main.go"), "package main\n")
+
+	build := buildFunc(t, tmp, src)
+
+	repo := &config.Repo{
+		KeepGenerations: 1,
+		URLPattern:      &config.URLPattern{BaseURL: "{url}/blob/{branch}/{path}"},
+	}
+	s := &Searcher{idx: build("one", "1"), inUse: &sync.WaitGroup{}, Repo: repo, branch: "v1.0"}
+	if u := s.URLPattern().BaseURL; u != "{url}/blob/v1.0/{path}" {
+		t.Fatalf("expected links to v1.0, got %s", u)
+	}
+
+	s.swapIndexes(build("two", "2"), "v1.1")
+	defer s.idx.Close()
+	if u := s.URLPattern().BaseURL; u != "{url}/blob/v1.1/{path}" {
+		t.Fatalf("expected links to follow the new index to v1.1, got %s", u)
+	}
+
+	s.swapIndexes(build("three", "3"), "")
+	if u := s.URLPattern().BaseURL; u != "{url}/blob/master/{path}" {
+		t.Fatalf("expected links to the default branch, got %s", u)
+	}
+
+	if u := repo.URLPattern.BaseURL; u != "{url}/blob/{branch}/{path}" {
+		t.Fatalf("expected the url-pattern of the repo to be left as is, got %s", u)
+	}
+}
@@ -0,0 +1,543 @@
+package searcher
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/embed"
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/meta"
+	"github.com/hound-search/hound/notify"
+	"github.com/hound-search/hound/store"
+)
+
+// The states a repo of a Set can be in.
+const (
+	StateIndexing = "indexing"
+	StateReady    = "ready"
+	StateFailed   = "failed"
+	StateDisabled = "disabled"
+)
+
+// Set is the searchers being served, keyed by repo name. Repos can be
+// added to it and removed from it while searches are running.
+type Set struct {
+	lck       sync.RWMutex
+	searchers map[string]*Searcher
+
+	// Repos that are still being indexed for the first time, and the
+	// ones that failed to, along with their config.
+	pending map[string]*config.Repo
+	failed  map[string]*failedRepo
+
+	// Repos of the config that were disabled, which are neither indexed
+	// nor served.
+	disabled map[string]*config.Repo
+
+	// Set once the searchers have been told to shut down.
+	stopped bool
+
+	// What it takes to start another searcher.
+	cfg  *config.Config
+	role func() Role
+	st   store.Store
+	lim  limiter
+	thr  *throttles
+
+	// Told about repos being added, removed and failing, if it is set.
+	events *notify.Notifier
+
+	// Embeds the files of the repos for semantic search, if it is set.
+	emb *embed.Model
+
+	// Where the indexes and failures of the repos are recorded, if it is
+	// set.
+	meta *meta.DB
+}
+
+type failedRepo struct {
+	repo   *config.Repo
+	shared bool
+	err    error
+
+	// Spaces out the attempts to index it again.
+	health *repoHealth
+}
+
+// RepoStatus is the state of one repo of a Set.
+type RepoStatus struct {
+	State string
+	URL   string
+	Rev   string `json:",omitempty"`
+
+	// When the index being served was built.
+	IndexedAt *time.Time `json:",omitempty"`
+
+	// Why the repo failed to index, or why its last update failed.
+	Error string `json:",omitempty"`
+
+	// For a repo that is failing, the number of failures in a row, when
+	// the last one was and when it will be tried again. Once the circuit
+	// is open, it is only tried at the longest backoff.
+	Failures    int        `json:",omitempty"`
+	LastFailure *time.Time `json:",omitempty"`
+	NextAttempt *time.Time `json:",omitempty"`
+	CircuitOpen bool       `json:",omitempty"`
+
+	// How long it took to build the index being served, if it is known.
+	IndexMs int64 `json:",omitempty"`
+
+	// The earlier revisions whose indexes are kept and can be searched,
+	// newest first, and when each of them was indexed.
+	Generations     []string    `json:",omitempty"`
+	GenerationTimes []time.Time `json:",omitempty"`
+}
+
+// NewSet makes a Set of searchers that were made outside of MakeAll, e.g.
+// with New. Repos added to it are indexed in the dbpath of cfg.
+func NewSet(cfg *config.Config, searchers map[string]*Searcher) *Set {
+	return newSet(cfg, searchers, func() Role { return RoleAll }, nil, makeLimiter(1), nil)
+}
+
+func newSet(cfg *config.Config, searchers map[string]*Searcher, role func() Role, st store.Store, lim limiter, thr *throttles) *Set {
+	return &Set{
+		searchers: searchers,
+		pending:   map[string]*config.Repo{},
+		failed:    map[string]*failedRepo{},
+		disabled:  map[string]*config.Repo{},
+		cfg:       cfg,
+		role:      role,
+		st:        st,
+		lim:       lim,
+		thr:       thr,
+	}
+}
+
+// All returns the searchers that are ready. The map is a copy, so it stays
+// the same for as long as the caller needs it.
+func (s *Set) All() map[string]*Searcher {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+
+	all := make(map[string]*Searcher, len(s.searchers))
+	for name, srch := range s.searchers {
+		all[name] = srch
+	}
+	return all
+}
+
+// State returns the state of a repo of the set, or "" if there is no
+// repo by that name.
+func (s *Set) State(name string) string {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+
+	switch {
+	case s.searchers[name] != nil:
+		return StateReady
+	case s.pending[name] != nil:
+		return StateIndexing
+	case s.failed[name] != nil:
+		return StateFailed
+	case s.disabled[name] != nil:
+		return StateDisabled
+	}
+	return ""
+}
+
+// Repos returns the config of every repo of the set, including the ones
+// that are not searchable yet and the disabled ones.
+func (s *Set) Repos() map[string]*config.Repo {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+
+	res := make(map[string]*config.Repo, len(s.searchers)+len(s.pending)+len(s.failed)+len(s.disabled))
+	for name, srch := range s.searchers {
+		res[name] = srch.Repo
+	}
+	for name, repo := range s.pending {
+		res[name] = repo
+	}
+	for name, f := range s.failed {
+		res[name] = f.repo
+	}
+	for name, repo := range s.disabled {
+		res[name] = repo
+	}
+	return res
+}
+
+// Config returns the config that the set was made with, as it is being
+// run: with the defaults filled in, the repos that are being served
+// rather than the ones in the file, and the secrets masked.
+func (s *Set) Config() *config.Config {
+	return s.cfg.Effective(s.Repos())
+}
+
+// InDefaultScope is whether a repo is searched by the searches that don't
+// say which repos to search. See config.InDefaultScope.
+func (s *Set) InDefaultScope(name string, repo *config.Repo) bool {
+	return s.cfg.InDefaultScope(name, repo)
+}
+
+// MaxResponseBytes is the cap on the size of the responses of searches
+// of the config of the set.
+func (s *Set) MaxResponseBytes() int {
+	return s.cfg.MaxResponseBytes
+}
+
+// Embeddings is the model that the repos are embedded with for semantic
+// search, which is nil unless it is turned on in the config.
+func (s *Set) Embeddings() *embed.Model {
+	return s.emb
+}
+
+// Meta is where the indexes and failures of the repos are recorded, along
+// with the saved searches. It is nil for sets made with NewSet.
+func (s *Set) Meta() *meta.DB {
+	return s.meta
+}
+
+// Get returns the searcher of a repo, or nil if it isn't ready.
+func (s *Set) Get(name string) *Searcher {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+	return s.searchers[name]
+}
+
+// Add starts indexing another repo, filling in the defaults of its config.
+// It is searchable once the first index is built, which happens in the
+// background.
+func (s *Set) Add(name string, repo *config.Repo) error {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+
+	if s.stopped {
+		return errors.New("hound is shutting down")
+	}
+
+	if name == "" || repo.URL == "" {
+		return errors.New("a repo needs a name and a url")
+	}
+
+	if s.searchers[name] != nil || s.pending[name] != nil {
+		return fmt.Errorf("repo %s already exists", name)
+	}
+
+	// a failed or disabled repo that is added again takes its own place.
+	if max := s.cfg.MaxRepos; max > 0 {
+		n := len(s.searchers) + len(s.pending) + len(s.failed) + len(s.disabled)
+		if s.failed[name] != nil || s.disabled[name] != nil {
+			n--
+		}
+		if n >= max {
+			return fmt.Errorf("there are already %d repos, the most there can be", max)
+		}
+	}
+
+	s.cfg.InitRepo(repo)
+
+	// a repo sharing a remote with another one needs its own vcs dir.
+	shared := false
+	for _, srch := range s.searchers {
+		shared = shared || srch.Repo.URL == repo.URL
+	}
+	for _, r := range s.pending {
+		shared = shared || r.URL == repo.URL
+	}
+
+	if f := s.failed[name]; f != nil {
+		f.health.forget()
+		delete(s.failed, name)
+	}
+	if s.disabled[name] != nil {
+		delete(s.disabled, name)
+		s.recordDisabled(name, repo, false)
+	}
+	s.pending[name] = repo
+
+	go s.build(name, repo, shared, newRepoHealth(name, repo))
+
+	return nil
+}
+
+// Index a repo that was added, or that failed before, and start serving
+// it.
+func (s *Set) build(name string, repo *config.Repo, shared bool, h *repoHealth) {
+	s.lim.Acquire()
+	srch, err := newSearcher(s.cfg.DbPath, name, repo, shared, s.role, s.st, &foundRefs{claimed: map[*index.IndexRef]bool{}}, s.lim, s.thr, s.emb, s.meta)
+	s.lim.Release()
+
+	s.lck.Lock()
+	defer s.lck.Unlock()
+
+	// the repo may have been removed while it was being indexed, which
+	// deletes the index, or the set stopped, which keeps it for the next
+	// start.
+	if s.pending[name] != repo || s.stopped {
+		if srch != nil {
+			go srch.discard(!s.stopped)
+		}
+		return
+	}
+	delete(s.pending, name)
+
+	if err != nil {
+		log.Printf("failed to add repo (%s): %s", name, err)
+		s.fail(name, repo, shared, err, h)
+		return
+	}
+	h.succeeded()
+
+	log.Printf("Added repo %s", name)
+	s.searchers[name] = srch
+	srch.events = s.events
+	srch.begin()
+
+	s.events.Notify(&notify.Event{
+		Event: notify.RepoAdded,
+		Repo:  name,
+		URL:   repo.URL,
+		Rev:   srch.Ref().Rev,
+	})
+}
+
+// Record that a repo failed to index and schedule another attempt once it
+// has backed off. The caller holds the lock.
+func (s *Set) fail(name string, repo *config.Repo, shared bool, err error, h *repoHealth) {
+	n := h.failed(err, time.Now())
+	recordFailure(s.meta, name, repo.URL, err, n, time.Now())
+	s.events.Notify(&notify.Event{
+		Event:    notify.IndexFailed,
+		Repo:     name,
+		URL:      repo.URL,
+		Error:    err.Error(),
+		Failures: n,
+	})
+
+	f := &failedRepo{repo, shared, err, h}
+	s.failed[name] = f
+
+	time.AfterFunc(h.wait(0, time.Now()), func() {
+		s.retry(name, f)
+	})
+}
+
+// Try to index a failed repo again, unless it was removed or added anew
+// in the meantime.
+func (s *Set) retry(name string, f *failedRepo) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+
+	if s.stopped || s.failed[name] != f {
+		return
+	}
+
+	delete(s.failed, name)
+	s.pending[name] = f.repo
+	go s.build(name, f.repo, f.shared, f.health)
+}
+
+// Remove stops serving a repo and deletes its index once the searcher
+// has shut down.
+func (s *Set) Remove(name string) error {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+
+	if srch := s.searchers[name]; srch != nil {
+		delete(s.searchers, name)
+		if srch.health != nil {
+			srch.health.forget()
+		}
+		go srch.Remove()
+		s.removed(name, srch.Repo)
+		return nil
+	}
+
+	if repo := s.pending[name]; repo != nil {
+		delete(s.pending, name)
+		s.removed(name, repo)
+		return nil
+	}
+
+	if f := s.failed[name]; f != nil {
+		f.health.forget()
+		delete(s.failed, name)
+		s.removed(name, f.repo)
+		return nil
+	}
+
+	if repo := s.disabled[name]; repo != nil {
+		delete(s.disabled, name)
+		s.removed(name, repo)
+		return nil
+	}
+
+	return fmt.Errorf("No such repository: %s", name)
+}
+
+// Disable stops indexing and serving a repo, and deletes its index, but
+// keeps it in the set so that it can be enabled again. It stays disabled
+// across restarts for as long as it is in the config.
+func (s *Set) Disable(name string) error {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+
+	var repo *config.Repo
+	if srch := s.searchers[name]; srch != nil {
+		delete(s.searchers, name)
+		if srch.health != nil {
+			srch.health.forget()
+		}
+		go srch.Remove()
+		repo = srch.Repo
+	} else if r := s.pending[name]; r != nil {
+		delete(s.pending, name)
+		repo = r
+	} else if f := s.failed[name]; f != nil {
+		f.health.forget()
+		delete(s.failed, name)
+		repo = f.repo
+	} else if s.disabled[name] != nil {
+		return nil
+	} else {
+		return fmt.Errorf("No such repository: %s", name)
+	}
+
+	log.Printf("Disabled repo %s", name)
+	s.disabled[name] = repo
+	s.recordDisabled(name, repo, true)
+	s.events.Notify(&notify.Event{
+		Event: notify.RepoRemoved,
+		Repo:  name,
+		URL:   repo.URL,
+	})
+	return nil
+}
+
+// Enable starts indexing a repo that was disabled again, as Add does.
+func (s *Set) Enable(name string) error {
+	s.lck.RLock()
+	repo := s.disabled[name]
+	s.lck.RUnlock()
+
+	if repo == nil {
+		if s.State(name) != "" {
+			return fmt.Errorf("repo %s is not disabled", name)
+		}
+		return fmt.Errorf("No such repository: %s", name)
+	}
+	return s.Add(name, repo)
+}
+
+// Record whether a repo is disabled.
+func (s *Set) recordDisabled(name string, repo *config.Repo, disabled bool) {
+	err := s.meta.UpdateRepo(name, func(r *meta.Repo) bool {
+		if r.Disabled == disabled && r.URL == repo.URL {
+			return false
+		}
+		r.URL, r.Disabled = repo.URL, disabled
+		return true
+	})
+	if err != nil {
+		log.Printf("failed to record that %s is disabled: %s", name, err)
+	}
+}
+
+// Tell the webhooks that a repo is no longer served, and forget it.
+func (s *Set) removed(name string, repo *config.Repo) {
+	if err := s.meta.RemoveRepo(name); err != nil {
+		log.Printf("failed to forget repo %s: %s", name, err)
+	}
+
+	s.events.Notify(&notify.Event{
+		Event: notify.RepoRemoved,
+		Repo:  name,
+		URL:   repo.URL,
+	})
+}
+
+// Status reports on every repo of the set, including the ones that are
+// not searchable yet.
+func (s *Set) Status() map[string]*RepoStatus {
+	s.lck.RLock()
+	defer s.lck.RUnlock()
+
+	recs, err := s.meta.Repos()
+	if err != nil {
+		log.Printf("failed to read the records of the repos: %s", err)
+	}
+
+	res := map[string]*RepoStatus{}
+	for name, srch := range s.searchers {
+		ref := srch.Ref()
+		st := &RepoStatus{
+			State:     StateReady,
+			URL:       srch.Repo.URL,
+			Rev:       ref.Rev,
+			IndexedAt: &ref.Time,
+		}
+		if rec := recs[name]; rec != nil && rec.IndexDir == ref.Dir() {
+			st.IndexMs = rec.IndexMs
+		}
+		if gens := srch.Generations(); len(gens) > 1 {
+			for _, g := range gens[1:] {
+				st.Generations = append(st.Generations, g.Rev)
+				st.GenerationTimes = append(st.GenerationTimes, g.Time)
+			}
+		}
+		if srch.health != nil {
+			srch.health.report(st)
+		}
+		res[name] = st
+	}
+
+	for name, repo := range s.pending {
+		res[name] = &RepoStatus{
+			State: StateIndexing,
+			URL:   repo.URL,
+		}
+	}
+
+	for name, f := range s.failed {
+		st := &RepoStatus{
+			State: StateFailed,
+			URL:   f.repo.URL,
+		}
+		f.health.report(st)
+		res[name] = st
+	}
+
+	for name, repo := range s.disabled {
+		res[name] = &RepoStatus{
+			State: StateDisabled,
+			URL:   repo.URL,
+		}
+	}
+
+	return res
+}
+
+// Stop shuts down every searcher in the set, waiting for any indexing in
+// progress to finish.
+func (s *Set) Stop() {
+	s.lck.Lock()
+	s.stopped = true
+	s.lck.Unlock()
+
+	all := s.All()
+	for _, srch := range all {
+		srch.Stop()
+	}
+
+	for _, srch := range all {
+		srch.Wait()
+	}
+
+	s.thr.close()
+	s.meta.Close()
+}
@@ -0,0 +1,265 @@
+package searcher
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/meta"
+)
+
+// Make a git repo with one commit to index.
+func makeGitRepo(t *testing.T, dir string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("needle\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "a.txt"},
+		{"-c", "user.name=hound", "-c", "user.email=hound@example.com", "commit", "-q", "-m", "a"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s: %s", args, err, out)
+		}
+	}
+}
+
+// Wait for a repo of the set to leave the indexing state.
+func waitForState(t *testing.T, set *Set, name string) *RepoStatus {
+	for i := 0; i < 200; i++ {
+		if st := set.Status()[name]; st == nil || st.State != StateIndexing {
+			return st
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("%s is still indexing", name)
+	return nil
+}
+
+func TestSetAddRemove(t *testing.T) {
+	src, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	makeGitRepo(t, src)
+
+	db, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(db)
+
+	set := NewSet(&config.Config{DbPath: db}, map[string]*Searcher{})
+	if err := set.Add("a", &config.Repo{URL: src}); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Add("a", &config.Repo{URL: src}); err == nil {
+		t.Fatal("expected adding a repo twice to fail")
+	}
+	if err := set.Add("bad", &config.Repo{URL: filepath.Join(src, "missing")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if st := waitForState(t, set, "a"); st.State != StateReady || st.Rev == "" {
+		t.Fatalf("expected a to be ready, got %+v", st)
+	}
+	if st := waitForState(t, set, "bad"); st.State != StateFailed || st.Error == "" {
+		t.Fatalf("expected bad to fail, got %+v", st)
+	}
+
+	srch := set.Get("a")
+	res, err := srch.Search("needle", &index.SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Matches) != 1 {
+		t.Fatalf("expected a match, got %d", len(res.Matches))
+	}
+
+	for _, name := range []string{"a", "bad"} {
+		if err := set.Remove(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := set.Remove("a"); err == nil {
+		t.Fatal("expected removing a missing repo to fail")
+	}
+	if len(set.Status()) != 0 {
+		t.Fatalf("expected no repos, got %v", set.Status())
+	}
+
+	// searches that still hold the searcher fail once it is gone.
+	srch.Remove()
+	if _, err := srch.Search("needle", &index.SearchOptions{}); err != errRemoved {
+		t.Fatalf("expected a search of a removed repo to fail, got %v", err)
+	}
+}
+
+func TestSetRemoveWhileIndexing(t *testing.T) {
+	src, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	makeGitRepo(t, src)
+
+	db, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(db)
+
+	set := NewSet(&config.Config{DbPath: db}, map[string]*Searcher{})
+	if err := set.Add("a", &config.Repo{URL: src}); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the indexers of the set take turns, so once another repo is ready
+	// the build of a is done too.
+	if err := set.Add("b", &config.Repo{URL: src}); err != nil {
+		t.Fatal(err)
+	}
+	if st := waitForState(t, set, "b"); st.State != StateReady {
+		t.Fatalf("expected b to be ready, got %+v", st)
+	}
+
+	// the index of a is deleted rather than waiting on a poller that
+	// never began, leaving that of b.
+	for i := 0; ; i++ {
+		dirs, err := filepath.Glob(filepath.Join(db, "idx-*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(dirs) == 1 {
+			break
+		}
+		if i == 200 {
+			t.Fatalf("expected only the index of b, got %v", dirs)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if st := set.Status()["a"]; st != nil {
+		t.Fatalf("expected a to be gone, got %+v", st)
+	}
+	set.Stop()
+}
+
+func TestSetMaxRepos(t *testing.T) {
+	src, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	makeGitRepo(t, src)
+
+	db, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(db)
+
+	set := NewSet(&config.Config{DbPath: db, MaxRepos: 1}, map[string]*Searcher{})
+	defer set.Stop()
+	if err := set.Add("a", &config.Repo{URL: src}); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Add("b", &config.Repo{URL: src}); err == nil {
+		t.Fatal("expected a repo past max-repos to be refused")
+	}
+
+	if st := waitForState(t, set, "a"); st.State != StateReady {
+		t.Fatalf("expected a to be ready, got %+v", st)
+	}
+	if err := set.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Add("b", &config.Repo{URL: src}); err != nil {
+		t.Fatalf("expected room for b once a is removed, got %s", err)
+	}
+	waitForState(t, set, "b")
+}
+
+func TestSetRecordsMeta(t *testing.T) {
+	src, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	makeGitRepo(t, src)
+
+	dbpath, err := ioutil.TempDir("", "hound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbpath)
+
+	db, err := meta.Open(dbpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := NewSet(&config.Config{DbPath: dbpath}, map[string]*Searcher{})
+	set.meta = db
+
+	if err := set.Add("a", &config.Repo{URL: src}); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Add("bad", &config.Repo{URL: filepath.Join(src, "missing")}); err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, set, "a")
+	waitForState(t, set, "bad")
+
+	ref := set.Get("a").Ref()
+	rec, err := db.Repo("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec == nil || rec.Rev != ref.Rev || rec.IndexDir != ref.Dir() || rec.IndexMs == 0 {
+		t.Fatalf("expected the index of a to be recorded, got %+v", rec)
+	}
+	if st := set.Status()["a"]; st.IndexMs != rec.IndexMs {
+		t.Fatalf("expected the status to have the time it took, got %+v", st)
+	}
+
+	rec, err = db.Repo("bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec == nil || rec.Failures < 1 || rec.LastError == "" {
+		t.Fatalf("expected the failure of bad to be recorded, got %+v", rec)
+	}
+
+	// the records outlive houndd, and go with their repos.
+	if err := set.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	set.Stop()
+
+	db, err = meta.OpenReadOnly(dbpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs, err := db.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recs["a"] != nil || recs["bad"] == nil {
+		t.Fatalf("expected only the record of bad, got %v", recs)
+	}
+}
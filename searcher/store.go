@@ -0,0 +1,130 @@
+package searcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/store"
+)
+
+// What the index store holds about the most recently published index of
+// a repo, under <key>/latest.json. The index itself is at <key>/<rev>.tar.gz.
+type storedIndex struct {
+	Rev    string
+	Branch string
+	Time   time.Time
+}
+
+// Open the index store named in the config, if there is one.
+func openIndexStore(cfg *config.Config) (store.Store, error) {
+	if cfg.IndexStore == "" {
+		return nil, nil
+	}
+
+	return store.New(cfg.IndexStore, cfg.IndexStoreConfig(), cfg.Proxy.Client())
+}
+
+// Repos are keyed by name as well as url since several repos can index
+// different branches of the same remote.
+func storeKeyFor(name string, repo *config.Repo) string {
+	return hashFor(repo.URL + "\x00" + name)
+}
+
+// Upload an index and then point latest.json at it, so that readers never
+// see a latest.json for an index that isn't there yet.
+func publishIndex(st store.Store, name string, repo *config.Repo, idx *index.Index, branch string) error {
+	key := storeKeyFor(name, repo)
+	rev := idx.Ref.Rev
+
+	if err := store.PutDir(st, fmt.Sprintf("%s/%s.tar.gz", key, rev), idx.GetDir()); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(&storedIndex{
+		Rev:    rev,
+		Branch: branch,
+		Time:   time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return store.PutBytes(st, key+"/latest.json", b)
+}
+
+// Like publishIndex, but failures are only logged. The index is still
+// served locally and will be published again after the next rebuild.
+func tryPublishIndex(st store.Store, name string, repo *config.Repo, idx *index.Index, branch string) {
+	if st == nil {
+		return
+	}
+
+	if err := publishIndex(st, name, repo, idx, branch); err != nil {
+		log.Printf("failed to publish index (%s): %s", name, err)
+		return
+	}
+
+	log.Printf("Published index of %s at %s", name, idx.Ref.Rev)
+}
+
+// Read what the store says is the latest index for the repo.
+func latestStoredIndex(st store.Store, name string, repo *config.Repo) (*storedIndex, error) {
+	b, err := store.GetBytes(st, storeKeyFor(name, repo)+"/latest.json")
+	if err != nil {
+		return nil, err
+	}
+
+	var si storedIndex
+	if err := json.Unmarshal(b, &si); err != nil {
+		return nil, err
+	}
+
+	return &si, nil
+}
+
+// Open the latest published index for the repo, preferring a copy that
+// is already in the dbpath over downloading it again.
+func fetchIndex(
+	st store.Store,
+	dbpath, name string,
+	repo *config.Repo,
+	refs *foundRefs) (*index.Index, *storedIndex, error) {
+	si, err := latestStoredIndex(st, name, repo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if ref := refs.find(repo.URL, si.Rev); ref != nil {
+		refs.claim(ref)
+		idx, err := ref.Open()
+		return idx, si, err
+	}
+
+	idx, err := downloadIndex(st, dbpath, name, repo, si.Rev)
+	return idx, si, err
+}
+
+// Download a published index into the dbpath. It's unpacked under a
+// temporary name and renamed into place so that nothing else looking at
+// the dbpath sees a partial index.
+func downloadIndex(st store.Store, dbpath, name string, repo *config.Repo, rev string) (*index.Index, error) {
+	dir := nextIndexDir(dbpath)
+	tmp := filepath.Join(dbpath, "dl-"+filepath.Base(dir))
+
+	if err := store.GetDir(st, fmt.Sprintf("%s/%s.tar.gz", storeKeyFor(name, repo), rev), tmp); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmp, dir); err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+
+	return index.Open(dir)
+}
@@ -0,0 +1,197 @@
+package searcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/store"
+)
+
+func TestPublishAndFetchIndex(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "hound-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	st, err := store.New("file", []byte(`{"path": "`+filepath.ToSlash(filepath.Join(tmp, "store"))+`"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &config.Repo{URL: "https://example.com/repo.git"}
+	if _, err := latestStoredIndex(st, "repo", repo); err != store.ErrNotFound {
+		t.Fatalf("expected an empty store, got %v", err)
+	}
+
+	src := filepath.Join(tmp, "src")
+	writeFile(t, filepath.Join(src, "main.go"), "package main\n")
+
+	ref, err := index.Build(&index.IndexOptions{}, filepath.Join(tmp, "db1", "idx-1"), src, repo.URL, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := ref.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	if err := publishIndex(st, "repo", repo, idx, "main"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a fresh instance with an empty dbpath downloads it
+	db2 := filepath.Join(tmp, "db2")
+	fetched, si, err := fetchIndex(st, db2, "repo", repo, &foundRefs{claimed: map[*index.IndexRef]bool{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fetched.Close()
+
+	if si.Rev != "abc" || si.Branch != "main" {
+		t.Fatalf("expected abc on main, got %s on %s", si.Rev, si.Branch)
+	}
+
+	res, err := fetched.Search("package", &index.SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Matches) != 1 {
+		t.Fatalf("expected 1 match in the fetched index, got %d", len(res.Matches))
+	}
+
+	// an instance that already has that rev reuses its copy
+	refs, err := findExistingRefs(filepath.Join(tmp, "db1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, _, err := fetchIndex(st, filepath.Join(tmp, "db1"), "repo", repo, refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+
+	if local.GetDir() != ref.Dir() || !refs.claimed[refs.refs[0]] {
+		t.Fatalf("expected the local index to be claimed, got %s", local.GetDir())
+	}
+}
+
+func TestUpdateFromStore(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "hound-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	st, err := store.New("file", []byte(`{"path": "`+filepath.ToSlash(filepath.Join(tmp, "store"))+`"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &config.Repo{URL: "https://example.com/repo.git"}
+	src := filepath.Join(tmp, "src")
+	writeFile(t, filepath.Join(src, "main.go"), "package main\n")
+
+	build := func(dir, rev string) *index.Index {
+		ref, err := index.Build(&index.IndexOptions{}, filepath.Join(tmp, dir), src, repo.URL, rev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx, err := ref.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return idx
+	}
+
+	// the searcher is serving rev one, then an indexer publishes two
+	s := &Searcher{idx: build("one", "1"), Repo: repo, indexStore: st}
+	two := build("two", "2")
+	defer two.Close()
+	if err := publishIndex(st, "repo", repo, two, "main"); err != nil {
+		t.Fatal(err)
+	}
+
+	db := filepath.Join(tmp, "db")
+	rev, ok, err := updateFromStore(s, db, "repo", "1", makeLimiter(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || rev != "2" {
+		t.Fatalf("expected to move to rev 2, got %s", rev)
+	}
+	defer s.idx.Close()
+
+	if s.idx.Ref.Rev != "2" {
+		t.Fatalf("expected the searcher to serve rev 2, got %s", s.idx.Ref.Rev)
+	}
+
+	if _, ok, _ := updateFromStore(s, db, "repo", "2", makeLimiter(1)); ok {
+		t.Fatal("expected no update when the published rev is unchanged")
+	}
+}
+
+// Tests that a searcher waiting for an index to be published doesn't keep
+// the other repos from being indexed.
+func TestWaitForIndexReleasesLimiter(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "hound-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	st, err := store.New("file", []byte(`{"path": "`+filepath.ToSlash(filepath.Join(tmp, "store"))+`"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &config.Repo{URL: "https://example.com/repo.git", MsBetweenPolls: 10}
+	lim := makeLimiter(1)
+	lim.Acquire()
+
+	var role int32 = 1
+	roleFn := func() Role {
+		if atomic.LoadInt32(&role) != 0 {
+			return RoleSearcher
+		}
+		return RoleIndexer
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := waitForIndex(st, filepath.Join(tmp, "db"), "repo", repo, &foundRefs{claimed: map[*index.IndexRef]bool{}}, lim, roleFn)
+		done <- err
+	}()
+
+	// another repo gets the token while this one waits.
+	got := make(chan bool)
+	go func() {
+		lim.Acquire()
+		got <- true
+	}()
+	select {
+	case <-got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the token to be given back while waiting for an index")
+	}
+	lim.Release()
+
+	atomic.StoreInt32(&role, 0)
+	if err := <-done; err != store.ErrNotFound {
+		t.Fatalf("expected to build the index once it isn't a searcher, got %v", err)
+	}
+
+	// the waiter holds its token again.
+	select {
+	case lim <- true:
+		t.Fatal("expected the waiter to hold the token again")
+	default:
+	}
+}
@@ -0,0 +1,97 @@
+package searcher
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/index"
+	"github.com/hound-search/hound/throttle"
+	"github.com/hound-search/hound/vcs"
+)
+
+// The limits on how fast repos are fetched and their indexes are written.
+// The ones in the config are shared by every repo, and each repo can have
+// its own below them.
+type throttles struct {
+	fetch, write *throttle.Limiter
+
+	// vcs commands are throttled by pointing them at this proxy, which is
+	// started once a repo needs it.
+	lck   sync.Mutex
+	proxy *throttle.Proxy
+}
+
+func newThrottles(cfg *config.Config) *throttles {
+	return &throttles{
+		fetch: throttle.NewLimiter(cfg.MaxFetchBytesPerSec, nil),
+		write: throttle.NewLimiter(cfg.MaxWriteBytesPerSec, nil),
+	}
+}
+
+// Apply the limits of a repo to the commands of its work dir and to the
+// writing of its indexes. Its route through the proxy is named for the
+// dbpath as well as the repo, since repos of different tenants can have
+// the same name.
+func (t *throttles) apply(dbpath, name string, repo *config.Repo, wd *vcs.WorkDir, opt *index.IndexOptions) error {
+	if t == nil {
+		return nil
+	}
+
+	opt.WriteLimit = throttle.NewLimiter(repo.MaxWriteBytesPerSec, t.write)
+
+	fetch := throttle.NewLimiter(repo.MaxFetchBytesPerSec, t.fetch)
+	if fetch == nil {
+		return nil
+	}
+
+	p, err := t.fetchProxy()
+	if err != nil {
+		return err
+	}
+
+	// the proxy goes on through the proxy of the repo, so it replaces
+	// the environment that points at that one.
+	wd.SetEnv(proxyEnv(p.Route(hashFor(dbpath+"\x00"+name), fetch, repo.Proxy.ProxyFunc())))
+	return nil
+}
+
+func (t *throttles) fetchProxy() (*throttle.Proxy, error) {
+	t.lck.Lock()
+	defer t.lck.Unlock()
+
+	if t.proxy == nil {
+		p, err := throttle.NewProxy()
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Throttling fetches through a proxy on %s", p.Addr())
+		t.proxy = p
+	}
+	return t.proxy, nil
+}
+
+func (t *throttles) close() {
+	if t == nil {
+		return
+	}
+
+	t.lck.Lock()
+	defer t.lck.Unlock()
+
+	if t.proxy != nil {
+		t.proxy.Close()
+		t.proxy = nil
+	}
+}
+
+// Environment variables that send every http(s) request of a command
+// through the proxy at u.
+func proxyEnv(u string) []string {
+	var env []string
+	for _, name := range []string{"http_proxy", "https_proxy", "all_proxy"} {
+		env = append(env, strings.ToUpper(name)+"="+u, name+"="+u)
+	}
+	return append(env, "NO_PROXY=", "no_proxy=")
+}
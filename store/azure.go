@@ -0,0 +1,124 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const azureAPIVersion = "2020-04-08"
+
+// A store in an Azure Blob Storage container. Requests are authorized
+// with a SAS token, which can be scoped to the one container.
+type AzureStore struct {
+	// e.g. https://account.blob.core.windows.net/container
+	ContainerURL string `json:"container-url"`
+
+	// Prepended to every key.
+	Prefix string `json:"prefix"`
+
+	// Name of the environment variable holding the SAS token.
+	SASTokenEnv string `json:"sas-token-env"`
+
+	client *http.Client
+}
+
+func init() {
+	Register(newAzure, "azure")
+}
+
+func newAzure(b []byte, client *http.Client) (Store, error) {
+	s := &AzureStore{
+		SASTokenEnv: "AZURE_STORAGE_SAS_TOKEN",
+		client:      client,
+	}
+
+	if b != nil {
+		if err := json.Unmarshal(b, s); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.ContainerURL == "" {
+		return nil, errors.New("store: a container-url is required")
+	}
+
+	return s, nil
+}
+
+func (s *AzureStore) url(key string) (string, error) {
+	sas := strings.TrimPrefix(os.Getenv(s.SASTokenEnv), "?")
+	if sas == "" {
+		return "", fmt.Errorf("store: %s must be set", s.SASTokenEnv)
+	}
+
+	return fmt.Sprintf("%s/%s?%s",
+		strings.TrimSuffix(s.ContainerURL, "/"),
+		escapePath(s.Prefix+key),
+		sas), nil
+}
+
+func (s *AzureStore) Get(key string) (io.ReadCloser, error) {
+	u, err := s.url(key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Ms-Version", azureAPIVersion)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res.Body, nil
+	case http.StatusNotFound:
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+
+	return nil, httpError(res)
+}
+
+// A single Put Blob call, which is good for blobs up to 5000 MiB with
+// this API version.
+func (s *AzureStore) Put(key string, r io.Reader, size int64) error {
+	u, err := s.url(key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PUT", u, ioutil.NopCloser(r))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	req.Header.Set("X-Ms-Version", azureAPIVersion)
+	req.Header.Set("X-Ms-Blob-Type", "BlockBlob")
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusCreated {
+		return httpError(res)
+	}
+
+	res.Body.Close()
+	return nil
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// A store on a shared filesystem, like an NFS mount.
+type FileStore struct {
+	Path string `json:"path"`
+}
+
+func init() {
+	Register(newFile, "file")
+}
+
+func newFile(b []byte, client *http.Client) (Store, error) {
+	var s FileStore
+	if b != nil {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Path == "" {
+		return nil, errors.New("store: the file store needs a path")
+	}
+
+	return &s, nil
+}
+
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.Path, filepath.FromSlash(key))
+}
+
+func (s *FileStore) Get(key string) (io.ReadCloser, error) {
+	r, err := os.Open(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return r, err
+}
+
+// Objects are written to a temp file and renamed into place so readers
+// never see a partial object.
+func (s *FileStore) Put(key string, r io.Reader, size int64) error {
+	dst := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+
+	w, err := ioutil.TempFile(filepath.Dir(dst), ".put-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(w.Name())
+
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(w.Name(), dst)
+}
@@ -0,0 +1,297 @@
+package store
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultS3Region   = "us-east-1"
+	defaultGCSRegion  = "auto"
+	defaultGCSBaseURL = "https://storage.googleapis.com"
+
+	// Uploads are streamed, so the body is not part of the signature.
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+
+	amzDateFormat = "20060102T150405Z"
+)
+
+// A store in an S3 bucket, or anything that speaks the S3 API with
+// SigV4 signing. That covers Google Cloud Storage with HMAC keys and
+// self-hosted servers like MinIO.
+type S3Store struct {
+	Bucket string `json:"bucket"`
+	Region string `json:"region"`
+
+	// The base url of the service. Defaults to the regional AWS endpoint.
+	Endpoint string `json:"endpoint"`
+
+	// Prepended to every key.
+	Prefix string `json:"prefix"`
+
+	// Names of the environment variables holding the credentials, so
+	// they don't have to be written into the config.
+	AccessKeyEnv    string `json:"access-key-env"`
+	SecretKeyEnv    string `json:"secret-key-env"`
+	SessionTokenEnv string `json:"session-token-env"`
+
+	client *http.Client
+	now    func() time.Time
+}
+
+func init() {
+	Register(newS3, "s3")
+	Register(newGCS, "gcs")
+}
+
+func parseS3(b []byte, client *http.Client) (*S3Store, error) {
+	s := &S3Store{
+		AccessKeyEnv: "AWS_ACCESS_KEY_ID",
+		SecretKeyEnv: "AWS_SECRET_ACCESS_KEY",
+		client:       client,
+		now:          time.Now,
+	}
+
+	if b != nil {
+		if err := json.Unmarshal(b, s); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Bucket == "" {
+		return nil, errors.New("store: a bucket is required")
+	}
+
+	return s, nil
+}
+
+func newS3(b []byte, client *http.Client) (Store, error) {
+	s, err := parseS3(b, client)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Region == "" {
+		s.Region = defaultS3Region
+	}
+
+	if s.Endpoint == "" {
+		s.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", s.Region)
+	}
+
+	return s, nil
+}
+
+// GCS accepts SigV4 requests signed with HMAC keys through its XML API.
+func newGCS(b []byte, client *http.Client) (Store, error) {
+	s, err := parseS3(b, client)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Region == "" {
+		s.Region = defaultGCSRegion
+	}
+
+	if s.Endpoint == "" {
+		s.Endpoint = defaultGCSBaseURL
+	}
+
+	return s, nil
+}
+
+// Objects are addressed path style so that buckets with dots in their
+// names work over https.
+func (s *S3Store) url(key string) string {
+	return fmt.Sprintf("%s/%s/%s",
+		strings.TrimSuffix(s.Endpoint, "/"),
+		s.Bucket,
+		s.Prefix+key)
+}
+
+func (s *S3Store) do(req *http.Request) (*http.Response, error) {
+	access, secret := os.Getenv(s.AccessKeyEnv), os.Getenv(s.SecretKeyEnv)
+	if access == "" || secret == "" {
+		return nil, fmt.Errorf("store: %s and %s must be set", s.AccessKeyEnv, s.SecretKeyEnv)
+	}
+
+	if s.SessionTokenEnv != "" {
+		req.Header.Set("X-Amz-Security-Token", os.Getenv(s.SessionTokenEnv))
+	}
+
+	signV4(req, access, secret, s.Region, "s3", s.now(), unsignedPayload)
+
+	return s.client.Do(req)
+}
+
+func (s *S3Store) Get(key string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", s.url(key), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res.Body, nil
+	case http.StatusNotFound:
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+
+	return nil, httpError(res)
+}
+
+func (s *S3Store) Put(key string, r io.Reader, size int64) error {
+	req, err := http.NewRequest("PUT", s.url(key), ioutil.NopCloser(r))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return httpError(res)
+	}
+
+	res.Body.Close()
+	return nil
+}
+
+// Turn an unexpected response into an error, consuming the body.
+func httpError(res *http.Response) error {
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("store: %s %s: %s: %s",
+		res.Request.Method,
+		res.Request.URL.Path,
+		res.Status,
+		strings.TrimSpace(string(body)))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data string) string {
+	h := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(h[:])
+}
+
+// Escape a path the way SigV4 wants it: everything but the unreserved
+// characters and slashes is percent encoded.
+func escapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func canonicalQuery(q url.Values) string {
+	var parts []string
+	for k, vs := range q {
+		for _, v := range vs {
+			parts = append(parts, escapePath(k)+"="+strings.Replace(escapePath(v), "/", "%2F", -1))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
+
+// Sign the request with AWS Signature Version 4. All headers already on
+// the request are signed along with the host.
+func signV4(req *http.Request, access, secret, region, service string, t time.Time, payloadHash string) {
+	t = t.UTC()
+	amzDate := t.Format(amzDateFormat)
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, vs := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(vs, ","))
+	}
+
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonHeaders, "%s:%s\n", k, headers[k])
+	}
+	signed := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if u, err := url.PathUnescape(path); err == nil {
+		path = escapePath(u)
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	canon := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	toSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex(canon),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		access,
+		scope,
+		signed,
+		hex.EncodeToString(hmacSHA256(key, toSign))))
+}
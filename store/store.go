@@ -0,0 +1,231 @@
+// Package store keeps copies of built indexes somewhere other than the
+// local dbpath, so that they can be shared between hound instances.
+package store
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned by Get when there is nothing stored under a key.
+var ErrNotFound = errors.New("store: not found")
+
+// A collection that maps store names to their underlying factory. Like
+// vcs drivers, a factory is handed the raw json config for the store.
+var stores = make(map[string]func(c []byte, client *http.Client) (Store, error))
+
+// Store is a flat namespace of objects addressed by slash separated keys.
+// The remote copy is authoritative; the dbpath acts as the local cache.
+type Store interface {
+	// Get returns the contents of key or ErrNotFound.
+	Get(key string) (io.ReadCloser, error)
+
+	// Put replaces the contents of key with size bytes read from r.
+	Put(key string, r io.Reader, size int64) error
+}
+
+// Register a new store under 1 or more names.
+func Register(fn func(c []byte, client *http.Client) (Store, error), names ...string) {
+	if fn == nil {
+		log.Panic("store: cannot register nil factory")
+	}
+
+	for _, name := range names {
+		stores[name] = fn
+	}
+}
+
+// Create a new Store from the name and configuration data. The client is
+// used by stores that talk http.
+func New(name string, cfg []byte, client *http.Client) (Store, error) {
+	f := stores[name]
+	if f == nil {
+		return nil, fmt.Errorf("store: %s is not a valid index store.", name)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return f(cfg, client)
+}
+
+// Get a small object, like a pointer to the latest index, into memory.
+func GetBytes(s Store, key string) ([]byte, error) {
+	r, err := s.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+// Put a small object that is already in memory.
+func PutBytes(s Store, key string, b []byte) error {
+	return s.Put(key, strings.NewReader(string(b)), int64(len(b)))
+}
+
+// PutDir archives the contents of dir and stores it under key.
+func PutDir(s Store, key, dir string) error {
+	f, err := ioutil.TempFile("", "hound-archive-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := archiveDir(f, dir); err != nil {
+		return err
+	}
+
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return s.Put(key, f, size)
+}
+
+// GetDir fetches the archive stored under key and unpacks it into dir,
+// which must not already exist. On failure dir is removed.
+func GetDir(s Store, key, dir string) error {
+	r, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := extractDir(r, dir); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+
+	return nil
+}
+
+func archiveDir(w io.Writer, dir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		if !fi.IsDir() && !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if fi.IsDir() {
+			return nil
+		}
+
+		r, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		_, err = io.Copy(tw, r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+func extractDir(r io.Reader, dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("store: %s already exists", dir)
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		name := filepath.FromSlash(hdr.Name)
+		if filepath.IsAbs(name) || strings.HasPrefix(filepath.Clean(name), "..") {
+			return fmt.Errorf("store: bad path in archive: %s", hdr.Name)
+		}
+		path := filepath.Join(dir, name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, os.ModePerm); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := extractFile(tr, path); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func extractFile(r io.Reader, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	w, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
@@ -0,0 +1,255 @@
+package structural
+
+import (
+	"bytes"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Language is the lexical syntax that matching has to respect: the text
+// in comments and string literals is never taken for code, so delimiters
+// inside them don't count towards balancing.
+type Language struct {
+	Name          string
+	LineComments  []string
+	BlockComments [][2]string
+
+	// String literals, with longer openings first.
+	Strings []StringSyntax
+}
+
+// StringSyntax describes one kind of string literal.
+type StringSyntax struct {
+	Open, Close string
+
+	// The character that escapes the one after it, or 0 for raw strings.
+	Escape byte
+
+	// Whether a doubled Close stands for itself, as in C# verbatim strings.
+	Doubled bool
+}
+
+var (
+	cComments     = [][2]string{{"/*", "*/"}}
+	cLineComments = []string{"//"}
+	dquote        = StringSyntax{Open: `"`, Close: `"`, Escape: '\\'}
+	squote        = StringSyntax{Open: `'`, Close: `'`, Escape: '\\'}
+	tripleDquote  = StringSyntax{Open: `"""`, Close: `"""`, Escape: '\\'}
+	tripleSquote  = StringSyntax{Open: `'''`, Close: `'''`, Escape: '\\'}
+	languageByExt = map[string]*Language{}
+)
+
+var (
+	// Go is the syntax of Go source.
+	Go = register(&Language{
+		Name:          "go",
+		LineComments:  cLineComments,
+		BlockComments: cComments,
+		Strings: []StringSyntax{
+			dquote,
+			squote,
+			{Open: "`", Close: "`"},
+		},
+	}, ".go")
+
+	// Java is the syntax of Java source, including text blocks.
+	Java = register(&Language{
+		Name:          "java",
+		LineComments:  cLineComments,
+		BlockComments: cComments,
+		Strings:       []StringSyntax{tripleDquote, dquote, squote},
+	}, ".java")
+
+	// CSharp is the syntax of C# source, including verbatim and raw
+	// strings.
+	CSharp = register(&Language{
+		Name:          "csharp",
+		LineComments:  cLineComments,
+		BlockComments: cComments,
+		Strings: []StringSyntax{
+			{Open: `"""`, Close: `"""`},
+			{Open: `@"`, Close: `"`, Doubled: true},
+			dquote,
+			squote,
+		},
+	}, ".cs")
+
+	// Python is the syntax of Python source.
+	Python = register(&Language{
+		Name:         "python",
+		LineComments: []string{"#"},
+		Strings:      []StringSyntax{tripleDquote, tripleSquote, dquote, squote},
+	}, ".py")
+
+	// Generic is used for files in other languages. It knows about C
+	// style comments and quoted strings, which covers most of them.
+	Generic = &Language{
+		Name:          "generic",
+		LineComments:  cLineComments,
+		BlockComments: cComments,
+		Strings:       []StringSyntax{dquote, squote},
+	}
+)
+
+func register(l *Language, exts ...string) *Language {
+	for _, ext := range exts {
+		languageByExt[ext] = l
+	}
+	return l
+}
+
+// LanguageFor picks the language of a file from its extension.
+func LanguageFor(filename string) *Language {
+	if l := languageByExt[strings.ToLower(filepath.Ext(filename))]; l != nil {
+		return l
+	}
+	return Generic
+}
+
+// A comment or string literal, as byte offsets.
+type span struct {
+	start, end int
+	comment    bool
+}
+
+// What a pass over a file learns about its structure.
+type doc struct {
+	src   []byte
+	spans []span
+
+	// The offsets of the opening delimiters outside of spans, in order,
+	// and of the delimiter that closes each of them or -1.
+	opens  []int
+	closes []int
+}
+
+func isOpen(c byte) bool {
+	return c == '(' || c == '[' || c == '{'
+}
+
+func isClose(c byte) bool {
+	return c == ')' || c == ']' || c == '}'
+}
+
+func closerOf(c byte) byte {
+	switch c {
+	case '(':
+		return ')'
+	case '[':
+		return ']'
+	}
+	return '}'
+}
+
+// Find the comments and strings of src and pair up its delimiters.
+func (l *Language) parse(src []byte) *doc {
+	d := &doc{src: src}
+
+	var stack []int
+	for p := 0; p < len(src); {
+		if s, ok := l.spanAt(src, p); ok {
+			d.spans = append(d.spans, s)
+			p = s.end
+			continue
+		}
+
+		c := src[p]
+		if isOpen(c) {
+			stack = append(stack, len(d.opens))
+			d.opens = append(d.opens, p)
+			d.closes = append(d.closes, -1)
+		} else if isClose(c) {
+			// pop to the opener this closes. A stray closer doesn't
+			// close anything.
+			for i := len(stack) - 1; i >= 0; i-- {
+				if closerOf(src[d.opens[stack[i]]]) == c {
+					d.closes[stack[i]] = p
+					stack = stack[:i]
+					break
+				}
+			}
+		}
+		p++
+	}
+
+	return d
+}
+
+// If a comment or string starts at p, find where it ends.
+func (l *Language) spanAt(src []byte, p int) (span, bool) {
+	rest := src[p:]
+	for _, lc := range l.LineComments {
+		if bytes.HasPrefix(rest, []byte(lc)) {
+			end := bytes.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			return span{p, p + end, true}, true
+		}
+	}
+
+	for _, bc := range l.BlockComments {
+		if bytes.HasPrefix(rest, []byte(bc[0])) {
+			end := bytes.Index(rest[len(bc[0]):], []byte(bc[1]))
+			if end < 0 {
+				return span{p, len(src), true}, true
+			}
+			return span{p, p + len(bc[0]) + end + len(bc[1]), true}, true
+		}
+	}
+
+	for _, ss := range l.Strings {
+		if bytes.HasPrefix(rest, []byte(ss.Open)) {
+			return span{p, p + ss.length(rest), false}, true
+		}
+	}
+
+	return span{}, false
+}
+
+// The length of the string literal at the start of b.
+func (ss *StringSyntax) length(b []byte) int {
+	for i := len(ss.Open); i < len(b); i++ {
+		if ss.Escape != 0 && b[i] == ss.Escape {
+			i++
+			continue
+		}
+
+		if !bytes.HasPrefix(b[i:], []byte(ss.Close)) {
+			// single quoted strings end with the line, even unclosed.
+			if b[i] == '\n' && len(ss.Close) == 1 && ss.Escape != 0 {
+				return i
+			}
+			continue
+		}
+
+		if ss.Doubled && bytes.HasPrefix(b[i+len(ss.Close):], []byte(ss.Close)) {
+			i += 2*len(ss.Close) - 1
+			continue
+		}
+
+		return i + len(ss.Close)
+	}
+	return len(b)
+}
+
+// The comment or string around p, if p is inside one.
+func (d *doc) spanAround(p int) (span, bool) {
+	i := sort.Search(len(d.spans), func(i int) bool {
+		return d.spans[i].end > p
+	})
+	if i < len(d.spans) && d.spans[i].start <= p {
+		return d.spans[i], true
+	}
+	return span{}, false
+}
+
+// Where the delimiter opened at p is closed, or -1.
+func (d *doc) closeOf(p int) int {
+	i := sort.SearchInts(d.opens, p)
+	if i < len(d.opens) && d.opens[i] == p {
+		return d.closes[i]
+	}
+	return -1
+}
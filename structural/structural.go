@@ -0,0 +1,324 @@
+// Package structural matches code against patterns with holes, like
+// foo(:[args], nil), that stand for balanced runs of code. Unlike a
+// regexp, a hole never stops partway through a nested call or a string
+// literal, so patterns can describe code by its shape.
+package structural
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Holes stop growing past this many bytes, which bounds the work spent
+// on each place a pattern could start.
+const maxHoleLen = 1 << 12
+
+// Matching gives up on a source after this many steps of its holes, so that
+// a pattern with many holes in a row, whose ways to split the code between
+// them grow with the power of their number, can't take forever on a file.
+const maxSteps = 1 << 20
+
+type elemKind int
+
+const (
+	word elemKind = iota
+	punct
+	hole
+)
+
+type elem struct {
+	kind elemKind
+	text string
+
+	// for holes, the index of the first hole with the same name, which
+	// this one has to match the same text as.
+	same int
+}
+
+// Pattern is a compiled structural pattern. A pattern is text, in which
+// :[name] is a hole. Whitespace is insignificant, except that it keeps
+// words apart, and comments in the code are skipped like whitespace. A
+// hole matches the shortest balanced run of code, which may be empty, that
+// lets the rest of the pattern match, except for a hole at the end which
+// runs to the end of the line. Holes with the same name must match the
+// same text, other than :[_] which is always anonymous.
+//
+// A Pattern is safe for concurrent use.
+type Pattern struct {
+	expr  string
+	elems []elem
+	names []string
+}
+
+// Match is a place where a pattern matched, as byte offsets of the source,
+// and the text of each named hole.
+type Match struct {
+	Start, End int
+	Holes      map[string]string
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+// Compile parses a structural pattern.
+func Compile(expr string) (*Pattern, error) {
+	p := &Pattern{expr: expr}
+	first := map[string]int{}
+
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case strings.HasPrefix(expr[i:], ":["):
+			end := strings.IndexByte(expr[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("structural: unclosed hole at %q", expr[i:])
+			}
+			name := expr[i+2 : i+end]
+			for j := 0; j < len(name); j++ {
+				if !isIdent(name[j]) {
+					return nil, fmt.Errorf("structural: invalid hole name %q", name)
+				}
+			}
+
+			if len(p.elems) == 0 {
+				return nil, errors.New("structural: a pattern has to start with text, not a hole")
+			}
+			if p.elems[len(p.elems)-1].kind == hole {
+				return nil, errors.New("structural: holes have to be separated by text")
+			}
+
+			e := elem{kind: hole, text: name, same: len(p.elems)}
+			if name != "" && name != "_" {
+				if j, ok := first[name]; ok {
+					e.same = j
+				} else {
+					first[name] = len(p.elems)
+					p.names = append(p.names, name)
+				}
+			}
+			p.elems = append(p.elems, e)
+			i += end + 1
+		case isSpace(c):
+			i++
+		case isIdent(c):
+			j := i
+			for j < len(expr) && isIdent(expr[j]) {
+				j++
+			}
+			p.elems = append(p.elems, elem{kind: word, text: expr[i:j]})
+			i = j
+		default:
+			p.elems = append(p.elems, elem{kind: punct, text: expr[i : i+1]})
+			i++
+		}
+	}
+
+	if len(p.elems) == 0 {
+		return nil, errors.New("structural: empty pattern")
+	}
+
+	return p, nil
+}
+
+// String returns the source text of the pattern.
+func (p *Pattern) String() string {
+	return p.expr
+}
+
+// Literals returns the words of the pattern, which every match contains.
+func (p *Pattern) Literals() []string {
+	var lits []string
+	for _, e := range p.elems {
+		if e.kind == word {
+			lits = append(lits, e.text)
+		}
+	}
+	return lits
+}
+
+// FindAll returns the matches of the pattern in src, which is code in the
+// given language, in order and without overlaps, and whether it looked
+// through all of src. If matching takes more than maxSteps, it stops with
+// the matches it found by then.
+func (p *Pattern) FindAll(src []byte, lang *Language) ([]*Match, bool) {
+	m := &matcher{
+		p:    p,
+		doc:  lang.parse(src),
+		vals: make([]string, len(p.elems)),
+	}
+
+	var matches []*Match
+	lead := []byte(p.elems[0].text)
+	for from := 0; from < len(src); {
+		i := bytes.Index(src[from:], lead)
+		if i < 0 {
+			break
+		}
+		start := from + i
+		from = start + 1
+
+		// matches only start in code.
+		if s, ok := m.doc.spanAround(start); ok && s.start < start {
+			from = s.end
+			continue
+		}
+
+		end := m.match(0, start)
+		if m.steps > maxSteps {
+			return matches, false
+		} else if end < 0 {
+			continue
+		}
+
+		match := &Match{Start: start, End: end}
+		if len(p.names) > 0 {
+			match.Holes = map[string]string{}
+			for i, e := range p.elems {
+				if e.kind == hole && e.same == i && e.text != "" && e.text != "_" {
+					match.Holes[e.text] = m.vals[i]
+				}
+			}
+		}
+		matches = append(matches, match)
+
+		if end > start {
+			from = end
+		}
+	}
+
+	return matches, true
+}
+
+type matcher struct {
+	p   *Pattern
+	doc *doc
+
+	// the text each hole matched on the way to the current position.
+	vals []string
+
+	// how many times holes have stepped, across the source.
+	steps int
+}
+
+// Skip over whitespace and comments.
+func (m *matcher) skipSpace(p int) int {
+	src := m.doc.src
+	for p < len(src) {
+		if isSpace(src[p]) {
+			p++
+			continue
+		}
+		if s, ok := m.doc.spanAround(p); ok && s.start == p && s.comment {
+			p = s.end
+			continue
+		}
+		break
+	}
+	return p
+}
+
+// Step over one piece of code at p: a comment or string, a balanced
+// group of delimiters, or a single byte. It returns -1 at the end of the
+// source or at a closing delimiter, which a hole can't go past.
+func (m *matcher) step(p int) int {
+	src := m.doc.src
+	if p >= len(src) {
+		return -1
+	}
+
+	if s, ok := m.doc.spanAround(p); ok {
+		return s.end
+	}
+
+	c := src[p]
+	if isOpen(c) {
+		end := m.doc.closeOf(p)
+		if end < 0 {
+			return -1
+		}
+		return end + 1
+	}
+
+	if isClose(c) {
+		return -1
+	}
+
+	return p + 1
+}
+
+// Match the elements of the pattern from i on at p, returning where the
+// match ends or -1.
+func (m *matcher) match(i, p int) int {
+	elems := m.p.elems
+	if i == len(elems) {
+		return p
+	}
+
+	src := m.doc.src
+	e := &elems[i]
+	switch e.kind {
+	case word, punct:
+		q := m.skipSpace(p)
+		if i == 0 {
+			q = p
+		}
+		if !bytes.HasPrefix(src[q:], []byte(e.text)) {
+			return -1
+		}
+
+		end := q + len(e.text)
+		if e.kind == word && (q > 0 && isIdent(src[q-1]) || end < len(src) && isIdent(src[end])) {
+			return -1
+		}
+
+		return m.match(i+1, end)
+	}
+
+	// a hole at the end takes the rest of the line.
+	if i == len(elems)-1 {
+		end := p
+		for end < len(src) && src[end] != '\n' {
+			next := m.step(end)
+			if next < 0 {
+				break
+			}
+			end = next
+		}
+		if !m.bind(i, p, end) {
+			return -1
+		}
+		return end
+	}
+
+	for end := p; end >= 0 && end-p <= maxHoleLen; end = m.step(end) {
+		if m.steps++; m.steps > maxSteps {
+			return -1
+		}
+		if !m.bind(i, p, end) {
+			continue
+		}
+		if r := m.match(i+1, end); r >= 0 {
+			return r
+		}
+	}
+
+	return -1
+}
+
+// Take src[p:end] as the text of hole i, if it agrees with any earlier
+// hole of the same name.
+func (m *matcher) bind(i, p, end int) bool {
+	v := string(bytes.TrimSpace(m.doc.src[p:end]))
+	if j := m.p.elems[i].same; j != i && m.vals[j] != v {
+		return false
+	}
+	m.vals[i] = v
+	return true
+}
@@ -0,0 +1,179 @@
+package structural
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func findAll(t *testing.T, pat, src string, lang *Language) []string {
+	p, err := Compile(pat)
+	if err != nil {
+		t.Fatalf("Compile(%q): %s", pat, err)
+	}
+
+	var got []string
+	ms, _ := p.FindAll([]byte(src), lang)
+	for _, m := range ms {
+		got = append(got, src[m.Start:m.End])
+	}
+	return got
+}
+
+func TestCompile(t *testing.T) {
+	bad := []string{
+		"",
+		"  ",
+		":[x] foo",
+		"foo(:[a]:[b])",
+		"foo(:[a",
+		"foo(:[a-b])",
+	}
+	for _, pat := range bad {
+		if _, err := Compile(pat); err == nil {
+			t.Errorf("Compile(%q) should fail", pat)
+		}
+	}
+
+	p, err := Compile("foo(:[args], nil)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lits := p.Literals(); !reflect.DeepEqual(lits, []string{"foo", "nil"}) {
+		t.Fatalf("expected literals foo and nil, got %v", lits)
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	tests := []struct {
+		pat, src string
+		lang     *Language
+		want     []string
+	}{
+		// holes span nested calls, but not unbalanced ones.
+		{
+			pat:  "foo(:[args], nil)",
+			src:  "foo(a, nil)\nfoo(bar(1, 2), nil)\nfoo(a, b)\nx(foo(z), nil)",
+			lang: Go,
+			want: []string{"foo(a, nil)", "foo(bar(1, 2), nil)"},
+		},
+		// whitespace and comments between tokens are insignificant.
+		{
+			pat:  "foo(:[a], nil)",
+			src:  "foo(\n\tx, /* nothing */ nil )",
+			lang: Go,
+			want: []string{"foo(\n\tx, /* nothing */ nil )"},
+		},
+		// delimiters in strings don't count; matches don't start in them.
+		{
+			pat:  "foo(:[a], nil)",
+			src:  "s := \"foo(x, nil)\"\nfoo(\")\", nil)\n// foo(y, nil)",
+			lang: Go,
+			want: []string{"foo(\")\", nil)"},
+		},
+		// words need boundaries.
+		{
+			pat:  "foo(:[a])",
+			src:  "xfoo(1) foo(2) foox(3)",
+			lang: Go,
+			want: []string{"foo(2)"},
+		},
+		// repeated holes match the same text.
+		{
+			pat:  "if :[x] == :[x]:",
+			src:  "if b == b:\nif b == c:",
+			lang: Python,
+			want: []string{"if b == b:"},
+		},
+		// a trailing hole runs to the end of the line.
+		{
+			pat:  "return :[rest]",
+			src:  "return a, f(b,\n\tc)\nreturn",
+			lang: Go,
+			want: []string{"return a, f(b,\n\tc)", "return"},
+		},
+		// python comments and strings.
+		{
+			pat:  "print(:[x])",
+			src:  "# print(a)\nprint(\"\"\")\"\"\")",
+			lang: Python,
+			want: []string{"print(\"\"\")\"\"\")"},
+		},
+		// verbatim strings in C#.
+		{
+			pat:  "Write(:[s]);",
+			src:  `Write(@"a "")"" b");`,
+			lang: CSharp,
+			want: []string{`Write(@"a "")"" b");`},
+		},
+	}
+
+	for _, test := range tests {
+		got := findAll(t, test.pat, test.src, test.lang)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q in %q: expected %q, got %q", test.pat, test.src, test.want, got)
+		}
+	}
+}
+
+func TestHoles(t *testing.T) {
+	p, err := Compile("assertEquals(:[want], :[got]);")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms, complete := p.FindAll([]byte(`assertEquals( "a,b" , list.get(0, 1) );`), Java)
+	if !complete {
+		t.Fatal("expected matching to look through the whole source")
+	}
+	if len(ms) != 1 {
+		t.Fatalf("expected 1 match, got %d", len(ms))
+	}
+
+	want := map[string]string{"want": `"a,b"`, "got": "list.get(0, 1)"}
+	if !reflect.DeepEqual(ms[0].Holes, want) {
+		t.Fatalf("expected holes %v, got %v", want, ms[0].Holes)
+	}
+}
+
+// Tests that a pattern whose holes can split a long call in more ways than
+// could ever be tried gives up on the file rather than hanging the search.
+func TestFindAllGivesUp(t *testing.T) {
+	p, err := Compile("f(:[a],:[b],:[c],:[d],X)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := "f(1,2,3,4,X)\nf(" + strings.Repeat("1,", 400) + "0)\n"
+
+	start := time.Now()
+	ms, complete := p.FindAll([]byte(src), Go)
+	if took := time.Since(start); took > 5*time.Second {
+		t.Fatalf("expected matching to give up promptly, took %s", took)
+	}
+
+	if complete {
+		t.Fatal("expected matching to report that it gave up")
+	}
+
+	if len(ms) != 1 || src[ms[0].Start:ms[0].End] != "f(1,2,3,4,X)" {
+		t.Fatalf("expected the match before the long call, got %v", ms)
+	}
+}
+
+func TestLanguageFor(t *testing.T) {
+	tests := map[string]*Language{
+		"a/b.go":     Go,
+		"Main.java":  Java,
+		"Prog.CS":    CSharp,
+		"setup.py":   Python,
+		"README":     Generic,
+		"index.html": Generic,
+	}
+	for name, want := range tests {
+		if got := LanguageFor(name); got != want {
+			t.Errorf("LanguageFor(%q): expected %s, got %s", name, want.Name, got.Name)
+		}
+	}
+}
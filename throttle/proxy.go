@@ -0,0 +1,306 @@
+package throttle
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dialTimeout = 30 * time.Second
+
+// Proxy is an http proxy on localhost that limits the traffic passing
+// through it. Commands like git can't be throttled from the outside, but
+// they can be pointed at a proxy. Each route through the proxy has its
+// own Limiter, and clients pick theirs with the user of the proxy url.
+// The password of the url is a secret of the proxy, so that other
+// processes on the host can't use the routes.
+type Proxy struct {
+	ln     net.Listener
+	srv    *http.Server
+	secret string
+
+	lck    sync.Mutex
+	routes map[string]*route
+}
+
+type route struct {
+	lim      *Limiter
+	upstream func(*http.Request) (*url.URL, error)
+	client   *http.Client
+}
+
+// NewProxy starts a proxy on a free port of localhost.
+func NewProxy() (*Proxy, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Proxy{
+		ln:     ln,
+		secret: hex.EncodeToString(b),
+		routes: map[string]*route{},
+	}
+	p.srv = &http.Server{Handler: p}
+	go p.srv.Serve(ln)
+
+	return p, nil
+}
+
+// Route returns the url of the proxy for traffic that is limited by lim
+// and then goes on through upstream, a proxy function like the ones of
+// http.Transport, which may be nil. The user must be safe to put in a
+// url. Routing the same user again replaces the route.
+func (p *Proxy) Route(user string, lim *Limiter, upstream func(*http.Request) (*url.URL, error)) string {
+	p.lck.Lock()
+	defer p.lck.Unlock()
+
+	p.routes[user] = &route{
+		lim:      lim,
+		upstream: upstream,
+		client: &http.Client{
+			Transport: &http.Transport{Proxy: upstream},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+
+	return fmt.Sprintf("http://%s:%s@%s", user, p.secret, p.ln.Addr())
+}
+
+// Addr is the address the proxy listens on.
+func (p *Proxy) Addr() string {
+	return p.ln.Addr().String()
+}
+
+// Close stops the proxy. Connections that are still open are not closed.
+func (p *Proxy) Close() error {
+	return p.srv.Close()
+}
+
+// Find the route of a request from its credentials.
+func (p *Proxy) routeFor(r *http.Request) *route {
+	auth := r.Header.Get("Proxy-Authorization")
+	if !strings.HasPrefix(auth, "Basic ") {
+		return nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(auth[len("Basic "):])
+	if err != nil {
+		return nil
+	}
+	cred := strings.SplitN(string(b), ":", 2)
+	if len(cred) != 2 || subtle.ConstantTimeCompare([]byte(cred[1]), []byte(p.secret)) != 1 {
+		return nil
+	}
+	user := cred[0]
+
+	p.lck.Lock()
+	defer p.lck.Unlock()
+	return p.routes[user]
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt := p.routeFor(r)
+	if rt == nil {
+		// curl only sends the credentials once it is asked for them.
+		w.Header().Set("Proxy-Authenticate", `Basic realm="hound"`)
+		http.Error(w, "Proxy Authentication Required", http.StatusProxyAuthRequired)
+		return
+	}
+
+	if r.Method == "CONNECT" {
+		rt.tunnel(w, r)
+	} else {
+		rt.forward(w, r)
+	}
+}
+
+// Pass the bytes of a CONNECT request, usually a TLS connection, both
+// ways.
+func (rt *route) tunnel(w http.ResponseWriter, r *http.Request) {
+	up, err := rt.dial(r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer up.Close()
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "unable to tunnel", http.StatusInternalServerError)
+		return
+	}
+
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		log.Printf("failed to tunnel to %s: %s", r.Host, err)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		return
+	}
+
+	done := make(chan bool, 2)
+	go func() {
+		io.Copy(up, rt.lim.Reader(brw))
+		done <- true
+	}()
+	go func() {
+		io.Copy(conn, rt.lim.Reader(up))
+		done <- true
+	}()
+
+	// once either side is done, closing both ends the other copy.
+	<-done
+}
+
+// Connect to host, through the upstream proxy if there is one.
+func (rt *route) dial(host string) (net.Conn, error) {
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Scheme: "https", Host: host},
+		Host:   host,
+		Header: http.Header{},
+	}
+
+	var u *url.URL
+	if rt.upstream != nil {
+		var err error
+		if u, err = rt.upstream(req); err != nil {
+			return nil, err
+		}
+	}
+
+	if u == nil {
+		return net.DialTimeout("tcp", host, dialTimeout)
+	}
+
+	conn, err := dialProxy(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+
+			base64.StdEncoding.EncodeToString([]byte(u.User.Username()+":"+pass)))
+	}
+
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %s", u.Host, res.Status)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &bufferedConn{conn, br}, nil
+}
+
+func dialProxy(u *url.URL) (net.Conn, error) {
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "https" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	if u.Scheme == "https" {
+		d := &net.Dialer{Timeout: dialTimeout}
+		return tls.DialWithDialer(d, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	}
+	return net.DialTimeout("tcp", host, dialTimeout)
+}
+
+// A connection whose first bytes were read into a bufio.Reader.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// Headers that only apply to one hop of a proxied request.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Make a plain http request on behalf of the client.
+func (rt *route) forward(w http.ResponseWriter, r *http.Request) {
+	if !r.URL.IsAbs() {
+		http.Error(w, "not a proxy request", http.StatusBadRequest)
+		return
+	}
+
+	req, err := http.NewRequest(r.Method, r.URL.String(), rt.lim.Reader(r.Body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.ContentLength = r.ContentLength
+	req.Header = r.Header.Clone()
+	for _, h := range hopHeaders {
+		req.Header.Del(h)
+	}
+
+	res, err := rt.client.Do(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+
+	for key, vals := range res.Header {
+		w.Header()[key] = vals
+	}
+	for _, h := range hopHeaders {
+		w.Header().Del(h)
+	}
+	w.WriteHeader(res.StatusCode)
+	io.Copy(w, rt.lim.Reader(res.Body))
+}
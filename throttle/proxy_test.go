@@ -0,0 +1,76 @@
+package throttle
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func get(t *testing.T, c *http.Client, u string) (int, string) {
+	res, err := c.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, string(b)
+}
+
+func clientFor(t *testing.T, proxy string, tr *http.Transport) *http.Client {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr = tr.Clone()
+	tr.Proxy = http.ProxyURL(u)
+	return &http.Client{Transport: tr}
+}
+
+func TestProxy(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+
+	https := httptest.NewTLSServer(h)
+	defer https.Close()
+
+	plain := httptest.NewServer(h)
+	defer plain.Close()
+
+	p, err := NewProxy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	u := p.Route("repo", NewLimiter(1<<20, nil), nil)
+	c := clientFor(t, u, https.Client().Transport.(*http.Transport))
+
+	// tunneled with CONNECT.
+	if code, body := get(t, c, https.URL); code != 200 || body != "hello" {
+		t.Fatalf("expected hello through the tunnel, got %d %q", code, body)
+	}
+
+	// forwarded as a plain request.
+	if code, body := get(t, c, plain.URL); code != 200 || body != "hello" {
+		t.Fatalf("expected hello through the proxy, got %d %q", code, body)
+	}
+
+	// clients without a route are asked for credentials.
+	c = clientFor(t, "http://"+p.Addr(), &http.Transport{})
+	if code, _ := get(t, c, plain.URL); code != http.StatusProxyAuthRequired {
+		t.Fatalf("expected %d, got %d", http.StatusProxyAuthRequired, code)
+	}
+
+	// and so are clients of the route that don't know the secret.
+	c = clientFor(t, "http://repo:x@"+p.Addr(), &http.Transport{})
+	if code, _ := get(t, c, plain.URL); code != http.StatusProxyAuthRequired {
+		t.Fatalf("expected %d without the secret, got %d", http.StatusProxyAuthRequired, code)
+	}
+}
@@ -0,0 +1,108 @@
+// Package throttle limits how fast bytes are read and written, so that
+// indexing in the background doesn't use up the network or the disk of a
+// host that it shares with other services.
+package throttle
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket of bytes that refills at a fixed rate. A
+// Limiter can have a parent, e.g. a limit for the whole daemon above the
+// limits of each repo, and then waits for both. A nil Limiter never
+// waits.
+type Limiter struct {
+	rate   float64 // bytes per second
+	parent *Limiter
+
+	lck    sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter makes a Limiter of rate bytes per second below parent, which
+// may be nil. If rate isn't positive, there is no limit of its own and
+// it returns parent.
+func NewLimiter(rate int64, parent *Limiter) *Limiter {
+	if rate <= 0 {
+		return parent
+	}
+
+	return &Limiter{
+		rate:   float64(rate),
+		parent: parent,
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until n bytes can be passed on.
+func (l *Limiter) Wait(n int) {
+	for ; l != nil; l = l.parent {
+		if d := l.reserve(n, time.Now()); d > 0 {
+			time.Sleep(d)
+		}
+	}
+}
+
+// Take n bytes from the bucket, which may leave it owing them, and return
+// how long it will take to pay them back. The bucket holds at most a
+// second's worth, so a burst after a quiet spell is short.
+func (l *Limiter) reserve(n int, now time.Time) time.Duration {
+	l.lck.Lock()
+	defer l.lck.Unlock()
+
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens += elapsed.Seconds() * l.rate
+		if l.tokens > l.rate {
+			l.tokens = l.rate
+		}
+		l.last = now
+	}
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// Reader returns a reader that waits for the bytes it has read from r.
+func (l *Limiter) Reader(r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &reader{r, l}
+}
+
+// Writer returns a writer that waits for bytes before it writes them to
+// w.
+func (l *Limiter) Writer(w io.Writer) io.Writer {
+	if l == nil {
+		return w
+	}
+	return &writer{w, l}
+}
+
+type reader struct {
+	r io.Reader
+	l *Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.l.Wait(n)
+	return n, err
+}
+
+type writer struct {
+	w io.Writer
+	l *Limiter
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	w.l.Wait(len(p))
+	return w.w.Write(p)
+}
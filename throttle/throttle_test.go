@@ -0,0 +1,72 @@
+package throttle
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestReserve(t *testing.T) {
+	l := NewLimiter(1000, nil)
+	now := l.last
+
+	// a second's worth is there right away.
+	if d := l.reserve(1000, now); d != 0 {
+		t.Fatalf("expected the first second not to wait, got %s", d)
+	}
+
+	if d := l.reserve(500, now); d != 500*time.Millisecond {
+		t.Fatalf("expected to wait for 500ms, got %s", d)
+	}
+
+	// the debt is paid back after half a second, and then it refills.
+	now = now.Add(1500 * time.Millisecond)
+	if d := l.reserve(1000, now); d != 0 {
+		t.Fatalf("expected the bucket to have refilled, got %s", d)
+	}
+
+	// it never holds more than a second's worth, however long it is idle.
+	now = now.Add(time.Hour)
+	if d := l.reserve(2000, now); d != time.Second {
+		t.Fatalf("expected to wait for a second, got %s", d)
+	}
+}
+
+func TestNoLimit(t *testing.T) {
+	if l := NewLimiter(0, nil); l != nil {
+		t.Fatalf("expected no limiter, got %+v", l)
+	}
+
+	parent := NewLimiter(10, nil)
+	if l := NewLimiter(-1, parent); l != parent {
+		t.Fatal("expected a repo without a limit to use the global one")
+	}
+
+	var l *Limiter
+	l.Wait(1 << 30)
+
+	r := bytes.NewReader([]byte("hello"))
+	if l.Reader(r) != r {
+		t.Fatal("expected a nil limiter to leave readers alone")
+	}
+}
+
+func TestReader(t *testing.T) {
+	l := NewLimiter(50000, NewLimiter(100000, nil))
+
+	start := time.Now()
+	b, err := ioutil.ReadAll(l.Reader(bytes.NewReader(make([]byte, 75000))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b) != 75000 {
+		t.Fatalf("expected 75000 bytes, got %d", len(b))
+	}
+
+	// 50000 pass right away and the rest take half a second.
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Fatalf("expected reading to be throttled, it took %s", d)
+	}
+}
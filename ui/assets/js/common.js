@@ -5,11 +5,38 @@ export function ExpandVars(template, values) {
     return template;
 };
 
+/**
+ * Make the anchor of a link to a line, or to a range of lines like
+ * { start : 12, end : 14, startcol : 5, endcol : 20 }. Ranges use the
+ * range-anchor of the pattern, if it has one, or else link to their
+ * first line.
+ */
+export function AnchorFor(pattern, filename, line) {
+    if (!line) {
+        return '';
+    }
+
+    if (typeof line === 'object') {
+        if (line.end > line.start && pattern['range-anchor']) {
+            return ExpandVars(pattern['range-anchor'], {
+                start : line.start,
+                end : line.end,
+                startcol : line.startcol || 1,
+                endcol : line.endcol || 1,
+                filename : filename
+            });
+        }
+        line = line.start;
+    }
+
+    return ExpandVars(pattern.anchor, { line : line, filename : filename });
+}
+
 export function UrlToRepo(repo, path, line, rev) {
     var url = repo.url.replace(/\.git$/, ''),
         pattern = repo['url-pattern'],
         filename = path.substring(path.lastIndexOf('/') + 1),
-        anchor = line ? ExpandVars(pattern.anchor, { line : line, filename : filename }) : '';
+        anchor = AnchorFor(pattern, filename, line);
 
     // Determine if the URL passed is a GitHub wiki
     var wikiUrl = /\.wiki$/.exec(url);
@@ -31,6 +58,16 @@ export function UrlToRepo(repo, path, line, rev) {
         url = '//' + sshParts[2] + '/' + sshParts[4];
     }
 
+    // the markdown files of docs repos link to their rendered pages.
+    if (pattern['page-url'] && /\.(md|markdown|mdown|mkd|mdx)$/i.test(path)) {
+        return ExpandVars(pattern['page-url'], {
+            url : url,
+            page : path.replace(/\.[^.\/]+$/, ''),
+            path : path,
+            rev : rev
+        });
+    }
+
     // I'm sure there is a nicer React/jsx way to do this:
     return ExpandVars(pattern['base-url'], {
         url : url,
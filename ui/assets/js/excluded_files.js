@@ -120,7 +120,7 @@ var FilterableExcludedFiles = React.createClass({
   render: function() {
     return (
       <div id="excluded_container">
-        <a href="/">Home</a>
+        <a href="./">Home</a>
         <h1>Excluded Files</h1>
 
         <div id="excluded_files" className="table-container">
@@ -64,7 +64,16 @@ var ParamsFromQueryString = function(qs, params) {
     // when Hound is set up in Chrome's Search Engine Manager settings
     pair[1] = pair[1].replace(/\+/g, ' ');
 
-    params[decodeURIComponent(pair[0])] = decodeURIComponent(pair[1]);
+    var key = decodeURIComponent(pair[0]),
+        val = decodeURIComponent(pair[1]);
+
+    // params that can be repeated, like within, are lists.
+    if (Array.isArray(params[key])) {
+      params[key].push(val);
+      return;
+    }
+
+    params[key] = val;
   });
 
 
@@ -74,11 +83,164 @@ var ParamsFromQueryString = function(qs, params) {
 var ParamsFromUrl = function(params) {
   params = params || {
     q: '',
-    i: 'nope',
+    i: '',
+    'case': '',
+    word: '',
     files: '',
-    repos: '*'
+    excludeFiles: '',
+    repos: '*',
+    mode: '',
+    within: [],
+    filter: []
+  };
+  params = ParamsFromQueryString(location.search, params);
+  params['case'] = CaseModeFromParams(params);
+  return params;
+};
+
+/**
+ * The extensions of the languages that a file filter can pick.
+ */
+var LanguageExtensions = {
+  'C': ['c', 'h'],
+  'C++': ['cc', 'cpp', 'cxx', 'hh', 'hpp', 'hxx'],
+  'C#': ['cs'],
+  'CSS': ['css', 'less', 'scss'],
+  'Go': ['go'],
+  'HTML': ['htm', 'html'],
+  'Java': ['java'],
+  'JavaScript': ['js', 'jsx', 'mjs'],
+  'JSON': ['json'],
+  'Kotlin': ['kt', 'kts'],
+  'Markdown': ['md', 'markdown'],
+  'PHP': ['php'],
+  'Protobuf': ['proto'],
+  'Python': ['py'],
+  'Ruby': ['rb'],
+  'Rust': ['rs'],
+  'Scala': ['scala'],
+  'Shell': ['bash', 'sh'],
+  'SQL': ['sql'],
+  'Swift': ['swift'],
+  'TypeScript': ['ts', 'tsx'],
+  'YAML': ['yaml', 'yml']
+};
+
+/**
+ * The kinds of file filters, with what the UI calls them. Paths are matched
+ * literally, anywhere in the path unless they start with a / in which case
+ * they are anchored to the root of the repo.
+ */
+var FileFilterKinds = [
+  { kind: 'path', label: 'Path' },
+  { kind: '-path', label: 'Not path' },
+  { kind: 'ext', label: 'Extension' },
+  { kind: 'lang', label: 'Language' },
+  { kind: 'regexp', label: 'Path regexp' },
+  { kind: '-regexp', label: 'Not path regexp' }
+];
+
+var EscapeRegExp = function(s) {
+  return s.replace(/[\\^$.*+?()[\]{}|]/g, '\\$&');
+};
+
+var PathToRegExp = function(path) {
+  if (path.charAt(0) == '/') {
+    return '^' + EscapeRegExp(path.substring(1));
+  }
+  return EscapeRegExp(path);
+};
+
+/**
+ * Parse a filter of the url, which is its kind and its value, like ext:go.
+ */
+var FileFilterFromString = function(v) {
+  var ix = v.indexOf(':');
+  if (ix < 0) {
+    return null;
+  }
+
+  var kind = v.substring(0, ix);
+  for (var i = 0, n = FileFilterKinds.length; i < n; i++) {
+    if (FileFilterKinds[i].kind == kind) {
+      return { kind: kind, value: v.substring(ix + 1) };
+    }
+  }
+  return null;
+};
+
+var FileFilterToString = function(f) {
+  return f.kind + ':' + f.value;
+};
+
+/**
+ * Compile the file filters to the files and excludeFiles regexps of the
+ * API. A file has to match one of the paths, if there are any, and have one
+ * of the extensions, if there are any, and must not match any of the
+ * negated paths.
+ */
+var FileFiltersToRegExps = function(filters) {
+  var paths = [],
+      exts = [],
+      excluded = [];
+  filters.forEach(function(f) {
+    switch (f.kind) {
+    case 'path':
+      paths.push(PathToRegExp(f.value));
+      break;
+    case '-path':
+      excluded.push(PathToRegExp(f.value));
+      break;
+    case 'ext':
+      exts.push(EscapeRegExp(f.value.replace(/^\./, '')));
+      break;
+    case 'lang':
+      (LanguageExtensions[f.value] || []).forEach(function(ext) {
+        exts.push(EscapeRegExp(ext));
+      });
+      break;
+    case 'regexp':
+      paths.push(f.value);
+      break;
+    case '-regexp':
+      excluded.push(f.value);
+      break;
+    }
+  });
+
+  var files = '';
+  if (paths.length > 0) {
+    files = '(?:' + paths.join('|') + ')';
+  }
+  if (exts.length > 0) {
+    files += (files ? '.*' : '') + '\\.(?:' + exts.join('|') + ')$';
+  }
+
+  return {
+    files: files,
+    excludeFiles: excluded.length > 0 ? '(?:' + excluded.join('|') + ')' : ''
   };
-  return ParamsFromQueryString(location.search, params);
+};
+
+/**
+ * The file filters of the url. Links from before there were filters only
+ * have the regexps, which become regexp filters.
+ */
+var FileFiltersFromParams = function(params) {
+  var filters = (params.filter || []).map(FileFilterFromString).filter(function(f) {
+    return f !== null;
+  });
+  if (filters.length > 0) {
+    return filters;
+  }
+
+  if (params.files) {
+    filters.push({ kind: 'regexp', value: params.files });
+  }
+  if (params.excludeFiles) {
+    filters.push({ kind: '-regexp', value: params.excludeFiles });
+  }
+  return filters;
 };
 
 var ParamValueToBool = function(v) {
@@ -86,10 +248,85 @@ var ParamValueToBool = function(v) {
   return v == 'fosho' || v == 'true' || v == '1';
 };
 
+/**
+ * The modes of matching case. Smart case ignores it unless the pattern
+ * has an upper case letter, like ripgrep.
+ */
+var CaseModes = [
+  { value: 'smart', label: 'Smart' },
+  { value: 'sensitive', label: 'Match case' },
+  { value: 'insensitive', label: 'Ignore case' }
+];
+
+/**
+ * The case mode of the params of a url, which is smart unless it says
+ * otherwise. Older links only have i, which was off by default.
+ */
+var CaseModeFromParams = function(params) {
+  var mode = params['case'] || '';
+  for (var i = 0; i < CaseModes.length; i++) {
+    if (CaseModes[i].value == mode) {
+      return mode;
+    }
+  }
+
+  if (!params.i) {
+    return 'smart';
+  }
+  return ParamValueToBool(params.i) ? 'insensitive' : 'sensitive';
+};
+
+/**
+ * Whether a pattern has an upper case letter of its own, leaving out
+ * those of escapes like \S, \pL and \x4A and the names of groups. This
+ * is the same as the check of the server.
+ */
+var HasUpperCase = function(pat) {
+  for (var i = 0; i < pat.length; i++) {
+    var c = pat.charAt(i);
+    if (c == '\\' && i + 1 < pat.length) {
+      i++;
+      c = pat.charAt(i);
+      if (c == 'p' || c == 'P' || c == 'x') {
+        if (pat.charAt(i + 1) == '{') {
+          while (i < pat.length && pat.charAt(i) != '}') {
+            i++;
+          }
+        } else {
+          i += c == 'x' ? 2 : 1;
+        }
+      }
+    } else if (c == '(' && pat.substr(i, 4) == '(?P<') {
+      while (i < pat.length && pat.charAt(i) != '>') {
+        i++;
+      }
+    } else if (c != c.toLowerCase()) {
+      return true;
+    }
+  }
+  return false;
+};
+
+/**
+ * Whether a search of pat in a case mode ignores case.
+ */
+var IgnoresCase = function(mode, pat) {
+  return mode == 'insensitive' || (mode == 'smart' && !HasUpperCase(pat));
+};
+
 /**
  * The data model for the UI is responsible for conducting searches and managing
  * all results.
  */
+/**
+ * The message of an error response of the API, or a generic one if the
+ * server didn't send one.
+ */
+var ErrorMessage = function(xhr) {
+  var data = xhr.responseJSON;
+  return data && data.Error ? data.Error : "The server broke down";
+};
+
 var Model = {
   // raised when a search begins
   willSearch: new Signal(),
@@ -105,6 +342,49 @@ var Model = {
 
   didLoadRepos : new Signal(),
 
+  // what the user set in their preferences, if they are known.
+  prefs: {},
+
+  // the searches that the server suggests retrying with, when the last
+  // one found nothing or failed.
+  suggestions: [],
+
+  // where to go on from, when the server cut the results of the last
+  // search short to keep its response small.
+  cursor: '',
+
+  // The url of the search of the page with some of its params changed,
+  // as a suggestion has them.
+  UrlForRetry: function(changed) {
+    var params = $.extend({}, this.params, changed);
+    // the path filters of the search bar would put back the old files.
+    if ('files' in changed) {
+      delete params.filter;
+    }
+    ['stats', 'suggest', 'rng', 'ctx'].forEach(function(key) {
+      delete params[key];
+    });
+    return location.pathname + '?' + $.param(params, true);
+  },
+
+  // the repos that are searched unless the user picks others, and those
+  // listed first, as the config has them.
+  scope: (typeof ScopeData != 'undefined') ? JSON.parse(ScopeData) : {},
+
+  // The names of the repos in the order the repo filter lists them: the
+  // pinned ones first, then the rest by name.
+  OrderedRepos: function() {
+    var all = this.repos,
+        pinned = this.ValidRepos(this.scope.Pinned || []),
+        isPinned = {};
+    pinned.forEach(function(repo) {
+      isPinned[repo] = true;
+    });
+    return pinned.concat(Object.keys(all).filter(function(repo) {
+      return !isPinned[repo];
+    }).sort());
+  },
+
   ValidRepos: function(repos) {
     var all = this.repos,
         seen = {};
@@ -160,17 +440,24 @@ var Model = {
     var _this = this,
         startedAt = Date.now();
 
-    params = $.extend({
+    var defaults = {
       stats: 'fosho',
+      suggest: 'fosho',
       repos: '*',
-      rng: ':20',
-    }, params);
+      rng: ':' + (this.prefs.ResultsPerPage || 20),
+    };
+    if (this.prefs.LinesOfContext != null) {
+      defaults.ctx = this.prefs.LinesOfContext;
+    }
+    params = $.extend(defaults, params);
 
     if (params.repos === '') {
       params.repos = '*';
     }
 
     _this.params = params;
+    _this.suggestions = [];
+    _this.cursor = '';
 
     // An empty query is basically useless, so rather than
     // sending it to the server and having the server do work
@@ -186,9 +473,13 @@ var Model = {
     $.ajax({
       url: 'api/v1/search',
       data: params,
+      // send within as repeated params rather than within[].
+      traditional: true,
       type: 'GET',
       dataType: 'json',
       success: function(data) {
+        _this.suggestions = data.Suggestions || [];
+        _this.cursor = data.Cursor || '';
         if (data.Error) {
           _this.didError.raise(_this, data.Error);
           return;
@@ -206,13 +497,15 @@ var Model = {
           results.push({
             Repo: repo,
             Rev: res.Revision,
-            Matches: res.Matches,
+            Matches: res.Matches || [],
             FilesWithMatch: res.FilesWithMatch,
+            FilenameHits: res.FilenameHits || [],
           });
         }
 
         results.sort(function(a, b) {
-          return b.Matches.length - a.Matches.length || a.Repo.localeCompare(b.Repo);
+          return (b.Matches.length + b.FilenameHits.length) - (a.Matches.length + a.FilenameHits.length) ||
+            a.Repo.localeCompare(b.Repo);
         });
 
         var byRepo = {};
@@ -231,7 +524,7 @@ var Model = {
         _this.didSearch.raise(_this, _this.results, _this.stats);
       },
       error: function(xhr, status, err) {
-        _this.didError.raise(this, "The server broke down");
+        _this.didError.raise(this, ErrorMessage(xhr));
       }
     });
   },
@@ -254,6 +547,7 @@ var Model = {
     $.ajax({
       url: 'api/v1/search',
       data: params,
+      traditional: true,
       type: 'GET',
       dataType: 'json',
       success: function(data) {
@@ -267,7 +561,89 @@ var Model = {
         _this.didLoadMore.raise(_this, repo, _this.results);
       },
       error: function(xhr, status, err) {
-        _this.didError.raise(this, "The server broke down");
+        _this.didError.raise(this, ErrorMessage(xhr));
+      }
+    });
+  },
+
+  // Go on from where the server cut the results of the search short,
+  // adding the files that it returns to those of the repos.
+  LoadRest: function() {
+    var _this = this,
+        params = $.extend({}, this.params, { cursor: this.cursor });
+
+    $.ajax({
+      url: 'api/v1/search',
+      data: params,
+      traditional: true,
+      type: 'GET',
+      dataType: 'json',
+      success: function(data) {
+        if (data.Error) {
+          _this.didError.raise(_this, data.Error);
+          return;
+        }
+
+        _this.cursor = data.Cursor || '';
+        var matches = data.Results;
+        for (var repo in matches) {
+          if (!matches[repo]) {
+            continue;
+          }
+
+          // the repo that was cut short comes back with the rest of its
+          // files.
+          var res = matches[repo],
+              have = _this.resultsByRepo[repo];
+          if (have) {
+            have.Matches = have.Matches.concat(res.Matches || []);
+            continue;
+          }
+
+          have = {
+            Repo: repo,
+            Rev: res.Revision,
+            Matches: res.Matches || [],
+            FilesWithMatch: res.FilesWithMatch,
+            FilenameHits: res.FilenameHits || [],
+          };
+          _this.results.push(have);
+          _this.resultsByRepo[repo] = have;
+        }
+        _this.didLoadMore.raise(_this, null, _this.results);
+      },
+      error: function(xhr, status, err) {
+        _this.didError.raise(this, ErrorMessage(xhr));
+      }
+    });
+  },
+
+  Blame: function(repo, path, lines, rev, done) {
+    $.ajax({
+      url: 'api/v1/blame',
+      data: {
+        repo: repo,
+        path: path,
+        lines: lines.join(','),
+        rev: rev || ''
+      },
+      type: 'GET',
+      dataType: 'json',
+      success: function(data) {
+        if (data && data.Error) {
+          done(null, data.Error);
+          return;
+        }
+
+        var byLine = {};
+        (data || []).forEach(function(b) {
+          byLine[b.Line] = b;
+        });
+        done(byLine, null);
+      },
+      error: function(xhr, status, err) {
+        var data = xhr.responseJSON;
+        done(null, data && data.Error ? data.Error : 'Blame is not available');
       }
     });
   },
@@ -308,11 +684,37 @@ var RepoOption = React.createClass({
   }
 });
 
+/**
+ * The retries that the server suggests for a search that found nothing,
+ * each a link to the search it suggests.
+ */
+var SuggestionsView = React.createClass({
+  render: function() {
+    var suggestions = this.props.suggestions || [];
+    if (suggestions.length === 0) {
+      return <div />;
+    }
+
+    var items = suggestions.map(function(s) {
+      if (!s.Params) {
+        return <li>{s.Message}</li>;
+      }
+      return <li><a href={Model.UrlForRetry(s.Params)}>{s.Message}</a></li>;
+    });
+    return (
+      <div className="suggestions">
+        <div>Did you mean to:</div>
+        <ul>{items}</ul>
+      </div>
+    );
+  }
+});
+
 var SearchBar = React.createClass({
   componentWillMount: function() {
     var _this = this;
     Model.didLoadRepos.tap(function(model, repos) {
-      _this.setState({ allRepos: Object.keys(repos) });
+      _this.setState({ allRepos: model.OrderedRepos() });
     });
   },
 
@@ -334,7 +736,9 @@ var SearchBar = React.createClass({
     return {
       state: null,
       allRepos: [],
-      repos: []
+      repos: [],
+      within: [],
+      filters: []
     };
   },
   queryGotKeydown: function(event) {
@@ -357,29 +761,104 @@ var SearchBar = React.createClass({
     }
   },
   filesGotKeydown: function(event) {
+    var files = this.refs.files.getDOMNode();
     switch (event.keyCode) {
     case 38:
       // if advanced is empty, close it up.
-      if (this.refs.files.getDOMNode().value.trim() === '') {
+      if (files.value.trim() === '' && this.state.filters.length === 0) {
         this.hideAdvanced();
       }
       this.refs.q.getDOMNode().focus();
       break;
+    case 8:
+      // backspace in an empty box takes off the last filter.
+      if (files.value === '' && this.state.filters.length > 0) {
+        this.removeFilter(this.state.filters.length - 1);
+      }
+      break;
     case 13:
-      this.submitQuery();
+      // enter adds what is in the box as a filter, or searches if the box
+      // is empty.
+      if (!this.addFilter()) {
+        this.submitQuery();
+      }
       break;
     }
   },
+  addFilter: function() {
+    var files = this.refs.files.getDOMNode(),
+        kind = this.refs.filterKind.getDOMNode().value,
+        value = kind == 'lang' ? this.refs.filterLang.getDOMNode().value : files.value.trim();
+    if (value === '') {
+      return false;
+    }
+
+    var dup = this.state.filters.some(function(f) {
+      return f.kind == kind && f.value == value;
+    });
+    if (dup) {
+      files.value = '';
+      return false;
+    }
+
+    this.setState({ filters: this.state.filters.concat([{ kind: kind, value: value }]) });
+    files.value = '';
+    return true;
+  },
+  removeFilter: function(index) {
+    var filters = this.state.filters.slice();
+    filters.splice(index, 1);
+    this.setState({ filters: filters });
+  },
+  filterKindChanged: function(event) {
+    this.setState({ filterKind: event.target.value });
+  },
   filesGotFocus: function(event) {
     this.showAdvanced();
   },
   submitQuery: function() {
     this.props.onSearchRequested(this.getParams());
   },
+  // Keep the current query as one the next search has to match as well,
+  // so that a big set of results can be narrowed down with another one.
+  refineQuery: function() {
+    var q = this.refs.q.getDOMNode(),
+        pat = q.value.trim();
+    if (pat === '') {
+      return;
+    }
+
+    var ignoreCase = IgnoresCase(this.refs.caseMode.getDOMNode().value, pat);
+    if (this.refs.word.getDOMNode().checked) {
+      pat = '\\b(?:' + pat + ')\\b';
+    }
+    if (ignoreCase) {
+      pat = '(?i)' + pat;
+    }
+
+    this.setState({ within: this.state.within.concat([pat]) });
+    q.value = '';
+    q.focus();
+  },
+  removeWithin: function(index) {
+    var within = this.state.within.slice();
+    within.splice(index, 1);
+    this.setState({ within: within }, function() {
+      if (this.refs.q.getDOMNode().value.trim() !== '') {
+        this.submitQuery();
+      }
+    });
+  },
   getRegExp : function() {
+    // structural patterns aren't regexps, so there is nothing to highlight.
+    if (this.refs.structural.getDOMNode().checked) {
+      return /(?!)/g;
+    }
+
+    var pat = this.refs.q.getDOMNode().value.trim();
     return new RegExp(
-      this.refs.q.getDOMNode().value.trim(),
-      this.refs.icase.getDOMNode().checked ? 'ig' : 'g');
+      this.refs.word.getDOMNode().checked ? '\\b(?:' + pat + ')\\b' : pat,
+      IgnoresCase(this.refs.caseMode.getDOMNode().value, pat) ? 'ig' : 'g');
   },
   getParams: function() {
     // selecting all repos is the same as not selecting any, so normalize the url
@@ -389,24 +868,43 @@ var SearchBar = React.createClass({
       repos = [];
     }
 
+    // anything left in the filter box counts, as if enter had been hit.
+    var filters = this.state.filters.slice(),
+        kind = this.refs.filterKind.getDOMNode().value,
+        pending = this.refs.files.getDOMNode().value.trim();
+    if (pending !== '' && kind != 'lang') {
+      filters.push({ kind: kind, value: pending });
+    }
+
+    var res = FileFiltersToRegExps(filters);
     return {
       q : this.refs.q.getDOMNode().value.trim(),
-      files : this.refs.files.getDOMNode().value.trim(),
+      files : res.files,
+      excludeFiles : res.excludeFiles,
+      filter : filters.map(FileFilterToString),
       repos : repos.join(','),
-      i: this.refs.icase.getDOMNode().checked ? 'fosho' : 'nope'
+      'case': this.refs.caseMode.getDOMNode().value,
+      word: this.refs.word.getDOMNode().checked ? 'true' : '',
+      mode: this.refs.structural.getDOMNode().checked ? 'structural' : '',
+      within: this.state.within
     };
   },
   setParams: function(params) {
     var q = this.refs.q.getDOMNode(),
-        i = this.refs.icase.getDOMNode(),
-        files = this.refs.files.getDOMNode();
+        structural = this.refs.structural.getDOMNode();
 
     q.value = params.q;
-    i.checked = ParamValueToBool(params.i);
-    files.value = params.files;
+    this.refs.caseMode.getDOMNode().value = params.caseMode || CaseModeFromParams(params);
+    this.refs.word.getDOMNode().checked = ParamValueToBool(params.word || '');
+    structural.checked = params.mode == 'structural';
+    this.refs.files.getDOMNode().value = '';
+    this.setState({
+      within: params.within || [],
+      filters: FileFiltersFromParams(params)
+    });
   },
   hasAdvancedValues: function() {
-    return this.refs.files.getDOMNode().value.trim() !== '' || this.refs.icase.getDOMNode().checked || this.refs.repos.getDOMNode().value !== '';
+    return this.state.filters.length > 0 || this.refs.files.getDOMNode().value.trim() !== '' || this.refs.caseMode.getDOMNode().value != 'smart' || this.refs.word.getDOMNode().checked || this.refs.structural.getDOMNode().checked || this.refs.repos.getDOMNode().value !== '';
   },
   showAdvanced: function() {
     var adv = this.refs.adv.getDOMNode(),
@@ -470,8 +968,45 @@ var SearchBar = React.createClass({
       );
     }
 
+    var _this = this,
+        isLang = this.state.filterKind == 'lang',
+        filterKinds = FileFilterKinds.map(function(k) {
+          return <option value={k.kind}>{k.label}</option>;
+        }),
+        languages = Object.keys(LanguageExtensions).map(function(lang) {
+          return <option value={lang}>{lang}</option>;
+        });
+
+    var filterChips = this.state.filters.map(function(f, index) {
+      var label = FileFilterKinds.filter(function(k) {
+        return k.kind == f.kind;
+      })[0].label;
+      return (
+        <span className={'filter-chip' + (f.kind.charAt(0) == '-' ? ' negated' : '')}>
+          <em>{label}</em> {f.value}
+          <span className="octicon octicon-x" onClick={_this.removeFilter.bind(_this, index)}></span>
+        </span>
+      );
+    });
+
+    var withinView = '';
+    if (this.state.within.length > 0) {
+      var chips = this.state.within.map(function(pat, index) {
+        return (
+          <span className="within-chip" title="Only files that also match this are searched">
+            {pat}
+            <span className="octicon octicon-x" onClick={_this.removeWithin.bind(_this, index)}></span>
+          </span>
+        );
+      });
+      withinView = (
+        <div id="within"><em>Within:</em>{chips}</div>
+      );
+    }
+
     return (
       <div id="input">
+        {withinView}
         <div id="ina">
           <input id="q"
               type="text"
@@ -480,6 +1015,9 @@ var SearchBar = React.createClass({
               autocomplete="off"
               onKeyDown={this.queryGotKeydown}
               onFocus={this.queryGotFocus}/>
+          <div className="button-add-on">
+            <button id="refine" title="Search within the results of this query" onClick={this.refineQuery}>Refine</button>
+          </div>
           <div className="button-add-on">
             <button id="dodat" onClick={this.submitQuery}></button>
           </div>
@@ -489,20 +1027,46 @@ var SearchBar = React.createClass({
           <div id="adv" ref="adv">
             <span className="octicon octicon-chevron-up hide-adv" onClick={this.hideAdvanced}></span>
             <div className="field">
-              <label htmlFor="files">File Path</label>
+              <label htmlFor="files">Files</label>
               <div className="field-input">
-                <input type="text"
-                    id="files"
-                    placeholder="regexp"
-                    ref="files"
-                    onKeyDown={this.filesGotKeydown}
-                    onFocus={this.filesGotFocus} />
+                <div className="file-filters">{filterChips}</div>
+                <select className="filter-kind" ref="filterKind" onChange={this.filterKindChanged}>
+                  {filterKinds}
+                </select>
+                <select className="filter-lang" ref="filterLang" style={{display: isLang ? '' : 'none'}}>
+                  {languages}
+                </select>
+                <div className="filter-box">
+                  <input type="text"
+                      id="files"
+                      placeholder={isLang ? 'enter to add' : 'e.g. src/ or /cmd, then enter'}
+                      ref="files"
+                      onKeyDown={this.filesGotKeydown}
+                      onFocus={this.filesGotFocus} />
+                </div>
               </div>
             </div>
             <div className="field">
-              <label htmlFor="ignore-case">Ignore Case</label>
+              <label htmlFor="case-mode">Case</label>
               <div className="field-input">
-                <input id="ignore-case" type="checkbox" ref="icase" />
+                <select id="case-mode" ref="caseMode"
+                    title="Smart case ignores case unless the query has an upper case letter">
+                  {CaseModes.map(function(m) {
+                    return <option value={m.value}>{m.label}</option>;
+                  })}
+                </select>
+              </div>
+            </div>
+            <div className="field">
+              <label htmlFor="whole-word">Whole Word</label>
+              <div className="field-input">
+                <input id="whole-word" type="checkbox" ref="word" />
+              </div>
+            </div>
+            <div className="field">
+              <label htmlFor="structural">Structural</label>
+              <div className="field-input">
+                <input id="structural" type="checkbox" ref="structural" />
               </div>
             </div>
             <div className="field">
@@ -536,21 +1100,25 @@ var MatchToLines = function(match) {
     lines.push({
       Number : base - nBefore + index,
       Content: line,
-      Match: false
+      Match: false,
+      Cell: match.Cell
     });
   });
 
   lines.push({
     Number: base,
     Content: match.Line,
-    Match: true
+    Match: true,
+    Spans: match.Spans,
+    Cell: match.Cell
   });
 
   match.After.forEach(function(line, index) {
     lines.push({
       Number: base + index + 1,
       Content: line,
-      Match: false
+      Match: false,
+      Cell: match.Cell
     });
   });
 
@@ -583,7 +1151,9 @@ var CoalesceMatches = function(matches) {
         } else if (current && line.Match) {
           // we have to go back into current and make sure that matches
           // are properly marked.
-          current[current.length - 1 - (max - line.Number)].Match = true;
+          var prev = current[current.length - 1 - (max - line.Number)];
+          prev.Match = true;
+          prev.Spans = line.Spans;
         }
       });
     } else {
@@ -612,12 +1182,57 @@ var EscapeHtml = function(text) {
 EscapeHtml.e = document.createElement('div');
 
 /**
- * Produce html for a line using the regexp to highlight matches.
+ * Produce html for a line with the spans the server found the matches at,
+ * which are byte offsets of the UTF-8 encoding of the line.
+ */
+var ContentForSpans = function(content, spans) {
+  var buffer = [],
+      pos = 0,
+      bytes = 0,
+      i = 0;
+
+  // the index in content of a byte offset, counting on from the last.
+  var indexOf = function(offset) {
+    while (i < content.length && bytes < offset) {
+      var c = content.charCodeAt(i);
+      if (c < 0x80) {
+        bytes += 1;
+      } else if (c < 0x800) {
+        bytes += 2;
+      } else if (c >= 0xd800 && c < 0xdc00) {
+        // a surrogate pair is one character of four bytes.
+        bytes += 4;
+        i++;
+      } else {
+        bytes += 3;
+      }
+      i++;
+    }
+    return i;
+  };
+
+  spans.forEach(function(span) {
+    var start = indexOf(span.Start),
+        end = indexOf(span.End);
+    buffer.push(EscapeHtml(content.substring(pos, start)));
+    buffer.push('<em>' + EscapeHtml(content.substring(start, end)) + '</em>');
+    pos = end;
+  });
+  buffer.push(EscapeHtml(content.substring(pos)));
+  return buffer.join('');
+};
+
+/**
+ * Produce html for a line, highlighting the matches at their spans, or
+ * else using the regexp to find them.
  */
 var ContentFor = function(line, regexp) {
   if (!line.Match) {
     return EscapeHtml(line.Content);
   }
+  if (line.Spans) {
+    return ContentForSpans(line.Content, line.Spans);
+  }
   var content = line.Content,
       buffer = [];
 
@@ -636,44 +1251,181 @@ var ContentFor = function(line, regexp) {
   return buffer.join('');
 };
 
+/**
+ * Find the runs of consecutive matching lines of a block, which are
+ * linked to as a range, along with the columns, from 1, where the first
+ * match of the run starts and the last one ends. Runs of a single line
+ * are left out. The result is keyed by the first line of each run.
+ */
+var RangesFor = function(block, regexp) {
+  var ranges = {},
+      run = [];
+
+  var columns = function(content) {
+    var first = null,
+        last = null;
+    regexp.lastIndex = 0;
+    while (true) {
+      var m = regexp.exec(content);
+      if (!m || m[0].length == 0) {
+        break;
+      }
+      if (first === null) {
+        first = m.index + 1;
+      }
+      last = regexp.lastIndex + 1;
+    }
+    regexp.lastIndex = 0;
+    return { first: first || 1, last: last || content.length + 1 };
+  };
+
+  var flush = function() {
+    if (run.length > 1) {
+      var first = run[0],
+          last = run[run.length - 1];
+      ranges[first.Number] = {
+        start: first.Number,
+        end: last.Number,
+        startcol: columns(first.Content).first,
+        endcol: columns(last.Content).last
+      };
+    }
+    run = [];
+  };
+
+  block.forEach(function(line) {
+    if (line.Match) {
+      run.push(line);
+    } else {
+      flush();
+    }
+  });
+  flush();
+
+  return ranges;
+};
+
+/**
+ * A short description of who last changed a line, and when.
+ */
+var BlameFor = function(b) {
+  if (!b) {
+    return '';
+  }
+
+  var date = b.Date ? b.Date.substring(0, 10) : '';
+  return (
+    <span className="blame" title={b.Commit + ' ' + b.Summary}>
+      {b.Author} {date} {b.Commit.substring(0, 8)}
+    </span>
+  );
+};
+
 var FilesView = React.createClass({
+  getInitialState: function() {
+    // the blame of each file that it has been turned on for, by line.
+    return { blame: {} };
+  },
+
   onLoadMore: function(event) {
     Model.LoadMore(this.props.repo);
   },
 
+  onToggleBlame: function(filename, lines, event) {
+    event.preventDefault();
+
+    var _this = this,
+        blame = $.extend({}, this.state.blame);
+    if (blame[filename]) {
+      delete blame[filename];
+      this.setState({ blame: blame });
+      return;
+    }
+
+    blame[filename] = { loading: true };
+    this.setState({ blame: blame });
+
+    Model.Blame(this.props.repo, filename, lines, this.props.rev, function(byLine, error) {
+      var blame = $.extend({}, _this.state.blame);
+      if (!blame[filename]) {
+        return;
+      }
+      blame[filename] = error ? { error: error } : { lines: byLine };
+      _this.setState({ blame: blame });
+    });
+  },
+
   render: function() {
-    var rev = this.props.rev,
+    var _this = this,
+        rev = this.props.rev,
         repo = this.props.repo,
         regexp = this.props.regexp,
         matches = this.props.matches,
         totalMatches = this.props.totalMatches;
     var files = matches.map(function(match, index) {
       var filename = match.Filename,
-          blocks = CoalesceMatches(match.Matches);
+          blocks = CoalesceMatches(match.Matches),
+          blame = _this.state.blame[filename],
+          numbers = [];
       var matches = blocks.map(function(block) {
+        // the lines of a notebook are those of the text of its cells,
+        // and those of a source from a source map aren't in the repo, so
+        // neither can link to the lines of a file.
+        var cell = block[0].Cell,
+            unlinked = cell || match.SourceMap,
+            ranges = unlinked ? {} : RangesFor(block, regexp);
         var lines = block.map(function(line) {
-          var content = ContentFor(line, regexp);
+          var content = ContentFor(line, regexp),
+              range = ranges[line.Number];
+          numbers.push(line.Number);
           return (
             <div className="line">
-              <a href={Model.UrlToRepo(repo, filename, line.Number, rev)}
+              <a href={Model.UrlToRepo(repo, match.SourceMap || filename, unlinked ? null : line.Number, rev)}
                   className="lnum"
                   target="_blank">{line.Number}</a>
+              {blame && blame.lines ? BlameFor(blame.lines[line.Number]) : ''}
               <span className="lval" dangerouslySetInnerHTML={{__html:content}} />
+              {range ? (
+                <a href={Model.UrlToRepo(repo, filename, range, rev)}
+                    className="lrange"
+                    title="Link to the matching lines"
+                    target="_blank">L{range.start}-L{range.end}</a>
+              ) : ''}
             </div>
           );
         });
 
         return (
-          <div className="match">{lines}</div>
+          <div className="match">
+            {cell ? <div className="cell">Cell {cell.Number} &middot; {cell.Type}</div> : ''}
+            {lines}
+          </div>
         );
       });
 
       return (
         <div className="file">
           <div className="title">
-            <a href={Model.UrlToRepo(repo, match.Filename, null, rev)}>
+            <a href={match.URL || Model.UrlToRepo(repo, match.SourceMap || match.Filename, null, rev)}>
               {match.Filename}
             </a>
+            {(match.Owners || []).map(function(owner) {
+              return <span className="owner" title="Owner">{owner}</span>;
+            })}
+            {match.Modified ? (
+              <span className="modified" title={'Last changed ' + match.Modified + (match.Author ? ' by ' + match.Author : '')}>
+                {match.Modified.substring(0, 10)}
+              </span>
+            ) : ''}
+            {match.SourceMap ? (
+              <span className="source-map" title={'An original source in ' + match.SourceMap}>From source map</span>
+            ) : (
+              <a href="#" className="blame-toggle"
+                  onClick={_this.onToggleBlame.bind(_this, filename, numbers)}>
+                {blame ? (blame.loading ? 'Loading blame...' : 'Hide blame') : 'Blame'}
+              </a>
+            )}
+            {blame && blame.error ? <span className="blame-error">{blame.error}</span> : ''}
           </div>
           <div className="file-body">
             {matches}
@@ -682,6 +1434,23 @@ var FilesView = React.createClass({
       );
     });
 
+    // files that weren't indexed, like images, only match by their names.
+    var hits = (this.props.filenameHits || []).map(function(hit) {
+      return (
+        <div className="file filename-hit">
+          <div className="title">
+            <a href={Model.UrlToRepo(repo, hit.Filename, null, rev)}>
+              {hit.Filename}
+            </a>
+            {(hit.Owners || []).map(function(owner) {
+              return <span className="owner" title="Owner">{owner}</span>;
+            })}
+            <span className="not-indexed" title={hit.Reason}>Filename only</span>
+          </div>
+        </div>
+      );
+    });
+
     var more = '';
     if (matches.length < totalMatches) {
       more = (<button className="moar" onClick={this.onLoadMore}>Load all {totalMatches} matches in {Model.NameForRepo(repo)}</button>);
@@ -691,6 +1460,7 @@ var FilesView = React.createClass({
       <div className="files">
       {files}
       {more}
+      {hits}
       </div>
     );
   }
@@ -709,11 +1479,15 @@ var ResultView = React.createClass({
   getInitialState: function() {
     return { results: null };
   },
+  onLoadRest: function() {
+    Model.LoadRest();
+  },
   render: function() {
     if (this.state.error) {
       return (
         <div id="no-result" className="error">
           <strong>ERROR:</strong>{this.state.error}
+          <SuggestionsView suggestions={Model.suggestions} />
         </div>
       );
     }
@@ -721,7 +1495,10 @@ var ResultView = React.createClass({
     if (this.state.results !== null && this.state.results.length === 0) {
       // TODO(knorton): We need something better here. :-(
       return (
-        <div id="no-result">&ldquo;Nothing for you, Dawg.&rdquo;<div>0 results</div></div>
+        <div id="no-result">
+          &ldquo;Nothing for you, Dawg.&rdquo;<div>0 results</div>
+          <SuggestionsView suggestions={Model.suggestions} />
+        </div>
       );
     }
 
@@ -744,12 +1521,22 @@ var ResultView = React.createClass({
               rev={result.Rev}
               repo={result.Repo}
               regexp={regexp}
-              totalMatches={result.FilesWithMatch} />
+              totalMatches={result.FilesWithMatch}
+              filenameHits={result.FilenameHits} />
+          {result.Truncated && result.Truncated.Matches ?
+            <div className="truncated">
+              This repository had more matches than a search returns. Narrow the search to see the rest.
+            </div> : ''}
         </div>
       );
     });
+    var rest = Model.cursor ?
+      <div className="truncated-response">
+        The results were cut short to keep the page from getting too big.
+        <button className="moar" onClick={this.onLoadRest}>Load the rest</button>
+      </div> : '';
     return (
-      <div id="result">{repos}</div>
+      <div id="result">{repos}{rest}</div>
     );
   }
 });
@@ -762,8 +1549,14 @@ var App = React.createClass({
     this.setState({
       q: params.q,
       i: params.i,
+      caseMode: params['case'],
+      word: params.word,
       files: params.files,
-      repos: repos
+      excludeFiles: params.excludeFiles,
+      filter: params.filter,
+      repos: repos,
+      mode: params.mode,
+      within: params.within
     });
 
     var _this = this;
@@ -815,9 +1608,18 @@ var App = React.createClass({
   updateHistory: function(params) {
     var path = location.pathname +
       '?q=' + encodeURIComponent(params.q) +
-      '&i=' + encodeURIComponent(params.i) +
+      '&case=' + encodeURIComponent(params['case']) +
+      '&word=' + encodeURIComponent(params.word) +
       '&files=' + encodeURIComponent(params.files) +
-      '&repos=' + params.repos;
+      '&excludeFiles=' + encodeURIComponent(params.excludeFiles) +
+      '&repos=' + params.repos +
+      '&mode=' + encodeURIComponent(params.mode);
+    (params.within || []).forEach(function(w) {
+      path += '&within=' + encodeURIComponent(w);
+    });
+    (params.filter || []).forEach(function(f) {
+      path += '&filter=' + encodeURIComponent(f);
+    });
     history.pushState({path:path}, '', path);
   },
   render: function() {
@@ -826,8 +1628,14 @@ var App = React.createClass({
         <SearchBar ref="searchBar"
             q={this.state.q}
             i={this.state.i}
+            caseMode={this.state.caseMode}
+            word={this.state.word}
             files={this.state.files}
+            excludeFiles={this.state.excludeFiles}
+            filter={this.state.filter}
             repos={this.state.repos}
+            mode={this.state.mode}
+            within={this.state.within}
             onSearchRequested={this.onSearchRequested} />
         <ResultView ref="resultView" q={this.state.q} />
       </div>
@@ -835,8 +1643,41 @@ var App = React.createClass({
   }
 });
 
-React.renderComponent(
-  <App />,
-  document.getElementById('root')
-);
-Model.Load();
+/**
+ * Load the preferences that the server keeps for the user, if it knows
+ * who they are, before the page is rendered. The repos that they prefer
+ * are searched unless the url says which to search, and the default
+ * scope of the config if they don't prefer any.
+ */
+var LoadPreferences = function(done) {
+  $.ajax({
+    url: 'api/v1/me/preferences',
+    dataType: 'json',
+    success: function(prefs) {
+      Model.prefs = prefs;
+      if (prefs.Theme) {
+        document.body.className += ' theme-' + prefs.Theme;
+      }
+      if (prefs.Repos && prefs.Repos.length > 0 && !/[?&]repos=/.test(location.search)) {
+        var search = location.search ? location.search + '&' : '?';
+        history.replaceState(null, '', location.pathname + search + 'repos=' + prefs.Repos.join(','));
+      }
+    },
+    complete: function() {
+      var repos = Model.scope.Default;
+      if (repos && repos.length > 0 && !/[?&]repos=/.test(location.search)) {
+        var search = location.search ? location.search + '&' : '?';
+        history.replaceState(null, '', location.pathname + search + 'repos=' + repos.join(','));
+      }
+      done();
+    }
+  });
+};
+
+LoadPreferences(function() {
+  React.renderComponent(
+    <App />,
+    document.getElementById('root')
+  );
+  Model.Load();
+});
@@ -0,0 +1,166 @@
+var HealthRow = React.createClass({
+  handleChange: function(event) {
+    this.props.onSelect(this.props.name, event.target.checked);
+  },
+  render: function() {
+    var repo = this.props.repo,
+        changed = repo.LastChange ? new Date(repo.LastChange).toLocaleDateString() : '',
+        failing = repo.FailingSince ? new Date(repo.FailingSince).toLocaleDateString() : '';
+    return (
+      <tr>
+        <td><input type="checkbox" checked={this.props.selected} onChange={this.handleChange} /></td>
+        <td className="name">{this.props.name}</td>
+        <td>{repo.State}</td>
+        <td>{repo.Score}</td>
+        <td>{(repo.Flags || []).join(', ')}</td>
+        <td>{failing}</td>
+        <td>{changed}</td>
+        <td className="reason">{repo.LastError}</td>
+      </tr>
+    );
+  }
+});
+
+var HealthTable = React.createClass({
+  render: function() {
+    var _this = this,
+        names = Object.keys(this.props.repos);
+    if (this.props.loading) {
+      return (<div id="no-result"><img src="images/busy.gif" /><div>Loading...</div></div>);
+    }
+
+    // the least healthy repos first.
+    names.sort(function(a, b) {
+      var sa = _this.props.repos[a].Score,
+          sb = _this.props.repos[b].Score;
+      return sa === sb ? (a < b ? -1 : 1) : sa - sb;
+    });
+
+    var rows = names.map(function(name) {
+      return (
+        <HealthRow
+            name={name}
+            repo={_this.props.repos[name]}
+            selected={!!_this.props.selected[name]}
+            onSelect={_this.props.onSelect} />
+      );
+    });
+
+    return (
+      <table>
+          <thead>
+              <tr>
+                  <th></th>
+                  <th>Repo</th>
+                  <th>State</th>
+                  <th>Score</th>
+                  <th>Flags</th>
+                  <th>Failing Since</th>
+                  <th>Last Change</th>
+                  <th>Last Error</th>
+              </tr>
+          </thead>
+          <tbody className="list">{rows}</tbody>
+      </table>
+    );
+  }
+});
+
+var RepoHealth = React.createClass({
+  getInitialState: function() {
+    this.load(false);
+    return {
+      repos: {},
+      selected: {},
+      all: false,
+      loading: true,
+      message: ''
+    };
+  },
+
+  load: function(all) {
+    var _this = this;
+    $.ajax({
+      url: 'api/v1/admin/health',
+      data: {all: all},
+      dataType: 'json',
+      success: function(data) {
+        _this.setState({ repos: data, selected: {}, loading: false });
+      },
+      error: function(xhr, status, err) {
+        _this.setState({ loading: false, message: 'Failed to load the report: ' + (xhr.responseJSON ? xhr.responseJSON.Error : err) });
+      }
+    });
+  },
+
+  onSelect: function(name, selected) {
+    var s = this.state.selected;
+    s[name] = selected;
+    this.setState({ selected: s });
+  },
+
+  onShowAll: function(event) {
+    this.setState({ all: event.target.checked, loading: true });
+    this.load(event.target.checked);
+  },
+
+  act: function(action) {
+    var _this = this,
+        repos = Object.keys(this.state.selected).filter(function(name) {
+          return _this.state.selected[name];
+        });
+    if (repos.length === 0 || !confirm(action + ' ' + repos.join(', ') + '?')) {
+      return;
+    }
+
+    $.ajax({
+      url: 'api/v1/admin/health',
+      type: 'POST',
+      contentType: 'application/json',
+      data: JSON.stringify({ action: action, repos: repos }),
+      dataType: 'json',
+      success: function(data) {
+        var failed = Object.keys(data).filter(function(name) {
+          return data[name] !== 'ok';
+        }).map(function(name) {
+          return name + ': ' + data[name];
+        });
+        _this.setState({ message: failed.join('; ') });
+        _this.load(_this.state.all);
+      },
+      error: function(xhr, status, err) {
+        _this.setState({ message: 'Failed to ' + action + ': ' + err });
+      }
+    });
+  },
+
+  render: function() {
+    return (
+      <div id="excluded_container">
+        <a href="./">Home</a>
+        <h1>Repo Health</h1>
+
+        <div>
+          <label><input type="checkbox" checked={this.state.all} onChange={this.onShowAll} /> Show every repo</label>
+          <button onClick={this.act.bind(this, 'disable')}>Disable</button>
+          <button onClick={this.act.bind(this, 'enable')}>Enable</button>
+          <button onClick={this.act.bind(this, 'remove')}>Remove</button>
+          <span>{this.state.message}</span>
+        </div>
+
+        <div id="excluded_files" className="table-container">
+          <HealthTable
+              repos={this.state.repos}
+              selected={this.state.selected}
+              loading={this.state.loading}
+              onSelect={this.onSelect} />
+        </div>
+      </div>
+    );
+  }
+});
+
+React.renderComponent(
+  <RepoHealth />,
+  document.getElementById('root')
+);
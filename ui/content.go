@@ -62,5 +62,13 @@ func init() {
 			},
 			tplType: "html",
 		},
+
+		"/repo_health.html": &content{
+			template: "repo_health.tpl.html",
+			sources: []string{
+				"js/repo_health.js",
+			},
+			tplType: "html",
+		},
 	}
 }
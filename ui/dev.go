@@ -0,0 +1,144 @@
+//go:build dev
+
+package ui
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	html_template "html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	text_template "text/template"
+
+	"github.com/hound-search/hound/config"
+)
+
+// DevUI is whether this build can serve the UI from its source tree.
+const DevUI = true
+
+// The directory of the source of this package, which a dev build is run
+// from.
+var _, srcFile, _, _ = runtime.Caller(0)
+var srcDir = filepath.Dir(srcFile)
+
+// An http.Handler for the dev-mode case.
+type devHandler struct {
+	// A simple file server for serving non-template assets
+	http.Handler
+
+	// the collection of templated assets
+	content map[string]*content
+
+	// the root asset dir
+	root string
+
+	// the config we are running on
+	cfg *config.Config
+}
+
+func (h *devHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Path
+
+	// See if we have templated content for this path
+	cr := h.content[p]
+	if cr == nil {
+		// if not, serve up files
+		h.Handler.ServeHTTP(w, r)
+		return
+	}
+
+	// If so, render the HTML
+	w.Header().Set("Content-Type", "text/html;charset=utf-8")
+	if err := renderForDev(w, h.root, cr, h.cfg, r); err != nil {
+		log.Panic(err)
+	}
+}
+
+// Renders a templated asset in dev-mode. This simply embeds external script tags
+// for the source elements.
+func renderForDev(w io.Writer, root string, c *content, cfg *config.Config, r *http.Request) error {
+	var err error
+	// For more context, see: https://github.com/etsy/hound/issues/239
+	switch c.tplType {
+	case "html":
+		// Use html/template to parse the html template
+		c.tpl, err = html_template.ParseFiles(filepath.Join(root, c.template))
+		if err != nil {
+			return err
+		}
+	case "xml", "text":
+		// Use text/template to parse the xml or text templates
+		// We are using text/template here for parsing xml to keep things
+		// consistent with html/template parsing.
+		c.tpl, err = text_template.ParseFiles(filepath.Join(root, c.template))
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.New("invalid tplType for content")
+	}
+
+	json, err := cfg.ToJSONString()
+	if err != nil {
+		return err
+	}
+
+	scope, err := cfg.ScopeToJSONString()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, path := range c.sources {
+		fmt.Fprintf(&buf, "<script src=\"http://localhost:8080/%s\"></script>", path)
+	}
+
+	return c.tpl.Execute(w, map[string]interface{}{
+		"ReactVersion":  ReactVersion,
+		"jQueryVersion": JQueryVersion,
+		"ReposAsJson":   json,
+		"ScopeAsJson":   scope,
+		"Title":         cfg.Title,
+		"Source":        html_template.HTML(buf.String()),
+		"Host":          r.Host,
+		"BasePath":      cfg.BasePath,
+	})
+}
+
+// Used for dev-mode only. Determime the asset directory where
+// we can find all our web files for direct serving.
+func assetDir() string {
+	dir, err := filepath.Abs(
+		filepath.Join(srcDir, "assets"))
+	if err != nil {
+		log.Panic(err)
+	}
+	return dir
+}
+
+// Create an http.Handler for dev-mode.
+func newDevHandler(cfg *config.Config) (http.Handler, error) {
+	root := assetDir()
+	return &devHandler{
+		Handler: http.FileServer(http.Dir(root)),
+		content: contents,
+		root:    root,
+		cfg:     cfg,
+	}, nil
+}
+
+// StartDevServer starts webpack-dev-server, which builds the scripts of
+// the UI as they change and serves them for the pages of the dev handler.
+func StartDevServer() error {
+	webpack := exec.Command("./node_modules/.bin/webpack-dev-server", "--mode", "development")
+	webpack.Dir = filepath.Join(srcDir, "..")
+	webpack.Stdout = os.Stdout
+	webpack.Stderr = os.Stderr
+	return webpack.Start()
+}
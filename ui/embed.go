@@ -0,0 +1,87 @@
+package ui
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"time"
+)
+
+// The assets of the UI and the bundles that webpack builds from their
+// scripts into build/, with make ui. build/ has a .gitignore of its own,
+// so it is never empty and houndd builds before the UI has been.
+//
+//go:embed assets all:build
+var embedded embed.FS
+
+var (
+	assetFiles  = subFS(embedded, "assets")
+	bundleFiles = subFS(embedded, "build")
+
+	// The files of the UI as they are served, with the bundles in place
+	// of the scripts they were built from.
+	files = layers{bundleFiles, assetFiles}
+)
+
+// The embedded files don't have times, so they are served as changed when
+// houndd started.
+var modTime = time.Now()
+
+func subFS(f fs.FS, dir string) fs.FS {
+	s, err := fs.Sub(f, dir)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Several file systems, with the files of each hiding those of the ones
+// after it.
+type layers []fs.FS
+
+func (l layers) Open(name string) (fs.File, error) {
+	for _, f := range l[:len(l)-1] {
+		if r, err := f.Open(name); err == nil {
+			return r, nil
+		}
+	}
+	return l[len(l)-1].Open(name)
+}
+
+// Read a bundle that a page is built from. The source of a bundle isn't
+// served in its place, since browsers can't run it as it is.
+func readBundle(name string) ([]byte, error) {
+	b, err := fs.ReadFile(bundleFiles, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("ui: %s hasn't been built, run make ui first or use -dev-ui", name)
+	}
+	return b, err
+}
+
+// Serve an asset over HTTP. This ensures we get proper support for range
+// requests and if-modified-since checks.
+func serveAsset(w http.ResponseWriter, r *http.Request, name string) {
+	f, err := files.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.ServeContent(w, r, fi.Name(), modTime, rs)
+}
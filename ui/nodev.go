@@ -0,0 +1,25 @@
+//go:build !dev
+
+package ui
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/hound-search/hound/config"
+)
+
+// DevUI is whether this build can serve the UI from its source tree.
+const DevUI = false
+
+var errNoDevUI = errors.New("ui: serving the UI from disk needs a build with -tags dev")
+
+func newDevHandler(cfg *config.Config) (http.Handler, error) {
+	return nil, errNoDevUI
+}
+
+// StartDevServer starts webpack-dev-server, which builds the scripts of
+// the UI as they change and serves them for the pages of the dev handler.
+func StartDevServer() error {
+	return errNoDevUI
+}
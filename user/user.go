@@ -0,0 +1,54 @@
+// Package user tells who made an API call, when hound knows, so that
+// what they keep on the server, like their preferences, follows them.
+// Users are known by the header that an authenticating proxy in front of
+// hound sets, or else by the API token that they presented.
+package user
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// The longest name taken from a header. Longer ones are ignored.
+const maxLen = 256
+
+type key struct{}
+
+// NewContext returns a copy of ctx that carries the name of the user.
+func NewContext(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, key{}, name)
+}
+
+// FromContext returns the name of the user that ctx carries, or "" if the
+// user isn't known.
+func FromContext(ctx context.Context) string {
+	name, _ := ctx.Value(key{}).(string)
+	return name
+}
+
+// ForToken is the name that the users of an API token are known by. It
+// is made from a hash of the token, so it can be stored and logged.
+func ForToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token-" + hex.EncodeToString(sum[:6])
+}
+
+// Handler takes the name of the user that made each request to h from
+// header, if header isn't empty and the request has it. Only a proxy
+// that every request goes through may set the header, since it is
+// believed as it is.
+func Handler(header string, h http.Handler) http.Handler {
+	if header == "" {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name := strings.TrimSpace(r.Header.Get(header)); name != "" && len(name) <= maxLen {
+			r = r.WithContext(NewContext(r.Context(), name))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
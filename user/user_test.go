@@ -0,0 +1,53 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	var seen string
+	h := Handler("X-Forwarded-User", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}))
+
+	tests := map[string]string{
+		"":                            "",
+		"jane":                        "jane",
+		"  jane@example.com ":         "jane@example.com",
+		strings.Repeat("a", maxLen+1): "",
+	}
+	for sent, exp := range tests {
+		r := httptest.NewRequest("GET", "/api/v1/me/preferences", nil)
+		if sent != "" {
+			r.Header.Set("X-Forwarded-User", sent)
+		}
+		seen = "unset"
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		if seen != exp {
+			t.Errorf("%q: expected the user %q, got %q", sent, exp, seen)
+		}
+	}
+
+	// without a header, the header of a request is no one.
+	r := httptest.NewRequest("GET", "/api/v1/me/preferences", nil)
+	r.Header.Set("X-Forwarded-User", "jane")
+	Handler("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	if seen != "" {
+		t.Fatalf("expected the header to be ignored, got %q", seen)
+	}
+}
+
+func TestForToken(t *testing.T) {
+	a, b := ForToken("secret-a"), ForToken("secret-b")
+	if a == b || a != ForToken("secret-a") {
+		t.Fatalf("expected a name of each token, got %q and %q", a, b)
+	}
+	if strings.Contains(a, "secret") {
+		t.Fatalf("expected the token to be hidden, got %q", a)
+	}
+}
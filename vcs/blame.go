@@ -0,0 +1,153 @@
+package vcs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrCannotBlame is returned by Blame for drivers that can't tell who
+// wrote the lines of a file.
+var ErrCannotBlame = errors.New("vcs: the driver cannot blame files")
+
+// BlameLine is the commit that last changed a line of a file.
+type BlameLine struct {
+	Line   int
+	Commit string
+	Author string
+	Date   time.Time
+
+	// The first line of the commit message.
+	Summary string
+}
+
+// Drivers that can blame the files of their working directory implement
+// this.
+type blameDriver interface {
+	blame(dir, rev, path string, lines []int) ([]*BlameLine, error)
+}
+
+// Blame reports on the given lines of a file of the working directory as
+// of rev, which may be empty for the head.
+func (w *WorkDir) Blame(dir, rev, path string, lines []int) ([]*BlameLine, error) {
+	d, ok := w.Driver.(blameDriver)
+	if !ok {
+		return nil, ErrCannotBlame
+	}
+
+	// neither can be mistaken for an option of the command.
+	if strings.HasPrefix(rev, "-") || path == "" {
+		return nil, fmt.Errorf("vcs: invalid revision or path")
+	}
+
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	return d.blame(dir, rev, path, lines)
+}
+
+func (g *GitDriver) blame(dir, rev, path string, lines []int) ([]*BlameLine, error) {
+	args := []string{"blame", "--porcelain"}
+	for _, n := range lines {
+		args = append(args, "-L", fmt.Sprintf("%d,%d", n, n))
+	}
+	if rev != "" {
+		args = append(args, rev)
+	}
+	args = append(args, "--", path)
+
+	cmd, err := g.command(dir, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git blame: %s", msg)
+		}
+		return nil, err
+	}
+
+	return parsePorcelainBlame(out)
+}
+
+// Parse the output of git blame --porcelain. Each line starts with a
+// header of the commit and the line number; the details of a commit only
+// follow the first time it appears.
+func parsePorcelainBlame(out []byte) ([]*BlameLine, error) {
+	commits := map[string]*BlameLine{}
+
+	var res []*BlameLine
+	var cur *BlameLine
+
+	s := bufio.NewScanner(bytes.NewReader(out))
+	s.Buffer(make([]byte, 64*1024), 1<<20)
+	for s.Scan() {
+		line := s.Text()
+
+		// the content of the line ends its entry.
+		if strings.HasPrefix(line, "\t") {
+			if cur != nil {
+				res = append(res, cur)
+				cur = nil
+			}
+			continue
+		}
+
+		if cur == nil {
+			f := strings.Fields(line)
+			if len(f) < 3 {
+				return nil, fmt.Errorf("git blame: unexpected line: %q", line)
+			}
+			n, err := strconv.Atoi(f[2])
+			if err != nil {
+				return nil, fmt.Errorf("git blame: unexpected line: %q", line)
+			}
+
+			c := commits[f[0]]
+			if c == nil {
+				c = &BlameLine{Commit: f[0]}
+				commits[f[0]] = c
+			}
+			entry := *c
+			entry.Line = n
+			cur = &entry
+			continue
+		}
+
+		key, val := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			key, val = line[:i], line[i+1:]
+		}
+
+		c := commits[cur.Commit]
+		switch key {
+		case "author":
+			c.Author = val
+		case "author-time":
+			if t, err := strconv.ParseInt(val, 10, 64); err == nil {
+				c.Date = time.Unix(t, 0).UTC()
+			}
+		case "summary":
+			c.Summary = val
+		default:
+			continue
+		}
+
+		// the details come before the content of the first line of the
+		// commit, so they are copied onto its entry as they arrive.
+		n := cur.Line
+		*cur = *c
+		cur.Line = n
+	}
+
+	return res, s.Err()
+}
@@ -0,0 +1,75 @@
+package vcs
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestParsePorcelainBlame(t *testing.T) {
+	out := []byte("aaaa 1 1 2\n" +
+		"author Ann\n" +
+		"author-time 1600000000\n" +
+		"summary First\n" +
+		"filename main.go\n" +
+		"\tpackage main\n" +
+		"aaaa 2 2\n" +
+		"\t\n" +
+		"bbbb 5 7 1\n" +
+		"author Bob\n" +
+		"summary Second\n" +
+		"filename main.go\n" +
+		"\tfunc main() {}\n")
+
+	lines, err := parsePorcelainBlame(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines))
+	}
+
+	// the details of a commit carry over to its later lines.
+	if l := lines[1]; l.Line != 2 || l.Author != "Ann" || l.Summary != "First" || l.Date.Unix() != 1600000000 {
+		t.Fatalf("unexpected second line: %+v", l)
+	}
+
+	if l := lines[2]; l.Line != 7 || l.Commit != "bbbb" || l.Author != "Bob" {
+		t.Fatalf("unexpected third line: %+v", l)
+	}
+}
+
+func TestGitBlame(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := makeTaggedRepo(t, "v1", "v2")
+	defer os.RemoveAll(repo)
+
+	wd, err := New("git", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines, err := wd.Blame(repo, "", "VERSION", []int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || lines[0].Summary != "v2" || lines[0].Author != "hound" {
+		t.Fatalf("expected the line to be from v2, got %+v", lines)
+	}
+
+	lines, err = wd.Blame(repo, "v1", "VERSION", []int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || lines[0].Summary != "v1" {
+		t.Fatalf("expected the line to be from v1, got %+v", lines)
+	}
+
+	if _, err := wd.Blame(repo, "--output=x", "VERSION", []int{1}); err == nil {
+		t.Fatal("expected a revision that looks like an option to be rejected")
+	}
+}
@@ -17,7 +17,9 @@ func newBzr(b []byte) (Driver, error) {
 	return &BzrDriver{}, nil
 }
 
-type BzrDriver struct{}
+type BzrDriver struct {
+	cmdEnv
+}
 
 func (g *BzrDriver) HeadRev(dir string) (string, error) {
 	cmd := exec.Command(
@@ -46,6 +48,7 @@ func (g *BzrDriver) HeadRev(dir string) (string, error) {
 func (g *BzrDriver) Pull(dir string) (string, error) {
 	cmd := exec.Command("bzr", "pull")
 	cmd.Dir = dir
+	cmd.Env = g.environ()
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		log.Printf("Failed to bzr pull %s, see output below\n%sContinuing...", dir, out)
@@ -63,6 +66,7 @@ func (g *BzrDriver) Clone(dir, url string) (string, error) {
 		url,
 		rep)
 	cmd.Dir = par
+	cmd.Env = g.environ()
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		log.Printf("Failed to clone %s, see output below\n%sContinuing...", url, out)
@@ -72,6 +76,17 @@ func (g *BzrDriver) Clone(dir, url string) (string, error) {
 	return g.HeadRev(dir)
 }
 
+func (g *BzrDriver) tools() [][]string {
+	return [][]string{{"bzr", "--version"}}
+}
+
+func (g *BzrDriver) checkRemote(url string) error {
+	cmd := exec.Command("bzr", "revno", url)
+	cmd.Env = g.environ()
+	_, err := runCheck(cmd)
+	return err
+}
+
 func (g *BzrDriver) SpecialFiles() []string {
 	return []string{
 		".bzr",
@@ -0,0 +1,137 @@
+package vcs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How long a check may take before it is given up on, e.g. when a host
+// doesn't answer or a command waits for a password.
+const checkTimeout = 30 * time.Second
+
+// ErrCannotCheck is returned by CheckRemote for drivers that have no way
+// to reach a remote without cloning it.
+var ErrCannotCheck = errors.New("vcs: the driver cannot check remotes")
+
+// Drivers that run external commands implement this so that an
+// installation can be checked before any repo is cloned.
+type checkDriver interface {
+	// The commands the driver runs, each with the arguments that make
+	// it print its version.
+	tools() [][]string
+
+	// Reach the remote at url with the configured credentials, without
+	// cloning it.
+	checkRemote(url string) error
+}
+
+// The oldest version of each command that has everything the drivers use,
+// e.g. git ls-remote --sort for tag patterns.
+var minToolVersions = map[string]string{
+	"git": "2.18",
+}
+
+var versionPattern = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// Whether version a is older than b, comparing them as dotted numbers.
+func olderVersion(a, b string) bool {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			return x < y
+		}
+	}
+	return false
+}
+
+// Tool is a command that a driver needs.
+type Tool struct {
+	Name string
+
+	// The first line that the command printed about its version.
+	Version string
+
+	// Why the command could not be run, or that it is too old.
+	Err error
+}
+
+// Run a command, giving up on it after the check timeout. The error
+// carries the first line of its output, which is where the commands say
+// what went wrong.
+func runCheck(cmd *exec.Cmd) (string, error) {
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	t := time.AfterFunc(checkTimeout, func() {
+		cmd.Process.Kill()
+	})
+	err := cmd.Wait()
+	timedOut := !t.Stop()
+
+	out := strings.TrimSpace(buf.String())
+	if timedOut {
+		return out, fmt.Errorf("timed out after %s", checkTimeout)
+	} else if err != nil {
+		if first := strings.TrimSpace(strings.SplitN(out, "\n", 2)[0]); first != "" {
+			return out, fmt.Errorf("%s: %s", err, first)
+		}
+		return out, err
+	}
+
+	return out, nil
+}
+
+// Tools reports on each of the commands the driver needs.
+func (w *WorkDir) Tools() []*Tool {
+	d, ok := w.Driver.(checkDriver)
+	if !ok {
+		return nil
+	}
+
+	var res []*Tool
+	for _, args := range d.tools() {
+		t := &Tool{Name: args[0]}
+		out, err := runCheck(exec.Command(args[0], args[1:]...))
+		if err != nil {
+			t.Err = err
+			res = append(res, t)
+			continue
+		}
+
+		t.Version = strings.SplitN(out, "\n", 2)[0]
+		if min := minToolVersions[t.Name]; min != "" {
+			if v := versionPattern.FindString(t.Version); v != "" && olderVersion(v, min) {
+				t.Err = fmt.Errorf("version %s is older than %s", v, min)
+			}
+		}
+		res = append(res, t)
+	}
+	return res
+}
+
+// CheckRemote reaches the remote at url the same way the driver would to
+// clone it, with the same credentials, and reports any failure.
+func (w *WorkDir) CheckRemote(url string) error {
+	d, ok := w.Driver.(checkDriver)
+	if !ok {
+		return ErrCannotCheck
+	}
+	return d.checkRemote(url)
+}
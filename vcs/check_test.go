@@ -0,0 +1,64 @@
+package vcs
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestOlderVersion(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		older bool
+	}{
+		{"2.17.1", "2.18", true},
+		{"2.18", "2.18.0", false},
+		{"2.18.0", "2.18", false},
+		{"2.9", "2.18", true},
+		{"10.0", "2.18", false},
+	}
+
+	for _, test := range tests {
+		if got := olderVersion(test.a, test.b); got != test.older {
+			t.Errorf("olderVersion(%s, %s) = %t, expected %t", test.a, test.b, got, test.older)
+		}
+	}
+}
+
+// Tests that git is found and that remotes are checked without cloning.
+func TestGitCheck(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := makeTaggedRepo(t, "v1")
+	defer os.RemoveAll(repo)
+
+	wd, err := New("git", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tools := wd.Tools()
+	if len(tools) != 1 || tools[0].Name != "git" || tools[0].Version == "" {
+		t.Fatalf("expected the version of git, got %+v", tools)
+	}
+
+	if err := wd.CheckRemote(repo); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := wd.CheckRemote(filepath.Join(repo, "nope")); err == nil {
+		t.Fatal("expected a missing remote to fail the check")
+	}
+
+	wd, err = New("git", []byte(`{"pat-env": "HOUND_TEST_UNSET_TOKEN"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := wd.CheckRemote(repo); err == nil {
+		t.Fatal("expected a missing token to fail the check")
+	}
+}
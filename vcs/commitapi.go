@@ -0,0 +1,162 @@
+package vcs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hound-search/hound/config"
+)
+
+const commitAPITimeout = 30 * time.Second
+
+// Asks a GitHub compatible API for the commit at the head of a branch,
+// sending the ETag of the last answer so that the API can say it hasn't
+// changed without sending it again.
+type commitAPI struct {
+	url     string
+	ref     string
+	headers map[string]string
+	client  *http.Client
+
+	// the last answer.
+	etag, rev string
+}
+
+// The owner/name of the repo at a clone url, which may be an scp style
+// ssh url.
+func repoPath(remote string) (string, error) {
+	path := remote
+	if i := strings.Index(remote, "://"); i >= 0 {
+		u, err := url.Parse(remote)
+		if err != nil {
+			return "", err
+		}
+		path = u.Path
+	} else if i := strings.Index(remote, ":"); i >= 0 {
+		path = remote[i+1:]
+	}
+
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segs) < 2 || segs[len(segs)-2] == "" || segs[len(segs)-1] == "" {
+		return "", fmt.Errorf("vcs: no owner and name in %s", config.RedactURL(remote))
+	}
+
+	owner, name := segs[len(segs)-2], strings.TrimSuffix(segs[len(segs)-1], ".git")
+	return owner + "/" + name, nil
+}
+
+// What is replaced with the password or token of the repo in the headers
+// sent to the commit api.
+const tokenPlaceholder = "{token}"
+
+func newCommitAPI(api, remote, ref string, headers map[string]string) (*commitAPI, error) {
+	path, err := repoPath(remote)
+	if err != nil {
+		return nil, err
+	}
+
+	return &commitAPI{
+		url:     fmt.Sprintf("%s/repos/%s/commits/%s", strings.TrimSuffix(api, "/"), path, url.PathEscape(ref)),
+		ref:     ref,
+		headers: headers,
+		client:  &http.Client{Timeout: commitAPITimeout},
+	}, nil
+}
+
+// Return the commit at the head of the branch, authenticating with user
+// and pass if there is a pass, in the headers that take the token if there
+// are any and as basic auth otherwise.
+func (c *commitAPI) head(user, pass string) (string, error) {
+	req, err := http.NewRequest("GET", c.url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github.sha")
+	if c.etag != "" {
+		req.Header.Set("If-None-Match", c.etag)
+	}
+
+	basic := pass != ""
+	for key, val := range c.headers {
+		if strings.Contains(val, tokenPlaceholder) {
+			val = strings.Replace(val, tokenPlaceholder, pass, -1)
+			basic = false
+		}
+		req.Header.Set(key, val)
+	}
+	if basic {
+		req.SetBasicAuth(user, pass)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNotModified:
+		return c.rev, nil
+	case http.StatusOK:
+	default:
+		return "", fmt.Errorf("vcs: %s from %s", res.Status, c.url)
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	c.rev = strings.TrimSpace(string(b))
+	c.etag = res.Header.Get("ETag")
+	return c.rev, nil
+}
+
+// Whether the commit API says that the branch is still at the head of the
+// working directory, in which case there is nothing to fetch. It says no
+// when it can't tell, including in tag mode and for the default branch of
+// the remote, which is only found out by asking the remote and can change.
+func (g *GitDriver) headUnchanged(dir string) bool {
+	if g.CommitAPI == "" || g.noCommitAPI || g.TagPattern != "" {
+		return false
+	}
+
+	ref := g.Branch
+	if ref == "" {
+		return false
+	}
+
+	if g.commits == nil || g.commits.ref != ref {
+		remote, err := g.remoteURL(dir)
+		if err != nil {
+			return false
+		}
+
+		c, err := newCommitAPI(g.CommitAPI, remote, ref, g.CommitAPIHeaders)
+		if err != nil {
+			log.Printf("Not using the commit api for %s: %s", dir, err)
+			g.noCommitAPI = true
+			return false
+		}
+		g.commits = c
+	}
+
+	user, pass, err := g.credentials()
+	if err != nil {
+		return false
+	}
+
+	rev, err := g.commits.head(user, pass)
+	if err != nil {
+		log.Printf("failed to ask the commit api for the head of %s: %s", dir, err)
+		return false
+	}
+
+	head, err := g.HeadRev(dir)
+	return err == nil && rev == head
+}
@@ -0,0 +1,151 @@
+package vcs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrCannotListCommits is returned by LastCommits for drivers that can't
+// tell when the files of their working directory last changed.
+var ErrCannotListCommits = errors.New("vcs: the driver cannot list the commits of files")
+
+// FileCommit is the last commit that changed a file.
+type FileCommit struct {
+	Time time.Time
+
+	// The author of the commit, as Name <email>.
+	Author string
+}
+
+// Drivers that can find the last commit of every file of their working
+// directory implement this.
+type lastCommitsDriver interface {
+	lastCommits(dir string) (map[string]*FileCommit, error)
+}
+
+// LastCommits finds the last commit of each file of the working directory,
+// by its path relative to dir with forward slashes.
+func (w *WorkDir) LastCommits(dir string) (map[string]*FileCommit, error) {
+	d, ok := w.Driver.(lastCommitsDriver)
+	if !ok {
+		return nil, ErrCannotListCommits
+	}
+	return d.lastCommits(dir)
+}
+
+// The header of each commit in the log, which no path can be taken for.
+const logHeader = "\x00"
+
+// The commits at the edge of the history of a shallow clone, whose parents
+// were never fetched. Git lists every file of one as changed by it.
+func shallowCommits(dir string) (map[string]bool, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ".git", "shallow"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	res := map[string]bool{}
+	for _, h := range strings.Fields(string(data)) {
+		res[h] = true
+	}
+	return res, nil
+}
+
+func (g *GitDriver) lastCommits(dir string) (map[string]*FileCommit, error) {
+	cmd, err := g.command(dir, "ls-files", "-z")
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	tracked := map[string]bool{}
+	for _, p := range bytes.Split(out, []byte{0}) {
+		if len(p) > 0 {
+			tracked[string(p)] = true
+		}
+	}
+
+	shallow, err := shallowCommits(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd, err = g.command(dir, "-c", "core.quotepath=off", "log", "--format=%x00%H %ct %aN <%aE>", "--name-only", "--no-renames")
+	if err != nil {
+		return nil, err
+	}
+	r, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	res, err := parseLastCommits(r, tracked, shallow)
+	if len(res) == len(tracked) {
+		// the rest of the history can't change a thing.
+		cmd.Process.Kill()
+		cmd.Wait()
+		return res, err
+	}
+
+	if werr := cmd.Wait(); err == nil {
+		err = werr
+	}
+	return res, err
+}
+
+// Read a log of commits, newest first, each a header with the hash, the
+// time and the author of the commit followed by the paths it changed, and find the
+// first commit of each of the files in want. It stops once it has all of
+// them. The files of the shallow commits aren't known to have changed
+// then, so they are left out.
+func parseLastCommits(r io.Reader, want, shallow map[string]bool) (map[string]*FileCommit, error) {
+	res := map[string]*FileCommit{}
+
+	var cur *FileCommit
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1024*1024)
+	for s.Scan() && len(res) < len(want) {
+		line := s.Text()
+		if strings.HasPrefix(line, logHeader) {
+			f := strings.SplitN(strings.TrimPrefix(line, logHeader), " ", 3)
+			if len(f) != 3 {
+				return nil, fmt.Errorf("git log: unexpected header %q", line)
+			}
+			secs, err := strconv.ParseInt(f[1], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+
+			cur = nil
+			if !shallow[f[0]] {
+				cur = &FileCommit{Time: time.Unix(secs, 0).UTC(), Author: f[2]}
+			}
+			continue
+		}
+
+		if line == "" || cur == nil || !want[line] {
+			continue
+		}
+		if _, ok := res[line]; !ok {
+			res[line] = cur
+		}
+	}
+	return res, s.Err()
+}
@@ -0,0 +1,77 @@
+package vcs
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLastCommits(t *testing.T) {
+	log := "\x00cccc 1600000300 Jane Doe <jane@example.com>\n\nmain.go\n" +
+		"\x00bbbb 1600000200 Bob <bob@example.com>\n\nmain.go\nREADME.md\ngone.go\n" +
+		"\x00aaaa 1600000100 Bob <bob@example.com>\n\nLICENSE\n" +
+		"\x00ffff 1500000000 Ann <ann@example.com>\n\nmain.go\nREADME.md\nLICENSE\nNOTICE\n"
+
+	// the shallow commit lists every file, so NOTICE isn't known.
+	want := map[string]bool{"main.go": true, "README.md": true, "LICENSE": true, "NOTICE": true}
+	res, err := parseLastCommits(strings.NewReader(log), want, map[string]bool{"ffff": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := map[string]int64{"main.go": 1600000300, "README.md": 1600000200, "LICENSE": 1600000100}
+	if len(res) != len(exp) {
+		t.Fatalf("expected commits for %v, got %v", exp, res)
+	}
+	if a := res["main.go"].Author; a != "Jane Doe <jane@example.com>" {
+		t.Fatalf("expected main.go to have been changed last by Jane, got %q", a)
+	}
+	for name, secs := range exp {
+		if c := res[name]; c == nil || c.Time.Unix() != secs {
+			t.Errorf("expected %s to have last changed at %d, got %+v", name, secs, c)
+		}
+	}
+}
+
+func TestGitLastCommits(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := makeTaggedRepo(t, "v1", "v2")
+	defer os.RemoveAll(repo)
+
+	wd, err := New("git", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := wd.LastCommits(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := res["VERSION"]; len(res) != 1 || c == nil || time.Since(c.Time) > time.Hour || c.Author != "hound <hound@example.com>" {
+		t.Fatalf("expected the last commit of VERSION, got %v", res)
+	}
+
+	// a shallow clone can't tell when files changed before its history.
+	shallow, err := ioutil.TempDir("", "hound-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(shallow)
+
+	if out, err := exec.Command("git", "clone", "-q", "--depth", "1", "file://"+repo, shallow).CombinedOutput(); err != nil {
+		t.Fatalf("git clone: %s\n%s", err, out)
+	}
+	if res, err := wd.LastCommits(shallow); err != nil || len(res) != 0 {
+		t.Fatalf("expected no commits in a shallow clone, got %v, %v", res, err)
+	}
+
+	if _, err := (&WorkDir{&SVNDriver{}}).LastCommits(repo); err != ErrCannotListCommits {
+		t.Fatalf("expected svn to be unable to list commits, got %v", err)
+	}
+}
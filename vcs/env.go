@@ -0,0 +1,35 @@
+package vcs
+
+import "os"
+
+// Drivers that run commands over the network embed this to receive
+// extra environment variables (proxy settings, for instance) that apply
+// to each of their commands.
+type cmdEnv struct {
+	extra []string
+}
+
+func (e *cmdEnv) setEnv(env []string) {
+	e.extra = env
+}
+
+// The environment for a command run by the driver.
+func (e *cmdEnv) environ() []string {
+	return append(os.Environ(), e.extra...)
+}
+
+// Look up a variable in the extra environment, falling back to the
+// environment of the daemon.
+func (e *cmdEnv) getenv(name string) string {
+	for i := len(e.extra) - 1; i >= 0; i-- {
+		kv := e.extra[i]
+		if len(kv) > len(name) && kv[:len(name)] == name && kv[len(name)] == '=' {
+			return kv[len(name)+1:]
+		}
+	}
+	return os.Getenv(name)
+}
+
+type envSetter interface {
+	setEnv(env []string)
+}
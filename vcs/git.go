@@ -2,24 +2,199 @@ package vcs
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
+
+	"github.com/hound-search/hound/config"
 )
 
 const defaultRef = "master"
 
+// The username that is sent along with a personal access token when no
+// username is configured. GitHub, GitLab and Azure DevOps all ignore it.
+const defaultTokenUsername = "hound"
+
+// A credential helper that answers git's "get" requests from the
+// environment so the secret never appears in an argument list or URL.
+const credentialHelper = `!f() { test "$1" = get || return 0; ` +
+	`echo "username=${HOUND_GIT_USERNAME}"; ` +
+	`echo "password=${HOUND_GIT_PASSWORD}"; }; f`
+
 func init() {
 	Register(newGit, "git")
 }
 
-type GitDriver struct{}
+type GitDriver struct {
+	SSHConfig
+	cmdEnv
+
+	// Username for HTTP(S) remotes.
+	Username string `json:"username"`
+
+	// The name of an environment variable holding the password.
+	PasswordEnv string `json:"password-env"`
+
+	// The name of an environment variable holding a personal access token.
+	PatEnv string `json:"pat-env"`
+
+	// The branch to index. This defaults to the branch that HEAD points
+	// at on the remote.
+	Branch string `json:"branch"`
+
+	// When set, index the highest version tag matching this pattern
+	// (e.g. "v*") instead of the head of the branch. The tag is resolved
+	// again on each poll.
+	TagPattern string `json:"tag-pattern"`
+
+	// The url of a GitHub compatible API, like https://api.github.com, to
+	// ask whether the branch has moved before fetching. It answers from
+	// the ETag of its last answer, so a branch that hasn't moved costs a
+	// 304 that GitHub doesn't count against the rate limit.
+	CommitAPI string `json:"commit-api"`
+
+	// Extra headers to send the commit api, for servers that want a
+	// token in a header of their own, like GitLab's Private-Token, rather
+	// than basic auth. {token} in a value is replaced with the password
+	// or token of the repo, and when any of them has it the credentials
+	// aren't also sent as basic auth.
+	CommitAPIHeaders map[string]string `json:"commit-api-headers"`
+
+	// Fetches the whole history of the branch rather than only its head,
+	// which blame and the times that files last changed need.
+	History bool `json:"history"`
+
+	// the tag most recently resolved from TagPattern.
+	tag string
+
+	// the rev that the remote ref pointed at when it was last resolved,
+	// if the remote said.
+	remoteRev string
+
+	// asks CommitAPI for the head of the branch.
+	commits *commitAPI
+
+	// set when CommitAPI can't be used for the remote, which the config
+	// still names.
+	noCommitAPI bool
+
+	// the default branch as reported by the remote.
+	detected string
+
+	// a bare repo holding the objects for all working directories of
+	// this remote, if it is shared with other repos.
+	store string
+}
 
 func newGit(b []byte) (Driver, error) {
-	return &GitDriver{}, nil
+	var d GitDriver
+
+	if b != nil {
+		if err := json.Unmarshal(b, &d); err != nil {
+			return nil, err
+		}
+	}
+
+	return &d, nil
+}
+
+// Resolve the HTTP(S) credentials for this repo. An empty password means
+// that no credentials were configured.
+func (g *GitDriver) credentials() (string, string, error) {
+	name := g.PasswordEnv
+	if name == "" {
+		name = g.PatEnv
+	}
+
+	if name == "" {
+		return "", "", nil
+	}
+
+	pass := os.Getenv(name)
+	if pass == "" {
+		return "", "", fmt.Errorf("vcs: environment variable %s is not set", name)
+	}
+
+	user := g.Username
+	if user == "" {
+		user = defaultTokenUsername
+	}
+
+	return user, pass, nil
+}
+
+// The environment for git commands. This carries the per-repo ssh
+// command and credentials when they are configured.
+func (g *GitDriver) env() ([]string, error) {
+	ssh, err := g.SSHConfig.Command()
+	if err != nil {
+		return nil, err
+	}
+
+	user, pass, err := g.credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	env := g.environ()
+	if ssh != "" {
+		env = append(env, "GIT_SSH_COMMAND="+ssh)
+	}
+
+	if pass != "" {
+		env = append(env,
+			"HOUND_GIT_USERNAME="+user,
+			"HOUND_GIT_PASSWORD="+pass,
+			"GIT_TERMINAL_PROMPT=0")
+	}
+	return env, nil
+}
+
+// Prefix the git arguments with the configuration overrides for this repo.
+func (g *GitDriver) args(args ...string) []string {
+	if g.PasswordEnv == "" && g.PatEnv == "" {
+		return args
+	}
+
+	// The empty helper clears any helpers from the global config so
+	// that ours is the only one consulted.
+	return append([]string{
+		"-c", "credential.helper=",
+		"-c", "credential.helper=" + credentialHelper,
+	}, args...)
+}
+
+func (g *GitDriver) command(dir string, args ...string) (*exec.Cmd, error) {
+	env, err := g.env()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("git", g.args(args...)...)
+	cmd.Dir = dir
+	cmd.Env = env
+	return cmd, nil
+}
+
+func (g *GitDriver) tools() [][]string {
+	return [][]string{{"git", "--version"}}
+}
+
+func (g *GitDriver) checkRemote(url string) error {
+	cmd, err := g.command("", "ls-remote", url, "HEAD")
+	if err != nil {
+		return err
+	}
+	cmd.Env = append(cmd.Env, "GIT_TERMINAL_PROMPT=0")
+
+	_, err = runCheck(cmd)
+	return err
 }
 
 func (g *GitDriver) HeadRev(dir string) (string, error) {
@@ -47,58 +222,291 @@ func (g *GitDriver) HeadRev(dir string) (string, error) {
 	return strings.TrimSpace(buf.String()), cmd.Wait()
 }
 
-func run(desc, dir, cmd string, args ...string) error {
-	c := exec.Command(cmd, args...)
-	c.Dir = dir
+func run(desc string, c *exec.Cmd) error {
 	if out, err := c.CombinedOutput(); err != nil {
 		log.Printf(
 			"Failed to %s %s, see output below\n%sContinuing...",
 			desc,
-			dir,
+			c.Dir,
 			out)
-		return err
+		return gitError(err, out)
 	}
 	return nil
 }
 
+// The credentials of the urls in the messages of git.
+var urlCredentials = regexp.MustCompile(`://[^/@\s]+@`)
+
+// The error of a git command that failed along with what git said went
+// wrong, so that it is in the status of the repo and not just in the log.
+func gitError(err error, out []byte) error {
+	var msgs []string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "fatal:") || strings.HasPrefix(line, "error:") || strings.HasPrefix(line, "remote:") {
+			msgs = append(msgs, urlCredentials.ReplaceAllString(line, "://"))
+		}
+	}
+	if len(msgs) == 0 {
+		return err
+	}
+	return fmt.Errorf("%s: %s", err, strings.Join(msgs, " "))
+}
+
+// Find the newest tag on the remote that matches the tag pattern. Tags are
+// ordered as versions, so v1.10 is considered newer than v1.9.
+func (g *GitDriver) latestTag(dir, remote string) (string, error) {
+	cmd, err := g.command(dir,
+		"ls-remote",
+		"--tags",
+		"--refs",
+		"--sort=-v:refname",
+		remote,
+		g.TagPattern)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		f := strings.Fields(line)
+		if len(f) == 2 && strings.HasPrefix(f[1], "refs/tags/") {
+			g.tag, g.remoteRev = f[1], f[0]
+			return f[1], nil
+		}
+	}
+
+	return "", fmt.Errorf("vcs: no tags matching %s", g.TagPattern)
+}
+
+// Ask the remote which branch its HEAD points at.
+func (g *GitDriver) detectDefaultBranch(dir, remote string) (string, error) {
+	cmd, err := g.command(dir, "ls-remote", "--symref", remote, "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	var detected, rev string
+	for _, line := range strings.Split(string(out), "\n") {
+		f := strings.Fields(line)
+		if len(f) == 3 && f[0] == "ref:" && f[2] == "HEAD" {
+			detected = strings.TrimPrefix(f[1], "refs/heads/")
+		} else if len(f) == 2 && f[1] == "HEAD" {
+			rev = f[0]
+		}
+	}
+
+	if detected == "" {
+		return "", fmt.Errorf("vcs: unable to determine the default branch of %s", config.RedactURL(remote))
+	}
+
+	g.detected, g.remoteRev = detected, rev
+	return detected, nil
+}
+
+// Ask the remote which rev a ref points at.
+func (g *GitDriver) lsRemote(dir, remote, ref string) (string, error) {
+	cmd, err := g.command(dir, "ls-remote", remote, ref)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		f := strings.Fields(line)
+		if len(f) == 2 && f[1] == ref {
+			return f[0], nil
+		}
+	}
+
+	return "", fmt.Errorf("vcs: %s has no %s", config.RedactURL(remote), ref)
+}
+
+// Resolve the remote ref that should be indexed, along with the rev it
+// points at.
+func (g *GitDriver) remoteRef(dir, remote string) (string, error) {
+	g.remoteRev = ""
+
+	if g.TagPattern != "" {
+		return g.latestTag(dir, remote)
+	}
+
+	if g.Branch == "" {
+		if _, err := g.detectDefaultBranch(dir, remote); err != nil {
+			return "", err
+		}
+		return "refs/heads/" + g.branch(), nil
+	}
+
+	ref := "refs/heads/" + g.branch()
+	rev, err := g.lsRemote(dir, remote, ref)
+	if err != nil {
+		return "", err
+	}
+	g.remoteRev = rev
+	return ref, nil
+}
+
+// Whether the working directory is already at the rev the remote ref was
+// resolved to, so there is nothing to fetch. The ref that was fetched last
+// has to be at that rev and the working directory has to have been reset
+// to it.
+func (g *GitDriver) upToDate(dir, ref string) bool {
+	if g.remoteRev == "" {
+		return false
+	}
+
+	cmd, err := g.command(dir, "rev-parse", localRef(ref), localRef(ref)+"^{commit}", "HEAD")
+	if err != nil {
+		return false
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return false
+	}
+
+	revs := strings.Fields(string(out))
+	return len(revs) == 3 && revs[0] == g.remoteRev && revs[1] == revs[2]
+}
+
+// The branch that is being indexed in branch mode.
+func (g *GitDriver) branch() string {
+	if g.Branch != "" {
+		return g.Branch
+	}
+
+	if g.detected != "" {
+		return g.detected
+	}
+
+	return defaultRef
+}
+
+// Ref returns the branch, or the most recently resolved tag in tag
+// mode, that is being indexed.
+func (g *GitDriver) Ref() string {
+	if g.TagPattern != "" {
+		return strings.TrimPrefix(g.tag, "refs/tags/")
+	}
+	return g.branch()
+}
+
+// The local ref under which a fetched remote ref is stored.
+func localRef(ref string) string {
+	if strings.HasPrefix(ref, "refs/tags/") {
+		return ref
+	}
+	return "refs/remotes/origin/" + strings.TrimPrefix(ref, "refs/heads/")
+}
+
 func (g *GitDriver) Pull(dir string) (string, error) {
-	if err := run("git fetch", dir,
-		"git",
-		"fetch",
-		"--prune",
-		"--no-tags",
-		"--depth", "1",
+	if g.store != "" {
+		url, err := g.remoteURL(dir)
+		if err != nil {
+			return "", err
+		}
+		return g.pullFromStore(dir, url)
+	}
+
+	if g.headUnchanged(dir) {
+		return g.HeadRev(dir)
+	}
+
+	ref, err := g.remoteRef(dir, "origin")
+	if err != nil {
+		return "", err
+	}
+
+	if g.upToDate(dir, ref) {
+		return g.HeadRev(dir)
+	}
+
+	args := append([]string{"fetch", "--prune", "--no-tags"}, g.depthArgs(dir)...)
+	cmd, err := g.command(dir, append(args,
 		"origin",
-		fmt.Sprintf("+%s:remotes/origin/%s", defaultRef, defaultRef)); err != nil {
+		fmt.Sprintf("+%s:%s", ref, localRef(ref)))...)
+	if err != nil {
 		return "", err
 	}
 
-	if err := run("git reset", dir,
-		"git",
+	if err := run("git fetch", cmd); err != nil {
+		return "", err
+	}
+
+	cmd, err = g.command(dir,
 		"reset",
 		"--hard",
-		fmt.Sprintf("origin/%s", defaultRef)); err != nil {
+		localRef(ref))
+	if err != nil {
+		return "", err
+	}
+
+	if err := run("git reset", cmd); err != nil {
 		return "", err
 	}
 
 	return g.HeadRev(dir)
 }
 
+// The arguments that limit how much history a clone, or a fetch into the
+// repo at dir, gets: only the head, unless History is set, when a repo
+// that was cloned without it gets the rest.
+func (g *GitDriver) depthArgs(dir string) []string {
+	if !g.History {
+		return []string{"--depth", "1"}
+	}
+	if dir != "" && (exists(filepath.Join(dir, ".git", "shallow")) || exists(filepath.Join(dir, "shallow"))) {
+		return []string{"--unshallow"}
+	}
+	return nil
+}
+
 func (g *GitDriver) Clone(dir, url string) (string, error) {
+	if g.store != "" {
+		return g.cloneFromStore(dir, url)
+	}
+
 	par, rep := filepath.Split(dir)
-	cmd := exec.Command(
-		"git",
-		"clone",
-		"--depth", "1",
-		url,
-		rep)
-	cmd.Dir = par
-	out, err := cmd.CombinedOutput()
+	args := append([]string{"clone"}, g.depthArgs("")...)
+	if g.TagPattern != "" {
+		tag, err := g.latestTag(par, url)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, "--branch", strings.TrimPrefix(tag, "refs/tags/"))
+	} else if g.Branch != "" {
+		args = append(args, "--branch", g.Branch)
+	} else if _, err := g.detectDefaultBranch(par, url); err != nil {
+		// the clone will still check out the remote HEAD, we just
+		// won't know what to call it until the next pull.
+		log.Printf("Failed to detect the default branch of %s: %s", config.RedactURL(url), err)
+	}
+
+	cmd, err := g.command(par, append(args, url, rep)...)
 	if err != nil {
-		log.Printf("Failed to clone %s, see output below\n%sContinuing...", url, out)
 		return "", err
 	}
 
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("Failed to clone %s, see output below\n%sContinuing...", config.RedactURL(url), out)
+		return "", gitError(err, out)
+	}
+
 	return g.HeadRev(dir)
 }
 
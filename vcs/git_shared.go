@@ -0,0 +1,167 @@
+package vcs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Locks for the shared object stores. Several repos fetch into the same
+// store, and git does not cope well with concurrent shallow fetches.
+var (
+	storeLcks   = map[string]*sync.Mutex{}
+	storeLcksMu sync.Mutex
+)
+
+func storeLock(dir string) *sync.Mutex {
+	storeLcksMu.Lock()
+	defer storeLcksMu.Unlock()
+
+	l := storeLcks[dir]
+	if l == nil {
+		l = &sync.Mutex{}
+		storeLcks[dir] = l
+	}
+	return l
+}
+
+func (g *GitDriver) setSharedStore(dir string) {
+	g.store = dir
+}
+
+// The url of the origin remote of a working directory.
+func (g *GitDriver) remoteURL(dir string) (string, error) {
+	cmd, err := g.command(dir, "remote", "get-url", "origin")
+	if err != nil {
+		return "", err
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Fetch the ref from the remote into the shared object store, creating
+// the store if this is the first repo to use it.
+func (g *GitDriver) fetchIntoStore(url, ref string) error {
+	l := storeLock(g.store)
+	l.Lock()
+	defer l.Unlock()
+
+	if !exists(g.store) {
+		cmd, err := g.command("", "init", "--bare", g.store)
+		if err != nil {
+			return err
+		}
+
+		if err := run("git init", cmd); err != nil {
+			return err
+		}
+	}
+
+	args := append([]string{"fetch", "--no-tags"}, g.depthArgs(g.store)...)
+	cmd, err := g.command(g.store, append(args,
+		url,
+		fmt.Sprintf("+%s:%s", ref, ref))...)
+	if err != nil {
+		return err
+	}
+
+	return run("git fetch", cmd)
+}
+
+// Update the working directory from the shared store. The objects are
+// already present through the alternates file, so this only moves refs.
+func (g *GitDriver) pullFromStore(dir, url string) (string, error) {
+	if g.headUnchanged(dir) {
+		return g.HeadRev(dir)
+	}
+
+	ref, err := g.remoteRef(dir, url)
+	if err != nil {
+		return "", err
+	}
+
+	if g.upToDate(dir, ref) {
+		return g.HeadRev(dir)
+	}
+
+	if err := g.fetchIntoStore(url, ref); err != nil {
+		return "", err
+	}
+
+	args := append([]string{"fetch", "--no-tags"}, g.depthArgs(dir)...)
+	cmd, err := g.command(dir, append(args,
+		g.store,
+		fmt.Sprintf("+%s:%s", ref, localRef(ref)))...)
+	if err != nil {
+		return "", err
+	}
+
+	if err := run("git fetch", cmd); err != nil {
+		return "", err
+	}
+
+	cmd, err = g.command(dir,
+		"reset",
+		"--hard",
+		localRef(ref))
+	if err != nil {
+		return "", err
+	}
+
+	if err := run("git reset", cmd); err != nil {
+		return "", err
+	}
+
+	return g.HeadRev(dir)
+}
+
+// Create a working directory that borrows its objects from the shared
+// store rather than keeping a full clone of its own.
+func (g *GitDriver) cloneFromStore(dir, url string) (string, error) {
+	cmd, err := g.command("", "init", dir)
+	if err != nil {
+		return "", err
+	}
+
+	if err := run("git init", cmd); err != nil {
+		return "", err
+	}
+
+	store, err := filepath.Abs(g.store)
+	if err != nil {
+		return "", err
+	}
+
+	alt := filepath.Join(dir, ".git", "objects", "info", "alternates")
+	if err := ioutil.WriteFile(alt,
+		[]byte(filepath.ToSlash(filepath.Join(store, "objects"))+"\n"),
+		0644); err != nil {
+		return "", err
+	}
+
+	cmd, err = g.command(dir, "remote", "add", "origin", url)
+	if err != nil {
+		return "", err
+	}
+
+	if err := run("git remote add", cmd); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	rev, err := g.pullFromStore(dir, url)
+	if err != nil {
+		// leave nothing behind so the next attempt starts over with a clone.
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	return rev, nil
+}
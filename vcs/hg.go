@@ -2,6 +2,7 @@ package vcs
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
 	"io/ioutil"
 	"os/exec"
@@ -13,10 +14,43 @@ func init() {
 	Register(newHg, "hg", "mercurial")
 }
 
-type MercurialDriver struct{}
+const defaultHgBranch = "default"
+
+type MercurialDriver struct {
+	SSHConfig
+	cmdEnv
+
+	// Track a bookmark instead of the default branch.
+	Bookmark string `json:"bookmark"`
+
+	// Track a named branch instead of the default branch.
+	Branch string `json:"branch"`
+}
 
 func newHg(b []byte) (Driver, error) {
-	return &MercurialDriver{}, nil
+	var d MercurialDriver
+
+	if b != nil {
+		if err := json.Unmarshal(b, &d); err != nil {
+			return nil, err
+		}
+	}
+
+	return &d, nil
+}
+
+// Build the arguments for an hg command that talks to the remote,
+// adding the per-repo ssh command when one is configured.
+func (g *MercurialDriver) remoteArgs(args ...string) ([]string, error) {
+	ssh, err := g.SSHConfig.Command()
+	if err != nil {
+		return nil, err
+	}
+
+	if ssh != "" {
+		args = append(args, "--ssh", ssh)
+	}
+	return args, nil
 }
 
 func (g *MercurialDriver) HeadRev(dir string) (string, error) {
@@ -47,25 +81,70 @@ func (g *MercurialDriver) HeadRev(dir string) (string, error) {
 	return strings.TrimSpace(buf.String()), cmd.Wait()
 }
 
+// The bookmark or branch that has been selected in the vcs-config. This
+// is empty when the driver tracks the default branch.
+func (g *MercurialDriver) selected() string {
+	if g.Bookmark != "" {
+		return g.Bookmark
+	}
+	return g.Branch
+}
+
+// Ref returns the bookmark or branch that is being indexed.
+func (g *MercurialDriver) Ref() string {
+	if sel := g.selected(); sel != "" {
+		return sel
+	}
+	return defaultHgBranch
+}
+
 func (g *MercurialDriver) Pull(dir string) (string, error) {
-	cmd := exec.Command("hg", "pull", "-u")
-	cmd.Dir = dir
-	err := cmd.Run()
+	sel := g.selected()
+
+	args := []string{"pull"}
+	if sel == "" {
+		args = append(args, "-u")
+	}
+
+	args, err := g.remoteArgs(args...)
 	if err != nil {
 		return "", err
 	}
 
+	cmd := exec.Command("hg", args...)
+	cmd.Dir = dir
+	cmd.Env = g.environ()
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+
+	if sel != "" {
+		cmd := exec.Command("hg", "update", "--clean", "--rev", sel)
+		cmd.Dir = dir
+		cmd.Env = g.environ()
+		if err := cmd.Run(); err != nil {
+			return "", err
+		}
+	}
+
 	return g.HeadRev(dir)
 }
 
 func (g *MercurialDriver) Clone(dir, url string) (string, error) {
 	par, rep := filepath.Split(dir)
-	cmd := exec.Command(
-		"hg",
-		"clone",
-		url,
-		rep)
+	args := []string{"clone"}
+	if sel := g.selected(); sel != "" {
+		args = append(args, "--updaterev", sel)
+	}
+
+	args, err := g.remoteArgs(append(args, url, rep)...)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command("hg", args...)
 	cmd.Dir = par
+	cmd.Env = g.environ()
 	cmd.Stdout = ioutil.Discard
 	if err := cmd.Run(); err != nil {
 		return "", err
@@ -74,6 +153,22 @@ func (g *MercurialDriver) Clone(dir, url string) (string, error) {
 	return g.HeadRev(dir)
 }
 
+func (g *MercurialDriver) tools() [][]string {
+	return [][]string{{"hg", "--version", "--quiet"}}
+}
+
+func (g *MercurialDriver) checkRemote(url string) error {
+	args, err := g.remoteArgs("identify", "--noninteractive", url)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("hg", args...)
+	cmd.Env = g.environ()
+	_, err = runCheck(cmd)
+	return err
+}
+
 func (g *MercurialDriver) SpecialFiles() []string {
 	return []string{
 		".hg",
@@ -0,0 +1,108 @@
+package vcs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SSHConfig holds the ssh related options that may appear in a repo's
+// vcs-config. These let each repo authenticate with its own deploy key
+// rather than relying on the daemon's global ssh setup.
+type SSHConfig struct {
+	// Path to a private key on disk.
+	KeyPath string `json:"ssh-key-path"`
+
+	// An inline private key. This is written to a private temp file
+	// the first time it is needed.
+	Key string `json:"ssh-key"`
+
+	// Path to a known_hosts file.
+	KnownHostsPath string `json:"ssh-known-hosts-path"`
+
+	// Inline known_hosts entries, one per line.
+	KnownHosts string `json:"ssh-known-hosts"`
+
+	once sync.Once
+	cmd  string
+	err  error
+}
+
+// Quote a value for use in GIT_SSH_COMMAND / ui.ssh, both of which are
+// interpreted by a POSIX shell (git for Windows ships one as well).
+func shellQuote(s string) string {
+	return "'" + strings.Replace(filepath.ToSlash(s), "'", `'\''`, -1) + "'"
+}
+
+// Write inline key material to a temp file that only we can read.
+func writeSecretFile(prefix, data string) (string, error) {
+	f, err := ioutil.TempFile("", prefix)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if err := f.Chmod(0600); err != nil {
+		return "", err
+	}
+
+	if !strings.HasSuffix(data, "\n") {
+		data += "\n"
+	}
+
+	if _, err := f.WriteString(data); err != nil {
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+func (s *SSHConfig) build() (string, error) {
+	keyPath := s.KeyPath
+	if s.Key != "" {
+		p, err := writeSecretFile("hound-key-", s.Key)
+		if err != nil {
+			return "", err
+		}
+		keyPath = p
+	}
+
+	hostsPath := s.KnownHostsPath
+	if s.KnownHosts != "" {
+		p, err := writeSecretFile("hound-known-hosts-", s.KnownHosts)
+		if err != nil {
+			return "", err
+		}
+		hostsPath = p
+	}
+
+	if keyPath == "" && hostsPath == "" {
+		return "", nil
+	}
+
+	args := []string{"ssh"}
+	if keyPath != "" {
+		args = append(args,
+			"-i", shellQuote(keyPath),
+			"-o", "IdentitiesOnly=yes")
+	}
+
+	if hostsPath != "" {
+		args = append(args,
+			"-o", fmt.Sprintf("UserKnownHostsFile=%s", shellQuote(hostsPath)),
+			"-o", "StrictHostKeyChecking=yes")
+	}
+
+	return strings.Join(args, " "), nil
+}
+
+// Command returns the ssh command line that should be used for this
+// repo or an empty string if no ssh options were configured.
+func (s *SSHConfig) Command() (string, error) {
+	s.once.Do(func() {
+		s.cmd, s.err = s.build()
+	})
+	return s.cmd, s.err
+}
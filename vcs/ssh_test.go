@@ -0,0 +1,77 @@
+package vcs
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Tests that the git driver picks up the ssh options from its config.
+func TestGitSSHConfig(t *testing.T) {
+	cfg := `{"ssh-key-path" : "/keys/deploy", "ssh-known-hosts-path" : "/keys/known_hosts"}`
+
+	d, err := New("git", []byte(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	git := d.Driver.(*GitDriver)
+	cmd, err := git.Command()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := "ssh -i '/keys/deploy' -o IdentitiesOnly=yes " +
+		"-o UserKnownHostsFile='/keys/known_hosts' -o StrictHostKeyChecking=yes"
+	if cmd != exp {
+		t.Fatalf("expected ssh command of %q, got %q", exp, cmd)
+	}
+}
+
+// Tests that inline keys are written to a private file.
+func TestSSHInlineKey(t *testing.T) {
+	s := SSHConfig{Key: "-----BEGIN KEY-----"}
+
+	cmd, err := s.Command()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := strings.Split(cmd, "'")
+	if len(f) < 2 {
+		t.Fatalf("expected a quoted key path in %q", cmd)
+	}
+	defer os.Remove(f[1])
+
+	fi, err := os.Stat(f[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fi.Mode().Perm()&0077 != 0 {
+		t.Fatalf("key file is readable by others: %s", fi.Mode())
+	}
+
+	b, err := ioutil.ReadFile(f[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "-----BEGIN KEY-----\n" {
+		t.Fatalf("unexpected key contents: %q", b)
+	}
+}
+
+// Without any ssh options, the default ssh setup should be left alone.
+func TestSSHEmptyConfig(t *testing.T) {
+	var s SSHConfig
+	cmd, err := s.Command()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cmd != "" {
+		t.Fatalf("expected no ssh command, got %q", cmd)
+	}
+}
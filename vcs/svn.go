@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"io"
 	"log"
+	"net/url"
 	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github.com/hound-search/hound/config"
 )
 
 func init() {
@@ -17,6 +20,18 @@ func init() {
 type SVNDriver struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+
+	// Resolve svn:externals definitions rather than ignoring them.
+	Externals bool `json:"externals"`
+
+	// Credentials for externals that live on other servers or repos.
+	ExternalCredentials []*SVNCredential `json:"external-credentials"`
+
+	// Only check out these paths (relative to the repo url) instead of
+	// the whole tree. This is useful for very large repositories.
+	Paths []string `json:"paths"`
+
+	cmdEnv
 }
 
 func newSvn(b []byte) (Driver, error) {
@@ -54,19 +69,116 @@ func (g *SVNDriver) HeadRev(dir string) (string, error) {
 	return strings.TrimSpace(buf.String()), cmd.Wait()
 }
 
-func (g *SVNDriver) Pull(dir string) (string, error) {
-	cmd := exec.Command(
-		"svn",
-		"update",
-		"--ignore-externals",
-		"--username",
-		g.Username,
-		"--password",
-		g.Password)
+// svn does not read the proxy environment variables, so they are
+// translated into the equivalent runtime config options.
+func (g *SVNDriver) proxyArgs() []string {
+	proxy := g.getenv("HTTPS_PROXY")
+	if proxy == "" {
+		proxy = g.getenv("HTTP_PROXY")
+	}
+
+	if proxy == "" {
+		return nil
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil || u.Hostname() == "" {
+		log.Printf("Ignoring invalid proxy url for svn: %s", config.RedactURL(proxy))
+		return nil
+	}
+
+	opt := func(name, val string) []string {
+		return []string{"--config-option", "servers:global:" + name + "=" + val}
+	}
+
+	args := opt("http-proxy-host", u.Hostname())
+	if port := u.Port(); port != "" {
+		args = append(args, opt("http-proxy-port", port)...)
+	}
+
+	if u.User != nil {
+		args = append(args, opt("http-proxy-username", u.User.Username())...)
+		if pass, ok := u.User.Password(); ok {
+			args = append(args, opt("http-proxy-password", pass)...)
+		}
+	}
+
+	if np := g.getenv("NO_PROXY"); np != "" {
+		var hosts []string
+		for _, h := range strings.Split(np, ",") {
+			h = strings.TrimSpace(h)
+			if strings.HasPrefix(h, ".") {
+				h = "*" + h
+			}
+			if h != "" {
+				hosts = append(hosts, h)
+			}
+		}
+		args = append(args, opt("http-proxy-exceptions", strings.Join(hosts, ","))...)
+	}
+
+	return args
+}
+
+// Build an svn command that authenticates with the given credentials.
+func (g *SVNDriver) command(dir string, cred *SVNCredential, args ...string) *exec.Cmd {
+	if cred.Username != "" || cred.Password != "" {
+		args = append(args,
+			"--username",
+			cred.Username,
+			"--password",
+			cred.Password)
+	}
+	cmd := exec.Command("svn", append(args, g.proxyArgs()...)...)
 	cmd.Dir = dir
+	cmd.Env = g.environ()
+	return cmd
+}
+
+// The credentials for the repo itself.
+func (g *SVNDriver) credential() *SVNCredential {
+	return &SVNCredential{
+		Username: g.Username,
+		Password: g.Password,
+	}
+}
+
+func (g *SVNDriver) runCommand(desc, target string, cmd *exec.Cmd) error {
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		log.Printf("Failed to SVN update %s, see output below\n%sContinuing...", dir, out)
+		log.Printf("Failed to %s %s, see output below\n%sContinuing...", desc, config.RedactURL(target), out)
+		return err
+	}
+	return nil
+}
+
+// Bring the configured sparse paths into the working directory. This
+// is idempotent, so it also picks up paths added to the config later.
+func (g *SVNDriver) updatePaths(dir string) error {
+	if len(g.Paths) == 0 {
+		return nil
+	}
+
+	args := []string{"update", "--ignore-externals", "--parents", "--set-depth", "infinity"}
+	for _, p := range g.Paths {
+		args = append(args, filepath.FromSlash(strings.Trim(p, "/")))
+	}
+
+	return g.runCommand("SVN update sparse paths in", dir,
+		g.command(dir, g.credential(), args...))
+}
+
+func (g *SVNDriver) Pull(dir string) (string, error) {
+	if err := g.runCommand("SVN update", dir,
+		g.command(dir, g.credential(), "update", "--ignore-externals")); err != nil {
+		return "", err
+	}
+
+	if err := g.updatePaths(dir); err != nil {
+		return "", err
+	}
+
+	if err := g.pullExternals(dir); err != nil {
 		return "", err
 	}
 
@@ -75,26 +187,40 @@ func (g *SVNDriver) Pull(dir string) (string, error) {
 
 func (g *SVNDriver) Clone(dir, url string) (string, error) {
 	par, rep := filepath.Split(dir)
-	cmd := exec.Command(
-		"svn",
-		"checkout",
-		"--ignore-externals",
-		"--username",
-		g.Username,
-		"--password",
-		g.Password,
-		url,
-		rep)
-	cmd.Dir = par
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("Failed to checkout %s, see output below\n%sContinuing...", url, out)
+
+	args := []string{"checkout", "--ignore-externals"}
+	if len(g.Paths) > 0 {
+		args = append(args, "--depth", "empty")
+	}
+
+	if err := g.runCommand("checkout", url,
+		g.command(par, g.credential(), append(args, url, rep)...)); err != nil {
+		return "", err
+	}
+
+	if err := g.updatePaths(dir); err != nil {
+		return "", err
+	}
+
+	if err := g.pullExternals(dir); err != nil {
 		return "", err
 	}
 
 	return g.HeadRev(dir)
 }
 
+func (g *SVNDriver) tools() [][]string {
+	return [][]string{
+		{"svn", "--version", "--quiet"},
+		{"svnversion", "--version", "--quiet"},
+	}
+}
+
+func (g *SVNDriver) checkRemote(url string) error {
+	_, err := runCheck(g.command("", g.credential(), "info", "--non-interactive", url))
+	return err
+}
+
 func (g *SVNDriver) SpecialFiles() []string {
 	return []string{
 		".svn",
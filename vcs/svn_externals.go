@@ -0,0 +1,274 @@
+package vcs
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SVNCredential holds the credentials that are used for any svn url that
+// starts with URL.
+type SVNCredential struct {
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// A single parsed line of an svn:externals property.
+type svnExternal struct {
+	// The directory that will hold the external, relative to the
+	// directory carrying the property.
+	LocalPath string
+
+	// The fully resolved url of the external (including any peg
+	// revision).
+	URL string
+
+	// An operative revision from -r, if any.
+	Rev string
+}
+
+// The output of svn propget --xml.
+type svnProperties struct {
+	Targets []struct {
+		Path     string `xml:"path,attr"`
+		Property string `xml:"property"`
+	} `xml:"target"`
+}
+
+// Determines whether the token of an externals definition is a url
+// (absolute or one of svn's relative forms) rather than a local path.
+func isSvnURL(s string) bool {
+	return strings.Contains(s, "://") ||
+		strings.HasPrefix(s, "^/") ||
+		strings.HasPrefix(s, "/") ||
+		strings.HasPrefix(s, "../")
+}
+
+// Resolve a possibly relative external url. dirURL is the url of the
+// directory that carries the property and rootURL is the repository root.
+func resolveSvnURL(ref, dirURL, rootURL string) (string, error) {
+	if strings.Contains(ref, "://") {
+		return ref, nil
+	}
+
+	base := dirURL
+	if strings.HasPrefix(ref, "^/") {
+		base, ref = rootURL, ref[2:]
+	}
+
+	b, err := url.Parse(strings.TrimSuffix(base, "/") + "/")
+	if err != nil {
+		return "", err
+	}
+
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+
+	return b.ResolveReference(r).String(), nil
+}
+
+// Parse the value of an svn:externals property. Both the pre-1.5 format
+// (LOCALPATH [-r REV] URL) and the current format ([-r REV] URL[@PEG]
+// LOCALPATH) are supported.
+func parseSvnExternals(prop, dirURL, rootURL string) ([]*svnExternal, error) {
+	var exts []*svnExternal
+	for _, line := range strings.Split(prop, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		var rev string
+		var toks []string
+		f := strings.Fields(line)
+		for i := 0; i < len(f); i++ {
+			switch {
+			case f[i] == "-r" && i+1 < len(f):
+				rev = f[i+1]
+				i++
+			case strings.HasPrefix(f[i], "-r"):
+				rev = f[i][2:]
+			default:
+				toks = append(toks, f[i])
+			}
+		}
+
+		if len(toks) != 2 {
+			return nil, fmt.Errorf("vcs: invalid svn:externals definition: %s", line)
+		}
+
+		ref, local := toks[0], toks[1]
+		if !isSvnURL(ref) {
+			ref, local = local, ref
+		}
+
+		u, err := resolveSvnURL(ref, dirURL, rootURL)
+		if err != nil {
+			return nil, err
+		}
+
+		exts = append(exts, &svnExternal{
+			LocalPath: local,
+			URL:       u,
+			Rev:       rev,
+		})
+	}
+	return exts, nil
+}
+
+// The directory in the working directory dir of an external at local,
+// relative to the directory target. It fails for one that would be outside
+// of dir, like ../x, or dir itself, also through a symlink that is already
+// in the working directory.
+func externalDir(dir, target, local string) (string, error) {
+	dst := filepath.Join(dir, filepath.FromSlash(target), filepath.FromSlash(local))
+	if rel, err := filepath.Rel(dir, dst); err != nil || !isBelow(rel) {
+		return "", fmt.Errorf("vcs: the svn external %s of %s is outside of the working directory", local, target)
+	}
+
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+
+	// what the external will be put in, as far as it already exists.
+	p := dst
+	for !exists(p) {
+		p = filepath.Dir(p)
+	}
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || !(isBelow(rel) || rel == "." && p != dst) {
+		return "", fmt.Errorf("vcs: the svn external %s of %s is outside of the working directory", local, target)
+	}
+
+	return dst, nil
+}
+
+// Whether the relative path rel is of something below the directory it is
+// relative to.
+func isBelow(rel string) bool {
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// Find the credentials for url, preferring the longest matching prefix in
+// external-credentials and falling back to those of the repo itself, but
+// only for an external on the same server as the repo at rootURL. Others
+// get no credentials, so that an external can't send those of the repo to
+// a server of its choosing.
+func (g *SVNDriver) credentialFor(u, rootURL string) *SVNCredential {
+	var best *SVNCredential
+	for _, c := range g.ExternalCredentials {
+		if strings.HasPrefix(u, c.URL) && (best == nil || len(c.URL) > len(best.URL)) {
+			best = c
+		}
+	}
+
+	if best != nil {
+		return best
+	}
+	if sameServer(u, rootURL) {
+		return g.credential()
+	}
+	return &SVNCredential{}
+}
+
+// Whether two urls have the same scheme and host.
+func sameServer(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return ua.Host != "" && strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host)
+}
+
+// Query a single item from svn info on the working directory.
+func (g *SVNDriver) infoItem(dir, target, item string) (string, error) {
+	cmd := g.command(dir, g.credential(), "info", "--show-item", item, target)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Check out or update every external referenced in the working directory.
+// Each external is fetched with its own credentials, which is why this is
+// done here rather than by letting svn follow the externals itself.
+func (g *SVNDriver) pullExternals(dir string) error {
+	if !g.Externals {
+		return nil
+	}
+
+	cmd := g.command(dir, g.credential(), "propget", "svn:externals", "--recursive", "--xml", ".")
+	out, err := cmd.Output()
+	if err != nil {
+		return err
+	}
+
+	var props svnProperties
+	if err := xml.Unmarshal(out, &props); err != nil {
+		return err
+	}
+
+	rootURL, err := g.infoItem(dir, ".", "repos-root-url")
+	if err != nil {
+		return err
+	}
+
+	for _, t := range props.Targets {
+		dirURL, err := g.infoItem(dir, t.Path, "url")
+		if err != nil {
+			return err
+		}
+
+		exts, err := parseSvnExternals(t.Property, dirURL, rootURL)
+		if err != nil {
+			return err
+		}
+
+		for _, ext := range exts {
+			dst, err := externalDir(dir, t.Path, ext.LocalPath)
+			if err != nil {
+				return err
+			}
+			cred := g.credentialFor(ext.URL, rootURL)
+
+			// nested externals are not followed.
+			args := []string{"--ignore-externals"}
+			if ext.Rev != "" {
+				args = append(args, "-r", ext.Rev)
+			}
+
+			if exists(filepath.Join(dst, ".svn")) {
+				err = g.runCommand("SVN update external", dst,
+					g.command(dst, cred, append([]string{"update"}, args...)...))
+			} else {
+				if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+					return err
+				}
+				err = g.runCommand("checkout external", ext.URL,
+					g.command(dir, cred, append(append([]string{"checkout"}, args...), ext.URL, dst)...))
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -1,6 +1,10 @@
 package vcs
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -22,3 +26,153 @@ func TestSvnConfig(t *testing.T) {
 		t.Fatalf("expected password of \"svn_password\", got %s", svn.Password)
 	}
 }
+
+// Tests that proxy settings from the environment are translated into
+// svn config options.
+func TestSvnProxyArgs(t *testing.T) {
+	d, err := New("svn", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.SetEnv([]string{
+		"HTTPS_PROXY=http://bob:pw@proxy.corp:3128",
+		"NO_PROXY=localhost,.corp",
+	})
+
+	args := strings.Join(d.Driver.(*SVNDriver).proxyArgs(), " ")
+	exp := "--config-option servers:global:http-proxy-host=proxy.corp " +
+		"--config-option servers:global:http-proxy-port=3128 " +
+		"--config-option servers:global:http-proxy-username=bob " +
+		"--config-option servers:global:http-proxy-password=pw " +
+		"--config-option servers:global:http-proxy-exceptions=localhost,*.corp"
+	if args != exp {
+		t.Fatalf("expected %q, got %q", exp, args)
+	}
+}
+
+// Tests parsing of both svn:externals formats and relative urls.
+func TestParseSvnExternals(t *testing.T) {
+	prop := `
+# comment
+^/libs/common@1024 common
+-r 21 ../sibling/trunk sibling
+//svn.other.com/repo/lib lib/other
+/repo/tools tools
+third-party/zlib -r148 http://svn.zlib.net/zlib/trunk
+`
+
+	exts, err := parseSvnExternals(prop,
+		"https://svn.example.com/repo/project/trunk",
+		"https://svn.example.com/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []svnExternal{
+		{"common", "https://svn.example.com/repo/libs/common@1024", ""},
+		{"sibling", "https://svn.example.com/repo/project/sibling/trunk", "21"},
+		{"lib/other", "https://svn.other.com/repo/lib", ""},
+		{"tools", "https://svn.example.com/repo/tools", ""},
+		{"third-party/zlib", "http://svn.zlib.net/zlib/trunk", "148"},
+	}
+
+	if len(exts) != len(exp) {
+		t.Fatalf("expected %d externals, got %d", len(exp), len(exts))
+	}
+
+	for i, e := range exp {
+		if *exts[i] != e {
+			t.Errorf("expected %+v, got %+v", e, *exts[i])
+		}
+	}
+}
+
+// Tests that the most specific credentials are used for an external, and
+// that those of the repo are only used on its own server.
+func TestSvnCredentialFor(t *testing.T) {
+	d, err := New("svn", []byte(`{
+		"username" : "main",
+		"password" : "hunter2",
+		"external-credentials" : [
+			{"url" : "https://svn.other.com/", "username" : "other"},
+			{"url" : "https://svn.other.com/secret/", "username" : "secret"}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svn := d.Driver.(*SVNDriver)
+	tests := map[string]string{
+		"https://svn.example.com/repo":       "main",
+		"https://SVN.example.com/libs/x":     "main",
+		"https://svn.other.com/repo":         "other",
+		"https://svn.other.com/secret/trunk": "secret",
+		"https://evil.example.net/repo":      "",
+		"http://svn.example.com/repo":        "",
+	}
+
+	for u, exp := range tests {
+		if c := svn.credentialFor(u, "https://svn.example.com/repo"); c.Username != exp {
+			t.Errorf("expected %q for %s, got %q", exp, u, c.Username)
+		}
+	}
+
+	c := svn.credentialFor("https://evil.example.net/repo", "https://svn.example.com/repo")
+	if c.Password != "" {
+		t.Fatalf("expected no password for an external on another host, got %q", c.Password)
+	}
+	if args := svn.command("", c, "checkout").Args; strings.Contains(strings.Join(args, " "), "--password") {
+		t.Fatalf("expected no credentials on the command line, got %v", args)
+	}
+}
+
+// Tests that externals can't be put outside of the working directory.
+func TestSvnExternalDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hound-svn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wc := filepath.Join(dir, "wc")
+	if err := os.MkdirAll(filepath.Join(wc, "sub"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(dir, filepath.Join(wc, "out")); err != nil {
+		t.Fatal(err)
+	}
+
+	ok := map[[2]string]string{
+		{".", "common"}:         filepath.Join(wc, "common"),
+		{"sub", "lib/other"}:    filepath.Join(wc, "sub", "lib", "other"),
+		{"sub", "../sibling"}:   filepath.Join(wc, "sibling"),
+		{".", "a/../b"}:         filepath.Join(wc, "b"),
+		{"sub/deep", "x"}:       filepath.Join(wc, "sub", "deep", "x"),
+		{".", "new/dirs/on/it"}: filepath.Join(wc, "new", "dirs", "on", "it"),
+	}
+	for args, exp := range ok {
+		dst, err := externalDir(wc, args[0], args[1])
+		if err != nil {
+			t.Errorf("externalDir(%s, %s): %s", args[0], args[1], err)
+		} else if dst != exp {
+			t.Errorf("externalDir(%s, %s): expected %s, got %s", args[0], args[1], exp, dst)
+		}
+	}
+
+	bad := [][2]string{
+		{".", "../escape"},
+		{"sub", "../../escape"},
+		{".", "."},
+		{"sub", ".."},
+		{"..", "x"},
+		{".", "out/escape"},
+		{".", "out"},
+	}
+	for _, args := range bad {
+		if dst, err := externalDir(wc, args[0], args[1]); err == nil {
+			t.Errorf("externalDir(%s, %s): expected an error, got %s", args[0], args[1], dst)
+		}
+	}
+}
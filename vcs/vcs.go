@@ -67,6 +67,46 @@ func exists(path string) bool {
 	return true
 }
 
+// Drivers that index a particular branch, bookmark or tag implement this
+// so that links to the hosted repo can point at the same ref.
+type refDriver interface {
+	Ref() string
+}
+
+// Ref returns the branch, bookmark or tag that is being indexed, or
+// an empty string if the driver cannot tell.
+func (w *WorkDir) Ref() string {
+	if d, ok := w.Driver.(refDriver); ok {
+		return d.Ref()
+	}
+	return ""
+}
+
+// Drivers that can keep the objects for several working directories of
+// the same remote in a single shared store.
+type sharedStoreDriver interface {
+	setSharedStore(dir string)
+}
+
+// UseSharedStore asks the driver to keep its objects in the store at dir,
+// which is shared with other repos pointing at the same remote. It
+// returns false if the driver does not support this.
+func (w *WorkDir) UseSharedStore(dir string) bool {
+	if d, ok := w.Driver.(sharedStoreDriver); ok {
+		d.setSharedStore(dir)
+		return true
+	}
+	return false
+}
+
+// SetEnv adds environment variables to every command the driver runs.
+// Drivers that do not run external commands ignore it.
+func (w *WorkDir) SetEnv(env []string) {
+	if d, ok := w.Driver.(envSetter); ok {
+		d.setEnv(env)
+	}
+}
+
 // A utility method that carries out the common operation of cloning
 // if the working directory is absent and pulling otherwise.
 func (w *WorkDir) PullOrClone(dir, url string) (string, error) {
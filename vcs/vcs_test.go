@@ -1,7 +1,11 @@
 package vcs
 
 import (
+	"path/filepath"
+	"runtime"
 	"testing"
+
+	"github.com/hound-search/hound/config"
 )
 
 // TODO(knorton): Write tests for the vcs interactions
@@ -19,3 +23,46 @@ func TestNilConfigs(t *testing.T) {
 		}
 	}
 }
+
+// Ensure that each of the vcs's declared in the example config are legit.
+func TestExampleConfigVcs(t *testing.T) {
+	_, file, _, _ := runtime.Caller(0)
+	conf := filepath.Join(filepath.Dir(file), "..", "config-example.json")
+
+	var cfg config.Config
+	if err := cfg.LoadFromFile(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, repo := range cfg.Repos {
+		if _, err := New(repo.Vcs, repo.VcsConfig()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Tests that the hg driver reports the selected bookmark or branch.
+func TestHgRef(t *testing.T) {
+	tests := map[string]string{
+		``:                                   "default",
+		`{"branch" : "stable"}`:              "stable",
+		`{"bookmark" : "@"}`:                 "@",
+		`{"bookmark" : "@", "branch" : "x"}`: "@",
+	}
+
+	for cfg, exp := range tests {
+		var b []byte
+		if cfg != "" {
+			b = []byte(cfg)
+		}
+
+		d, err := New("hg", b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ref := d.Ref(); ref != exp {
+			t.Fatalf("expected ref %q for %s, got %q", exp, cfg, ref)
+		}
+	}
+}
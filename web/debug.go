@@ -0,0 +1,124 @@
+package web
+
+import (
+	"crypto/subtle"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"strings"
+
+	"github.com/hound-search/hound/api"
+	"github.com/hound-search/hound/user"
+)
+
+// The prefix under which the diagnostic endpoints are served.
+const debugPrefix = "/debug/"
+
+// Handlers for diagnosing a running houndd: the usual net/http/pprof and
+// expvar endpoints plus dumps of every goroutine's stack and of the heap.
+// They are only reachable with the admin token, and not at all if no
+// token is configured.
+func debugHandler(token string) http.Handler {
+	m := http.NewServeMux()
+	m.HandleFunc("/debug/pprof/", pprof.Index)
+	m.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	m.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	m.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	m.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	m.Handle("/debug/vars", expvar.Handler())
+	m.HandleFunc("/debug/dump/goroutines", dumpGoroutines)
+	m.HandleFunc("/debug/dump/heap", dumpHeap)
+
+	return requireToken(token, m)
+}
+
+// Write the stacks of all goroutines, which is what to look at when an
+// indexer seems stuck.
+func dumpGoroutines(w http.ResponseWriter, r *http.Request) {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(buf)
+}
+
+// Write a heap profile taken right after a collection, so that it only
+// shows what is still live.
+func dumpHeap(w http.ResponseWriter, r *http.Request) {
+	runtime.GC()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="heap.pprof"`)
+	if err := rpprof.WriteHeapProfile(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Only let requests through that carry the token, either as a bearer
+// token or as the password of basic auth so the pprof pages can be
+// browsed.
+func requireToken(token string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !hasToken(r, token) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="hound admin"`)
+			api.WriteError(w, errors.New("Unauthorized, check the admin token"), http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Like requireToken, but for the API, which stays open when there are no
+// tokens and accepts any of them otherwise.
+func requireAPIToken(tokens []string, h http.Handler) http.Handler {
+	if len(tokens) == 0 {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, token := range tokens {
+			if hasToken(r, token) {
+				// the user header of a proxy says who it is, if it is set.
+				if user.FromContext(r.Context()) == "" {
+					r = r.WithContext(user.NewContext(r.Context(), user.ForToken(token)))
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("WWW-Authenticate", `Basic realm="hound"`)
+		api.WriteError(w, errors.New("Unauthorized, check the token"), http.StatusUnauthorized)
+	})
+}
+
+func hasToken(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	got := ""
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		got = strings.TrimPrefix(auth, "Bearer ")
+	} else if _, pass, ok := r.BasicAuth(); ok {
+		got = pass
+	}
+
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
@@ -0,0 +1,62 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugRequiresToken(t *testing.T) {
+	tests := []struct {
+		token  string
+		auth   func(r *http.Request)
+		status int
+	}{
+		{"", func(r *http.Request) {}, http.StatusNotFound},
+		{"", func(r *http.Request) { r.Header.Set("Authorization", "Bearer ") }, http.StatusNotFound},
+		{"secret", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"secret", func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }, http.StatusUnauthorized},
+		{"secret", func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") }, http.StatusOK},
+		{"secret", func(r *http.Request) { r.SetBasicAuth("admin", "secret") }, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		h := debugHandler(test.token)
+		for _, path := range []string{"/debug/vars", "/debug/pprof/", "/debug/dump/goroutines"} {
+			r := httptest.NewRequest("GET", path, nil)
+			test.auth(r)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != test.status {
+				t.Errorf("%s with token %q: expected %d, got %d", path, test.token, test.status, w.Code)
+			}
+		}
+	}
+}
+
+func TestAPIRequiresToken(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		tokens []string
+		auth   func(r *http.Request)
+		status int
+	}{
+		{nil, func(r *http.Request) {}, http.StatusOK},
+		{[]string{"a", "b"}, func(r *http.Request) {}, http.StatusUnauthorized},
+		{[]string{"a", "b"}, func(r *http.Request) { r.Header.Set("Authorization", "Bearer c") }, http.StatusUnauthorized},
+		{[]string{"a", ""}, func(r *http.Request) { r.Header.Set("Authorization", "Bearer ") }, http.StatusUnauthorized},
+		{[]string{"a", "b"}, func(r *http.Request) { r.Header.Set("Authorization", "Bearer b") }, http.StatusOK},
+		{[]string{"a", "b"}, func(r *http.Request) { r.SetBasicAuth("", "a") }, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/api/v1/search", nil)
+		test.auth(r)
+		w := httptest.NewRecorder()
+		requireAPIToken(test.tokens, ok).ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("tokens %q: expected %d, got %d", test.tokens, test.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package web
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/hound-search/hound/config"
+)
+
+// The listeners that houndd serves on: those of the config, or a plain
+// one at addr if it has none.
+func listenersFor(cfg *config.Config, addr string) []*config.Listener {
+	if len(cfg.Listeners) > 0 {
+		return cfg.Listeners
+	}
+	return []*config.Listener{{Addr: addr, Network: config.NetworkTCP}}
+}
+
+// Open the sockets of a listener, which is two of them for a dual-stack
+// one.
+func listen(l *config.Listener) ([]net.Listener, error) {
+	switch l.Network {
+	case config.NetworkTCP, config.NetworkTCP4, config.NetworkTCP6:
+		ln, err := net.Listen(l.Network, l.Addr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{ln}, nil
+	case config.NetworkDual:
+		host, port, err := net.SplitHostPort(l.Addr)
+		if err != nil {
+			return nil, err
+		}
+		if host != "" {
+			return nil, fmt.Errorf("a dual-stack listener listens on every address, so %s can't have a host", l.Addr)
+		}
+
+		// a tcp6 socket on the unspecified address only takes IPv6, so
+		// the two don't collide.
+		ln4, err := net.Listen(config.NetworkTCP4, net.JoinHostPort("0.0.0.0", port))
+		if err != nil {
+			return nil, err
+		}
+		ln6, err := net.Listen(config.NetworkTCP6, net.JoinHostPort("::", port))
+		if err != nil {
+			ln4.Close()
+			return nil, err
+		}
+		return []net.Listener{ln4, ln6}, nil
+	default:
+		return nil, fmt.Errorf("unknown network %q for listener %s, expected %s, %s, %s or %s",
+			l.Network, l.Addr, config.NetworkTCP, config.NetworkTCP4, config.NetworkTCP6, config.NetworkDual)
+	}
+}
+
+// Only answer the health check, wherever the server would.
+func (s *Server) healthCheckOnly() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p := r.URL.Path; p != s.cfg.HealthCheckURI && p != s.cfg.BasePath+s.cfg.HealthCheckURI {
+			http.NotFound(w, r)
+			return
+		}
+		s.ServeHTTP(w, r)
+	})
+}
+
+// The http server of a listener.
+func (s *Server) serverFor(l *config.Listener) (*http.Server, error) {
+	var h http.Handler = s
+	if l.HealthCheckOnly {
+		h = s.healthCheckOnly()
+	}
+
+	srv := &http.Server{
+		Handler:      h,
+		ReadTimeout:  l.ReadTimeout(),
+		WriteTimeout: l.WriteTimeout(),
+		IdleTimeout:  l.IdleTimeout(),
+	}
+
+	if l.TLS() {
+		// loaded now, so that a bad certificate fails at startup rather
+		// than when the listener starts serving.
+		cert, err := tls.LoadX509KeyPair(l.TLSCert, l.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %s", l.Addr, err)
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	return srv, nil
+}
+
+// Listen on every listener and serve on them in the background. Either
+// all of them are listening or, if one of them can't, none are. An error
+// from any of them once they are serving is sent on the channel of the
+// server.
+func (s *Server) listenAll(ls []*config.Listener) error {
+	type serving struct {
+		srv *http.Server
+		ln  net.Listener
+		tls bool
+	}
+
+	var all []serving
+	closeAll := func() {
+		for _, sv := range all {
+			sv.ln.Close()
+		}
+	}
+
+	for _, l := range ls {
+		srv, err := s.serverFor(l)
+		if err != nil {
+			closeAll()
+			return err
+		}
+
+		lns, err := listen(l)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		for _, ln := range lns {
+			all = append(all, serving{srv, ln, l.TLS()})
+			s.lns = append(s.lns, ln)
+		}
+		s.urls = append(s.urls, urlOf(l))
+	}
+
+	s.ch = make(chan error, len(all))
+	for _, sv := range all {
+		go func(sv serving) {
+			if sv.tls {
+				s.ch <- sv.srv.ServeTLS(sv.ln, "", "")
+			} else {
+				s.ch <- sv.srv.Serve(sv.ln)
+			}
+		}(sv)
+	}
+	return nil
+}
+
+// Where a listener can be reached, for the log.
+func urlOf(l *config.Listener) string {
+	host := l.Addr
+	if strings.HasPrefix(host, ":") {
+		host = "localhost" + host
+	}
+
+	scheme := "http"
+	if l.TLS() {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, host)
+}
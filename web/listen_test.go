@@ -0,0 +1,86 @@
+package web
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/hound-search/hound/config"
+)
+
+func TestListeners(t *testing.T) {
+	cfg := &config.Config{
+		HealthCheckURI: "/healthz",
+		Listeners: []*config.Listener{
+			{Addr: "127.0.0.1:0", Network: config.NetworkTCP4, MsReadTimeout: 1000},
+			{Addr: "127.0.0.1:0", Network: config.NetworkTCP, HealthCheckOnly: true},
+		},
+	}
+
+	s, err := Start(cfg, ":0", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, ln := range s.lns {
+			ln.Close()
+		}
+	}()
+
+	if len(s.lns) != 2 {
+		t.Fatalf("expected 2 sockets, got %d", len(s.lns))
+	}
+
+	get := func(i int, path string) (int, string) {
+		res, err := http.Get("http://" + s.lns[i].Addr().String() + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		b, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, string(b)
+	}
+
+	tests := []struct {
+		listener int
+		path     string
+		status   int
+	}{
+		{0, "/healthz", http.StatusOK},
+		// not ready, as there are no indexes yet.
+		{0, "/api/v1/search", http.StatusServiceUnavailable},
+		{1, "/healthz", http.StatusOK},
+		{1, "/api/v1/search", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		if status, body := get(test.listener, test.path); status != test.status {
+			t.Errorf("%d %s: expected %d, got %d: %s", test.listener, test.path, test.status, status, body)
+		}
+	}
+}
+
+func TestListenerErrors(t *testing.T) {
+	tests := []*config.Listener{
+		{Addr: "127.0.0.1:0", Network: "udp"},
+		{Addr: "127.0.0.1:0", Network: config.NetworkDual},
+		{Addr: "127.0.0.1:0", Network: config.NetworkTCP, TLSCert: "missing.pem", TLSKey: "missing.key"},
+	}
+
+	for _, l := range tests {
+		cfg := &config.Config{
+			HealthCheckURI: "/healthz",
+			Listeners: []*config.Listener{
+				{Addr: "127.0.0.1:0", Network: config.NetworkTCP},
+				l,
+			},
+		}
+		if _, err := Start(cfg, ":0", false); err == nil {
+			t.Errorf("%s %s: expected an error", l.Network, l.Addr)
+		}
+	}
+}
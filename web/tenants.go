@@ -0,0 +1,85 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/hound-search/hound/api"
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/searcher"
+)
+
+// ServeTenant starts offering the UI and the API of the tenant with a name
+// under its prefix, with the config that config.ForTenant made for it and
+// the searchers of its repos. Until it is called, the requests of the
+// tenant get a 503 like those of the instance before ServeWithIndex.
+func (s *Server) ServeTenant(name string, cfg *config.Config, set *searcher.Set) error {
+	m, err := s.handlerFor(cfg, set, nil)
+	if err != nil {
+		return err
+	}
+
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	if s.tenants == nil {
+		s.tenants = map[string]http.Handler{}
+	}
+	s.tenants[name] = m
+	return nil
+}
+
+// Hand a request under the prefix of a tenant to it, with the prefix
+// taken off of its path as the base path is.
+func (s *Server) serveTenant(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, config.TenantPrefix)
+	if i := strings.Index(name, "/"); i >= 0 {
+		name = name[:i]
+	}
+
+	if _, ok := s.cfg.Tenants[name]; !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r = stripBasePath(w, r, config.TenantPrefix+name); r == nil {
+		return
+	}
+
+	s.lck.RLock()
+	h := s.tenants[name]
+	s.lck.RUnlock()
+	if h != nil {
+		h.ServeHTTP(w, r)
+	} else if strings.HasPrefix(r.URL.Path, "/api/") {
+		api.WriteError(w,
+			errors.New("Hound is not ready."),
+			http.StatusServiceUnavailable)
+	} else {
+		http.Error(w,
+			"Hound is not ready.",
+			http.StatusServiceUnavailable)
+	}
+}
+
+// Turn away the requests to h past the first n at once with a 429, or let
+// all of them through if n is 0.
+func limitRequests(n int, h http.Handler) http.Handler {
+	if n <= 0 {
+		return h
+	}
+
+	sem := make(chan struct{}, n)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			h.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			api.WriteError(w,
+				errors.New("Too many requests at once, try again shortly."),
+				http.StatusTooManyRequests)
+		}
+	})
+}
@@ -1,14 +1,22 @@
 package web
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 
 	"github.com/hound-search/hound/api"
 	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/federation"
+	"github.com/hound-search/hound/hooks"
+	"github.com/hound-search/hound/reqid"
 	"github.com/hound-search/hound/searcher"
 	"github.com/hound-search/hound/ui"
+	"github.com/hound-search/hound/user"
 )
 
 // Server is an HTTP server that handles all
@@ -20,20 +28,53 @@ type Server struct {
 	dev bool
 	ch  chan error
 
+	// The sockets that the server is listening on, and where each of its
+	// listeners can be reached.
+	lns  []net.Listener
+	urls []string
+
 	mux *http.ServeMux
 	lck sync.RWMutex
+
+	// The handlers of the tenants that are being served, by name.
+	tenants map[string]http.Handler
+
+	// Diagnostics, served even before the indexes are ready.
+	debug http.Handler
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the health check is answered under the base path and at the root,
+	// for load balancers that check hound without the proxy.
+	if base := s.cfg.BasePath; base != "" && r.URL.Path != s.cfg.HealthCheckURI {
+		if r = stripBasePath(w, r, base); r == nil {
+			return
+		}
+	}
+
 	if r.URL.Path == s.cfg.HealthCheckURI {
 		fmt.Fprintln(w, "👍")
 		return
 	}
 
+	if strings.HasPrefix(r.URL.Path, debugPrefix) {
+		s.debug.ServeHTTP(w, r)
+		return
+	}
+
+	if len(s.cfg.Tenants) > 0 && strings.HasPrefix(r.URL.Path, config.TenantPrefix) {
+		s.serveTenant(w, r)
+		return
+	}
+
 	s.lck.RLock()
 	defer s.lck.RUnlock()
 	if m := s.mux; m != nil {
 		m.ServeHTTP(w, r)
+	} else if strings.HasPrefix(r.URL.Path, "/api/") {
+		api.WriteError(w,
+			errors.New("Hound is not ready."),
+			http.StatusServiceUnavailable)
 	} else {
 		http.Error(w,
 			"Hound is not ready.",
@@ -41,45 +82,113 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Take the base path off of the path of the request, so that the handlers
+// all see the paths that they would at the root. The base path itself is
+// sent to the same path with a slash, so that the relative links of the UI
+// resolve under it, and paths outside of it aren't found. It returns the
+// request to handle, or nil if it was answered already.
+func stripBasePath(w http.ResponseWriter, r *http.Request, base string) *http.Request {
+	p := r.URL.Path
+	if p == base {
+		u := *r.URL
+		u.Path = base + "/"
+		http.Redirect(w, r, u.RequestURI(), http.StatusMovedPermanently)
+		return nil
+	}
+
+	if !strings.HasPrefix(p, base+"/") {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = p[len(base):]
+	r2.URL.RawPath = ""
+	return r2
+}
+
 func (s *Server) serveWith(m *http.ServeMux) {
 	s.lck.Lock()
 	defer s.lck.Unlock()
 	s.mux = m
 }
 
-// Start creates a new server that will immediately start handling HTTP traffic.
-// The HTTP server will return 200 on the health check, but a 503 on every other
-// request until ServeWithIndex is called to begin serving search traffic with
-// the given searchers.
-func Start(cfg *config.Config, addr string, dev bool) *Server {
-	ch := make(chan error)
-
+// Start creates a new server that will immediately start handling HTTP traffic
+// on the listeners of the config, or on addr if it has none. The HTTP server
+// will return 200 on the health check, but a 503 on every other request until
+// ServeWithIndex is called to begin serving search traffic with the given
+// searchers. It fails if any of the listeners can't listen.
+func Start(cfg *config.Config, addr string, dev bool) (*Server, error) {
 	s := &Server{
-		cfg: cfg,
-		dev: dev,
-		ch:  ch,
+		cfg:   cfg,
+		dev:   dev,
+		debug: debugHandler(cfg.AdminToken),
+	}
+
+	if err := s.listenAll(listenersFor(cfg, addr)); err != nil {
+		return nil, err
 	}
 
-	go func() {
-		ch <- http.ListenAndServe(addr, s)
-	}()
+	return s, nil
+}
 
-	return s
+// URLs are where each of the listeners of the server can be reached.
+func (s *Server) URLs() []string {
+	return s.urls
 }
 
-// ServeWithIndex allow the server to start offering the search UI and the
-// search APIs operating on the given indexes.
-func (s *Server) ServeWithIndex(idx map[string]*searcher.Searcher) error {
-	h, err := ui.Content(s.dev, s.cfg)
+// The UI and the API of the config cfg, searching set and the downstream
+// instances of fed if it is non-nil.
+func (s *Server) handlerFor(cfg *config.Config, set *searcher.Set, fed *federation.Federation) (*http.ServeMux, error) {
+	h, err := ui.Content(s.dev, cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	m := http.NewServeMux()
 	m.Handle("/", h)
-	api.Setup(m, idx)
+	if err := handleAPI(m, cfg, set, fed); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Add the API of the config cfg to m, behind its tokens.
+func handleAPI(m *http.ServeMux, cfg *config.Config, set *searcher.Set, fed *federation.Federation) error {
+	hk, err := hooks.New(cfg.ResultHooks, cfg.Proxy.Client())
+	if err != nil {
+		return err
+	}
+
+	am := http.NewServeMux()
+	api.Setup(am, set, fed, hk)
+
+	adm := http.NewServeMux()
+	api.SetupAdmin(adm, set)
+
+	m.Handle("/api/", reqid.Handler(user.Handler(cfg.UserHeader, requireAPIToken(cfg.APITokens, limitRequests(cfg.MaxConcurrentRequests, am)))))
+
+	// webhooks can't send API tokens, and pushes are checked against the
+	// push-headers and push-secret-env of their repos instead.
+	m.Handle("/api/v1/update", reqid.Handler(limitRequests(cfg.MaxConcurrentRequests, am)))
+	m.Handle("/api/v1/admin/", reqid.Handler(requireToken(cfg.AdminToken, adm)))
+	return nil
+}
+
+// ServeWithIndex allow the server to start offering the search UI and the
+// search APIs operating on the given indexes, and on the downstream
+// instances of fed if it is non-nil.
+func (s *Server) ServeWithIndex(set *searcher.Set, fed *federation.Federation) error {
+	m, err := s.handlerFor(s.cfg, set, fed)
+	if err != nil {
+		return err
+	}
 
 	s.serveWith(m)
 
+	// the first of the listeners to stop stops the server.
 	return <-s.ch
 }
@@ -0,0 +1,238 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hound-search/hound/config"
+	"github.com/hound-search/hound/searcher"
+)
+
+func TestBasePath(t *testing.T) {
+	m := http.NewServeMux()
+	m.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	})
+
+	s := &Server{
+		cfg: &config.Config{
+			BasePath:       "/hound",
+			HealthCheckURI: "/healthz",
+		},
+		debug: debugHandler(""),
+		mux:   m,
+	}
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/hound/", http.StatusOK, "/"},
+		{"/hound/api/v1/search", http.StatusOK, "/api/v1/search"},
+		{"/hound/open_search.xml", http.StatusOK, "/open_search.xml"},
+		{"/hound", http.StatusMovedPermanently, ""},
+		{"/houndish/", http.StatusNotFound, ""},
+		{"/api/v1/search", http.StatusNotFound, ""},
+		{"/healthz", http.StatusOK, "👍\n"},
+		{"/hound/healthz", http.StatusOK, "👍\n"},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d, got %d", test.path, test.status, w.Code)
+			continue
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s: expected %q, got %q", test.path, test.body, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/hound?q=foo", nil))
+	if loc := w.Header().Get("Location"); loc != "/hound/?q=foo" {
+		t.Fatalf("expected a redirect to /hound/?q=foo, got %q", loc)
+	}
+}
+
+func TestTenants(t *testing.T) {
+	echo := func(who string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(who + " " + r.URL.Path))
+		})
+	}
+
+	s := &Server{
+		cfg: &config.Config{
+			HealthCheckURI: "/healthz",
+			Tenants: map[string]*config.Tenant{
+				"payments": {},
+				"search":   {},
+			},
+		},
+		debug:   debugHandler(""),
+		mux:     http.NewServeMux(),
+		tenants: map[string]http.Handler{"payments": echo("payments")},
+	}
+	s.mux.Handle("/", echo("instance"))
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/", http.StatusOK, "instance /"},
+		{"/t/payments/", http.StatusOK, "payments /"},
+		{"/t/payments/api/v1/search", http.StatusOK, "payments /api/v1/search"},
+		{"/t/payments", http.StatusMovedPermanently, ""},
+		{"/t/search/api/v1/search", http.StatusServiceUnavailable, ""},
+		{"/t/other/", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d, got %d", test.path, test.status, w.Code)
+			continue
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s: expected %q, got %q", test.path, test.body, w.Body.String())
+		}
+	}
+}
+
+func TestLimitRequests(t *testing.T) {
+	in, out := make(chan bool), make(chan bool)
+	h := limitRequests(1, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		in <- true
+		<-out
+	}))
+
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/search", nil))
+		done <- w.Code
+	}()
+	<-in
+
+	// the second request at once is turned away.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/search", nil))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected a 429, got %d", w.Code)
+	}
+
+	out <- true
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("expected the first request to be handled, got %d", code)
+	}
+
+	// and once the first is done, there is room again.
+	go func() {
+		<-in
+		out <- true
+	}()
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/search", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected room for another request, got %d", w.Code)
+	}
+}
+
+// Tests that webhooks can push updates without an API token, as long as
+// they are signed, while the rest of the API still needs one.
+func TestPushWithoutAPIToken(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	tmp, err := ioutil.TempDir("", "hound-web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	if err := os.MkdirAll(src, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=hound", "-c", "user.email=hound@example.com", "commit", "-q", "-m", "main"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = src
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s: %s", args, err, out)
+		}
+	}
+
+	os.Setenv("HOUND_TEST_PUSH_SECRET", "s3cret")
+	defer os.Unsetenv("HOUND_TEST_PUSH_SECRET")
+
+	push := true
+	cfg := &config.Config{
+		DbPath:           filepath.Join(tmp, "db"),
+		APITokens:        []string{"tok"},
+		MaxResponseBytes: 1 << 20,
+	}
+	repo := &config.Repo{URL: src, EnablePushUpdates: &push, PushSecretEnv: "HOUND_TEST_PUSH_SECRET"}
+	cfg.InitRepo(repo)
+	if err := os.MkdirAll(cfg.DbPath, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	srch, err := searcher.New(cfg.DbPath, "a", repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := searcher.NewSet(cfg, map[string]*searcher.Searcher{"a": srch})
+	defer set.Stop()
+
+	m := http.NewServeMux()
+	if err := handleAPI(m, cfg, set, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"repository":{"clone_url":"https://git.example.com/acme/a.git"}}`
+	send := func(secret string) int {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+
+		r := httptest.NewRequest("POST", "/api/v1/update?repos=a", strings.NewReader(body))
+		r.Header.Set("X-GitHub-Event", "push")
+		r.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := send("s3cret"); code != http.StatusOK {
+		t.Fatalf("expected a signed push without a token to be accepted, got %d", code)
+	}
+	if code := send("wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("expected a push with the wrong signature to be refused, got %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/repos", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the rest of the API to need a token, got %d", w.Code)
+	}
+}
@@ -2,8 +2,9 @@ const path = require('path');
 
 module.exports = {
     entry: {
-        'ui/js/hound.js': './ui/assets/js/hound.js',
-        'ui/js/excluded_files.js': './ui/assets/js/excluded_files.js',
+        'js/hound.js': './ui/assets/js/hound.js',
+        'js/excluded_files.js': './ui/assets/js/excluded_files.js',
+        'js/repo_health.js': './ui/assets/js/repo_health.js',
     },
     module: {
         rules: [
@@ -18,6 +19,6 @@ module.exports = {
     },
     output: {
         filename: '[name]',
-        path: path.resolve(__dirname, '.build')
+        path: path.resolve(__dirname, 'ui/build')
     }
 };
\ No newline at end of file